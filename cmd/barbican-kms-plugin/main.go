@@ -28,10 +28,7 @@ import (
 	"k8s.io/klog/v2"
 )
 
-var (
-	socketPath  string
-	cloudConfig string
-)
+var opts server.Options
 
 func main() {
 	cmd := &cobra.Command{
@@ -40,22 +37,32 @@ func main() {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			sigChan := make(chan os.Signal, 1)
 			signal.Notify(sigChan, unix.SIGTERM, unix.SIGINT)
-			err := server.Run(cloudConfig, socketPath, sigChan)
+			err := server.Run(opts, sigChan)
 			return err
 		},
 		Version: version.Version,
 	}
 
-	cmd.PersistentFlags().StringVar(&socketPath, "socketpath", "", "Barbican KMS Plugin unix socket endpoint")
+	cmd.PersistentFlags().StringVar(&opts.SocketPath, "socketpath", "", "Barbican KMS Plugin unix socket endpoint")
 	if err := cmd.MarkPersistentFlagRequired("socketpath"); err != nil {
 		klog.Fatalf("Unable to mark flag socketpath as required: %v", err)
 	}
 
-	cmd.PersistentFlags().StringVar(&cloudConfig, "cloud-config", "", "Barbican KMS Plugin cloud config")
+	cmd.PersistentFlags().StringVar(&opts.CloudConfig, "cloud-config", "", "Barbican KMS Plugin cloud config")
 	if err := cmd.MarkPersistentFlagRequired("cloud-config"); err != nil {
 		klog.Fatalf("Unable to mark flag cloud-config as required: %v", err)
 	}
 
+	cmd.PersistentFlags().DurationVar(&opts.DEKCacheTTL, "dek-cache-ttl", 0, "Duration for which the decrypted DEKs are cached in memory, saving the requests to Barbican when decrypting the data encrypted with the same DEK. The DEKs are not cached if 0.")
+	cmd.PersistentFlags().IntVar(&opts.DEKCacheSize, "dek-cache-size", 1000, "Maximum number of the decrypted DEKs cached in memory.")
+
+	cmd.PersistentFlags().StringVar(&opts.MetricsAddress, "metrics-listen", "", "<address>:<port> to serve the Prometheus metrics on over HTTP, on the /metrics path. The metrics are not served if empty.")
+
+	cmd.PersistentFlags().DurationVar(&opts.CloudConfigReloadInterval, "cloud-config-reload-interval", 0, "Interval the credentials of the cloud config are checked for changes at, and reloaded without restarting the plugin, e.g. when the mounted Secret holding them is rotated. Zero disables the reload.")
+
+	cmd.PersistentFlags().StringVar(&opts.AuditLogPath, "audit-log-path", "", "File the encrypt and decrypt operations are appended to as JSON lines, with the key they use and the process which requested them, '-' means the standard output. The operations are not written if empty.")
+	cmd.PersistentFlags().Float64Var(&opts.AuditSampleRate, "audit-sample-rate", 1, "Fraction of the successful encrypt and decrypt operations written to the audit log, greater than 0 and at most 1. The failed operations are always written.")
+
 	code := cli.Run(cmd)
 	os.Exit(code)
 }
@@ -19,9 +19,11 @@ package main
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/cloud-provider-openstack/pkg/csi"
 	"k8s.io/cloud-provider-openstack/pkg/csi/cinder"
 	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
@@ -42,8 +44,22 @@ var (
 	httpEndpoint             string
 	provideControllerService bool
 	provideNodeService       bool
+	ephemeralVolumes         bool
+	barbicanKeys             bool
 	noClient                 bool
 	withTopology             bool
+	volumeModification       bool
+	modifyVolumeTimeout      time.Duration
+	pvcMetadataAnnotations   []string
+	pvcMetadataLabels        []string
+	orphanCleanupOpts        cinder.OrphanCleanupOpts
+	stuckAttachmentOpts      cinder.StuckAttachmentOpts
+	backendLabelOpts         cinder.BackendLabelOpts
+	attachLimitOpts          cinder.AttachLimitOpts
+	provisionLimitOpts       cinder.ProvisionLimitOpts
+	volumeEvents             bool
+	leaderElectionOpts       cinder.LeaderElectionOpts
+	shutdownGracePeriod      time.Duration
 )
 
 func main() {
@@ -56,7 +72,7 @@ func main() {
 		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
 			f := cmd.Flags()
 
-			if !provideControllerService {
+			if !provideControllerService && !ephemeralVolumes && !barbicanKeys {
 				return nil
 			}
 
@@ -89,6 +105,11 @@ func main() {
 	cmd.Flags().StringSliceVar(&cloudConfig, "cloud-config", nil, "CSI driver cloud config. This option can be given multiple times")
 
 	cmd.PersistentFlags().BoolVar(&withTopology, "with-topology", true, "cluster is topology-aware")
+	cmd.PersistentFlags().BoolVar(&volumeModification, "volume-modification", false, "If set to true then the CSI driver controller service does change the volume type of the volumes according to their VolumeAttributesClass (default: false)")
+	cmd.PersistentFlags().DurationVar(&modifyVolumeTimeout, "volume-modification-timeout", time.Hour, "Duration the controller service waits for the retype of a volume, which may migrate its data to another backend. The csi-resizer --timeout must be at least as long")
+
+	cmd.PersistentFlags().StringSliceVar(&pvcMetadataAnnotations, "pvc-metadata-annotations", nil, "Keys of the PVC annotations copied to the metadata of the created volumes. A key ending with * matches all the keys with the given prefix, e.g. example.com/*. This option can be given multiple times and requires the --pvc-annotations flag")
+	cmd.PersistentFlags().StringSliceVar(&pvcMetadataLabels, "pvc-metadata-labels", nil, "Keys of the PVC labels copied to the metadata of the created volumes. A key ending with * matches all the keys with the given prefix, e.g. example.com/*. This option can be given multiple times and requires the --pvc-annotations flag")
 
 	cmd.PersistentFlags().StringSliceVar(&cloudNames, "cloud-name", []string{""}, "Cloud name to instruct CSI driver to read additional OpenStack cloud credentials from the configuration subsections. This option can be specified multiple times to manage multiple OpenStack clouds.")
 	cmd.PersistentFlags().StringToStringVar(&additionalTopologies, "additional-topology", map[string]string{}, "Additional CSI driver topology keys, for example topology.kubernetes.io/region=REGION1. This option can be specified multiple times to add multiple additional topology keys.")
@@ -96,8 +117,34 @@ func main() {
 	cmd.PersistentFlags().StringVar(&cluster, "cluster", "", "The identifier of the cluster that the plugin is running in.")
 	cmd.PersistentFlags().StringVar(&httpEndpoint, "http-endpoint", "", "The TCP network address where the HTTP server for providing metrics for diagnostics, will listen (example: `:8080`). The default is empty string, which means the server is disabled.")
 
+	cmd.PersistentFlags().DurationVar(&orphanCleanupOpts.Interval, "orphan-cleanup-interval", 0, "Interval at which the controller service looks for the Cinder volumes of the cluster without a PV, and the attachments to the nodes without a VolumeAttachment. Requires --cluster. Zero disables the cleanup (default: 0)")
+	cmd.PersistentFlags().DurationVar(&orphanCleanupOpts.MinAge, "orphan-cleanup-min-age", time.Hour, "Minimum age of the orphaned volumes and attachments, so that the ones being provisioned or attached are not collected")
+	cmd.PersistentFlags().BoolVar(&orphanCleanupOpts.Delete, "orphan-cleanup-delete", false, "If set to true then the orphaned volumes are deleted and the orphaned attachments are detached, otherwise they are only reported (default: false)")
+
+	cmd.PersistentFlags().DurationVar(&stuckAttachmentOpts.Interval, "stuck-attachment-interval", 0, "Interval at which the controller service looks for the VolumeAttachments stuck attaching or detaching. Zero disables the reconciliation (default: 0)")
+	cmd.PersistentFlags().DurationVar(&stuckAttachmentOpts.Threshold, "stuck-attachment-threshold", 10*time.Minute, "Duration after which a VolumeAttachment which is not attached, or not deleted, is stuck")
+	cmd.PersistentFlags().BoolVar(&stuckAttachmentOpts.Repair, "stuck-attachment-repair", false, "If set to true then the stuck VolumeAttachments are retried, and the volumes are detached by force from the deleted servers, otherwise they are only reported (default: false)")
+
+	cmd.PersistentFlags().DurationVar(&backendLabelOpts.Interval, "pv-backend-labels-interval", 0, "Interval at which the controller service labels the PVs with the host, the backend and the pool of their volume, which Cinder only exposes to the administrators. Zero disables the labels (default: 0)")
+
+	cmd.PersistentFlags().IntVar(&attachLimitOpts.MaxConcurrent, "max-concurrent-attach-operations", 0, "Maximum number of concurrent volume attach and detach operations of the controller service. Zero means no limit (default: 0)")
+	cmd.PersistentFlags().IntVar(&attachLimitOpts.MaxConcurrentPerNode, "max-concurrent-attach-operations-per-node", 0, "Maximum number of concurrent volume attach and detach operations of the controller service for a node. Zero means no limit (default: 0)")
+	cmd.PersistentFlags().IntVar(&provisionLimitOpts.MaxConcurrent, "max-concurrent-volume-operations", 0, "Maximum number of concurrent volume creations and deletions of the controller service. Zero means no limit (default: 0)")
+	cmd.PersistentFlags().Float64Var(&provisionLimitOpts.Rate, "volume-operations-rate", 0, "Maximum number of volume creations and deletions started per second by the controller service. Zero means no limit (default: 0)")
+	cmd.PersistentFlags().IntVar(&provisionLimitOpts.Burst, "volume-operations-burst", 1, "Number of volume creations and deletions the controller service can start at once above --volume-operations-rate")
+	cmd.PersistentFlags().BoolVar(&volumeEvents, "volume-events", false, "If set to true then the controller service emits warning events on the PVCs and the pending pods of the volumes which can't be attached, e.g. to a node of another availability zone, and events reporting the progress of the snapshots on their VolumeSnapshots (default: false)")
+
+	cmd.PersistentFlags().BoolVar(&leaderElectionOpts.Enabled, "leader-election", false, "If set to true then the replicas of the controller service elect a leader, which runs the orphan cleanup and the stuck attachments reconciliation, so that several replicas can run. The CSI calls are served by every replica (default: false)")
+	cmd.PersistentFlags().StringVar(&leaderElectionOpts.Namespace, "leader-election-namespace", "", "Namespace of the lease of the leader election. Defaults to the namespace of the pod")
+	cmd.PersistentFlags().DurationVar(&leaderElectionOpts.LeaseDuration, "leader-election-lease-duration", 15*time.Second, "Duration the other replicas wait for before taking over the lease of a leader which stopped renewing it")
+	cmd.PersistentFlags().DurationVar(&leaderElectionOpts.RenewDeadline, "leader-election-renew-deadline", 10*time.Second, "Duration the leader retries renewing the lease for before giving up the leadership")
+	cmd.PersistentFlags().DurationVar(&leaderElectionOpts.RetryPeriod, "leader-election-retry-period", 5*time.Second, "Interval the replicas try to acquire or renew the lease at")
+	cmd.PersistentFlags().DurationVar(&shutdownGracePeriod, "shutdown-grace-period", 25*time.Second, "Duration the in-flight calls are waited for on SIGTERM before they are canceled and retried by another replica. Must be shorter than the terminationGracePeriodSeconds of the pod")
+
 	cmd.PersistentFlags().BoolVar(&provideControllerService, "provide-controller-service", true, "If set to true then the CSI driver does provide the controller service (default: true)")
 	cmd.PersistentFlags().BoolVar(&provideNodeService, "provide-node-service", true, "If set to true then the CSI driver does provide the node service (default: true)")
+	cmd.PersistentFlags().BoolVar(&ephemeralVolumes, "node-service-ephemeral-volumes", false, "If set to true then the CSI driver node service does provide CSI ephemeral inline volumes. This requires OpenStack credentials on the nodes (default: false)")
+	cmd.PersistentFlags().BoolVar(&barbicanKeys, "node-service-barbican-keys", false, "If set to true then the CSI driver node service does get the LUKS keys of the volumes with the luks-key-id parameter from the key manager (Barbican). This requires OpenStack credentials on the nodes (default: false)")
 	cmd.PersistentFlags().BoolVar(&noClient, "node-service-no-os-client", false, "If set to true then the CSI driver node service will not use the OpenStack client (default: false)")
 	cmd.PersistentFlags().MarkDeprecated("node-service-no-os-client", "This flag is deprecated and will be removed in the future. Node service do not use OpenStack credentials anymore.") //nolint:errcheck
 
@@ -108,12 +155,33 @@ func main() {
 }
 
 func handle() {
+	pvcLister := csi.GetPVCLister()
+	if pvcLister == nil && (len(pvcMetadataAnnotations) > 0 || len(pvcMetadataLabels) > 0) {
+		klog.Warning("The --pvc-metadata-annotations and --pvc-metadata-labels flags are ignored without the --pvc-annotations flag")
+	}
+	var nodeLister corelisters.NodeLister
+	if provideControllerService {
+		nodeLister = csi.GetNodeLister()
+	}
+
 	// Initialize cloud
 	d := cinder.NewDriver(&cinder.DriverOpts{
 		Endpoint:     endpoint,
 		ClusterID:    cluster,
-		PVCLister:    csi.GetPVCLister(),
+		PVCLister:    pvcLister,
+		NodeLister:   nodeLister,
 		WithTopology: withTopology,
+
+		VolumeModification:        volumeModification,
+		VolumeModificationTimeout: modifyVolumeTimeout,
+
+		PVCMetadataAnnotations: pvcMetadataAnnotations,
+		PVCMetadataLabels:      pvcMetadataLabels,
+
+		AttachLimits:    attachLimitOpts,
+		ProvisionLimits: provisionLimitOpts,
+
+		ShutdownGracePeriod: shutdownGracePeriod,
 	})
 
 	openstack.InitOpenStackProvider(cloudConfig, httpEndpoint)
@@ -130,6 +198,29 @@ func handle() {
 		}
 
 		d.SetupControllerService(clouds)
+
+		if volumeEvents {
+			d.SetupEvents(csi.GetKubeClient(), csi.GetKubeMetadataClient())
+		}
+
+		if orphanCleanupOpts.Interval > 0 {
+			if cluster == "" {
+				klog.Fatal("The --orphan-cleanup-interval flag requires the --cluster flag")
+			}
+			d.SetupOrphanCleanup(csi.GetKubeClient(), orphanCleanupOpts)
+		}
+
+		if stuckAttachmentOpts.Interval > 0 {
+			d.SetupStuckAttachmentReconciler(csi.GetKubeClient(), stuckAttachmentOpts)
+		}
+
+		if backendLabelOpts.Interval > 0 {
+			d.SetupBackendLabels(csi.GetKubeClient(), backendLabelOpts)
+		}
+
+		if leaderElectionOpts.Enabled {
+			d.SetupLeaderElection(csi.GetKubeClient(), leaderElectionOpts)
+		}
 	}
 
 	if provideNodeService {
@@ -146,6 +237,26 @@ func handle() {
 		metadata := metadata.GetMetadataProvider(cfg.Metadata.SearchOrder)
 
 		d.SetupNodeService(mount, metadata, cfg.BlockStorage, additionalTopologies)
+
+		if ephemeralVolumes {
+			// ephemeral volumes have no secrets, so they are managed in the first cloud
+			cloud, err := openstack.GetOpenStackProvider(cloudNames[0])
+			if err != nil {
+				klog.Warningf("Failed to GetOpenStackProvider %s: %v", cloudNames[0], err)
+				return
+			}
+			d.SetupNodeEphemeralVolumes(cloud)
+		}
+
+		if barbicanKeys {
+			// the keys are held by the key manager of the first cloud
+			cloud, err := openstack.GetOpenStackProvider(cloudNames[0])
+			if err != nil {
+				klog.Warningf("Failed to GetOpenStackProvider %s: %v", cloudNames[0], err)
+				return
+			}
+			d.SetupNodeKeyManager(cloud)
+		}
 	}
 
 	d.Run()
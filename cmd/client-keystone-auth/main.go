@@ -18,6 +18,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -25,6 +26,7 @@ import (
 	"time"
 
 	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/tokens"
 	"github.com/gophercloud/utils/v2/openstack/clientconfig"
 	"github.com/spf13/cobra"
 	"k8s.io/component-base/cli"
@@ -65,9 +67,10 @@ func promptForString(field string, r io.Reader, show bool) (result string, err e
 	return result, err
 }
 
-// prompt pulls keystone auth url, domain, project, username and password from stdin,
-// if they are not specified initially (i.e. equal "").
-func prompt(url string, domain string, user string, project string, password string, applicationCredentialID string, applicationCredentialName string, applicationCredentialSecret string) (gophercloud.AuthOptions, error) {
+// prompt pulls keystone auth url, domain, project and username from stdin,
+// if they are not specified initially (i.e. equal ""). The password is prompted
+// for by promptForPassword, only if no token is cached.
+func prompt(url string, domain string, user string, project string, password string, applicationCredentialID string, applicationCredentialName string, applicationCredentialSecret string, trustID string) (gophercloud.AuthOptions, error) {
 	var err error
 	var options gophercloud.AuthOptions
 
@@ -92,20 +95,13 @@ func prompt(url string, domain string, user string, project string, password str
 		}
 	}
 
-	if project == "" && applicationCredentialID == "" && applicationCredentialName == "" {
+	if project == "" && applicationCredentialID == "" && applicationCredentialName == "" && trustID == "" {
 		project, err = promptForString("project name", os.Stdin, true)
 		if err != nil {
 			return options, err
 		}
 	}
 
-	if password == "" && applicationCredentialID == "" && applicationCredentialName == "" {
-		password, err = promptForString("password", nil, false)
-		if err != nil {
-			return options, err
-		}
-	}
-
 	options = gophercloud.AuthOptions{
 		IdentityEndpoint:            url,
 		Username:                    user,
@@ -120,16 +116,18 @@ func prompt(url string, domain string, user string, project string, password str
 	return options, nil
 }
 
-func argumentsAreSet(url, user, project, password, domain, applicationCredentialID, applicationCredentialName, applicationCredentialSecret string) bool {
+func argumentsAreSet(url, user, project, password, domain, applicationCredentialID, applicationCredentialName, applicationCredentialSecret, trustID string) bool {
 	if url == "" {
 		return false
 	}
 
-	if user != "" && project != "" && domain != "" && password != "" {
+	// The trust-scoped tokens are scoped to the project of the trust
+	if user != "" && (project != "" || trustID != "") && domain != "" && password != "" {
 		return true
 	}
 
-	if applicationCredentialID != "" && applicationCredentialName != "" && applicationCredentialSecret != "" {
+	// An application credential is identified by its ID, or by its name and the name of its user
+	if applicationCredentialSecret != "" && (applicationCredentialID != "" || (applicationCredentialName != "" && user != "" && domain != "")) {
 		return true
 	}
 
@@ -142,6 +140,12 @@ var (
 	user                        string
 	project                     string
 	password                    string
+	tokenCache                  bool
+	tokenCacheDir               string
+	tokenRenewBefore            time.Duration
+	cloud                       string
+	trustID                     string
+	passcode                    string
 	clientCertPath              string
 	clientKeyPath               string
 	clientCAPath                string
@@ -167,6 +171,12 @@ func main() {
 	cmd.PersistentFlags().StringVar(&user, "user-name", os.Getenv("OS_USERNAME"), "User name")
 	cmd.PersistentFlags().StringVar(&project, "project-name", os.Getenv("OS_PROJECT_NAME"), "Keystone project name")
 	cmd.PersistentFlags().StringVar(&password, "password", os.Getenv("OS_PASSWORD"), "Password")
+	cmd.PersistentFlags().StringVar(&passcode, "passcode", os.Getenv("OS_PASSCODE"), "TOTP passcode, prompted for if required by Keystone and not set")
+	cmd.PersistentFlags().StringVar(&trustID, "trust-id", os.Getenv("OS_TRUST_ID"), "ID of the trust to scope the token to, the user being the trustee")
+	cmd.PersistentFlags().StringVar(&cloud, "cloud", os.Getenv("OS_CLOUD"), "Name of the cloud in clouds.yaml to read the credentials from")
+	cmd.PersistentFlags().BoolVar(&tokenCache, "token-cache", true, "Cache the tokens on disk and reuse them until they are to be renewed")
+	cmd.PersistentFlags().StringVar(&tokenCacheDir, "token-cache-dir", keystone.DefaultTokenCacheDir(), "Directory of the cached tokens")
+	cmd.PersistentFlags().DurationVar(&tokenRenewBefore, "token-renew-before", 5*time.Minute, "How long before their expiry the tokens are renewed")
 	cmd.PersistentFlags().StringVar(&clientCertPath, "cert", os.Getenv("OS_CERT"), "Client certificate bundle file")
 	cmd.PersistentFlags().StringVar(&clientKeyPath, "key", os.Getenv("OS_KEY"), "Client certificate key file")
 	cmd.PersistentFlags().StringVar(&clientCAPath, "cacert", os.Getenv("OS_CACERT"), "Certificate authority file")
@@ -179,11 +189,17 @@ func main() {
 }
 
 func handle(ctx context.Context) {
-	// Generate Gophercloud Auth Options based on input data from stdin
-	// if IsTerminal returns "true", or from env variables otherwise.
-	if !term.IsTerminal(int(os.Stdin.Fd())) {
+	// Generate Gophercloud Auth Options based on the cloud in clouds.yaml if it is set,
+	// on input data from stdin if IsTerminal returns "true", or from env variables otherwise.
+	if cloud != "" {
+		options, err = cloudOptions(cloud)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read cloud %s from clouds.yaml: %s\n", cloud, err)
+			os.Exit(1)
+		}
+	} else if !term.IsTerminal(int(os.Stdin.Fd())) {
 		// If all required arguments are set use them
-		if argumentsAreSet(url, user, project, password, domain, applicationCredentialID, applicationCredentialName, applicationCredentialSecret) {
+		if argumentsAreSet(url, user, project, password, domain, applicationCredentialID, applicationCredentialName, applicationCredentialSecret, trustID) {
 			options.AuthOptions = gophercloud.AuthOptions{
 				IdentityEndpoint:            url,
 				Username:                    user,
@@ -204,28 +220,141 @@ func handle(ctx context.Context) {
 			options.AuthOptions = *authOpts
 		}
 	} else {
-		options.AuthOptions, err = prompt(url, domain, user, project, password, applicationCredentialID, applicationCredentialName, applicationCredentialSecret)
+		options.AuthOptions, err = prompt(url, domain, user, project, password, applicationCredentialID, applicationCredentialName, applicationCredentialSecret, trustID)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to read data from console: %s\n", err)
 			os.Exit(1)
 		}
 	}
 
-	options.ClientCertPath = clientCertPath
-	options.ClientKeyPath = clientKeyPath
-	options.ClientCAPath = clientCAPath
+	if clientCertPath != "" {
+		options.ClientCertPath = clientCertPath
+	}
+	if clientKeyPath != "" {
+		options.ClientKeyPath = clientKeyPath
+	}
+	if clientCAPath != "" {
+		options.ClientCAPath = clientCAPath
+	}
+	if passcode != "" {
+		options.AuthOptions.Passcode = passcode
+	}
+	if trustID != "" {
+		options.AuthOptions.Scope = &gophercloud.AuthScope{TrustID: trustID}
+	}
 
-	token, err := keystone.GetToken(ctx, options)
-	if err != nil {
-		if gophercloud.ResponseCodeIs(err, http.StatusUnauthorized) {
-			fmt.Println(errRespTemplate)
-			os.Stderr.WriteString("Invalid user credentials were provided\n")
-			os.Exit(0)
+	var cache *keystone.TokenFileCache
+	if tokenCache && tokenCacheDir != "" {
+		cache = &keystone.TokenFileCache{Dir: tokenCacheDir, RenewBefore: tokenRenewBefore}
+	}
+
+	var token *tokens.Token
+	if cache != nil {
+		token = cache.Get(options)
+	}
+
+	if token == nil {
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			if err := promptForPassword(&options.AuthOptions); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to read data from console: %s\n", err)
+				os.Exit(1)
+			}
 		}
-		fmt.Fprintf(os.Stderr, "An error occurred: %v\n", err)
-		os.Exit(1)
+
+		token, err = getToken(ctx, options)
+		if err != nil {
+			if gophercloud.ResponseCodeIs(err, http.StatusUnauthorized) {
+				fmt.Println(errRespTemplate)
+				os.Stderr.WriteString("Invalid user credentials were provided\n")
+				os.Exit(0)
+			}
+			fmt.Fprintf(os.Stderr, "An error occurred: %v\n", err)
+			os.Exit(1)
+		}
+
+		if cache != nil {
+			if err := cache.Set(options, token); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to cache the token: %s\n", err)
+			}
+		}
+	}
+
+	// client-go executes the plugin again once the token expires, the expiry is reported early
+	// so that the token is renewed before
+	expiresAt := token.ExpiresAt
+	if renewAt := expiresAt.Add(-tokenRenewBefore); renewAt.After(time.Now()) {
+		expiresAt = renewAt
 	}
 
-	out := fmt.Sprintf(respTemplate, token.ID, token.ExpiresAt.Format(time.RFC3339Nano))
+	out := fmt.Sprintf(respTemplate, token.ID, expiresAt.Format(time.RFC3339Nano))
 	fmt.Println(out)
 }
+
+// cloudOptions reads the credentials and the certificate files of the cloud from clouds.yaml and
+// secure.yaml.
+func cloudOptions(name string) (keystone.Options, error) {
+	var o keystone.Options
+
+	clientOpts := &clientconfig.ClientOpts{Cloud: name}
+	c, err := clientconfig.GetCloudFromYAML(clientOpts)
+	if err != nil {
+		return o, err
+	}
+
+	authOpts, err := clientconfig.AuthOptions(clientOpts)
+	if err != nil {
+		return o, err
+	}
+
+	o.AuthOptions = *authOpts
+	o.ClientCertPath = c.ClientCertFile
+	o.ClientKeyPath = c.ClientKeyFile
+	o.ClientCAPath = c.CACertFile
+
+	return o, nil
+}
+
+// promptForPassword prompts for the password if the options use the password authentication
+// without a password.
+func promptForPassword(authOpts *gophercloud.AuthOptions) error {
+	if authOpts.Password != "" || authOpts.ApplicationCredentialID != "" || authOpts.ApplicationCredentialName != "" || authOpts.TokenID != "" {
+		return nil
+	}
+
+	password, err := promptForString("password", nil, false)
+	if err != nil {
+		return err
+	}
+	authOpts.Password = password
+
+	return nil
+}
+
+// getToken gets a token from Keystone, completing the multi-factor authentication with a TOTP
+// passcode if Keystone requires it.
+func getToken(ctx context.Context, options keystone.Options) (*tokens.Token, error) {
+	token, err := keystone.GetToken(ctx, options)
+
+	var mfaErr *keystone.MFARequiredError
+	if !errors.As(err, &mfaErr) {
+		return token, err
+	}
+	if !mfaErr.RequiresTOTP() || options.AuthOptions.Passcode != "" {
+		return nil, fmt.Errorf("unsupported additional authentication methods are required: %v", mfaErr.RequiredMethods)
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, fmt.Errorf("a TOTP passcode is required, use --passcode or OS_PASSCODE")
+	}
+
+	passcode, err := promptForString("TOTP passcode", os.Stdin, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data from console: %v", err)
+	}
+
+	// The password is proven by the receipt, only the passcode is submitted
+	options.Receipt = mfaErr.Receipt
+	options.AuthOptions.Password = ""
+	options.AuthOptions.Passcode = passcode
+
+	return keystone.GetToken(ctx, options)
+}
@@ -20,8 +20,10 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"k8s.io/cloud-provider-openstack/pkg/client"
 	"k8s.io/cloud-provider-openstack/pkg/csi"
 	"k8s.io/cloud-provider-openstack/pkg/csi/manila"
 	"k8s.io/cloud-provider-openstack/pkg/csi/manila/csiclient"
@@ -50,12 +52,26 @@ var (
 	endpoint                 string
 	runtimeConfigFile        string
 	userAgentData            []string
+	retryOpts                client.RetryOpts
 	provideControllerService bool
 	provideNodeService       bool
+	cephxSecretNamespace     string
+	volumeModification       bool
+	volumeGroupSnapshot      bool
+	capacitySecret           string
+	janitorSecret            string
+	janitorInterval          time.Duration
+	janitorForceDelete       bool
+	accessRepairSecret       string
+	accessRepairInterval     time.Duration
+	httpEndpoint             string
+	shareMetricsSecret       string
+	pvcMetadataAnnotations   []string
+	pvcMetadataLabels        []string
 )
 
 func validateShareProtocolSelector(v string) error {
-	supportedShareProtocols := []string{"NFS", "CEPHFS"}
+	supportedShareProtocols := []string{"NFS", "CEPHFS", "CIFS"}
 
 	v = strings.ToUpper(v)
 	for _, proto := range supportedShareProtocols {
@@ -76,9 +92,14 @@ func main() {
 				klog.Fatal(err.Error())
 			}
 
-			manilaClientBuilder := &manilaclient.ClientBuilder{UserAgent: "manila-csi-plugin", ExtraUserAgentData: userAgentData}
+			manilaClientBuilder := &manilaclient.ClientBuilder{UserAgent: "manila-csi-plugin", ExtraUserAgentData: userAgentData, RetryOpts: retryOpts}
 			csiClientBuilder := &csiclient.ClientBuilder{}
 
+			pvcLister := csi.GetPVCLister()
+			if pvcLister == nil && (len(pvcMetadataAnnotations) > 0 || len(pvcMetadataLabels) > 0) {
+				klog.Warning("The --pvc-metadata-annotations and --pvc-metadata-labels flags are ignored without the --pvc-annotations flag")
+			}
+
 			opts := &manila.DriverOpts{
 				DriverName:          driverName,
 				WithTopology:        withTopology,
@@ -88,7 +109,48 @@ func main() {
 				ManilaClientBuilder: manilaClientBuilder,
 				CSIClientBuilder:    csiClientBuilder,
 				ClusterID:           clusterID,
-				PVCLister:           csi.GetPVCLister(),
+				PVCLister:           pvcLister,
+				VolumeModification:  volumeModification,
+				VolumeGroupSnapshot: volumeGroupSnapshot,
+			}
+
+			if pvcLister != nil {
+				opts.PVCMetadataAnnotations = pvcMetadataAnnotations
+				opts.PVCMetadataLabels = pvcMetadataLabels
+			}
+
+			if provideControllerService {
+				opts.NodeLister = csi.NewNodeLister()
+			}
+
+			if cephxSecretNamespace != "" && provideControllerService {
+				opts.KubeClient = csi.GetKubeClient()
+				opts.CephxSecretNamespace = cephxSecretNamespace
+			}
+
+			if capacitySecret != "" && provideControllerService {
+				opts.KubeClient = csi.GetKubeClient()
+				opts.CapacitySecret = capacitySecret
+			}
+
+			if janitorSecret != "" && provideControllerService {
+				opts.KubeClient = csi.GetKubeClient()
+				opts.JanitorSecret = janitorSecret
+				opts.JanitorInterval = janitorInterval
+				opts.JanitorForceDelete = janitorForceDelete
+			}
+
+			if accessRepairSecret != "" && provideControllerService {
+				opts.KubeClient = csi.GetKubeClient()
+				opts.AccessRepairSecret = accessRepairSecret
+				opts.AccessRepairInterval = accessRepairInterval
+			}
+
+			opts.HTTPEndpoint = httpEndpoint
+
+			if shareMetricsSecret != "" && provideControllerService {
+				opts.KubeClient = csi.GetKubeClient()
+				opts.ShareMetricsSecret = shareMetricsSecret
 			}
 
 			d, err := manila.NewDriver(opts)
@@ -140,7 +202,7 @@ func main() {
 
 	cmd.PersistentFlags().BoolVar(&withTopology, "with-topology", false, "cluster is topology-aware")
 
-	cmd.PersistentFlags().StringVar(&protoSelector, "share-protocol-selector", "", "specifies which Manila share protocol to use. Valid values are NFS and CEPHFS")
+	cmd.PersistentFlags().StringVar(&protoSelector, "share-protocol-selector", "", "specifies which Manila share protocol to use. Valid values are NFS, CEPHFS and CIFS")
 	if err := cmd.MarkPersistentFlagRequired("share-protocol-selector"); err != nil {
 		klog.Fatalf("Unable to mark flag share-protocol-selector to be required: %v", err)
 	}
@@ -153,12 +215,37 @@ func main() {
 	cmd.PersistentFlags().StringVar(&compatibilitySettings, "compatibility-settings", "", "settings for the compatibility layer")
 
 	cmd.PersistentFlags().StringArrayVar(&userAgentData, "user-agent", nil, "extra data to add to gophercloud user-agent. Use multiple times to add more than one component.")
+	cmd.PersistentFlags().DurationVar(&retryOpts.Timeout, "openstack-api-timeout", 0, "Timeout of a single OpenStack API call. Zero means no timeout.")
+	cmd.PersistentFlags().UintVar(&retryOpts.MaxRetries, "openstack-api-max-retries", 0, "Number of times an OpenStack API call is retried when it is rate limited, or when a read-only call fails with a transient error. Zero disables the retries.")
+	cmd.PersistentFlags().DurationVar(&retryOpts.Backoff, "openstack-api-retry-backoff", time.Second, "Delay before the first retry of an OpenStack API call, doubled at each retry.")
+	cmd.PersistentFlags().DurationVar(&retryOpts.MaxBackoff, "openstack-api-max-retry-backoff", 30*time.Second, "Maximum delay between the retries of an OpenStack API call, including the delay requested by the Retry-After header of rate limited calls.")
 
 	cmd.PersistentFlags().StringVar(&clusterID, "cluster-id", "", "The identifier of the cluster that the plugin is running in.")
 
 	cmd.PersistentFlags().BoolVar(&provideControllerService, "provide-controller-service", true, "If set to true then the CSI driver does provide the controller service (default: true)")
 	cmd.PersistentFlags().BoolVar(&provideNodeService, "provide-node-service", true, "If set to true then the CSI driver does provide the node service (default: true)")
 
+	cmd.PersistentFlags().StringVar(&cephxSecretNamespace, "cephx-secret-namespace", "", "Namespace of the secrets generated with the cephx credentials of the CephFS shares. If set, the controller creates a secret named after the PersistentVolume for every share, to be used as its node stage and node publish secret.")
+
+	cmd.PersistentFlags().StringSliceVar(&pvcMetadataAnnotations, "pvc-metadata-annotations", nil, "Keys of the PVC annotations copied to the metadata of the created shares. A key ending with * matches all the keys with the given prefix, e.g. example.com/*. This option can be given multiple times and requires the --pvc-annotations flag")
+	cmd.PersistentFlags().StringSliceVar(&pvcMetadataLabels, "pvc-metadata-labels", nil, "Keys of the PVC labels copied to the metadata of the created shares. A key ending with * matches all the keys with the given prefix, e.g. example.com/*. This option can be given multiple times and requires the --pvc-annotations flag")
+
+	cmd.PersistentFlags().StringVar(&capacitySecret, "capacity-secret", "", "The <namespace>/<name> of the secret with the OpenStack credentials used to report the capacity of the storage classes. If set, the controller reports the capacity left by the share quotas and, if the credentials may list them, the pools of the share type, enabling the storage capacity tracking.")
+
+	cmd.PersistentFlags().StringVar(&janitorSecret, "janitor-secret", "", "The <namespace>/<name> of the secret with the OpenStack credentials used to clean up the shares of the cluster stuck in an error state. If set, the controller periodically deletes the shares in the error_deleting state, and the shares in the error state which back no PersistentVolume. Requires the --cluster-id flag.")
+	cmd.PersistentFlags().DurationVar(&janitorInterval, "janitor-interval", 10*time.Minute, "The interval between the clean-ups of the shares in an error state.")
+	cmd.PersistentFlags().BoolVar(&janitorForceDelete, "janitor-force-delete", false, "If set to true then the shares in an error state are force-deleted, which requires the credentials of the --janitor-secret flag to have the admin role (default: false)")
+
+	cmd.PersistentFlags().StringVar(&accessRepairSecret, "access-repair-secret", "", "The <namespace>/<name> of the secret with the OpenStack credentials used to repair the NFS access rules of the shares created with the nfs-shareClientSource nodeSubnets or nodeAddresses. If set, the controller periodically grants the access to the new nodes and revokes the access of the removed ones. Requires the --cluster-id and --pvc-annotations flags.")
+	cmd.PersistentFlags().DurationVar(&accessRepairInterval, "access-repair-interval", 5*time.Minute, "The interval between the repairs of the NFS access rules of the shares.")
+
+	cmd.PersistentFlags().StringVar(&httpEndpoint, "http-endpoint", "", "The TCP network address where the HTTP server for providing metrics for diagnostics, will listen (example: `:8080`). The default is empty string, which means the server is disabled.")
+	cmd.PersistentFlags().StringVar(&shareMetricsSecret, "share-metrics-secret", "", "The <namespace>/<name> of the secret with the OpenStack credentials used to count the shares of the cluster by status. If set, the controller exports the manila_csi_shares metric. Requires the --cluster-id and --http-endpoint flags.")
+
+	cmd.PersistentFlags().BoolVar(&volumeModification, "volume-modification", false, "If set to true then the CSI driver controller service does promote the share replicas according to the VolumeAttributesClass of the volumes (default: false)")
+
+	cmd.PersistentFlags().BoolVar(&volumeGroupSnapshot, "volume-group-snapshot", false, "If set to true then the CSI driver controller service does snapshot the share groups according to the VolumeGroupSnapshots of the volumes (default: false)")
+
 	code := cli.Run(cmd)
 	os.Exit(code)
 }
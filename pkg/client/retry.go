@@ -0,0 +1,139 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"k8s.io/klog/v2"
+)
+
+// RetryOpts configures the timeout and the retries of the OpenStack API calls
+type RetryOpts struct {
+	// Timeout of a single API call, including reading the response. Zero
+	// means no timeout.
+	Timeout time.Duration
+	// MaxRetries is the number of times an API call is retried. Only the
+	// calls which can't cause duplicate operations are retried: the calls
+	// rate limited with 429, and the GET and HEAD calls failing with a
+	// transient error.
+	MaxRetries uint
+	// Backoff is the delay before the first retry, doubled at each retry
+	Backoff time.Duration
+	// MaxBackoff caps the delay between the retries, including the delay
+	// requested by the Retry-After header
+	MaxBackoff time.Duration
+}
+
+// SetRetryOpts configures the timeout and the retries of the API calls made
+// with the provider client.
+func SetRetryOpts(provider *gophercloud.ProviderClient, opts RetryOpts) {
+	provider.HTTPClient.Timeout = opts.Timeout
+
+	if opts.MaxRetries == 0 {
+		return
+	}
+
+	provider.MaxBackoffRetries = opts.MaxRetries
+	provider.RetryBackoffFunc = func(ctx context.Context, respErr *gophercloud.ErrUnexpectedResponseCode, err error, retries uint) error {
+		delay := opts.backoff(retries)
+		if after, ok := retryAfter(respErr.ResponseHeader, time.Now()); ok {
+			delay = opts.capBackoff(after)
+		}
+		klog.V(4).Infof("%s %s is rate limited with %d, retry %d/%d in %s", respErr.Method, respErr.URL, respErr.Actual, retries, opts.MaxRetries, delay)
+		return sleep(ctx, delay, respErr)
+	}
+	provider.RetryFunc = func(ctx context.Context, method, url string, options *gophercloud.RequestOpts, err error, failCount uint) error {
+		if failCount > opts.MaxRetries || !isRetriable(method, err) {
+			return err
+		}
+		delay := opts.backoff(failCount)
+		klog.V(4).Infof("%s %s failed: %v, retry %d/%d in %s", method, url, err, failCount, opts.MaxRetries, delay)
+		return sleep(ctx, delay, err)
+	}
+}
+
+// backoff returns the delay before the given retry
+func (opts RetryOpts) backoff(retry uint) time.Duration {
+	delay := opts.Backoff
+	for i := uint(1); i < retry && i < 32; i++ {
+		delay *= 2
+	}
+	return opts.capBackoff(delay)
+}
+
+// capBackoff caps the delay with MaxBackoff, if set
+func (opts RetryOpts) capBackoff(delay time.Duration) time.Duration {
+	if opts.MaxBackoff > 0 && delay > opts.MaxBackoff {
+		return opts.MaxBackoff
+	}
+	return delay
+}
+
+// retryAfter returns the delay requested by the Retry-After header, given in
+// seconds or as an HTTP date.
+func retryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// isRetriable returns true if the failed API call can be retried without
+// risking a duplicate operation.
+func isRetriable(method string, err error) bool {
+	if method != http.MethodGet && method != http.MethodHead {
+		return false
+	}
+
+	var respErr gophercloud.ErrUnexpectedResponseCode
+	if errors.As(err, &respErr) {
+		switch respErr.Actual {
+		case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	// the call failed before a response was received, e.g. it timed out
+	return !errors.Is(err, context.Canceled)
+}
+
+// sleep waits for the delay, and returns the error if the context is done
+// before.
+func sleep(ctx context.Context, delay time.Duration, err error) error {
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return err
+	}
+}
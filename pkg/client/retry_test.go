@@ -0,0 +1,76 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{value: "", ok: false},
+		{value: "10", expected: 10 * time.Second, ok: true},
+		{value: "Mon, 01 Jan 2024 12:00:30 GMT", expected: 30 * time.Second, ok: true},
+		{value: "Mon, 01 Jan 2024 11:00:00 GMT", expected: 0, ok: true},
+		{value: "soon", ok: false},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.value != "" {
+			header.Set("Retry-After", tt.value)
+		}
+		delay, ok := retryAfter(header, now)
+		assert.Equal(t, tt.ok, ok, tt.value)
+		assert.Equal(t, tt.expected, delay, tt.value)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	opts := RetryOpts{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	assert.Equal(t, time.Second, opts.backoff(1))
+	assert.Equal(t, 2*time.Second, opts.backoff(2))
+	assert.Equal(t, 4*time.Second, opts.backoff(3))
+	assert.Equal(t, 5*time.Second, opts.backoff(4))
+	assert.Equal(t, 5*time.Second, opts.backoff(100))
+}
+
+func TestIsRetriable(t *testing.T) {
+	unavailable := gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusServiceUnavailable}
+	notFound := gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusNotFound}
+	timeout := errors.New("context deadline exceeded (Client.Timeout exceeded while awaiting headers)")
+
+	assert.True(t, isRetriable(http.MethodGet, unavailable))
+	assert.True(t, isRetriable(http.MethodGet, timeout))
+	assert.False(t, isRetriable(http.MethodGet, notFound))
+	assert.False(t, isRetriable(http.MethodGet, context.Canceled))
+	// retrying a POST could create a duplicate resource
+	assert.False(t, isRetriable(http.MethodPost, unavailable))
+	assert.False(t, isRetriable(http.MethodPost, timeout))
+}
@@ -69,3 +69,12 @@ func NewKeyManagerV1(provider *gophercloud.ProviderClient, eo *gophercloud.Endpo
 	}
 	return secret, nil
 }
+
+// NewBareMetalV1 creates a ServiceClient that may be used with the Ironic v1 API
+func NewBareMetalV1(provider *gophercloud.ProviderClient, eo *gophercloud.EndpointOpts) (*gophercloud.ServiceClient, error) {
+	baremetal, err := openstack.NewBareMetalV1(provider, *eo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find baremetal v1 %s endpoint for region %s: %v", eo.Availability, eo.Region, err)
+	}
+	return baremetal, nil
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"context"
+	"sync"
+)
+
+// AttachLimitOpts limits the number of the concurrent attach and detach
+// operations, so that the Nova volume attachment API is not overwhelmed when
+// many pods are rescheduled at once. Zero means no limit.
+type AttachLimitOpts struct {
+	// MaxConcurrent is the maximum number of operations for all the nodes
+	MaxConcurrent int
+	// MaxConcurrentPerNode is the maximum number of operations for a node
+	MaxConcurrentPerNode int
+}
+
+// attachLimiter hands out the slots of the attach and detach operations. The
+// operations wait for a slot of their node first, so that the operations of a
+// busy node don't hold the global slots while waiting.
+type attachLimiter struct {
+	opts   AttachLimitOpts
+	global chan struct{}
+
+	mu    sync.Mutex
+	nodes map[string]*nodeSlots
+}
+
+// nodeSlots are the slots of a node, removed once no operation uses them
+type nodeSlots struct {
+	slots chan struct{}
+	refs  int
+}
+
+func newAttachLimiter(opts AttachLimitOpts) *attachLimiter {
+	l := &attachLimiter{
+		opts:  opts,
+		nodes: make(map[string]*nodeSlots),
+	}
+	if opts.MaxConcurrent > 0 {
+		l.global = make(chan struct{}, opts.MaxConcurrent)
+	}
+	return l
+}
+
+// acquire waits for a slot for an operation on the node, and returns the
+// function releasing it. An error is returned if the context is done before a
+// slot is free.
+func (l *attachLimiter) acquire(ctx context.Context, nodeID string) (func(), error) {
+	var node *nodeSlots
+	if l.opts.MaxConcurrentPerNode > 0 {
+		node = l.nodeSlots(nodeID)
+		if err := takeSlot(ctx, node.slots); err != nil {
+			l.putNodeSlots(nodeID, node)
+			return nil, err
+		}
+	}
+
+	if l.global != nil {
+		if err := takeSlot(ctx, l.global); err != nil {
+			if node != nil {
+				<-node.slots
+				l.putNodeSlots(nodeID, node)
+			}
+			return nil, err
+		}
+	}
+
+	return func() {
+		if l.global != nil {
+			<-l.global
+		}
+		if node != nil {
+			<-node.slots
+			l.putNodeSlots(nodeID, node)
+		}
+	}, nil
+}
+
+// takeSlot takes a slot, or returns the error of the context if it is done before
+func takeSlot(ctx context.Context, slots chan struct{}) error {
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *attachLimiter) nodeSlots(nodeID string) *nodeSlots {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	node, ok := l.nodes[nodeID]
+	if !ok {
+		node = &nodeSlots{slots: make(chan struct{}, l.opts.MaxConcurrentPerNode)}
+		l.nodes[nodeID] = node
+	}
+	node.refs++
+	return node
+}
+
+func (l *attachLimiter) putNodeSlots(nodeID string, node *nodeSlots) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	node.refs--
+	if node.refs == 0 {
+		delete(l.nodes, nodeID)
+	}
+}
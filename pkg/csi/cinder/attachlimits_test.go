@@ -0,0 +1,72 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tryAcquire acquires a slot, giving up shortly if none is free
+func tryAcquire(l *attachLimiter, nodeID string) (func(), error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	return l.acquire(ctx, nodeID)
+}
+
+func TestAttachLimiter(t *testing.T) {
+	assert := assert.New(t)
+
+	// no limit
+	l := newAttachLimiter(AttachLimitOpts{})
+	for i := 0; i < 10; i++ {
+		_, err := tryAcquire(l, "node-1")
+		assert.NoError(err)
+	}
+
+	// per node limit
+	l = newAttachLimiter(AttachLimitOpts{MaxConcurrentPerNode: 1})
+	release, err := tryAcquire(l, "node-1")
+	assert.NoError(err)
+	_, err = tryAcquire(l, "node-1")
+	assert.ErrorIs(err, context.DeadlineExceeded)
+	release2, err := tryAcquire(l, "node-2")
+	assert.NoError(err)
+	release()
+	release2()
+	assert.Empty(l.nodes)
+	release, err = tryAcquire(l, "node-1")
+	assert.NoError(err)
+	release()
+
+	// global limit
+	l = newAttachLimiter(AttachLimitOpts{MaxConcurrent: 2, MaxConcurrentPerNode: 2})
+	release, err = tryAcquire(l, "node-1")
+	assert.NoError(err)
+	_, err = tryAcquire(l, "node-2")
+	assert.NoError(err)
+	_, err = tryAcquire(l, "node-3")
+	assert.ErrorIs(err, context.DeadlineExceeded)
+	// the node slot is given back when the global slot can't be taken
+	assert.NotContains(l.nodes, "node-3")
+	release()
+	_, err = tryAcquire(l, "node-3")
+	assert.NoError(err)
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// The labels of the PVs giving the backend of their volume, parsed from the
+// host of the volume, host@backend#pool, which Cinder only exposes to the
+// administrators
+const (
+	backendHostLabel = driverName + "/backend-host"
+	backendLabel     = driverName + "/backend"
+	backendPoolLabel = driverName + "/backend-pool"
+)
+
+// invalidLabelValueChars matches the characters a label value can't have
+var invalidLabelValueChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// BackendLabelOpts configures the labeling of the PVs with the backend of
+// their volume.
+type BackendLabelOpts struct {
+	// Interval between the labelings
+	Interval time.Duration
+}
+
+type backendLabeler struct {
+	driver *Driver
+	kube   kubernetes.Interface
+	opts   BackendLabelOpts
+}
+
+// run labels the PVs at every interval, until the context is done.
+func (l *backendLabeler) run(ctx context.Context) {
+	klog.Infof("Labeling the PVs with the backend of their volume every %s", l.opts.Interval)
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := l.label(ctx); err != nil {
+			klog.Errorf("Failed to label the PVs with the backend of their volume: %v", err)
+		}
+	}, l.opts.Interval)
+}
+
+func (l *backendLabeler) label(ctx context.Context) error {
+	hosts := make(map[string]string)
+	for name, cloud := range l.driver.cs.Clouds {
+		vols, _, err := cloud.ListVolumes(ctx, 0, "")
+		if err != nil {
+			return fmt.Errorf("failed to list the volumes of cloud %q: %v", name, err)
+		}
+		for _, vol := range vols {
+			hosts[vol.ID] = vol.Host
+		}
+	}
+
+	pvs, err := l.kube.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list the PVs: %v", err)
+	}
+
+	var labeled int
+	for i := range pvs.Items {
+		pv := &pvs.Items[i]
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != driverName {
+			continue
+		}
+		// the host isn't exposed to the users who aren't administrators
+		labels := backendLabels(hosts[pv.Spec.CSI.VolumeHandle])
+		if len(labels) == 0 || hasLabels(pv, labels) {
+			continue
+		}
+
+		patch, err := json.Marshal(map[string]any{"metadata": map[string]any{"labels": labels}})
+		if err != nil {
+			return err
+		}
+		if _, err := l.kube.CoreV1().PersistentVolumes().Patch(ctx, pv.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			klog.Errorf("Failed to label PV %s with the backend of volume %s: %v", pv.Name, pv.Spec.CSI.VolumeHandle, err)
+			continue
+		}
+		klog.V(4).Infof("Labeled PV %s with the backend of volume %s: %v", pv.Name, pv.Spec.CSI.VolumeHandle, labels)
+		labeled++
+	}
+
+	klog.V(2).Infof("Labeled %d PVs with the backend of their volume", labeled)
+	return nil
+}
+
+// backendLabels returns the labels of the backend of the volume host, e.g.
+// cinder-volume-0@ceph#volumes. The parts of the host which are not valid
+// label values are left out.
+func backendLabels(host string) map[string]string {
+	if host == "" {
+		return nil
+	}
+	hostname, backend, _ := strings.Cut(host, "@")
+	backend, pool, _ := strings.Cut(backend, "#")
+
+	labels := make(map[string]string, 3)
+	for key, value := range map[string]string{backendHostLabel: hostname, backendLabel: backend, backendPoolLabel: pool} {
+		if value = labelValue(value); value != "" {
+			labels[key] = value
+		}
+	}
+	return labels
+}
+
+// labelValue replaces the characters a label value can't have, and truncates
+// the value to the maximum length of the label values.
+func labelValue(v string) string {
+	v = invalidLabelValueChars.ReplaceAllString(v, "_")
+	if len(v) > validation.LabelValueMaxLength {
+		v = v[:validation.LabelValueMaxLength]
+	}
+	v = strings.Trim(v, "_.-")
+	if len(validation.IsValidLabelValue(v)) > 0 {
+		return ""
+	}
+	return v
+}
+
+// hasLabels returns true if the PV has all the labels already.
+func hasLabels(pv *corev1.PersistentVolume, labels map[string]string) bool {
+	for k, v := range labels {
+		if pv.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
+)
+
+func TestBackendLabels(t *testing.T) {
+	assert.Equal(t, map[string]string{
+		backendHostLabel: "cinder-volume-0",
+		backendLabel:     "ceph",
+		backendPoolLabel: "volumes",
+	}, backendLabels("cinder-volume-0@ceph#volumes"))
+	// no pool, and characters which are not valid in a label value
+	assert.Equal(t, map[string]string{
+		backendHostLabel: "host_1",
+		backendLabel:     "lvm",
+	}, backendLabels("host:1@lvm"))
+	assert.Nil(t, backendLabels(""))
+}
+
+func TestLabelBackends(t *testing.T) {
+	cloudVolumes := []volumes.Volume{
+		{ID: "vol-ceph", Host: "cinder-volume-0@ceph#volumes"},
+		{ID: "vol-labeled", Host: "cinder-volume-0@ceph#volumes"},
+		// the host isn't exposed
+		{ID: "vol-hidden"},
+	}
+
+	pv := func(name, volumeID string, labels map[string]string) *corev1.PersistentVolume {
+		return &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+			Spec: corev1.PersistentVolumeSpec{
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{Driver: driverName, VolumeHandle: volumeID},
+				},
+			},
+		}
+	}
+	labels := backendLabels("cinder-volume-0@ceph#volumes")
+	objects := []runtime.Object{
+		pv("pv-ceph", "vol-ceph", map[string]string{"app": "db"}),
+		pv("pv-labeled", "vol-labeled", labels),
+		pv("pv-hidden", "vol-hidden", nil),
+	}
+
+	osmock := new(openstack.OpenStackMock)
+	osmock.On("ListVolumes", 0, "").Return(cloudVolumes, "", nil)
+
+	kube := fake.NewClientset(objects...)
+	d := NewDriver(&DriverOpts{Endpoint: FakeEndpoint, ClusterID: FakeCluster})
+	d.SetupControllerService(map[string]openstack.IOpenStack{"": osmock})
+	d.SetupBackendLabels(kube, BackendLabelOpts{})
+
+	err := d.backendLabels.label(FakeCtx)
+	assert.NoError(t, err)
+
+	patched := 0
+	for _, a := range kube.Actions() {
+		if a.GetVerb() == "patch" {
+			patched++
+		}
+	}
+	assert.Equal(t, 1, patched)
+
+	got, err := kube.CoreV1().PersistentVolumes().Get(FakeCtx, "pv-ceph", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"app":            "db",
+		backendHostLabel: "cinder-volume-0",
+		backendLabel:     "ceph",
+		backendPoolLabel: "volumes",
+	}, got.Labels)
+
+	got, err = kube.CoreV1().PersistentVolumes().Get(FakeCtx, "pv-hidden", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, got.Labels)
+}
@@ -20,19 +20,26 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"slices"
 	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/backups"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/qos"
 	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/snapshots"
 	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumetypes"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
 	"github.com/kubernetes-csi/csi-lib-utils/protosanitizer"
 	"golang.org/x/exp/maps"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	corev1 "k8s.io/api/core/v1"
 
 	sharedcsi "k8s.io/cloud-provider-openstack/pkg/csi"
 	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
@@ -51,6 +58,22 @@ const (
 	cinderCSIClusterIDKey = "cinder.csi.openstack.org/cluster"
 	affinityKey           = "cinder.csi.openstack.org/affinity"
 	antiAffinityKey       = "cinder.csi.openstack.org/anti-affinity"
+	imageKey              = "cinder.csi.openstack.org/image"
+
+	// the StorageClass parameters of the snapshot or the volume the volumes
+	// without a data source are cloned from
+	fastCloneSnapshotKey = "fast-clone-snapshot"
+	fastCloneVolumeKey   = "fast-clone-volume"
+
+	// availabilityPolicyKey is the StorageClass parameter choosing whether the
+	// availability parameter or the topology takes precedence
+	availabilityPolicyKey      = "availability-policy"
+	availabilityPolicyStatic   = "static"
+	availabilityPolicyTopology = "topology"
+
+	// selectedNodeKey is the PVC annotation of the node the PVC is scheduled
+	// to, set with the WaitForFirstConsumer volume binding mode
+	selectedNodeKey = "volume.kubernetes.io/selected-node"
 )
 
 func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
@@ -68,6 +91,18 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 	volCapabilities := req.GetVolumeCapabilities()
 	volParams := req.GetParameters()
 
+	// the mutable parameters of the VolumeAttributesClass take precedence
+	if mutableParams := req.GetMutableParameters(); len(mutableParams) > 0 {
+		if err := validateMutableParameters(mutableParams); err != nil {
+			return nil, err
+		}
+		volParams = maps.Clone(volParams)
+		if volParams == nil {
+			volParams = make(map[string]string, len(mutableParams))
+		}
+		maps.Copy(volParams, mutableParams)
+	}
+
 	if len(volName) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "[CreateVolume] missing Volume Name")
 	}
@@ -76,6 +111,11 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 		return nil, status.Error(codes.InvalidArgument, "[CreateVolume] missing Volume capability")
 	}
 
+	multiNode, err := cs.validateVolumeCapabilities(volCapabilities)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "[CreateVolume] %v", err)
+	}
+
 	// Volume Size - Default is 1 GiB
 	volSizeBytes := int64(1 * 1024 * 1024 * 1024)
 	if req.GetCapacityRange() != nil {
@@ -86,26 +126,56 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 	// Volume Type
 	volType := volParams["type"]
 
-	// Volume AZ
+	// the volume context passes the encryption and the file system options to
+	// the node service
+	nodeCtx, err := luksVolumeContext(volParams)
+	if err != nil {
+		return nil, err
+	}
+	fsCtx, err := fsVolumeContext(volParams, volCapabilities)
+	if err != nil {
+		return nil, err
+	}
+	if len(fsCtx) > 0 {
+		if nodeCtx == nil {
+			nodeCtx = make(map[string]string, len(fsCtx))
+		}
+		maps.Copy(nodeCtx, fsCtx)
+	}
+
+	// the volumes without a data source are cloned from the fast clone source
+	// of the StorageClass, which is not reported as their content source
+	content := req.GetVolumeContentSource()
+	fastClone := content == nil && (volParams[fastCloneSnapshotKey] != "" || volParams[fastCloneVolumeKey] != "")
 
 	accessibleTopologyReq := req.GetAccessibilityRequirements()
-	ignoreVolumeAZ := cloud.GetBlockStorageOpts().IgnoreVolumeAZ
+	bsOpts := cloud.GetBlockStorageOpts()
 
-	// First check if volAvailability is already specified, if not get preferred from Topology
-	// Required, in case vol AZ is different from node AZ
-	var volAvailability string
-	if volParams["availability"] != "" {
-		volAvailability = volParams["availability"]
-	} else if cs.Driver.withTopology && accessibleTopologyReq != nil {
-		volAvailability = sharedcsi.GetAZFromTopology(topologyKey, accessibleTopologyReq)
+	// get the PVC annotation
+	var pvcAnnotations map[string]string
+	pvc := sharedcsi.GetPVC(cs.Driver.pvcLister, volParams)
+	if pvc != nil {
+		pvcAnnotations = pvc.Annotations
 	}
 
-	// get the PVC annotation
-	pvcAnnotations := sharedcsi.GetPVCAnnotations(cs.Driver.pvcLister, volParams)
+	// Volume AZ
+	volAvailability, err := cs.getVolumeAZ(volParams, pvcAnnotations, accessibleTopologyReq, bsOpts)
+	if err != nil {
+		return nil, err
+	}
+	crossAZRestore, err := getCrossAZRestore(volParams)
+	if err != nil {
+		return nil, err
+	}
 	for k, v := range pvcAnnotations {
 		klog.V(4).Infof("CreateVolume: retrieved %q pvc annotation: %s: %s", k, v, volName)
 	}
 
+	// Transfer an existing volume from another project instead of creating one
+	if transferVolID := pvcAnnotations[transferVolumeKey]; transferVolID != "" {
+		return cs.createVolumeFromTransfer(ctx, cloud, volCloud, volName, volParams, pvcAnnotations[transferCloudKey], transferVolID, volSizeGB, multiNode, accessibleTopologyReq)
+	}
+
 	// Verify a volume with the provided name doesn't already exist for this tenant
 	vols, err := cloud.GetVolumesByName(ctx, volName)
 	if err != nil {
@@ -117,9 +187,25 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 		if volSizeGB != vols[0].Size {
 			return nil, status.Error(codes.AlreadyExists, "Volume Already exists with same name and different capacity")
 		}
+		if multiNode && !vols[0].Multiattach {
+			return nil, status.Error(codes.AlreadyExists, "Volume Already exists with same name and is not multiattach")
+		}
+		if err := waitVolumeCreated(ctx, cloud, &vols[0]); err != nil {
+			return nil, err
+		}
+		if snap := content.GetSnapshot(); snap != nil && crossAZRestore != "" && vols[0].SnapshotID != snap.GetSnapshotId() {
+			finishRestore(ctx, cloud, volName, &vols[0], snap.GetSnapshotId())
+		}
 		klog.V(4).Infof("Volume %s already exists in Availability Zone: %s of size %d GiB", vols[0].ID, vols[0].AvailabilityZone, vols[0].Size)
-		accessibleTopology := getTopology(&vols[0], accessibleTopologyReq, cs.Driver.withTopology, ignoreVolumeAZ)
-		return getCreateVolumeResponse(&vols[0], nil, accessibleTopology), nil
+		accessibleTopology := getTopology(&vols[0], accessibleTopologyReq, cs.Driver.withTopology, bsOpts)
+		if !isAccessibleFromRequisite(accessibleTopology, accessibleTopologyReq) {
+			return nil, status.Errorf(codes.AlreadyExists, "Volume Already exists with same name in Availability Zone %s, which is not accessible from the requisite topology", vols[0].AvailabilityZone)
+		}
+		resp := getCreateVolumeResponse(&vols[0], maps.Clone(nodeCtx), accessibleTopology)
+		if fastClone {
+			resp.Volume.ContentSource = nil
+		}
+		return resp, nil
 	}
 
 	if len(vols) > 1 {
@@ -127,6 +213,12 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 		return nil, status.Error(codes.Internal, "Multiple volumes reported by Cinder with same name")
 	}
 
+	release, err := cs.Driver.provisionLimiter.acquire(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Aborted, "[CreateVolume] too many concurrent volume operations: %v", err)
+	}
+	defer release()
+
 	// Volume Create
 	properties := map[string]string{cinderCSIClusterIDKey: cs.Driver.clusterID}
 	// Tag volume with metadata if present: https://github.com/kubernetes-csi/external-provisioner/pull/399
@@ -135,10 +227,20 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 			properties[mKey] = v
 		}
 	}
-	content := req.GetVolumeContentSource()
+	// Copy the allow-listed PVC annotations and labels, without overriding the
+	// keys set by the driver
+	if pvc != nil {
+		for k, v := range sharedcsi.GetPVCMetadata(pvc, cs.Driver.pvcMetadataAnnotations, cs.Driver.pvcMetadataLabels, maxMetadataLength, maxMetadataLength) {
+			if _, ok := properties[k]; !ok {
+				properties[k] = v
+			}
+		}
+	}
 	var snapshotID string
 	var sourceVolID string
 	var sourceBackupID string
+	// the snapshot restored from a backup, in another availability zone
+	var restoredSnapshotID string
 	var backupsAreEnabled bool
 	backupsAreEnabled, err = cloud.BackupsAreEnabled()
 	klog.V(4).Infof("Backups enabled: %v", backupsAreEnabled)
@@ -157,6 +259,17 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 		if err == nil && snap.Status != "available" {
 			return nil, status.Errorf(codes.Unavailable, "VolumeContentSource Snapshot %s is not yet available. status: %s", snapshotID, snap.Status)
 		}
+		if err == nil && crossAZRestore == crossAZRestoreBackup {
+			backupID, err := cs.getRestoreBackup(ctx, cloud, volName, snap, volAvailability)
+			if err != nil {
+				return nil, err
+			}
+			if backupID != "" {
+				restoredSnapshotID = snapshotID
+				sourceBackupID = backupID
+				snapshotID = ""
+			}
+		}
 
 		// In case a snapshot is not found
 		// check if a Backup with the same ID exists
@@ -193,6 +306,35 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 		}
 	}
 
+	if fastClone && pvcAnnotations[imageKey] == "" {
+		snapshotID, sourceVolID, err = getFastCloneSource(ctx, cloud, volParams, volSizeGB)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		fastClone = false
+	}
+
+	imageID, err := getVolumeImage(volParams, pvcAnnotations, content)
+	if err != nil {
+		return nil, err
+	}
+	if fastClone {
+		imageID = ""
+	}
+
+	if err := ensureVolumeTypeEncryption(ctx, cloud, volType, volParams); err != nil {
+		return nil, err
+	}
+
+	if err := ensureVolumeTypeQoS(ctx, cloud, "CreateVolume", volType, volParams); err != nil {
+		return nil, err
+	}
+
+	if err := checkQuota(ctx, cloud, "CreateVolume", volType, volSizeGB, false); err != nil {
+		return nil, err
+	}
+
 	opts := &volumes.CreateOpts{
 		Name:             volName,
 		Size:             volSizeGB,
@@ -201,12 +343,14 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 		SnapshotID:       snapshotID,
 		SourceVolID:      sourceVolID,
 		BackupID:         sourceBackupID,
+		ImageID:          imageID,
 		Metadata:         properties,
 	}
 
 	// Set scheduler hints if affinity or anti-affinity is set in PVC annotations
 	var schedulerHints volumes.SchedulerHintOptsBuilder
 	volCtx := map[string]string{}
+	maps.Copy(volCtx, nodeCtx)
 	affinity := pvcAnnotations[affinityKey]
 	antiAffinity := pvcAnnotations[antiAffinityKey]
 	if affinity != "" || antiAffinity != "" {
@@ -234,28 +378,236 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 	}
 
 	vol, err := cloud.CreateVolume(ctx, opts, schedulerHints)
+	// the slot is not held while waiting for the volume, a retried call finds
+	// the volume by name
+	release()
 	if err != nil {
 		klog.Errorf("Failed to CreateVolume: %v", err)
 		if errors.Is(err, cpoerrors.ErrQuotaExceeded) {
 			return nil, status.Errorf(codes.ResourceExhausted, "CreateVolume failed due to exceeded quota %v", err)
 		}
+		if errors.Is(err, cpoerrors.ErrMicroversionNotSupported) {
+			return nil, status.Errorf(codes.FailedPrecondition, "CreateVolume failed: %v", err)
+		}
+		if imageID != "" && cpoerrors.IsNotFound(err) {
+			return nil, status.Errorf(codes.NotFound, "CreateVolume failed, image %s not found: %v", imageID, err)
+		}
 		return nil, status.Errorf(codes.Internal, "CreateVolume failed with error %v", err)
 	}
 
+	if multiNode && !vol.Multiattach {
+		klog.Errorf("CreateVolume: volume %s of type %q does not support multiattach, deleting it", vol.ID, vol.VolumeType)
+		if err := cloud.DeleteVolume(ctx, vol.ID); err != nil {
+			klog.Errorf("Failed to delete volume %s: %v", vol.ID, err)
+		}
+		return nil, status.Errorf(codes.InvalidArgument, "[CreateVolume] volume type %q does not support multiattach, which is required by the multi-node access mode", vol.VolumeType)
+	}
+
+	if err := waitVolumeCreated(ctx, cloud, vol); err != nil {
+		return nil, err
+	}
+
 	// When creating a volume from a backup, the response does not include the backupID.
 	if sourceBackupID != "" {
 		vol.BackupID = &sourceBackupID
 	}
+	if restoredSnapshotID != "" {
+		finishRestore(ctx, cloud, volName, vol, restoredSnapshotID)
+	}
 
 	klog.V(4).Infof("CreateVolume: Successfully created volume %s in Availability Zone: %s of size %d GiB", vol.ID, vol.AvailabilityZone, vol.Size)
 
-	accessibleTopology := getTopology(vol, accessibleTopologyReq, cs.Driver.withTopology, ignoreVolumeAZ)
+	accessibleTopology := getTopology(vol, accessibleTopologyReq, cs.Driver.withTopology, bsOpts)
+	if !isAccessibleFromRequisite(accessibleTopology, accessibleTopologyReq) {
+		// e.g. Cinder fell back to its default AZ, which none of the nodes
+		// the volume must be accessible from is in
+		klog.Errorf("CreateVolume: volume %s was created in Availability Zone %s, which is not accessible from the requisite topology %v, deleting it", vol.ID, vol.AvailabilityZone, accessibleTopologyReq.GetRequisite())
+		if err := cloud.DeleteVolume(ctx, vol.ID); err != nil {
+			klog.Errorf("Failed to delete volume %s: %v", vol.ID, err)
+		}
+		return nil, status.Errorf(codes.InvalidArgument, "[CreateVolume] volume was created in Availability Zone %s, which is not accessible from the requisite topology %v", vol.AvailabilityZone, accessibleTopologyReq.GetRequisite())
+	}
+
+	resp := getCreateVolumeResponse(vol, volCtx, accessibleTopology)
+	if fastClone {
+		resp.Volume.ContentSource = nil
+	}
+	return resp, nil
+}
+
+// getVolumeAZ returns the Cinder AZ the volume is created in. With the static
+// availability policy, the availability parameter takes precedence over the
+// zone of the topology requirement, while with the topology policy it is only
+// used when there is no topology requirement. Without a topology requirement,
+// e.g. when topology is disabled, the zone of the node the PVC is scheduled to
+// is used, so that the volume is accessible from the node.
+func (cs *controllerServer) getVolumeAZ(volParams, pvcAnnotations map[string]string, topologyReq *csi.TopologyRequirement, bsOpts openstack.BlockStorageOpts) (string, error) {
+	policy := volParams[availabilityPolicyKey]
+	switch policy {
+	case "", availabilityPolicyStatic, availabilityPolicyTopology:
+	default:
+		return "", status.Errorf(codes.InvalidArgument, "[CreateVolume] invalid %s parameter %q, expected %s or %s", availabilityPolicyKey, policy, availabilityPolicyStatic, availabilityPolicyTopology)
+	}
+
+	availability := volParams["availability"]
+	if availability != "" && policy != availabilityPolicyTopology {
+		return availability, nil
+	}
+
+	// the topology and the nodes hold Nova AZs, which may have a different
+	// name in Cinder
+	if cs.Driver.withTopology && topologyReq != nil {
+		if computeAZ := sharedcsi.GetAZFromTopology(topologyKey, topologyReq); computeAZ != "" {
+			return bsOpts.VolumeAZ(computeAZ), nil
+		}
+	}
+	if computeAZ := cs.getSelectedNodeAZ(pvcAnnotations); computeAZ != "" {
+		klog.V(4).Infof("CreateVolume: using the availability zone %s of the selected node %s", computeAZ, pvcAnnotations[selectedNodeKey])
+		return bsOpts.VolumeAZ(computeAZ), nil
+	}
+	return availability, nil
+}
+
+// getSelectedNodeAZ returns the Nova AZ of the node the PVC is scheduled to,
+// given by the topology labels of the node, or an empty string if it is
+// unknown.
+func (cs *controllerServer) getSelectedNodeAZ(pvcAnnotations map[string]string) string {
+	nodeName := pvcAnnotations[selectedNodeKey]
+	if nodeName == "" || cs.Driver.nodeLister == nil {
+		return ""
+	}
+
+	node, err := cs.Driver.nodeLister.Get(nodeName)
+	if err != nil {
+		klog.Warningf("Failed to get the selected node %s of the PVC: %v", nodeName, err)
+		return ""
+	}
+	if az := node.Labels[topologyKey]; az != "" {
+		return az
+	}
+	return node.Labels[corev1.LabelTopologyZone]
+}
 
-	return getCreateVolumeResponse(vol, volCtx, accessibleTopology), nil
+// waitVolumeCreated waits for the volume to be available. A volume which went
+// into an error state is deleted, so that it is created again when the call is
+// retried, and the message of Cinder telling why its creation failed is
+// returned, which external-provisioner reports in the events of the PVC.
+func waitVolumeCreated(ctx context.Context, cloud openstack.IOpenStack, vol *volumes.Volume) error {
+	if vol.Status == openstack.VolumeAvailableStatus || vol.Status == openstack.VolumeInUseStatus {
+		return nil
+	}
+
+	err := cloud.WaitVolumeTargetStatus(ctx, vol.ID, []string{openstack.VolumeAvailableStatus})
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, cpoerrors.ErrVolumeErrorState) {
+		return status.Errorf(codes.Aborted, "[CreateVolume] volume %s is not available yet: %v", vol.ID, err)
+	}
+
+	klog.Errorf("CreateVolume: volume %s failed to be created, deleting it: %v", vol.ID, err)
+	if err := cloud.DeleteVolume(ctx, vol.ID); err != nil {
+		klog.Errorf("Failed to delete volume %s: %v", vol.ID, err)
+	}
+	return status.Errorf(codes.Internal, "[CreateVolume] volume %s failed to be created: %v", vol.ID, err)
 }
 
-func (d *controllerServer) ControllerModifyVolume(ctx context.Context, req *csi.ControllerModifyVolumeRequest) (*csi.ControllerModifyVolumeResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "")
+// getFastCloneSource returns the ID of the snapshot or of the volume, given by
+// the StorageClass, the volumes without a data source are cloned from. The
+// backends supporting it, e.g. Ceph RBD, create the clones as copy-on-write
+// volumes, which is much faster than populating the volumes. A snapshot given
+// by name is the newest available snapshot with this name, so that the source
+// can be refreshed by creating a new snapshot.
+func getFastCloneSource(ctx context.Context, cloud openstack.IOpenStack, volParams map[string]string, volSizeGB int) (string, string, error) {
+	snapshot, volume := volParams[fastCloneSnapshotKey], volParams[fastCloneVolumeKey]
+	if snapshot != "" && volume != "" {
+		return "", "", status.Errorf(codes.InvalidArgument, "[CreateVolume] the %s and %s parameters are mutually exclusive", fastCloneSnapshotKey, fastCloneVolumeKey)
+	}
+	if volParams["image"] != "" {
+		return "", "", status.Errorf(codes.InvalidArgument, "[CreateVolume] the %s and %s parameters can not be used with the image parameter", fastCloneSnapshotKey, fastCloneVolumeKey)
+	}
+
+	if snapshot != "" {
+		snap, err := getFastCloneSnapshot(ctx, cloud, snapshot)
+		if err != nil {
+			return "", "", err
+		}
+		if snap.Size > volSizeGB {
+			return "", "", status.Errorf(codes.OutOfRange, "[CreateVolume] requested size %d GiB is smaller than the %d GiB of fast clone snapshot %s", volSizeGB, snap.Size, snap.ID)
+		}
+		klog.V(4).Infof("CreateVolume: cloning fast clone snapshot %s", snap.ID)
+		return snap.ID, "", nil
+	}
+
+	vol, err := cloud.GetVolume(ctx, volume)
+	if cpoerrors.IsNotFound(err) {
+		var vols []volumes.Volume
+		vols, err = cloud.GetVolumesByName(ctx, volume)
+		if err == nil {
+			if len(vols) != 1 {
+				return "", "", status.Errorf(codes.FailedPrecondition, "[CreateVolume] found %d fast clone volumes %q, expected 1", len(vols), volume)
+			}
+			vol = &vols[0]
+		}
+	}
+	if err != nil {
+		return "", "", status.Errorf(codes.Internal, "[CreateVolume] failed to get fast clone volume %q: %v", volume, err)
+	}
+	if vol.Status != openstack.VolumeAvailableStatus && vol.Status != openstack.VolumeInUseStatus {
+		return "", "", status.Errorf(codes.Unavailable, "[CreateVolume] fast clone volume %s is not available, status: %s", vol.ID, vol.Status)
+	}
+	if vol.Size > volSizeGB {
+		return "", "", status.Errorf(codes.OutOfRange, "[CreateVolume] requested size %d GiB is smaller than the %d GiB of fast clone volume %s", volSizeGB, vol.Size, vol.ID)
+	}
+	klog.V(4).Infof("CreateVolume: cloning fast clone volume %s", vol.ID)
+	return "", vol.ID, nil
+}
+
+// getFastCloneSnapshot returns the available snapshot with the given ID, or
+// the newest available snapshot with the given name.
+func getFastCloneSnapshot(ctx context.Context, cloud openstack.IOpenStack, snapshot string) (*snapshots.Snapshot, error) {
+	snap, err := cloud.GetSnapshotByID(ctx, snapshot)
+	if err == nil {
+		if snap.Status != "available" {
+			return nil, status.Errorf(codes.Unavailable, "[CreateVolume] fast clone snapshot %s is not available, status: %s", snap.ID, snap.Status)
+		}
+		return snap, nil
+	}
+	if !cpoerrors.IsNotFound(err) {
+		return nil, status.Errorf(codes.Internal, "[CreateVolume] failed to get fast clone snapshot %q: %v", snapshot, err)
+	}
+
+	snaps, _, err := cloud.ListSnapshots(ctx, map[string]string{"Name": snapshot, "Status": "available"})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "[CreateVolume] failed to list fast clone snapshots %q: %v", snapshot, err)
+	}
+	if len(snaps) == 0 {
+		return nil, status.Errorf(codes.NotFound, "[CreateVolume] fast clone snapshot %q not found", snapshot)
+	}
+	newest := &snaps[0]
+	for i := range snaps {
+		if snaps[i].CreatedAt.After(newest.CreatedAt) {
+			newest = &snaps[i]
+		}
+	}
+	return newest, nil
+}
+
+// getVolumeImage returns the Glance image, specified by its ID or name, the
+// volume is created from. The image of the PVC annotation takes precedence over
+// the image of the StorageClass, which is ignored when the volume is created
+// from a snapshot or a volume.
+func getVolumeImage(volParams, pvcAnnotations map[string]string, content *csi.VolumeContentSource) (string, error) {
+	if image := pvcAnnotations[imageKey]; image != "" {
+		if content != nil {
+			return "", status.Errorf(codes.InvalidArgument, "[CreateVolume] the %s PVC annotation can not be used with a data source", imageKey)
+		}
+		return image, nil
+	}
+	if content != nil {
+		return "", nil
+	}
+	return volParams["image"], nil
 }
 
 func (cs *controllerServer) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
@@ -273,7 +625,14 @@ func (cs *controllerServer) DeleteVolume(ctx context.Context, req *csi.DeleteVol
 	if len(volID) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "DeleteVolume Volume ID must be provided")
 	}
-	err := cloud.DeleteVolume(ctx, volID)
+
+	release, err := cs.Driver.provisionLimiter.acquire(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Aborted, "[DeleteVolume] too many concurrent volume operations: %v", err)
+	}
+	defer release()
+
+	err = cloud.DeleteVolume(ctx, volID)
 	if err != nil {
 		if cpoerrors.IsNotFound(err) {
 			klog.V(3).Infof("Volume %s is already deleted.", volID)
@@ -313,7 +672,7 @@ func (cs *controllerServer) ControllerPublishVolume(ctx context.Context, req *cs
 		return nil, status.Error(codes.InvalidArgument, "[ControllerPublishVolume] Volume capability must be provided")
 	}
 
-	_, err := cloud.GetVolume(ctx, volumeID)
+	vol, err := cloud.GetVolume(ctx, volumeID)
 	if err != nil {
 		if cpoerrors.IsNotFound(err) {
 			return nil, status.Errorf(codes.NotFound, "[ControllerPublishVolume] Volume %s not found", volumeID)
@@ -321,7 +680,11 @@ func (cs *controllerServer) ControllerPublishVolume(ctx context.Context, req *cs
 		return nil, status.Errorf(codes.Internal, "[ControllerPublishVolume] get volume failed with error %v", err)
 	}
 
-	_, err = cloud.GetInstanceByID(ctx, instanceID)
+	if isPublishedToOtherNode(vol, instanceID) {
+		return nil, status.Errorf(codes.FailedPrecondition, "[ControllerPublishVolume] Volume %s is not multiattach and is already attached to another node", volumeID)
+	}
+
+	server, err := cloud.GetInstanceByID(ctx, instanceID)
 	if err != nil {
 		if cpoerrors.IsNotFound(err) {
 			return nil, status.Errorf(codes.NotFound, "[ControllerPublishVolume] Instance %s not found", instanceID)
@@ -329,8 +692,31 @@ func (cs *controllerServer) ControllerPublishVolume(ctx context.Context, req *cs
 		return nil, status.Errorf(codes.Internal, "[ControllerPublishVolume] GetInstanceByID failed with error %v", err)
 	}
 
+	release, err := cs.Driver.attachLimiter.acquire(ctx, instanceID)
+	if err != nil {
+		return nil, status.Errorf(codes.Aborted, "[ControllerPublishVolume] too many concurrent attach operations: %v", err)
+	}
+	defer release()
+
+	if isNVMeoFVolume(cloud.GetBlockStorageOpts(), vol) {
+		return cs.publishNVMeoFVolume(ctx, cloud, volumeID, instanceID)
+	}
+
+	if isLocalAttachVolume(cloud.GetBlockStorageOpts(), vol) {
+		resp, err := cs.publishLocalVolume(ctx, cloud, vol, server)
+		if err != nil || resp != nil {
+			return resp, err
+		}
+	}
+
 	_, err = cloud.AttachVolume(ctx, instanceID, volumeID)
 	if err != nil {
+		if errors.Is(err, cpoerrors.ErrCrossAZAttach) {
+			return nil, cs.crossAZAttachError(ctx, cloud.GetBlockStorageOpts(), vol, server)
+		}
+		if errors.Is(err, cpoerrors.ErrMicroversionNotSupported) {
+			return nil, status.Errorf(codes.FailedPrecondition, "[ControllerPublishVolume] Attach Volume failed: %v", err)
+		}
 		klog.Errorf("Failed to AttachVolume: %v", err)
 		return nil, status.Errorf(codes.Internal, "[ControllerPublishVolume] Attach Volume failed with error %v", err)
 
@@ -385,6 +771,45 @@ func (cs *controllerServer) ControllerUnpublishVolume(ctx context.Context, req *
 		return nil, status.Errorf(codes.Internal, "[ControllerUnpublishVolume] GetInstanceByID failed with error %v", err)
 	}
 
+	release, err := cs.Driver.attachLimiter.acquire(ctx, instanceID)
+	if err != nil {
+		return nil, status.Errorf(codes.Aborted, "[ControllerUnpublishVolume] too many concurrent detach operations: %v", err)
+	}
+	defer release()
+
+	if bsOpts := cloud.GetBlockStorageOpts(); len(bsOpts.NVMeoFVolumeTypes) > 0 || len(bsOpts.LocalAttachVolumeTypes) > 0 {
+		vol, err := cloud.GetVolume(ctx, volumeID)
+		if err != nil {
+			if cpoerrors.IsNotFound(err) {
+				klog.V(3).Infof("ControllerUnpublishVolume assuming volume %s is detached, because it does not exist", volumeID)
+				return &csi.ControllerUnpublishVolumeResponse{}, nil
+			}
+			return nil, status.Errorf(codes.Internal, "[ControllerUnpublishVolume] get volume failed with error %v", err)
+		}
+		if isNVMeoFVolume(bsOpts, vol) {
+			if err := cloud.DeleteVolumeAttachments(ctx, volumeID, instanceID); err != nil {
+				klog.Errorf("Failed to DeleteVolumeAttachments: %v", err)
+				return nil, status.Errorf(codes.Internal, "ControllerUnpublishVolume Detach Volume failed with error %v", err)
+			}
+			klog.V(4).Infof("ControllerUnpublishVolume %s on %s over NVMe-oF", volumeID, instanceID)
+			return &csi.ControllerUnpublishVolumeResponse{}, nil
+		}
+		if isLocalAttachVolume(bsOpts, vol) {
+			attached, err := cloud.VolumeAttachedByCompute(ctx, instanceID, volumeID)
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "[ControllerUnpublishVolume] failed to get the attachment of volume %s to instance %s: %v", volumeID, instanceID, err)
+			}
+			if !attached {
+				if err := cloud.DeleteVolumeAttachments(ctx, volumeID, instanceID); err != nil {
+					klog.Errorf("Failed to DeleteVolumeAttachments: %v", err)
+					return nil, status.Errorf(codes.Internal, "ControllerUnpublishVolume Detach Volume failed with error %v", err)
+				}
+				klog.V(4).Infof("ControllerUnpublishVolume %s on %s with local connector", volumeID, instanceID)
+				return &csi.ControllerUnpublishVolumeResponse{}, nil
+			}
+		}
+	}
+
 	err = cloud.DetachVolume(ctx, instanceID, volumeID)
 	if err != nil {
 		if cpoerrors.IsNotFound(err) {
@@ -410,6 +835,29 @@ func (cs *controllerServer) ControllerUnpublishVolume(ctx context.Context, req *
 	return &csi.ControllerUnpublishVolumeResponse{}, nil
 }
 
+// crossAZAttachError returns the error of a volume which can't be attached to
+// a server of another availability zone, and reports it as an event. Retrying
+// can't succeed, so the error gives the topology the volume is accessible
+// from, which the PV must require for the pods to be scheduled to the nodes
+// the volume can be attached to. The topology holds the Nova AZs the Cinder
+// AZ of the volume is mapped to.
+func (cs *controllerServer) crossAZAttachError(ctx context.Context, bsOpts openstack.BlockStorageOpts, vol *volumes.Volume, server *servers.Server) error {
+	computeAZs := bsOpts.ComputeAZs(vol.AvailabilityZone)
+	topologies := make([]string, len(computeAZs))
+	for i, computeAZ := range computeAZs {
+		topologies[i] = topologyKey + "=" + computeAZ
+	}
+	msg := fmt.Sprintf("Volume %s in availability zone %s can not be attached to instance %s in availability zone %s, the volume is only accessible from the nodes with topology %s",
+		vol.ID, vol.AvailabilityZone, server.ID, server.AvailabilityZone, strings.Join(topologies, " or "))
+	klog.Errorf("Failed to AttachVolume: %s", msg)
+
+	if cs.Driver.events != nil {
+		cs.Driver.events.volumeWarning(ctx, vol.ID, eventReasonCrossAZAttach, msg)
+	}
+
+	return status.Errorf(codes.FailedPrecondition, "[ControllerPublishVolume] %s", msg)
+}
+
 func (cs *controllerServer) extractNodeIDs(attachments []volumes.Attachment) []string {
 	nodeIDs := make([]string, len(attachments))
 	for i, attachment := range attachments {
@@ -428,12 +876,39 @@ func (cs *controllerServer) createVolumeEntries(vlist []volumes.Volume) []*csi.L
 			},
 			Status: &csi.ListVolumesResponse_VolumeStatus{
 				PublishedNodeIds: cs.extractNodeIDs(v.Attachments),
+				VolumeCondition:  volumeCondition(&v),
 			},
 		}
 	}
 	return entries
 }
 
+// volumeCondition returns the condition of the volume reported to the
+// external-health-monitor. The volume is abnormal when it is in an error state,
+// or when its status doesn't match its attachments.
+func volumeCondition(v *volumes.Volume) *csi.VolumeCondition {
+	switch {
+	case strings.HasPrefix(v.Status, "error"):
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("Volume %s is in %s state", v.ID, v.Status),
+		}
+	case v.Status == openstack.VolumeInUseStatus && len(v.Attachments) == 0:
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("Volume %s is in-use but not attached to any server", v.ID),
+		}
+	case v.Status == openstack.VolumeAvailableStatus && len(v.Attachments) > 0:
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("Volume %s is available but still attached to server %s", v.ID, v.Attachments[0].ServerID),
+		}
+	}
+	return &csi.VolumeCondition{
+		Message: fmt.Sprintf("Volume %s is %s", v.ID, v.Status),
+	}
+}
+
 func (cs *controllerServer) ListVolumes(ctx context.Context, req *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
 	klog.V(4).Infof("ListVolumes: called with %+#v request", req)
 
@@ -604,9 +1079,30 @@ func (cs *controllerServer) CreateSnapshot(ctx context.Context, req *csi.CreateS
 			klog.Errorf("Error to convert time to timestamp: %v", err)
 		}
 
-		snap.Status, err = cloud.WaitSnapshotReady(ctx, snap.ID)
+		snap.Status, err = cloud.WaitSnapshotReady(ctx, snap.ID, cs.snapshotProgressReporter(ctx))
 		if err != nil {
+			// the snapshot is reported as not ready to use, csi-snapshotter
+			// checks its status again with ListSnapshots. A backup can only
+			// be created from a ready snapshot, CreateSnapshot is retried.
+			if errors.Is(err, cpoerrors.ErrSnapshotNotReady) {
+				klog.V(3).Infof("Snapshot %s of volume %s is not ready yet: %v", snap.ID, volumeID, err)
+				if snapshotType == "snapshot" {
+					return &csi.CreateSnapshotResponse{
+						Snapshot: &csi.Snapshot{
+							SnapshotId:     snap.ID,
+							SizeBytes:      int64(snap.Size * 1024 * 1024 * 1024),
+							SourceVolumeId: snap.VolumeID,
+							CreationTime:   ctime,
+							ReadyToUse:     false,
+						},
+					}, nil
+				}
+				return nil, status.Errorf(codes.Aborted, "[CreateSnapshot] snapshot %s of the backup is not ready yet, status: %s", snap.ID, snap.Status)
+			}
 			klog.Errorf("Failed to WaitSnapshotReady: %v", err)
+			if cs.Driver.events != nil {
+				cs.Driver.events.snapshotEvent(ctx, snap, corev1.EventTypeWarning, eventReasonSnapshotFailed, fmt.Sprintf("Snapshot %s of volume %s failed: %v", snap.ID, volumeID, err))
+			}
 			return nil, status.Errorf(codes.Internal, "CreateSnapshot failed with error: %v. Current snapshot status: %v", err, snap.Status)
 		}
 
@@ -671,6 +1167,25 @@ func (cs *controllerServer) CreateSnapshot(ctx context.Context, req *csi.CreateS
 	}, nil
 }
 
+// snapshotProgressReporter returns the function reporting the progress of the
+// snapshots being created as events, or nil if the events are disabled.
+func (cs *controllerServer) snapshotProgressReporter(ctx context.Context) func(*snapshots.Snapshot) {
+	if cs.Driver.events == nil {
+		return nil
+	}
+	return func(snap *snapshots.Snapshot) {
+		cs.Driver.events.snapshotEvent(ctx, snap, corev1.EventTypeNormal, eventReasonSnapshotProgress, snapshotProgressMessage(snap))
+	}
+}
+
+func snapshotProgressMessage(snap *snapshots.Snapshot) string {
+	progress := snap.Progress
+	if progress == "" {
+		progress = "unknown"
+	}
+	return fmt.Sprintf("Snapshot %s of volume %s is %s, progress: %s", snap.ID, snap.VolumeID, snap.Status, progress)
+}
+
 func (cs *controllerServer) createSnapshot(ctx context.Context, cloud openstack.IOpenStack, name string, volumeID string, parameters map[string]string) (snap *snapshots.Snapshot, err error) {
 	filters := map[string]string{}
 	filters["Name"] = name
@@ -714,6 +1229,19 @@ func (cs *controllerServer) createSnapshot(ctx context.Context, cloud openstack.
 		}
 	}
 
+	if cloud.GetBlockStorageOpts().QuotaPreflight {
+		vol, err := cloud.GetVolume(ctx, volumeID)
+		if err != nil {
+			if cpoerrors.IsNotFound(err) {
+				return nil, status.Errorf(codes.NotFound, "[CreateSnapshot] source volume %s not found", volumeID)
+			}
+			return nil, status.Errorf(codes.Internal, "[CreateSnapshot] failed to get source volume %s: %v", volumeID, err)
+		}
+		if err := checkQuota(ctx, cloud, "CreateSnapshot", vol.VolumeType, vol.Size, true); err != nil {
+			return nil, err
+		}
+	}
+
 	// TODO: Delegate the check to openstack itself and ignore the conflict
 	snap, err = cloud.CreateSnapshot(ctx, name, volumeID, properties)
 	if err != nil {
@@ -732,9 +1260,9 @@ func (cs *controllerServer) createBackup(ctx context.Context, cloud openstack.IO
 
 	// see https://github.com/kubernetes-csi/external-snapshotter/pull/375/
 	// Also, we don't want to tag every param but we still want to send the
-	// 'force-create' flag to openstack layer so that we will honor the
-	// force create functions
-	for _, mKey := range append(sharedcsi.RecognizedCSISnapshotterParams, openstack.SnapshotForceCreate, openstack.SnapshotType) {
+	// 'force-create', 'incremental' and 'container' flags to openstack layer
+	// so that we will honor them when creating the backup
+	for _, mKey := range append(sharedcsi.RecognizedCSISnapshotterParams, openstack.SnapshotForceCreate, openstack.SnapshotType, openstack.BackupIncremental, openstack.BackupContainer) {
 		if v, ok := parameters[mKey]; ok {
 			properties[mKey] = v
 		}
@@ -743,6 +1271,9 @@ func (cs *controllerServer) createBackup(ctx context.Context, cloud openstack.IO
 	backup, err := cloud.CreateBackup(ctx, name, volumeID, snap.ID, parameters[openstack.SnapshotAvailabilityZone], properties)
 	if err != nil {
 		klog.Errorf("Failed to Create backup: %v", err)
+		if errors.Is(err, cpoerrors.ErrMicroversionNotSupported) {
+			return nil, status.Errorf(codes.FailedPrecondition, "CreateBackup failed: %v", err)
+		}
 		return nil, status.Error(codes.Internal, fmt.Sprintf("CreateBackup failed with error %v", err))
 	}
 	klog.V(4).Infof("Backup created: %+v", backup)
@@ -810,13 +1341,20 @@ func (cs *controllerServer) ListSnapshots(ctx context.Context, req *csi.ListSnap
 
 		ctime := timestamppb.New(snap.CreatedAt)
 
+		// csi-snapshotter checks the status of the snapshots which were not
+		// ready to use when they were created
+		ready := snap.Status == openstack.SnapshotReadyStatus
+		if !ready && cs.Driver.events != nil {
+			cs.Driver.events.snapshotEvent(ctx, snap, corev1.EventTypeNormal, eventReasonSnapshotProgress, snapshotProgressMessage(snap))
+		}
+
 		entry := &csi.ListSnapshotsResponse_Entry{
 			Snapshot: &csi.Snapshot{
 				SizeBytes:      int64(snap.Size * 1024 * 1024 * 1024),
 				SnapshotId:     snap.ID,
 				SourceVolumeId: snap.VolumeID,
 				CreationTime:   ctime,
-				ReadyToUse:     true,
+				ReadyToUse:     ready,
 			},
 		}
 
@@ -901,7 +1439,7 @@ func (cs *controllerServer) ValidateVolumeCapabilities(ctx context.Context, req
 		return nil, status.Error(codes.InvalidArgument, "ValidateVolumeCapabilities Volume ID must be provided")
 	}
 
-	_, err := cloud.GetVolume(ctx, volumeID)
+	vol, err := cloud.GetVolume(ctx, volumeID)
 	if err != nil {
 		if cpoerrors.IsNotFound(err) {
 			return nil, status.Errorf(codes.NotFound, "ValidateVolumeCapabilities Volume %s not found", volumeID)
@@ -909,28 +1447,59 @@ func (cs *controllerServer) ValidateVolumeCapabilities(ctx context.Context, req
 		return nil, status.Errorf(codes.Internal, "ValidateVolumeCapabilities %v", err)
 	}
 
+	multiNode, err := cs.validateVolumeCapabilities(reqVolCap)
+	if err != nil {
+		return &csi.ValidateVolumeCapabilitiesResponse{Message: "Requested Volume Capability not supported"}, nil
+	}
+	if multiNode && !vol.Multiattach {
+		return &csi.ValidateVolumeCapabilitiesResponse{Message: "Requested multi-node access mode is not supported by a volume which is not multiattach"}, nil
+	}
+
+	var confirmed []*csi.VolumeCapability
 	for _, cap := range reqVolCap {
-		if cap.GetAccessMode().GetMode() != cs.Driver.vcap[0].Mode {
-			return &csi.ValidateVolumeCapabilitiesResponse{Message: "Requested Volume Capability not supported"}, nil
-		}
+		confirmed = append(confirmed, &csi.VolumeCapability{
+			AccessMode: cap.GetAccessMode(),
+		})
 	}
 
-	// Cinder CSI driver currently supports one mode only
 	resp := &csi.ValidateVolumeCapabilitiesResponse{
 		Confirmed: &csi.ValidateVolumeCapabilitiesResponse_Confirmed{
-			VolumeCapabilities: []*csi.VolumeCapability{
-				{
-					AccessMode: cs.Driver.vcap[0],
-				},
-			},
+			VolumeCapabilities: confirmed,
 		},
 	}
 
 	return resp, nil
 }
 
+// GetCapacity returns the capacity left in the Cinder quotas of the project.
+// The quotas are the same in all the availability zones, so the accessible
+// topology of the request is ignored.
 func (cs *controllerServer) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "GetCapacity is not yet implemented")
+	klog.V(4).Infof("GetCapacity: called with args %+v", protosanitizer.StripSecrets(req))
+
+	// GetCapacity requests have no secrets, use the first cloud
+	cloudsNames := maps.Keys(cs.Clouds)
+	sort.Strings(cloudsNames)
+	cloud := cs.Clouds[cloudsNames[0]]
+
+	volType := req.GetParameters()["type"]
+	quota, err := cloud.GetVolumeQuota(ctx, volType)
+	if err != nil {
+		klog.Errorf("Failed to GetVolumeQuota: %v", err)
+		return nil, status.Errorf(codes.Internal, "GetCapacity failed with error %v", err)
+	}
+
+	res := &csi.GetCapacityResponse{
+		AvailableCapacity: math.MaxInt64,
+	}
+	if quota.AvailableGB != openstack.UnlimitedQuota {
+		res.AvailableCapacity = int64(quota.AvailableGB) * 1024 * 1024 * 1024
+	}
+	if quota.MaxVolumeSizeGB != openstack.UnlimitedQuota {
+		res.MaximumVolumeSize = wrapperspb.Int64(int64(quota.MaxVolumeSizeGB) * 1024 * 1024 * 1024)
+	}
+
+	return res, nil
 }
 
 func (cs *controllerServer) ControllerGetVolume(ctx context.Context, req *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
@@ -969,6 +1538,7 @@ func (cs *controllerServer) ControllerGetVolume(ctx context.Context, req *csi.Co
 	for _, attachment := range volume.Attachments {
 		status.PublishedNodeIds = append(status.PublishedNodeIds, attachment.ServerID)
 	}
+	status.VolumeCondition = volumeCondition(volume)
 	ventry.Status = status
 
 	return &ventry, nil
@@ -1020,6 +1590,9 @@ func (cs *controllerServer) ControllerExpandVolume(ctx context.Context, req *csi
 
 	err = cloud.ExpandVolume(ctx, volumeID, volume.Status, volSizeGB)
 	if err != nil {
+		if errors.Is(err, cpoerrors.ErrMicroversionNotSupported) {
+			return nil, status.Errorf(codes.FailedPrecondition, "Could not resize volume %q: %v", volumeID, err)
+		}
 		return nil, status.Errorf(codes.Internal, "Could not resize volume %q to size %v: %v", volumeID, volSizeGB, err)
 	}
 
@@ -1039,13 +1612,294 @@ func (cs *controllerServer) ControllerExpandVolume(ctx context.Context, req *csi
 	}, nil
 }
 
-func getTopology(vol *volumes.Volume, topologyReq *csi.TopologyRequirement, withTopology bool, ignoreVolumeAZ bool) []*csi.Topology {
+// ControllerModifyVolume applies the mutable parameters of a
+// VolumeAttributesClass to the volume, by changing its volume type.
+func (cs *controllerServer) ControllerModifyVolume(ctx context.Context, req *csi.ControllerModifyVolumeRequest) (*csi.ControllerModifyVolumeResponse, error) {
+	klog.V(4).Infof("ControllerModifyVolume: called with args %+v", protosanitizer.StripSecrets(req))
+
+	if err := cs.Driver.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_MODIFY_VOLUME); err != nil {
+		return nil, status.Error(codes.Unimplemented, "[ControllerModifyVolume] volume modification is disabled, set the --volume-modification flag to enable it")
+	}
+
+	// Volume cloud
+	volCloud := req.GetSecrets()["cloud"]
+	cloud, cloudExist := cs.Clouds[volCloud]
+	if !cloudExist {
+		return nil, status.Error(codes.InvalidArgument, "[ControllerModifyVolume] specified cloud undefined")
+	}
+
+	volumeID := req.GetVolumeId()
+	if len(volumeID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "[ControllerModifyVolume] Volume ID not provided")
+	}
+
+	params := req.GetMutableParameters()
+	if err := validateMutableParameters(params); err != nil {
+		return nil, err
+	}
+
+	volType := params["type"]
+	if volType == "" {
+		return nil, status.Error(codes.InvalidArgument, "[ControllerModifyVolume] the type parameter is required")
+	}
+
+	migrationPolicy := params[openstack.VolumeMigrationPolicy]
+	switch migrationPolicy {
+	case "":
+		migrationPolicy = string(volumes.MigrationPolicyOnDemand)
+	case string(volumes.MigrationPolicyNever), string(volumes.MigrationPolicyOnDemand):
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "[ControllerModifyVolume] invalid %s parameter %q", openstack.VolumeMigrationPolicy, migrationPolicy)
+	}
+
+	volume, err := cloud.GetVolume(ctx, volumeID)
+	if err != nil {
+		if cpoerrors.IsNotFound(err) {
+			return nil, status.Errorf(codes.NotFound, "Volume %s not found", volumeID)
+		}
+		return nil, status.Errorf(codes.Internal, "GetVolume failed with error %v", err)
+	}
+
+	if volume.Status == openstack.VolumeRetypingStatus {
+		return nil, status.Errorf(codes.Aborted, "[ControllerModifyVolume] Volume %s is being retyped", volumeID)
+	}
+
+	if volume.VolumeType == volType {
+		// a volume was already retyped
+		klog.V(2).Infof("Volume %q already has the volume type %q", volumeID, volType)
+		return &csi.ControllerModifyVolumeResponse{}, nil
+	}
+
+	if err := ensureVolumeTypeQoS(ctx, cloud, "ControllerModifyVolume", volType, params); err != nil {
+		return nil, err
+	}
+
+	if err := cloud.ChangeVolumeType(ctx, volumeID, volType, migrationPolicy); err != nil {
+		return nil, status.Errorf(codes.Internal, "Could not change the type of volume %q to %q: %v", volumeID, volType, err)
+	}
+
+	// the volume is back to available or in-use once it was retyped, or
+	// when the retype failed. The retypes migrating the volume to another
+	// backend copy its data, which takes long.
+	targetStatus := []string{openstack.VolumeAvailableStatus, openstack.VolumeInUseStatus}
+	err = cloud.WaitVolumeTargetStatusWithTimeout(ctx, volumeID, targetStatus, cs.Driver.volumeModificationTimeout)
+	if err != nil {
+		klog.Errorf("Failed to WaitVolumeTargetStatusWithTimeout of volume %s: %v", volumeID, err)
+		return nil, status.Errorf(codes.Internal, "[ControllerModifyVolume] Volume %s not in target state after retype operation: %v", volumeID, err)
+	}
+
+	volume, err = cloud.GetVolume(ctx, volumeID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "GetVolume failed with error %v", err)
+	}
+	if volume.VolumeType != volType {
+		return nil, status.Errorf(codes.Internal, "[ControllerModifyVolume] Volume %s has the volume type %q after retype operation, see the Cinder logs", volumeID, volume.VolumeType)
+	}
+
+	klog.V(4).Infof("ControllerModifyVolume changed the type of volume %v to %v", volumeID, volType)
+
+	return &csi.ControllerModifyVolumeResponse{}, nil
+}
+
+// validateMutableParameters checks that the parameters of a
+// VolumeAttributesClass are supported.
+func validateMutableParameters(params map[string]string) error {
+	for k := range params {
+		switch k {
+		case "type", openstack.VolumeMigrationPolicy, openstack.VolumeQoSSpecs, openstack.VolumeQoSConsumer:
+			continue
+		}
+		if _, ok := openstack.VolumeQoSLimits[k]; ok {
+			continue
+		}
+		return status.Errorf(codes.InvalidArgument, "unsupported mutable parameter %q", k)
+	}
+	return nil
+}
+
+// ensureVolumeTypeEncryption checks that the volume type is encrypted when
+// the StorageClass requires encrypted volumes, and that its encryption matches
+// the requested one. The volume type must be created beforehand.
+func ensureVolumeTypeEncryption(ctx context.Context, cloud openstack.IOpenStack, volType string, params map[string]string) error {
+	encrypted := false
+	if v, ok := params[openstack.VolumeEncrypted]; ok {
+		var err error
+		encrypted, err = strconv.ParseBool(v)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "[CreateVolume] invalid %s parameter: %v", openstack.VolumeEncrypted, err)
+		}
+	}
+
+	encOpts := volumetypes.CreateEncryptionOpts{
+		Provider:        params[openstack.VolumeEncryptionProvider],
+		Cipher:          params[openstack.VolumeEncryptionCipher],
+		ControlLocation: params[openstack.VolumeEncryptionControlLocation],
+	}
+	if v, ok := params[openstack.VolumeEncryptionKeySize]; ok {
+		keySize, err := strconv.Atoi(v)
+		if err != nil || keySize <= 0 {
+			return status.Errorf(codes.InvalidArgument, "[CreateVolume] invalid %s parameter %q", openstack.VolumeEncryptionKeySize, v)
+		}
+		encOpts.KeySize = keySize
+	}
+
+	if !encrypted {
+		if encOpts != (volumetypes.CreateEncryptionOpts{}) {
+			return status.Errorf(codes.InvalidArgument, "[CreateVolume] encryption parameters require the %s parameter to be true", openstack.VolumeEncrypted)
+		}
+		return nil
+	}
+
+	if volType == "" {
+		return status.Error(codes.InvalidArgument, "[CreateVolume] encrypted volumes require the type parameter")
+	}
+
+	encryption, err := cloud.GetVolumeTypeEncryption(ctx, volType)
+	if err != nil {
+		if !cpoerrors.IsNotFound(err) {
+			return status.Errorf(codes.Internal, "[CreateVolume] failed to get encryption of volume type %q: %v", volType, err)
+		}
+		return status.Errorf(codes.InvalidArgument, "[CreateVolume] volume type %q not found", volType)
+	}
+
+	if encryption == nil {
+		return status.Errorf(codes.InvalidArgument, "[CreateVolume] volume type %q is not encrypted", volType)
+	}
+	if encOpts.Provider != "" && encOpts.Provider != encryption.Provider {
+		return status.Errorf(codes.InvalidArgument, "[CreateVolume] volume type %q is encrypted with provider %q, not %q", volType, encryption.Provider, encOpts.Provider)
+	}
+	if encOpts.Cipher != "" && encOpts.Cipher != encryption.Cipher {
+		return status.Errorf(codes.InvalidArgument, "[CreateVolume] volume type %q is encrypted with cipher %q, not %q", volType, encryption.Cipher, encOpts.Cipher)
+	}
+	if encOpts.KeySize != 0 && encOpts.KeySize != encryption.KeySize {
+		return status.Errorf(codes.InvalidArgument, "[CreateVolume] volume type %q is encrypted with a key size of %d, not %d", volType, encryption.KeySize, encOpts.KeySize)
+	}
+	if encOpts.ControlLocation != "" && encOpts.ControlLocation != encryption.ControlLocation {
+		return status.Errorf(codes.InvalidArgument, "[CreateVolume] volume type %q is encrypted in the %q control location, not %q", volType, encryption.ControlLocation, encOpts.ControlLocation)
+	}
+
+	return nil
+}
+
+// ensureVolumeTypeQoS checks that the volume type is associated with the QoS
+// specs required by the StorageClass, and that their limits match the
+// requested ones. The QoS specs and the volume type must be created and
+// associated beforehand. The errors are prefixed with the name of the calling
+// RPC.
+func ensureVolumeTypeQoS(ctx context.Context, cloud openstack.IOpenStack, rpc, volType string, params map[string]string) error {
+	qosName := params[openstack.VolumeQoSSpecs]
+	consumer := params[openstack.VolumeQoSConsumer]
+
+	limits := map[string]string{}
+	for param, key := range openstack.VolumeQoSLimits {
+		v, ok := params[param]
+		if !ok {
+			continue
+		}
+		if limit, err := strconv.ParseUint(v, 10, 64); err != nil || limit == 0 {
+			return status.Errorf(codes.InvalidArgument, "[%s] invalid %s parameter %q", rpc, param, v)
+		}
+		limits[key] = v
+	}
+
+	if qosName == "" {
+		if len(limits) > 0 || consumer != "" {
+			return status.Errorf(codes.InvalidArgument, "[%s] QoS parameters require the %s parameter", rpc, openstack.VolumeQoSSpecs)
+		}
+		return nil
+	}
+
+	if volType == "" {
+		return status.Errorf(codes.InvalidArgument, "[%s] QoS specs require the type parameter", rpc)
+	}
+
+	switch consumer {
+	case "", string(qos.ConsumerFront), string(qos.ConsumerBack), string(qos.ConsumerBoth):
+	default:
+		return status.Errorf(codes.InvalidArgument, "[%s] invalid %s parameter %q", rpc, openstack.VolumeQoSConsumer, consumer)
+	}
+
+	specs, err := cloud.GetQoSSpecs(ctx, qosName)
+	if err != nil {
+		if cpoerrors.IsNotFound(err) {
+			return status.Errorf(codes.InvalidArgument, "[%s] QoS specs %q not found", rpc, qosName)
+		}
+		return status.Errorf(codes.Internal, "[%s] failed to get QoS specs %q: %v", rpc, qosName, err)
+	}
+
+	if consumer != "" && consumer != specs.Consumer {
+		return status.Errorf(codes.InvalidArgument, "[%s] QoS specs %q are consumed by %q, not %q", rpc, qosName, specs.Consumer, consumer)
+	}
+	for key, v := range limits {
+		if specs.Specs[key] != v {
+			return status.Errorf(codes.InvalidArgument, "[%s] QoS specs %q set %s to %q, not %q", rpc, qosName, key, specs.Specs[key], v)
+		}
+	}
+
+	typeSpecs, err := cloud.GetVolumeTypeQoSSpecs(ctx, volType)
+	if err != nil {
+		if cpoerrors.IsNotFound(err) {
+			return status.Errorf(codes.InvalidArgument, "[%s] volume type %q not found", rpc, volType)
+		}
+		return status.Errorf(codes.Internal, "[%s] failed to get QoS specs of volume type %q: %v", rpc, volType, err)
+	}
+
+	if typeSpecs == nil || typeSpecs.ID != specs.ID {
+		return status.Errorf(codes.InvalidArgument, "[%s] volume type %q is not associated with QoS specs %q", rpc, volType, qosName)
+	}
+
+	return nil
+}
+
+// validateVolumeCapabilities checks that the access modes of the capabilities
+// are supported and returns true if one of them is a multi-node access mode.
+// Multi-node access is only supported for raw block volumes, since a
+// filesystem mounted on several nodes at once would get corrupted.
+func (cs *controllerServer) validateVolumeCapabilities(caps []*csi.VolumeCapability) (bool, error) {
+	multiNode := false
+	for _, cap := range caps {
+		mode := cap.GetAccessMode().GetMode()
+		supported := false
+		for _, vcap := range cs.Driver.vcap {
+			if vcap.GetMode() == mode {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return false, fmt.Errorf("access mode %s is not supported", mode)
+		}
+		if mode == csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER {
+			if cap.GetBlock() == nil {
+				return false, fmt.Errorf("access mode %s is only supported for block volumes", mode)
+			}
+			multiNode = true
+		}
+	}
+	return multiNode, nil
+}
+
+// isPublishedToOtherNode returns true if the volume can only be attached to a
+// single node and is already attached to another node.
+func isPublishedToOtherNode(vol *volumes.Volume, instanceID string) bool {
+	if vol.Multiattach {
+		return false
+	}
+	for _, att := range vol.Attachments {
+		if att.ServerID != instanceID {
+			return true
+		}
+	}
+	return false
+}
+
+func getTopology(vol *volumes.Volume, topologyReq *csi.TopologyRequirement, withTopology bool, bsOpts openstack.BlockStorageOpts) []*csi.Topology {
 	var accessibleTopology []*csi.Topology
 	if !withTopology {
 		return accessibleTopology
 	}
 
-	if ignoreVolumeAZ {
+	if bsOpts.IgnoreVolumeAZ {
 		if topologyReq != nil {
 			accessibleTopology = topologyReq.GetPreferred()
 		}
@@ -1053,13 +1907,36 @@ func getTopology(vol *volumes.Volume, topologyReq *csi.TopologyRequirement, with
 		// NOTE(stephenfin): We retrieve the AZ from the created volume rather than
 		// using the value we provided in our request since these can differ due to
 		// Cinder's '[DEFAULT] allow_availability_zone_fallback' option.
-		accessibleTopology = []*csi.Topology{
-			{Segments: map[string]string{topologyKey: vol.AvailabilityZone}},
+		for _, computeAZ := range bsOpts.ComputeAZs(vol.AvailabilityZone) {
+			accessibleTopology = append(accessibleTopology, &csi.Topology{
+				Segments: map[string]string{topologyKey: computeAZ},
+			})
 		}
 	}
 	return accessibleTopology
 }
 
+// isAccessibleFromRequisite returns true if the volume is accessible from at
+// least one of the requisite topologies, or if there is no requisite topology.
+func isAccessibleFromRequisite(accessibleTopology []*csi.Topology, topologyReq *csi.TopologyRequirement) bool {
+	requisite := topologyReq.GetRequisite()
+	if len(requisite) == 0 || len(accessibleTopology) == 0 {
+		return true
+	}
+	for _, req := range requisite {
+		zone, ok := req.GetSegments()[topologyKey]
+		if !ok {
+			return true
+		}
+		for _, t := range accessibleTopology {
+			if t.GetSegments()[topologyKey] == zone {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func getCreateVolumeResponse(vol *volumes.Volume, volCtx map[string]string, accessibleTopology []*csi.Topology) *csi.CreateVolumeResponse {
 	var volSrc *csi.VolumeContentSource
 
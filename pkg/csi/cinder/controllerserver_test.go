@@ -17,14 +17,31 @@ limitations under the License.
 package cinder
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
 	"testing"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/backups"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/qos"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/snapshots"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/transfers"
 	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumetypes"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 
 	sharedcsi "k8s.io/cloud-provider-openstack/pkg/csi"
 	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
@@ -62,6 +79,7 @@ func TestCreateVolume(t *testing.T) {
 	// mock OpenStack
 	properties := map[string]string{cinderCSIClusterIDKey: FakeCluster}
 	osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), FakeVolType, FakeAvailability, "", "", "", properties).Return(&FakeVol, nil)
+	osmock.On("WaitVolumeTargetStatus", FakeVol.ID, []string{openstack.VolumeAvailableStatus}).Return(nil)
 	osmock.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
 	osmock.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{})
 
@@ -149,6 +167,46 @@ func TestCreateVolumeQuotaError(t *testing.T) {
 	assert.Equal(statusErr.Code(), codes.ResourceExhausted)
 }
 
+// Test CreateVolume fails with the Cinder message of a volume in error state
+func TestCreateVolumeErrorState(t *testing.T) {
+	fakeCs, osmock := fakeControllerServer()
+
+	creatingVol := FakeVol
+	creatingVol.Status = "creating"
+	errorStateErr := fmt.Errorf("%w error: schedule allocate volume:Could not find any available weighted backend", cpoerrors.ErrVolumeErrorState)
+
+	// mock OpenStack
+	properties := map[string]string{cinderCSIClusterIDKey: FakeCluster}
+	osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), FakeVolType, "", "", "", "", properties).Return(&creatingVol, nil)
+	osmock.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
+	osmock.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{})
+	osmock.On("WaitVolumeTargetStatus", FakeVolID, []string{openstack.VolumeAvailableStatus}).Return(errorStateErr)
+	osmock.On("DeleteVolume", FakeVolID).Return(nil)
+
+	assert := assert.New(t)
+
+	// Fake request
+	fakeReq := &csi.CreateVolumeRequest{
+		Name: FakeVolName,
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+	}
+
+	// Invoke CreateVolume
+	_, err := fakeCs.CreateVolume(FakeCtx, fakeReq)
+
+	// Assert
+	assert.Equal(codes.Internal, status.Code(err))
+	assert.ErrorContains(err, "Could not find any available weighted backend")
+	// the volume is deleted, so that it is created again on retry
+	osmock.AssertCalled(t, "DeleteVolume", FakeVolID)
+}
+
 // Test CreateVolume with additional param
 func TestCreateVolumeWithParam(t *testing.T) {
 	fakeCs, osmock := fakeControllerServer()
@@ -156,6 +214,7 @@ func TestCreateVolumeWithParam(t *testing.T) {
 	// mock OpenStack
 	properties := map[string]string{cinderCSIClusterIDKey: FakeCluster}
 	osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), "dummyVolType", "cinder", "", "", "", properties).Return(&FakeVol, nil)
+	osmock.On("WaitVolumeTargetStatus", FakeVol.ID, []string{openstack.VolumeAvailableStatus}).Return(nil)
 	osmock.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
 	osmock.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{})
 
@@ -206,6 +265,7 @@ func TestCreateVolumeWithIgnoreVolumeAZ(t *testing.T) {
 
 	properties := map[string]string{cinderCSIClusterIDKey: FakeCluster}
 	osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), FakeVolType, "cinder", "", "", "", properties).Return(&FakeVol, nil)
+	osmock.On("WaitVolumeTargetStatus", FakeVol.ID, []string{openstack.VolumeAvailableStatus}).Return(nil)
 	osmock.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
 	osmock.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{IgnoreVolumeAZ: true})
 
@@ -260,6 +320,159 @@ func TestCreateVolumeWithIgnoreVolumeAZ(t *testing.T) {
 	assert.Equal("foo", actualRes.Volume.AccessibleTopology[0].GetSegments()[topologyKey])
 }
 
+// Test CreateVolume with availability-zone-map option
+func TestCreateVolumeWithAvailabilityZoneMap(t *testing.T) {
+	fakeCs, osmock := fakeControllerServer()
+
+	properties := map[string]string{cinderCSIClusterIDKey: FakeCluster}
+	osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), FakeVolType, FakeAvailability, "", "", "", properties).Return(&FakeVol, nil)
+	osmock.On("WaitVolumeTargetStatus", FakeVol.ID, []string{openstack.VolumeAvailableStatus}).Return(nil)
+	osmock.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
+	bsOpts := openstack.BlockStorageOpts{
+		AvailabilityZoneMap: []string{"az1:" + FakeAvailability, "az2:" + FakeAvailability, "az3:other"},
+	}
+
+	assert := assert.New(t)
+	assert.NoError(bsOpts.ParseAvailabilityZoneMap())
+	osmock.On("GetBlockStorageOpts").Return(bsOpts)
+
+	// Fake request
+	fakeReq := &csi.CreateVolumeRequest{
+		Name: FakeVolName,
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+
+		AccessibilityRequirements: &csi.TopologyRequirement{
+			Requisite: []*csi.Topology{
+				{
+					Segments: map[string]string{topologyKey: "az1"},
+				},
+				{
+					Segments: map[string]string{topologyKey: "az2"},
+				},
+			},
+			Preferred: []*csi.Topology{
+				{
+					Segments: map[string]string{topologyKey: "az2"},
+				},
+			},
+		},
+	}
+
+	// Invoke CreateVolume
+	actualRes, err := fakeCs.CreateVolume(FakeCtx, fakeReq)
+	if err != nil {
+		t.Errorf("failed to CreateVolume: %v", err)
+	}
+
+	// Assert
+	assert.NotNil(actualRes.Volume)
+	assert.Len(actualRes.Volume.AccessibleTopology, 2)
+	assert.Equal("az1", actualRes.Volume.AccessibleTopology[0].GetSegments()[topologyKey])
+	assert.Equal("az2", actualRes.Volume.AccessibleTopology[1].GetSegments()[topologyKey])
+}
+
+// Test CreateVolume with a volume created in a zone which is not accessible
+// from the requisite topology
+func TestCreateVolumeNotAccessibleFromRequisite(t *testing.T) {
+	fakeCs, osmock := fakeControllerServer()
+
+	properties := map[string]string{cinderCSIClusterIDKey: FakeCluster}
+	// Cinder falls back to FakeAvailability
+	osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), FakeVolType, "az9", "", "", "", properties).Return(&FakeVol, nil)
+	osmock.On("WaitVolumeTargetStatus", FakeVol.ID, []string{openstack.VolumeAvailableStatus}).Return(nil)
+	osmock.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
+	osmock.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{})
+	osmock.On("DeleteVolume", FakeVol.ID).Return(nil)
+
+	_, err := fakeCs.CreateVolume(FakeCtx, &csi.CreateVolumeRequest{
+		Name: FakeVolName,
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+		AccessibilityRequirements: &csi.TopologyRequirement{
+			Requisite: []*csi.Topology{
+				{
+					Segments: map[string]string{topologyKey: "az9"},
+				},
+			},
+		},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	osmock.AssertCalled(t, "DeleteVolume", FakeVol.ID)
+}
+
+// Test CreateVolume with multi-node access mode
+func TestCreateVolumeMultiattach(t *testing.T) {
+	assert := assert.New(t)
+
+	multiattachVol := FakeVol
+	multiattachVol.Multiattach = true
+
+	tests := []struct {
+		name       string
+		accessType *csi.VolumeCapability_Block
+		vol        *volumes.Volume
+		wantCode   codes.Code
+	}{
+		{
+			name:       "block volume of a multiattach type",
+			accessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}},
+			vol:        &multiattachVol,
+			wantCode:   codes.OK,
+		},
+		{
+			name:       "block volume of a type without multiattach",
+			accessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}},
+			vol:        &FakeVol,
+			wantCode:   codes.InvalidArgument,
+		},
+		{
+			name:     "filesystem volume",
+			vol:      &multiattachVol,
+			wantCode: codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeCs, osmock := fakeControllerServer()
+
+			properties := map[string]string{cinderCSIClusterIDKey: FakeCluster}
+			osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), FakeVolType, "", "", "", "", properties).Return(tt.vol, nil)
+			osmock.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
+			osmock.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{})
+			osmock.On("DeleteVolume", FakeVolID).Return(nil)
+			osmock.On("WaitVolumeTargetStatus", FakeVolID, []string{openstack.VolumeAvailableStatus}).Return(nil)
+
+			volCap := &csi.VolumeCapability{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+				},
+			}
+			if tt.accessType != nil {
+				volCap.AccessType = tt.accessType
+			}
+
+			fakeReq := &csi.CreateVolumeRequest{
+				Name:               FakeVolName,
+				VolumeCapabilities: []*csi.VolumeCapability{volCap},
+			}
+
+			_, err := fakeCs.CreateVolume(FakeCtx, fakeReq)
+			assert.Equal(tt.wantCode, status.Code(err), err)
+		})
+	}
+}
+
 // Test CreateVolume with --with-topology=false flag
 func TestCreateVolumeWithTopologyDisabled(t *testing.T) {
 	assert := assert.New(t)
@@ -289,6 +502,7 @@ func TestCreateVolumeWithTopologyDisabled(t *testing.T) {
 
 			properties := map[string]string{cinderCSIClusterIDKey: FakeCluster}
 			osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), FakeVolType, tt.expectedVolumeAZ, "", "", "", properties).Return(&FakeVol, nil)
+			osmock.On("WaitVolumeTargetStatus", FakeVol.ID, []string{openstack.VolumeAvailableStatus}).Return(nil)
 			osmock.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
 			osmock.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{})
 
@@ -335,6 +549,7 @@ func TestCreateVolumeWithExtraMetadata(t *testing.T) {
 		sharedcsi.PvcNamespaceKey: FakePVCNamespace,
 	}
 	osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), FakeVolType, FakeAvailability, "", "", "", properties).Return(&FakeVol, nil)
+	osmock.On("WaitVolumeTargetStatus", FakeVol.ID, []string{openstack.VolumeAvailableStatus}).Return(nil)
 	osmock.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
 	osmock.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{})
 
@@ -370,11 +585,389 @@ func TestCreateVolumeWithExtraMetadata(t *testing.T) {
 	}
 }
 
+func TestCreateVolumeWithPVCMetadata(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	err := indexer.Add(&corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      FakePVCName,
+			Namespace: FakePVCNamespace,
+			Annotations: map[string]string{
+				"billing.example.com/cost-center": "cc-42",
+				"billing.example.com/owner":       "team-a",
+				"unrelated":                       "ignored",
+				cinderCSIClusterIDKey:             "overridden",
+			},
+			Labels: map[string]string{
+				"app":  "db",
+				"tier": "ignored",
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	osmock := new(openstack.OpenStackMock)
+	d := NewDriver(&DriverOpts{
+		Endpoint:               FakeEndpoint,
+		ClusterID:              FakeCluster,
+		WithTopology:           true,
+		PVCLister:              corelisters.NewPersistentVolumeClaimLister(indexer),
+		PVCMetadataAnnotations: []string{"billing.example.com/*", cinderCSIClusterIDKey},
+		PVCMetadataLabels:      []string{"app"},
+	})
+	fakeCs := NewControllerServer(d, map[string]openstack.IOpenStack{"": osmock})
+
+	// mock OpenStack
+	properties := map[string]string{
+		cinderCSIClusterIDKey:             FakeCluster,
+		sharedcsi.PvNameKey:               FakePVName,
+		sharedcsi.PvcNameKey:              FakePVCName,
+		sharedcsi.PvcNamespaceKey:         FakePVCNamespace,
+		"billing.example.com/cost-center": "cc-42",
+		"billing.example.com/owner":       "team-a",
+		"app":                             "db",
+	}
+	osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), FakeVolType, FakeAvailability, "", "", "", properties).Return(&FakeVol, nil)
+	osmock.On("WaitVolumeTargetStatus", FakeVol.ID, []string{openstack.VolumeAvailableStatus}).Return(nil)
+	osmock.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
+	osmock.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{})
+
+	// Fake request
+	fakeReq := &csi.CreateVolumeRequest{
+		Name: FakeVolName,
+		Parameters: map[string]string{
+			sharedcsi.PvNameKey:       FakePVName,
+			sharedcsi.PvcNameKey:      FakePVCName,
+			sharedcsi.PvcNamespaceKey: FakePVCNamespace,
+		},
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+
+		AccessibilityRequirements: &csi.TopologyRequirement{
+			Requisite: []*csi.Topology{
+				{
+					Segments: map[string]string{topologyKey: FakeAvailability},
+				},
+			},
+		},
+	}
+
+	// Invoke CreateVolume
+	_, err = fakeCs.CreateVolume(FakeCtx, fakeReq)
+	if err != nil {
+		t.Errorf("failed to CreateVolume: %v", err)
+	}
+	osmock.AssertCalled(t, "CreateVolume", FakeVolName, mock.AnythingOfType("int"), FakeVolType, FakeAvailability, "", "", "", properties)
+}
+
+func TestGetVolumeAZ(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.NoError(t, indexer.Add(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "node-1",
+			Labels: map[string]string{topologyKey: "nova-2"},
+		},
+	}))
+	assert.NoError(t, indexer.Add(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "node-2",
+			Labels: map[string]string{corev1.LabelTopologyZone: "nova-3"},
+		},
+	}))
+	d := NewDriver(&DriverOpts{
+		Endpoint:     FakeEndpoint,
+		ClusterID:    FakeCluster,
+		WithTopology: true,
+		NodeLister:   corelisters.NewNodeLister(indexer),
+	})
+	cs := NewControllerServer(d, nil)
+
+	topologyReq := &csi.TopologyRequirement{
+		Preferred: []*csi.Topology{{Segments: map[string]string{topologyKey: "nova-1"}}},
+	}
+	bsOpts := openstack.BlockStorageOpts{AvailabilityZoneMap: []string{"nova-1:cinder-1"}}
+	assert.NoError(t, bsOpts.ParseAvailabilityZoneMap())
+
+	tests := []struct {
+		name           string
+		params         map[string]string
+		pvcAnnotations map[string]string
+		topologyReq    *csi.TopologyRequirement
+		want           string
+		wantCode       codes.Code
+	}{
+		{
+			name:        "availability parameter takes precedence",
+			params:      map[string]string{"availability": "static"},
+			topologyReq: topologyReq,
+			want:        "static",
+		},
+		{
+			name:        "topology takes precedence with the topology policy",
+			params:      map[string]string{"availability": "static", availabilityPolicyKey: availabilityPolicyTopology},
+			topologyReq: topologyReq,
+			want:        "cinder-1",
+		},
+		{
+			name:           "zone label of the selected node without topology",
+			pvcAnnotations: map[string]string{selectedNodeKey: "node-1"},
+			want:           "nova-2",
+		},
+		{
+			name:           "well-known zone label of the selected node",
+			params:         map[string]string{"availability": "static", availabilityPolicyKey: availabilityPolicyTopology},
+			pvcAnnotations: map[string]string{selectedNodeKey: "node-2"},
+			want:           "nova-3",
+		},
+		{
+			name:           "availability parameter with an unknown selected node",
+			params:         map[string]string{"availability": "static", availabilityPolicyKey: availabilityPolicyTopology},
+			pvcAnnotations: map[string]string{selectedNodeKey: "node-3"},
+			want:           "static",
+		},
+		{
+			name: "default availability zone",
+			want: "",
+		},
+		{
+			name:     "invalid policy",
+			params:   map[string]string{availabilityPolicyKey: "nearest"},
+			wantCode: codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			az, err := cs.getVolumeAZ(tt.params, tt.pvcAnnotations, tt.topologyReq, bsOpts)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			assert.Equal(t, tt.want, az)
+		})
+	}
+}
+
+// transferMock mocks GetVolume, which always returns the same volume in
+// OpenStackMock
+type transferMock struct {
+	*openstack.OpenStackMock
+}
+
+func (m transferMock) GetVolume(ctx context.Context, volumeID string) (*volumes.Volume, error) {
+	ret := m.Called(volumeID)
+	vol, _ := ret.Get(0).(*volumes.Volume)
+	return vol, ret.Error(1)
+}
+
+func TestCreateVolumeFromTransfer(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	err := indexer.Add(&corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      FakePVCName,
+			Namespace: FakePVCNamespace,
+			Annotations: map[string]string{
+				transferVolumeKey: FakeVol2.ID,
+				transferCloudKey:  "tenant",
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	fakeReq := &csi.CreateVolumeRequest{
+		Name: FakeVolName,
+		Parameters: map[string]string{
+			sharedcsi.PvcNameKey:      FakePVCName,
+			sharedcsi.PvcNamespaceKey: FakePVCNamespace,
+		},
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+	}
+	transfer := &transfers.Transfer{ID: "transfer-id", AuthKey: "auth-key", VolumeID: FakeVol2.ID}
+	srcVol := FakeVol2
+	srcVol.Size = 1
+	srcVol.Metadata = map[string]string{"owner": "tenant"}
+	transferredVol := FakeVol2
+	transferredVol.Size = 1
+	transferredVol.Metadata = map[string]string{transferredForKey: FakeVolName, cinderCSIClusterIDKey: FakeCluster}
+	otherVol := FakeVol2
+	otherVol.Metadata = map[string]string{transferredForKey: "other-volume"}
+
+	tests := []struct {
+		name         string
+		sourceClouds string
+		existingVol  *volumes.Volume
+		acceptErr    error
+		expectedCode codes.Code
+		transferred  bool
+	}{
+		{
+			name:         "transferred",
+			sourceClouds: "other,tenant",
+			transferred:  true,
+		},
+		{
+			name:         "transfer not accepted",
+			sourceClouds: "tenant",
+			acceptErr:    errors.New("forbidden"),
+			expectedCode: codes.Internal,
+			transferred:  true,
+		},
+		{
+			name:         "transfer cloud not allowed",
+			sourceClouds: "other",
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "no transfer source clouds",
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:        "already transferred",
+			existingVol: &transferredVol,
+		},
+		{
+			name:         "existing volume not transferred for the volume",
+			sourceClouds: "tenant",
+			existingVol:  &otherVol,
+			expectedCode: codes.FailedPrecondition,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			osmock := new(openstack.OpenStackMock)
+			tenantmock := new(openstack.OpenStackMock)
+			d := NewDriver(&DriverOpts{
+				Endpoint:     FakeEndpoint,
+				ClusterID:    FakeCluster,
+				WithTopology: true,
+				PVCLister:    corelisters.NewPersistentVolumeClaimLister(indexer),
+			})
+			fakeCs := NewControllerServer(d, map[string]openstack.IOpenStack{
+				"":       transferMock{osmock},
+				"tenant": transferMock{tenantmock},
+			})
+
+			if test.existingVol != nil {
+				osmock.On("GetVolume", FakeVol2.ID).Return(test.existingVol, nil)
+			} else {
+				osmock.On("GetVolume", FakeVol2.ID).Return(nil, cpoerrors.ErrNotFound).Once()
+				osmock.On("GetVolume", FakeVol2.ID).Return(&transferredVol, nil)
+			}
+			tenantmock.On("GetVolume", FakeVol2.ID).Return(&srcVol, nil)
+			tenantmock.On("UpdateVolumeMetadata", FakeVol2.ID, mock.Anything).Return(nil)
+			tenantmock.On("CreateVolumeTransfer", FakeVol2.ID).Return(transfer, nil)
+			tenantmock.On("DeleteVolumeTransfer", transfer.ID).Return(nil)
+			osmock.On("AcceptVolumeTransfer", transfer.ID, transfer.AuthKey).Return(test.acceptErr)
+			osmock.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{})
+
+			req := &csi.CreateVolumeRequest{
+				Name: fakeReq.Name,
+				Parameters: map[string]string{
+					sharedcsi.PvcNameKey:      FakePVCName,
+					sharedcsi.PvcNamespaceKey: FakePVCNamespace,
+				},
+				VolumeCapabilities: fakeReq.VolumeCapabilities,
+			}
+			if test.sourceClouds != "" {
+				req.Parameters[transferSourceCloudsKey] = test.sourceClouds
+			}
+			res, err := fakeCs.CreateVolume(FakeCtx, req)
+			if test.transferred {
+				tenantmock.AssertCalled(t, "UpdateVolumeMetadata", FakeVol2.ID, map[string]string{
+					"owner":               "tenant",
+					transferredForKey:     FakeVolName,
+					cinderCSIClusterIDKey: FakeCluster,
+				})
+			} else {
+				tenantmock.AssertNotCalled(t, "CreateVolumeTransfer", FakeVol2.ID)
+			}
+			if test.expectedCode != codes.OK {
+				assert.Equal(t, test.expectedCode, status.Code(err))
+				if test.transferred {
+					tenantmock.AssertCalled(t, "DeleteVolumeTransfer", transfer.ID)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, FakeVol2.ID, res.Volume.VolumeId)
+			osmock.AssertNotCalled(t, "CreateVolume", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			tenantmock.AssertNotCalled(t, "DeleteVolumeTransfer", transfer.ID)
+		})
+	}
+}
+
+func TestGetVolumeImage(t *testing.T) {
+	snapshotSource := &csi.VolumeContentSource{
+		Type: &csi.VolumeContentSource_Snapshot{
+			Snapshot: &csi.VolumeContentSource_SnapshotSource{
+				SnapshotId: FakeSnapshotID,
+			},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		volParams      map[string]string
+		pvcAnnotations map[string]string
+		content        *csi.VolumeContentSource
+		expected       string
+		expectedCode   codes.Code
+	}{
+		{
+			name:     "no image",
+			expected: "",
+		},
+		{
+			name:      "StorageClass image",
+			volParams: map[string]string{"image": "ubuntu-24.04"},
+			expected:  "ubuntu-24.04",
+		},
+		{
+			name:           "PVC annotation overrides the StorageClass image",
+			volParams:      map[string]string{"image": "ubuntu-24.04"},
+			pvcAnnotations: map[string]string{imageKey: "fedora-40"},
+			expected:       "fedora-40",
+		},
+		{
+			name:      "data source overrides the StorageClass image",
+			volParams: map[string]string{"image": "ubuntu-24.04"},
+			content:   snapshotSource,
+			expected:  "",
+		},
+		{
+			name:           "PVC annotation with a data source",
+			pvcAnnotations: map[string]string{imageKey: "fedora-40"},
+			content:        snapshotSource,
+			expectedCode:   codes.InvalidArgument,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			image, err := getVolumeImage(test.volParams, test.pvcAnnotations, test.content)
+			if test.expectedCode != codes.OK {
+				assert.Equal(t, test.expectedCode, status.Code(err))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, image)
+		})
+	}
+}
+
 func TestCreateVolumeFromSnapshot(t *testing.T) {
 	fakeCs, osmock := fakeControllerServer()
 
 	properties := map[string]string{cinderCSIClusterIDKey: FakeCluster}
 	osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), FakeVolType, "", FakeSnapshotID, "", "", properties).Return(&FakeVolFromSnapshot, nil)
+	osmock.On("WaitVolumeTargetStatus", FakeVolFromSnapshot.ID, []string{openstack.VolumeAvailableStatus}).Return(nil)
 	osmock.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
 	osmock.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{})
 
@@ -401,20 +994,70 @@ func TestCreateVolumeFromSnapshot(t *testing.T) {
 		VolumeContentSource: src,
 	}
 
-	// Invoke CreateVolume
+	// Invoke CreateVolume
+	actualRes, err := fakeCs.CreateVolume(FakeCtx, fakeReq)
+	if err != nil {
+		t.Errorf("failed to CreateVolume: %v", err)
+	}
+
+	// Assert
+	assert.NotNil(actualRes.Volume)
+
+	assert.NotNil(actualRes.Volume.CapacityBytes)
+
+	assert.NotEqual(0, len(actualRes.Volume.VolumeId), "Volume Id is nil")
+
+	assert.Equal(FakeSnapshotID, actualRes.Volume.ContentSource.GetSnapshot().SnapshotId)
+}
+
+// Test CreateVolume from a snapshot of another availability zone
+func TestCreateVolumeFromSnapshotCrossAZ(t *testing.T) {
+	fakeCs, osmock := fakeControllerServer()
+
+	backupName := restoreBackupPrefix + FakeVolName
+	backup := backups.Backup{ID: "backup-1", Name: backupName, Status: "available"}
+	restored := &volumes.Volume{ID: "vol-restored", Name: FakeVolName, Status: "available", AvailabilityZone: "zone2", Size: 1}
+	properties := map[string]string{cinderCSIClusterIDKey: FakeCluster}
+	osmock.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
+	osmock.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{})
+	osmock.On("ListBackups", map[string]string{"Name": backupName}).Return([]backups.Backup{}, nil).Once()
+	osmock.On("CreateBackup", backupName, "CSIVolumeID", FakeSnapshotID, "", map[string]string{cinderCSIClusterIDKey: FakeCluster, restoreSnapshotKey: FakeSnapshotID}).Return(&backup, nil)
+	osmock.On("WaitBackupReady", backup.ID).Return("available", nil)
+	osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), FakeVolType, "zone2", "", "", backup.ID, properties).Return(restored, nil)
+	osmock.On("ListBackups", map[string]string{"Name": backupName}).Return([]backups.Backup{backup}, nil)
+	osmock.On("DeleteBackup", backup.ID).Return(nil)
+
+	src := &csi.VolumeContentSource{
+		Type: &csi.VolumeContentSource_Snapshot{
+			Snapshot: &csi.VolumeContentSource_SnapshotSource{
+				SnapshotId: FakeSnapshotID,
+			},
+		},
+	}
+	fakeReq := &csi.CreateVolumeRequest{
+		Name: FakeVolName,
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+		Parameters:          map[string]string{"availability": "zone2", crossAZRestoreKey: crossAZRestoreBackup},
+		VolumeContentSource: src,
+	}
+
+	// the snapshot of the volume of zone nova is restored from a backup,
+	// which is deleted once the volume is available
 	actualRes, err := fakeCs.CreateVolume(FakeCtx, fakeReq)
-	if err != nil {
-		t.Errorf("failed to CreateVolume: %v", err)
-	}
-
-	// Assert
-	assert.NotNil(actualRes.Volume)
-
-	assert.NotNil(actualRes.Volume.CapacityBytes)
-
-	assert.NotEqual(0, len(actualRes.Volume.VolumeId), "Volume Id is nil")
-
-	assert.Equal(FakeSnapshotID, actualRes.Volume.ContentSource.GetSnapshot().SnapshotId)
+	assert.NoError(t, err)
+	assert.Equal(t, restored.ID, actualRes.Volume.VolumeId)
+	assert.Equal(t, FakeSnapshotID, actualRes.Volume.ContentSource.GetSnapshot().GetSnapshotId())
+	osmock.AssertCalled(t, "DeleteBackup", backup.ID)
+
+	fakeReq.Parameters[crossAZRestoreKey] = "migrate"
+	_, err = fakeCs.CreateVolume(FakeCtx, fakeReq)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
 }
 
 func TestCreateVolumeFromSourceVolume(t *testing.T) {
@@ -422,6 +1065,7 @@ func TestCreateVolumeFromSourceVolume(t *testing.T) {
 
 	properties := map[string]string{cinderCSIClusterIDKey: FakeCluster}
 	osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), FakeVolType, "", "", FakeVolID, "", properties).Return(&FakeVolFromSourceVolume, nil)
+	osmock.On("WaitVolumeTargetStatus", FakeVolFromSourceVolume.ID, []string{openstack.VolumeAvailableStatus}).Return(nil)
 	osmock.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
 	osmock.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{})
 
@@ -464,6 +1108,56 @@ func TestCreateVolumeFromSourceVolume(t *testing.T) {
 	assert.Equal(FakeVolID, actualRes.Volume.ContentSource.GetVolume().VolumeId)
 }
 
+// Test CreateVolume from a fast clone source given in the parameters
+func TestCreateVolumeFastClone(t *testing.T) {
+	fakeCs, osmock := fakeControllerServer()
+
+	properties := map[string]string{cinderCSIClusterIDKey: FakeCluster}
+	osmock.On("CreateVolume", FakeVolName, 2, FakeVolType, "", FakeSnapshotID, "", "", properties).Return(&FakeVolFromSnapshot, nil)
+	osmock.On("WaitVolumeTargetStatus", FakeVolFromSnapshot.ID, []string{openstack.VolumeAvailableStatus}).Return(nil)
+	osmock.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
+	osmock.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{})
+
+	assert := assert.New(t)
+
+	fakeReq := &csi.CreateVolumeRequest{
+		Name: FakeVolName,
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+		CapacityRange: &csi.CapacityRange{RequiredBytes: 2 * 1024 * 1024 * 1024},
+		Parameters:    map[string]string{fastCloneSnapshotKey: FakeSnapshotID},
+	}
+
+	actualRes, err := fakeCs.CreateVolume(FakeCtx, fakeReq)
+	assert.NoError(err)
+
+	// the fast clone source is not the content source of the volume, but its
+	// file system must be resized
+	assert.Nil(actualRes.Volume.ContentSource)
+	assert.Equal("true", actualRes.Volume.VolumeContext[ResizeRequired])
+
+	// the mock returns FakeVol2 for all the volumes
+	osmock.On("CreateVolume", FakeVolName, 2, FakeVolType, "", "", FakeVol2.ID, "", properties).Return(&FakeVolFromSourceVolume, nil)
+	osmock.On("WaitVolumeTargetStatus", FakeVolFromSourceVolume.ID, []string{openstack.VolumeAvailableStatus}).Return(nil)
+	fakeReq.Parameters = map[string]string{fastCloneVolumeKey: "golden"}
+	actualRes, err = fakeCs.CreateVolume(FakeCtx, fakeReq)
+	assert.NoError(err)
+	assert.Nil(actualRes.Volume.ContentSource)
+
+	fakeReq.Parameters = map[string]string{fastCloneSnapshotKey: FakeSnapshotID, fastCloneVolumeKey: "golden"}
+	_, err = fakeCs.CreateVolume(FakeCtx, fakeReq)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+
+	fakeReq.Parameters = map[string]string{fastCloneSnapshotKey: FakeSnapshotID, "image": "fedora-40"}
+	_, err = fakeCs.CreateVolume(FakeCtx, fakeReq)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+}
+
 // Test CreateVolume when a volume with the given name already exists
 func TestCreateVolumeDuplicate(t *testing.T) {
 	fakeCs, osmock := fakeControllerServer()
@@ -504,6 +1198,7 @@ func TestDeleteVolume(t *testing.T) {
 	fakeCs, osmock := fakeControllerServer()
 
 	osmock.On("DeleteVolume", FakeVolID).Return(nil)
+	osmock.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{})
 
 	assert := assert.New(t)
 
@@ -525,10 +1220,213 @@ func TestDeleteVolume(t *testing.T) {
 	assert.Equal(expectedRes, actualRes)
 }
 
+func TestEnsureVolumeTypeEncryption(t *testing.T) {
+	encryption := &volumetypes.GetEncryptionType{
+		EncryptionID:    "fake-encryption",
+		Provider:        "luks",
+		Cipher:          "aes-xts-plain64",
+		KeySize:         256,
+		ControlLocation: "front-end",
+	}
+
+	tests := []struct {
+		name       string
+		volType    string
+		params     map[string]string
+		encryption *volumetypes.GetEncryptionType
+		getErr     error
+		wantCode   codes.Code
+	}{
+		{
+			name:     "encryption not requested",
+			volType:  "plain",
+			wantCode: codes.OK,
+		},
+		{
+			name:     "encryption parameters without encrypted",
+			volType:  "plain",
+			params:   map[string]string{openstack.VolumeEncryptionCipher: "aes-xts-plain64"},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "missing volume type",
+			params:   map[string]string{openstack.VolumeEncrypted: "true"},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:       "encrypted volume type",
+			volType:    "luks",
+			params:     map[string]string{openstack.VolumeEncrypted: "true", openstack.VolumeEncryptionKeySize: "256"},
+			encryption: encryption,
+			wantCode:   codes.OK,
+		},
+		{
+			name:       "encrypted volume type with another cipher",
+			volType:    "luks",
+			params:     map[string]string{openstack.VolumeEncrypted: "true", openstack.VolumeEncryptionCipher: "aes-cbc-essiv"},
+			encryption: encryption,
+			wantCode:   codes.InvalidArgument,
+		},
+		{
+			name:     "volume type is not encrypted",
+			volType:  "plain",
+			params:   map[string]string{openstack.VolumeEncrypted: "true"},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "volume type not found",
+			volType:  "luks",
+			params:   map[string]string{openstack.VolumeEncrypted: "true"},
+			getErr:   cpoerrors.ErrNotFound,
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:    "volume type not found with an encryption provider",
+			volType: "luks",
+			params: map[string]string{
+				openstack.VolumeEncrypted:          "true",
+				openstack.VolumeEncryptionProvider: "luks",
+			},
+			getErr:   cpoerrors.ErrNotFound,
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:       "encrypted volume type with another provider",
+			volType:    "luks",
+			params:     map[string]string{openstack.VolumeEncrypted: "true", openstack.VolumeEncryptionProvider: "plain"},
+			encryption: encryption,
+			wantCode:   codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			osmock := new(openstack.OpenStackMock)
+			osmock.On("GetVolumeTypeEncryption", tt.volType).Return(tt.encryption, tt.getErr)
+
+			err := ensureVolumeTypeEncryption(FakeCtx, osmock, tt.volType, tt.params)
+			assert.Equal(t, tt.wantCode, status.Code(err), err)
+		})
+	}
+}
+
+func TestEnsureVolumeTypeQoS(t *testing.T) {
+	gold := &qos.QoS{ID: "gold-id", Name: "gold", Consumer: "front-end", Specs: map[string]string{"total_iops_sec": "1000"}}
+
+	tests := []struct {
+		name      string
+		volType   string
+		params    map[string]string
+		specs     *qos.QoS
+		getErr    error
+		typeSpecs *qos.QoS
+		typeErr   error
+		wantCode  codes.Code
+	}{
+		{
+			name:     "no QoS",
+			volType:  "plain",
+			wantCode: codes.OK,
+		},
+		{
+			name:     "limits without QoS specs",
+			volType:  "plain",
+			params:   map[string]string{"total-iops-sec": "1000"},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "missing volume type",
+			params:   map[string]string{openstack.VolumeQoSSpecs: "gold"},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "invalid limit",
+			volType:  "gold",
+			params:   map[string]string{openstack.VolumeQoSSpecs: "gold", "read-bytes-sec": "-1"},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:      "volume type associated with the QoS specs",
+			volType:   "gold",
+			params:    map[string]string{openstack.VolumeQoSSpecs: "gold", "total-iops-sec": "1000"},
+			specs:     gold,
+			typeSpecs: gold,
+			wantCode:  codes.OK,
+		},
+		{
+			name:     "QoS specs with another limit",
+			volType:  "gold",
+			params:   map[string]string{openstack.VolumeQoSSpecs: "gold", "total-iops-sec": "2000"},
+			specs:    gold,
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "volume type without QoS specs",
+			volType:  "plain",
+			params:   map[string]string{openstack.VolumeQoSSpecs: "gold"},
+			specs:    gold,
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "QoS specs not found",
+			volType:  "gold",
+			params:   map[string]string{openstack.VolumeQoSSpecs: "gold"},
+			getErr:   cpoerrors.ErrNotFound,
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "QoS specs with limits not found",
+			volType:  "gold",
+			params:   map[string]string{openstack.VolumeQoSSpecs: "gold", "total-iops-sec": "1000"},
+			getErr:   cpoerrors.ErrNotFound,
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "volume type not found",
+			volType:  "gold",
+			params:   map[string]string{openstack.VolumeQoSSpecs: "gold"},
+			specs:    gold,
+			typeErr:  cpoerrors.ErrNotFound,
+			wantCode: codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			osmock := new(openstack.OpenStackMock)
+			osmock.On("GetQoSSpecs", "gold").Return(tt.specs, tt.getErr)
+			osmock.On("GetVolumeTypeQoSSpecs", tt.volType).Return(tt.typeSpecs, tt.typeErr)
+
+			err := ensureVolumeTypeQoS(FakeCtx, osmock, "CreateVolume", tt.volType, tt.params)
+			assert.Equal(t, tt.wantCode, status.Code(err), err)
+		})
+	}
+}
+
+func TestGetCapacity(t *testing.T) {
+	fakeCs, osmock := fakeControllerServer()
+
+	osmock.On("GetVolumeQuota", "").Return(&openstack.VolumeQuota{AvailableGB: openstack.UnlimitedQuota, MaxVolumeSizeGB: openstack.UnlimitedQuota}, nil)
+	osmock.On("GetVolumeQuota", "gold").Return(&openstack.VolumeQuota{AvailableGB: 100, MaxVolumeSizeGB: 10}, nil)
+
+	assert := assert.New(t)
+
+	res, err := fakeCs.GetCapacity(FakeCtx, &csi.GetCapacityRequest{})
+	assert.NoError(err)
+	assert.Equal(int64(math.MaxInt64), res.AvailableCapacity)
+	assert.Nil(res.MaximumVolumeSize)
+
+	res, err = fakeCs.GetCapacity(FakeCtx, &csi.GetCapacityRequest{
+		Parameters: map[string]string{"type": "gold"},
+	})
+	assert.NoError(err)
+	assert.Equal(int64(100*1024*1024*1024), res.AvailableCapacity)
+	assert.Equal(int64(10*1024*1024*1024), res.MaximumVolumeSize.GetValue())
+}
+
 // Test ControllerPublishVolume
 func TestControllerPublishVolume(t *testing.T) {
 	fakeCs, osmock := fakeControllerServer()
 
+	osmock.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{})
 	osmock.On("AttachVolume", FakeNodeID, FakeVolID).Return(FakeVolID, nil)
 	osmock.On("WaitDiskAttached", FakeNodeID, FakeVolID).Return(nil)
 	osmock.On("GetAttachmentDiskPath", FakeNodeID, FakeVolID).Return(FakeDevicePath, nil)
@@ -564,10 +1462,89 @@ func TestControllerPublishVolume(t *testing.T) {
 	assert.Equal(expectedRes, actualRes)
 }
 
+func TestControllerPublishVolumeCrossAZ(t *testing.T) {
+	fakeCs, osmock := fakeControllerServer()
+
+	osmock.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{})
+	osmock.On("AttachVolume", FakeNodeID, FakeVolID).Return("", errors.Join(errors.New("bad request"), cpoerrors.ErrCrossAZAttach))
+
+	// the mock returns FakeVol2 for all the volumes
+	pv := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pv"},
+		Spec: corev1.PersistentVolumeSpec{
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: driverName, VolumeHandle: FakeVol2.ID},
+			},
+			ClaimRef: &corev1.ObjectReference{Namespace: "default", Name: "pvc"},
+		},
+	}
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pvc"}}
+	podSpec := corev1.PodSpec{
+		Volumes: []corev1.Volume{{
+			Name: "data",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "pvc"},
+			},
+		}},
+	}
+	pending := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pending"},
+		Spec:       podSpec,
+		Status:     corev1.PodStatus{Phase: corev1.PodPending},
+	}
+	running := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "running"},
+		Spec:       podSpec,
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	pvIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.NoError(t, pvIndexer.Add(pv))
+	recorder := record.NewFakeRecorder(10)
+	fakeCs.Driver.events = &eventReporter{
+		kube:     fake.NewClientset(pvc, pending, running),
+		pvLister: corelisters.NewPersistentVolumeLister(pvIndexer),
+		recorder: recorder,
+	}
+
+	_, err := fakeCs.ControllerPublishVolume(FakeCtx, &csi.ControllerPublishVolumeRequest{
+		VolumeId: FakeVolID,
+		NodeId:   FakeNodeID,
+		VolumeCapability: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{},
+			},
+		},
+	})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Contains(t, err.Error(), topologyKey+"="+FakeVol2.AvailabilityZone)
+
+	// one event for the PVC and one for the pending pod
+	assert.Len(t, recorder.Events, 2)
+	for range 2 {
+		assert.Contains(t, <-recorder.Events, "Warning "+eventReasonCrossAZAttach)
+	}
+}
+
+func TestCrossAZAttachErrorAvailabilityZoneMap(t *testing.T) {
+	fakeCs, _ := fakeControllerServer()
+
+	bsOpts := openstack.BlockStorageOpts{AvailabilityZoneMap: []string{"nova-1:cinder-1", "nova-2:cinder-1"}}
+	assert.NoError(t, bsOpts.ParseAvailabilityZoneMap())
+	vol := &volumes.Volume{ID: FakeVolID, AvailabilityZone: "cinder-1"}
+	server := &servers.Server{ID: FakeNodeID, AvailabilityZone: "nova-3"}
+
+	// the hint gives the Nova AZs of the nodes, not the Cinder AZ
+	err := fakeCs.crossAZAttachError(FakeCtx, bsOpts, vol, server)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Contains(t, err.Error(), topologyKey+"=nova-1 or "+topologyKey+"=nova-2")
+	assert.NotContains(t, err.Error(), topologyKey+"=cinder-1")
+}
+
 // Test ControllerUnpublishVolume
 func TestControllerUnpublishVolume(t *testing.T) {
 	fakeCs, osmock := fakeControllerServer()
 
+	osmock.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{})
 	osmock.On("DetachVolume", FakeNodeID, FakeVolID).Return(nil)
 	osmock.On("WaitDiskDetached", FakeNodeID, FakeVolID).Return(nil)
 
@@ -608,6 +1585,7 @@ func genFakeVolumeEntry(fakeVol volumes.Volume) *csi.ListVolumesResponse_Entry {
 		},
 		Status: &csi.ListVolumesResponse_VolumeStatus{
 			PublishedNodeIds: extractFakeNodeIDs(fakeVol.Attachments),
+			VolumeCondition:  volumeCondition(&fakeVol),
 		},
 	}
 }
@@ -620,6 +1598,45 @@ func genFakeVolumeEntries(fakeVolumes []volumes.Volume) []*csi.ListVolumesRespon
 	return entries
 }
 
+func TestVolumeCondition(t *testing.T) {
+	tests := []struct {
+		name     string
+		vol      volumes.Volume
+		abnormal bool
+	}{
+		{
+			name: "available",
+			vol:  volumes.Volume{ID: FakeVolID, Status: "available"},
+		},
+		{
+			name: "in-use",
+			vol:  volumes.Volume{ID: FakeVolID, Status: "in-use", Attachments: []volumes.Attachment{FakeAttachment}},
+		},
+		{
+			name:     "error",
+			vol:      volumes.Volume{ID: FakeVolID, Status: "error_extending"},
+			abnormal: true,
+		},
+		{
+			name:     "in-use without attachments",
+			vol:      volumes.Volume{ID: FakeVolID, Status: "in-use"},
+			abnormal: true,
+		},
+		{
+			name:     "available with attachments",
+			vol:      volumes.Volume{ID: FakeVolID, Status: "available", Attachments: []volumes.Attachment{FakeAttachment}},
+			abnormal: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition := volumeCondition(&tt.vol)
+			assert.Equal(t, tt.abnormal, condition.Abnormal, condition.Message)
+			assert.NotEmpty(t, condition.Message)
+		})
+	}
+}
+
 func TestListVolumes(t *testing.T) {
 	fakeCs, osmock := fakeControllerServer()
 
@@ -981,6 +1998,7 @@ func TestGlobalListVolumesMultipleClouds(t *testing.T) {
 func TestCreateSnapshot(t *testing.T) {
 	fakeCs, osmock := fakeControllerServer()
 
+	osmock.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{})
 	osmock.On("CreateSnapshot", FakeSnapshotName, FakeVolID, map[string]string{cinderCSIClusterIDKey: "cluster"}).Return(&FakeSnapshotRes, nil)
 	osmock.On("ListSnapshots", map[string]string{"Name": FakeSnapshotName}).Return(FakeSnapshotListEmpty, "", nil)
 	osmock.On("WaitSnapshotReady", FakeSnapshotID).Return(FakeSnapshotRes.Status, nil)
@@ -1008,6 +2026,64 @@ func TestCreateSnapshot(t *testing.T) {
 	assert.NotNil(FakeSnapshotID, actualRes.Snapshot.SnapshotId)
 }
 
+// Test CreateSnapshot of a snapshot which is not ready after the timeout
+func TestCreateSnapshotNotReady(t *testing.T) {
+	fakeCs, osmock := fakeControllerServer()
+
+	osmock.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{})
+	osmock.On("CreateSnapshot", FakeSnapshotName, FakeVolID, map[string]string{cinderCSIClusterIDKey: "cluster"}).Return(&FakeSnapshotRes, nil)
+	osmock.On("ListSnapshots", map[string]string{"Name": FakeSnapshotName}).Return(FakeSnapshotListEmpty, "", nil)
+	osmock.On("WaitSnapshotReady", FakeSnapshotID).Return("creating", fmt.Errorf("%w: snapshot %s is still not ready", cpoerrors.ErrSnapshotNotReady, FakeSnapshotID))
+	osmock.On("ListBackups", map[string]string{"Name": FakeSnapshotName}).Return(FakeBackupListEmpty, nil)
+
+	recorder := record.NewFakeRecorder(10)
+	vs := &metav1.PartialObjectMetadata{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "snapshot.storage.k8s.io/v1", Kind: "VolumeSnapshot"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "snap", UID: "snap-uid"},
+	}
+	scheme := metadatafake.NewTestScheme()
+	assert.NoError(t, metav1.AddMetaToScheme(scheme))
+	fakeCs.Driver.events = &eventReporter{
+		metadata: metadatafake.NewSimpleMetadataClient(scheme, vs),
+		recorder: recorder,
+	}
+
+	// the snapshot is reported as not ready to use, instead of failing
+	actualRes, err := fakeCs.CreateSnapshot(FakeCtx, &csi.CreateSnapshotRequest{
+		Name:           FakeSnapshotName,
+		SourceVolumeId: FakeVolID,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, FakeSnapshotID, actualRes.Snapshot.SnapshotId)
+	assert.False(t, actualRes.Snapshot.ReadyToUse)
+
+	// a backup can't be created from the snapshot yet
+	osmock.On("BackupsAreEnabled").Return(true, nil)
+	_, err = fakeCs.CreateSnapshot(FakeCtx, &csi.CreateSnapshotRequest{
+		Name:           FakeSnapshotName,
+		SourceVolumeId: FakeVolID,
+		Parameters:     map[string]string{openstack.SnapshotType: "backup"},
+	})
+	assert.Equal(t, codes.Aborted, status.Code(err))
+
+	// the progress is reported on the VolumeSnapshot of the snapshot
+	fakeCs.snapshotProgressReporter(FakeCtx)(&snapshots.Snapshot{
+		ID:       FakeSnapshotID,
+		VolumeID: FakeVolID,
+		Status:   "creating",
+		Progress: "42%",
+		Metadata: map[string]string{
+			sharedcsi.VolSnapshotNameKey:      "snap",
+			sharedcsi.VolSnapshotNamespaceKey: "default",
+		},
+	})
+	assert.Equal(t, "Normal "+eventReasonSnapshotProgress+" Snapshot "+FakeSnapshotID+" of volume "+FakeVolID+" is creating, progress: 42%", <-recorder.Events)
+
+	// the snapshots created without --extra-create-metadata have no VolumeSnapshot
+	fakeCs.snapshotProgressReporter(FakeCtx)(&snapshots.Snapshot{ID: FakeSnapshotID, Status: "creating"})
+	assert.Empty(t, recorder.Events)
+}
+
 // Test CreateSnapshot with extra metadata
 func TestCreateSnapshotWithExtraMetadata(t *testing.T) {
 	fakeCs, osmock := fakeControllerServer()
@@ -1020,6 +2096,7 @@ func TestCreateSnapshotWithExtraMetadata(t *testing.T) {
 		openstack.SnapshotForceCreate:       "true",
 	}
 
+	osmock.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{})
 	osmock.On("CreateSnapshot", FakeSnapshotName, FakeVolID, properties).Return(&FakeSnapshotRes, nil)
 	osmock.On("ListSnapshots", map[string]string{"Name": FakeSnapshotName}).Return(FakeSnapshotListEmpty, "", nil)
 	osmock.On("WaitSnapshotReady", FakeSnapshotID).Return(FakeSnapshotRes.Status, nil)
@@ -1050,6 +2127,137 @@ func TestCreateSnapshotWithExtraMetadata(t *testing.T) {
 	assert.NotNil(FakeSnapshotID, actualRes.Snapshot.SnapshotId)
 }
 
+// Test CreateSnapshot with an incremental backup
+func TestCreateSnapshotIncrementalBackup(t *testing.T) {
+	fakeCs, osmock := fakeControllerServer()
+
+	backupProperties := map[string]string{
+		cinderCSIClusterIDKey:       FakeCluster,
+		openstack.SnapshotType:      "backup",
+		openstack.BackupIncremental: "true",
+		openstack.BackupContainer:   "k8s-backups",
+	}
+
+	osmock.On("ListBackups", map[string]string{"Name": FakeSnapshotName}).Return(FakeBackupListEmpty, nil)
+	osmock.On("ListSnapshots", map[string]string{"Name": FakeSnapshotName}).Return(FakeSnapshotListEmpty, "", nil)
+	osmock.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{})
+	osmock.On("CreateSnapshot", FakeSnapshotName, FakeVolID, map[string]string{cinderCSIClusterIDKey: FakeCluster}).Return(&FakeSnapshotRes, nil)
+	osmock.On("WaitSnapshotReady", FakeSnapshotID).Return(FakeSnapshotRes.Status, nil)
+	osmock.On("CreateBackup", FakeSnapshotName, FakeVolID, FakeSnapshotID, "nova2", backupProperties).Return(&backups.Backup{ID: FakeBackupID, Status: "creating"}, nil)
+	osmock.On("WaitBackupReady", FakeBackupID).Return("available", nil)
+	osmock.On("DeleteSnapshot", FakeSnapshotID).Return(nil)
+
+	assert := assert.New(t)
+
+	// Fake request
+	fakeReq := &csi.CreateSnapshotRequest{
+		Name:           FakeSnapshotName,
+		SourceVolumeId: FakeVolID,
+		Parameters: map[string]string{
+			openstack.SnapshotType:             "backup",
+			openstack.BackupIncremental:        "true",
+			openstack.BackupContainer:          "k8s-backups",
+			openstack.SnapshotAvailabilityZone: "nova2",
+		},
+	}
+
+	// Invoke CreateSnapshot
+	actualRes, err := fakeCs.CreateSnapshot(FakeCtx, fakeReq)
+	if err != nil {
+		t.Errorf("failed to CreateSnapshot: %v", err)
+	}
+
+	// Assert
+	osmock.AssertCalled(t, "CreateBackup", FakeSnapshotName, FakeVolID, FakeSnapshotID, "nova2", backupProperties)
+	assert.Equal(FakeVolID, actualRes.Snapshot.SourceVolumeId)
+	assert.True(actualRes.Snapshot.ReadyToUse)
+}
+
+// Test ControllerModifyVolume
+func TestControllerModifyVolume(t *testing.T) {
+	osmock := new(openstack.OpenStackMock)
+	d := NewDriver(&DriverOpts{Endpoint: FakeEndpoint, ClusterID: FakeCluster, VolumeModification: true})
+	fakeCs := NewControllerServer(d, map[string]openstack.IOpenStack{"": osmock})
+
+	osmock.On("ChangeVolumeType", FakeVolID, "gold", "on-demand").Return(nil)
+	osmock.On("WaitVolumeTargetStatusWithTimeout", FakeVolID, []string{openstack.VolumeAvailableStatus, openstack.VolumeInUseStatus}, defaultVolumeModificationTimeout).Return(nil)
+
+	tests := []struct {
+		name     string
+		params   map[string]string
+		wantCode codes.Code
+	}{
+		{
+			name:     "missing type",
+			params:   map[string]string{openstack.VolumeMigrationPolicy: "never"},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "unsupported parameter",
+			params:   map[string]string{"type": "gold", "availability": "nova"},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "invalid migration policy",
+			params:   map[string]string{"type": "gold", openstack.VolumeMigrationPolicy: "always"},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			// the mocked volume keeps its volume type
+			name:     "retype failed",
+			params:   map[string]string{"type": "gold"},
+			wantCode: codes.Internal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := fakeCs.ControllerModifyVolume(FakeCtx, &csi.ControllerModifyVolumeRequest{
+				VolumeId:          FakeVolID,
+				MutableParameters: tt.params,
+			})
+			assert.Equal(t, tt.wantCode, status.Code(err), err)
+		})
+	}
+	osmock.AssertCalled(t, "ChangeVolumeType", FakeVolID, "gold", "on-demand")
+
+	// disabled volume modification
+	fakeCs, _ = fakeControllerServer()
+	_, err := fakeCs.ControllerModifyVolume(FakeCtx, &csi.ControllerModifyVolumeRequest{
+		VolumeId:          FakeVolID,
+		MutableParameters: map[string]string{"type": "gold"},
+	})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+// Test CreateVolume with the mutable parameters of a VolumeAttributesClass
+func TestCreateVolumeWithMutableParameters(t *testing.T) {
+	fakeCs, osmock := fakeControllerServer()
+
+	properties := map[string]string{cinderCSIClusterIDKey: FakeCluster}
+	osmock.On("CreateVolume", FakeVolName, mock.AnythingOfType("int"), "gold", FakeAvailability, "", "", "", properties).Return(&FakeVol, nil)
+	osmock.On("WaitVolumeTargetStatus", FakeVol.ID, []string{openstack.VolumeAvailableStatus}).Return(nil)
+	osmock.On("GetVolumesByName", FakeVolName).Return(FakeVolListEmpty, nil)
+	osmock.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{})
+
+	fakeReq := &csi.CreateVolumeRequest{
+		Name: FakeVolName,
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+		Parameters:        map[string]string{"type": "silver", "availability": FakeAvailability},
+		MutableParameters: map[string]string{"type": "gold"},
+	}
+
+	_, err := fakeCs.CreateVolume(FakeCtx, fakeReq)
+	assert.NoError(t, err)
+	osmock.AssertCalled(t, "CreateVolume", FakeVolName, mock.AnythingOfType("int"), "gold", FakeAvailability, "", "", "", properties)
+	assert.Equal(t, "silver", fakeReq.Parameters["type"], "the request parameters must not be modified")
+}
+
 // Test DeleteSnapshot
 func TestDeleteSnapshot(t *testing.T) {
 	fakeCs, osmock := fakeControllerServer()
@@ -1189,3 +2397,12 @@ func TestValidateVolumeCapabilities(t *testing.T) {
 	assert.Equal(expectedRes, actualRes)
 	assert.Equal(expectedRes2, actualRes2)
 }
+
+func TestIsPublishedToOtherNode(t *testing.T) {
+	attached := []volumes.Attachment{{ServerID: "node1"}}
+
+	assert.False(t, isPublishedToOtherNode(&volumes.Volume{}, "node1"))
+	assert.False(t, isPublishedToOtherNode(&volumes.Volume{Attachments: attached}, "node1"))
+	assert.True(t, isPublishedToOtherNode(&volumes.Volume{Attachments: attached}, "node2"))
+	assert.False(t, isPublishedToOtherNode(&volumes.Volume{Attachments: attached, Multiattach: true}, "node2"))
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
+	"k8s.io/cloud-provider-openstack/pkg/util/blockdevice"
+	"k8s.io/cloud-provider-openstack/pkg/util/mount"
+)
+
+const (
+	defaultMultipathTimeout     = 10 * time.Second
+	defaultDeviceCleanupTimeout = 30 * time.Second
+	defaultDevicePollInterval   = time.Second
+)
+
+// devicePollInterval returns the interval the node scans for the devices of
+// the volumes at.
+func (ns *nodeServer) devicePollInterval() time.Duration {
+	if ns.Opts.NodeDevicePollInterval.Duration > 0 {
+		return ns.Opts.NodeDevicePollInterval.Duration
+	}
+	return defaultDevicePollInterval
+}
+
+// deviceWaitOpts returns the options of the wait for the devices of the
+// attached volumes.
+func (ns *nodeServer) deviceWaitOpts() mount.DeviceWaitOpts {
+	return mount.DeviceWaitOpts{
+		Timeout:      ns.Opts.NodeDeviceScanTimeout.Duration,
+		PollInterval: ns.Opts.NodeDevicePollInterval.Duration,
+		UdevSettle:   ns.Opts.NodeUdevSettle,
+		PreferByPath: ns.Opts.NodeDevicePathType == openstack.DevicePathTypeByPath,
+	}
+}
+
+// stageDevicePath returns the device the volume is staged from. With the
+// node-multipath option, it is the multipath map of the device of the volume,
+// which is created if multipathd didn't create it yet. The device itself is
+// used if the map can not be created.
+func (ns *nodeServer) stageDevicePath(devicePath string) string {
+	if !ns.Opts.NodeMultipath {
+		return devicePath
+	}
+
+	mpath, err := blockdevice.GetMultipathDevice(devicePath)
+	if err == nil && mpath != "" {
+		klog.V(4).Infof("Using multipath map %s of device %s", mpath, devicePath)
+		return mpath
+	}
+
+	if err := blockdevice.CreateMultipathDevice(devicePath); err != nil {
+		klog.Warningf("Using the single path %s: %v", devicePath, err)
+		return devicePath
+	}
+
+	timeout := ns.Opts.NodeDeviceScanTimeout.Duration
+	if timeout <= 0 {
+		timeout = defaultMultipathTimeout
+	}
+	err = wait.PollUntilContextTimeout(context.Background(), ns.devicePollInterval(), timeout, true, func(context.Context) (bool, error) {
+		mpath, err = blockdevice.GetMultipathDevice(devicePath)
+		return mpath != "", err
+	})
+	if err != nil {
+		klog.Warningf("Multipath map of device %s was not created, using the single path: %v", devicePath, err)
+		return devicePath
+	}
+
+	klog.V(4).Infof("Using multipath map %s of device %s", mpath, devicePath)
+	return mpath
+}
+
+// cleanupVolumeDevices flushes the multipath map of the unstaged volume and
+// removes its SCSI devices, so that no stale devices are left behind on the
+// node once the volume is detached.
+func (ns *nodeServer) cleanupVolumeDevices(volumeID string) error {
+	devicePath, err := ns.Mount.GetDevicePath(volumeID, mount.DeviceWaitOpts{Timeout: defaultDevicePollInterval})
+	if err != nil {
+		klog.V(4).Infof("No device left for volume %s: %v", volumeID, err)
+		return nil
+	}
+
+	resolved, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		return err
+	}
+	devices := []string{filepath.Base(resolved)}
+
+	mpath, err := blockdevice.GetMultipathDevice(devicePath)
+	if err != nil {
+		return err
+	}
+	if mpath != "" {
+		if devices, err = blockdevice.GetMultipathPaths(mpath); err != nil {
+			return err
+		}
+		if err := blockdevice.FlushMultipathDevice(mpath); err != nil {
+			return err
+		}
+	}
+
+	var removed []string
+	for _, dev := range devices {
+		ok, err := blockdevice.RemoveSCSIDevice(dev)
+		if err != nil {
+			return err
+		}
+		if ok {
+			removed = append(removed, dev)
+		}
+	}
+
+	timeout := ns.Opts.NodeDeviceCleanupTimeout.Duration
+	if timeout <= 0 {
+		timeout = defaultDeviceCleanupTimeout
+	}
+	err = wait.PollUntilContextTimeout(context.Background(), ns.devicePollInterval(), timeout, true, func(context.Context) (bool, error) {
+		for _, dev := range removed {
+			if blockdevice.DeviceExists(dev) {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("devices %v of volume %s were not removed: %v", removed, volumeID, err)
+	}
+
+	klog.V(4).Infof("Removed devices %v of volume %s", removed, volumeID)
+	return nil
+}
+
+// rescanVolumeDevice rescans the device of the volume until it has the new
+// size. With the node-multipath option, all the paths of the multipath map of
+// the device are rescanned and the map is resized.
+func (ns *nodeServer) rescanVolumeDevice(devicePath, volumePath string, newSize int64) error {
+	var mpath string
+	if ns.Opts.NodeMultipath {
+		if blockdevice.IsMultipathDevice(devicePath) {
+			mpath = devicePath
+		} else if m, err := blockdevice.GetMultipathDevice(devicePath); err == nil {
+			mpath = m
+		}
+	}
+	if mpath == "" {
+		return blockdevice.RescanBlockDeviceGeometry(devicePath, volumePath, newSize)
+	}
+
+	paths, err := blockdevice.GetMultipathPaths(mpath)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		if err := blockdevice.RescanBlockDeviceGeometry(filepath.Join("/dev", p), volumePath, newSize); err != nil {
+			return err
+		}
+	}
+	return blockdevice.ResizeMultipathDevice(mpath)
+}
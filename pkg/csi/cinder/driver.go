@@ -17,12 +17,19 @@ limitations under the License.
 package cinder
 
 import (
+	"context"
 	"fmt"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/listers/core/v1"
+	kubemetadata "k8s.io/client-go/metadata"
 	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
 	"k8s.io/cloud-provider-openstack/pkg/util/metadata"
 	"k8s.io/cloud-provider-openstack/pkg/util/mount"
@@ -39,6 +46,10 @@ const (
 
 	// ResizeRequired parameter, if set to true, will trigger a resize on mount operation
 	ResizeRequired = driverName + "/resizeRequired"
+
+	// defaultVolumeModificationTimeout is the default duration the retype of
+	// a volume is waited for
+	defaultVolumeModificationTimeout = time.Hour
 )
 
 var (
@@ -77,15 +88,63 @@ type Driver struct {
 	cscap []*csi.ControllerServiceCapability
 	nscap []*csi.NodeServiceCapability
 
+	gc *orphanCollector
+	// attachments reconciles the stuck VolumeAttachments, if set
+	attachments *attachmentReconciler
+	// backendLabels labels the PVs with the backend of their volume, if set
+	backendLabels *backendLabeler
+	// attachLimiter limits the concurrent attach and detach operations
+	attachLimiter *attachLimiter
+	// provisionLimiter limits the volume creations and deletions
+	provisionLimiter *provisionLimiter
+	// events reports the volume errors as Kubernetes events, if set
+	events *eventReporter
+	// leader runs the background tasks on the leader replica only, if set
+	leader *leaderElector
+	// shutdownGracePeriod is the duration the in-flight calls are waited for
+	// on shutdown
+	shutdownGracePeriod time.Duration
+	// volumeModificationTimeout is the duration ControllerModifyVolume waits
+	// for the retype of a volume
+	volumeModificationTimeout time.Duration
+
 	pvcLister v1.PersistentVolumeClaimLister
+	// nodeLister finds the zone of the nodes the PVCs are scheduled to
+	nodeLister v1.NodeLister
+	// keys of the PVC annotations and labels copied to the volume metadata
+	pvcMetadataAnnotations []string
+	pvcMetadataLabels      []string
 }
 
 type DriverOpts struct {
 	ClusterID    string
 	Endpoint     string
 	WithTopology bool
+	// VolumeModification enables the modification of the volumes with
+	// VolumeAttributesClasses
+	VolumeModification bool
+	// VolumeModificationTimeout is the duration the retype of a volume is
+	// waited for, defaultVolumeModificationTimeout if zero
+	VolumeModificationTimeout time.Duration
 
 	PVCLister v1.PersistentVolumeClaimLister
+	// NodeLister is used to create the volumes in the zone of the node the
+	// PVC is scheduled to, when there is no topology requirement
+	NodeLister v1.NodeLister
+	// PVCMetadataAnnotations and PVCMetadataLabels are the keys of the PVC
+	// annotations and labels copied to the metadata of the created volumes.
+	// A key ending with "*" matches all the keys with the given prefix.
+	PVCMetadataAnnotations []string
+	PVCMetadataLabels      []string
+
+	// AttachLimits limits the concurrent ControllerPublishVolume and
+	// ControllerUnpublishVolume calls
+	AttachLimits AttachLimitOpts
+	// ProvisionLimits limits the CreateVolume and DeleteVolume calls
+	ProvisionLimits ProvisionLimitOpts
+	// ShutdownGracePeriod is the duration the in-flight calls are waited for
+	// on SIGTERM before they are canceled
+	ShutdownGracePeriod time.Duration
 }
 
 func NewDriver(o *DriverOpts) *Driver {
@@ -96,6 +155,20 @@ func NewDriver(o *DriverOpts) *Driver {
 		clusterID:    o.ClusterID,
 		withTopology: o.WithTopology,
 		pvcLister:    o.PVCLister,
+		nodeLister:   o.NodeLister,
+
+		shutdownGracePeriod:       o.ShutdownGracePeriod,
+		volumeModificationTimeout: o.VolumeModificationTimeout,
+
+		pvcMetadataAnnotations: o.PVCMetadataAnnotations,
+		pvcMetadataLabels:      o.PVCMetadataLabels,
+
+		attachLimiter:    newAttachLimiter(o.AttachLimits),
+		provisionLimiter: newProvisionLimiter(o.ProvisionLimits),
+	}
+
+	if d.volumeModificationTimeout <= 0 {
+		d.volumeModificationTimeout = defaultVolumeModificationTimeout
 	}
 
 	klog.Info("Driver: ", d.name)
@@ -103,21 +176,27 @@ func NewDriver(o *DriverOpts) *Driver {
 	klog.Info("CSI Spec version: ", specVersion)
 	klog.Infof("Topology awareness: %t", d.withTopology)
 
-	d.AddControllerServiceCapabilities(
-		[]csi.ControllerServiceCapability_RPC_Type{
-			csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
-			csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
-			csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME,
-			csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
-			csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
-			csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
-			csi.ControllerServiceCapability_RPC_CLONE_VOLUME,
-			csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES,
-			csi.ControllerServiceCapability_RPC_GET_VOLUME,
-		})
+	cscaps := []csi.ControllerServiceCapability_RPC_Type{
+		csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
+		csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
+		csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME,
+		csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
+		csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
+		csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
+		csi.ControllerServiceCapability_RPC_CLONE_VOLUME,
+		csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES,
+		csi.ControllerServiceCapability_RPC_GET_VOLUME,
+		csi.ControllerServiceCapability_RPC_GET_CAPACITY,
+		csi.ControllerServiceCapability_RPC_VOLUME_CONDITION,
+	}
+	if o.VolumeModification {
+		cscaps = append(cscaps, csi.ControllerServiceCapability_RPC_MODIFY_VOLUME)
+	}
+	d.AddControllerServiceCapabilities(cscaps)
 	d.AddVolumeCapabilityAccessModes(
 		[]csi.VolumeCapability_AccessMode_Mode{
 			csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
 		})
 
 	// ignoring error, because AddNodeServiceCapabilities is public
@@ -127,6 +206,7 @@ func NewDriver(o *DriverOpts) *Driver {
 			csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
 			csi.NodeServiceCapability_RPC_EXPAND_VOLUME,
 			csi.NodeServiceCapability_RPC_GET_VOLUME_STATS,
+			csi.NodeServiceCapability_RPC_VOLUME_CONDITION,
 		})
 
 	d.ids = NewIdentityServer(d)
@@ -199,10 +279,125 @@ func (d *Driver) SetupNodeService(mount mount.IMount, metadata metadata.IMetadat
 	d.ns = NewNodeServer(d, mount, metadata, opts, topologies)
 }
 
+// SetupNodeEphemeralVolumes enables the CSI ephemeral inline volumes, which
+// are created and attached by the node service using the given cloud.
+func (d *Driver) SetupNodeEphemeralVolumes(cloud openstack.IOpenStack) {
+	klog.Info("Providing CSI ephemeral inline volumes")
+	d.ns.Cloud = cloud
+}
+
+// SetupNodeKeyManager enables the LUKS keys held by the key manager of the
+// given cloud.
+func (d *Driver) SetupNodeKeyManager(cloud openstack.IOpenStack) {
+	klog.Info("Providing LUKS keys from the key manager")
+	d.ns.KeyManager = cloud
+}
+
+// SetupOrphanCleanup enables the collection of the orphaned volumes and
+// attachments of the clouds of the controller service.
+func (d *Driver) SetupOrphanCleanup(kube kubernetes.Interface, opts OrphanCleanupOpts) {
+	klog.Info("Providing orphaned volumes cleanup")
+	d.gc = &orphanCollector{driver: d, kube: kube, opts: opts}
+}
+
+// SetupStuckAttachmentReconciler enables the reconciliation of the
+// VolumeAttachments stuck attaching or detaching.
+func (d *Driver) SetupStuckAttachmentReconciler(kube kubernetes.Interface, opts StuckAttachmentOpts) {
+	klog.Info("Providing stuck attachments reconciliation")
+	d.attachments = &attachmentReconciler{driver: d, kube: kube, opts: opts}
+}
+
+// SetupBackendLabels enables the labeling of the PVs with the backend host
+// and pool of their volume.
+func (d *Driver) SetupBackendLabels(kube kubernetes.Interface, opts BackendLabelOpts) {
+	klog.Info("Providing PV backend labels")
+	d.backendLabels = &backendLabeler{driver: d, kube: kube, opts: opts}
+}
+
+// SetupEvents enables the Kubernetes events reporting the volume errors, which
+// can't be fixed by retrying, on the PVCs and the pods of the volumes, and the
+// progress of the snapshots on their VolumeSnapshots.
+func (d *Driver) SetupEvents(kube kubernetes.Interface, kubeMetadata kubemetadata.Interface) {
+	klog.Info("Providing volume events")
+	d.events = newEventReporter(kube, kubeMetadata)
+}
+
+// SetupLeaderElection enables the leader election of the replicas of the
+// controller service, so that the background tasks run on a single replica.
+func (d *Driver) SetupLeaderElection(kube kubernetes.Interface, opts LeaderElectionOpts) {
+	klog.Info("Providing leader election of the controller service replicas")
+	d.leader = &leaderElector{kube: kube, opts: opts}
+}
+
 func (d *Driver) Run() {
 	if nil == d.cs && nil == d.ns {
 		klog.Fatal("No CSI services initialized")
 	}
 
-	RunServicesInitialized(d.endpoint, d.ids, d.cs, d.ns)
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if d.cs != nil {
+		if d.leader != nil {
+			go d.leader.run(ctx, d.name, d.runBackgroundTasks)
+		} else {
+			go d.runBackgroundTasks(ctx)
+		}
+	}
+
+	s := NewNonBlockingGRPCServer()
+	s.Start(d.endpoint, d.ids, d.cs, d.ns)
+	go func() {
+		<-ctx.Done()
+		klog.Infof("Shutting down, waiting up to %s for the in-flight calls", d.shutdownGracePeriod)
+		stopServer(s, d.shutdownGracePeriod)
+	}()
+	s.Wait()
+}
+
+// runBackgroundTasks runs the background tasks of the controller service
+// until the context is done.
+func (d *Driver) runBackgroundTasks(ctx context.Context) {
+	var wg sync.WaitGroup
+	if d.gc != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.gc.run(ctx)
+		}()
+	}
+	if d.attachments != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.attachments.run(ctx)
+		}()
+	}
+	if d.backendLabels != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.backendLabels.run(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// stopServer stops the server gracefully, so that the in-flight calls, e.g.
+// waiting for a snapshot or a backup, complete and the sidecars of another
+// replica take over the next ones. The calls still running after the grace
+// period are canceled, and retried by the sidecars of the new leaders.
+func stopServer(s NonBlockingGRPCServer, gracePeriod time.Duration) {
+	stopped := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(gracePeriod):
+		klog.Warningf("In-flight calls are still running after %s, canceling them", gracePeriod)
+		s.ForceStop()
+	}
 }
@@ -0,0 +1,174 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"context"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/snapshots"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+
+	sharedcsi "k8s.io/cloud-provider-openstack/pkg/csi"
+)
+
+const (
+	// eventReasonCrossAZAttach is the reason of the events of the volumes
+	// which can't be attached to a node of another availability zone
+	eventReasonCrossAZAttach = "VolumeZoneMismatch"
+	// eventReasonSnapshotProgress is the reason of the events reporting the
+	// progress of the snapshots being created
+	eventReasonSnapshotProgress = "SnapshotInProgress"
+	// eventReasonSnapshotFailed is the reason of the events of the snapshots
+	// which failed to be created
+	eventReasonSnapshotFailed = "SnapshotFailed"
+)
+
+var volumeSnapshotResource = schema.GroupVersionResource{Group: "snapshot.storage.k8s.io", Version: "v1", Resource: "volumesnapshots"}
+
+// eventReporter reports the volume errors, which can't be fixed by retrying,
+// as events on the PVCs of the volumes and on the pods using them, and the
+// progress of the snapshots as events on their VolumeSnapshots.
+type eventReporter struct {
+	kube     kubernetes.Interface
+	metadata metadata.Interface
+	pvLister corelisters.PersistentVolumeLister
+	recorder record.EventRecorder
+}
+
+func newEventReporter(kube kubernetes.Interface, metadata metadata.Interface) *eventReporter {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartLogging(klog.V(4).Infof)
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{
+		Interface: kube.CoreV1().Events(""),
+	})
+
+	// the PVs are looked up in the informer cache, so that the errors of
+	// the attachments don't list all the PVs of the cluster
+	factory := informers.NewSharedInformerFactory(kube, 0)
+	ctx := context.TODO()
+	pvInformer := factory.Core().V1().PersistentVolumes().Informer()
+	go pvInformer.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), pvInformer.HasSynced) {
+		klog.Fatal("Error syncing PV informer cache")
+	}
+
+	return &eventReporter{
+		kube:     kube,
+		metadata: metadata,
+		pvLister: factory.Core().V1().PersistentVolumes().Lister(),
+		recorder: broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: driverName}),
+	}
+}
+
+// volumeWarning emits a warning event on the PVC bound to the PV of the
+// volume, and on the pods of the PVC which are not running yet.
+func (r *eventReporter) volumeWarning(ctx context.Context, volumeID, reason, message string) {
+	pvc, err := r.getVolumePVC(ctx, volumeID)
+	if err != nil {
+		klog.Warningf("Failed to get the PVC of volume %s: %v", volumeID, err)
+		return
+	}
+	if pvc == nil {
+		klog.V(4).Infof("Volume %s has no PVC to report %s to", volumeID, reason)
+		return
+	}
+	r.recorder.Event(pvc, corev1.EventTypeWarning, reason, message)
+
+	pods, err := r.kube.CoreV1().Pods(pvc.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("status.phase", string(corev1.PodPending)).String(),
+	})
+	if err != nil {
+		klog.Warningf("Failed to list the pods of PVC %s/%s: %v", pvc.Namespace, pvc.Name, err)
+		return
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase == corev1.PodPending && usesPVC(pod, pvc.Name) {
+			r.recorder.Event(pod, corev1.EventTypeWarning, reason, message)
+		}
+	}
+}
+
+// getVolumePVC returns the PVC bound to the PV of the volume, or nil if the
+// volume has no bound PV.
+func (r *eventReporter) getVolumePVC(ctx context.Context, volumeID string) (*corev1.PersistentVolumeClaim, error) {
+	pvs, err := r.pvLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pv := range pvs {
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != driverName || pv.Spec.CSI.VolumeHandle != volumeID {
+			continue
+		}
+		ref := pv.Spec.ClaimRef
+		if ref == nil {
+			return nil, nil
+		}
+		return r.kube.CoreV1().PersistentVolumeClaims(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	}
+	return nil, nil
+}
+
+// snapshotEvent emits an event on the VolumeSnapshot of the snapshot, which
+// csi-snapshotter run with --extra-create-metadata gives in the parameters
+// stored in the snapshot metadata.
+func (r *eventReporter) snapshotEvent(ctx context.Context, snap *snapshots.Snapshot, eventType, reason, message string) {
+	name, namespace := snap.Metadata[sharedcsi.VolSnapshotNameKey], snap.Metadata[sharedcsi.VolSnapshotNamespaceKey]
+	if name == "" || namespace == "" {
+		klog.V(4).Infof("Snapshot %s has no VolumeSnapshot to report %s to", snap.ID, reason)
+		return
+	}
+
+	// the UID is required for the event to be listed with the VolumeSnapshot
+	vs, err := r.metadata.Resource(volumeSnapshotResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		klog.Warningf("Failed to get VolumeSnapshot %s/%s of snapshot %s: %v", namespace, name, snap.ID, err)
+		return
+	}
+	ref := &corev1.ObjectReference{
+		APIVersion:      volumeSnapshotResource.GroupVersion().String(),
+		Kind:            "VolumeSnapshot",
+		Namespace:       namespace,
+		Name:            name,
+		UID:             vs.UID,
+		ResourceVersion: vs.ResourceVersion,
+	}
+	r.recorder.Event(ref, eventType, reason, message)
+}
+
+func usesPVC(pod *corev1.Pod, claimName string) bool {
+	for _, v := range pod.Spec.Volumes {
+		if v.PersistentVolumeClaim != nil && v.PersistentVolumeClaim.ClaimName == claimName {
+			return true
+		}
+	}
+	return false
+}
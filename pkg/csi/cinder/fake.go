@@ -107,6 +107,8 @@ var FakeVolListEmpty = []volumes.Volume{}
 var FakeSnapshotListEmpty = []snapshots.Snapshot{}
 var FakeBackupListEmpty = []backups.Backup{}
 
+var FakeBackupID = "eb5e4e9a-a4e5-4728-a748-04f9e2868573"
+
 var FakeInstanceID = "321a8b81-3660-43e5-bab8-6470b65ee4e8"
 
 const FakeMaxVolume int64 = 256
@@ -0,0 +1,191 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"k8s.io/cloud-provider-openstack/pkg/util/mount"
+)
+
+// The StorageClass parameters of the file system the node service formats
+// and mounts the volumes with. They are passed to the node service in the
+// volume context.
+const (
+	// defaultFsTypeKey is the file system of the volumes whose capability
+	// gives none
+	defaultFsTypeKey = "default-fs-type"
+	// mkfsOptionsKey are the options mkfs formats the volumes with, separated
+	// by spaces
+	mkfsOptionsKey = "mkfs-options"
+	// mountOptionsKey are the options the volumes are mounted with, separated
+	// by commas, in addition to the mountOptions of the StorageClass
+	mountOptionsKey = "mount-options"
+)
+
+// fsAllowList is the allow-list of the options of a file system, which
+// excludes the options giving paths or destroying data. The value is true if
+// the option takes a value.
+type fsAllowList struct {
+	mkfs  map[string]bool
+	mount map[string]bool
+}
+
+var extAllowList = fsAllowList{
+	mkfs: map[string]bool{
+		"-b": true, "-E": true, "-i": true, "-I": true, "-m": true, "-N": true, "-O": true, "-T": true,
+	},
+	mount: map[string]bool{
+		"noatime": false, "nodiratime": false, "relatime": false, "strictatime": false, "lazytime": false,
+		"discard": false, "nodiscard": false, "nobarrier": false, "barrier": true, "commit": true,
+		"data": true, "errors": true, "journal_checksum": false, "dioread_nolock": false,
+		"delalloc": false, "nodelalloc": false, "auto_da_alloc": false, "noauto_da_alloc": false,
+		"init_itable": true, "noinit_itable": false, "stripe": true,
+	},
+}
+
+// fsAllowLists are the allow-lists of the file systems which support options
+var fsAllowLists = map[string]fsAllowList{
+	"ext2": extAllowList,
+	"ext3": extAllowList,
+	"ext4": extAllowList,
+	"xfs": {
+		mkfs: map[string]bool{
+			"-b": true, "-d": true, "-i": true, "-l": true, "-m": true, "-n": true, "-K": false,
+		},
+		mount: map[string]bool{
+			"noatime": false, "nodiratime": false, "relatime": false, "strictatime": false, "lazytime": false,
+			"discard": false, "nodiscard": false, "inode32": false, "inode64": false,
+			"largeio": false, "nolargeio": false, "allocsize": true, "logbufs": true, "logbsize": true,
+			"noalign": false, "sunit": true, "swidth": true, "swalloc": false, "wsync": false,
+		},
+	},
+}
+
+// fsVolumeContext validates the file system parameters of the StorageClass
+// against the allow-list of the file system of each capability, and returns
+// the volume context passing them to the node service, or nil if there are
+// none.
+func fsVolumeContext(params map[string]string, caps []*csi.VolumeCapability) (map[string]string, error) {
+	defaultFsType := params[defaultFsTypeKey]
+	mkfsOptions, mountOptions := params[mkfsOptionsKey], params[mountOptionsKey]
+	repair, err := getFsRepair(params)
+	if err != nil {
+		return nil, err
+	}
+	if defaultFsType == "" && mkfsOptions == "" && mountOptions == "" && !repair {
+		return nil, nil
+	}
+
+	if defaultFsType != "" {
+		if _, ok := fsAllowLists[defaultFsType]; !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "[CreateVolume] unsupported %s parameter %q", defaultFsTypeKey, defaultFsType)
+		}
+	}
+	for _, c := range caps {
+		if c.GetBlock() != nil {
+			continue
+		}
+		fsType := volumeFsType(c.GetMount().GetFsType(), defaultFsType)
+		if _, _, err := parseFsOptions(fsType, mkfsOptions, mountOptions); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "[CreateVolume] %v", err)
+		}
+		if _, ok := fsAllowLists[fsType]; repair && !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "[CreateVolume] file system %s doesn't support the %s parameter", fsType, fsRepairKey)
+		}
+	}
+
+	volCtx := map[string]string{}
+	for k, v := range map[string]string{defaultFsTypeKey: defaultFsType, mkfsOptionsKey: mkfsOptions, mountOptionsKey: mountOptions} {
+		if v != "" {
+			volCtx[k] = v
+		}
+	}
+	if repair {
+		volCtx[fsRepairKey] = "true"
+	}
+	return volCtx, nil
+}
+
+// volumeFsType returns the file system of the capability, the default file
+// system of the StorageClass otherwise, or the default file system of the OS.
+func volumeFsType(fsType, defaultFsType string) string {
+	if fsType != "" {
+		return fsType
+	}
+	if defaultFsType != "" {
+		return defaultFsType
+	}
+	return mount.DefaultFsType
+}
+
+// parseFsOptions splits the mkfs and the mount options and checks them
+// against the allow-list of the file system.
+func parseFsOptions(fsType, mkfsOptions, mountOptions string) ([]string, []string, error) {
+	if mkfsOptions == "" && mountOptions == "" {
+		return nil, nil, nil
+	}
+	allowList, ok := fsAllowLists[fsType]
+	if !ok {
+		return nil, nil, fmt.Errorf("file system %s doesn't support the %s and %s parameters", fsType, mkfsOptionsKey, mountOptionsKey)
+	}
+
+	mkfsArgs := strings.Fields(mkfsOptions)
+	for i := 0; i < len(mkfsArgs); i++ {
+		arg := mkfsArgs[i]
+		hasValue, ok := allowList.mkfs[arg]
+		if !ok {
+			return nil, nil, fmt.Errorf("mkfs option %q is not allowed for file system %s", arg, fsType)
+		}
+		if !hasValue {
+			continue
+		}
+		i++
+		if i == len(mkfsArgs) || !validOptionValue(mkfsArgs[i]) {
+			return nil, nil, fmt.Errorf("mkfs option %s requires a valid value", arg)
+		}
+	}
+
+	var mountArgs []string
+	for _, opt := range strings.Split(mountOptions, ",") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+		name, value, hasValue := strings.Cut(opt, "=")
+		takesValue, ok := allowList.mount[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("mount option %q is not allowed for file system %s", name, fsType)
+		}
+		if hasValue != takesValue || (hasValue && !validOptionValue(value)) {
+			return nil, nil, fmt.Errorf("mount option %q is invalid for file system %s", opt, fsType)
+		}
+		mountArgs = append(mountArgs, opt)
+	}
+	return mkfsArgs, mountArgs, nil
+}
+
+// validOptionValue refuses the values which could be taken by mkfs as another
+// option or as a path, e.g. of another device.
+func validOptionValue(v string) bool {
+	return v != "" && !strings.HasPrefix(v, "-") && !strings.Contains(v, "/")
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	mountutil "k8s.io/mount-utils"
+)
+
+func TestFsVolumeContext(t *testing.T) {
+	mountCap := func(fsType string) *csi.VolumeCapability {
+		return &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{FsType: fsType}},
+		}
+	}
+	blockCap := &csi.VolumeCapability{AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}}}
+
+	tests := []struct {
+		name     string
+		params   map[string]string
+		caps     []*csi.VolumeCapability
+		expected map[string]string
+		code     codes.Code
+	}{
+		{
+			name:   "no options",
+			params: map[string]string{"type": "fast"},
+			caps:   []*csi.VolumeCapability{mountCap("")},
+		},
+		{
+			name:   "ext4 of the OS",
+			params: map[string]string{mkfsOptionsKey: "-E lazy_itable_init=0,lazy_journal_init=0", mountOptionsKey: "noatime,commit=30"},
+			caps:   []*csi.VolumeCapability{mountCap("")},
+			expected: map[string]string{
+				mkfsOptionsKey:  "-E lazy_itable_init=0,lazy_journal_init=0",
+				mountOptionsKey: "noatime,commit=30",
+			},
+		},
+		{
+			name:     "default xfs",
+			params:   map[string]string{defaultFsTypeKey: "xfs", mkfsOptionsKey: "-m reflink=1 -K"},
+			caps:     []*csi.VolumeCapability{mountCap(""), blockCap},
+			expected: map[string]string{defaultFsTypeKey: "xfs", mkfsOptionsKey: "-m reflink=1 -K"},
+		},
+		{
+			name:   "options of another file system",
+			params: map[string]string{defaultFsTypeKey: "xfs", mkfsOptionsKey: "-d su=64k,sw=4"},
+			caps:   []*csi.VolumeCapability{mountCap("ext4")},
+			code:   codes.InvalidArgument,
+		},
+		{
+			name:   "unsupported default file system",
+			params: map[string]string{defaultFsTypeKey: "btrfs"},
+			caps:   []*csi.VolumeCapability{mountCap("")},
+			code:   codes.InvalidArgument,
+		},
+		{
+			name:   "mkfs option not allowed",
+			params: map[string]string{mkfsOptionsKey: "-F"},
+			caps:   []*csi.VolumeCapability{mountCap("ext4")},
+			code:   codes.InvalidArgument,
+		},
+		{
+			name:   "mkfs option without value",
+			params: map[string]string{mkfsOptionsKey: "-E"},
+			caps:   []*csi.VolumeCapability{mountCap("ext4")},
+			code:   codes.InvalidArgument,
+		},
+		{
+			name:   "mkfs option giving a device",
+			params: map[string]string{mkfsOptionsKey: "-l logdev=/dev/vdb"},
+			caps:   []*csi.VolumeCapability{mountCap("xfs")},
+			code:   codes.InvalidArgument,
+		},
+		{
+			name:   "mount option not allowed",
+			params: map[string]string{mountOptionsKey: "noatime,dax"},
+			caps:   []*csi.VolumeCapability{mountCap("xfs")},
+			code:   codes.InvalidArgument,
+		},
+		{
+			name:   "mount option without value",
+			params: map[string]string{mountOptionsKey: "commit"},
+			caps:   []*csi.VolumeCapability{mountCap("ext4")},
+			code:   codes.InvalidArgument,
+		},
+		{
+			name:     "repair",
+			params:   map[string]string{fsRepairKey: "true"},
+			caps:     []*csi.VolumeCapability{mountCap("xfs"), blockCap},
+			expected: map[string]string{fsRepairKey: "true"},
+		},
+		{
+			name:   "repair disabled",
+			params: map[string]string{fsRepairKey: "false"},
+			caps:   []*csi.VolumeCapability{mountCap("xfs")},
+		},
+		{
+			name:   "invalid repair",
+			params: map[string]string{fsRepairKey: "always"},
+			caps:   []*csi.VolumeCapability{mountCap("ext4")},
+			code:   codes.InvalidArgument,
+		},
+		{
+			name:   "repair of another file system",
+			params: map[string]string{fsRepairKey: "true"},
+			caps:   []*csi.VolumeCapability{mountCap("btrfs")},
+			code:   codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			volCtx, err := fsVolumeContext(tt.params, tt.caps)
+			assert.Equal(t, tt.code, status.Code(err))
+			assert.Equal(t, tt.expected, volCtx)
+		})
+	}
+}
+
+func TestParseFsOptions(t *testing.T) {
+	mkfsArgs, mountArgs, err := parseFsOptions("ext4", " -E  lazy_itable_init=0 -m 1 ", "noatime, data=ordered")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-E", "lazy_itable_init=0", "-m", "1"}, mkfsArgs)
+	assert.Equal(t, []string{"noatime", "data=ordered"}, mountArgs)
+
+	mkfsArgs, mountArgs, err = parseFsOptions("btrfs", "", "")
+	assert.NoError(t, err)
+	assert.Nil(t, mkfsArgs)
+	assert.Nil(t, mountArgs)
+}
+
+func TestIsRepairableMountError(t *testing.T) {
+	assert.True(t, isRepairableMountError(mountutil.NewMountError(mountutil.HasFilesystemErrors, "'fsck' found errors on device /dev/vdb")))
+	assert.True(t, isRepairableMountError(fmt.Errorf("retry: %w", mountutil.NewMountError(mountutil.UnknownMountError, "mount failed: exit status 32"))))
+	assert.False(t, isRepairableMountError(mountutil.NewMountError(mountutil.FilesystemMismatch, "mount failed: wrong fs type")))
+	assert.False(t, isRepairableMountError(mountutil.NewMountError(mountutil.FormatFailed, "mkfs failed")))
+	assert.False(t, isRepairableMountError(errors.New("device not found")))
+}
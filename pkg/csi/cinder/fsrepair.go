@@ -0,0 +1,123 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+	mountutil "k8s.io/mount-utils"
+	utilexec "k8s.io/utils/exec"
+
+	"k8s.io/cloud-provider-openstack/pkg/util/mount"
+)
+
+const (
+	// fsRepairKey is the StorageClass parameter which enables the repair of
+	// the file system of the volumes which can't be mounted, e.g. after an
+	// unclean shutdown of their node
+	fsRepairKey = "fs-repair"
+
+	defaultFsRepairTimeout = 10 * time.Minute
+
+	// e2fsck exit codes below this one mean the file system is clean or
+	// its errors were corrected
+	e2fsckErrorsUncorrected = 4
+)
+
+// getFsRepair validates the fs-repair parameter and returns it.
+func getFsRepair(params map[string]string) (bool, error) {
+	v, ok := params[fsRepairKey]
+	if !ok {
+		return false, nil
+	}
+	repair, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, status.Errorf(codes.InvalidArgument, "[CreateVolume] invalid %s parameter %q, must be true or false", fsRepairKey, v)
+	}
+	return repair, nil
+}
+
+// isRepairableMountError returns true if the mount error can be caused by
+// the errors of the existing file system of the device, which fsck can fix.
+// The format errors and the mismatching file systems are not repaired.
+func isRepairableMountError(err error) bool {
+	var mountErr mountutil.MountError
+	if !errors.As(err, &mountErr) {
+		return false
+	}
+	switch mountErr.Type {
+	case mountutil.HasFilesystemErrors, mountutil.UnknownMountError:
+		return true
+	default:
+		return false
+	}
+}
+
+// repairFilesystem repairs the file system of the device, within the
+// node-fs-repair-timeout. The repairs which could lose the data of the
+// volume, e.g. zeroing the log of an XFS file system, are not attempted.
+func (ns *nodeServer) repairFilesystem(devicePath, fsType string) error {
+	existing, err := mount.GetDiskFormat(ns.Mount.Mounter(), devicePath)
+	if err != nil {
+		return fmt.Errorf("failed to get the file system of device %s: %v", devicePath, err)
+	}
+	if existing != fsType {
+		return fmt.Errorf("device %s has file system %q instead of %s, not repairing it", devicePath, existing, fsType)
+	}
+
+	var cmd string
+	var args []string
+	switch fsType {
+	case "ext2", "ext3", "ext4":
+		cmd, args = "e2fsck", []string{"-f", "-y", devicePath}
+	case "xfs":
+		cmd, args = "xfs_repair", []string{devicePath}
+	default:
+		return fmt.Errorf("repairing file system %s is not supported", fsType)
+	}
+
+	timeout := ns.Opts.NodeFsRepairTimeout.Duration
+	if timeout <= 0 {
+		timeout = defaultFsRepairTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	klog.Warningf("Repairing the %s file system of device %s with %s", fsType, devicePath, cmd)
+	out, err := ns.Mount.Mounter().Exec.CommandContext(ctx, cmd, args...).CombinedOutput()
+	if err != nil {
+		var exitErr utilexec.ExitError
+		if cmd == "e2fsck" && errors.As(err, &exitErr) && exitErr.ExitStatus() < e2fsckErrorsUncorrected {
+			klog.Infof("Errors of the file system of device %s were corrected: %s", devicePath, string(out))
+			return nil
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s of device %s didn't complete within %s", cmd, devicePath, timeout)
+		}
+		return fmt.Errorf("%s of device %s failed: %v, output: %q", cmd, devicePath, err, string(out))
+	}
+
+	klog.Infof("Repaired the file system of device %s", devicePath)
+	return nil
+}
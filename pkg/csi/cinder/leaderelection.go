@@ -0,0 +1,142 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// serviceAccountNamespaceFile gives the namespace of the pod, which holds
+	// the lease unless another namespace is given
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+	// defaultLeaderElectionNamespace holds the lease outside of a pod
+	defaultLeaderElectionNamespace = "kube-system"
+)
+
+// LeaderElectionOpts configures the leader election of the replicas of the
+// controller service. The CSI calls are served by every replica, as the
+// sidecars elect their own leader for each operation, while the background
+// tasks, i.e. the orphan cleanup and the stuck attachments reconciliation,
+// only run on the leader.
+type LeaderElectionOpts struct {
+	// Enabled enables the leader election, otherwise the background tasks
+	// run on every replica
+	Enabled bool
+	// Namespace of the lease, the namespace of the pod by default
+	Namespace string
+	// LeaseDuration is the duration the other replicas wait for before
+	// taking over the lease of a leader which stopped renewing it
+	LeaseDuration time.Duration
+	// RenewDeadline is the duration the leader retries renewing the lease
+	// for before giving up the leadership
+	RenewDeadline time.Duration
+	// RetryPeriod is the interval the replicas try to acquire or renew the
+	// lease at
+	RetryPeriod time.Duration
+}
+
+// leaderElector runs the background tasks of the controller service while the
+// replica holds the lease.
+type leaderElector struct {
+	kube kubernetes.Interface
+	opts LeaderElectionOpts
+}
+
+// leaseName returns the name of the lease of the driver, e.g.
+// cinder-csi-openstack-org-controller.
+func leaseName(driverName string) string {
+	return strings.ReplaceAll(driverName, ".", "-") + "-controller"
+}
+
+// leaseNamespace returns the namespace of the lease, which defaults to the
+// namespace of the pod.
+func leaseNamespace(namespace, namespaceFile string) string {
+	if namespace != "" {
+		return namespace
+	}
+	if data, err := os.ReadFile(namespaceFile); err == nil {
+		if ns := strings.TrimSpace(string(data)); ns != "" {
+			return ns
+		}
+	}
+	return defaultLeaderElectionNamespace
+}
+
+// run runs the tasks each time the replica becomes the leader, until the
+// context is done. The tasks are given a context which is canceled when the
+// leadership is lost, and the replica then competes for the lease again, so
+// that it can take over when the new leader stops.
+func (e *leaderElector) run(ctx context.Context, name string, tasks func(context.Context)) {
+	id, err := os.Hostname()
+	if err != nil {
+		klog.Fatalf("Failed to get the hostname for the leader election: %v", err)
+	}
+	// add a uniquifier so that two processes on the same host don't accidentally both become active
+	id = id + "_" + string(uuid.NewUUID())
+
+	namespace := leaseNamespace(e.opts.Namespace, serviceAccountNamespaceFile)
+	lock, err := resourcelock.New(
+		resourcelock.LeasesResourceLock,
+		namespace,
+		leaseName(name),
+		e.kube.CoreV1(),
+		e.kube.CoordinationV1(),
+		resourcelock.ResourceLockConfig{Identity: id},
+	)
+	if err != nil {
+		klog.Fatalf("Failed to create the leader election lock: %v", err)
+	}
+
+	klog.Infof("Running the background tasks of the controller service on the leader of lease %s/%s, identity: %s", namespace, leaseName(name), id)
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:          lock,
+			LeaseDuration: e.opts.LeaseDuration,
+			RenewDeadline: e.opts.RenewDeadline,
+			RetryPeriod:   e.opts.RetryPeriod,
+			// the lease is released on shutdown, so that another replica
+			// takes over without waiting for the lease to expire
+			ReleaseOnCancel: true,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					klog.Info("Became the leader, starting the background tasks")
+					tasks(ctx)
+				},
+				OnStoppedLeading: func() {
+					klog.Info("Stopped leading, stopping the background tasks")
+				},
+				OnNewLeader: func(identity string) {
+					if identity != id {
+						klog.Infof("The background tasks run on the new leader %s", identity)
+					}
+				},
+			},
+			Name: name,
+		})
+	}, e.opts.RetryPeriod)
+}
@@ -0,0 +1,42 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeaseName(t *testing.T) {
+	assert.Equal(t, "cinder-csi-openstack-org-controller", leaseName(driverName))
+}
+
+func TestLeaseNamespace(t *testing.T) {
+	namespaceFile := filepath.Join(t.TempDir(), "namespace")
+
+	assert.Equal(t, "csi", leaseNamespace("csi", namespaceFile))
+	assert.Equal(t, defaultLeaderElectionNamespace, leaseNamespace("", namespaceFile))
+
+	if err := os.WriteFile(namespaceFile, []byte("openstack\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "openstack", leaseNamespace("", namespaceFile))
+	assert.Equal(t, "csi", leaseNamespace("csi", namespaceFile))
+}
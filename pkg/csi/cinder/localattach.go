@@ -0,0 +1,333 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+
+	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
+	"k8s.io/cloud-provider-openstack/pkg/util/blockdevice"
+	cpoerrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
+)
+
+// The volumes of the backends listed in the local-attach-volume-types option,
+// which share the hosts of the nodes, e.g. hyperconverged LVM or Ceph, are
+// attached by the controller service with the Cinder attachments API, using a
+// connector with the host name of the node. When the connection info has a
+// local connector, the node service connects the device of the volume itself,
+// without Nova. Otherwise the attachment is deleted and the volume is attached
+// by Nova.
+const (
+	// localConnectorKey is the publish context of the local connector of the
+	// volume, i.e. the driver_volume_type of its connection info
+	localConnectorKey = "localConnector"
+
+	localDevicePathKey = "localDevicePath"
+
+	rbdPoolKey     = "rbdPool"
+	rbdImageKey    = "rbdImage"
+	rbdUserKey     = "rbdUser"
+	rbdMonitorsKey = "rbdMonitors"
+
+	// rbdImagePrefix prefixes the volume ID for the name of its RBD image,
+	// as the default volume_name_template of Cinder. It is only assumed for
+	// the volumes staged without a saved local connection.
+	rbdImagePrefix = "volume-"
+
+	// localConnectionFile is the file holding the publish context of the
+	// local connector of a staged volume, next to its staging target path, so
+	// that the device is found when unstaging the volume
+	localConnectionFile = "cinder-local-connection.json"
+)
+
+// localConnector connects the nodes to the devices of the volumes of a
+// driver_volume_type locally, without Nova. The controller service gives the
+// publish context of the connection info of the volumes to the node service,
+// which connects to the devices with it.
+type localConnector interface {
+	// publishContext returns the publish context of the connection info data
+	publishContext(volumeID string, data map[string]any) (map[string]string, error)
+	// connect connects the node to the device of the volume, and returns its
+	// device path
+	connect(volumeID string, publishContext map[string]string) (string, error)
+	// disconnect disconnects the node from the device of the unstaged volume,
+	// if it is connected. The publish context is the one the volume was
+	// connected with, or nil if it wasn't saved.
+	disconnect(volumeID string, publishContext map[string]string) error
+}
+
+// localConnectors are the local connectors by driver_volume_type
+var localConnectors = map[string]localConnector{
+	"local": deviceConnector{},
+	"rbd":   rbdConnector{},
+}
+
+// deviceConnector connects the volumes which are already block devices of the
+// host, e.g. the logical volumes of the LVM backend, which gives the local
+// connection info when the host of the connector is the host of the volume.
+type deviceConnector struct{}
+
+func (deviceConnector) publishContext(volumeID string, data map[string]any) (map[string]string, error) {
+	devicePath, _ := data["device_path"].(string)
+	if devicePath == "" {
+		return nil, fmt.Errorf("local connection info of volume %s has no device path", volumeID)
+	}
+	return map[string]string{localDevicePathKey: devicePath}, nil
+}
+
+func (deviceConnector) connect(volumeID string, publishContext map[string]string) (string, error) {
+	devicePath := publishContext[localDevicePathKey]
+	fi, err := os.Stat(devicePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to find device %s of volume %s on the node: %v", devicePath, volumeID, err)
+	}
+	if fi.Mode()&os.ModeDevice == 0 {
+		return "", fmt.Errorf("%s of volume %s is not a device", devicePath, volumeID)
+	}
+	return devicePath, nil
+}
+
+func (deviceConnector) disconnect(string, map[string]string) error {
+	// the device belongs to the backend
+	return nil
+}
+
+// rbdConnector maps the RBD images of the Ceph backend with krbd, using the
+// Ceph configuration and keyring of the node.
+type rbdConnector struct{}
+
+func (rbdConnector) publishContext(volumeID string, data map[string]any) (map[string]string, error) {
+	// e.g. volumes/volume-<volume ID>
+	name, _ := data["name"].(string)
+	pool, image, ok := strings.Cut(name, "/")
+	if !ok || pool == "" || image == "" {
+		return nil, fmt.Errorf("rbd connection info of volume %s has an invalid image name %q", volumeID, name)
+	}
+
+	hosts, _ := data["hosts"].([]any)
+	ports, _ := data["ports"].([]any)
+	var monitors []string
+	for i, h := range hosts {
+		if i < len(ports) {
+			monitors = append(monitors, net.JoinHostPort(fmt.Sprint(h), fmt.Sprint(ports[i])))
+		}
+	}
+
+	publishContext := map[string]string{
+		rbdPoolKey:  pool,
+		rbdImageKey: image,
+	}
+	if user, _ := data["auth_username"].(string); user != "" {
+		publishContext[rbdUserKey] = user
+	}
+	if len(monitors) > 0 {
+		publishContext[rbdMonitorsKey] = strings.Join(monitors, ",")
+	}
+	return publishContext, nil
+}
+
+func (rbdConnector) connect(_ string, publishContext map[string]string) (string, error) {
+	var monitors []string
+	if m := publishContext[rbdMonitorsKey]; m != "" {
+		monitors = strings.Split(m, ",")
+	}
+	return blockdevice.MapRBD(publishContext[rbdPoolKey], publishContext[rbdImageKey], publishContext[rbdUserKey], monitors)
+}
+
+func (rbdConnector) disconnect(volumeID string, publishContext map[string]string) error {
+	pool, image := publishContext[rbdPoolKey], publishContext[rbdImageKey]
+	if image == "" {
+		pool, image = "", rbdImagePrefix+volumeID
+	}
+	devicePath, err := blockdevice.FindRBDDevice(pool, image)
+	if err != nil {
+		klog.V(4).Infof("Failed to find the RBD device of volume %s: %v", volumeID, err)
+		return nil
+	}
+	if devicePath == "" {
+		return nil
+	}
+	return blockdevice.UnmapRBD(devicePath)
+}
+
+// isLocalAttachVolume returns true if the volume can be connected locally by
+// the nodes instead of being attached by Nova.
+func isLocalAttachVolume(bsOpts openstack.BlockStorageOpts, vol *volumes.Volume) bool {
+	return slices.Contains(bsOpts.LocalAttachVolumeTypes, vol.VolumeType)
+}
+
+// localAttachConnector returns the os-brick connector properties of the
+// server, whose host lets the backends sharing the host of the server give a
+// local connection info.
+func localAttachConnector(server *servers.Server) map[string]any {
+	return map[string]any{
+		"host":      server.Name,
+		"uuid":      server.ID,
+		"multipath": false,
+		"os_type":   "linux",
+	}
+}
+
+// publishLocalVolume attaches the volume to the node with the Cinder
+// attachments API, and returns the publish context of its local connector. It
+// returns nil if the volume can't be connected locally, e.g. because it is on
+// another host than the node, so that it is attached by Nova.
+func (cs *controllerServer) publishLocalVolume(ctx context.Context, cloud openstack.IOpenStack, vol *volumes.Volume, server *servers.Server) (*csi.ControllerPublishVolumeResponse, error) {
+	for _, att := range vol.Attachments {
+		if att.ServerID != server.ID {
+			continue
+		}
+		// the attachments of Nova are Cinder attachments too
+		attached, err := cloud.VolumeAttachedByCompute(ctx, server.ID, vol.ID)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "[ControllerPublishVolume] failed to get the attachment of volume %s to instance %s: %v", vol.ID, server.ID, err)
+		}
+		if attached {
+			return nil, nil
+		}
+	}
+
+	attachment, err := cloud.CreateVolumeAttachment(ctx, vol.ID, server.ID, localAttachConnector(server))
+	if err != nil {
+		klog.Errorf("Failed to CreateVolumeAttachment: %v", err)
+		if errors.Is(err, cpoerrors.ErrMicroversionNotSupported) {
+			return nil, status.Errorf(codes.FailedPrecondition, "[ControllerPublishVolume] Attach Volume failed: %v", err)
+		}
+		return nil, status.Errorf(codes.Internal, "[ControllerPublishVolume] Attach Volume failed with error %v", err)
+	}
+
+	driverVolumeType, _ := attachment.ConnectionInfo["driver_volume_type"].(string)
+	connector, ok := localConnectors[driverVolumeType]
+	if !ok {
+		klog.V(3).Infof("ControllerPublishVolume: volume %s can't be connected locally by %s with %q, attaching it with Nova", vol.ID, server.ID, driverVolumeType)
+		if err := cloud.DeleteVolumeAttachments(ctx, vol.ID, server.ID); err != nil {
+			return nil, status.Errorf(codes.Internal, "[ControllerPublishVolume] failed to delete the attachment of volume %s: %v", vol.ID, err)
+		}
+		return nil, nil
+	}
+
+	data, _ := attachment.ConnectionInfo["data"].(map[string]any)
+	publishContext, err := connector.publishContext(vol.ID, data)
+	if err != nil {
+		if err := cloud.DeleteVolumeAttachments(ctx, vol.ID, server.ID); err != nil {
+			klog.Errorf("Failed to delete the attachment of volume %s: %v", vol.ID, err)
+		}
+		return nil, status.Errorf(codes.FailedPrecondition, "[ControllerPublishVolume] %v", err)
+	}
+	publishContext[localConnectorKey] = driverVolumeType
+
+	klog.V(4).Infof("ControllerPublishVolume %s on %s with local connector %s is successful", vol.ID, server.ID, driverVolumeType)
+
+	return &csi.ControllerPublishVolumeResponse{
+		PublishContext: publishContext,
+	}, nil
+}
+
+// connectLocalVolume connects the node to the device of the volume with its
+// local connector, and returns the device path. The publish context is saved
+// next to the staging target path for disconnectLocalVolume.
+func (ns *nodeServer) connectLocalVolume(volumeID, stagingTarget string, publishContext map[string]string) (string, error) {
+	connector, ok := localConnectors[publishContext[localConnectorKey]]
+	if !ok {
+		return "", fmt.Errorf("unsupported local connector %q of volume %s", publishContext[localConnectorKey], volumeID)
+	}
+	if err := saveLocalConnection(stagingTarget, publishContext); err != nil {
+		return "", fmt.Errorf("failed to save the local connection of volume %s: %v", volumeID, err)
+	}
+	devicePath, err := connector.connect(volumeID, publishContext)
+	if err != nil {
+		return "", err
+	}
+
+	klog.V(4).Infof("Connected device %s of volume %s with local connector %s", devicePath, volumeID, publishContext[localConnectorKey])
+	return devicePath, nil
+}
+
+// disconnectLocalVolume disconnects the node from the device of the unstaged
+// volume, if it was connected by a local connector. The volumes staged
+// without a saved local connection are looked up by every local connector.
+func (ns *nodeServer) disconnectLocalVolume(volumeID, stagingTarget string) error {
+	publishContext, err := loadLocalConnection(stagingTarget)
+	if err != nil {
+		return fmt.Errorf("failed to load the local connection of volume %s: %v", volumeID, err)
+	}
+
+	var errs []error
+	for driverVolumeType, connector := range localConnectors {
+		if publishContext != nil && publishContext[localConnectorKey] != driverVolumeType {
+			continue
+		}
+		if err := connector.disconnect(volumeID, publishContext); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", driverVolumeType, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	if err := os.Remove(localConnectionPath(stagingTarget)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove the local connection of volume %s: %v", volumeID, err)
+	}
+	return nil
+}
+
+// localConnectionPath returns the path of the local connection file of the
+// volume staged at the staging target path.
+func localConnectionPath(stagingTarget string) string {
+	return filepath.Join(filepath.Dir(filepath.Clean(stagingTarget)), localConnectionFile)
+}
+
+func saveLocalConnection(stagingTarget string, publishContext map[string]string) error {
+	data, err := json.Marshal(publishContext)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(localConnectionPath(stagingTarget), data, 0600)
+}
+
+// loadLocalConnection returns the saved publish context of the volume staged
+// at the staging target path, or nil if there is none.
+func loadLocalConnection(stagingTarget string) (map[string]string, error) {
+	data, err := os.ReadFile(localConnectionPath(stagingTarget))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var publishContext map[string]string
+	if err := json.Unmarshal(data, &publishContext); err != nil {
+		return nil, err
+	}
+	return publishContext, nil
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/attachments"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLocalConnectorPublishContext(t *testing.T) {
+	tests := []struct {
+		name     string
+		connType string
+		data     map[string]any
+		expected map[string]string
+	}{
+		{
+			name:     "lvm",
+			connType: "local",
+			data:     map[string]any{"device_path": "/dev/cinder-volumes/volume-" + FakeVolID},
+			expected: map[string]string{localDevicePathKey: "/dev/cinder-volumes/volume-" + FakeVolID},
+		},
+		{
+			name:     "lvm without device",
+			connType: "local",
+			data:     map[string]any{},
+		},
+		{
+			name:     "ceph",
+			connType: "rbd",
+			data: map[string]any{
+				"name":          "volumes/volume-" + FakeVolID,
+				"hosts":         []any{"10.0.0.1", "fd00::1"},
+				"ports":         []any{"6789", 3300.0},
+				"auth_username": "cinder",
+				"secret_uuid":   "457eb676-33da-42ec-9a8c-9293d545c337",
+			},
+			expected: map[string]string{
+				rbdPoolKey:     "volumes",
+				rbdImageKey:    "volume-" + FakeVolID,
+				rbdUserKey:     "cinder",
+				rbdMonitorsKey: "10.0.0.1:6789,[fd00::1]:3300",
+			},
+		},
+		{
+			name:     "ceph without pool",
+			connType: "rbd",
+			data:     map[string]any{"name": "volume-" + FakeVolID},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publishContext, err := localConnectors[tt.connType].publishContext(FakeVolID, tt.data)
+			if tt.expected == nil {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, publishContext)
+		})
+	}
+}
+
+func TestLocalConnection(t *testing.T) {
+	stagingTarget := filepath.Join(t.TempDir(), "globalmount")
+	ns := &nodeServer{}
+
+	// No local connection is saved for the volumes staged by Nova
+	publishContext, err := loadLocalConnection(stagingTarget)
+	assert.NoError(t, err)
+	assert.Nil(t, publishContext)
+
+	saved := map[string]string{localConnectorKey: "rbd", rbdPoolKey: "volumes", rbdImageKey: "volume-custom-" + FakeVolID}
+	assert.NoError(t, saveLocalConnection(stagingTarget, saved))
+	publishContext, err = loadLocalConnection(stagingTarget)
+	assert.NoError(t, err)
+	assert.Equal(t, saved, publishContext)
+
+	// The saved local connection is removed when the volume is disconnected
+	assert.NoError(t, saveLocalConnection(stagingTarget, map[string]string{localConnectorKey: "local", localDevicePathKey: "/dev/sda"}))
+	assert.NoError(t, ns.disconnectLocalVolume(FakeVolID, stagingTarget))
+	_, err = os.Stat(localConnectionPath(stagingTarget))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPublishLocalVolume(t *testing.T) {
+	server := &servers.Server{ID: FakeNodeID, Name: "compute-0"}
+	vol := &volumes.Volume{ID: FakeVolID}
+
+	t.Run("remote", func(t *testing.T) {
+		fakeCs, osmock := fakeControllerServer()
+		osmock.On("CreateVolumeAttachment", FakeVolID, FakeNodeID, localAttachConnector(server)).Return(&attachments.Attachment{
+			ConnectionInfo: map[string]any{"driver_volume_type": "iscsi"},
+		}, nil)
+		osmock.On("DeleteVolumeAttachments", FakeVolID, FakeNodeID).Return(nil)
+
+		// the attachment is deleted so that the volume is attached by Nova
+		resp, err := fakeCs.publishLocalVolume(FakeCtx, osmock, vol, server)
+		assert.NoError(t, err)
+		assert.Nil(t, resp)
+		osmock.AssertCalled(t, "DeleteVolumeAttachments", FakeVolID, FakeNodeID)
+	})
+
+	t.Run("local", func(t *testing.T) {
+		fakeCs, osmock := fakeControllerServer()
+		osmock.On("CreateVolumeAttachment", FakeVolID, FakeNodeID, localAttachConnector(server)).Return(&attachments.Attachment{
+			ConnectionInfo: map[string]any{
+				"driver_volume_type": "local",
+				"data":               map[string]any{"device_path": "/dev/cinder-volumes/volume-" + FakeVolID},
+			},
+		}, nil)
+
+		resp, err := fakeCs.publishLocalVolume(FakeCtx, osmock, vol, server)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			localConnectorKey:  "local",
+			localDevicePathKey: "/dev/cinder-volumes/volume-" + FakeVolID,
+		}, resp.PublishContext)
+	})
+
+	t.Run("attached by nova", func(t *testing.T) {
+		fakeCs, osmock := fakeControllerServer()
+		osmock.On("VolumeAttachedByCompute", FakeNodeID, FakeVolID).Return(true, nil)
+
+		attached := &volumes.Volume{ID: FakeVolID, Attachments: []volumes.Attachment{{ServerID: FakeNodeID}}}
+		resp, err := fakeCs.publishLocalVolume(FakeCtx, osmock, attached, server)
+		assert.NoError(t, err)
+		assert.Nil(t, resp)
+		osmock.AssertNotCalled(t, "CreateVolumeAttachment", FakeVolID, FakeNodeID, localAttachConnector(server))
+	})
+
+	t.Run("invalid connection info", func(t *testing.T) {
+		fakeCs, osmock := fakeControllerServer()
+		osmock.On("CreateVolumeAttachment", FakeVolID, FakeNodeID, localAttachConnector(server)).Return(&attachments.Attachment{
+			ConnectionInfo: map[string]any{"driver_volume_type": "rbd", "data": map[string]any{}},
+		}, nil)
+		osmock.On("DeleteVolumeAttachments", FakeVolID, FakeNodeID).Return(nil)
+
+		_, err := fakeCs.publishLocalVolume(FakeCtx, osmock, vol, server)
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+		osmock.AssertCalled(t, "DeleteVolumeAttachments", FakeVolID, FakeNodeID)
+	})
+}
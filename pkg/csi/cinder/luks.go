@@ -0,0 +1,225 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+	utilexec "k8s.io/utils/exec"
+	utilpath "k8s.io/utils/path"
+)
+
+// The StorageClass parameters of the volumes encrypted with LUKS by the node
+// service, for the Cinder backends which don't support encryption. They are
+// passed to the node service in the volume context.
+const (
+	luksEncryptedKey = "luks-encrypted"
+	luksCipherKey    = "luks-cipher"
+	luksKeySizeKey   = "luks-key-size"
+	// luksKeyIDKey is the ID of the key manager secret holding the passphrase
+	luksKeyIDKey = "luks-key-id"
+
+	// luksSecretKey is the key of the passphrase in the node stage secret
+	luksSecretKey = "luks-key"
+
+	defaultLUKSCipher  = "aes-xts-plain64"
+	defaultLUKSKeySize = 512
+
+	luksMapperDir    = "/dev/mapper"
+	luksMapperPrefix = "luks-"
+)
+
+// luksVolumeContext validates the LUKS parameters of the StorageClass and
+// returns the volume context passing them to the node service, or nil if the
+// volume is not encrypted by the node service.
+func luksVolumeContext(params map[string]string) (map[string]string, error) {
+	encrypted := false
+	if v, ok := params[luksEncryptedKey]; ok {
+		var err error
+		encrypted, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "[CreateVolume] invalid %s parameter: %v", luksEncryptedKey, err)
+		}
+	}
+
+	if !encrypted {
+		for _, k := range []string{luksCipherKey, luksKeySizeKey, luksKeyIDKey} {
+			if _, ok := params[k]; ok {
+				return nil, status.Errorf(codes.InvalidArgument, "[CreateVolume] %s parameter requires the %s parameter to be true", k, luksEncryptedKey)
+			}
+		}
+		return nil, nil
+	}
+
+	volCtx := map[string]string{
+		luksEncryptedKey: "true",
+		luksCipherKey:    defaultLUKSCipher,
+		luksKeySizeKey:   strconv.Itoa(defaultLUKSKeySize),
+	}
+	if v := params[luksCipherKey]; v != "" {
+		volCtx[luksCipherKey] = v
+	}
+	if v, ok := params[luksKeySizeKey]; ok {
+		keySize, err := strconv.Atoi(v)
+		if err != nil || keySize <= 0 || keySize%8 != 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "[CreateVolume] invalid %s parameter %q", luksKeySizeKey, v)
+		}
+		volCtx[luksKeySizeKey] = v
+	}
+	if v := params[luksKeyIDKey]; v != "" {
+		volCtx[luksKeyIDKey] = v
+	}
+	return volCtx, nil
+}
+
+// luksMapperPath returns the path of the device mapping of the decrypted
+// volume.
+func luksMapperPath(volumeID string) string {
+	return filepath.Join(luksMapperDir, luksMapperPrefix+volumeID)
+}
+
+// isLUKSMapping returns true if the device is the mapping of a volume encrypted
+// by the node service.
+func isLUKSMapping(devicePath string) bool {
+	return strings.HasPrefix(devicePath, filepath.Join(luksMapperDir, luksMapperPrefix))
+}
+
+// getLUKSKey returns the passphrase of the volume, from the key manager if the
+// StorageClass gives a key ID, otherwise from the node stage secret.
+func (ns *nodeServer) getLUKSKey(ctx context.Context, volumeContext, secrets map[string]string) ([]byte, error) {
+	if keyID := volumeContext[luksKeyIDKey]; keyID != "" {
+		if ns.KeyManager == nil {
+			return nil, fmt.Errorf("the %s parameter requires the --node-service-barbican-keys argument", luksKeyIDKey)
+		}
+		key, err := ns.KeyManager.GetSecretPayload(ctx, keyID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get key manager secret %s: %v", keyID, err)
+		}
+		return key, nil
+	}
+
+	if key := secrets[luksSecretKey]; key != "" {
+		return []byte(key), nil
+	}
+	return nil, fmt.Errorf("no passphrase, set the %s key of the node stage secret or the %s parameter", luksSecretKey, luksKeyIDKey)
+}
+
+// openLUKSVolume opens the LUKS device of the volume and returns the path of
+// its mapping. A blank device is formatted with LUKS first, while a device
+// holding anything else than LUKS is refused, so that no data is lost.
+func (ns *nodeServer) openLUKSVolume(ctx context.Context, volumeID, devicePath string, volumeContext, secrets map[string]string) (string, error) {
+	mapperPath := luksMapperPath(volumeID)
+	exists, err := utilpath.Exists(utilpath.CheckFollowSymlink, mapperPath)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		klog.V(4).Infof("LUKS device of volume %s is already open at %s", volumeID, mapperPath)
+		return mapperPath, nil
+	}
+
+	key, err := ns.getLUKSKey(ctx, volumeContext, secrets)
+	if err != nil {
+		return "", err
+	}
+
+	format, err := ns.diskFormat(devicePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get the format of device %s: %v", devicePath, err)
+	}
+	switch format {
+	case "":
+		klog.V(2).Infof("Formatting device %s of volume %s with LUKS", devicePath, volumeID)
+		if err := ns.cryptsetup(key, "luksFormat", "--batch-mode", "--type", "luks2",
+			"--cipher", volumeContext[luksCipherKey],
+			"--key-size", volumeContext[luksKeySizeKey],
+			"--key-file", "-", devicePath); err != nil {
+			return "", err
+		}
+	case "crypto_LUKS":
+	default:
+		return "", fmt.Errorf("device %s of volume %s is formatted with %s, not LUKS", devicePath, volumeID, format)
+	}
+
+	// the volume key is kept out of the kernel keyring, so that the mapping
+	// can be resized without the passphrase
+	if err := ns.cryptsetup(key, "luksOpen", "--disable-keyring", "--key-file", "-", devicePath, luksMapperPrefix+volumeID); err != nil {
+		return "", err
+	}
+	klog.V(4).Infof("Opened LUKS device of volume %s at %s", volumeID, mapperPath)
+	return mapperPath, nil
+}
+
+// closeLUKSVolume closes the LUKS device of the volume, if it is open.
+func (ns *nodeServer) closeLUKSVolume(volumeID string) error {
+	exists, err := utilpath.Exists(utilpath.CheckFollowSymlink, luksMapperPath(volumeID))
+	if err != nil || !exists {
+		return err
+	}
+	return ns.cryptsetup(nil, "luksClose", luksMapperPrefix+volumeID)
+}
+
+// resizeLUKSVolume grows the mapping of the LUKS device to the size of the
+// volume.
+func (ns *nodeServer) resizeLUKSVolume(mapperPath string) error {
+	return ns.cryptsetup(nil, "resize", filepath.Base(mapperPath))
+}
+
+// diskFormat returns the format of the device found by blkid, or an empty
+// string if the device is blank.
+func (ns *nodeServer) diskFormat(devicePath string) (string, error) {
+	out, err := ns.Mount.Mounter().Exec.Command("blkid", "-p", "-s", "TYPE", "-s", "PTTYPE", "-o", "export", devicePath).CombinedOutput()
+	if err != nil {
+		// blkid exits with 2 when no format is found
+		if exitErr, ok := err.(utilexec.ExitError); ok && exitErr.ExitStatus() == 2 {
+			return "", nil
+		}
+		return "", fmt.Errorf("blkid failed: %v, output: %q", err, string(out))
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		k, v, _ := strings.Cut(strings.TrimSpace(line), "=")
+		switch k {
+		case "TYPE":
+			return v, nil
+		case "PTTYPE":
+			return "partition table " + v, nil
+		}
+	}
+	return "", nil
+}
+
+// cryptsetup runs cryptsetup, passing the key on the standard input
+func (ns *nodeServer) cryptsetup(key []byte, args ...string) error {
+	cmd := ns.Mount.Mounter().Exec.Command("cryptsetup", args...)
+	if key != nil {
+		cmd.SetStdin(bytes.NewReader(key))
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("cryptsetup %s failed: %v, output: %q", args[0], err, string(out))
+	}
+	return nil
+}
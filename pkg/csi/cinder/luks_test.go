@@ -0,0 +1,127 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLUKSVolumeContext(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   map[string]string
+		expected map[string]string
+		code     codes.Code
+	}{
+		{
+			name:   "not encrypted",
+			params: map[string]string{"type": "fast"},
+		},
+		{
+			name:   "defaults",
+			params: map[string]string{luksEncryptedKey: "true"},
+			expected: map[string]string{
+				luksEncryptedKey: "true",
+				luksCipherKey:    "aes-xts-plain64",
+				luksKeySizeKey:   "512",
+			},
+		},
+		{
+			name: "key manager",
+			params: map[string]string{
+				luksEncryptedKey: "true",
+				luksCipherKey:    "aes-cbc-essiv:sha256",
+				luksKeySizeKey:   "256",
+				luksKeyIDKey:     "e6f72f7a-5ea2-4d3b-9a1c-0b5e5b1f3e3a",
+			},
+			expected: map[string]string{
+				luksEncryptedKey: "true",
+				luksCipherKey:    "aes-cbc-essiv:sha256",
+				luksKeySizeKey:   "256",
+				luksKeyIDKey:     "e6f72f7a-5ea2-4d3b-9a1c-0b5e5b1f3e3a",
+			},
+		},
+		{
+			name:   "invalid key size",
+			params: map[string]string{luksEncryptedKey: "true", luksKeySizeKey: "100x"},
+			code:   codes.InvalidArgument,
+		},
+		{
+			name:   "parameters without encryption",
+			params: map[string]string{luksCipherKey: "aes-xts-plain64"},
+			code:   codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			volCtx, err := luksVolumeContext(tt.params)
+			assert.Equal(t, tt.code, status.Code(err))
+			assert.Equal(t, tt.expected, volCtx)
+		})
+	}
+}
+
+func TestNodeStageVolumeLUKS(t *testing.T) {
+	fakeNs, omock, mmock, _ := fakeNodeServer()
+
+	mmock.On("GetDevicePath", FakeVolID).Return(FakeDevicePath, nil)
+
+	req := &csi.NodeStageVolumeRequest{
+		VolumeId:          FakeVolID,
+		PublishContext:    map[string]string{"DevicePath": FakeDevicePath},
+		StagingTargetPath: FakeStagingTargetPath,
+		VolumeCapability: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{},
+			},
+		},
+		VolumeContext: map[string]string{
+			luksEncryptedKey: "true",
+			luksCipherKey:    defaultLUKSCipher,
+			luksKeySizeKey:   "512",
+			luksKeyIDKey:     "e6f72f7a-5ea2-4d3b-9a1c-0b5e5b1f3e3a",
+		},
+	}
+
+	// the key manager is not enabled
+	_, err := fakeNs.NodeStageVolume(FakeCtx, req)
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Contains(t, err.Error(), "--node-service-barbican-keys")
+
+	// the device of the mock holds an ext4 file system, which is never
+	// overwritten with LUKS
+	fakeNs.KeyManager = omock
+	omock.On("GetSecretPayload", "e6f72f7a-5ea2-4d3b-9a1c-0b5e5b1f3e3a").Return([]byte("passphrase"), nil)
+	_, err = fakeNs.NodeStageVolume(FakeCtx, req)
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Contains(t, err.Error(), "not LUKS")
+
+	// the block volumes are not supported
+	req.VolumeCapability = &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Block{
+			Block: &csi.VolumeCapability_BlockVolume{},
+		},
+	}
+	_, err = fakeNs.NodeStageVolume(FakeCtx, req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
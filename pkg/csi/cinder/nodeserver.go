@@ -21,21 +21,25 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
 	"github.com/kubernetes-csi/csi-lib-utils/protosanitizer"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/klog/v2"
 	utilpath "k8s.io/utils/path"
 
 	sharedcsi "k8s.io/cloud-provider-openstack/pkg/csi"
 	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
+	"k8s.io/cloud-provider-openstack/pkg/util"
 	"k8s.io/cloud-provider-openstack/pkg/util/blockdevice"
+	cpoerrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
 	"k8s.io/cloud-provider-openstack/pkg/util/metadata"
 	"k8s.io/cloud-provider-openstack/pkg/util/mount"
-	mountutil "k8s.io/mount-utils"
 )
 
 type nodeServer struct {
@@ -44,6 +48,12 @@ type nodeServer struct {
 	Metadata   metadata.IMetadata
 	Opts       openstack.BlockStorageOpts
 	Topologies map[string]string
+	// Cloud is used to manage the CSI ephemeral inline volumes, which are
+	// disabled when it is nil
+	Cloud openstack.IOpenStack
+	// KeyManager is used to get the LUKS keys held by the key manager, which
+	// are unavailable when it is nil
+	KeyManager openstack.IOpenStack
 	csi.UnimplementedNodeServer
 }
 
@@ -67,8 +77,10 @@ func (ns *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 
 	ephemeralVolume := req.GetVolumeContext()[sharedcsi.VolEphemeralKey] == "true"
 	if ephemeralVolume {
-		// See https://github.com/kubernetes/cloud-provider-openstack/issues/2599
-		return nil, status.Error(codes.Unimplemented, "CSI inline ephemeral volumes support is removed in 1.31 release.")
+		if ns.Cloud == nil {
+			return nil, status.Error(codes.Unimplemented, "CSI inline ephemeral volumes are disabled, they can be enabled with the --node-service-ephemeral-volumes flag")
+		}
+		return nodePublishEphemeral(ctx, req, ns)
 	}
 
 	// In case of ephemeral volume staging path not provided
@@ -96,7 +108,7 @@ func (ns *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 
 	// Volume Mount
 	if notMnt {
-		fsType := "ext4"
+		fsType := mount.DefaultFsType
 		if mnt := volumeCapability.GetMount(); mnt != nil {
 			if mnt.FsType != "" {
 				fsType = mnt.FsType
@@ -122,10 +134,11 @@ func nodePublishVolumeForBlock(req *csi.NodePublishVolumeRequest, ns *nodeServer
 	m := ns.Mount
 
 	// Do not trust the path provided by cinder, get the real path on node
-	source, err := getDevicePath(volumeID, m)
+	source, err := getDevicePath(volumeID, m, ns.deviceWaitOpts())
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "Unable to find Device path for volume: %v", err)
 	}
+	source = ns.stageDevicePath(source)
 
 	exists, err := utilpath.Exists(utilpath.CheckFollowSymlink, podVolumePath)
 	if err != nil {
@@ -163,10 +176,154 @@ func (ns *nodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpu
 		return nil, status.Error(codes.InvalidArgument, "[NodeUnpublishVolume] volumeID must be provided")
 	}
 
+	var ephemeralVol *volumes.Volume
+	if ns.Cloud != nil {
+		vols, err := ns.Cloud.GetVolumesByName(ctx, ephemeralVolumeName(volumeID))
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "[NodeUnpublishVolume] failed to get ephemeral volume: %v", err)
+		}
+		if len(vols) > 0 {
+			ephemeralVol = &vols[0]
+		}
+	}
+
 	if err := ns.Mount.UnmountPath(targetPath); err != nil {
 		return nil, status.Errorf(codes.Internal, "Unmount of targetpath %s failed with error %v", targetPath, err)
 	}
 
+	if ephemeralVol != nil {
+		return nodeUnpublishEphemeral(ctx, ns, ephemeralVol)
+	}
+
+	return &csi.NodeUnpublishVolumeResponse{}, nil
+}
+
+// ephemeralVolumeName returns the name of the Cinder volume backing the CSI
+// ephemeral inline volume with the given ID.
+func ephemeralVolumeName(volumeID string) string {
+	return fmt.Sprintf("ephemeral-%s", volumeID)
+}
+
+// nodePublishEphemeral creates and attaches the Cinder volume backing a CSI
+// ephemeral inline volume, and mounts it on the target path.
+func nodePublishEphemeral(ctx context.Context, req *csi.NodePublishVolumeRequest, ns *nodeServer) (*csi.NodePublishVolumeResponse, error) {
+	volumeID := req.GetVolumeId()
+	volName := ephemeralVolumeName(volumeID)
+	volumeContext := req.GetVolumeContext()
+	cloud := ns.Cloud
+
+	// Volume Size - Default is 1 GiB
+	size := 1
+	if capacity, ok := volumeContext["capacity"]; ok {
+		quantity, err := resource.ParseQuantity(capacity)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "[NodePublishVolume] invalid capacity %q: %v", capacity, err)
+		}
+		size = int(util.RoundUpSize(quantity.Value(), 1024*1024*1024))
+	}
+
+	volAvailability, err := ns.Metadata.GetAvailabilityZone()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "[NodePublishVolume] retrieving availability zone from metadata service failed with error %v", err)
+	}
+
+	nodeID, err := ns.Metadata.GetInstanceID()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "[NodePublishVolume] retrieving instance id of node failed with error %v", err)
+	}
+
+	// Reuse the volume created by a previous attempt
+	vols, err := cloud.GetVolumesByName(ctx, volName)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "[NodePublishVolume] failed to get volumes: %v", err)
+	}
+
+	var vol *volumes.Volume
+	if len(vols) > 0 {
+		vol = &vols[0]
+		klog.V(4).Infof("Ephemeral volume %s already exists", vol.ID)
+	} else {
+		opts := &volumes.CreateOpts{
+			Name:             volName,
+			Size:             size,
+			VolumeType:       volumeContext["type"],
+			AvailabilityZone: ns.Opts.VolumeAZ(volAvailability),
+			Metadata:         map[string]string{cinderCSIClusterIDKey: ns.Driver.clusterID},
+		}
+		vol, err = cloud.CreateVolume(ctx, opts, nil)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "[NodePublishVolume] failed to create ephemeral volume: %v", err)
+		}
+		klog.V(4).Infof("Created ephemeral volume %s for %s", vol.ID, volumeID)
+	}
+
+	if err := cloud.WaitVolumeTargetStatus(ctx, vol.ID, []string{openstack.VolumeAvailableStatus, openstack.VolumeInUseStatus}); err != nil {
+		return nil, status.Errorf(codes.Internal, "[NodePublishVolume] ephemeral volume %s is not available: %v", vol.ID, err)
+	}
+
+	if _, err := cloud.AttachVolume(ctx, nodeID, vol.ID); err != nil {
+		return nil, status.Errorf(codes.Internal, "[NodePublishVolume] failed to attach ephemeral volume %s: %v", vol.ID, err)
+	}
+
+	if err := cloud.WaitDiskAttached(ctx, nodeID, vol.ID); err != nil {
+		return nil, status.Errorf(codes.Internal, "[NodePublishVolume] failed to attach ephemeral volume %s: %v", vol.ID, err)
+	}
+
+	m := ns.Mount
+	devicePath, err := getDevicePath(vol.ID, m, ns.deviceWaitOpts())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Unable to find Device path for volume: %v", err)
+	}
+
+	notMnt, err := m.IsLikelyNotMountPointAttach(req.GetTargetPath())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	if notMnt {
+		fsType := mount.DefaultFsType
+		var options []string
+		if mnt := req.GetVolumeCapability().GetMount(); mnt != nil {
+			if mnt.FsType != "" {
+				fsType = mnt.FsType
+			}
+			options = collectMountOptions(fsType, mnt.GetMountFlags())
+		}
+		if req.GetReadonly() {
+			options = append(options, "ro")
+		}
+		if err := m.Mounter().FormatAndMount(devicePath, req.GetTargetPath(), fsType, options); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+
+	return &csi.NodePublishVolumeResponse{}, nil
+}
+
+// nodeUnpublishEphemeral detaches and deletes the Cinder volume backing a CSI
+// ephemeral inline volume.
+func nodeUnpublishEphemeral(ctx context.Context, ns *nodeServer, vol *volumes.Volume) (*csi.NodeUnpublishVolumeResponse, error) {
+	cloud := ns.Cloud
+
+	nodeID, err := ns.Metadata.GetInstanceID()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "[NodeUnpublishVolume] retrieving instance id of node failed with error %v", err)
+	}
+
+	if err := cloud.DetachVolume(ctx, nodeID, vol.ID); err != nil {
+		return nil, status.Errorf(codes.Internal, "[NodeUnpublishVolume] failed to detach ephemeral volume %s: %v", vol.ID, err)
+	}
+
+	if err := cloud.WaitDiskDetached(ctx, nodeID, vol.ID); err != nil {
+		return nil, status.Errorf(codes.Internal, "[NodeUnpublishVolume] failed to detach ephemeral volume %s: %v", vol.ID, err)
+	}
+
+	if err := cloud.DeleteVolume(ctx, vol.ID); err != nil && !cpoerrors.IsNotFound(err) {
+		return nil, status.Errorf(codes.Internal, "[NodeUnpublishVolume] failed to delete ephemeral volume %s: %v", vol.ID, err)
+	}
+
+	klog.V(4).Infof("Deleted ephemeral volume %s", vol.ID)
+
 	return &csi.NodeUnpublishVolumeResponse{}, nil
 }
 
@@ -190,10 +347,35 @@ func (ns *nodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStageVol
 	}
 
 	m := ns.Mount
-	// Do not trust the path provided by cinder, get the real path on node
-	devicePath, err := getDevicePath(volumeID, m)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "Unable to find Device path for volume: %v", err)
+	var devicePath string
+	var err error
+	if publishContext := req.GetPublishContext(); publishContext[nvmeofTargetNQNKey] != "" {
+		devicePath, err = ns.connectNVMeoFVolume(volumeID, publishContext)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Unable to connect volume over NVMe-oF: %v", err)
+		}
+	} else if publishContext[localConnectorKey] != "" {
+		devicePath, err = ns.connectLocalVolume(volumeID, stagingTarget, publishContext)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Unable to connect volume locally: %v", err)
+		}
+	} else {
+		// Do not trust the path provided by cinder, get the real path on node
+		devicePath, err = getDevicePath(volumeID, m, ns.deviceWaitOpts())
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Unable to find Device path for volume: %v", err)
+		}
+		devicePath = ns.stageDevicePath(devicePath)
+	}
+
+	if volumeContext[luksEncryptedKey] == "true" {
+		if volumeCapability.GetBlock() != nil {
+			return nil, status.Error(codes.InvalidArgument, "LUKS encryption is only supported for the volumes with a file system")
+		}
+		devicePath, err = ns.openLUKSVolume(ctx, volumeID, devicePath, volumeContext, req.GetSecrets())
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Unable to open LUKS device of volume %s: %v", volumeID, err)
+		}
 	}
 
 	if blk := volumeCapability.GetBlock(); blk != nil {
@@ -209,25 +391,26 @@ func (ns *nodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStageVol
 
 	// Volume Mount
 	if notMnt {
-		// set default fstype is ext4
-		fsType := "ext4"
-		var options []string
+		// the default fstype of the StorageClass or of the OS
+		fsType := volumeFsType(volumeCapability.GetMount().GetFsType(), volumeContext[defaultFsTypeKey])
+		formatOptions, fsMountOptions, err := parseFsOptions(fsType, volumeContext[mkfsOptionsKey], volumeContext[mountOptionsKey])
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid file system options of volume %s: %v", volumeID, err)
+		}
+		options := fsMountOptions
 		if mnt := volumeCapability.GetMount(); mnt != nil {
-			if mnt.FsType != "" {
-				fsType = mnt.FsType
-			}
-			mountFlags := mnt.GetMountFlags()
-			options = append(options, collectMountOptions(fsType, mountFlags)...)
+			mountFlags := slices.Concat(mnt.GetMountFlags(), fsMountOptions)
+			options = collectMountOptions(fsType, mountFlags)
 		}
 		// Mount
-		err = ns.formatAndMountRetry(devicePath, stagingTarget, fsType, options)
+		err = ns.formatAndMountRetry(devicePath, stagingTarget, fsType, options, formatOptions, volumeContext[fsRepairKey] == "true")
 		if err != nil {
 			return nil, status.Error(codes.Internal, err.Error())
 		}
 	}
 
 	if required, ok := volumeContext[ResizeRequired]; ok && strings.EqualFold(required, "true") {
-		r := mountutil.NewResizeFs(ns.Mount.Mounter().Exec)
+		r := mount.NewResizeFs(ns.Mount.Mounter().Exec)
 
 		needResize, err := r.NeedResize(devicePath, stagingTarget)
 
@@ -248,9 +431,11 @@ func (ns *nodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStageVol
 
 // formatAndMountRetry attempts to format and mount a device at the given path.
 // If the initial mount fails, it rescans the device and retries the mount operation.
-func (ns *nodeServer) formatAndMountRetry(devicePath, stagingTarget, fsType string, options []string) error {
+// The format options are only used when the device is not formatted yet. With
+// repair, the file system is repaired and mounted again if it can't be mounted.
+func (ns *nodeServer) formatAndMountRetry(devicePath, stagingTarget, fsType string, options, formatOptions []string, repair bool) error {
 	m := ns.Mount
-	err := m.Mounter().FormatAndMount(devicePath, stagingTarget, fsType, options)
+	err := m.Mounter().FormatAndMountSensitiveWithFormatOptions(devicePath, stagingTarget, fsType, options, nil, formatOptions)
 	if err != nil {
 		klog.Infof("Initial format and mount failed: %v. Attempting rescan.", err)
 		// Attempting rescan if the initial mount fails
@@ -260,7 +445,14 @@ func (ns *nodeServer) formatAndMountRetry(devicePath, stagingTarget, fsType stri
 			return err
 		}
 		klog.Infof("Rescan succeeded, retrying format and mount")
-		err = m.Mounter().FormatAndMount(devicePath, stagingTarget, fsType, options)
+		err = m.Mounter().FormatAndMountSensitiveWithFormatOptions(devicePath, stagingTarget, fsType, options, nil, formatOptions)
+	}
+	if err != nil && repair && isRepairableMountError(err) {
+		klog.Warningf("Mount of device %s failed: %v. Attempting repair.", devicePath, err)
+		if repairErr := ns.repairFilesystem(devicePath, fsType); repairErr != nil {
+			return fmt.Errorf("%v, and the repair failed: %v", err, repairErr)
+		}
+		err = m.Mounter().FormatAndMountSensitiveWithFormatOptions(devicePath, stagingTarget, fsType, options, nil, formatOptions)
 	}
 	return err
 }
@@ -283,6 +475,24 @@ func (ns *nodeServer) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstag
 		return nil, status.Errorf(codes.Internal, "Unmount of targetPath %s failed with error %v", stagingTargetPath, err)
 	}
 
+	if err := ns.closeLUKSVolume(volumeID); err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to close LUKS device of volume %s: %v", volumeID, err)
+	}
+
+	if ns.Opts.NodeDeviceCleanup {
+		if err := ns.cleanupVolumeDevices(volumeID); err != nil {
+			return nil, status.Errorf(codes.Internal, "Failed to clean up the devices of volume %s: %v", volumeID, err)
+		}
+	}
+
+	if err := ns.disconnectNVMeoFVolume(volumeID); err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to disconnect volume %s over NVMe-oF: %v", volumeID, err)
+	}
+
+	if err := ns.disconnectLocalVolume(volumeID, stagingTargetPath); err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to disconnect volume %s locally: %v", volumeID, err)
+	}
+
 	return &csi.NodeUnstageVolumeResponse{}, nil
 }
 
@@ -294,7 +504,7 @@ func (ns *nodeServer) NodeGetInfo(ctx context.Context, req *csi.NodeGetInfoReque
 
 	nodeInfo := &csi.NodeGetInfoResponse{
 		NodeId:            nodeID,
-		MaxVolumesPerNode: ns.Opts.NodeVolumeAttachLimit,
+		MaxVolumesPerNode: ns.nodeVolumeAttachLimit(),
 	}
 
 	if !ns.Driver.withTopology {
@@ -348,6 +558,13 @@ func (ns *nodeServer) NodeGetVolumeStats(_ context.Context, req *csi.NodeGetVolu
 		return nil, status.Errorf(codes.Internal, "failed to get stats by path: %v", err)
 	}
 
+	condition := nodeVolumeCondition(volumeID, stats)
+	if stats.DeviceMissing {
+		return &csi.NodeGetVolumeStatsResponse{
+			VolumeCondition: condition,
+		}, nil
+	}
+
 	if stats.Block {
 		return &csi.NodeGetVolumeStatsResponse{
 			Usage: []*csi.VolumeUsage{
@@ -356,6 +573,7 @@ func (ns *nodeServer) NodeGetVolumeStats(_ context.Context, req *csi.NodeGetVolu
 					Unit:  csi.VolumeUsage_BYTES,
 				},
 			},
+			VolumeCondition: condition,
 		}, nil
 	}
 
@@ -364,9 +582,30 @@ func (ns *nodeServer) NodeGetVolumeStats(_ context.Context, req *csi.NodeGetVolu
 			{Total: stats.TotalBytes, Available: stats.AvailableBytes, Used: stats.UsedBytes, Unit: csi.VolumeUsage_BYTES},
 			{Total: stats.TotalInodes, Available: stats.AvailableInodes, Used: stats.UsedInodes, Unit: csi.VolumeUsage_INODES},
 		},
+		VolumeCondition: condition,
 	}, nil
 }
 
+// nodeVolumeCondition returns the condition of the volume as seen from the
+// node.
+func nodeVolumeCondition(volumeID string, stats *mount.DeviceStats) *csi.VolumeCondition {
+	switch {
+	case stats.DeviceMissing:
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("Volume %s is mounted but its device is missing", volumeID),
+		}
+	case stats.ReadOnlyRemount:
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("Volume %s file system was remounted read-only", volumeID),
+		}
+	}
+	return &csi.VolumeCondition{
+		Message: fmt.Sprintf("Volume %s is healthy", volumeID),
+	}
+}
+
 func (ns *nodeServer) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandVolumeRequest) (*csi.NodeExpandVolumeResponse, error) {
 	klog.V(4).Infof("NodeExpandVolume: called with args %+v", protosanitizer.StripSecrets(req))
 
@@ -379,10 +618,13 @@ func (ns *nodeServer) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandV
 		return nil, status.Error(codes.InvalidArgument, "Volume path not provided")
 	}
 
-	_, err := blockdevice.IsBlockDevice(volumePath)
+	isBlock, err := blockdevice.IsBlockDevice(volumePath)
 	if err != nil {
 		return nil, status.Errorf(codes.NotFound, "Failed to determine device path for volumePath %s: %v", volumePath, err)
 	}
+	if isBlock || req.GetVolumeCapability().GetBlock() != nil {
+		return ns.nodeExpandBlockVolume(volumeID, volumePath, req.GetCapacityRange().GetRequiredBytes())
+	}
 
 	output, err := ns.Mount.GetMountFs(volumePath)
 	if err != nil {
@@ -394,24 +636,59 @@ func (ns *nodeServer) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandV
 		return nil, status.Error(codes.Internal, "Unable to find Device path for volume")
 	}
 
-	if ns.Opts.RescanOnResize {
+	if isLUKSMapping(devicePath) {
+		if ns.Opts.RescanOnResize {
+			// the size of the volume is the one of the encrypted device
+			encryptedPath, err := getDevicePath(volumeID, ns.Mount, ns.deviceWaitOpts())
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "Unable to find Device path for volume: %v", err)
+			}
+			if err := ns.rescanVolumeDevice(ns.stageDevicePath(encryptedPath), volumePath, req.GetCapacityRange().GetRequiredBytes()); err != nil {
+				return nil, status.Errorf(codes.Internal, "Could not verify %q volume size: %v", volumeID, err)
+			}
+		}
+		if err := ns.resizeLUKSVolume(devicePath); err != nil {
+			return nil, status.Errorf(codes.Internal, "Could not resize LUKS device of volume %q: %v", volumeID, err)
+		}
+	} else if ns.Opts.RescanOnResize {
 		// comparing current volume size with the expected one
 		newSize := req.GetCapacityRange().GetRequiredBytes()
-		if err := blockdevice.RescanBlockDeviceGeometry(devicePath, volumePath, newSize); err != nil {
+		if err := ns.rescanVolumeDevice(devicePath, volumePath, newSize); err != nil {
 			return nil, status.Errorf(codes.Internal, "Could not verify %q volume size: %v", volumeID, err)
 		}
 	}
 
-	r := mountutil.NewResizeFs(ns.Mount.Mounter().Exec)
+	r := mount.NewResizeFs(ns.Mount.Mounter().Exec)
 	if _, err := r.Resize(devicePath, volumePath); err != nil {
 		return nil, status.Errorf(codes.Internal, "Could not resize volume %q: %v", volumeID, err)
 	}
 	return &csi.NodeExpandVolumeResponse{}, nil
 }
 
-func getDevicePath(volumeID string, m mount.IMount) (string, error) {
+// nodeExpandBlockVolume makes the new size of a raw block volume visible on
+// the node. There is no file system to resize.
+func (ns *nodeServer) nodeExpandBlockVolume(volumeID, volumePath string, newSize int64) (*csi.NodeExpandVolumeResponse, error) {
+	devicePath, err := getDevicePath(volumeID, ns.Mount, ns.deviceWaitOpts())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Unable to find Device path for volume: %v", err)
+	}
+
+	if err := ns.rescanVolumeDevice(devicePath, volumePath, newSize); err != nil {
+		return nil, status.Errorf(codes.Internal, "Could not verify %q volume size: %v", volumeID, err)
+	}
+
+	size, err := blockdevice.GetBlockDeviceSize(volumePath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Could not get the size of volume %q: %v", volumeID, err)
+	}
+
+	klog.V(4).Infof("NodeExpandVolume: block volume %q has the size %d", volumeID, size)
+	return &csi.NodeExpandVolumeResponse{CapacityBytes: size}, nil
+}
+
+func getDevicePath(volumeID string, m mount.IMount, opts mount.DeviceWaitOpts) (string, error) {
 	var devicePath string
-	devicePath, err := m.GetDevicePath(volumeID)
+	devicePath, err := m.GetDevicePath(volumeID, opts)
 	if err != nil {
 		klog.Warningf("Couldn't get device path from mount: %v", err)
 	}
@@ -23,6 +23,7 @@ import (
 	"testing"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -86,6 +87,43 @@ func TestNodeGetInfo(t *testing.T) {
 	assert.Equal(expectedRes, actualRes)
 }
 
+func TestDetectVolumeAttachLimit(t *testing.T) {
+	defer func(path string) { sysBlockPath = path }(sysBlockPath)
+
+	fakeDisks := func(t *testing.T, serials map[string]string) {
+		sysBlockPath = t.TempDir()
+		for name, serial := range serials {
+			dir := filepath.Join(sysBlockPath, name)
+			assert.NoError(t, os.MkdirAll(dir, 0755))
+			if serial != "" {
+				assert.NoError(t, os.WriteFile(filepath.Join(dir, "serial"), []byte(serial+"\n"), 0644))
+			}
+		}
+	}
+
+	// root and config drive disks, and an attached volume
+	fakeDisks(t, map[string]string{"vda": "", "vdb": "", "vdc": "261a8b81-3660-43e5-b"})
+	limit, err := detectVolumeAttachLimit()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(virtioBlkVolumeAttachLimit-2), limit)
+
+	fakeDisks(t, map[string]string{"sda": "", "sdb": "", "loop0": ""})
+	limit, err = detectVolumeAttachLimit()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(virtioSCSIVolumeAttachLimit), limit)
+
+	fakeDisks(t, map[string]string{"nvme0n1": ""})
+	_, err = detectVolumeAttachLimit()
+	assert.Error(t, err)
+
+	// the configured limit takes precedence
+	fakeDisks(t, map[string]string{"vda": ""})
+	ns := &nodeServer{Opts: openstack.BlockStorageOpts{NodeVolumeAttachLimitAuto: true}}
+	assert.Equal(t, int64(virtioBlkVolumeAttachLimit-1), ns.nodeVolumeAttachLimit())
+	ns.Opts.NodeVolumeAttachLimit = 10
+	assert.Equal(t, int64(10), ns.nodeVolumeAttachLimit())
+}
+
 // Test NodePublishVolume
 func TestNodePublishVolume(t *testing.T) {
 	fakeNs, omock, mmock, _ := fakeNodeServer()
@@ -127,12 +165,20 @@ func TestNodePublishVolume(t *testing.T) {
 }
 
 func TestNodePublishVolumeEphemeral(t *testing.T) {
-	fakeNs, omock, _, _ := fakeNodeServer()
+	fakeNs, omock, mmock, metamock := fakeNodeServer()
 
 	properties := map[string]string{cinderCSIClusterIDKey: FakeCluster}
 	fvolName := fmt.Sprintf("ephemeral-%s", FakeVolID)
 
+	omock.On("GetVolumesByName", fvolName).Return(FakeVolListEmpty, nil)
 	omock.On("CreateVolume", fvolName, 2, "test", "nova", "", "", "", properties).Return(&FakeVol, nil)
+	omock.On("WaitVolumeTargetStatus", FakeVolID, []string{openstack.VolumeAvailableStatus, openstack.VolumeInUseStatus}).Return(nil)
+	omock.On("AttachVolume", FakeNodeID, FakeVolID).Return(FakeVolID, nil)
+	omock.On("WaitDiskAttached", FakeNodeID, FakeVolID).Return(nil)
+	mmock.On("GetDevicePath", FakeVolID).Return(FakeDevicePath, nil)
+	mmock.On("IsLikelyNotMountPointAttach", FakeTargetPath).Return(true, nil)
+	metamock.On("GetInstanceID").Return(FakeNodeID, nil)
+	metamock.On("GetAvailabilityZone").Return(FakeAvailability, nil)
 
 	assert := assert.New(t)
 
@@ -156,9 +202,38 @@ func TestNodePublishVolumeEphemeral(t *testing.T) {
 		VolumeContext:    map[string]string{"capacity": "2Gi", sharedcsi.VolEphemeralKey: "true", "type": "test"},
 	}
 
-	// Invoke NodePublishVolume
+	// Invoke NodePublishVolume with ephemeral volumes disabled
 	_, err := fakeNs.NodePublishVolume(FakeCtx, fakeReq)
-	assert.Equal(status.Error(codes.Unimplemented, "CSI inline ephemeral volumes support is removed in 1.31 release."), err)
+	assert.Equal(codes.Unimplemented, status.Code(err))
+
+	// Invoke NodePublishVolume
+	fakeNs.Cloud = omock
+	actualRes, err := fakeNs.NodePublishVolume(FakeCtx, fakeReq)
+	assert.NoError(err)
+	assert.Equal(&csi.NodePublishVolumeResponse{}, actualRes)
+	omock.AssertCalled(t, "CreateVolume", fvolName, 2, "test", "nova", "", "", "", properties)
+}
+
+func TestNodeUnpublishVolumeEphemeral(t *testing.T) {
+	fakeNs, omock, mmock, metamock := fakeNodeServer()
+	fakeNs.Cloud = omock
+
+	fvolName := fmt.Sprintf("ephemeral-%s", FakeVolID)
+
+	omock.On("GetVolumesByName", fvolName).Return([]volumes.Volume{FakeVol}, nil)
+	omock.On("DetachVolume", FakeNodeID, FakeVolID).Return(nil)
+	omock.On("WaitDiskDetached", FakeNodeID, FakeVolID).Return(nil)
+	omock.On("DeleteVolume", FakeVolID).Return(nil)
+	mmock.On("UnmountPath", FakeTargetPath).Return(nil)
+	metamock.On("GetInstanceID").Return(FakeNodeID, nil)
+
+	actualRes, err := fakeNs.NodeUnpublishVolume(FakeCtx, &csi.NodeUnpublishVolumeRequest{
+		VolumeId:   FakeVolID,
+		TargetPath: FakeTargetPath,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &csi.NodeUnpublishVolumeResponse{}, actualRes)
+	omock.AssertCalled(t, "DeleteVolume", FakeVolID)
 }
 
 // Test NodeStageVolume
@@ -326,6 +401,33 @@ func TestNodeExpandVolume(t *testing.T) {
 
 }
 
+func TestNodeExpandVolumeBlock(t *testing.T) {
+	fakeNs, _, mmock, _ := fakeNodeServer()
+
+	// the bind mounted device of the volume
+	volumePath := filepath.Join(t.TempDir(), "block")
+	if err := os.WriteFile(volumePath, make([]byte, 1024*1024), 0644); err != nil {
+		t.Fatalf("Failed to set up volumepath: %v", err)
+	}
+
+	mmock.On("GetDevicePath", FakeVolID).Return(FakeDevicePath, nil)
+
+	fakeReq := &csi.NodeExpandVolumeRequest{
+		VolumeId:   FakeVolID,
+		VolumePath: volumePath,
+		VolumeCapability: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Block{
+				Block: &csi.VolumeCapability_BlockVolume{},
+			},
+		},
+	}
+
+	actualRes, err := fakeNs.NodeExpandVolume(FakeCtx, fakeReq)
+	assert.NoError(t, err)
+	assert.Equal(t, &csi.NodeExpandVolumeResponse{CapacityBytes: 1024 * 1024}, actualRes)
+	mmock.AssertCalled(t, "GetDevicePath", FakeVolID)
+}
+
 func TestNodeGetVolumeStatsBlock(t *testing.T) {
 	fakeNs, _, mmock, _ := fakeNodeServer()
 
@@ -353,6 +455,9 @@ func TestNodeGetVolumeStatsBlock(t *testing.T) {
 		Usage: []*csi.VolumeUsage{
 			{Total: FakeBlockDeviceStats.TotalBytes, Unit: csi.VolumeUsage_BYTES},
 		},
+		VolumeCondition: &csi.VolumeCondition{
+			Message: fmt.Sprintf("Volume %s is healthy", FakeVolName),
+		},
 	}
 
 	blockRes, err := fakeNs.NodeGetVolumeStats(FakeCtx, fakeReq)
@@ -388,6 +493,9 @@ func TestNodeGetVolumeStatsFs(t *testing.T) {
 			{Total: FakeFsStats.TotalBytes, Available: FakeFsStats.AvailableBytes, Used: FakeFsStats.UsedBytes, Unit: csi.VolumeUsage_BYTES},
 			{Total: FakeFsStats.TotalInodes, Available: FakeFsStats.AvailableInodes, Used: FakeFsStats.UsedInodes, Unit: csi.VolumeUsage_INODES},
 		},
+		VolumeCondition: &csi.VolumeCondition{
+			Message: fmt.Sprintf("Volume %s is healthy", FakeVolName),
+		},
 	}
 
 	fsRes, err := fakeNs.NodeGetVolumeStats(FakeCtx, fakeReq)
@@ -396,3 +504,61 @@ func TestNodeGetVolumeStatsFs(t *testing.T) {
 	assert.Equal(expectedFsRes, fsRes)
 
 }
+
+func TestNodeGetVolumeStatsAbnormal(t *testing.T) {
+	tempDir := os.TempDir()
+	volumePath := filepath.Join(tempDir, FakeTargetPath)
+	err := os.MkdirAll(volumePath, 0750)
+	if err != nil {
+		t.Fatalf("Failed to set up volumepath: %v", err)
+	}
+	defer os.RemoveAll(volumePath)
+
+	readOnlyStats := *FakeFsStats
+	readOnlyStats.ReadOnlyRemount = true
+
+	tests := []struct {
+		name     string
+		stats    *mount.DeviceStats
+		expected *csi.NodeGetVolumeStatsResponse
+	}{
+		{
+			name:  "read-only remount",
+			stats: &readOnlyStats,
+			expected: &csi.NodeGetVolumeStatsResponse{
+				Usage: []*csi.VolumeUsage{
+					{Total: FakeFsStats.TotalBytes, Available: FakeFsStats.AvailableBytes, Used: FakeFsStats.UsedBytes, Unit: csi.VolumeUsage_BYTES},
+					{Total: FakeFsStats.TotalInodes, Available: FakeFsStats.AvailableInodes, Used: FakeFsStats.UsedInodes, Unit: csi.VolumeUsage_INODES},
+				},
+				VolumeCondition: &csi.VolumeCondition{
+					Abnormal: true,
+					Message:  fmt.Sprintf("Volume %s file system was remounted read-only", FakeVolName),
+				},
+			},
+		},
+		{
+			name:  "device missing",
+			stats: &mount.DeviceStats{DeviceMissing: true},
+			expected: &csi.NodeGetVolumeStatsResponse{
+				VolumeCondition: &csi.VolumeCondition{
+					Abnormal: true,
+					Message:  fmt.Sprintf("Volume %s is mounted but its device is missing", FakeVolName),
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeNs, _, mmock, _ := fakeNodeServer()
+			mmock.On("GetDeviceStats", volumePath).Return(tt.stats, nil)
+
+			res, err := fakeNs.NodeGetVolumeStats(FakeCtx, &csi.NodeGetVolumeStatsRequest{
+				VolumeId:   FakeVolName,
+				VolumePath: volumePath,
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, res)
+		})
+	}
+}
@@ -0,0 +1,224 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
+	"k8s.io/cloud-provider-openstack/pkg/util/blockdevice"
+	cpoerrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
+)
+
+// The volumes of the NVMe-oF backends listed in the nvmeof-volume-types option
+// are not attached to the servers by Nova. The controller service attaches them
+// with the Cinder attachments API, using a connector with the host NQN of the
+// node, and passes their connection info in the publish context. The node
+// service connects to the NVMe-oF subsystem of the volume, and finds its
+// namespace by UUID.
+const (
+	nvmeofTargetNQNKey     = "nvmeofTargetNQN"
+	nvmeofPortalsKey       = "nvmeofPortals"
+	nvmeofNamespaceUUIDKey = "nvmeofNamespaceUUID"
+
+	defaultNVMeoFConnectTimeout = 30 * time.Second
+)
+
+// nvmeofHostNQN returns the host NQN of the node, derived from its server ID,
+// so that the controller and the node service agree on it.
+func nvmeofHostNQN(nodeID string) string {
+	return "nqn.2014-08.org.nvmexpress:uuid:" + nodeID
+}
+
+// nvmeofConnector returns the os-brick connector properties of the node
+func nvmeofConnector(nodeID string) map[string]any {
+	return map[string]any{
+		"host":      nodeID,
+		"uuid":      nodeID,
+		"nqn":       nvmeofHostNQN(nodeID),
+		"multipath": false,
+		"os_type":   "linux",
+	}
+}
+
+// isNVMeoFVolume returns true if the volume is connected by the nodes over
+// NVMe-oF instead of being attached by Nova.
+func isNVMeoFVolume(bsOpts openstack.BlockStorageOpts, vol *volumes.Volume) bool {
+	return slices.Contains(bsOpts.NVMeoFVolumeTypes, vol.VolumeType)
+}
+
+// nvmeofPublishContext returns the publish context of the NVMe-oF connection
+// info of an attachment. Both the portals format and the legacy single portal
+// format of the connection info are supported.
+func nvmeofPublishContext(volumeID string, connInfo map[string]any) (map[string]string, error) {
+	if t, _ := connInfo["driver_volume_type"].(string); t != "nvmeof" {
+		return nil, fmt.Errorf("volume %s is connected with %q, not nvmeof", volumeID, t)
+	}
+	data, _ := connInfo["data"].(map[string]any)
+
+	targetNQN, _ := data["target_nqn"].(string)
+	if targetNQN == "" {
+		targetNQN, _ = data["nqn"].(string)
+	}
+	if targetNQN == "" {
+		return nil, fmt.Errorf("connection info of volume %s has no target NQN", volumeID)
+	}
+
+	var portals []string
+	if list, ok := data["portals"].([]any); ok {
+		for _, p := range list {
+			// [address, port, transport]
+			if p, ok := p.([]any); ok && len(p) == 3 {
+				portals = append(portals, nvmeofPortal(p[2], p[0], p[1]))
+			}
+		}
+	} else if addr, ok := data["target_portal"]; ok {
+		portals = append(portals, nvmeofPortal(data["transport_type"], addr, data["target_port"]))
+	}
+	if len(portals) == 0 {
+		return nil, fmt.Errorf("connection info of volume %s has no portal", volumeID)
+	}
+
+	nsUUID, _ := data["vol_uuid"].(string)
+	if nsUUID == "" {
+		nsUUID = volumeID
+	}
+
+	return map[string]string{
+		nvmeofTargetNQNKey:     targetNQN,
+		nvmeofPortalsKey:       strings.Join(portals, ","),
+		nvmeofNamespaceUUIDKey: nsUUID,
+	}, nil
+}
+
+// nvmeofPortal formats a portal as transport://address:port. The transports
+// of the Cinder drivers, e.g. nvmet_tcp or RoCEv2, are normalized to the ones
+// of nvme-cli.
+func nvmeofPortal(transport, addr, port any) string {
+	t := strings.TrimPrefix(strings.ToLower(fmt.Sprint(transport)), "nvmet_")
+	if t == "rocev2" {
+		t = "rdma"
+	}
+	return t + "://" + net.JoinHostPort(fmt.Sprint(addr), fmt.Sprint(port))
+}
+
+// parseNVMeoFPortals parses the portals of the publish context
+func parseNVMeoFPortals(s string) ([]blockdevice.NVMeoFPortal, error) {
+	var portals []blockdevice.NVMeoFPortal
+	for _, p := range strings.Split(s, ",") {
+		transport, hostPort, ok := strings.Cut(p, "://")
+		if !ok {
+			return nil, fmt.Errorf("invalid NVMe-oF portal %q", p)
+		}
+		addr, port, err := net.SplitHostPort(hostPort)
+		if err != nil {
+			return nil, fmt.Errorf("invalid NVMe-oF portal %q: %v", p, err)
+		}
+		portals = append(portals, blockdevice.NVMeoFPortal{Transport: transport, Address: addr, Port: port})
+	}
+	return portals, nil
+}
+
+// publishNVMeoFVolume attaches the volume to the node with the Cinder
+// attachments API, and returns the connection info of the volume.
+func (cs *controllerServer) publishNVMeoFVolume(ctx context.Context, cloud openstack.IOpenStack, volumeID, instanceID string) (*csi.ControllerPublishVolumeResponse, error) {
+	attachment, err := cloud.CreateVolumeAttachment(ctx, volumeID, instanceID, nvmeofConnector(instanceID))
+	if err != nil {
+		klog.Errorf("Failed to CreateVolumeAttachment: %v", err)
+		if errors.Is(err, cpoerrors.ErrMicroversionNotSupported) {
+			return nil, status.Errorf(codes.FailedPrecondition, "[ControllerPublishVolume] Attach Volume failed: %v", err)
+		}
+		return nil, status.Errorf(codes.Internal, "[ControllerPublishVolume] Attach Volume failed with error %v", err)
+	}
+
+	publishContext, err := nvmeofPublishContext(volumeID, attachment.ConnectionInfo)
+	if err != nil {
+		if err := cloud.DeleteVolumeAttachments(ctx, volumeID, instanceID); err != nil {
+			klog.Errorf("Failed to delete the attachment of volume %s: %v", volumeID, err)
+		}
+		return nil, status.Errorf(codes.FailedPrecondition, "[ControllerPublishVolume] %v, check the nvmeof-volume-types option", err)
+	}
+
+	klog.V(4).Infof("ControllerPublishVolume %s on %s over NVMe-oF is successful", volumeID, instanceID)
+
+	return &csi.ControllerPublishVolumeResponse{
+		PublishContext: publishContext,
+	}, nil
+}
+
+// connectNVMeoFVolume connects the node to the NVMe-oF subsystem of the volume
+// and returns the device of its namespace.
+func (ns *nodeServer) connectNVMeoFVolume(volumeID string, publishContext map[string]string) (string, error) {
+	nodeID, err := ns.Metadata.GetInstanceID()
+	if err != nil {
+		return "", fmt.Errorf("unable to retrieve instance id of node: %v", err)
+	}
+
+	portals, err := parseNVMeoFPortals(publishContext[nvmeofPortalsKey])
+	if err != nil {
+		return "", err
+	}
+	if err := blockdevice.ConnectNVMeoF(nvmeofHostNQN(nodeID), publishContext[nvmeofTargetNQNKey], portals); err != nil {
+		return "", err
+	}
+
+	nsUUID := publishContext[nvmeofNamespaceUUIDKey]
+	timeout := ns.Opts.NodeDeviceScanTimeout.Duration
+	if timeout <= 0 {
+		timeout = defaultNVMeoFConnectTimeout
+	}
+	var devicePath string
+	err = wait.PollUntilContextTimeout(context.Background(), ns.devicePollInterval(), timeout, true, func(context.Context) (bool, error) {
+		devicePath, err = blockdevice.FindNVMeNamespace(nsUUID)
+		return devicePath != "", err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to find the NVMe namespace %s of volume %s: %v", nsUUID, volumeID, err)
+	}
+
+	klog.V(4).Infof("Found NVMe namespace %s of volume %s", devicePath, volumeID)
+	return devicePath, nil
+}
+
+// disconnectNVMeoFVolume disconnects the node from the NVMe-oF subsystem of
+// the unstaged volume, unless the subsystem has namespaces of other volumes.
+// The namespace is found by the volume ID, which is the namespace UUID of the
+// Cinder NVMe-oF drivers.
+func (ns *nodeServer) disconnectNVMeoFVolume(volumeID string) error {
+	devicePath, err := blockdevice.FindNVMeNamespace(volumeID)
+	if err != nil {
+		klog.V(4).Infof("Failed to find the NVMe namespace of volume %s: %v", volumeID, err)
+		return nil
+	}
+	if devicePath == "" {
+		return nil
+	}
+	return blockdevice.DisconnectNVMeNamespace(devicePath)
+}
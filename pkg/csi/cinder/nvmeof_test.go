@@ -0,0 +1,117 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/attachments"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"k8s.io/cloud-provider-openstack/pkg/util/blockdevice"
+)
+
+func TestNVMeoFPublishContext(t *testing.T) {
+	tests := []struct {
+		name     string
+		connInfo map[string]any
+		expected map[string]string
+	}{
+		{
+			name: "portals",
+			connInfo: map[string]any{
+				"driver_volume_type": "nvmeof",
+				"data": map[string]any{
+					"target_nqn": "nqn.2014-08.org.cinder:volume",
+					"vol_uuid":   "8ae6ff6e-4ec1-4bbd-a16e-257b3cfbcbcf",
+					"portals": []any{
+						[]any{"10.0.0.1", 4420.0, "tcp"},
+						[]any{"fd00::1", "4420", "RoCEv2"},
+					},
+				},
+			},
+			expected: map[string]string{
+				nvmeofTargetNQNKey:     "nqn.2014-08.org.cinder:volume",
+				nvmeofPortalsKey:       "tcp://10.0.0.1:4420,rdma://[fd00::1]:4420",
+				nvmeofNamespaceUUIDKey: "8ae6ff6e-4ec1-4bbd-a16e-257b3cfbcbcf",
+			},
+		},
+		{
+			name: "legacy",
+			connInfo: map[string]any{
+				"driver_volume_type": "nvmeof",
+				"data": map[string]any{
+					"nqn":            "nqn.2014-08.org.cinder:volume",
+					"target_portal":  "10.0.0.1",
+					"target_port":    4420.0,
+					"transport_type": "nvmet_tcp",
+				},
+			},
+			expected: map[string]string{
+				nvmeofTargetNQNKey:     "nqn.2014-08.org.cinder:volume",
+				nvmeofPortalsKey:       "tcp://10.0.0.1:4420",
+				nvmeofNamespaceUUIDKey: FakeVolID,
+			},
+		},
+		{
+			name: "iscsi",
+			connInfo: map[string]any{
+				"driver_volume_type": "iscsi",
+				"data":               map[string]any{},
+			},
+		},
+		{
+			name: "no portal",
+			connInfo: map[string]any{
+				"driver_volume_type": "nvmeof",
+				"data":               map[string]any{"target_nqn": "nqn.2014-08.org.cinder:volume"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publishContext, err := nvmeofPublishContext(FakeVolID, tt.connInfo)
+			if tt.expected == nil {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, publishContext)
+
+			portals, err := parseNVMeoFPortals(publishContext[nvmeofPortalsKey])
+			assert.NoError(t, err)
+			assert.Equal(t, blockdevice.NVMeoFPortal{Transport: "tcp", Address: "10.0.0.1", Port: "4420"}, portals[0])
+		})
+	}
+}
+
+func TestPublishNVMeoFVolume(t *testing.T) {
+	fakeCs, osmock := fakeControllerServer()
+
+	osmock.On("CreateVolumeAttachment", FakeVolID, FakeNodeID, nvmeofConnector(FakeNodeID)).Return(&attachments.Attachment{
+		ConnectionInfo: map[string]any{"driver_volume_type": "iscsi"},
+	}, nil)
+	osmock.On("DeleteVolumeAttachments", FakeVolID, FakeNodeID).Return(nil)
+
+	// the attachment is deleted when the volume type isn't NVMe-oF
+	_, err := fakeCs.publishNVMeoFVolume(FakeCtx, osmock, FakeVolID, FakeNodeID)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	osmock.AssertCalled(t, "DeleteVolumeAttachments", FakeVolID, FakeNodeID)
+}
@@ -21,17 +21,25 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/gophercloud/gophercloud/v2"
 	"github.com/gophercloud/gophercloud/v2/openstack"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/attachments"
 	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/backups"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/qos"
 	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/snapshots"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/transfers"
 	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumetypes"
 	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
 	"github.com/spf13/pflag"
 	gcfg "gopkg.in/gcfg.v1"
 	"k8s.io/cloud-provider-openstack/pkg/client"
 	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	"k8s.io/cloud-provider-openstack/pkg/util"
 	"k8s.io/cloud-provider-openstack/pkg/util/metadata"
 	"k8s.io/component-base/metrics/legacyregistry"
 	"k8s.io/klog/v2"
@@ -40,9 +48,19 @@ import (
 // userAgentData is used to add extra information to the gophercloud user-agent
 var userAgentData []string
 
+// retryOpts configures the timeout and the retries of the OpenStack API calls
+var retryOpts client.RetryOpts
+
 // AddExtraFlags is called by the main package to add component specific command line flags
 func AddExtraFlags(fs *pflag.FlagSet) {
 	fs.StringArrayVar(&userAgentData, "user-agent", nil, "Extra data to add to gophercloud user-agent. Use multiple times to add more than one component.")
+	fs.DurationVar(&retryOpts.Timeout, "openstack-api-timeout", 0, "Timeout of a single OpenStack API call. Zero means no timeout.")
+	fs.UintVar(&retryOpts.MaxRetries, "openstack-api-max-retries", 0, "Number of times an OpenStack API call is retried when it is rate limited, or when a read-only call fails with a transient error. Zero disables the retries.")
+	fs.DurationVar(&retryOpts.Backoff, "openstack-api-retry-backoff", time.Second, "Delay before the first retry of an OpenStack API call, doubled at each retry.")
+	fs.DurationVar(&retryOpts.MaxBackoff, "openstack-api-max-retry-backoff", 30*time.Second, "Maximum delay between the retries of an OpenStack API call, including the delay requested by the Retry-After header of rate limited calls.")
+	fs.DurationVar(&credentialsReloadInterval, "cloud-config-reload-interval", 0, "Interval the credentials of the cloud config files are checked for changes at, and reloaded without restarting the plugin. Zero disables the reload.")
+	fs.DurationVar(&snapReadyTimeout, "snapshot-ready-timeout", snapReadyTimeout, "How long CreateSnapshot waits for a snapshot to be ready. A snapshot still being created after it is reported as not ready to use, and its status is checked again by csi-snapshotter.")
+	fs.DurationVar(&snapReadyMaxInterval, "snapshot-ready-max-interval", snapReadyMaxInterval, "Maximum interval between the checks of the status of a snapshot being created, which grows exponentially from one second.")
 }
 
 type IOpenStack interface {
@@ -54,6 +72,7 @@ type IOpenStack interface {
 	DetachVolume(ctx context.Context, instanceID, volumeID string) error
 	WaitDiskDetached(ctx context.Context, instanceID string, volumeID string) error
 	WaitVolumeTargetStatus(ctx context.Context, volumeID string, tStatus []string) error
+	WaitVolumeTargetStatusWithTimeout(ctx context.Context, volumeID string, tStatus []string, timeout time.Duration) error
 	GetAttachmentDiskPath(ctx context.Context, instanceID, volumeID string) (string, error)
 	GetVolume(ctx context.Context, volumeID string) (*volumes.Volume, error)
 	GetVolumesByName(ctx context.Context, name string) ([]volumes.Volume, error)
@@ -62,7 +81,7 @@ type IOpenStack interface {
 	ListSnapshots(ctx context.Context, filters map[string]string) ([]snapshots.Snapshot, string, error)
 	DeleteSnapshot(ctx context.Context, snapID string) error
 	GetSnapshotByID(ctx context.Context, snapshotID string) (*snapshots.Snapshot, error)
-	WaitSnapshotReady(ctx context.Context, snapshotID string) (string, error)
+	WaitSnapshotReady(ctx context.Context, snapshotID string, progress func(*snapshots.Snapshot)) (string, error)
 	CreateBackup(ctx context.Context, name, volID, snapshotID, availabilityZone string, tags map[string]string) (*backups.Backup, error)
 	ListBackups(ctx context.Context, filters map[string]string) ([]backups.Backup, error)
 	DeleteBackup(ctx context.Context, backupID string) error
@@ -71,25 +90,136 @@ type IOpenStack interface {
 	WaitBackupReady(ctx context.Context, backupID string, snapshotSize int, backupMaxDurationSecondsPerGB int) (string, error)
 	GetInstanceByID(ctx context.Context, instanceID string) (*servers.Server, error)
 	ExpandVolume(ctx context.Context, volumeID string, status string, size int) error
+	ChangeVolumeType(ctx context.Context, volumeID string, volumeType string, migrationPolicy string) error
 	GetMaxVolLimit() int64
 	GetMetadataOpts() metadata.Opts
 	GetBlockStorageOpts() BlockStorageOpts
 	ResolveVolumeListToUUIDs(ctx context.Context, volumes string) (string, error)
+	GetVolumeTypeEncryption(ctx context.Context, volumeType string) (*volumetypes.GetEncryptionType, error)
+	GetSecretPayload(ctx context.Context, secretID string) ([]byte, error)
+	GetQoSSpecs(ctx context.Context, name string) (*qos.QoS, error)
+	GetVolumeTypeQoSSpecs(ctx context.Context, volumeType string) (*qos.QoS, error)
+	GetVolumeQuota(ctx context.Context, volumeType string) (*VolumeQuota, error)
+	CreateVolumeTransfer(ctx context.Context, volumeID string) (*transfers.Transfer, error)
+	AcceptVolumeTransfer(ctx context.Context, transferID, authKey string) error
+	DeleteVolumeTransfer(ctx context.Context, transferID string) error
+	UpdateVolumeMetadata(ctx context.Context, volumeID string, metadata map[string]string) error
+	CreateVolumeAttachment(ctx context.Context, volumeID, instanceID string, connector map[string]any) (*attachments.Attachment, error)
+	DeleteVolumeAttachments(ctx context.Context, volumeID, instanceID string) error
+	VolumeAttachedByCompute(ctx context.Context, instanceID, volumeID string) (bool, error)
 }
 
 type OpenStack struct {
 	compute      *gophercloud.ServiceClient
 	blockstorage *gophercloud.ServiceClient
+	keymanager   *gophercloud.ServiceClient
 	bsOpts       BlockStorageOpts
 	epOpts       gophercloud.EndpointOpts
 	metadataOpts metadata.Opts
+
+	// the microversions supported by the APIs
+	bsMicroversions      microversions
+	computeMicroversions microversions
 }
 
 type BlockStorageOpts struct {
-	NodeVolumeAttachLimit    int64 `gcfg:"node-volume-attach-limit"`
-	RescanOnResize           bool  `gcfg:"rescan-on-resize"`
-	IgnoreVolumeAZ           bool  `gcfg:"ignore-volume-az"`
-	IgnoreVolumeMicroversion bool  `gcfg:"ignore-volume-microversion"`
+	NodeVolumeAttachLimit     int64    `gcfg:"node-volume-attach-limit"`
+	NodeVolumeAttachLimitAuto bool     `gcfg:"node-volume-attach-limit-auto"`
+	RescanOnResize            bool     `gcfg:"rescan-on-resize"`
+	IgnoreVolumeAZ            bool     `gcfg:"ignore-volume-az"`
+	IgnoreVolumeMicroversion  bool     `gcfg:"ignore-volume-microversion"`
+	AvailabilityZoneMap       []string `gcfg:"availability-zone-map"`
+	// Options of the devices of the volumes on the nodes
+	NodeMultipath            bool            `gcfg:"node-multipath"`
+	NodeDeviceCleanup        bool            `gcfg:"node-device-cleanup"`
+	NodeDeviceScanTimeout    util.MyDuration `gcfg:"node-device-scan-timeout"`
+	NodeDeviceCleanupTimeout util.MyDuration `gcfg:"node-device-cleanup-timeout"`
+	// NodeDevicePollInterval is the interval the nodes scan for the devices
+	// of the attached volumes at
+	NodeDevicePollInterval util.MyDuration `gcfg:"node-device-poll-interval"`
+	// NodeUdevSettle waits for udev to process the events of each scan
+	NodeUdevSettle bool `gcfg:"node-udev-settle"`
+	// NodeDevicePathType is the type of the links the devices are staged
+	// with, by-id or by-path
+	NodeDevicePathType string `gcfg:"node-device-path-type"`
+	// NodeFsRepairTimeout bounds the repair of the file systems of the
+	// volumes with the fs-repair parameter
+	NodeFsRepairTimeout util.MyDuration `gcfg:"node-fs-repair-timeout"`
+	// NVMeoFVolumeTypes are the volume types of the NVMe-oF backends, whose
+	// volumes are connected by the nodes instead of being attached by Nova
+	NVMeoFVolumeTypes []string `gcfg:"nvmeof-volume-types"`
+	// LocalAttachVolumeTypes are the volume types of the backends sharing
+	// the hosts of the nodes, whose volumes are connected locally by the
+	// nodes when the backend allows it, instead of being attached by Nova
+	LocalAttachVolumeTypes []string `gcfg:"local-attach-volume-types"`
+	// QuotaPreflight checks the quotas of the project before creating the
+	// volumes and the snapshots, so that they fail fast when exceeded
+	QuotaPreflight bool `gcfg:"quota-preflight"`
+
+	// azMap maps the Nova AZs to the Cinder AZs, parsed from
+	// AvailabilityZoneMap by ParseAvailabilityZoneMap
+	azMap map[string]string
+}
+
+// The types of the links of the devices of the volumes on the nodes
+const (
+	DevicePathTypeByID   = "by-id"
+	DevicePathTypeByPath = "by-path"
+)
+
+// parseAvailabilityZoneMap parses the "<compute AZ>:<volume AZ>" entries of
+// the availability-zone-map option.
+func parseAvailabilityZoneMap(entries []string) (map[string]string, error) {
+	azMap := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		computeAZ, volumeAZ, ok := strings.Cut(entry, ":")
+		computeAZ, volumeAZ = strings.TrimSpace(computeAZ), strings.TrimSpace(volumeAZ)
+		if !ok || computeAZ == "" || volumeAZ == "" {
+			return nil, fmt.Errorf("invalid availability-zone-map entry %q, expected <compute AZ>:<volume AZ>", entry)
+		}
+		azMap[computeAZ] = volumeAZ
+	}
+	return azMap, nil
+}
+
+// ParseAvailabilityZoneMap parses the availability-zone-map option once, for
+// VolumeAZ and ComputeAZs to use the parsed map.
+func (o *BlockStorageOpts) ParseAvailabilityZoneMap() error {
+	if len(o.AvailabilityZoneMap) == 0 {
+		return nil
+	}
+	azMap, err := parseAvailabilityZoneMap(o.AvailabilityZoneMap)
+	if err != nil {
+		return err
+	}
+	o.azMap = azMap
+	return nil
+}
+
+// VolumeAZ returns the Cinder AZ the volumes accessible from the given Nova AZ
+// must be created in.
+func (o BlockStorageOpts) VolumeAZ(computeAZ string) string {
+	if volumeAZ, ok := o.azMap[computeAZ]; ok {
+		return volumeAZ
+	}
+	return computeAZ
+}
+
+// ComputeAZs returns the Nova AZs the volumes of the given Cinder AZ are
+// accessible from. A Cinder AZ which is not mapped is accessible from the Nova
+// AZ with the same name.
+func (o BlockStorageOpts) ComputeAZs(volumeAZ string) []string {
+	var computeAZs []string
+	for computeAZ, az := range o.azMap {
+		if az == volumeAZ {
+			computeAZs = append(computeAZs, computeAZ)
+		}
+	}
+	if len(computeAZs) == 0 {
+		return []string{volumeAZ}
+	}
+	sort.Strings(computeAZs)
+	return computeAZs
 }
 
 type Config struct {
@@ -127,6 +257,19 @@ func GetConfigFromFiles(configFilePaths []string) (Config, error) {
 		}
 	}
 
+	if err := cfg.BlockStorage.ParseAvailabilityZoneMap(); err != nil {
+		klog.Errorf("Failed to read OpenStack configuration file: %v", err)
+		return cfg, err
+	}
+
+	switch cfg.BlockStorage.NodeDevicePathType {
+	case "", DevicePathTypeByID, DevicePathTypeByPath:
+	default:
+		err := fmt.Errorf("invalid node-device-path-type %q, must be %s or %s", cfg.BlockStorage.NodeDevicePathType, DevicePathTypeByID, DevicePathTypeByPath)
+		klog.Errorf("Failed to read OpenStack configuration file: %v", err)
+		return cfg, err
+	}
+
 	for _, global := range cfg.Global {
 		// Update the config with data from clouds.yaml if UseClouds is enabled
 		if global.UseClouds {
@@ -168,6 +311,10 @@ func InitOpenStackProvider(cfgFiles []string, httpEndpoint string) {
 
 	configFiles = cfgFiles
 	klog.V(2).Infof("InitOpenStackProvider configFiles: %s", configFiles)
+
+	if credentialsReloadInterval > 0 {
+		go watchCredentials(context.Background(), credentialsReloadInterval)
+	}
 }
 
 // CreateOpenStackProvider creates Openstack Instance with custom Global config param
@@ -193,6 +340,7 @@ func CreateOpenStackProvider(cloudName string) (IOpenStack, error) {
 	if err != nil {
 		return nil, err
 	}
+	client.SetRetryOpts(provider, retryOpts)
 
 	epOpts := gophercloud.EndpointOpts{
 		Region:       global.Region,
@@ -211,10 +359,20 @@ func CreateOpenStackProvider(cloudName string) (IOpenStack, error) {
 		return nil, err
 	}
 
+	// Init Barbican ServiceClient, used to get the LUKS keys of the nodes
+	keymanagerclient, err := openstack.NewKeyManagerV1(provider, epOpts)
+	if err != nil {
+		klog.V(4).Infof("Key manager service is not available: %v", err)
+		keymanagerclient = nil
+	}
+
+	registerCredentials(cloudName, global, provider, blockstorageclient.Endpoint)
+
 	// Init OpenStack
 	OsInstances[cloudName] = &OpenStack{
 		compute:      computeclient,
 		blockstorage: blockstorageclient,
+		keymanager:   keymanagerclient,
 		bsOpts:       cfg.BlockStorage,
 		epOpts:       epOpts,
 		metadataOpts: cfg.Metadata,
@@ -0,0 +1,170 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package openstack attachments provides the attachments of the Cinder volumes
+// which are connected by the servers themselves, instead of being attached by
+// Nova, using Gophercloud.
+package openstack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/attachments"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/volumeattach"
+	"github.com/gophercloud/gophercloud/v2/pagination"
+	"k8s.io/klog/v2"
+
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	cpoerrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
+)
+
+// attachmentsClient returns a Cinder ServiceClient with the microversion of
+// the attachments API.
+func (os *OpenStack) attachmentsClient(ctx context.Context) (*gophercloud.ServiceClient, error) {
+	if err := os.requireBlockStorageMicroversion(ctx, "direct volume attachment", microversionAttachments); err != nil {
+		return nil, err
+	}
+
+	// Init a local thread safe copy of the Cinder ServiceClient
+	client, err := openstack.NewBlockStorageV3(os.blockstorage.ProviderClient, os.epOpts)
+	if err != nil {
+		return nil, err
+	}
+	client.Microversion = microversionAttachments
+	return client, nil
+}
+
+// CreateVolumeAttachment attaches the volume to the server with the given
+// connector, and returns the attachment with the connection info the server
+// connects to the volume with. The existing attachment of the volume to the
+// server is returned if there is one.
+func (os *OpenStack) CreateVolumeAttachment(ctx context.Context, volumeID, instanceID string, connector map[string]any) (*attachments.Attachment, error) {
+	client, err := os.attachmentsClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := listVolumeAttachments(ctx, client, volumeID, instanceID)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range existing {
+		if a.Status != "attached" {
+			continue
+		}
+		klog.V(4).Infof("Volume %s is already attached to instance %s with attachment %s", volumeID, instanceID, a.ID)
+		mc := metrics.NewMetricContext("volume_attachment", "get")
+		attachment, err := attachments.Get(ctx, client, a.ID).Extract()
+		if mc.ObserveRequest(err) != nil {
+			return nil, err
+		}
+		return attachment, nil
+	}
+
+	// the attachments left reserved, e.g. by a restart of the controller
+	// before completing them, or by a failed delete, keep the volume reserved
+	for _, a := range existing {
+		klog.V(4).Infof("Deleting stale %s attachment %s of volume %s to instance %s", a.Status, a.ID, volumeID, instanceID)
+		mc := metrics.NewMetricContext("volume_attachment", "delete")
+		if err := mc.ObserveRequest(attachments.Delete(ctx, client, a.ID).ExtractErr()); err != nil && !cpoerrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to delete stale attachment %s of volume %s: %v", a.ID, volumeID, err)
+		}
+	}
+
+	opts := attachments.CreateOpts{
+		VolumeUUID:   volumeID,
+		InstanceUUID: instanceID,
+		Connector:    connector,
+	}
+	mc := metrics.NewMetricContext("volume_attachment", "create")
+	attachment, err := attachments.Create(ctx, client, opts).Extract()
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+
+	// the volume is in-use once the attachment is completed
+	mc = metrics.NewMetricContext("volume_attachment", "complete")
+	if err := mc.ObserveRequest(attachments.Complete(ctx, client, attachment.ID).ExtractErr()); err != nil {
+		// the attachment stays reserved otherwise, and every retry would
+		// reserve another one
+		mc := metrics.NewMetricContext("volume_attachment", "delete")
+		if delErr := mc.ObserveRequest(attachments.Delete(ctx, client, attachment.ID).ExtractErr()); delErr != nil && !cpoerrors.IsNotFound(delErr) {
+			klog.Errorf("Failed to delete attachment %s of volume %s to instance %s: %v", attachment.ID, volumeID, instanceID, delErr)
+		}
+		return nil, err
+	}
+	return attachment, nil
+}
+
+// DeleteVolumeAttachments deletes the attachments of the volume to the server
+func (os *OpenStack) DeleteVolumeAttachments(ctx context.Context, volumeID, instanceID string) error {
+	client, err := os.attachmentsClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	existing, err := listVolumeAttachments(ctx, client, volumeID, instanceID)
+	if err != nil {
+		return err
+	}
+	for _, a := range existing {
+		klog.V(4).Infof("Deleting attachment %s of volume %s to instance %s", a.ID, volumeID, instanceID)
+		mc := metrics.NewMetricContext("volume_attachment", "delete")
+		if err := mc.ObserveRequest(attachments.Delete(ctx, client, a.ID).ExtractErr()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VolumeAttachedByCompute returns true if the volume is attached to the server
+// by Nova, and false if it is not attached or only attached with the Cinder
+// attachments API.
+func (os *OpenStack) VolumeAttachedByCompute(ctx context.Context, instanceID, volumeID string) (bool, error) {
+	mc := metrics.NewMetricContext("server_volume_attachment", "get")
+	_, err := volumeattach.Get(ctx, os.compute, instanceID, volumeID).Extract()
+	if mc.ObserveRequest(err) != nil {
+		if cpoerrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func listVolumeAttachments(ctx context.Context, client *gophercloud.ServiceClient, volumeID, instanceID string) ([]attachments.Attachment, error) {
+	var list []attachments.Attachment
+	opts := attachments.ListOpts{
+		VolumeID:   volumeID,
+		InstanceID: instanceID,
+	}
+	mc := metrics.NewMetricContext("volume_attachment", "list")
+	err := attachments.List(client, opts).EachPage(ctx, func(_ context.Context, page pagination.Page) (bool, error) {
+		l, err := attachments.ExtractAttachments(page)
+		if err != nil {
+			return false, err
+		}
+		list = append(list, l...)
+		return true, nil
+	})
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+	return list, nil
+}
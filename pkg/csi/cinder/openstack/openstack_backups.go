@@ -38,6 +38,8 @@ const (
 	backupDescription                    = "Created by OpenStack Cinder CSI driver"
 	BackupMaxDurationSecondsPerGBDefault = 20
 	BackupMaxDurationPerGB               = "backup-max-duration-seconds-per-gb"
+	BackupIncremental                    = "incremental"
+	BackupContainer                      = "container"
 	backupBaseDurationSeconds            = 30
 	backupReadyCheckIntervalSeconds      = 7
 )
@@ -62,18 +64,52 @@ func (os *OpenStack) CreateBackup(ctx context.Context, name, volID, snapshotID,
 		delete(tags, SnapshotForceCreate)
 	}
 
+	// incremental backups only store the blocks changed since the latest
+	// backup of the volume, a full backup is created if there is none
+	incremental := false
+	if item, ok := (tags)[BackupIncremental]; ok {
+		var err error
+		incremental, err = strconv.ParseBool(item)
+		if err != nil {
+			klog.V(5).Infof("Make incremental flag to false due to: %v", err)
+		}
+		delete(tags, BackupIncremental)
+	}
+	if incremental {
+		// Cinder rejects the incremental backups of the volumes without an
+		// available backup
+		existing, err := os.ListBackups(ctx, map[string]string{"VolumeID": volID, "Status": "available"})
+		if err != nil {
+			return &backups.Backup{}, fmt.Errorf("failed to list the backups of volume %s: %v", volID, err)
+		}
+		if len(existing) == 0 {
+			klog.V(4).Infof("Volume %s has no available backup, creating a full backup instead of an incremental one", volID)
+			incremental = false
+		}
+	}
+
+	// the object storage container the backup is stored in, the backup
+	// service default is used when empty
+	container := tags[BackupContainer]
+	delete(tags, BackupContainer)
+
 	opts := &backups.CreateOpts{
 		VolumeID:         volID,
 		SnapshotID:       snapshotID,
 		Name:             name,
 		Force:            force,
+		Incremental:      incremental,
+		Container:        container,
 		Description:      backupDescription,
 		AvailabilityZone: availabilityZone,
 	}
 
 	if tags != nil {
 		// Set openstack microversion to 3.51 to send metadata along with the backup
-		blockstorageServiceClient.Microversion = "3.51"
+		if err := os.bsMicroversions.require(ctx, os.blockstorage, "backup metadata", microversionBackupRestore); err != nil {
+			return &backups.Backup{}, err
+		}
+		blockstorageServiceClient.Microversion = microversionBackupRestore
 		opts.Metadata = tags
 	}
 
@@ -0,0 +1,154 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package openstack capacity provides the capacity available to the Cinder
+// volumes using Gophercloud.
+package openstack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/quotasets"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/tokens"
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+)
+
+// UnlimitedQuota is the value of the quotas which are not limited
+const UnlimitedQuota = -1
+
+// VolumeQuota is the capacity left in the Cinder quotas of the project
+type VolumeQuota struct {
+	// AvailableGB is the size of the volumes which can still be created, or
+	// UnlimitedQuota
+	AvailableGB int
+	// MaxVolumeSizeGB is the maximum size of a single volume, or
+	// UnlimitedQuota
+	MaxVolumeSizeGB int
+	// AvailableVolumes is the number of volumes which can still be created,
+	// or UnlimitedQuota
+	AvailableVolumes int
+	// AvailableSnapshots is the number of snapshots which can still be
+	// created, or UnlimitedQuota
+	AvailableSnapshots int
+}
+
+// remainingQuota returns the quota left, or UnlimitedQuota.
+func remainingQuota(usage quotasets.QuotaUsage) int {
+	if usage.Limit < 0 {
+		return UnlimitedQuota
+	}
+	return max(usage.Limit-usage.InUse-usage.Reserved, 0)
+}
+
+// minQuota returns the smallest of the quotas, ignoring the unlimited ones.
+func minQuota(a, b int) int {
+	if a == UnlimitedQuota {
+		return b
+	}
+	if b == UnlimitedQuota {
+		return a
+	}
+	return min(a, b)
+}
+
+// getProjectID returns the ID of the project the client is scoped to.
+func (os *OpenStack) getProjectID() (string, error) {
+	result, ok := os.blockstorage.ProviderClient.GetAuthResult().(tokens.CreateResult)
+	if !ok {
+		return "", fmt.Errorf("the project of the client is unknown")
+	}
+	project, err := result.ExtractProject()
+	if err != nil {
+		return "", err
+	}
+	if project == nil {
+		return "", fmt.Errorf("the client is not scoped to a project")
+	}
+	return project.ID, nil
+}
+
+// GetVolumeQuota returns the capacity left in the quotas of the project for
+// the volumes of the given volume type. The quota of the volume type is only
+// taken into account when a volume type is given.
+func (os *OpenStack) GetVolumeQuota(ctx context.Context, volumeType string) (*VolumeQuota, error) {
+	projectID, err := os.getProjectID()
+	if err != nil {
+		return nil, err
+	}
+
+	// the quotas of the volume types are not part of quotasets.QuotaUsageSet
+	var body struct {
+		QuotaSet map[string]json.RawMessage `json:"quota_set"`
+	}
+	mc := metrics.NewMetricContext("quota", "get")
+	err = quotasets.GetUsage(ctx, os.blockstorage, projectID).ExtractInto(&body)
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+
+	usage := func(key string) (quotasets.QuotaUsage, error) {
+		u := quotasets.QuotaUsage{Limit: UnlimitedQuota}
+		if raw, ok := body.QuotaSet[key]; ok {
+			if err := json.Unmarshal(raw, &u); err != nil {
+				return u, fmt.Errorf("failed to parse the %s quota: %v", key, err)
+			}
+		}
+		return u, nil
+	}
+
+	// remaining returns the quota left of the project, and of the volume
+	// type if any
+	remaining := func(key string) (int, error) {
+		u, err := usage(key)
+		if err != nil {
+			return 0, err
+		}
+		left := remainingQuota(u)
+		if volumeType != "" {
+			typeUsage, err := usage(key + "_" + volumeType)
+			if err != nil {
+				return 0, err
+			}
+			left = minQuota(left, remainingQuota(typeUsage))
+		}
+		return left, nil
+	}
+
+	perVolume, err := usage("per_volume_gigabytes")
+	if err != nil {
+		return nil, err
+	}
+	quota := &VolumeQuota{
+		MaxVolumeSizeGB: perVolume.Limit,
+	}
+	if perVolume.Limit < 0 {
+		quota.MaxVolumeSizeGB = UnlimitedQuota
+	}
+
+	if quota.AvailableGB, err = remaining("gigabytes"); err != nil {
+		return nil, err
+	}
+	if quota.AvailableVolumes, err = remaining("volumes"); err != nil {
+		return nil, err
+	}
+	if quota.AvailableSnapshots, err = remaining("snapshots"); err != nil {
+		return nil, err
+	}
+
+	return quota, nil
+}
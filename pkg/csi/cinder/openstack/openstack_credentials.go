@@ -0,0 +1,172 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	"k8s.io/cloud-provider-openstack/pkg/client"
+)
+
+// credentialsReloadInterval is the interval the credentials of the
+// configuration files are checked for changes at. Zero disables the reload.
+var credentialsReloadInterval time.Duration
+
+// credentials authenticates the provider client of a cloud with the
+// credentials of the configuration files. When they change, e.g. when the
+// mounted Secret holding them is rotated, the provider client authenticates
+// with the new credentials, without recreating the service clients.
+type credentials struct {
+	provider *gophercloud.ProviderClient
+	// endpoint of the Block Storage API, which must not change
+	endpoint string
+
+	mu     sync.Mutex
+	global client.AuthOpts
+
+	// reauth authenticates with the current credentials
+	reauth atomic.Pointer[func(context.Context) error]
+}
+
+var (
+	credentialsMu    sync.Mutex
+	cloudCredentials = make(map[string]*credentials)
+)
+
+// registerCredentials registers the credentials the provider client of the
+// cloud is authenticated with, so that they are reloaded on change.
+func registerCredentials(cloudName string, global *client.AuthOpts, provider *gophercloud.ProviderClient, endpoint string) {
+	if provider.ReauthFunc == nil {
+		klog.V(4).Infof("Credentials of cloud %q can't be reloaded, the provider client doesn't re-authenticate", cloudName)
+		return
+	}
+
+	c := &credentials{
+		provider: provider,
+		endpoint: endpoint,
+		global:   *global,
+	}
+	reauth := provider.ReauthFunc
+	c.reauth.Store(&reauth)
+	// must be set before the provider client is used, as gophercloud
+	// doesn't guard it
+	provider.ReauthFunc = c.reauthenticate
+
+	credentialsMu.Lock()
+	defer credentialsMu.Unlock()
+	cloudCredentials[cloudName] = c
+}
+
+func (c *credentials) reauthenticate(ctx context.Context) error {
+	return (*c.reauth.Load())(ctx)
+}
+
+// reload authenticates the provider client with the given credentials, if
+// they changed. The credentials are checked by authenticating with them first,
+// so that the current ones are kept if the new ones are invalid.
+func (c *credentials) reload(cloudName string, global *client.AuthOpts) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if *global == c.global {
+		return nil
+	}
+	klog.Infof("Credentials of cloud %q changed, authenticating with the new credentials", cloudName)
+
+	provider, err := client.NewOpenStackClient(global, "cinder-csi-plugin", userAgentData...)
+	if err != nil {
+		return fmt.Errorf("failed to authenticate with the new credentials: %v", err)
+	}
+	bs, err := openstack.NewBlockStorageV3(provider, gophercloud.EndpointOpts{
+		Region:       global.Region,
+		Availability: global.EndpointType,
+	})
+	if err != nil {
+		return err
+	}
+	if bs.Endpoint != c.endpoint {
+		return fmt.Errorf("endpoint of the Block Storage API changed from %s to %s with the new credentials, restart the plugin to use it", c.endpoint, bs.Endpoint)
+	}
+
+	c.rotate(provider)
+	c.global = *global
+	klog.Infof("Credentials of cloud %q are reloaded", cloudName)
+	return nil
+}
+
+// rotate replaces the token of the provider client with the token of the
+// given provider client, authenticated with the new credentials, and
+// re-authenticates with the new credentials from now on.
+func (c *credentials) rotate(provider *gophercloud.ProviderClient) {
+	reauth := func(ctx context.Context) error {
+		if err := provider.Reauthenticate(ctx, provider.Token()); err != nil {
+			return err
+		}
+		c.provider.CopyTokenFrom(provider)
+		return nil
+	}
+	c.reauth.Store(&reauth)
+	c.provider.CopyTokenFrom(provider)
+}
+
+// reloadCredentials reloads the credentials of the clouds from the
+// configuration files.
+func reloadCredentials() {
+	credentialsMu.Lock()
+	clouds := make(map[string]*credentials, len(cloudCredentials))
+	for name, c := range cloudCredentials {
+		clouds[name] = c
+	}
+	credentialsMu.Unlock()
+	if len(clouds) == 0 {
+		return
+	}
+
+	cfg, err := GetConfigFromFiles(configFiles)
+	if err != nil {
+		klog.Errorf("Failed to reload the credentials from %s: %v", configFiles, err)
+		return
+	}
+	for name, c := range clouds {
+		global := cfg.Global[name]
+		if global == nil {
+			klog.Errorf("Failed to reload the credentials of cloud %q: not found in configuration files %s", name, configFiles)
+			continue
+		}
+		if err := c.reload(name, global); err != nil {
+			klog.Errorf("Failed to reload the credentials of cloud %q, keeping the current ones: %v", name, err)
+		}
+	}
+}
+
+// watchCredentials reloads the credentials at every interval, until the
+// context is done.
+func watchCredentials(ctx context.Context, interval time.Duration) {
+	klog.Infof("Reloading the credentials from %s every %s", configFiles, interval)
+	wait.UntilWithContext(ctx, func(context.Context) {
+		reloadCredentials()
+	}, interval)
+}
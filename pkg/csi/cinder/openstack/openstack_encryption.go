@@ -0,0 +1,102 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package openstack encryption provides an implementation of Cinder volume
+// encryption features using Gophercloud.
+package openstack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumetypes"
+	"github.com/gophercloud/gophercloud/v2/openstack/keymanager/v1/secrets"
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	cpoerrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
+)
+
+const (
+	VolumeEncrypted                 = "encrypted"
+	VolumeEncryptionProvider        = "encryption-provider"
+	VolumeEncryptionCipher          = "encryption-cipher"
+	VolumeEncryptionKeySize         = "encryption-key-size"
+	VolumeEncryptionControlLocation = "encryption-control-location"
+)
+
+// getVolumeType returns the volume type with the given name or ID.
+func (os *OpenStack) getVolumeType(ctx context.Context, volumeType string) (*volumetypes.VolumeType, error) {
+	mc := metrics.NewMetricContext("volume_type", "list")
+	allPages, err := volumetypes.List(os.blockstorage, volumetypes.ListOpts{IsPublic: volumetypes.VisibilityDefault}).AllPages(ctx)
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+
+	types, err := volumetypes.ExtractVolumeTypes(allPages)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range types {
+		if t.ID == volumeType || t.Name == volumeType {
+			return &t, nil
+		}
+	}
+	return nil, cpoerrors.ErrNotFound
+}
+
+// getVolumeTypeID returns the ID of the volume type with the given name or ID.
+func (os *OpenStack) getVolumeTypeID(ctx context.Context, volumeType string) (string, error) {
+	vt, err := os.getVolumeType(ctx, volumeType)
+	if err != nil {
+		return "", err
+	}
+	return vt.ID, nil
+}
+
+// GetVolumeTypeEncryption returns the encryption of the volume type with the
+// given name or ID, or nil if the volume type is not encrypted.
+func (os *OpenStack) GetVolumeTypeEncryption(ctx context.Context, volumeType string) (*volumetypes.GetEncryptionType, error) {
+	typeID, err := os.getVolumeTypeID(ctx, volumeType)
+	if err != nil {
+		return nil, err
+	}
+
+	mc := metrics.NewMetricContext("volume_type_encryption", "get")
+	encryption, err := volumetypes.GetEncryption(ctx, os.blockstorage, typeID).Extract()
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+
+	if encryption.EncryptionID == "" {
+		return nil, nil
+	}
+	return encryption, nil
+}
+
+// GetSecretPayload returns the payload of the key manager secret with the
+// given ID.
+func (os *OpenStack) GetSecretPayload(ctx context.Context, secretID string) ([]byte, error) {
+	if os.keymanager == nil {
+		return nil, fmt.Errorf("key manager client is not initialized")
+	}
+
+	mc := metrics.NewMetricContext("secret_payload", "get")
+	payload, err := secrets.GetPayload(ctx, os.keymanager, secretID, nil).Extract()
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+	return payload, nil
+}
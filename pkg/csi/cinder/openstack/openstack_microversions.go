@@ -0,0 +1,141 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/utils"
+	"k8s.io/klog/v2"
+
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	cpoerrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
+)
+
+// The microversions the optional features require
+// https://docs.openstack.org/cinder/latest/contributor/api_microversion_history.html
+// https://docs.openstack.org/nova/latest/reference/api-microversion-history.html
+const (
+	// online resize of in-use volumes
+	microversionOnlineResize = "3.42"
+	// creation of volumes from backups in another availability zone, and
+	// backups with metadata
+	microversionBackupRestore = "3.51"
+	// attachments API, used to connect the nodes to the volumes directly
+	microversionAttachments = "3.44"
+	// filtering and sorting of the user messages, which tell why the
+	// asynchronous operations failed
+	microversionMessages = "3.5"
+	// attachment of multiattach volumes to several servers
+	microversionMultiattach = "2.60"
+)
+
+// microversionsRetryInterval is the interval the failed discoveries of the
+// microversions are retried at
+var microversionsRetryInterval = time.Minute
+
+// microversions caches the range of the microversions supported by the API
+// of a service, which is discovered on first use.
+type microversions struct {
+	mu        sync.Mutex
+	supported *utils.SupportedMicroversions
+	// failedAt is the time of the last failed discovery
+	failedAt time.Time
+}
+
+// require returns an error if the API of the service doesn't support the
+// microversion the feature requires. The feature is assumed to be supported
+// if the microversions can't be discovered, so that the API returns the error.
+func (m *microversions) require(ctx context.Context, client *gophercloud.ServiceClient, feature, version string) error {
+	supported := m.get(ctx, client)
+	if supported == nil {
+		return nil
+	}
+
+	ok, err := supported.IsSupported(version)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.Join(fmt.Errorf("%s requires microversion %s of %s, which supports microversions %d.%d to %d.%d",
+			feature, version, client.Type, supported.MinMajor, supported.MinMinor, supported.MaxMajor, supported.MaxMinor), cpoerrors.ErrMicroversionNotSupported)
+	}
+	return nil
+}
+
+// get returns the supported microversions, or nil if they couldn't be
+// discovered. Only the successful discovery is cached, a failed one is
+// retried after microversionsRetryInterval.
+func (m *microversions) get(ctx context.Context, client *gophercloud.ServiceClient) *utils.SupportedMicroversions {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.supported != nil {
+		return m.supported
+	}
+	if !m.failedAt.IsZero() && time.Since(m.failedAt) < microversionsRetryInterval {
+		return nil
+	}
+
+	supported, err := discoverMicroversions(ctx, client)
+	if err != nil {
+		klog.Warningf("Failed to discover the microversions of %s, the optional features are assumed to be supported until the next discovery in %s: %v", client.Type, microversionsRetryInterval, err)
+		m.failedAt = time.Now()
+		return nil
+	}
+
+	klog.V(2).Infof("%s supports microversions %d.%d to %d.%d", client.Type, supported.MinMajor, supported.MinMinor, supported.MaxMajor, supported.MaxMinor)
+	m.supported = &supported
+	return m.supported
+}
+
+// discoverMicroversions returns the microversions supported by the API, which
+// are given by the version document of the endpoint without the project ID.
+func discoverMicroversions(ctx context.Context, client *gophercloud.ServiceClient) (utils.SupportedMicroversions, error) {
+	endpoint, err := utils.BaseVersionedEndpoint(client.Endpoint)
+	if err != nil {
+		return utils.SupportedMicroversions{}, err
+	}
+	sc := *client
+	sc.Endpoint = endpoint
+
+	mc := metrics.NewMetricContext("microversions", "get")
+	supported, err := utils.GetSupportedMicroversions(ctx, &sc)
+	return supported, mc.ObserveRequest(err)
+}
+
+// requireBlockStorageMicroversion returns an error if the feature can't be
+// used with the Block Storage API, either because the microversions are
+// disabled with the ignore-volume-microversion option or because the API
+// doesn't support the microversion.
+func (os *OpenStack) requireBlockStorageMicroversion(ctx context.Context, feature, version string) error {
+	if os.bsOpts.IgnoreVolumeMicroversion {
+		return errors.Join(fmt.Errorf("%s is not available with ignore-volume-microversion, requires microversion %s or newer", feature, version), cpoerrors.ErrMicroversionNotSupported)
+	}
+	return os.bsMicroversions.require(ctx, os.blockstorage, feature, version)
+}
+
+// requireComputeMicroversion returns an error if the Compute API doesn't
+// support the microversion the feature requires.
+func (os *OpenStack) requireComputeMicroversion(ctx context.Context, feature, version string) error {
+	return os.computeMicroversions.require(ctx, os.compute, feature, version)
+}
@@ -19,10 +19,15 @@ package openstack
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/attachments"
 	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/backups"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/qos"
 	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/snapshots"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/transfers"
 	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumetypes"
 	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
 	"github.com/stretchr/testify/mock"
 	"k8s.io/cloud-provider-openstack/pkg/util/errors"
@@ -186,6 +191,20 @@ func (_m *OpenStackMock) WaitDiskAttached(ctx context.Context, instanceID string
 	return r0
 }
 
+// WaitVolumeTargetStatusWithTimeout provides a mock function with given fields: volumeID, tStatus, timeout
+func (_m *OpenStackMock) WaitVolumeTargetStatusWithTimeout(ctx context.Context, volumeID string, tStatus []string, timeout time.Duration) error {
+	ret := _m.Called(volumeID, tStatus, timeout)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, []string, time.Duration) error); ok {
+		r0 = rf(volumeID, tStatus, timeout)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // WaitVolumeTargetStatus provides a mock function with given fields: volumeID, tStatus
 func (_m *OpenStackMock) WaitVolumeTargetStatus(ctx context.Context, volumeID string, tStatus []string) error {
 	ret := _m.Called(volumeID, tStatus)
@@ -442,7 +461,7 @@ func (_m *OpenStackMock) GetSnapshotByID(ctx context.Context, snapshotID string)
 	return &fakeSnapshot, nil
 }
 
-func (_m *OpenStackMock) WaitSnapshotReady(ctx context.Context, snapshotID string) (string, error) {
+func (_m *OpenStackMock) WaitSnapshotReady(ctx context.Context, snapshotID string, progress func(*snapshots.Snapshot)) (string, error) {
 	ret := _m.Called(snapshotID)
 
 	var r0 string
@@ -496,7 +515,7 @@ func (_m *OpenStackMock) BackupsAreEnabled() (bool, error) {
 }
 
 func (_m *OpenStackMock) GetInstanceByID(ctx context.Context, instanceID string) (*servers.Server, error) {
-	return nil, nil
+	return &servers.Server{ID: instanceID, AvailabilityZone: "nova"}, nil
 }
 
 // ExpandVolume provides a mock function with given fields: instanceID, volumeID
@@ -529,3 +548,113 @@ func (_m *OpenStackMock) GetBlockStorageOpts() BlockStorageOpts {
 func (_m *OpenStackMock) ResolveVolumeListToUUIDs(ctx context.Context, v string) (string, error) {
 	return v, nil
 }
+
+// GetVolumeTypeEncryption provides a mock function with given fields: volumeType
+func (_m *OpenStackMock) GetVolumeTypeEncryption(ctx context.Context, volumeType string) (*volumetypes.GetEncryptionType, error) {
+	ret := _m.Called(volumeType)
+
+	var r0 *volumetypes.GetEncryptionType
+	if rf, ok := ret.Get(0).(func(string) *volumetypes.GetEncryptionType); ok {
+		r0 = rf(volumeType)
+	} else if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*volumetypes.GetEncryptionType)
+	}
+
+	return r0, ret.Error(1)
+}
+
+// GetSecretPayload provides a mock function with given fields: secretID
+func (_m *OpenStackMock) GetSecretPayload(ctx context.Context, secretID string) ([]byte, error) {
+	ret := _m.Called(secretID)
+	return ret.Get(0).([]byte), ret.Error(1)
+}
+
+// GetQoSSpecs provides a mock function with given fields: name
+func (_m *OpenStackMock) GetQoSSpecs(ctx context.Context, name string) (*qos.QoS, error) {
+	ret := _m.Called(name)
+
+	var r0 *qos.QoS
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*qos.QoS)
+	}
+
+	return r0, ret.Error(1)
+}
+
+// GetVolumeTypeQoSSpecs provides a mock function with given fields: volumeType
+func (_m *OpenStackMock) GetVolumeTypeQoSSpecs(ctx context.Context, volumeType string) (*qos.QoS, error) {
+	ret := _m.Called(volumeType)
+
+	var r0 *qos.QoS
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*qos.QoS)
+	}
+
+	return r0, ret.Error(1)
+}
+
+// GetVolumeQuota provides a mock function with given fields: volumeType
+func (_m *OpenStackMock) GetVolumeQuota(ctx context.Context, volumeType string) (*VolumeQuota, error) {
+	ret := _m.Called(volumeType)
+
+	var r0 *VolumeQuota
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*VolumeQuota)
+	}
+
+	return r0, ret.Error(1)
+}
+
+// ChangeVolumeType provides a mock function with given fields: volumeID, volumeType, migrationPolicy
+func (_m *OpenStackMock) ChangeVolumeType(ctx context.Context, volumeID string, volumeType string, migrationPolicy string) error {
+	ret := _m.Called(volumeID, volumeType, migrationPolicy)
+	return ret.Error(0)
+}
+
+// CreateVolumeTransfer provides a mock function with given fields: volumeID
+func (_m *OpenStackMock) CreateVolumeTransfer(ctx context.Context, volumeID string) (*transfers.Transfer, error) {
+	ret := _m.Called(volumeID)
+
+	var r0 *transfers.Transfer
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*transfers.Transfer)
+	}
+
+	return r0, ret.Error(1)
+}
+
+// AcceptVolumeTransfer provides a mock function with given fields: transferID, authKey
+func (_m *OpenStackMock) AcceptVolumeTransfer(ctx context.Context, transferID string, authKey string) error {
+	ret := _m.Called(transferID, authKey)
+	return ret.Error(0)
+}
+
+// UpdateVolumeMetadata provides a mock function with given fields: volumeID, metadata
+func (_m *OpenStackMock) UpdateVolumeMetadata(ctx context.Context, volumeID string, metadata map[string]string) error {
+	ret := _m.Called(volumeID, metadata)
+	return ret.Error(0)
+}
+
+// DeleteVolumeTransfer provides a mock function with given fields: transferID
+func (_m *OpenStackMock) DeleteVolumeTransfer(ctx context.Context, transferID string) error {
+	ret := _m.Called(transferID)
+	return ret.Error(0)
+}
+
+// CreateVolumeAttachment provides a mock function with given fields: volumeID, instanceID, connector
+func (_m *OpenStackMock) CreateVolumeAttachment(ctx context.Context, volumeID, instanceID string, connector map[string]any) (*attachments.Attachment, error) {
+	ret := _m.Called(volumeID, instanceID, connector)
+	return ret.Get(0).(*attachments.Attachment), ret.Error(1)
+}
+
+// DeleteVolumeAttachments provides a mock function with given fields: volumeID, instanceID
+func (_m *OpenStackMock) DeleteVolumeAttachments(ctx context.Context, volumeID, instanceID string) error {
+	ret := _m.Called(volumeID, instanceID)
+	return ret.Error(0)
+}
+
+// VolumeAttachedByCompute provides a mock function with given fields: instanceID, volumeID
+func (_m *OpenStackMock) VolumeAttachedByCompute(ctx context.Context, instanceID, volumeID string) (bool, error) {
+	ret := _m.Called(instanceID, volumeID)
+	return ret.Bool(0), ret.Error(1)
+}
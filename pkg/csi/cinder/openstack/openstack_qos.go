@@ -0,0 +1,84 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package openstack qos provides an implementation of Cinder QoS specs
+// features using Gophercloud.
+package openstack
+
+import (
+	"context"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/qos"
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	cpoerrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
+)
+
+const (
+	VolumeQoSSpecs    = "qos-specs"
+	VolumeQoSConsumer = "qos-consumer"
+)
+
+// VolumeQoSLimits maps the StorageClass parameters setting the limits of the
+// QoS specs to the corresponding Cinder QoS specs keys
+var VolumeQoSLimits = map[string]string{
+	"total-iops-sec":  "total_iops_sec",
+	"read-iops-sec":   "read_iops_sec",
+	"write-iops-sec":  "write_iops_sec",
+	"total-bytes-sec": "total_bytes_sec",
+	"read-bytes-sec":  "read_bytes_sec",
+	"write-bytes-sec": "write_bytes_sec",
+}
+
+// GetQoSSpecs returns the QoS specs with the given name or ID.
+func (os *OpenStack) GetQoSSpecs(ctx context.Context, name string) (*qos.QoS, error) {
+	mc := metrics.NewMetricContext("qos_specs", "list")
+	allPages, err := qos.List(os.blockstorage, qos.ListOpts{}).AllPages(ctx)
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+
+	specs, err := qos.ExtractQoS(allPages)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range specs {
+		if s.ID == name || s.Name == name {
+			return &s, nil
+		}
+	}
+	return nil, cpoerrors.ErrNotFound
+}
+
+// GetVolumeTypeQoSSpecs returns the QoS specs associated with the volume type
+// with the given name or ID, or nil if the volume type has no QoS specs.
+func (os *OpenStack) GetVolumeTypeQoSSpecs(ctx context.Context, volumeType string) (*qos.QoS, error) {
+	vt, err := os.getVolumeType(ctx, volumeType)
+	if err != nil {
+		return nil, err
+	}
+
+	if vt.QosSpecID == "" {
+		return nil, nil
+	}
+
+	mc := metrics.NewMetricContext("qos_specs", "get")
+	specs, err := qos.Get(ctx, os.blockstorage, vt.QosSpecID).Extract()
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+	return specs, nil
+}
@@ -21,6 +21,7 @@ package openstack
 import (
 	"context"
 	"fmt"
+	"math"
 	"net/url"
 	"strconv"
 	"time"
@@ -29,14 +30,15 @@ import (
 	"github.com/gophercloud/gophercloud/v2/pagination"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	cpoerrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
 	"k8s.io/klog/v2"
 )
 
 const (
-	snapshotReadyStatus = "available"
+	SnapshotReadyStatus = "available"
+	snapshotErrorStatus = "error"
 	snapReadyDuration   = 1 * time.Second
-	snapReadyFactor     = 1.2
-	snapReadySteps      = 10
+	snapReadyFactor     = 1.5
 
 	snapshotDescription      = "Created by OpenStack Cinder CSI driver"
 	SnapshotForceCreate      = "force-create"
@@ -44,6 +46,15 @@ const (
 	SnapshotAvailabilityZone = "availability"
 )
 
+var (
+	// snapReadyTimeout is how long the snapshots are waited for to be ready,
+	// before they are reported as not ready to use
+	snapReadyTimeout = 30 * time.Second
+	// snapReadyMaxInterval caps the interval between the polls of the
+	// snapshot status, growing from snapReadyDuration by snapReadyFactor
+	snapReadyMaxInterval = 10 * time.Second
+)
+
 // CreateSnapshot issues a request to take a Snapshot of the specified Volume with the corresponding ID and
 // returns the resultant gophercloud Snapshot Item upon success
 func (os *OpenStack) CreateSnapshot(ctx context.Context, name, volID string, tags map[string]string) (*snapshots.Snapshot, error) {
@@ -159,40 +170,50 @@ func (os *OpenStack) GetSnapshotByID(ctx context.Context, snapshotID string) (*s
 	return s, nil
 }
 
-// WaitSnapshotReady waits till snapshot is ready
-func (os *OpenStack) WaitSnapshotReady(ctx context.Context, snapshotID string) (string, error) {
+// WaitSnapshotReady waits till snapshot is ready, polling its status with an
+// exponential backoff. The progress function, if not nil, is called with the
+// snapshot whenever its progress changes. An error wrapping
+// ErrSnapshotNotReady is returned if the snapshot is still not ready after
+// the timeout.
+func (os *OpenStack) WaitSnapshotReady(ctx context.Context, snapshotID string, progress func(*snapshots.Snapshot)) (string, error) {
 	backoff := wait.Backoff{
 		Duration: snapReadyDuration,
 		Factor:   snapReadyFactor,
-		Steps:    snapReadySteps,
+		Cap:      snapReadyMaxInterval,
+		Steps:    math.MaxInt32,
 	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, snapReadyTimeout)
+	defer cancel()
 
-	err := wait.ExponentialBackoff(backoff, func() (bool, error) {
-		ready, err := os.snapshotIsReady(ctx, snapshotID)
+	var snap *snapshots.Snapshot
+	lastProgress := ""
+	err := backoff.DelayFunc().Until(timeoutCtx, true, false, func(ctx context.Context) (bool, error) {
+		s, err := os.GetSnapshotByID(ctx, snapshotID)
 		if err != nil {
 			return false, err
 		}
-		return ready, nil
+		snap = s
+		switch snap.Status {
+		case SnapshotReadyStatus:
+			return true, nil
+		case snapshotErrorStatus:
+			return false, fmt.Errorf("snapshot %s is in error state", snapshotID)
+		}
+
+		klog.V(4).Infof("Snapshot %s is %s, progress: %s", snapshotID, snap.Status, snap.Progress)
+		if progress != nil && snap.Progress != lastProgress {
+			lastProgress = snap.Progress
+			progress(snap)
+		}
+		return false, nil
 	})
 
-	if wait.Interrupted(err) {
-		err = fmt.Errorf("timeout, Snapshot %s is still not Ready %v", snapshotID, err)
+	if err != nil && ctx.Err() == nil && timeoutCtx.Err() != nil {
+		err = fmt.Errorf("%w: snapshot %s is still not ready after %s", cpoerrors.ErrSnapshotNotReady, snapshotID, snapReadyTimeout)
 	}
 
-	snap, _ := os.GetSnapshotByID(ctx, snapshotID)
-
 	if snap != nil {
 		return snap.Status, err
-	} else {
-		return "Failed to get snapshot status", err
 	}
-}
-
-func (os *OpenStack) snapshotIsReady(ctx context.Context, snapshotID string) (bool, error) {
-	snap, err := os.GetSnapshotByID(ctx, snapshotID)
-	if err != nil {
-		return false, err
-	}
-
-	return snap.Status == snapshotReadyStatus, nil
+	return "Failed to get snapshot status", err
 }
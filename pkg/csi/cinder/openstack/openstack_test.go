@@ -17,14 +17,25 @@ limitations under the License.
 package openstack
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/quotasets"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/snapshots"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
 	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/assert"
 	"k8s.io/cloud-provider-openstack/pkg/client"
+	cpoerrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
 )
 
 var fakeFileName = "cloud.conf"
@@ -304,3 +315,365 @@ func TestUserAgentFlag(t *testing.T) {
 		})
 	}
 }
+
+func TestAvailabilityZoneMap(t *testing.T) {
+	opts := BlockStorageOpts{AvailabilityZoneMap: []string{"az1:nova", " az2 : nova ", "az3:ceph"}}
+	assert.NoError(t, opts.ParseAvailabilityZoneMap())
+
+	assert.Equal(t, "nova", opts.VolumeAZ("az1"))
+	assert.Equal(t, "nova", opts.VolumeAZ("az2"))
+	assert.Equal(t, "ceph", opts.VolumeAZ("az3"))
+	assert.Equal(t, "az4", opts.VolumeAZ("az4"))
+
+	assert.Equal(t, []string{"az1", "az2"}, opts.ComputeAZs("nova"))
+	assert.Equal(t, []string{"az3"}, opts.ComputeAZs("ceph"))
+	assert.Equal(t, []string{"az4"}, opts.ComputeAZs("az4"))
+
+	for _, entry := range []string{"az1", "az1:", ":nova"} {
+		_, err := parseAvailabilityZoneMap([]string{entry})
+		assert.Error(t, err, entry)
+	}
+}
+
+func TestRemainingQuota(t *testing.T) {
+	assert.Equal(t, UnlimitedQuota, remainingQuota(quotasets.QuotaUsage{Limit: -1, InUse: 10}))
+	assert.Equal(t, 60, remainingQuota(quotasets.QuotaUsage{Limit: 100, InUse: 30, Reserved: 10}))
+	assert.Equal(t, 0, remainingQuota(quotasets.QuotaUsage{Limit: 100, InUse: 120}))
+}
+
+func TestMinQuota(t *testing.T) {
+	assert.Equal(t, UnlimitedQuota, minQuota(UnlimitedQuota, UnlimitedQuota))
+	assert.Equal(t, 10, minQuota(UnlimitedQuota, 10))
+	assert.Equal(t, 10, minQuota(10, UnlimitedQuota))
+	assert.Equal(t, 5, minQuota(10, 5))
+}
+
+func TestMicroversionsRequire(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/v3/", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"versions": [{"id": "v3.0", "status": "CURRENT", "version": "3.45", "min_version": "3.0"}]}`)
+	}))
+	defer srv.Close()
+
+	client := &gophercloud.ServiceClient{
+		ProviderClient: &gophercloud.ProviderClient{},
+		Endpoint:       srv.URL + "/v3/" + fakeTenantID + "/",
+		Type:           "block-storage",
+	}
+
+	var m microversions
+	ctx := context.Background()
+	assert.NoError(t, m.require(ctx, client, "volume online resize", microversionOnlineResize))
+	err := m.require(ctx, client, "volume creation from backups", microversionBackupRestore)
+	assert.ErrorIs(t, err, cpoerrors.ErrMicroversionNotSupported)
+	assert.ErrorContains(t, err, "volume creation from backups requires microversion 3.51 of block-storage, which supports microversions 3.0 to 3.45")
+	// the microversions are discovered once
+	assert.Equal(t, 1, requests)
+
+	// the features are assumed to be supported if discovery fails
+	srv.Close()
+	m = microversions{}
+	assert.NoError(t, m.require(ctx, client, "volume creation from backups", microversionBackupRestore))
+}
+
+func TestMicroversionsRetry(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"versions": [{"id": "v3.0", "status": "CURRENT", "version": "3.45", "min_version": "3.0"}]}`)
+	}))
+	defer srv.Close()
+
+	client := &gophercloud.ServiceClient{
+		ProviderClient: &gophercloud.ProviderClient{},
+		Endpoint:       srv.URL + "/v3/" + fakeTenantID + "/",
+		Type:           "block-storage",
+	}
+
+	var m microversions
+	ctx := context.Background()
+	assert.NoError(t, m.require(ctx, client, "volume creation from backups", microversionBackupRestore))
+
+	// the failed discovery isn't retried before the retry interval
+	assert.NoError(t, m.require(ctx, client, "volume creation from backups", microversionBackupRestore))
+	assert.Equal(t, 1, requests)
+
+	defer func(interval time.Duration) { microversionsRetryInterval = interval }(microversionsRetryInterval)
+	microversionsRetryInterval = 0
+	assert.ErrorIs(t, m.require(ctx, client, "volume creation from backups", microversionBackupRestore), cpoerrors.ErrMicroversionNotSupported)
+	assert.Equal(t, 2, requests)
+}
+
+func TestCredentialsReload(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	provider := &gophercloud.ProviderClient{}
+	provider.UseTokenLock()
+	provider.TokenID = "old"
+	reauths := 0
+	provider.ReauthFunc = func(context.Context) error {
+		reauths++
+		return nil
+	}
+
+	global := client.AuthOpts{AuthURL: srv.URL + "/v3", Username: fakeUserName, Password: fakePassword}
+	registerCredentials(fakeCloudName, &global, provider, "https://cinder/v3/"+fakeTenantID)
+	defer delete(cloudCredentials, fakeCloudName)
+	c := cloudCredentials[fakeCloudName]
+
+	ctx := context.Background()
+	assert.NoError(t, provider.Reauthenticate(ctx, provider.Token()))
+	assert.Equal(t, 1, reauths)
+
+	// the unchanged credentials are not reloaded
+	assert.NoError(t, c.reload(fakeCloudName, &global))
+
+	// the current credentials are kept if the new ones are invalid
+	rotated := global
+	rotated.Password = "rotated"
+	assert.ErrorContains(t, c.reload(fakeCloudName, &rotated), "failed to authenticate with the new credentials")
+	assert.Equal(t, "old", provider.Token())
+	assert.Equal(t, global, c.global)
+
+	// the provider client re-authenticates with the new credentials
+	newProvider := &gophercloud.ProviderClient{}
+	newProvider.UseTokenLock()
+	newProvider.TokenID = "new"
+	newProvider.ReauthFunc = func(context.Context) error {
+		newProvider.CopyTokenFrom(&gophercloud.ProviderClient{TokenID: "renewed"})
+		return nil
+	}
+	c.rotate(newProvider)
+	assert.Equal(t, "new", provider.Token())
+	assert.NoError(t, provider.Reauthenticate(ctx, provider.Token()))
+	assert.Equal(t, "renewed", provider.Token())
+	assert.Equal(t, 1, reauths)
+}
+
+func TestVolumeErrorStateError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v3/":
+			fmt.Fprint(w, `{"versions": [{"id": "v3.0", "status": "CURRENT", "version": "3.70", "min_version": "3.0"}]}`)
+		case "/v3/" + fakeTenantID + "/messages":
+			assert.Equal(t, "volume 3.5", r.Header.Get("OpenStack-API-Version"))
+			if r.URL.Query().Get("resource_uuid") != "vol-1" {
+				fmt.Fprint(w, `{"messages": []}`)
+				return
+			}
+			fmt.Fprint(w, `{"messages": [{"user_message": "schedule allocate volume:Could not find any available weighted backend."}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	os := &OpenStack{
+		blockstorage: &gophercloud.ServiceClient{
+			ProviderClient: &gophercloud.ProviderClient{},
+			Endpoint:       srv.URL + "/v3/" + fakeTenantID + "/",
+			Type:           "volume",
+		},
+	}
+	err := os.volumeErrorStateError(context.Background(), &volumes.Volume{ID: "vol-1", Status: "error"})
+	assert.ErrorIs(t, err, cpoerrors.ErrVolumeErrorState)
+	assert.EqualError(t, err, "volume is in error state error: schedule allocate volume:Could not find any available weighted backend.")
+
+	// the error is returned without a message if the volume has none
+	err = os.volumeErrorStateError(context.Background(), &volumes.Volume{ID: "vol-2", Status: "error_extending"})
+	assert.EqualError(t, err, "volume is in error state error_extending")
+}
+
+func TestWaitSnapshotReady(t *testing.T) {
+	defer func(timeout, maxInterval time.Duration) {
+		snapReadyTimeout, snapReadyMaxInterval = timeout, maxInterval
+	}(snapReadyTimeout, snapReadyMaxInterval)
+	snapReadyTimeout = 5 * time.Second
+	snapReadyMaxInterval = 10 * time.Millisecond
+
+	var polls int
+	statuses := map[string][]string{
+		"snap-1": {"creating", "0%", "creating", "0%", "creating", "50%", "available", "100%"},
+		"snap-2": {"creating", "0%"},
+		"snap-3": {"error", "0%"},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		id := path.Base(r.URL.Path)
+		s := statuses[id]
+		if len(s) > 2 {
+			statuses[id] = s[2:]
+		}
+		polls++
+		fmt.Fprintf(w, `{"snapshot": {"id": %q, "status": %q, "os-extended-snapshot-attributes:progress": %q}}`, id, s[0], s[1])
+	}))
+	defer srv.Close()
+
+	os := &OpenStack{
+		blockstorage: &gophercloud.ServiceClient{
+			ProviderClient: &gophercloud.ProviderClient{},
+			Endpoint:       srv.URL + "/v3/" + fakeTenantID + "/",
+		},
+	}
+
+	// the progress is reported when it changes
+	var progress []string
+	status, err := os.WaitSnapshotReady(context.Background(), "snap-1", func(snap *snapshots.Snapshot) {
+		progress = append(progress, snap.Progress)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "available", status)
+	assert.Equal(t, []string{"0%", "50%"}, progress)
+	assert.Equal(t, 4, polls)
+
+	snapReadyTimeout = 50 * time.Millisecond
+	status, err = os.WaitSnapshotReady(context.Background(), "snap-2", nil)
+	assert.ErrorIs(t, err, cpoerrors.ErrSnapshotNotReady)
+	assert.Equal(t, "creating", status)
+
+	// a snapshot in error state isn't waited for
+	status, err = os.WaitSnapshotReady(context.Background(), "snap-3", nil)
+	assert.EqualError(t, err, "snapshot snap-3 is in error state")
+	assert.Equal(t, "error", status)
+}
+
+func TestCreateVolumeAttachmentCompleteFailure(t *testing.T) {
+	var deleted []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v3/":
+			fmt.Fprint(w, `{"versions": [{"id": "v3.0", "status": "CURRENT", "version": "3.70", "min_version": "3.0"}]}`)
+		case "GET /v3/" + fakeTenantID + "/attachments/detail":
+			fmt.Fprint(w, `{"attachments": []}`)
+		case "POST /v3/" + fakeTenantID + "/attachments":
+			fmt.Fprint(w, `{"attachment": {"id": "attachment-1", "status": "reserved", "volume_id": "vol-1", "instance": "server-1"}}`)
+		case "POST /v3/" + fakeTenantID + "/attachments/attachment-1/action":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "DELETE /v3/" + fakeTenantID + "/attachments/attachment-1":
+			deleted = append(deleted, "attachment-1")
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	provider := &gophercloud.ProviderClient{}
+	provider.EndpointLocator = func(gophercloud.EndpointOpts) (string, error) {
+		return srv.URL + "/v3/" + fakeTenantID + "/", nil
+	}
+	os := &OpenStack{
+		blockstorage: &gophercloud.ServiceClient{
+			ProviderClient: provider,
+			Endpoint:       srv.URL + "/v3/" + fakeTenantID + "/",
+			Type:           "block-storage",
+		},
+	}
+
+	// the reserved attachment isn't left behind for the retries
+	_, err := os.CreateVolumeAttachment(context.Background(), "vol-1", "server-1", map[string]any{})
+	assert.Error(t, err)
+	assert.Equal(t, []string{"attachment-1"}, deleted)
+}
+
+func TestCreateVolumeAttachmentStaleReserved(t *testing.T) {
+	var deleted []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v3/":
+			fmt.Fprint(w, `{"versions": [{"id": "v3.0", "status": "CURRENT", "version": "3.70", "min_version": "3.0"}]}`)
+		case "GET /v3/" + fakeTenantID + "/attachments/detail":
+			fmt.Fprint(w, `{"attachments": [{"id": "attachment-0", "status": "reserved", "volume_id": "vol-1", "instance": "server-1"}]}`)
+		case "DELETE /v3/" + fakeTenantID + "/attachments/attachment-0":
+			deleted = append(deleted, "attachment-0")
+			w.WriteHeader(http.StatusOK)
+		case "POST /v3/" + fakeTenantID + "/attachments":
+			fmt.Fprint(w, `{"attachment": {"id": "attachment-1", "status": "reserved", "volume_id": "vol-1", "instance": "server-1"}}`)
+		case "POST /v3/" + fakeTenantID + "/attachments/attachment-1/action":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	provider := &gophercloud.ProviderClient{}
+	provider.EndpointLocator = func(gophercloud.EndpointOpts) (string, error) {
+		return srv.URL + "/v3/" + fakeTenantID + "/", nil
+	}
+	os := &OpenStack{
+		blockstorage: &gophercloud.ServiceClient{
+			ProviderClient: provider,
+			Endpoint:       srv.URL + "/v3/" + fakeTenantID + "/",
+			Type:           "block-storage",
+		},
+	}
+
+	// the attachment left reserved by a previous call is deleted before attaching the volume again
+	attachment, err := os.CreateVolumeAttachment(context.Background(), "vol-1", "server-1", map[string]any{})
+	assert.NoError(t, err)
+	assert.Equal(t, "attachment-1", attachment.ID)
+	assert.Equal(t, []string{"attachment-0"}, deleted)
+}
+
+func TestCreateBackupIncremental(t *testing.T) {
+	var backups string
+	var incremental []bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v3/" + fakeTenantID + "/backups":
+			assert.Equal(t, "vol-1", r.URL.Query().Get("volume_id"))
+			assert.Equal(t, "available", r.URL.Query().Get("status"))
+			fmt.Fprintf(w, `{"backups": [%s]}`, backups)
+		case "POST /v3/" + fakeTenantID + "/backups":
+			var body struct {
+				Backup struct {
+					Incremental bool `json:"incremental"`
+				} `json:"backup"`
+			}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			incremental = append(incremental, body.Backup.Incremental)
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprint(w, `{"backup": {"id": "backup-1", "status": "creating"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	provider := &gophercloud.ProviderClient{}
+	provider.EndpointLocator = func(gophercloud.EndpointOpts) (string, error) {
+		return srv.URL + "/v3/" + fakeTenantID + "/", nil
+	}
+	os := &OpenStack{
+		blockstorage: &gophercloud.ServiceClient{
+			ProviderClient: provider,
+			Endpoint:       srv.URL + "/v3/" + fakeTenantID + "/",
+			Type:           "block-storage",
+		},
+	}
+
+	// the first backup of the volume is a full backup
+	_, err := os.CreateBackup(context.Background(), "backup", "vol-1", "snap-1", "", map[string]string{BackupIncremental: "true"})
+	assert.NoError(t, err)
+
+	backups = `{"id": "backup-0", "volume_id": "vol-1", "status": "available"}`
+	_, err = os.CreateBackup(context.Background(), "backup", "vol-1", "snap-1", "", map[string]string{BackupIncremental: "true"})
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{false, true}, incremental)
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package openstack transfers provides the transfer of the Cinder volumes
+// between projects using Gophercloud.
+package openstack
+
+import (
+	"context"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/transfers"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/v2/pagination"
+	"k8s.io/klog/v2"
+
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+)
+
+// CreateVolumeTransfer creates a transfer of the volume to another project.
+// The pending transfers of the volume are deleted first, since their
+// authentication key is only returned when they are created.
+func (os *OpenStack) CreateVolumeTransfer(ctx context.Context, volumeID string) (*transfers.Transfer, error) {
+	var pending []transfers.Transfer
+	mc := metrics.NewMetricContext("volume_transfer", "list")
+	err := transfers.List(os.blockstorage, transfers.ListOpts{}).EachPage(ctx, func(_ context.Context, page pagination.Page) (bool, error) {
+		list, err := transfers.ExtractTransfers(page)
+		if err != nil {
+			return false, err
+		}
+		for _, t := range list {
+			if t.VolumeID == volumeID {
+				pending = append(pending, t)
+			}
+		}
+		return true, nil
+	})
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+
+	for _, t := range pending {
+		klog.V(4).Infof("Deleting pending transfer %s of volume %s", t.ID, volumeID)
+		if err := os.DeleteVolumeTransfer(ctx, t.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	opts := transfers.CreateOpts{
+		VolumeID: volumeID,
+		Name:     volumeID,
+	}
+	mc = metrics.NewMetricContext("volume_transfer", "create")
+	transfer, err := transfers.Create(ctx, os.blockstorage, opts).Extract()
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// AcceptVolumeTransfer accepts the transfer of a volume from another project
+func (os *OpenStack) AcceptVolumeTransfer(ctx context.Context, transferID, authKey string) error {
+	mc := metrics.NewMetricContext("volume_transfer", "accept")
+	_, err := transfers.Accept(ctx, os.blockstorage, transferID, transfers.AcceptOpts{AuthKey: authKey}).Extract()
+	return mc.ObserveRequest(err)
+}
+
+// UpdateVolumeMetadata replaces the metadata of the volume, e.g. to mark it
+// before it is transferred
+func (os *OpenStack) UpdateVolumeMetadata(ctx context.Context, volumeID string, metadata map[string]string) error {
+	mc := metrics.NewMetricContext("volume", "update")
+	_, err := volumes.Update(ctx, os.blockstorage, volumeID, volumes.UpdateOpts{Metadata: metadata}).Extract()
+	return mc.ObserveRequest(err)
+}
+
+// DeleteVolumeTransfer deletes a transfer which was not accepted
+func (os *OpenStack) DeleteVolumeTransfer(ctx context.Context, transferID string) error {
+	mc := metrics.NewMetricContext("volume_transfer", "delete")
+	err := transfers.Delete(ctx, os.blockstorage, transferID).ExtractErr()
+	return mc.ObserveRequest(err)
+}
@@ -44,9 +44,12 @@ const (
 	VolumeAvailableStatus    = "available"
 	VolumeInUseStatus        = "in-use"
 	VolumeDetachingStatus    = "detaching"
+	VolumeRetypingStatus     = "retyping"
+	VolumeMigrationPolicy    = "migration-policy"
 	operationFinishInitDelay = 1 * time.Second
 	operationFinishFactor    = 1.1
 	operationFinishSteps     = 10
+	volumeStatusPollInterval = 5 * time.Second
 	diskAttachInitDelay      = 1 * time.Second
 	diskAttachFactor         = 1.2
 	diskAttachSteps          = 15
@@ -68,7 +71,10 @@ func (os *OpenStack) CreateVolume(ctx context.Context, opts *volumes.CreateOpts,
 	// creating volumes from backups and backups cross-az is available since 3.51 microversion
 	// https://docs.openstack.org/cinder/latest/contributor/api_microversion_history.html#id47
 	if !os.bsOpts.IgnoreVolumeMicroversion && opts.BackupID != "" {
-		blockstorageClient.Microversion = "3.51"
+		if err := os.bsMicroversions.require(ctx, os.blockstorage, "volume creation from backups", microversionBackupRestore); err != nil {
+			return nil, err
+		}
+		blockstorageClient.Microversion = microversionBackupRestore
 	}
 
 	mc := metrics.NewMetricContext("volume", "create")
@@ -220,12 +226,15 @@ func (os *OpenStack) AttachVolume(ctx context.Context, instanceID, volumeID stri
 
 	if volume.Multiattach {
 		// For multiattach volumes, supported compute api version is 2.60
+		if err := os.requireComputeMicroversion(ctx, "multiattach volume attachment", microversionMultiattach); err != nil {
+			return "", err
+		}
 		// Init a local thread safe copy of the compute ServiceClient
 		computeServiceClient, err = openstack.NewComputeV2(os.compute.ProviderClient, os.epOpts)
 		if err != nil {
 			return "", err
 		}
-		computeServiceClient.Microversion = "2.60"
+		computeServiceClient.Microversion = microversionMultiattach
 	}
 
 	mc := metrics.NewMetricContext("volume", "attach")
@@ -234,12 +243,27 @@ func (os *OpenStack) AttachVolume(ctx context.Context, instanceID, volumeID stri
 	}).Extract()
 
 	if mc.ObserveRequest(err) != nil {
-		return "", fmt.Errorf("failed to attach %s volume to %s compute: %v", volumeID, instanceID, err)
+		if isCrossAZAttachError(err) {
+			err = errors.Join(err, cpoerrors.ErrCrossAZAttach)
+		}
+		return "", fmt.Errorf("failed to attach %s volume to %s compute: %w", volumeID, instanceID, err)
 	}
 
 	return volume.ID, nil
 }
 
+// isCrossAZAttachError returns true if Nova refused to attach the volume
+// because it is not in the availability zone of the server, which happens
+// when cross_az_attach is disabled in Nova.
+func isCrossAZAttachError(err error) bool {
+	var e gophercloud.ErrUnexpectedResponseCode
+	if !errors.As(err, &e) || e.Actual != http.StatusBadRequest {
+		return false
+	}
+	body := strings.ToLower(string(e.Body))
+	return strings.Contains(body, "availability_zone") || strings.Contains(body, "availability zone")
+}
+
 // WaitDiskAttached waits for attached
 func (os *OpenStack) WaitDiskAttached(ctx context.Context, instanceID string, volumeID string) error {
 	backoff := wait.Backoff{
@@ -274,21 +298,7 @@ func (os *OpenStack) WaitVolumeTargetStatus(ctx context.Context, volumeID string
 	}
 
 	waitErr := wait.ExponentialBackoff(backoff, func() (bool, error) {
-		vol, err := os.GetVolume(ctx, volumeID)
-		if err != nil {
-			return false, err
-		}
-		for _, t := range tStatus {
-			if vol.Status == t {
-				return true, nil
-			}
-		}
-		for _, eState := range volumeErrorStates {
-			if vol.Status == eState {
-				return false, fmt.Errorf("volume is in Error State : %s", vol.Status)
-			}
-		}
-		return false, nil
+		return os.volumeInTargetStatus(ctx, volumeID, tStatus)
 	})
 
 	if wait.Interrupted(waitErr) {
@@ -298,6 +308,87 @@ func (os *OpenStack) WaitVolumeTargetStatus(ctx context.Context, volumeID string
 	return waitErr
 }
 
+// WaitVolumeTargetStatusWithTimeout waits for the volume to be in one of the
+// target statuses like WaitVolumeTargetStatus, for the long operations such as
+// retypes, which may migrate the volume to another backend.
+func (os *OpenStack) WaitVolumeTargetStatusWithTimeout(ctx context.Context, volumeID string, tStatus []string, timeout time.Duration) error {
+	waitErr := wait.PollUntilContextTimeout(ctx, volumeStatusPollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		return os.volumeInTargetStatus(ctx, volumeID, tStatus)
+	})
+
+	if wait.Interrupted(waitErr) {
+		waitErr = fmt.Errorf("timeout on waiting %s for volume %s status to be in %v", timeout, volumeID, tStatus)
+	}
+
+	return waitErr
+}
+
+// volumeInTargetStatus returns true if the volume is in one of the target
+// statuses, and an error if it is in an error status.
+func (os *OpenStack) volumeInTargetStatus(ctx context.Context, volumeID string, tStatus []string) (bool, error) {
+	vol, err := os.GetVolume(ctx, volumeID)
+	if err != nil {
+		return false, err
+	}
+	for _, t := range tStatus {
+		if vol.Status == t {
+			return true, nil
+		}
+	}
+	for _, eState := range volumeErrorStates {
+		if vol.Status == eState {
+			return false, os.volumeErrorStateError(ctx, vol)
+		}
+	}
+	return false, nil
+}
+
+// volumeErrorStateError returns the error of a volume in an error state, with
+// the latest user message of Cinder telling why the operation on the volume
+// failed, e.g. "schedule allocate volume:Could not find any available weighted
+// backend", if any.
+func (os *OpenStack) volumeErrorStateError(ctx context.Context, vol *volumes.Volume) error {
+	msg, err := os.getVolumeMessage(ctx, vol.ID)
+	if err != nil {
+		klog.V(4).Infof("Failed to get the messages of volume %s: %v", vol.ID, err)
+	}
+	if msg == "" {
+		return fmt.Errorf("%w %s", cpoerrors.ErrVolumeErrorState, vol.Status)
+	}
+	return fmt.Errorf("%w %s: %s", cpoerrors.ErrVolumeErrorState, vol.Status, msg)
+}
+
+// getVolumeMessage returns the latest user message of the volume, or an empty
+// string if there is none. There is no gophercloud package of the messages
+// API.
+func (os *OpenStack) getVolumeMessage(ctx context.Context, volumeID string) (string, error) {
+	if err := os.requireBlockStorageMicroversion(ctx, "volume messages", microversionMessages); err != nil {
+		return "", err
+	}
+	client := *os.blockstorage
+	client.Microversion = microversionMessages
+
+	query := url.Values{
+		"resource_uuid": {volumeID},
+		"sort":          {"created_at:desc"},
+		"limit":         {"1"},
+	}
+	var body struct {
+		Messages []struct {
+			UserMessage string `json:"user_message"`
+		} `json:"messages"`
+	}
+	mc := metrics.NewMetricContext("volume_message", "list")
+	_, err := client.Get(ctx, client.ServiceURL("messages")+"?"+query.Encode(), &body, nil)
+	if mc.ObserveRequest(err) != nil {
+		return "", err
+	}
+	if len(body.Messages) == 0 {
+		return "", nil
+	}
+	return body.Messages[0].UserMessage, nil
+}
+
 // DetachVolume detaches given cinder volume from the compute
 func (os *OpenStack) DetachVolume(ctx context.Context, instanceID, volumeID string) error {
 	volume, err := os.GetVolume(ctx, volumeID)
@@ -388,9 +479,9 @@ func (os *OpenStack) ExpandVolume(ctx context.Context, volumeID string, status s
 	switch status {
 	case VolumeInUseStatus:
 		// If the user has disabled the use of microversion to be compatible with
-		// older clouds, we should fail early
-		if os.bsOpts.IgnoreVolumeMicroversion {
-			return fmt.Errorf("volume online resize is not available with ignore-volume-microversion, requires microversion 3.42 or newer")
+		// older clouds, or if the cloud is too old, we should fail early
+		if err := os.requireBlockStorageMicroversion(ctx, "volume online resize", microversionOnlineResize); err != nil {
+			return err
 		}
 
 		// Init a local thread safe copy of the Cinder ServiceClient
@@ -401,7 +492,7 @@ func (os *OpenStack) ExpandVolume(ctx context.Context, volumeID string, status s
 
 		// cinder online resize is available since 3.42 microversion
 		// https://docs.openstack.org/cinder/latest/contributor/api_microversion_history.html#id40
-		blockstorageClient.Microversion = "3.42"
+		blockstorageClient.Microversion = microversionOnlineResize
 
 		mc := metrics.NewMetricContext("volume", "expand")
 		return mc.ObserveRequest(volumes.ExtendSize(ctx, blockstorageClient, volumeID, extendOpts).ExtractErr())
@@ -414,6 +505,19 @@ func (os *OpenStack) ExpandVolume(ctx context.Context, volumeID string, status s
 	return fmt.Errorf("volume cannot be resized, when status is %s", status)
 }
 
+// ChangeVolumeType changes the volume type of the volume. The migration
+// policy tells whether the volume can be migrated to another backend when the
+// current one doesn't support the new volume type.
+func (os *OpenStack) ChangeVolumeType(ctx context.Context, volumeID string, volumeType string, migrationPolicy string) error {
+	opts := volumes.ChangeTypeOpts{
+		NewType:         volumeType,
+		MigrationPolicy: volumes.MigrationPolicy(migrationPolicy),
+	}
+
+	mc := metrics.NewMetricContext("volume", "retype")
+	return mc.ObserveRequest(volumes.ChangeType(ctx, os.blockstorage, volumeID, opts).ExtractErr())
+}
+
 // GetMaxVolLimit returns max vol limit
 func (os *OpenStack) GetMaxVolLimit() int64 {
 	if os.bsOpts.NodeVolumeAttachLimit > 0 && os.bsOpts.NodeVolumeAttachLimit <= 256 {
@@ -0,0 +1,189 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
+)
+
+// OrphanCleanupOpts configures the collection of the orphaned volumes and
+// attachments: the Cinder volumes of the cluster without a PV, and the
+// attachments of the volumes to the nodes of the cluster without a
+// VolumeAttachment, which are left behind when the controller crashes.
+type OrphanCleanupOpts struct {
+	// Interval between the collections
+	Interval time.Duration
+	// MinAge of the orphaned volumes and attachments, so that the ones
+	// whose PV or VolumeAttachment is being created are not collected
+	MinAge time.Duration
+	// Delete the orphaned volumes and detach the orphaned attachments,
+	// instead of only reporting them
+	Delete bool
+}
+
+type orphanCollector struct {
+	driver *Driver
+	kube   kubernetes.Interface
+	opts   OrphanCleanupOpts
+}
+
+// run collects the orphaned volumes and attachments at every interval, until
+// the context is done.
+func (c *orphanCollector) run(ctx context.Context) {
+	klog.Infof("Collecting the orphaned volumes and attachments every %s, delete: %t", c.opts.Interval, c.opts.Delete)
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := c.collect(ctx); err != nil {
+			klog.Errorf("Failed to collect the orphaned volumes and attachments: %v", err)
+		}
+	}, c.opts.Interval)
+}
+
+// attachmentKey returns the key of the attachment of a volume to a node,
+// specified by its CSI node ID, i.e. its instance ID.
+func attachmentKey(volumeID, nodeID string) string {
+	return volumeID + "/" + nodeID
+}
+
+func (c *orphanCollector) collect(ctx context.Context) error {
+	now := time.Now()
+
+	// The volumes are listed first: the volumes and the attachments created
+	// later can then not be missing from the PVs and the VolumeAttachments
+	// listed below.
+	cloudVolumes := make(map[string][]volumes.Volume, len(c.driver.cs.Clouds))
+	for name, cloud := range c.driver.cs.Clouds {
+		vols, _, err := cloud.ListVolumes(ctx, 0, "")
+		if err != nil {
+			return fmt.Errorf("failed to list the volumes of cloud %q: %v", name, err)
+		}
+		cloudVolumes[name] = vols
+	}
+
+	pvs, err := c.kube.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list the PVs: %v", err)
+	}
+	volumeIDs := sets.New[string]()
+	pvVolumeIDs := make(map[string]string)
+	for _, pv := range pvs.Items {
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == driverName {
+			volumeIDs.Insert(pv.Spec.CSI.VolumeHandle)
+			pvVolumeIDs[pv.Name] = pv.Spec.CSI.VolumeHandle
+		}
+	}
+
+	csiNodes, err := c.kube.StorageV1().CSINodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list the CSINodes: %v", err)
+	}
+	nodeIDs := make(map[string]string)
+	for _, n := range csiNodes.Items {
+		for _, d := range n.Spec.Drivers {
+			if d.Name == driverName {
+				nodeIDs[n.Name] = d.NodeID
+			}
+		}
+	}
+
+	vas, err := c.kube.StorageV1().VolumeAttachments().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list the VolumeAttachments: %v", err)
+	}
+	attachments := sets.New[string]()
+	for _, va := range vas.Items {
+		if va.Spec.Attacher != driverName || va.Spec.Source.PersistentVolumeName == nil {
+			continue
+		}
+		if volumeID, ok := pvVolumeIDs[*va.Spec.Source.PersistentVolumeName]; ok {
+			attachments.Insert(attachmentKey(volumeID, nodeIDs[va.Spec.NodeName]))
+		}
+	}
+	clusterNodes := sets.New[string]()
+	for _, id := range nodeIDs {
+		clusterNodes.Insert(id)
+	}
+
+	var orphanedVolumes, orphanedAttachments int
+	for name, vols := range cloudVolumes {
+		cloud := c.driver.cs.Clouds[name]
+		for _, vol := range vols {
+			// the CSI ephemeral volumes have neither a PV nor a
+			// VolumeAttachment, they are managed by the nodes
+			if vol.Metadata[cinderCSIClusterIDKey] != c.driver.clusterID || strings.HasPrefix(vol.Name, ephemeralVolumeName("")) {
+				continue
+			}
+
+			for _, att := range vol.Attachments {
+				// the attachments to the instances which are not nodes of
+				// the cluster are left alone
+				if !clusterNodes.Has(att.ServerID) || attachments.Has(attachmentKey(vol.ID, att.ServerID)) || now.Sub(att.AttachedAt) < c.opts.MinAge {
+					continue
+				}
+				orphanedAttachments++
+				c.detach(ctx, cloud, &vol, att.ServerID)
+			}
+
+			if volumeIDs.Has(vol.ID) || vol.Status != openstack.VolumeAvailableStatus || now.Sub(vol.CreatedAt) < c.opts.MinAge {
+				continue
+			}
+			orphanedVolumes++
+			c.delete(ctx, cloud, &vol)
+		}
+	}
+
+	klog.V(2).Infof("Found %d orphaned volumes and %d orphaned attachments", orphanedVolumes, orphanedAttachments)
+	return nil
+}
+
+// detach reports the orphaned attachment of the volume to the node, and
+// detaches the volume if enabled.
+func (c *orphanCollector) detach(ctx context.Context, cloud openstack.IOpenStack, vol *volumes.Volume, nodeID string) {
+	if !c.opts.Delete {
+		klog.Warningf("Volume %s (%s) is attached to node %s without a VolumeAttachment", vol.ID, vol.Name, nodeID)
+		return
+	}
+
+	klog.Infof("Detaching volume %s (%s) from node %s, which has no VolumeAttachment", vol.ID, vol.Name, nodeID)
+	if err := cloud.DetachVolume(ctx, nodeID, vol.ID); err != nil {
+		klog.Errorf("Failed to detach orphaned attachment of volume %s from node %s: %v", vol.ID, nodeID, err)
+	}
+}
+
+// delete reports the orphaned volume, and deletes it if enabled.
+func (c *orphanCollector) delete(ctx context.Context, cloud openstack.IOpenStack, vol *volumes.Volume) {
+	if !c.opts.Delete {
+		klog.Warningf("Volume %s (%s) of the cluster has no PV", vol.ID, vol.Name)
+		return
+	}
+
+	klog.Infof("Deleting volume %s (%s), which has no PV", vol.ID, vol.Name)
+	if err := cloud.DeleteVolume(ctx, vol.ID); err != nil {
+		klog.Errorf("Failed to delete orphaned volume %s: %v", vol.ID, err)
+	}
+}
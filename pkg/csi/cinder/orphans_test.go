@@ -0,0 +1,112 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
+)
+
+func TestCollectOrphans(t *testing.T) {
+	old := time.Now().Add(-2 * time.Hour)
+	clusterTag := map[string]string{cinderCSIClusterIDKey: FakeCluster}
+	attachedTo := func(serverID string) []volumes.Attachment {
+		return []volumes.Attachment{{ServerID: serverID, AttachedAt: old}}
+	}
+	cloudVolumes := []volumes.Volume{
+		// attached, with a PV and a VolumeAttachment
+		{ID: "vol-used", Status: "in-use", Metadata: clusterTag, CreatedAt: old, Attachments: attachedTo("node-a-id")},
+		// without a PV
+		{ID: "vol-orphan", Status: "available", Metadata: clusterTag, CreatedAt: old},
+		// with a PV, attached without a VolumeAttachment
+		{ID: "vol-stale-attachment", Status: "in-use", Metadata: clusterTag, CreatedAt: old, Attachments: attachedTo("node-a-id")},
+		// of another cluster
+		{ID: "vol-other-cluster", Status: "available", Metadata: map[string]string{cinderCSIClusterIDKey: "other"}, CreatedAt: old},
+		// being provisioned
+		{ID: "vol-new", Status: "available", Metadata: clusterTag, CreatedAt: time.Now()},
+		// CSI ephemeral volume
+		{ID: "vol-ephemeral", Name: ephemeralVolumeName("csi-1234"), Status: "in-use", Metadata: clusterTag, CreatedAt: old, Attachments: attachedTo("node-a-id")},
+		// with a PV, attached to an instance which is not a node
+		{ID: "vol-other-instance", Status: "in-use", Metadata: clusterTag, CreatedAt: old, Attachments: attachedTo("instance-id")},
+	}
+
+	pv := func(name, volumeID string) *corev1.PersistentVolume {
+		return &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: corev1.PersistentVolumeSpec{
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{Driver: driverName, VolumeHandle: volumeID},
+				},
+			},
+		}
+	}
+	pvName := "pv-used"
+	objects := []runtime.Object{
+		pv("pv-used", "vol-used"),
+		pv("pv-stale-attachment", "vol-stale-attachment"),
+		pv("pv-other-instance", "vol-other-instance"),
+		&storagev1.CSINode{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+			Spec: storagev1.CSINodeSpec{
+				Drivers: []storagev1.CSINodeDriver{{Name: driverName, NodeID: "node-a-id"}},
+			},
+		},
+		&storagev1.VolumeAttachment{
+			ObjectMeta: metav1.ObjectMeta{Name: "va-used"},
+			Spec: storagev1.VolumeAttachmentSpec{
+				Attacher: driverName,
+				NodeName: "node-a",
+				Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &pvName},
+			},
+		},
+	}
+
+	for _, del := range []bool{false, true} {
+		osmock := new(openstack.OpenStackMock)
+		osmock.On("ListVolumes", 0, "").Return(cloudVolumes, "", nil)
+		osmock.On("DeleteVolume", "vol-orphan").Return(nil)
+		osmock.On("DetachVolume", "node-a-id", "vol-stale-attachment").Return(nil)
+
+		d := NewDriver(&DriverOpts{Endpoint: FakeEndpoint, ClusterID: FakeCluster})
+		d.SetupControllerService(map[string]openstack.IOpenStack{"": osmock})
+		d.SetupOrphanCleanup(fake.NewClientset(objects...), OrphanCleanupOpts{MinAge: time.Hour, Delete: del})
+
+		err := d.gc.collect(FakeCtx)
+		assert.NoError(t, err)
+
+		if del {
+			osmock.AssertCalled(t, "DeleteVolume", "vol-orphan")
+			osmock.AssertCalled(t, "DetachVolume", "node-a-id", "vol-stale-attachment")
+			osmock.AssertNumberOfCalls(t, "DeleteVolume", 1)
+			osmock.AssertNumberOfCalls(t, "DetachVolume", 1)
+		} else {
+			osmock.AssertNotCalled(t, "DeleteVolume", mock.Anything)
+			osmock.AssertNotCalled(t, "DetachVolume", mock.Anything, mock.Anything)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// ProvisionLimitOpts limits the volume creations and deletions, so that the
+// Cinder API is not overwhelmed when many PVCs are created or deleted at once,
+// e.g. when a StatefulSet is scaled up. Zero means no limit.
+type ProvisionLimitOpts struct {
+	// MaxConcurrent is the maximum number of concurrent operations
+	MaxConcurrent int
+	// Rate is the maximum number of operations started per second
+	Rate float64
+	// Burst is the number of operations which can be started at once, above
+	// the rate
+	Burst int
+}
+
+// provisionLimiter queues the volume creations and deletions over the limits,
+// until their CSI call times out.
+type provisionLimiter struct {
+	slots   chan struct{}
+	limiter *rate.Limiter
+}
+
+func newProvisionLimiter(opts ProvisionLimitOpts) *provisionLimiter {
+	l := &provisionLimiter{}
+	if opts.MaxConcurrent > 0 {
+		l.slots = make(chan struct{}, opts.MaxConcurrent)
+	}
+	if opts.Rate > 0 {
+		l.limiter = rate.NewLimiter(rate.Limit(opts.Rate), max(opts.Burst, 1))
+	}
+	return l
+}
+
+// acquire waits for a slot and for the rate limit, and returns the function
+// releasing the slot, which may be called several times. An error is returned
+// if the context is done first, or if its deadline would be exceeded waiting
+// for the rate limit.
+func (l *provisionLimiter) acquire(ctx context.Context) (func(), error) {
+	if l.slots != nil {
+		if err := takeSlot(ctx, l.slots); err != nil {
+			return nil, err
+		}
+	}
+
+	release := sync.OnceFunc(func() {
+		if l.slots != nil {
+			<-l.slots
+		}
+	})
+	if l.limiter != nil {
+		if err := l.limiter.Wait(ctx); err != nil {
+			release()
+			return nil, err
+		}
+	}
+	return release, nil
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tryAcquireProvision acquires a slot, giving up shortly if none is free
+func tryAcquireProvision(l *provisionLimiter) (func(), error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	return l.acquire(ctx)
+}
+
+func TestProvisionLimiter(t *testing.T) {
+	assert := assert.New(t)
+
+	// no limit
+	l := newProvisionLimiter(ProvisionLimitOpts{})
+	for i := 0; i < 10; i++ {
+		_, err := tryAcquireProvision(l)
+		assert.NoError(err)
+	}
+
+	// concurrency limit
+	l = newProvisionLimiter(ProvisionLimitOpts{MaxConcurrent: 2})
+	release, err := tryAcquireProvision(l)
+	assert.NoError(err)
+	_, err = tryAcquireProvision(l)
+	assert.NoError(err)
+	_, err = tryAcquireProvision(l)
+	assert.ErrorIs(err, context.DeadlineExceeded)
+	release()
+	// releasing again doesn't free another slot
+	release()
+	_, err = tryAcquireProvision(l)
+	assert.NoError(err)
+	_, err = tryAcquireProvision(l)
+	assert.ErrorIs(err, context.DeadlineExceeded)
+
+	// rate limit, the burst is started at once
+	l = newProvisionLimiter(ProvisionLimitOpts{MaxConcurrent: 3, Rate: 0.1, Burst: 2})
+	for i := 0; i < 2; i++ {
+		release, err := tryAcquireProvision(l)
+		assert.NoError(err)
+		release()
+	}
+	_, err = tryAcquireProvision(l)
+	assert.Error(err)
+	// the slot is given back when the rate limit can't be waited for
+	assert.Empty(l.slots)
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+
+	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+)
+
+// quotaRequest is a quota of the project, and the amount of it a CSI call
+// requires
+type quotaRequest struct {
+	name      string
+	requested int
+	available int
+	unit      string
+}
+
+// checkQuota returns a ResourceExhausted error if one of the quotas of the
+// project of the cloud would be exceeded by the volume or the snapshot of
+// the given volume type and size, when the quota-preflight option is enabled.
+// The quotas which can't be read are not checked, and Cinder refuses the
+// volume or the snapshot then.
+func checkQuota(ctx context.Context, cloud openstack.IOpenStack, method, volType string, sizeGB int, snapshot bool) error {
+	if !cloud.GetBlockStorageOpts().QuotaPreflight {
+		return nil
+	}
+
+	quota, err := cloud.GetVolumeQuota(ctx, volType)
+	if err != nil {
+		klog.Warningf("%s: failed to get the quotas of the project, not checking them: %v", method, err)
+		return nil
+	}
+
+	// the snapshots count against the gigabytes quota too, unless Cinder
+	// is configured otherwise
+	requests := []quotaRequest{
+		{name: "gigabytes", requested: sizeGB, available: quota.AvailableGB, unit: " GiB"},
+	}
+	if snapshot {
+		requests = append(requests, quotaRequest{name: "snapshots", requested: 1, available: quota.AvailableSnapshots})
+	} else {
+		requests = append(requests,
+			quotaRequest{name: "volumes", requested: 1, available: quota.AvailableVolumes},
+			quotaRequest{name: "per_volume_gigabytes", requested: sizeGB, available: quota.MaxVolumeSizeGB, unit: " GiB"},
+		)
+	}
+
+	for _, r := range requests {
+		if r.available == openstack.UnlimitedQuota || r.requested <= r.available {
+			continue
+		}
+		metrics.ObserveQuotaPreflightFailure(method, r.name)
+		if volType != "" {
+			return status.Errorf(codes.ResourceExhausted, "[%s] the %s quota of the project for volume type %q would be exceeded: %d%s requested, %d%s available", method, r.name, volType, r.requested, r.unit, r.available, r.unit)
+		}
+		return status.Errorf(codes.ResourceExhausted, "[%s] the %s quota of the project would be exceeded: %d%s requested, %d%s available", method, r.name, r.requested, r.unit, r.available, r.unit)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
+)
+
+func TestCheckQuota(t *testing.T) {
+	unlimited := openstack.VolumeQuota{
+		AvailableGB:        openstack.UnlimitedQuota,
+		MaxVolumeSizeGB:    openstack.UnlimitedQuota,
+		AvailableVolumes:   openstack.UnlimitedQuota,
+		AvailableSnapshots: openstack.UnlimitedQuota,
+	}
+	withQuota := func(f func(q *openstack.VolumeQuota)) *openstack.VolumeQuota {
+		q := unlimited
+		f(&q)
+		return &q
+	}
+
+	tests := []struct {
+		name     string
+		disabled bool
+		quota    *openstack.VolumeQuota
+		quotaErr error
+		snapshot bool
+		errCode  codes.Code
+		errMsg   string
+	}{
+		{name: "disabled", disabled: true, quota: withQuota(func(q *openstack.VolumeQuota) { q.AvailableGB = 0 })},
+		{name: "unlimited", quota: &unlimited},
+		{name: "quota error", quotaErr: errors.New("forbidden")},
+		{name: "enough gigabytes", quota: withQuota(func(q *openstack.VolumeQuota) { q.AvailableGB = 10 })},
+		{
+			name:    "gigabytes exceeded",
+			quota:   withQuota(func(q *openstack.VolumeQuota) { q.AvailableGB = 9 }),
+			errCode: codes.ResourceExhausted,
+			errMsg:  `[CreateVolume] the gigabytes quota of the project for volume type "gold" would be exceeded: 10 GiB requested, 9 GiB available`,
+		},
+		{
+			name:    "volumes exceeded",
+			quota:   withQuota(func(q *openstack.VolumeQuota) { q.AvailableVolumes = 0 }),
+			errCode: codes.ResourceExhausted,
+			errMsg:  `[CreateVolume] the volumes quota of the project for volume type "gold" would be exceeded: 1 requested, 0 available`,
+		},
+		{
+			name:    "volume size exceeded",
+			quota:   withQuota(func(q *openstack.VolumeQuota) { q.MaxVolumeSizeGB = 5 }),
+			errCode: codes.ResourceExhausted,
+			errMsg:  `[CreateVolume] the per_volume_gigabytes quota of the project for volume type "gold" would be exceeded: 10 GiB requested, 5 GiB available`,
+		},
+		{
+			name:     "snapshots exceeded",
+			quota:    withQuota(func(q *openstack.VolumeQuota) { q.AvailableSnapshots = 0 }),
+			snapshot: true,
+			errCode:  codes.ResourceExhausted,
+			errMsg:   `[CreateSnapshot] the snapshots quota of the project for volume type "gold" would be exceeded: 1 requested, 0 available`,
+		},
+		{
+			name:     "snapshot ignores the volume quotas",
+			quota:    withQuota(func(q *openstack.VolumeQuota) { q.AvailableVolumes, q.MaxVolumeSizeGB = 0, 5 }),
+			snapshot: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			osmock := new(openstack.OpenStackMock)
+			osmock.On("GetBlockStorageOpts").Return(openstack.BlockStorageOpts{QuotaPreflight: !tt.disabled})
+			osmock.On("GetVolumeQuota", "gold").Return(tt.quota, tt.quotaErr)
+
+			method := "CreateVolume"
+			if tt.snapshot {
+				method = "CreateSnapshot"
+			}
+			err := checkQuota(FakeCtx, osmock, method, "gold", 10, tt.snapshot)
+			if tt.errCode == codes.OK {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Equal(t, tt.errCode, status.Code(err))
+			assert.Equal(t, tt.errMsg, status.Convert(err).Message())
+		})
+	}
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/snapshots"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+
+	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
+	cpoerrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
+)
+
+const (
+	// crossAZRestoreKey is the StorageClass parameter of how the snapshots
+	// are restored to volumes in another availability zone than their source
+	// volume, which Cinder refuses unless cloned_volume_same_az is disabled
+	crossAZRestoreKey = "cross-az-restore"
+	// crossAZRestoreBackup restores the snapshot from a temporary backup of
+	// it, as the volumes can be created from the backups in any zone
+	crossAZRestoreBackup = "backup"
+
+	// restoreBackupPrefix prefixes the name of the volume for the name of its
+	// temporary backup, so that a retried CreateVolume finds it
+	restoreBackupPrefix = "restore-"
+	// restoreSnapshotKey is the metadata of the temporary backups giving the
+	// snapshot they are a backup of
+	restoreSnapshotKey = "cinder.csi.openstack.org/restore-snapshot"
+)
+
+// getCrossAZRestore validates the cross-az-restore parameter and returns it.
+func getCrossAZRestore(params map[string]string) (string, error) {
+	switch v := params[crossAZRestoreKey]; v {
+	case "", crossAZRestoreBackup:
+		return v, nil
+	default:
+		return "", status.Errorf(codes.InvalidArgument, "[CreateVolume] invalid %s parameter %q, must be %q", crossAZRestoreKey, v, crossAZRestoreBackup)
+	}
+}
+
+// getRestoreBackup returns the ID of the backup the snapshot is restored from,
+// when it is restored to another availability zone than the one of its source
+// volume, or an empty string when the snapshot can be restored directly. The
+// backup is created from the snapshot, unless a previous call created it.
+func (cs *controllerServer) getRestoreBackup(ctx context.Context, cloud openstack.IOpenStack, volName string, snap *snapshots.Snapshot, volAZ string) (string, error) {
+	if volAZ == "" {
+		return "", nil
+	}
+	srcVol, err := cloud.GetVolume(ctx, snap.VolumeID)
+	if err != nil {
+		if cpoerrors.IsNotFound(err) {
+			klog.V(4).Infof("CreateVolume: source volume %s of snapshot %s is deleted, restoring the snapshot directly", snap.VolumeID, snap.ID)
+			return "", nil
+		}
+		return "", status.Errorf(codes.Internal, "[CreateVolume] failed to get source volume %s of snapshot %s: %v", snap.VolumeID, snap.ID, err)
+	}
+	if srcVol.AvailabilityZone == volAZ {
+		return "", nil
+	}
+
+	name := restoreBackupPrefix + volName
+	existing, err := cloud.ListBackups(ctx, map[string]string{"Name": name})
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "[CreateVolume] failed to get backups: %v", err)
+	}
+	if len(existing) > 1 {
+		return "", status.Errorf(codes.Internal, "[CreateVolume] multiple backups reported by Cinder with name %s", name)
+	}
+
+	backupID := ""
+	if len(existing) == 1 {
+		backupID = existing[0].ID
+	} else {
+		klog.Infof("CreateVolume: restoring snapshot %s of availability zone %s to availability zone %s from a backup", snap.ID, srcVol.AvailabilityZone, volAZ)
+		properties := map[string]string{
+			cinderCSIClusterIDKey: cs.Driver.clusterID,
+			restoreSnapshotKey:    snap.ID,
+		}
+		backup, err := cloud.CreateBackup(ctx, name, snap.VolumeID, snap.ID, "", properties)
+		if err != nil {
+			if errors.Is(err, cpoerrors.ErrMicroversionNotSupported) {
+				return "", status.Errorf(codes.FailedPrecondition, "[CreateVolume] failed to create backup of snapshot %s: %v", snap.ID, err)
+			}
+			return "", status.Errorf(codes.Internal, "[CreateVolume] failed to create backup of snapshot %s: %v", snap.ID, err)
+		}
+		backupID = backup.ID
+	}
+
+	// the backup is waited for again by the retried calls
+	backupStatus, err := cloud.WaitBackupReady(ctx, backupID, snap.Size, openstack.BackupMaxDurationSecondsPerGBDefault)
+	if err != nil {
+		return "", status.Errorf(codes.Aborted, "[CreateVolume] backup %s of snapshot %s is not ready yet, status: %s: %v", backupID, snap.ID, backupStatus, err)
+	}
+	return backupID, nil
+}
+
+// finishRestore deletes the temporary backup of the volume restored from a
+// snapshot of another availability zone, which is not needed anymore once the
+// volume is available, and reports the snapshot as the source of the volume.
+func finishRestore(ctx context.Context, cloud openstack.IOpenStack, volName string, vol *volumes.Volume, snapshotID string) {
+	name := restoreBackupPrefix + volName
+	backups, err := cloud.ListBackups(ctx, map[string]string{"Name": name})
+	if err != nil {
+		klog.Errorf("Failed to get the backups %s of volume %s: %v", name, vol.ID, err)
+	}
+	for _, b := range backups {
+		klog.V(4).Infof("CreateVolume: deleting backup %s of snapshot %s restored to volume %s", b.ID, snapshotID, vol.ID)
+		if err := cloud.DeleteBackup(ctx, b.ID); err != nil && !cpoerrors.IsNotFound(err) {
+			klog.Errorf("Failed to delete backup %s of snapshot %s: %v", b.ID, snapshotID, err)
+		}
+	}
+
+	vol.BackupID = nil
+	vol.SnapshotID = snapshotID
+}
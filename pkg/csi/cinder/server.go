@@ -51,9 +51,27 @@ type nonBlockingGRPCServer struct {
 
 func (s *nonBlockingGRPCServer) Start(endpoint string, ids csi.IdentityServer, cs csi.ControllerServer, ns csi.NodeServer) {
 
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(logGRPC, observeGRPC),
+	}
+	// the server is created before serving, so that it can be stopped
+	// right away
+	server := grpc.NewServer(opts...)
+	s.server = server
+
+	if ids != nil {
+		csi.RegisterIdentityServer(server, ids)
+	}
+	if cs != nil {
+		csi.RegisterControllerServer(server, cs)
+	}
+	if ns != nil {
+		csi.RegisterNodeServer(server, ns)
+	}
+
 	s.wg.Add(1)
 
-	go s.serve(endpoint, ids, cs, ns)
+	go s.serve(endpoint)
 }
 
 func (s *nonBlockingGRPCServer) Wait() {
@@ -68,7 +86,7 @@ func (s *nonBlockingGRPCServer) ForceStop() {
 	s.server.Stop()
 }
 
-func (s *nonBlockingGRPCServer) serve(endpoint string, ids csi.IdentityServer, cs csi.ControllerServer, ns csi.NodeServer) {
+func (s *nonBlockingGRPCServer) serve(endpoint string) {
 	defer s.wg.Done()
 
 	proto, addr, err := ParseEndpoint(endpoint)
@@ -88,25 +106,9 @@ func (s *nonBlockingGRPCServer) serve(endpoint string, ids csi.IdentityServer, c
 		klog.Fatalf("Failed to listen: %v", err)
 	}
 
-	opts := []grpc.ServerOption{
-		grpc.UnaryInterceptor(logGRPC),
-	}
-	server := grpc.NewServer(opts...)
-	s.server = server
-
-	if ids != nil {
-		csi.RegisterIdentityServer(server, ids)
-	}
-	if cs != nil {
-		csi.RegisterControllerServer(server, cs)
-	}
-	if ns != nil {
-		csi.RegisterNodeServer(server, ns)
-	}
-
 	klog.Infof("Listening for connections on address: %#v", listener.Addr())
 
-	if err := server.Serve(listener); err != nil {
+	if err := s.server.Serve(listener); err != nil {
 		klog.Infof("Server stopped with: %v", err)
 		return
 	}
@@ -53,3 +53,31 @@ func TestServerReleaseWaitAfterStopCalling(t *testing.T) {
 
 	<-ch
 }
+
+// blockingServer is a server whose in-flight calls complete on ForceStop only
+type blockingServer struct {
+	NonBlockingGRPCServer
+	forced chan struct{}
+}
+
+func (s *blockingServer) Stop() {
+	<-s.forced
+}
+
+func (s *blockingServer) ForceStop() {
+	close(s.forced)
+}
+
+func TestStopServerForceStopsAfterGracePeriod(t *testing.T) {
+	server := &blockingServer{forced: make(chan struct{})}
+
+	start := time.Now()
+	stopServer(server, 100*time.Millisecond)
+
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	select {
+	case <-server.forced:
+	default:
+		require.Fail(t, "server is not stopped forcefully")
+	}
+}
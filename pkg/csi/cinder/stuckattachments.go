@@ -0,0 +1,252 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
+	cpoerrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
+)
+
+// reconciledAtKey is the annotation set on the stuck VolumeAttachments, so
+// that external-attacher processes them again without waiting for its backoff
+const reconciledAtKey = "cinder.csi.openstack.org/reconciled-at"
+
+// StuckAttachmentOpts configures the reconciliation of the VolumeAttachments
+// stuck attaching or detaching.
+type StuckAttachmentOpts struct {
+	// Interval between the reconciliations
+	Interval time.Duration
+	// Threshold after which a VolumeAttachment which is not attached, or not
+	// deleted, is stuck
+	Threshold time.Duration
+	// Repair the stuck VolumeAttachments, instead of only reporting them
+	Repair bool
+}
+
+type attachmentReconciler struct {
+	driver *Driver
+	kube   kubernetes.Interface
+	opts   StuckAttachmentOpts
+}
+
+// cloudVolume is a volume and the cloud it belongs to
+type cloudVolume struct {
+	cloud openstack.IOpenStack
+	vol   *volumes.Volume
+}
+
+// run reconciles the stuck VolumeAttachments at every interval, until the
+// context is done.
+func (r *attachmentReconciler) run(ctx context.Context) {
+	klog.Infof("Reconciling the VolumeAttachments stuck for %s every %s, repair: %t", r.opts.Threshold, r.opts.Interval, r.opts.Repair)
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := r.reconcile(ctx); err != nil {
+			klog.Errorf("Failed to reconcile the stuck VolumeAttachments: %v", err)
+		}
+	}, r.opts.Interval)
+}
+
+func (r *attachmentReconciler) reconcile(ctx context.Context) error {
+	now := time.Now()
+
+	vas, err := r.kube.StorageV1().VolumeAttachments().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list the VolumeAttachments: %v", err)
+	}
+	var stuck []*storagev1.VolumeAttachment
+	for i := range vas.Items {
+		va := &vas.Items[i]
+		if va.Spec.Attacher != driverName || va.Spec.Source.PersistentVolumeName == nil {
+			continue
+		}
+		if va.DeletionTimestamp != nil {
+			if now.Sub(va.DeletionTimestamp.Time) > r.opts.Threshold {
+				stuck = append(stuck, va)
+			}
+		} else if !va.Status.Attached && now.Sub(va.CreationTimestamp.Time) > r.opts.Threshold {
+			stuck = append(stuck, va)
+		}
+	}
+	if len(stuck) == 0 {
+		klog.V(4).Info("Found no stuck VolumeAttachments")
+		return nil
+	}
+
+	pvs, err := r.kube.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list the PVs: %v", err)
+	}
+	pvVolumeIDs := make(map[string]string)
+	for _, pv := range pvs.Items {
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == driverName {
+			pvVolumeIDs[pv.Name] = pv.Spec.CSI.VolumeHandle
+		}
+	}
+
+	csiNodes, err := r.kube.StorageV1().CSINodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list the CSINodes: %v", err)
+	}
+	nodeIDs := make(map[string]string)
+	for _, n := range csiNodes.Items {
+		for _, d := range n.Spec.Drivers {
+			if d.Name == driverName {
+				nodeIDs[n.Name] = d.NodeID
+			}
+		}
+	}
+
+	vols := make(map[string]cloudVolume)
+	for name, cloud := range r.driver.cs.Clouds {
+		list, _, err := cloud.ListVolumes(ctx, 0, "")
+		if err != nil {
+			return fmt.Errorf("failed to list the volumes of cloud %q: %v", name, err)
+		}
+		for i := range list {
+			vols[list[i].ID] = cloudVolume{cloud: cloud, vol: &list[i]}
+		}
+	}
+
+	for _, va := range stuck {
+		volumeID, ok := pvVolumeIDs[*va.Spec.Source.PersistentVolumeName]
+		if !ok {
+			continue
+		}
+		nodeID, ok := nodeIDs[va.Spec.NodeName]
+		if !ok {
+			klog.Warningf("VolumeAttachment %s is stuck, node %s has no CSINode of the driver", va.Name, va.Spec.NodeName)
+			continue
+		}
+		if va.DeletionTimestamp != nil {
+			r.reconcileDetach(ctx, va, volumeID, nodeID, vols[volumeID])
+		} else {
+			r.reconcileAttach(ctx, va, volumeID, nodeID, vols[volumeID])
+		}
+	}
+	return nil
+}
+
+// reconcileAttach handles a VolumeAttachment stuck attaching. The volume is
+// detached by force from the deleted servers it is still attached to, which
+// prevent its attachment to the node.
+func (r *attachmentReconciler) reconcileAttach(ctx context.Context, va *storagev1.VolumeAttachment, volumeID, nodeID string, cv cloudVolume) {
+	if cv.vol == nil {
+		klog.Warningf("VolumeAttachment %s is stuck attaching, volume %s does not exist", va.Name, volumeID)
+		return
+	}
+
+	if isAttachedTo(cv.vol, nodeID) {
+		klog.Warningf("VolumeAttachment %s is stuck attaching, volume %s is attached to node %s", va.Name, volumeID, nodeID)
+		r.redrive(ctx, va)
+		return
+	}
+
+	for _, att := range cv.vol.Attachments {
+		if cv.vol.Multiattach {
+			break
+		}
+		if _, err := cv.cloud.GetInstanceByID(ctx, att.ServerID); !cpoerrors.IsNotFound(err) {
+			klog.Warningf("VolumeAttachment %s is stuck attaching, volume %s is attached to server %s", va.Name, volumeID, att.ServerID)
+			return
+		}
+		klog.Warningf("VolumeAttachment %s is stuck attaching, volume %s is attached to the deleted server %s", va.Name, volumeID, att.ServerID)
+		r.forceDetach(ctx, cv, att.ServerID)
+	}
+
+	switch cv.vol.Status {
+	case openstack.VolumeAvailableStatus, openstack.VolumeInUseStatus:
+		klog.Warningf("VolumeAttachment %s is stuck attaching volume %s, status %s", va.Name, volumeID, cv.vol.Status)
+		r.redrive(ctx, va)
+	default:
+		// e.g. attaching, reserved or error_attaching, which only an
+		// administrator can reset
+		klog.Warningf("VolumeAttachment %s is stuck attaching, volume %s has status %s", va.Name, volumeID, cv.vol.Status)
+	}
+}
+
+// reconcileDetach handles a VolumeAttachment stuck detaching. The volume is
+// detached by force from the node if the server of the node is deleted, as
+// Nova can't detach it anymore.
+func (r *attachmentReconciler) reconcileDetach(ctx context.Context, va *storagev1.VolumeAttachment, volumeID, nodeID string, cv cloudVolume) {
+	if cv.vol == nil || !isAttachedTo(cv.vol, nodeID) {
+		klog.Warningf("VolumeAttachment %s is stuck detaching, volume %s is not attached to node %s", va.Name, volumeID, nodeID)
+		r.redrive(ctx, va)
+		return
+	}
+
+	_, err := cv.cloud.GetInstanceByID(ctx, nodeID)
+	if err == nil || !cpoerrors.IsNotFound(err) {
+		klog.Warningf("VolumeAttachment %s is stuck detaching volume %s from node %s, status %s", va.Name, volumeID, nodeID, cv.vol.Status)
+		r.redrive(ctx, va)
+		return
+	}
+
+	klog.Warningf("VolumeAttachment %s is stuck detaching, the server of node %s is deleted", va.Name, nodeID)
+	if r.forceDetach(ctx, cv, nodeID) {
+		r.redrive(ctx, va)
+	}
+}
+
+// redrive annotates the VolumeAttachment, so that external-attacher attaches
+// or detaches the volume again.
+func (r *attachmentReconciler) redrive(ctx context.Context, va *storagev1.VolumeAttachment) {
+	if !r.opts.Repair {
+		return
+	}
+
+	klog.Infof("Retrying VolumeAttachment %s", va.Name)
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, reconciledAtKey, time.Now().UTC().Format(time.RFC3339))
+	if _, err := r.kube.StorageV1().VolumeAttachments().Patch(ctx, va.Name, types.MergePatchType, []byte(patch), metav1.PatchOptions{}); err != nil {
+		klog.Errorf("Failed to annotate VolumeAttachment %s: %v", va.Name, err)
+	}
+}
+
+// forceDetach deletes the Cinder attachments of the volume to the deleted
+// server, and returns true if they are deleted.
+func (r *attachmentReconciler) forceDetach(ctx context.Context, cv cloudVolume, serverID string) bool {
+	if !r.opts.Repair {
+		return false
+	}
+
+	klog.Infof("Deleting the attachments of volume %s to the deleted server %s", cv.vol.ID, serverID)
+	if err := cv.cloud.DeleteVolumeAttachments(ctx, cv.vol.ID, serverID); err != nil {
+		klog.Errorf("Failed to delete the attachments of volume %s to server %s: %v", cv.vol.ID, serverID, err)
+		return false
+	}
+	return true
+}
+
+func isAttachedTo(vol *volumes.Volume, serverID string) bool {
+	for _, att := range vol.Attachments {
+		if att.ServerID == serverID {
+			return true
+		}
+	}
+	return false
+}
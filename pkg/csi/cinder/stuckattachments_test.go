@@ -0,0 +1,112 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
+)
+
+func TestReconcileStuckAttachments(t *testing.T) {
+	old := metav1.NewTime(time.Now().Add(-time.Hour))
+	cloudVolumes := []volumes.Volume{
+		// attached by Nova, but not reported as attached
+		{ID: "vol-attaching", Status: "in-use", Attachments: []volumes.Attachment{{ServerID: "node-a-id"}}},
+		// detached by Nova, but its VolumeAttachment is not deleted
+		{ID: "vol-detaching", Status: "available"},
+		// stuck in Cinder
+		{ID: "vol-reserved", Status: "reserved"},
+		{ID: "vol-new", Status: "available"},
+	}
+
+	pv := func(name, volumeID string) *corev1.PersistentVolume {
+		return &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: corev1.PersistentVolumeSpec{
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{Driver: driverName, VolumeHandle: volumeID},
+				},
+			},
+		}
+	}
+	va := func(name, pvName string, created metav1.Time, deleted *metav1.Time) *storagev1.VolumeAttachment {
+		va := &storagev1.VolumeAttachment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: created, DeletionTimestamp: deleted},
+			Spec: storagev1.VolumeAttachmentSpec{
+				Attacher: driverName,
+				NodeName: "node-a",
+				Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &pvName},
+			},
+		}
+		if deleted != nil {
+			va.Finalizers = []string{"external-attacher/cinder-csi-openstack-org"}
+		}
+		return va
+	}
+	objects := []runtime.Object{
+		pv("pv-attaching", "vol-attaching"),
+		pv("pv-detaching", "vol-detaching"),
+		pv("pv-reserved", "vol-reserved"),
+		pv("pv-new", "vol-new"),
+		&storagev1.CSINode{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+			Spec: storagev1.CSINodeSpec{
+				Drivers: []storagev1.CSINodeDriver{{Name: driverName, NodeID: "node-a-id"}},
+			},
+		},
+		va("va-attaching", "pv-attaching", old, nil),
+		va("va-detaching", "pv-detaching", old, &old),
+		va("va-reserved", "pv-reserved", old, nil),
+		va("va-new", "pv-new", metav1.Now(), nil),
+	}
+
+	for _, repair := range []bool{false, true} {
+		osmock := new(openstack.OpenStackMock)
+		osmock.On("ListVolumes", 0, "").Return(cloudVolumes, "", nil)
+
+		kube := fake.NewClientset(objects...)
+		d := NewDriver(&DriverOpts{Endpoint: FakeEndpoint, ClusterID: FakeCluster})
+		d.SetupControllerService(map[string]openstack.IOpenStack{"": osmock})
+		d.SetupStuckAttachmentReconciler(kube, StuckAttachmentOpts{Threshold: 10 * time.Minute, Repair: repair})
+
+		err := d.attachments.reconcile(FakeCtx)
+		assert.NoError(t, err)
+
+		for name, redriven := range map[string]bool{
+			"va-attaching": repair,
+			"va-detaching": repair,
+			// only an administrator can reset the status of the volume
+			"va-reserved": false,
+			"va-new":      false,
+		} {
+			va, err := kube.StorageV1().VolumeAttachments().Get(FakeCtx, name, metav1.GetOptions{})
+			assert.NoError(t, err)
+			_, ok := va.Annotations[reconciledAtKey]
+			assert.Equal(t, redriven, ok, "VolumeAttachment %s, repair: %t", name, repair)
+		}
+	}
+}
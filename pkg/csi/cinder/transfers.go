@@ -0,0 +1,149 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+
+	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
+	cpoerrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
+)
+
+const (
+	// transferVolumeKey is the PVC annotation of the ID of the volume
+	// transferred from another project
+	transferVolumeKey = "cinder.csi.openstack.org/transfer-volume"
+	// transferCloudKey is the PVC annotation of the name of the cloud, given
+	// with --cloud-name, whose credentials are scoped to the project the
+	// volume is transferred from
+	transferCloudKey = "cinder.csi.openstack.org/transfer-cloud"
+	// transferSourceCloudsKey is the StorageClass parameter of the comma
+	// separated names of the clouds the volumes may be transferred from. The
+	// volumes are not transferred when it is unset.
+	transferSourceCloudsKey = "transfer-source-clouds"
+	// transferredForKey is the volume metadata of the name of the CSI volume
+	// the volume is transferred for, set before the transfer
+	transferredForKey = "cinder.csi.openstack.org/transferred-for"
+)
+
+// createVolumeFromTransfer transfers an existing volume from the project of
+// the source cloud to the project of the cloud of the request, instead of
+// creating a new volume. The volume is marked with the name of the CSI volume
+// before it is transferred, so that a call retried after the transfer returns
+// the transferred volume, while the volumes of the project which were not
+// transferred for this CSI volume are not adopted.
+func (cs *controllerServer) createVolumeFromTransfer(ctx context.Context, cloud openstack.IOpenStack, volCloud, volName string, volParams map[string]string, srcCloudName, volumeID string, volSizeGB int, multiNode bool, accessibleTopologyReq *csi.TopologyRequirement) (*csi.CreateVolumeResponse, error) {
+	vol, err := cloud.GetVolume(ctx, volumeID)
+	switch {
+	case err == nil:
+		if vol.Metadata[transferredForKey] != volName {
+			return nil, status.Errorf(codes.FailedPrecondition, "[CreateVolume] volume %s already exists in the project and was not transferred for volume %s", volumeID, volName)
+		}
+		klog.V(4).Infof("CreateVolume: volume %s was already transferred", volumeID)
+	case cpoerrors.IsNotFound(err):
+		if vol, err = cs.transferVolumeFrom(ctx, cloud, volCloud, volName, volParams, srcCloudName, volumeID); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, status.Errorf(codes.Internal, "[CreateVolume] failed to get transferred volume %s: %v", volumeID, err)
+	}
+
+	if vol.Size < volSizeGB {
+		return nil, status.Errorf(codes.OutOfRange, "[CreateVolume] transferred volume %s of %d GiB is smaller than the requested %d GiB", volumeID, vol.Size, volSizeGB)
+	}
+	if multiNode && !vol.Multiattach {
+		return nil, status.Errorf(codes.InvalidArgument, "[CreateVolume] transferred volume %s does not support multiattach, which is required by the multi-node access mode", volumeID)
+	}
+
+	bsOpts := cloud.GetBlockStorageOpts()
+	accessibleTopology := getTopology(vol, accessibleTopologyReq, cs.Driver.withTopology, bsOpts)
+	return getCreateVolumeResponse(vol, nil, accessibleTopology), nil
+}
+
+// transferVolumeFrom checks that the volumes may be transferred from the
+// source cloud, marks the volume and transfers it to the project of the cloud
+// of the request.
+func (cs *controllerServer) transferVolumeFrom(ctx context.Context, cloud openstack.IOpenStack, volCloud, volName string, volParams map[string]string, srcCloudName, volumeID string) (*volumes.Volume, error) {
+	if srcCloudName == volCloud {
+		return nil, status.Errorf(codes.InvalidArgument, "[CreateVolume] the %s PVC annotation must be a cloud other than the cloud of the volume", transferCloudKey)
+	}
+	if !slices.Contains(strings.Split(volParams[transferSourceCloudsKey], ","), srcCloudName) {
+		return nil, status.Errorf(codes.InvalidArgument, "[CreateVolume] transfer cloud %q is not in the %s parameter of the StorageClass", srcCloudName, transferSourceCloudsKey)
+	}
+	srcCloud, ok := cs.Clouds[srcCloudName]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "[CreateVolume] transfer cloud %q undefined", srcCloudName)
+	}
+
+	vol, err := srcCloud.GetVolume(ctx, volumeID)
+	if err != nil {
+		if cpoerrors.IsNotFound(err) {
+			return nil, status.Errorf(codes.NotFound, "[CreateVolume] transfer volume %s not found", volumeID)
+		}
+		return nil, status.Errorf(codes.Internal, "[CreateVolume] failed to get transfer volume %s: %v", volumeID, err)
+	}
+
+	// the metadata is transferred with the volume
+	metadata := maps.Clone(vol.Metadata)
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	metadata[transferredForKey] = volName
+	metadata[cinderCSIClusterIDKey] = cs.Driver.clusterID
+	if err := srcCloud.UpdateVolumeMetadata(ctx, volumeID, metadata); err != nil {
+		return nil, status.Errorf(codes.Internal, "[CreateVolume] failed to mark transfer volume %s: %v", volumeID, err)
+	}
+
+	return transferVolume(ctx, srcCloud, cloud, vol)
+}
+
+// transferVolume transfers the volume from the project of the source cloud to
+// the project of the destination cloud, and returns the transferred volume.
+func transferVolume(ctx context.Context, srcCloud, dstCloud openstack.IOpenStack, vol *volumes.Volume) (*volumes.Volume, error) {
+	volumeID := vol.ID
+	if vol.Status != openstack.VolumeAvailableStatus {
+		return nil, status.Errorf(codes.FailedPrecondition, "[CreateVolume] transfer volume %s must be available, its status is %s", vol.ID, vol.Status)
+	}
+
+	transfer, err := srcCloud.CreateVolumeTransfer(ctx, vol.ID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "[CreateVolume] failed to create transfer of volume %s: %v", vol.ID, err)
+	}
+
+	if err := dstCloud.AcceptVolumeTransfer(ctx, transfer.ID, transfer.AuthKey); err != nil {
+		if err := srcCloud.DeleteVolumeTransfer(ctx, transfer.ID); err != nil {
+			klog.Errorf("Failed to delete transfer %s of volume %s: %v", transfer.ID, vol.ID, err)
+		}
+		return nil, status.Errorf(codes.Internal, "[CreateVolume] failed to accept transfer of volume %s: %v", vol.ID, err)
+	}
+	klog.V(2).Infof("CreateVolume: transferred volume %s", vol.ID)
+
+	vol, err = dstCloud.GetVolume(ctx, volumeID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "[CreateVolume] failed to get transferred volume %s: %v", volumeID, err)
+	}
+	return vol, nil
+}
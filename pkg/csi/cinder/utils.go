@@ -3,6 +3,7 @@ package cinder
 import (
 	"context"
 	"fmt"
+	"path"
 	"strings"
 	"sync/atomic"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/kubernetes-csi/csi-lib-utils/protosanitizer"
 	"google.golang.org/grpc"
 	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
 	"k8s.io/cloud-provider-openstack/pkg/util/metadata"
 	"k8s.io/cloud-provider-openstack/pkg/util/mount"
 	"k8s.io/klog/v2"
@@ -73,12 +75,6 @@ func NewNodeServer(d *Driver, mount mount.IMount, metadata metadata.IMetadata, o
 
 //revive:enable:unexported-return
 
-func RunServicesInitialized(endpoint string, ids csi.IdentityServer, cs csi.ControllerServer, ns csi.NodeServer) {
-	s := NewNonBlockingGRPCServer()
-	s.Start(endpoint, ids, cs, ns)
-	s.Wait()
-}
-
 func ParseEndpoint(ep string) (string, string, error) {
 	if strings.HasPrefix(strings.ToLower(ep), "unix://") || strings.HasPrefix(strings.ToLower(ep), "tcp://") {
 		s := strings.SplitN(ep, "://", 2)
@@ -104,6 +100,17 @@ func logGRPC(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, h
 	return resp, err
 }
 
+// observeGRPC records the latency and the result of the CSI RPCs
+func observeGRPC(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	mc := metrics.NewCSIMetricContext(path.Base(info.FullMethod))
+	resp, err := handler(ctx, req)
+	return resp, mc.ObserveCSIOperation(err)
+}
+
+// maxMetadataLength is the maximum length of the keys and the values of the
+// Cinder volume metadata
+const maxMetadataLength = 255
+
 func splitToken(str string) (string, string) {
 	i := strings.Index(str, ":")
 	if i == -1 {
@@ -20,12 +20,19 @@ import (
 	"bytes"
 	"context"
 	"flag"
+	"strings"
 	"testing"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/component-base/metrics/testutil"
 	"k8s.io/klog/v2"
 
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -145,6 +152,34 @@ func TestLogGRPC(t *testing.T) {
 		})
 	}
 }
+func TestObserveGRPC(t *testing.T) {
+	metrics.RegisterMetrics("cinder-csi")
+
+	info := grpc.UnaryServerInfo{
+		FullMethod: "/csi.v1.Controller/ControllerExpandVolume",
+	}
+	ok := func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil }
+	notFound := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "volume not found")
+	}
+
+	_, _ = observeGRPC(context.Background(), nil, &info, ok)
+	_, err := observeGRPC(context.Background(), nil, &info, notFound)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	expected := `
+# HELP csi_operation_errors_total [ALPHA] Total number of errors for a CSI RPC served by the plugin
+# TYPE csi_operation_errors_total counter
+csi_operation_errors_total{grpc_code="NotFound",method="ControllerExpandVolume"} 1
+# HELP csi_operations_total [ALPHA] Total number of CSI RPCs served by the plugin
+# TYPE csi_operations_total counter
+csi_operations_total{grpc_code="NotFound",method="ControllerExpandVolume"} 1
+csi_operations_total{grpc_code="OK",method="ControllerExpandVolume"} 1
+`
+	err = testutil.GatherAndCompare(legacyregistry.DefaultGatherer, strings.NewReader(expected), "csi_operations_total", "csi_operation_errors_total")
+	assert.NoError(t, err)
+}
+
 func TestSplitToken(t *testing.T) {
 	tests := []struct {
 		input string
@@ -0,0 +1,97 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cinder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// virtioBlkVolumeAttachLimit is the number of virtio-blk disks a libvirt
+	// server can have, each of them uses one of the 32 PCI slots and the
+	// other devices use the remaining ones
+	virtioBlkVolumeAttachLimit = 26
+	// virtioSCSIVolumeAttachLimit is the number of disks a virtio-scsi
+	// controller can have
+	virtioSCSIVolumeAttachLimit = maxVolumesPerNode
+)
+
+// sysBlockPath is where the block devices of the node are listed
+var sysBlockPath = "/sys/block"
+
+// detectVolumeAttachLimit returns the maximum number of volumes which can be
+// attached to the node according to the bus of its disks. The local disks of
+// the server, which have no serial since they are not Cinder volumes, are not
+// available to the volumes and are deducted from the limit of the bus.
+func detectVolumeAttachLimit() (int64, error) {
+	entries, err := os.ReadDir(sysBlockPath)
+	if err != nil {
+		return 0, err
+	}
+
+	var virtioBlk, scsi bool
+	var localDisks int64
+	for _, e := range entries {
+		name := e.Name()
+		switch {
+		case strings.HasPrefix(name, "vd"):
+			virtioBlk = true
+			serial, err := os.ReadFile(filepath.Join(sysBlockPath, name, "serial"))
+			if err != nil || strings.TrimSpace(string(serial)) == "" {
+				localDisks++
+			}
+		case strings.HasPrefix(name, "sd"):
+			scsi = true
+		}
+	}
+
+	var limit int64
+	switch {
+	case virtioBlk:
+		// volumes are attached on the bus of the root disk, which is the
+		// virtio-blk one when both buses are in use
+		limit = virtioBlkVolumeAttachLimit
+	case scsi:
+		limit = virtioSCSIVolumeAttachLimit
+	default:
+		return 0, fmt.Errorf("no virtio-blk or SCSI disk found in %s", sysBlockPath)
+	}
+
+	klog.V(4).Infof("Detected a volume attach limit of %d, with %d local disks", limit, localDisks)
+	return max(limit-localDisks, 1), nil
+}
+
+// nodeVolumeAttachLimit returns the maximum number of volumes which can be
+// attached to the node. The configured limit takes precedence over the
+// detected one.
+func (ns *nodeServer) nodeVolumeAttachLimit() int64 {
+	if ns.Opts.NodeVolumeAttachLimit > 0 || !ns.Opts.NodeVolumeAttachLimitAuto {
+		return ns.Opts.NodeVolumeAttachLimit
+	}
+
+	limit, err := detectVolumeAttachLimit()
+	if err != nil {
+		klog.Warningf("Failed to detect the volume attach limit of the node: %v", err)
+		return maxVolumesPerNode
+	}
+	return limit
+}
@@ -20,14 +20,18 @@ import (
 	"context"
 	"math/rand"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog/v2"
@@ -116,6 +120,74 @@ func GetPVCLister() v1.PersistentVolumeClaimLister {
 		return nil
 	}
 
+	clientset := GetKubeClient()
+
+	factory := informers.NewSharedInformerFactory(clientset, resyncPeriod(minResyncPeriod))
+	ctx := context.TODO()
+	pvcInformer := factory.Core().V1().PersistentVolumeClaims().Informer()
+	go pvcInformer.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), pvcInformer.HasSynced) {
+		klog.Fatal("Error syncing PVC informer cache")
+	}
+
+	klog.Info("Successully created PVC Annotations Lister")
+
+	return factory.Core().V1().PersistentVolumeClaims().Lister()
+}
+
+// GetNodeLister returns a lister of the nodes, to find the zone of the nodes
+// the PVCs are scheduled to. Like the PVC lister, it requires --pvc-annotations.
+func GetNodeLister() v1.NodeLister {
+	if !pvcAnnotations {
+		return nil
+	}
+
+	return NewNodeLister()
+}
+
+// NewNodeLister returns a lister of all the nodes of the cluster.
+func NewNodeLister() v1.NodeLister {
+	clientset := GetKubeClient()
+
+	factory := informers.NewSharedInformerFactory(clientset, resyncPeriod(minResyncPeriod))
+	ctx := context.TODO()
+	nodeInformer := factory.Core().V1().Nodes().Informer()
+	go nodeInformer.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), nodeInformer.HasSynced) {
+		klog.Fatal("Error syncing node informer cache")
+	}
+
+	klog.Info("Successfully created node Lister")
+
+	return factory.Core().V1().Nodes().Lister()
+}
+
+// GetKubeClient returns a Kubernetes client configured with the k8s client
+// options.
+func GetKubeClient() kubernetes.Interface {
+	config := getKubeConfig()
+	config.ContentType = runtime.ContentTypeProtobuf
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		klog.Fatalf("Failed to create client: %v", err)
+	}
+
+	return clientset
+}
+
+// GetKubeMetadataClient returns a client of the metadata of the Kubernetes
+// objects, e.g. of the custom resources which have no typed client, configured
+// with the k8s client options.
+func GetKubeMetadataClient() metadata.Interface {
+	client, err := metadata.NewForConfig(getKubeConfig())
+	if err != nil {
+		klog.Fatalf("Failed to create metadata client: %v", err)
+	}
+
+	return client
+}
+
+func getKubeConfig() *rest.Config {
 	// get the KUBECONFIG from env if specified (useful for local/debug cluster)
 	kubeconfigEnv := os.Getenv("KUBECONFIG")
 
@@ -132,28 +204,23 @@ func GetPVCLister() v1.PersistentVolumeClaimLister {
 	config.QPS = kubeAPIQPS
 	config.Burst = kubeAPIBurst
 
-	config.ContentType = runtime.ContentTypeProtobuf
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		klog.Fatalf("Failed to create client: %v", err)
-	}
-
-	factory := informers.NewSharedInformerFactory(clientset, resyncPeriod(minResyncPeriod))
-	ctx := context.TODO()
-	pvcInformer := factory.Core().V1().PersistentVolumeClaims().Informer()
-	go pvcInformer.Run(ctx.Done())
-	if !cache.WaitForCacheSync(ctx.Done(), pvcInformer.HasSynced) {
-		klog.Fatal("Error syncing PVC informer cache")
-	}
-
-	klog.Info("Successully created PVC Annotations Lister")
-
-	return factory.Core().V1().PersistentVolumeClaims().Lister()
+	return config
 }
 
 // GetPVCAnnotations returns PVC annotations for the given PVC name and
 // namespace stored in the params map.
 func GetPVCAnnotations(pvcLister v1.PersistentVolumeClaimLister, params map[string]string) map[string]string {
+	pvc := GetPVC(pvcLister, params)
+	if pvc == nil {
+		return nil
+	}
+
+	return pvc.Annotations
+}
+
+// GetPVC returns the PVC for the given PVC name and namespace stored in the
+// params map, or nil if the PVC lister is disabled or the PVC is not found.
+func GetPVC(pvcLister v1.PersistentVolumeClaimLister, params map[string]string) *corev1.PersistentVolumeClaim {
 	if pvcLister == nil {
 		return nil
 	}
@@ -171,7 +238,50 @@ func GetPVCAnnotations(pvcLister v1.PersistentVolumeClaimLister, params map[stri
 		return nil
 	}
 
-	return pvc.Annotations
+	return pvc
+}
+
+// GetPVCMetadata returns the PVC labels and annotations matching the given
+// keys. A key ending with "*" matches all the keys with the given prefix. The
+// annotations override the labels with the same key. The labels and the
+// annotations whose key or value is longer than the given maximum lengths are
+// skipped.
+func GetPVCMetadata(pvc *corev1.PersistentVolumeClaim, annotationKeys, labelKeys []string, maxKeyLength, maxValueLength int) map[string]string {
+	properties := make(map[string]string)
+	for _, src := range []struct {
+		values map[string]string
+		keys   []string
+	}{
+		{pvc.Labels, labelKeys},
+		{pvc.Annotations, annotationKeys},
+	} {
+		for k, v := range src.values {
+			if !matchKey(src.keys, k) {
+				continue
+			}
+			if len(k) > maxKeyLength || len(v) > maxValueLength {
+				klog.Warningf("Skipping PVC %s/%s metadata %q: the key and the value must not be longer than %d and %d characters", pvc.Namespace, pvc.Name, k, maxKeyLength, maxValueLength)
+				continue
+			}
+			properties[k] = v
+		}
+	}
+	return properties
+}
+
+// matchKey returns true if the key is one of the keys, or has the prefix of
+// one of the keys ending with "*".
+func matchKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if prefix, ok := strings.CutSuffix(k, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if k == key {
+			return true
+		}
+	}
+	return false
 }
 
 // resyncPeriod generates a random duration so that multiple controllers don't
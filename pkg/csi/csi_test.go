@@ -0,0 +1,57 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csi
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetPVCMetadata(t *testing.T) {
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pvc",
+			Namespace: "default",
+			Labels: map[string]string{
+				"app":                      "db",
+				"billing.example.com/team": "label-team",
+				"tier":                     "backend",
+			},
+			Annotations: map[string]string{
+				"billing.example.com/team":   "storage",
+				"billing.example.com/center": "42",
+				"billing.example.com/long":   strings.Repeat("x", 11),
+				"other.example.com/key":      "ignored",
+			},
+		},
+	}
+
+	metadata := GetPVCMetadata(pvc, []string{"billing.example.com/*"}, []string{"app", "billing.example.com/team"}, 255, 10)
+
+	expected := map[string]string{
+		"app":                        "db",
+		"billing.example.com/team":   "storage",
+		"billing.example.com/center": "42",
+	}
+	if !reflect.DeepEqual(metadata, expected) {
+		t.Errorf("expected metadata %v, got %v", expected, metadata)
+	}
+}
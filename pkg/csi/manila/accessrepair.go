@@ -0,0 +1,170 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shares"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
+	clouderrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
+	"k8s.io/klog/v2"
+)
+
+// runAccessRepair periodically reconciles the NFS access rules of the shares derived from the
+// node subnets or addresses with the current nodes, until ctx is done. It is not gated by a
+// leader election, so it requires a single replica of the controller.
+func (d *Driver) runAccessRepair(ctx context.Context) {
+	klog.Infof("Repairing the NFS access rules of the shares every %v", d.accessRepairInterval)
+
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		manilaClient, err := newManilaClientFromSecret(ctx, d.kubeClient, d.manilaClientBuilder, d.accessRepairSecretNamespace, d.accessRepairSecretName)
+		if err != nil {
+			klog.Errorf("access repair: %v", err)
+			return
+		}
+
+		if err := d.repairShareAccess(ctx, manilaClient); err != nil {
+			klog.Errorf("access repair: %v", err)
+		}
+	}, d.accessRepairInterval)
+}
+
+// repairShareAccess grants the NFS access to the nodes missing from the access rules of the
+// available shares of the cluster created with the nfs-shareClientSource nodeSubnets or
+// nodeAddresses, and revokes the access rules within the nfs-shareClient networks which no
+// longer match any node. The shares without a node address to grant access to are skipped.
+func (d *Driver) repairShareAccess(ctx context.Context, manilaClient manilaclient.Interface) error {
+	nodes, err := d.nodeLister.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %v", err)
+	}
+
+	ss, err := manilaClient.GetShares(ctx, shares.ListOpts{
+		Status:   shareAvailable,
+		Metadata: map[string]string{clusterMetadataKey: d.clusterID},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list shares: %v", err)
+	}
+
+	ips := nodeAddresses(nodes)
+
+	var subnetCIDRs []string
+
+	for i := range ss {
+		share := &ss[i]
+
+		source := share.Metadata[shareClientSourceMetadataKey]
+		if !strings.EqualFold(share.ShareProto, "NFS") || (source != shareClientSourceNodeSubnets && source != shareClientSourceNodeAddresses) {
+			continue
+		}
+
+		var shareSubnetCIDRs []string
+		if source == shareClientSourceNodeSubnets {
+			if subnetCIDRs == nil {
+				if subnetCIDRs, err = manilaClient.GetSubnetCIDRs(ctx); err != nil {
+					return fmt.Errorf("failed to list subnets: %v", err)
+				}
+				// A nil list of subnets would grant the access to the node addresses
+				subnetCIDRs = append([]string{}, subnetCIDRs...)
+			}
+			shareSubnetCIDRs = subnetCIDRs
+		}
+
+		if err := repairShareAccessRules(ctx, manilaClient, share, ips, shareSubnetCIDRs); err != nil {
+			klog.Errorf("access repair: share %s: %v", share.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func repairShareAccessRules(ctx context.Context, manilaClient manilaclient.Interface, share *shares.Share, ips []net.IP, subnetCIDRs []string) error {
+	allowed, err := parseCIDRs(share.Metadata[shareClientMetadataKey])
+	if err != nil {
+		return fmt.Errorf("invalid %s metadata: %v", shareClientMetadataKey, err)
+	}
+
+	desired, err := nodeShareClients(ips, subnetCIDRs, allowed)
+	if err != nil {
+		return fmt.Errorf("failed to parse subnets: %v", err)
+	}
+
+	if len(desired) == 0 {
+		klog.Warningf("access repair: skipping share %s, no node address within %s to grant access to", share.ID, share.Metadata[shareClientMetadataKey])
+		return nil
+	}
+
+	rights, err := manilaClient.GetAccessRights(ctx, share.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list access rights: %v", err)
+	}
+
+	granted := make(map[string]bool)
+
+	for _, right := range rights {
+		if right.AccessType != "ip" {
+			continue
+		}
+
+		n, err := parseCIDRs(right.AccessTo)
+		if err != nil || len(n) != 1 {
+			klog.Warningf("access repair: ignoring access rule %s of share %s with invalid address %q", right.ID, share.ID, right.AccessTo)
+			continue
+		}
+
+		client := n[0].String()
+		granted[client] = true
+
+		if slices.Contains(desired, client) || !slices.ContainsFunc(allowed, func(a *net.IPNet) bool { return containsNetwork(a, n[0]) }) {
+			continue
+		}
+
+		klog.Infof("access repair: revoking the access of %s to share %s, it matches no node", right.AccessTo, share.ID)
+
+		err = manilaClient.RevokeAccess(ctx, share.ID, shares.RevokeAccessOpts{AccessID: right.ID})
+		if err != nil && !clouderrors.IsNotFound(err) {
+			return fmt.Errorf("failed to revoke access right %s: %v", right.ID, err)
+		}
+	}
+
+	for _, client := range desired {
+		if granted[client] {
+			continue
+		}
+
+		klog.Infof("access repair: granting the access of %s to share %s", client, share.ID)
+
+		_, err := manilaClient.GrantAccess(ctx, share.ID, shares.GrantAccessOpts{
+			AccessType:  "ip",
+			AccessLevel: "rw",
+			AccessTo:    client,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to grant access right to %s: %v", client, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shares"
+	corev1 "k8s.io/api/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
+)
+
+// fakeAccessRepairClient lists the shares of the cluster and records the granted and revoked
+// access rules. The calls it doesn't implement panic.
+type fakeAccessRepairClient struct {
+	manilaclient.Interface
+
+	shares      []shares.Share
+	rights      map[string][]shares.AccessRight
+	subnetCIDRs []string
+
+	granted map[string][]string
+	revoked map[string][]string
+}
+
+func (c *fakeAccessRepairClient) GetShares(_ context.Context, opts shares.ListOptsBuilder) ([]shares.Share, error) {
+	listOpts := opts.(shares.ListOpts)
+
+	var ss []shares.Share
+	for _, s := range c.shares {
+		if s.Status == listOpts.Status && s.Metadata[clusterMetadataKey] == listOpts.Metadata[clusterMetadataKey] {
+			ss = append(ss, s)
+		}
+	}
+	return ss, nil
+}
+
+func (c *fakeAccessRepairClient) GetAccessRights(_ context.Context, shareID string) ([]shares.AccessRight, error) {
+	return c.rights[shareID], nil
+}
+
+func (c *fakeAccessRepairClient) GrantAccess(_ context.Context, shareID string, opts shares.GrantAccessOptsBuilder) (*shares.AccessRight, error) {
+	grantOpts := opts.(shares.GrantAccessOpts)
+	c.granted[shareID] = append(c.granted[shareID], grantOpts.AccessTo)
+	return &shares.AccessRight{ShareID: shareID, AccessType: grantOpts.AccessType, AccessTo: grantOpts.AccessTo, AccessLevel: grantOpts.AccessLevel}, nil
+}
+
+func (c *fakeAccessRepairClient) RevokeAccess(_ context.Context, shareID string, opts shares.RevokeAccessOptsBuilder) error {
+	c.revoked[shareID] = append(c.revoked[shareID], opts.(shares.RevokeAccessOpts).AccessID)
+	return nil
+}
+
+func (c *fakeAccessRepairClient) GetSubnetCIDRs(_ context.Context) ([]string, error) {
+	return c.subnetCIDRs, nil
+}
+
+func newNodeLister(t *testing.T, nodes ...*corev1.Node) corev1listers.NodeLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, node := range nodes {
+		if err := indexer.Add(node); err != nil {
+			t.Fatalf("failed to add node %s: %v", node.Name, err)
+		}
+	}
+	return corev1listers.NewNodeLister(indexer)
+}
+
+func TestRepairShareAccess(t *testing.T) {
+	metadata := func(source, shareClient string) map[string]string {
+		return map[string]string{clusterMetadataKey: "cluster", shareClientSourceMetadataKey: source, shareClientMetadataKey: shareClient}
+	}
+
+	c := &fakeAccessRepairClient{
+		shares: []shares.Share{
+			{ID: "addresses", Status: shareAvailable, ShareProto: "NFS", Metadata: metadata(shareClientSourceNodeAddresses, "10.0.0.0/16")},
+			{ID: "subnets", Status: shareAvailable, ShareProto: "NFS", Metadata: metadata(shareClientSourceNodeSubnets, "0.0.0.0/0")},
+			{ID: "no-node-within", Status: shareAvailable, ShareProto: "NFS", Metadata: metadata(shareClientSourceNodeAddresses, "192.168.0.0/16")},
+			{ID: "share-client", Status: shareAvailable, ShareProto: "NFS", Metadata: map[string]string{clusterMetadataKey: "cluster"}},
+			{ID: "other-cluster", Status: shareAvailable, ShareProto: "NFS", Metadata: map[string]string{shareClientSourceMetadataKey: shareClientSourceNodeAddresses, shareClientMetadataKey: "10.0.0.0/16"}},
+		},
+		rights: map[string][]shares.AccessRight{
+			"addresses": {
+				{ID: "kept", AccessType: "ip", AccessTo: "10.0.0.10"},
+				{ID: "dead", AccessType: "ip", AccessTo: "10.0.0.11/32"},
+				{ID: "outside", AccessType: "ip", AccessTo: "172.16.0.1"},
+				{ID: "cert", AccessType: "cert", AccessTo: "client"},
+			},
+			"subnets": {
+				{ID: "old-subnet", AccessType: "ip", AccessTo: "10.1.0.0/24"},
+			},
+			"no-node-within": {
+				{ID: "dead", AccessType: "ip", AccessTo: "192.168.0.10"},
+			},
+		},
+		subnetCIDRs: []string{"10.0.0.0/24", "10.0.1.0/24"},
+		granted:     make(map[string][]string),
+		revoked:     make(map[string][]string),
+	}
+
+	d := &Driver{
+		clusterID: "cluster",
+		nodeLister: newNodeLister(t,
+			newNode("node-1", corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.10"}),
+			newNode("node-3", corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.1.12"}),
+		),
+	}
+
+	if err := d.repairShareAccess(context.Background(), c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedGranted := map[string][]string{
+		"addresses": {"10.0.1.12/32"},
+		"subnets":   {"10.0.0.0/24", "10.0.1.0/24"},
+	}
+	expectedRevoked := map[string][]string{
+		"addresses": {"dead"},
+		"subnets":   {"old-subnet"},
+	}
+
+	for _, m := range []map[string][]string{c.granted, c.revoked} {
+		for _, v := range m {
+			slices.Sort(v)
+		}
+	}
+
+	if !reflect.DeepEqual(c.granted, expectedGranted) {
+		t.Errorf("expected granted access rules %v, got %v", expectedGranted, c.granted)
+	}
+
+	if !reflect.DeepEqual(c.revoked, expectedRevoked) {
+		t.Errorf("expected revoked access rules %v, got %v", expectedRevoked, c.revoked)
+	}
+}
@@ -31,6 +31,8 @@ func getShareAdapter(proto string) shareadapters.ShareAdapter {
 		return &shareadapters.Cephfs{}
 	case "NFS":
 		return &shareadapters.NFS{}
+	case "CIFS":
+		return &shareadapters.CIFS{}
 	default:
 		klog.Fatalf("unknown share adapter %s", proto)
 	}
@@ -69,6 +71,10 @@ func getAccessRightBasedOnShareAdapter(shareAdapter shareadapters.ShareAdapter,
 		// For NFS, we don't need to use an access right specifically. The controller is
 		// already making sure the access rules are properly created.
 		return nil
+	case *shareadapters.CIFS:
+		// For CIFS, the node authenticates with the SMB credentials of the node stage secret,
+		// whose user is granted access by the controller.
+		return nil
 	default:
 		klog.Fatalf("unknown share adapter type %T", shareAdapter)
 	}
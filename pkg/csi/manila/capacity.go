@@ -0,0 +1,259 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/schedulerstats"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/services"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/options"
+	"k8s.io/klog/v2"
+)
+
+// Binary of the Manila services which host the pools
+const manilaShareServiceBinary = "manila-share"
+
+// shareCapacity is the capacity left for new shares, in GiB. A negative value is unlimited.
+type shareCapacity struct {
+	available int
+	maximum   int
+}
+
+var unlimitedCapacity = shareCapacity{available: -1, maximum: -1}
+
+func (c shareCapacity) limitTo(o shareCapacity) shareCapacity {
+	minGiB := func(a, b int) int {
+		if a < 0 {
+			return b
+		}
+		if b < 0 {
+			return a
+		}
+		return min(a, b)
+	}
+
+	return shareCapacity{
+		available: minGiB(c.available, o.available),
+		maximum:   minGiB(c.maximum, o.maximum),
+	}
+}
+
+// quotaCapacity returns the capacity left by the share quotas of the project.
+func quotaCapacity(limits *manilaclient.Limits) shareCapacity {
+	if limits.MaxTotalShares >= 0 && limits.TotalSharesUsed >= limits.MaxTotalShares {
+		return shareCapacity{}
+	}
+
+	c := unlimitedCapacity
+	if limits.MaxTotalShareGigabytes >= 0 {
+		left := max(limits.MaxTotalShareGigabytes-limits.TotalShareGigabytesUsed, 0)
+		c = shareCapacity{available: left, maximum: left}
+	}
+
+	// The per share gigabytes quota limits the size of a single share only
+	if limits.MaxPerShareGigabytes > 0 {
+		c = c.limitTo(shareCapacity{available: -1, maximum: limits.MaxPerShareGigabytes})
+	}
+
+	return c
+}
+
+// poolsCapacity returns the capacity left in the pools. If hostZones is not nil,
+// only the pools of the hosts in the availability zone az are counted.
+func poolsCapacity(pools []schedulerstats.Pool, hostZones map[string]string, az string) shareCapacity {
+	var c shareCapacity
+
+	for _, p := range pools {
+		host, _, _ := strings.Cut(p.Name, "#")
+		if hostZones != nil {
+			if zone, ok := hostZones[host]; !ok || (az != "" && zone != az) {
+				continue
+			}
+		}
+
+		caps := p.Capabilities
+		if math.IsInf(caps.FreeCapacityGB, 1) {
+			return unlimitedCapacity
+		}
+
+		free := int(caps.FreeCapacityGB - caps.TotalCapacityGB*float64(caps.ReservedPercentage)/100)
+		if free <= 0 {
+			continue
+		}
+
+		c.available += free
+		c.maximum = max(c.maximum, free)
+	}
+
+	return c
+}
+
+// getHostZones returns the availability zones of the Manila share hosts which are up and enabled.
+func getHostZones(ctx context.Context, manilaClient manilaclient.Interface) (map[string]string, error) {
+	svcs, err := manilaClient.GetServices(ctx, services.ListOpts{Binary: manilaShareServiceBinary})
+	if err != nil {
+		return nil, err
+	}
+
+	hostZones := make(map[string]string, len(svcs))
+	for _, svc := range svcs {
+		if svc.State == "up" && svc.Status == "enabled" {
+			hostZones[svc.Host] = svc.Zone
+		}
+	}
+
+	return hostZones, nil
+}
+
+// capacityAvailabilityZone returns the Manila availability zone of the shares created
+// with shareOpts in the accessible topology, or an empty string if any zone may be chosen.
+// It returns false if no share can be created in the accessible topology.
+func capacityAvailabilityZone(withTopology bool, topology *csi.Topology, shareOpts *options.ControllerVolumeContext, zoneMap map[string]string) (string, bool) {
+	if shareOpts.AvailabilityZone != "" {
+		return shareOpts.AvailabilityZone, true
+	}
+
+	if !withTopology || topology == nil || !strings.EqualFold(shareOpts.AutoTopology, "true") {
+		return "", true
+	}
+
+	computeAZ, ok := topology.GetSegments()[topologyKey]
+	if !ok {
+		return "", true
+	}
+
+	if len(zoneMap) > 0 {
+		manilaAZ, ok := zoneMap[computeAZ]
+		return manilaAZ, ok
+	}
+
+	return computeAZ, true
+}
+
+func (cs *controllerServer) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
+	if cs.d.capacitySecretName == "" {
+		return nil, status.Error(codes.Unimplemented, "capacity reporting is disabled, set the --capacity-secret flag to enable it")
+	}
+
+	params := make(map[string]string, len(req.GetParameters())+1)
+	for k, v := range req.GetParameters() {
+		params[k] = v
+	}
+
+	params["protocol"] = cs.d.shareProto
+
+	shareOpts, err := options.NewControllerVolumeContext(params)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid volume parameters: %v", err)
+	}
+
+	zoneMap, err := parseZoneMap(shareOpts.AutoTopologyZoneMap)
+	if err != nil {
+		return nil, err
+	}
+
+	// GetCapacity requests carry no secrets, the credentials are read from the capacity secret
+	manilaClient, err := newManilaClientFromSecret(ctx, cs.d.kubeClient, cs.d.manilaClientBuilder, cs.d.capacitySecretNamespace, cs.d.capacitySecretName)
+	if err != nil {
+		return nil, err
+	}
+
+	var c shareCapacity
+
+	if shareOpts.ParentShareID != "" {
+		// The subdirectory volumes are allotted the size of the parent share
+
+		share, err := getParentShare(ctx, manilaClient, shareOpts.ParentShareID, cs.d.shareProto)
+		if err != nil {
+			return nil, err
+		}
+
+		_, total := subdirSizes(share)
+		left := max(share.Size-total, 0)
+		c = shareCapacity{available: left, maximum: left}
+	} else {
+		az, ok := capacityAvailabilityZone(cs.d.withTopology, req.GetAccessibleTopology(), shareOpts, zoneMap)
+		if !ok {
+			klog.V(4).Infof("GetCapacity: no Manila availability zone is mapped to the topology %v", req.GetAccessibleTopology().GetSegments())
+			return &csi.GetCapacityResponse{}, nil
+		}
+
+		if c, err = getShareCapacity(ctx, manilaClient, shareOpts.Type, az); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to retrieve the capacity of share type %s: %v", shareOpts.Type, err)
+		}
+	}
+
+	resp := &csi.GetCapacityResponse{
+		AvailableCapacity: math.MaxInt64,
+	}
+
+	if c.available >= 0 {
+		resp.AvailableCapacity = int64(c.available) * bytesInGiB
+	}
+
+	if c.maximum >= 0 {
+		resp.MaximumVolumeSize = wrapperspb.Int64(int64(c.maximum) * bytesInGiB)
+	}
+
+	return resp, nil
+}
+
+// getShareCapacity returns the capacity left for the shares of the share type in the availability
+// zone az, limited by the share quotas of the project and, if they can be listed, by the free
+// capacity of the pools.
+func getShareCapacity(ctx context.Context, manilaClient manilaclient.Interface, shareType, az string) (shareCapacity, error) {
+	limits, err := manilaClient.GetLimits(ctx)
+	if err != nil {
+		return shareCapacity{}, err
+	}
+
+	c := quotaCapacity(limits)
+
+	pools, err := manilaClient.GetPools(ctx, schedulerstats.ListDetailOpts{ShareType: shareType})
+	if err != nil {
+		if gophercloud.ResponseCodeIs(err, http.StatusForbidden) {
+			klog.V(4).Infof("GetCapacity: not allowed to list the pools, reporting the share quotas only: %v", err)
+			return c, nil
+		}
+
+		return shareCapacity{}, err
+	}
+
+	var hostZones map[string]string
+	if az != "" {
+		if hostZones, err = getHostZones(ctx, manilaClient); err != nil {
+			if gophercloud.ResponseCodeIs(err, http.StatusForbidden) {
+				klog.V(4).Infof("GetCapacity: not allowed to list the services, reporting the share quotas only: %v", err)
+				return c, nil
+			}
+
+			return shareCapacity{}, err
+		}
+	}
+
+	return c.limitTo(poolsCapacity(pools, hostZones, az)), nil
+}
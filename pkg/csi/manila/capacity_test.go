@@ -0,0 +1,143 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/schedulerstats"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/services"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/options"
+)
+
+// fakeCapacityClient serves the limits, the pools and the services. The pools and the services
+// are forbidden if nil. The calls it doesn't implement panic.
+type fakeCapacityClient struct {
+	manilaclient.Interface
+
+	limits   manilaclient.Limits
+	pools    []schedulerstats.Pool
+	services []services.Service
+}
+
+func (c *fakeCapacityClient) GetLimits(_ context.Context) (*manilaclient.Limits, error) {
+	l := c.limits
+	return &l, nil
+}
+
+func (c *fakeCapacityClient) GetPools(_ context.Context, opts schedulerstats.ListDetailOptsBuilder) ([]schedulerstats.Pool, error) {
+	if c.pools == nil {
+		return nil, gophercloud.ErrUnexpectedResponseCode{Actual: 403}
+	}
+	return c.pools, nil
+}
+
+func (c *fakeCapacityClient) GetServices(_ context.Context, opts services.ListOptsBuilder) ([]services.Service, error) {
+	if c.services == nil {
+		return nil, gophercloud.ErrUnexpectedResponseCode{Actual: 403}
+	}
+	return c.services, nil
+}
+
+func newPool(name string, free, total float64, reserved int64) schedulerstats.Pool {
+	return schedulerstats.Pool{
+		Name: name,
+		Capabilities: schedulerstats.Capabilities{
+			FreeCapacityGB:     free,
+			TotalCapacityGB:    total,
+			ReservedPercentage: reserved,
+		},
+	}
+}
+
+func TestGetShareCapacity(t *testing.T) {
+	pools := []schedulerstats.Pool{
+		newPool("host-a@backend#pool-1", 100, 1000, 5), // 50 GiB left after the reserved capacity
+		newPool("host-a@backend#pool-2", 30, 100, 0),
+		newPool("host-b@backend#pool-1", 200, 200, 0),
+		newPool("host-c@backend#pool-1", 500, 500, 0), // Down
+	}
+	svcs := []services.Service{
+		{Host: "host-a@backend", Zone: "zone-a", State: "up", Status: "enabled"},
+		{Host: "host-b@backend", Zone: "zone-b", State: "up", Status: "enabled"},
+		{Host: "host-c@backend", Zone: "zone-a", State: "down", Status: "enabled"},
+	}
+	unlimited := manilaclient.Limits{MaxTotalShareGigabytes: -1, MaxTotalShares: -1}
+
+	ts := []struct {
+		name     string
+		client   *fakeCapacityClient
+		az       string
+		expected shareCapacity
+	}{
+		{name: "unlimited", client: &fakeCapacityClient{limits: unlimited}, expected: unlimitedCapacity},
+		{name: "quota", client: &fakeCapacityClient{limits: manilaclient.Limits{MaxTotalShareGigabytes: 100, TotalShareGigabytesUsed: 40, MaxTotalShares: -1}}, expected: shareCapacity{available: 60, maximum: 60}},
+		{name: "per share quota", client: &fakeCapacityClient{limits: manilaclient.Limits{MaxTotalShareGigabytes: 100, TotalShareGigabytesUsed: 40, MaxTotalShares: -1, MaxPerShareGigabytes: 20}}, expected: shareCapacity{available: 60, maximum: 20}},
+		{name: "per share quota only", client: &fakeCapacityClient{limits: manilaclient.Limits{MaxTotalShareGigabytes: -1, MaxTotalShares: -1, MaxPerShareGigabytes: 20}}, expected: shareCapacity{available: -1, maximum: 20}},
+		{name: "share count quota exceeded", client: &fakeCapacityClient{limits: manilaclient.Limits{MaxTotalShareGigabytes: -1, MaxTotalShares: 10, TotalSharesUsed: 10}}, expected: shareCapacity{}},
+		{name: "all the pools", client: &fakeCapacityClient{limits: unlimited, pools: pools}, expected: shareCapacity{available: 780, maximum: 500}},
+		{name: "pools of the zone", client: &fakeCapacityClient{limits: unlimited, pools: pools, services: svcs}, az: "zone-a", expected: shareCapacity{available: 80, maximum: 50}},
+		{name: "pools of the zone limited by the quota", client: &fakeCapacityClient{limits: manilaclient.Limits{MaxTotalShareGigabytes: 100, TotalShareGigabytesUsed: 60, MaxTotalShares: -1}, pools: pools, services: svcs}, az: "zone-a", expected: shareCapacity{available: 40, maximum: 40}},
+		{name: "services forbidden", client: &fakeCapacityClient{limits: unlimited, pools: pools}, az: "zone-a", expected: unlimitedCapacity},
+		{name: "infinite pool", client: &fakeCapacityClient{limits: unlimited, pools: []schedulerstats.Pool{newPool("host-a@backend#pool-1", math.Inf(1), math.Inf(1), 0)}}, expected: unlimitedCapacity},
+	}
+
+	for _, tt := range ts {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := getShareCapacity(context.Background(), tt.client, "default", tt.az)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if c != tt.expected {
+				t.Errorf("expected capacity %+v, got %+v", tt.expected, c)
+			}
+		})
+	}
+}
+
+func TestCapacityAvailabilityZone(t *testing.T) {
+	topology := &csi.Topology{Segments: map[string]string{topologyKey: "nova-a"}}
+
+	ts := []struct {
+		name       string
+		shareOpts  options.ControllerVolumeContext
+		zoneMap    map[string]string
+		expectedAZ string
+		expectedOK bool
+	}{
+		{name: "availability", shareOpts: options.ControllerVolumeContext{AvailabilityZone: "manila-a", AutoTopology: "true"}, expectedAZ: "manila-a", expectedOK: true},
+		{name: "no autoTopology", shareOpts: options.ControllerVolumeContext{AutoTopology: "false"}, expectedOK: true},
+		{name: "autoTopology", shareOpts: options.ControllerVolumeContext{AutoTopology: "true"}, expectedAZ: "nova-a", expectedOK: true},
+		{name: "mapped zone", shareOpts: options.ControllerVolumeContext{AutoTopology: "true"}, zoneMap: map[string]string{"nova-a": "manila-a"}, expectedAZ: "manila-a", expectedOK: true},
+		{name: "unmapped zone", shareOpts: options.ControllerVolumeContext{AutoTopology: "true"}, zoneMap: map[string]string{"nova-b": "manila-b"}},
+	}
+
+	for _, tt := range ts {
+		t.Run(tt.name, func(t *testing.T) {
+			az, ok := capacityAvailabilityZone(true, topology, &tt.shareOpts, tt.zoneMap)
+			if az != tt.expectedAZ || ok != tt.expectedOK {
+				t.Errorf("expected (%q, %t), got (%q, %t)", tt.expectedAZ, tt.expectedOK, az, ok)
+			}
+		})
+	}
+}
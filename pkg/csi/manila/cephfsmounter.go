@@ -0,0 +1,84 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// Values of the cephfs-mounter volume parameter
+const (
+	cephfsMounterKernel = "kernel"
+	cephfsMounterFuse   = "fuse"
+	// The kernel client is used if the node supports it, ceph-fuse otherwise
+	cephfsMounterAuto = "auto"
+)
+
+// The filesystems supported by the kernel of the node
+var procFilesystems = "/proc/filesystems"
+
+// cephfsKernelSupported returns true if the kernel of the node supports CephFS,
+// i.e. the ceph module is loaded or built in.
+func cephfsKernelSupported() bool {
+	f, err := os.Open(procFilesystems)
+	if err != nil {
+		klog.Warningf("failed to read the filesystems supported by the kernel from %s: %v", procFilesystems, err)
+		return false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Lines are "[nodev]\t<filesystem>"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 && fields[len(fields)-1] == "ceph" {
+			return true
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		klog.Warningf("failed to read the filesystems supported by the kernel from %s: %v", procFilesystems, err)
+	}
+
+	return false
+}
+
+// selectCephfsMounter sets the mounter of the CSI CephFS volume context to the one the node
+// supports. The kernel client falls back to ceph-fuse if the kernel doesn't support CephFS.
+func selectCephfsMounter(volumeCtx map[string]string) {
+	mounter := volumeCtx["mounter"]
+	if mounter != cephfsMounterKernel && mounter != cephfsMounterAuto {
+		return
+	}
+
+	if cephfsKernelSupported() {
+		volumeCtx["mounter"] = cephfsMounterKernel
+		return
+	}
+
+	if mounter == cephfsMounterKernel {
+		klog.Warningf("the kernel of the node doesn't support CephFS, falling back to the %s mounter", cephfsMounterFuse)
+	} else {
+		klog.V(4).Infof("the kernel of the node doesn't support CephFS, using the %s mounter", cephfsMounterFuse)
+	}
+
+	volumeCtx["mounter"] = cephfsMounterFuse
+}
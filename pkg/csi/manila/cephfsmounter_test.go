@@ -0,0 +1,62 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSelectCephfsMounter(t *testing.T) {
+	withCeph := "nodev\tsysfs\nnodev\tproc\n\text4\nnodev\tceph\nfuseblk\nnodev\tfuse\n"
+	withoutCeph := "nodev\tsysfs\nnodev\tproc\n\text4\nfuseblk\nnodev\tfuse\nnodev\tcephx\n"
+
+	ts := []struct {
+		name            string
+		filesystems     string
+		mounter         string
+		expectedMounter string
+	}{
+		{name: "fuse", filesystems: withCeph, mounter: "fuse", expectedMounter: "fuse"},
+		{name: "kernel", filesystems: withCeph, mounter: "kernel", expectedMounter: "kernel"},
+		{name: "kernel fallback", filesystems: withoutCeph, mounter: "kernel", expectedMounter: "fuse"},
+		{name: "auto with kernel support", filesystems: withCeph, mounter: "auto", expectedMounter: "kernel"},
+		{name: "auto without kernel support", filesystems: withoutCeph, mounter: "auto", expectedMounter: "fuse"},
+		{name: "unreadable filesystems", mounter: "auto", expectedMounter: "fuse"},
+	}
+
+	defer func(path string) { procFilesystems = path }(procFilesystems)
+
+	for _, tt := range ts {
+		t.Run(tt.name, func(t *testing.T) {
+			procFilesystems = filepath.Join(t.TempDir(), "filesystems")
+			if tt.filesystems != "" {
+				if err := os.WriteFile(procFilesystems, []byte(tt.filesystems), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			volumeCtx := map[string]string{"mounter": tt.mounter}
+			selectCephfsMounter(volumeCtx)
+
+			if volumeCtx["mounter"] != tt.expectedMounter {
+				t.Errorf("expected mounter %s, got %s", tt.expectedMounter, volumeCtx["mounter"])
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shares"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/options"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/shareadapters"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// Labels of the secrets holding the cephx credentials of the shares
+	cephxSecretShareIDLabel   = "manila.csi.openstack.org/share-id"
+	cephxSecretManagedByLabel = "app.kubernetes.io/managed-by"
+
+	// Keys of the cephx credentials in the secrets, as expected by CSI CephFS
+	cephxUserIDKey  = "userID"
+	cephxUserKeyKey = "userKey"
+)
+
+// hasCephxCredentials returns true if the secrets of a node RPC are the cephx
+// credentials generated by the controller, instead of OpenStack credentials.
+func hasCephxCredentials(secrets map[string]string) bool {
+	return secrets[cephxUserIDKey] != "" && secrets[cephxUserKeyKey] != ""
+}
+
+// buildCephxVolumeContext builds the fields of the node volume context which let the node
+// mount the share without querying Manila.
+func buildCephxVolumeContext(ctx context.Context, manilaClient manilaclient.Interface, share *shares.Share, shareOpts *options.ControllerVolumeContext) (map[string]string, error) {
+	availableExportLocations, err := manilaClient.GetExportLocations(ctx, share.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list export locations: %v", err)
+	}
+
+	volCtx, err := shareadapters.Cephfs{}.BuildVolumeContext(&shareadapters.VolumeContextArgs{
+		Locations: availableExportLocations,
+		Share:     share,
+		Options:   &options.NodeVolumeContext{CephfsMounter: shareOpts.CephfsMounter},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{
+		"cephfs-monitors": volCtx["monitors"],
+		"cephfs-rootPath": volCtx["rootPath"],
+		"cephfs-fsName":   volCtx["fsName"],
+	}, nil
+}
+
+// createCephxSecret creates or updates the secret holding the cephx credentials of the share,
+// which the node service receives as its node stage and node publish secrets.
+func (cs *controllerServer) createCephxSecret(ctx context.Context, secretName string, share *shares.Share, accessRight *shares.AccessRight) error {
+	stageSecret, err := getShareAdapter(cs.d.shareProto).BuildNodeStageSecret(&shareadapters.SecretArgs{AccessRight: accessRight})
+	if err != nil {
+		return err
+	}
+
+	if !hasCephxCredentials(stageSecret) {
+		return fmt.Errorf("access right %s has no cephx key", accessRight.ID)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secretName,
+			Namespace: cs.d.cephxSecretNamespace,
+			Labels: map[string]string{
+				cephxSecretShareIDLabel:   share.ID,
+				cephxSecretManagedByLabel: cs.d.name,
+			},
+		},
+		Type:       corev1.SecretTypeOpaque,
+		StringData: stageSecret,
+	}
+
+	secrets := cs.d.kubeClient.CoreV1().Secrets(cs.d.cephxSecretNamespace)
+
+	if _, err = secrets.Create(ctx, secret, metav1.CreateOptions{}); err == nil {
+		klog.V(4).Infof("created cephx secret %s/%s for volume %s", secret.Namespace, secretName, share.ID)
+		return nil
+	}
+
+	if !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	existing, err := secrets.Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if existing.Labels[cephxSecretShareIDLabel] != share.ID {
+		return fmt.Errorf("secret %s/%s already exists and doesn't belong to volume %s", secret.Namespace, secretName, share.ID)
+	}
+
+	secret.ResourceVersion = existing.ResourceVersion
+	_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+
+	return err
+}
+
+// deleteCephxSecrets deletes the secrets holding the cephx credentials of the share.
+func (cs *controllerServer) deleteCephxSecrets(ctx context.Context, shareID string) error {
+	secrets := cs.d.kubeClient.CoreV1().Secrets(cs.d.cephxSecretNamespace)
+
+	list, err := secrets.List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{cephxSecretShareIDLabel: shareID}).String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, s := range list.Items {
+		if err := secrets.Delete(ctx, s.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+
+		klog.V(4).Infof("deleted cephx secret %s/%s of volume %s", s.Namespace, s.Name, shareID)
+	}
+
+	return nil
+}
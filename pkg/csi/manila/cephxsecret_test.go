@@ -0,0 +1,101 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shares"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCephxSecrets(t *testing.T) {
+	ctx := context.Background()
+	kubeClient := fake.NewClientset()
+	cs := &controllerServer{d: &Driver{
+		name:                 "cephfs.manila.csi.openstack.org",
+		shareProto:           "CEPHFS",
+		kubeClient:           kubeClient,
+		cephxSecretNamespace: "manila-secrets",
+	}}
+
+	share := &shares.Share{ID: "share-1"}
+	accessRight := &shares.AccessRight{ID: "access-1", AccessTo: "pv-1", AccessKey: "key-1"}
+
+	if err := cs.createCephxSecret(ctx, "pv-1", share, accessRight); err != nil {
+		t.Fatalf("failed to create cephx secret: %v", err)
+	}
+
+	// The secret of the same share is updated
+	accessRight.AccessKey = "key-2"
+	if err := cs.createCephxSecret(ctx, "pv-1", share, accessRight); err != nil {
+		t.Fatalf("failed to update cephx secret: %v", err)
+	}
+
+	secret, err := kubeClient.CoreV1().Secrets("manila-secrets").Get(ctx, "pv-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get cephx secret: %v", err)
+	}
+	if secret.StringData[cephxUserIDKey] != "pv-1" || secret.StringData[cephxUserKeyKey] != "key-2" {
+		t.Errorf("unexpected cephx credentials %v", secret.StringData)
+	}
+	if secret.Labels[cephxSecretShareIDLabel] != "share-1" {
+		t.Errorf("unexpected labels %v", secret.Labels)
+	}
+
+	// The secret of another share is not overwritten
+	if err := cs.createCephxSecret(ctx, "pv-1", &shares.Share{ID: "share-2"}, accessRight); err == nil {
+		t.Error("expected the secret of another volume not to be overwritten")
+	}
+
+	// An access right without a key is refused
+	if err := cs.createCephxSecret(ctx, "pv-3", &shares.Share{ID: "share-3"}, &shares.AccessRight{ID: "access-3", AccessTo: "pv-3"}); err == nil {
+		t.Error("expected an access right without a cephx key to be refused")
+	}
+
+	if err := cs.deleteCephxSecrets(ctx, "share-1"); err != nil {
+		t.Fatalf("failed to delete cephx secrets: %v", err)
+	}
+
+	list, err := kubeClient.CoreV1().Secrets("manila-secrets").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("failed to list secrets: %v", err)
+	}
+	if len(list.Items) != 0 {
+		t.Errorf("expected the cephx secrets to be deleted, got %d secrets", len(list.Items))
+	}
+}
+
+func TestHasCephxCredentials(t *testing.T) {
+	ts := []struct {
+		secrets  map[string]string
+		expected bool
+	}{
+		{secrets: map[string]string{cephxUserIDKey: "pv-1", cephxUserKeyKey: "key"}, expected: true},
+		{secrets: map[string]string{cephxUserIDKey: "pv-1"}, expected: false},
+		{secrets: map[string]string{"os-authURL": "https://keystone"}, expected: false},
+		{secrets: nil, expected: false},
+	}
+
+	for _, tt := range ts {
+		if has := hasCephxCredentials(tt.secrets); has != tt.expected {
+			t.Errorf("secrets %v: expected %t, got %t", tt.secrets, tt.expected, has)
+		}
+	}
+}
@@ -40,6 +40,15 @@ const (
 	affinityKey        = "manila.csi.openstack.org/affinity"
 	antiAffinityKey    = "manila.csi.openstack.org/anti-affinity"
 	groupIDKey         = "manila.csi.openstack.org/group-id"
+
+	// The nfs-shareClientSource and nfs-shareClient volume parameters the NFS access rules
+	// of the share were derived from, used to repair them when the nodes are replaced
+	shareClientSourceMetadataKey = "manila.csi.openstack.org/nfs-share-client-source"
+	shareClientMetadataKey       = "manila.csi.openstack.org/nfs-share-client"
+
+	// Maximum lengths of the keys and the values of the Manila share metadata
+	maxMetadataKeyLength   = 255
+	maxMetadataValueLength = 1023
 )
 
 type controllerServer struct {
@@ -99,11 +108,20 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 		return nil, status.Errorf(codes.InvalidArgument, "invalid volume parameters: %v", err)
 	}
 
+	if err := shareadapters.ValidateNFSMountOptions(shareOpts.NFSMountOptions); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid volume parameters: nfs-mountOptions: %v", err)
+	}
+
 	shareMetadata, err := prepareShareMetadata(shareOpts.AppendShareMetadata, cs.d.clusterID, params)
 	if err != nil {
 		return nil, err
 	}
 
+	zoneMap, err := parseZoneMap(shareOpts.AutoTopologyZoneMap)
+	if err != nil {
+		return nil, err
+	}
+
 	osOpts, err := options.NewOpenstackOptions(req.GetSecrets())
 	if err != nil {
 		return nil, status.Errorf(codes.InvalidArgument, "invalid OpenStack secrets: %v", err)
@@ -120,6 +138,10 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 		return nil, status.Errorf(codes.Unauthenticated, "failed to create Manila v2 client: %v", err)
 	}
 
+	if err := cs.resolveShareClients(ctx, manilaClient, shareOpts, shareMetadata); err != nil {
+		return nil, err
+	}
+
 	requestedSize := req.GetCapacityRange().GetRequiredBytes()
 	if requestedSize == 0 {
 		// At least 1GiB
@@ -128,6 +150,12 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 
 	sizeInGiB := bytesToGiB(requestedSize)
 
+	// Provision a subdirectory of the parent share instead of a share
+
+	if shareOpts.ParentShareID != "" {
+		return cs.createSubdirVolume(ctx, req, manilaClient, shareOpts, sizeInGiB)
+	}
+
 	var accessibleTopology []*csi.Topology
 	accessibleTopologyReq := req.GetAccessibilityRequirements()
 	if cs.d.withTopology && accessibleTopologyReq != nil {
@@ -136,21 +164,45 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 		accessibleTopology = accessibleTopologyReq.GetPreferred()
 
 		// When "autoTopology" is enabled and "availability" is empty, obtain the AZ from the target node.
+		// The compute AZ is mapped to a Manila AZ with "autoTopologyZoneMap" if the names differ.
 		if shareOpts.AvailabilityZone == "" && strings.EqualFold(shareOpts.AutoTopology, "true") {
-			shareOpts.AvailabilityZone = sharedcsi.GetAZFromTopology(topologyKey, accessibleTopologyReq)
-			accessibleTopology = []*csi.Topology{{
-				Segments: map[string]string{topologyKey: shareOpts.AvailabilityZone},
-			}}
+			if len(zoneMap) > 0 {
+				shareOpts.AvailabilityZone, accessibleTopology, err = mapTopologyToAvailabilityZone(accessibleTopologyReq, zoneMap)
+				if err != nil {
+					return nil, err
+				}
+			} else {
+				shareOpts.AvailabilityZone = sharedcsi.GetAZFromTopology(topologyKey, accessibleTopologyReq)
+				accessibleTopology = []*csi.Topology{{
+					Segments: map[string]string{topologyKey: shareOpts.AvailabilityZone},
+				}}
+			}
 		}
 	}
 
+	// Validate the share network
+
+	if err := resolveShareNetwork(ctx, manilaClient, shareOpts); err != nil {
+		return nil, err
+	}
+
 	// get the PVC annotation
-	pvcAnnotations := sharedcsi.GetPVCAnnotations(cs.d.pvcLister, params)
+	var pvcAnnotations map[string]string
+	if pvc := sharedcsi.GetPVC(cs.d.pvcLister, params); pvc != nil {
+		pvcAnnotations = pvc.Annotations
+
+		// Copy the allow-listed PVC annotations and labels, without overriding the
+		// keys set by the driver and the storage class
+		for k, v := range sharedcsi.GetPVCMetadata(pvc, cs.d.pvcMetadataAnnotations, cs.d.pvcMetadataLabels, maxMetadataKeyLength, maxMetadataValueLength) {
+			if _, ok := shareMetadata[k]; !ok {
+				shareMetadata[k] = v
+			}
+		}
+	}
 	for k, v := range pvcAnnotations {
 		klog.V(4).Infof("CreateVolume: retrieved %q pvc annotation: %s: %s", k, v, shareName)
 	}
-	affinity := pvcAnnotations[affinityKey]
-	antiAffinity := pvcAnnotations[antiAffinityKey]
+	affinity, antiAffinity := getSchedulerHints(shareOpts, pvcAnnotations)
 	if affinity != "" || antiAffinity != "" {
 		klog.V(4).Infof("CreateVolume: Getting scheduler hints: affinity=%s, anti-affinity=%s", affinity, antiAffinity)
 
@@ -203,6 +255,12 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 		return nil, status.Errorf(codes.Internal, "failed to grant access to volume %s: %v", share.Name, err)
 	}
 
+	// Replicate the share to the other availability zones
+
+	if err := ensureShareReplicas(ctx, manilaClient, share, shareOpts); err != nil {
+		return nil, err
+	}
+
 	var accessRightIDs []string
 	for _, ar := range accessRights {
 		accessRightIDs = append(accessRightIDs, ar.ID)
@@ -216,6 +274,23 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 	volCtx = util.SetMapIfNotEmpty(volCtx, "affinity", shareOpts.Affinity)
 	volCtx = util.SetMapIfNotEmpty(volCtx, "antiAffinity", shareOpts.AntiAffinity)
 
+	// Deliver the cephx credentials in a generated secret
+
+	if cs.d.cephxSecretNamespace != "" {
+		cephxVolCtx, err := buildCephxVolumeContext(ctx, manilaClient, share, shareOpts)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to build volume context for volume %s: %v", share.Name, err)
+		}
+
+		for k, v := range cephxVolCtx {
+			volCtx = util.SetMapIfNotEmpty(volCtx, k, v)
+		}
+
+		if err := cs.createCephxSecret(ctx, req.GetName(), share, &accessRights[0]); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to create cephx secret for volume %s: %v", share.Name, err)
+		}
+	}
+
 	return &csi.CreateVolumeResponse{
 		Volume: &csi.Volume{
 			VolumeId:           share.ID,
@@ -227,8 +302,58 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 	}, nil
 }
 
-func (d *controllerServer) ControllerModifyVolume(ctx context.Context, req *csi.ControllerModifyVolumeRequest) (*csi.ControllerModifyVolumeResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "")
+func (cs *controllerServer) ControllerModifyVolume(ctx context.Context, req *csi.ControllerModifyVolumeRequest) (*csi.ControllerModifyVolumeResponse, error) {
+	if !cs.d.volumeModification {
+		return nil, status.Error(codes.Unimplemented, "volume modification is disabled, set the --volume-modification flag to enable it")
+	}
+
+	if err := validateControllerModifyVolumeRequest(req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	zone, ok := req.GetMutableParameters()[activeReplicaAvailabilityZoneKey]
+	if !ok {
+		return &csi.ControllerModifyVolumeResponse{}, nil
+	}
+
+	if _, _, isSubdir := parseSubdirVolumeID(req.GetVolumeId()); isSubdir {
+		return nil, status.Errorf(codes.InvalidArgument, "volume %s is a subdirectory of a share, its replicas can't be promoted", req.GetVolumeId())
+	}
+
+	// Configuration
+
+	osOpts, err := options.NewOpenstackOptions(req.GetSecrets())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid OpenStack secrets: %v", err)
+	}
+
+	manilaClient, err := cs.d.manilaClientBuilder.New(ctx, osOpts)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "failed to create Manila v2 client: %v", err)
+	}
+
+	share, err := manilaClient.GetShareByID(ctx, req.GetVolumeId())
+	if err != nil {
+		if clouderrors.IsNotFound(err) {
+			return nil, status.Errorf(codes.NotFound, "volume %s not found: %v", req.GetVolumeId(), err)
+		}
+
+		return nil, status.Errorf(codes.Internal, "failed to retrieve volume %s: %v", req.GetVolumeId(), err)
+	}
+
+	// Check for pending operations on this volume
+	if _, isPending := pendingVolumes.LoadOrStore(share.Name, true); isPending {
+		return nil, status.Errorf(codes.Aborted, "volume %s is already being processed", share.Name)
+	}
+	defer pendingVolumes.Delete(share.Name)
+
+	// Promote the replica in the requested availability zone
+
+	if err := promoteShareReplica(ctx, manilaClient, share.ID, zone); err != nil {
+		return nil, err
+	}
+
+	return &csi.ControllerModifyVolumeResponse{}, nil
 }
 
 func (cs *controllerServer) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
@@ -246,10 +371,28 @@ func (cs *controllerServer) DeleteVolume(ctx context.Context, req *csi.DeleteVol
 		return nil, status.Errorf(codes.Unauthenticated, "failed to create Manila v2 client: %v", err)
 	}
 
+	if shareID, subdir, isSubdir := parseSubdirVolumeID(req.GetVolumeId()); isSubdir {
+		if err := cs.deleteSubdirVolume(ctx, manilaClient, shareID, subdir); err != nil {
+			return nil, err
+		}
+
+		return &csi.DeleteVolumeResponse{}, nil
+	}
+
+	if err := deleteShareReplicas(ctx, manilaClient, req.GetVolumeId()); err != nil {
+		return nil, err
+	}
+
 	if err := deleteShare(ctx, manilaClient, req.GetVolumeId()); err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to delete volume %s: %v", req.GetVolumeId(), err)
 	}
 
+	if cs.d.cephxSecretNamespace != "" {
+		if err := cs.deleteCephxSecrets(ctx, req.GetVolumeId()); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to delete cephx secrets of volume %s: %v", req.GetVolumeId(), err)
+		}
+	}
+
 	return &csi.DeleteVolumeResponse{}, nil
 }
 
@@ -258,6 +401,10 @@ func (cs *controllerServer) CreateSnapshot(ctx context.Context, req *csi.CreateS
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
+	if _, _, isSubdir := parseSubdirVolumeID(req.GetSourceVolumeId()); isSubdir {
+		return nil, status.Errorf(codes.InvalidArgument, "volume %s is a subdirectory of a share, it can't be snapshotted", req.GetSourceVolumeId())
+	}
+
 	// Configuration
 
 	osOpts, err := options.NewOpenstackOptions(req.GetSecrets())
@@ -297,10 +444,10 @@ func (cs *controllerServer) CreateSnapshot(ctx context.Context, req *csi.CreateS
 	// must advertise snapshot_support and create_share_from_snapshot_support
 	// capabilities.
 
-	if !sourceShare.SnapshotSupport || !sourceShare.CreateShareFromSnapshotSupport {
+	if missing := missingSnapshotCapabilities(sourceShare.SnapshotSupport, sourceShare.CreateShareFromSnapshotSupport); len(missing) > 0 {
 		return nil, status.Errorf(codes.InvalidArgument,
-			"cannot create snapshot %s for volume %s: parent share must advertise snapshot_support and create_share_from_snapshot_support capabilities",
-			req.GetName(), req.GetSourceVolumeId())
+			"cannot create snapshot %s for volume %s: share type %s of the volume does not support snapshots, parent share must advertise %s capabilities",
+			req.GetName(), req.GetSourceVolumeId(), coalesceValue(sourceShare.ShareTypeName), strings.Join(missing, " and "))
 	}
 
 	// Retrieve an existing snapshot or create a new one
@@ -462,10 +609,6 @@ func (cs *controllerServer) ListVolumes(context.Context, *csi.ListVolumesRequest
 	return nil, status.Error(codes.Unimplemented, "")
 }
 
-func (cs *controllerServer) GetCapacity(context.Context, *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "")
-}
-
 func (cs *controllerServer) ListSnapshots(context.Context, *csi.ListSnapshotsRequest) (*csi.ListSnapshotsResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "")
 }
@@ -487,6 +630,25 @@ func (cs *controllerServer) ControllerExpandVolume(ctx context.Context, req *csi
 		return nil, status.Errorf(codes.Unauthenticated, "failed to create Manila v2 client: %v", err)
 	}
 
+	desiredSizeInGiB := bytesToGiB(req.GetCapacityRange().GetRequiredBytes())
+
+	if limitBytes := req.GetCapacityRange().GetLimitBytes(); limitBytes > 0 && int64(desiredSizeInGiB)*bytesInGiB > limitBytes {
+		return nil, status.Errorf(codes.OutOfRange, "requested size %d GiB of volume %s exceeds the limit of %d bytes", desiredSizeInGiB, req.GetVolumeId(), limitBytes)
+	}
+
+	// The subdirectories are only allotted a larger part of their parent share
+
+	if shareID, subdir, isSubdir := parseSubdirVolumeID(req.GetVolumeId()); isSubdir {
+		if err := expandSubdirVolume(ctx, manilaClient, shareID, subdir, cs.d.shareProto, desiredSizeInGiB); err != nil {
+			return nil, err
+		}
+
+		return &csi.ControllerExpandVolumeResponse{
+			CapacityBytes:         int64(desiredSizeInGiB) * bytesInGiB,
+			NodeExpansionRequired: false,
+		}, nil
+	}
+
 	// Retrieve the share by its ID
 
 	share, err := manilaClient.GetShareByID(ctx, req.GetVolumeId())
@@ -506,23 +668,25 @@ func (cs *controllerServer) ControllerExpandVolume(ctx context.Context, req *csi
 
 	// Try to expand the share
 
-	desiredSizeInGiB := bytesToGiB(req.GetCapacityRange().GetRequiredBytes())
-
-	if share.Size >= desiredSizeInGiB {
+	if share.Size >= desiredSizeInGiB && share.Status != shareExtending {
 		// Share is already larger than requested size
 
 		return &csi.ControllerExpandVolumeResponse{
-			CapacityBytes: int64(share.Size) * bytesInGiB,
+			CapacityBytes:         int64(share.Size) * bytesInGiB,
+			NodeExpansionRequired: false,
 		}, nil
 	}
 
-	share, err = extendShare(ctx, manilaClient, share.ID, desiredSizeInGiB)
+	share, err = extendShare(ctx, manilaClient, share, desiredSizeInGiB)
 	if err != nil {
 		return nil, err
 	}
 
+	// Manila shares are resized by the storage backend while they are in use,
+	// there is nothing to be done on the nodes which have them mounted
 	return &csi.ControllerExpandVolumeResponse{
-		CapacityBytes: int64(share.Size) * bytesInGiB,
+		CapacityBytes:         int64(share.Size) * bytesInGiB,
+		NodeExpansionRequired: false,
 	}, nil
 }
 
@@ -539,6 +703,22 @@ func parseStringMapFromJSON(data string) (m map[string]string, err error) {
 	return
 }
 
+// getSchedulerHints returns the affinity and anti-affinity share lists of the volume.
+// The PVC annotations override the affinity and antiAffinity volume parameters.
+func getSchedulerHints(shareOpts *options.ControllerVolumeContext, pvcAnnotations map[string]string) (affinity, antiAffinity string) {
+	affinity, antiAffinity = shareOpts.Affinity, shareOpts.AntiAffinity
+
+	if v, ok := pvcAnnotations[affinityKey]; ok {
+		affinity = v
+	}
+
+	if v, ok := pvcAnnotations[antiAffinityKey]; ok {
+		antiAffinity = v
+	}
+
+	return affinity, antiAffinity
+}
+
 func prepareShareMetadata(appendShareMetadata, clusterID string, volumeParams map[string]string) (map[string]string, error) {
 	shareMetadata := make(map[string]string)
 
@@ -18,6 +18,7 @@ import (
 	"testing"
 
 	"k8s.io/cloud-provider-openstack/pkg/csi"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/options"
 )
 
 func TestPrepareShareMetadata(t *testing.T) {
@@ -123,3 +124,30 @@ func TestPrepareShareMetadata(t *testing.T) {
 		}
 	}
 }
+
+func TestGetSchedulerHints(t *testing.T) {
+	shareOpts := &options.ControllerVolumeContext{Affinity: "share-a", AntiAffinity: "share-b"}
+
+	ts := []struct {
+		name                 string
+		shareOpts            *options.ControllerVolumeContext
+		pvcAnnotations       map[string]string
+		expectedAffinity     string
+		expectedAntiAffinity string
+	}{
+		{name: "none", shareOpts: &options.ControllerVolumeContext{}},
+		{name: "volume parameters", shareOpts: shareOpts, expectedAffinity: "share-a", expectedAntiAffinity: "share-b"},
+		{name: "PVC annotations", shareOpts: &options.ControllerVolumeContext{}, pvcAnnotations: map[string]string{affinityKey: "share-c", antiAffinityKey: "share-d"}, expectedAffinity: "share-c", expectedAntiAffinity: "share-d"},
+		{name: "PVC annotation overriding a volume parameter", shareOpts: shareOpts, pvcAnnotations: map[string]string{antiAffinityKey: "share-d"}, expectedAffinity: "share-a", expectedAntiAffinity: "share-d"},
+		{name: "empty PVC annotation", shareOpts: shareOpts, pvcAnnotations: map[string]string{affinityKey: ""}, expectedAntiAffinity: "share-b"},
+	}
+
+	for _, tt := range ts {
+		t.Run(tt.name, func(t *testing.T) {
+			affinity, antiAffinity := getSchedulerHints(tt.shareOpts, tt.pvcAnnotations)
+			if affinity != tt.expectedAffinity || antiAffinity != tt.expectedAntiAffinity {
+				t.Errorf("expected (%q, %q), got (%q, %q)", tt.expectedAffinity, tt.expectedAntiAffinity, affinity, antiAffinity)
+			}
+		})
+	}
+}
@@ -72,6 +72,10 @@ func NewNodeSvcClient(conn *grpc.ClientConn) *NodeSvcClient {
 	return &NodeSvcClient{cl: csi.NewNodeClient(conn)}
 }
 
+func NewControllerSvcClient(conn *grpc.ClientConn) *ControllerSvcClient {
+	return &ControllerSvcClient{cl: csi.NewControllerClient(conn)}
+}
+
 func NewIdentitySvcClient(conn *grpc.ClientConn) *IdentitySvcClient {
 	return &IdentitySvcClient{cl: csi.NewIdentityClient(conn)}
 }
@@ -115,6 +119,10 @@ func (b ClientBuilder) NewNodeServiceClient(conn *grpc.ClientConn) Node {
 	return NewNodeSvcClient(conn)
 }
 
+func (b ClientBuilder) NewControllerServiceClient(conn *grpc.ClientConn) Controller {
+	return NewControllerSvcClient(conn)
+}
+
 func (b ClientBuilder) NewIdentityServiceClient(conn *grpc.ClientConn) Identity {
 	return NewIdentitySvcClient(conn)
 }
@@ -26,8 +26,9 @@ import (
 )
 
 var (
-	_ Node     = &NodeSvcClient{}
-	_ Identity = &IdentitySvcClient{}
+	_ Node       = &NodeSvcClient{}
+	_ Controller = &ControllerSvcClient{}
+	_ Identity   = &IdentitySvcClient{}
 )
 
 type NodeSvcClient struct {
@@ -58,6 +59,18 @@ func (c *NodeSvcClient) UnpublishVolume(ctx context.Context, req *csi.NodeUnpubl
 	return c.cl.NodeUnpublishVolume(ctx, req)
 }
 
+type ControllerSvcClient struct {
+	cl csi.ControllerClient
+}
+
+func (c *ControllerSvcClient) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
+	return c.cl.CreateVolume(ctx, req)
+}
+
+func (c *ControllerSvcClient) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
+	return c.cl.DeleteVolume(ctx, req)
+}
+
 type IdentitySvcClient struct {
 	cl csi.IdentityClient
 }
@@ -35,6 +35,13 @@ type Node interface {
 	UnpublishVolume(ctx context.Context, req *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error)
 }
 
+// Controller is the controller service of the fwd plugin, which manages the subdirectories
+// of the shares in the subdirectory provisioning mode
+type Controller interface {
+	CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error)
+	DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error)
+}
+
 type Identity interface {
 	GetPluginInfo(ctx context.Context) (*csi.GetPluginInfoResponse, error)
 	Probe(ctx context.Context, req *csi.ProbeRequest) (*csi.ProbeResponse, error)
@@ -46,5 +53,6 @@ type Builder interface {
 	NewConnectionWithContext(ctx context.Context, endpoint string) (*grpc.ClientConn, error)
 
 	NewNodeServiceClient(conn *grpc.ClientConn) Node
+	NewControllerServiceClient(conn *grpc.ClientConn) Controller
 	NewIdentityServiceClient(conn *grpc.ClientConn) Identity
 }
@@ -29,9 +29,11 @@ import (
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/kubernetes-csi/csi-lib-utils/protosanitizer"
 	"google.golang.org/grpc"
+	"k8s.io/client-go/kubernetes"
 	v1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/cloud-provider-openstack/pkg/csi/manila/csiclient"
 	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
 	"k8s.io/cloud-provider-openstack/pkg/util/metadata"
 	"k8s.io/cloud-provider-openstack/pkg/version"
 	"k8s.io/klog/v2"
@@ -50,16 +52,44 @@ type Driver struct {
 
 	ids *identityServer
 	cs  *controllerServer
+	gcs *groupControllerServer
 	ns  *nodeServer
 
-	vcaps  []*csi.VolumeCapability_AccessMode
-	cscaps []*csi.ControllerServiceCapability
-	nscaps []*csi.NodeServiceCapability
+	vcaps   []*csi.VolumeCapability_AccessMode
+	cscaps  []*csi.ControllerServiceCapability
+	gcscaps []*csi.GroupControllerServiceCapability
+	nscaps  []*csi.NodeServiceCapability
 
 	manilaClientBuilder manilaclient.Builder
 	csiClientBuilder    csiclient.Builder
 
-	pvcLister v1.PersistentVolumeClaimLister
+	pvcLister  v1.PersistentVolumeClaimLister
+	nodeLister v1.NodeLister
+
+	pvcMetadataAnnotations []string
+	pvcMetadataLabels      []string
+
+	kubeClient           kubernetes.Interface
+	cephxSecretNamespace string
+
+	capacitySecretNamespace string
+	capacitySecretName      string
+
+	janitorSecretNamespace string
+	janitorSecretName      string
+	janitorInterval        time.Duration
+	janitorForceDelete     bool
+
+	accessRepairSecretNamespace string
+	accessRepairSecretName      string
+	accessRepairInterval        time.Duration
+
+	httpEndpoint                string
+	shareMetricsSecretNamespace string
+	shareMetricsSecretName      string
+
+	volumeModification  bool
+	volumeGroupSnapshot bool
 }
 
 type DriverOpts struct {
@@ -76,6 +106,53 @@ type DriverOpts struct {
 	CSIClientBuilder    csiclient.Builder
 
 	PVCLister v1.PersistentVolumeClaimLister
+
+	// NodeLister is used to grant the NFS access to the node subnets or
+	// addresses, see the nfs-shareClientSource volume parameter
+	NodeLister v1.NodeLister
+
+	// PVCMetadataAnnotations and PVCMetadataLabels are the keys of the PVC
+	// annotations and labels copied to the share metadata, requires PVCLister
+	PVCMetadataAnnotations []string
+	PVCMetadataLabels      []string
+
+	// KubeClient is required by CephxSecretNamespace and CapacitySecret
+	KubeClient kubernetes.Interface
+	// CephxSecretNamespace is the namespace of the secrets generated with the cephx credentials
+	// of the CephFS shares. The secrets are not generated if empty.
+	CephxSecretNamespace string
+	// CapacitySecret is the <namespace>/<name> of the secret with the OpenStack credentials
+	// GetCapacity uses. The capacity is not reported if empty.
+	CapacitySecret string
+	// JanitorSecret is the <namespace>/<name> of the secret with the OpenStack credentials
+	// the share janitor uses. The shares in an error state are not cleaned up if empty.
+	JanitorSecret string
+	// JanitorInterval is the interval between the clean-ups of the share janitor
+	JanitorInterval time.Duration
+	// JanitorForceDelete makes the share janitor force-delete the shares, which
+	// requires the admin role
+	JanitorForceDelete bool
+
+	// AccessRepairSecret is the <namespace>/<name> of the secret with the OpenStack credentials
+	// used to repair the NFS access rules of the shares when the nodes change, requires
+	// NodeLister. The access rules are not repaired if empty.
+	AccessRepairSecret string
+	// AccessRepairInterval is the interval between the repairs of the NFS access rules
+	AccessRepairInterval time.Duration
+
+	// HTTPEndpoint is the address the metrics are served on. The metrics are not served if empty.
+	HTTPEndpoint string
+	// ShareMetricsSecret is the <namespace>/<name> of the secret with the OpenStack credentials
+	// used to count the shares of the cluster by status. The shares are not counted if empty.
+	ShareMetricsSecret string
+
+	// VolumeModification enables the promotion of the share replicas with
+	// ControllerModifyVolume
+	VolumeModification bool
+
+	// VolumeGroupSnapshot enables the group controller service, snapshotting
+	// the share groups with CreateVolumeGroupSnapshot
+	VolumeGroupSnapshot bool
 }
 
 type nonBlockingGRPCServer struct {
@@ -115,22 +192,127 @@ func NewDriver(o *DriverOpts) (*Driver, error) {
 	}
 
 	d := &Driver{
-		fqVersion:           fmt.Sprintf("%s@%s", driverVersion, version.Version),
-		withTopology:        o.WithTopology,
-		name:                o.DriverName,
-		serverEndpoint:      o.ServerCSIEndpoint,
-		fwdEndpoint:         o.FwdCSIEndpoint,
-		shareProto:          strings.ToUpper(o.ShareProto),
-		manilaClientBuilder: o.ManilaClientBuilder,
-		csiClientBuilder:    o.CSIClientBuilder,
-		clusterID:           o.ClusterID,
-		pvcLister:           o.PVCLister,
+		fqVersion:              fmt.Sprintf("%s@%s", driverVersion, version.Version),
+		withTopology:           o.WithTopology,
+		name:                   o.DriverName,
+		serverEndpoint:         o.ServerCSIEndpoint,
+		fwdEndpoint:            o.FwdCSIEndpoint,
+		shareProto:             strings.ToUpper(o.ShareProto),
+		manilaClientBuilder:    o.ManilaClientBuilder,
+		csiClientBuilder:       o.CSIClientBuilder,
+		clusterID:              o.ClusterID,
+		pvcLister:              o.PVCLister,
+		nodeLister:             o.NodeLister,
+		pvcMetadataAnnotations: o.PVCMetadataAnnotations,
+		pvcMetadataLabels:      o.PVCMetadataLabels,
+		kubeClient:             o.KubeClient,
+		cephxSecretNamespace:   o.CephxSecretNamespace,
+		httpEndpoint:           o.HTTPEndpoint,
+		volumeModification:     o.VolumeModification,
+		volumeGroupSnapshot:    o.VolumeGroupSnapshot,
 	}
 
+	if d.cephxSecretNamespace != "" {
+		if d.shareProto != "CEPHFS" {
+			return nil, fmt.Errorf("cephx secrets are only supported by the CEPHFS share protocol, got %s", d.shareProto)
+		}
+
+		if d.kubeClient == nil {
+			return nil, fmt.Errorf("cephx secrets require a Kubernetes client")
+		}
+	}
+
+	if o.CapacitySecret != "" {
+		ns, name, ok := strings.Cut(o.CapacitySecret, "/")
+		if !ok || ns == "" || name == "" {
+			return nil, fmt.Errorf("invalid capacity secret %q, expected <namespace>/<name>", o.CapacitySecret)
+		}
+
+		if d.kubeClient == nil {
+			return nil, fmt.Errorf("capacity secret requires a Kubernetes client")
+		}
+
+		d.capacitySecretNamespace, d.capacitySecretName = ns, name
+	}
+
+	if o.JanitorSecret != "" {
+		ns, name, ok := strings.Cut(o.JanitorSecret, "/")
+		if !ok || ns == "" || name == "" {
+			return nil, fmt.Errorf("invalid janitor secret %q, expected <namespace>/<name>", o.JanitorSecret)
+		}
+
+		if d.kubeClient == nil {
+			return nil, fmt.Errorf("janitor secret requires a Kubernetes client")
+		}
+
+		if d.clusterID == "" {
+			return nil, fmt.Errorf("share janitor requires a cluster ID to find the shares of the cluster")
+		}
+
+		if o.JanitorInterval <= 0 {
+			return nil, fmt.Errorf("invalid janitor interval %v", o.JanitorInterval)
+		}
+
+		d.janitorSecretNamespace, d.janitorSecretName = ns, name
+		d.janitorInterval, d.janitorForceDelete = o.JanitorInterval, o.JanitorForceDelete
+	}
+
+	if o.AccessRepairSecret != "" {
+		ns, name, ok := strings.Cut(o.AccessRepairSecret, "/")
+		if !ok || ns == "" || name == "" {
+			return nil, fmt.Errorf("invalid access repair secret %q, expected <namespace>/<name>", o.AccessRepairSecret)
+		}
+
+		if d.kubeClient == nil {
+			return nil, fmt.Errorf("access repair secret requires a Kubernetes client")
+		}
+
+		if d.clusterID == "" {
+			return nil, fmt.Errorf("access repair requires a cluster ID to find the shares of the cluster")
+		}
+
+		if d.nodeLister == nil {
+			return nil, fmt.Errorf("access repair requires a node lister")
+		}
+
+		if !strings.EqualFold(d.shareProto, "NFS") {
+			return nil, fmt.Errorf("access repair is only supported with the NFS share protocol")
+		}
+
+		if o.AccessRepairInterval <= 0 {
+			return nil, fmt.Errorf("invalid access repair interval %v", o.AccessRepairInterval)
+		}
+
+		d.accessRepairSecretNamespace, d.accessRepairSecretName = ns, name
+		d.accessRepairInterval = o.AccessRepairInterval
+	}
+
+	if o.ShareMetricsSecret != "" {
+		ns, name, ok := strings.Cut(o.ShareMetricsSecret, "/")
+		if !ok || ns == "" || name == "" {
+			return nil, fmt.Errorf("invalid share metrics secret %q, expected <namespace>/<name>", o.ShareMetricsSecret)
+		}
+
+		if d.kubeClient == nil {
+			return nil, fmt.Errorf("share metrics secret requires a Kubernetes client")
+		}
+
+		if d.clusterID == "" {
+			return nil, fmt.Errorf("share metrics require a cluster ID to find the shares of the cluster")
+		}
+
+		d.shareMetricsSecretNamespace, d.shareMetricsSecretName = ns, name
+	}
+
+	metrics.RegisterMetrics("manila-csi")
+
 	klog.Info("Driver: ", d.name)
 	klog.Info("Driver version: ", d.fqVersion)
 	klog.Info("CSI spec version: ", specVersion)
 	klog.Infof("Topology awareness: %t", d.withTopology)
+	if d.cephxSecretNamespace != "" {
+		klog.Infof("Generating cephx secrets in namespace %s", d.cephxSecretNamespace)
+	}
 
 	getShareAdapter(d.shareProto) // The program will terminate with a non-zero exit code if the share protocol selector is wrong
 	klog.Infof("Operating on %s shares", d.shareProto)
@@ -156,11 +338,18 @@ func NewDriver(o *DriverOpts) (*Driver, error) {
 func (d *Driver) SetupControllerService() error {
 	klog.Info("Providing controller service")
 
-	d.addControllerServiceCapabilities([]csi.ControllerServiceCapability_RPC_Type{
+	cscaps := []csi.ControllerServiceCapability_RPC_Type{
 		csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
 		csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
 		csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
-	})
+	}
+	if d.volumeModification {
+		cscaps = append(cscaps, csi.ControllerServiceCapability_RPC_MODIFY_VOLUME)
+	}
+	if d.capacitySecretName != "" {
+		cscaps = append(cscaps, csi.ControllerServiceCapability_RPC_GET_CAPACITY)
+	}
+	d.addControllerServiceCapabilities(cscaps)
 
 	d.addVolumeCapabilityAccessModes([]csi.VolumeCapability_AccessMode_Mode{
 		csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
@@ -171,6 +360,17 @@ func (d *Driver) SetupControllerService() error {
 	})
 
 	d.cs = &controllerServer{d: d}
+
+	if d.volumeGroupSnapshot {
+		klog.Info("Providing group controller service")
+
+		d.addGroupControllerServiceCapabilities([]csi.GroupControllerServiceCapability_RPC_Type{
+			csi.GroupControllerServiceCapability_RPC_CREATE_DELETE_GET_VOLUME_GROUP_SNAPSHOT,
+		})
+
+		d.gcs = &groupControllerServer{d: d}
+	}
+
 	return nil
 }
 
@@ -208,8 +408,24 @@ func (d *Driver) Run() {
 		klog.Fatal("No CSI services initialized")
 	}
 
+	if d.cs != nil && d.janitorSecretName != "" {
+		go d.runShareJanitor(context.Background())
+	}
+
+	if d.cs != nil && d.accessRepairSecretName != "" {
+		go d.runAccessRepair(context.Background())
+	}
+
+	if d.cs != nil && d.shareMetricsSecretName != "" {
+		go d.runShareMetrics(context.Background())
+	}
+
+	if d.httpEndpoint != "" {
+		go serveMetrics(d.httpEndpoint)
+	}
+
 	s := nonBlockingGRPCServer{}
-	s.start(d.serverEndpoint, d.ids, d.cs, d.ns)
+	s.start(d.serverEndpoint, d.ids, d.cs, d.gcs, d.ns)
 	s.wait()
 }
 
@@ -232,6 +448,25 @@ func (d *Driver) addControllerServiceCapabilities(cs []csi.ControllerServiceCapa
 	d.cscaps = caps
 }
 
+func (d *Driver) addGroupControllerServiceCapabilities(gcs []csi.GroupControllerServiceCapability_RPC_Type) {
+	caps := make([]*csi.GroupControllerServiceCapability, 0, len(gcs))
+
+	for _, c := range gcs {
+		klog.Infof("Enabling group controller service capability: %v", c.String())
+		gcsc := &csi.GroupControllerServiceCapability{
+			Type: &csi.GroupControllerServiceCapability_Rpc{
+				Rpc: &csi.GroupControllerServiceCapability_RPC{
+					Type: c,
+				},
+			},
+		}
+
+		caps = append(caps, gcsc)
+	}
+
+	d.gcscaps = caps
+}
+
 func (d *Driver) addVolumeCapabilityAccessModes(vs []csi.VolumeCapability_AccessMode_Mode) {
 	caps := make([]*csi.VolumeCapability_AccessMode, 0, len(vs))
 
@@ -293,16 +528,16 @@ func (d *Driver) initProxiedDriver() (csiNodeCapabilitySet, error) {
 	return nodeCaps, nil
 }
 
-func (s *nonBlockingGRPCServer) start(endpoint string, ids *identityServer, cs *controllerServer, ns *nodeServer) {
+func (s *nonBlockingGRPCServer) start(endpoint string, ids *identityServer, cs *controllerServer, gcs *groupControllerServer, ns *nodeServer) {
 	s.wg.Add(1)
-	go s.serve(endpoint, ids, cs, ns)
+	go s.serve(endpoint, ids, cs, gcs, ns)
 }
 
 func (s *nonBlockingGRPCServer) wait() {
 	s.wg.Wait()
 }
 
-func (s *nonBlockingGRPCServer) serve(endpoint string, ids *identityServer, cs *controllerServer, ns *nodeServer) {
+func (s *nonBlockingGRPCServer) serve(endpoint string, ids *identityServer, cs *controllerServer, gcs *groupControllerServer, ns *nodeServer) {
 	defer s.wg.Done()
 
 	proto, addr, err := parseGRPCEndpoint(endpoint)
@@ -321,7 +556,7 @@ func (s *nonBlockingGRPCServer) serve(endpoint string, ids *identityServer, cs *
 		klog.Fatalf("listen failed for GRPC server: %v", err)
 	}
 
-	server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 		callID := atomic.AddUint64(&serverGRPCEndpointCallCounter, 1)
 
 		klog.V(3).Infof("[ID:%d] GRPC call: %s", callID, info.FullMethod)
@@ -333,7 +568,7 @@ func (s *nonBlockingGRPCServer) serve(endpoint string, ids *identityServer, cs *
 			klog.V(5).Infof("[ID:%d] GRPC response: %s", callID, protosanitizer.StripSecrets(resp))
 		}
 		return resp, err
-	}))
+	}, observeGRPC))
 
 	s.server = server
 
@@ -343,6 +578,9 @@ func (s *nonBlockingGRPCServer) serve(endpoint string, ids *identityServer, cs *
 	if cs != nil {
 		csi.RegisterControllerServer(server, cs)
 	}
+	if gcs != nil {
+		csi.RegisterGroupControllerServer(server, gcs)
+	}
 	if ns != nil {
 		csi.RegisterNodeServer(server, ns)
 	}
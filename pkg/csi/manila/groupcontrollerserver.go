@@ -0,0 +1,297 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shares"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/options"
+	clouderrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
+	"k8s.io/klog/v2"
+)
+
+// groupControllerServer maps the CSI volume group snapshots to the Manila
+// share group snapshots. A volume group snapshot must cover all the shares
+// of a single share group, the share group snapshot being crash-consistent
+// only if the share group type supports consistent snapshots.
+type groupControllerServer struct {
+	d *Driver
+	csi.UnimplementedGroupControllerServer
+}
+
+func (gcs *groupControllerServer) GroupControllerGetCapabilities(ctx context.Context, req *csi.GroupControllerGetCapabilitiesRequest) (*csi.GroupControllerGetCapabilitiesResponse, error) {
+	return &csi.GroupControllerGetCapabilitiesResponse{
+		Capabilities: gcs.d.gcscaps,
+	}, nil
+}
+
+func (gcs *groupControllerServer) CreateVolumeGroupSnapshot(ctx context.Context, req *csi.CreateVolumeGroupSnapshotRequest) (*csi.CreateVolumeGroupSnapshotResponse, error) {
+	if err := validateCreateVolumeGroupSnapshotRequest(req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	for _, volID := range req.GetSourceVolumeIds() {
+		if _, _, isSubdir := parseSubdirVolumeID(volID); isSubdir {
+			return nil, status.Errorf(codes.InvalidArgument, "volume %s is a subdirectory of a share, it can't be snapshotted", volID)
+		}
+	}
+
+	// Configuration
+
+	osOpts, err := options.NewOpenstackOptions(req.GetSecrets())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid OpenStack secrets: %v", err)
+	}
+
+	// Check for pending CreateVolumeGroupSnapshots for this group snapshot name
+	if _, isPending := pendingSnapshots.LoadOrStore(req.GetName(), true); isPending {
+		return nil, status.Errorf(codes.Aborted, "group snapshot %s is already being processed", req.GetName())
+	}
+	defer pendingSnapshots.Delete(req.GetName())
+
+	manilaClient, err := gcs.d.manilaClientBuilder.New(ctx, osOpts)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "failed to create Manila v2 client: %v", err)
+	}
+
+	// Retrieve the share group of the source shares
+
+	shareGroupID, err := getSourceShareGroup(ctx, manilaClient, req.GetSourceVolumeIds(), gcs.d.shareProto)
+	if err != nil {
+		if clouderrors.IsNotFound(err) {
+			return nil, status.Errorf(codes.NotFound, "failed to create group snapshot %s because a source volume doesn't exist: %v", req.GetName(), err)
+		}
+
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+
+		return nil, status.Errorf(codes.Internal, "failed to retrieve source volumes of group snapshot %s: %v", req.GetName(), err)
+	}
+
+	// Retrieve an existing share group snapshot or create a new one
+
+	groupSnapshot, err := getOrCreateShareGroupSnapshot(ctx, manilaClient, req.GetName(), shareGroupID)
+	if err != nil {
+		if errors.Is(err, manilaclient.ErrMicroversionNotSupported) {
+			return nil, status.Errorf(codes.FailedPrecondition, "share group snapshots are not supported by the Manila API: %v", err)
+		}
+
+		return nil, status.Errorf(codes.Internal, "failed to create group snapshot %s of share group %s: %v", req.GetName(), shareGroupID, err)
+	}
+
+	if groupSnapshot.ShareGroupID != shareGroupID {
+		return nil, status.Errorf(codes.AlreadyExists, "group snapshot %s already exists, but is incompatible with the request: share group mismatch: wanted %s, got %s",
+			req.GetName(), shareGroupID, groupSnapshot.ShareGroupID)
+	}
+
+	// Check for group snapshot status, determine whether it's ready
+
+	var readyToUse bool
+
+	switch groupSnapshot.Status {
+	case snapshotCreating:
+		readyToUse = false
+	case snapshotAvailable:
+		readyToUse = true
+	case snapshotError:
+		// An error occurred, try to roll-back the group snapshot
+		if err := deleteShareGroupSnapshot(ctx, manilaClient, groupSnapshot.ID); err != nil {
+			klog.Errorf("couldn't delete group snapshot %s in a roll-back procedure: %v", groupSnapshot.ID, err)
+		}
+
+		return nil, status.Errorf(codes.Internal, "group snapshot %s of share group %s is in error state", groupSnapshot.ID, shareGroupID)
+	default:
+		return nil, status.Errorf(codes.Internal, "an error occurred while creating group snapshot %s of share group %s: group snapshot is in an unexpected state: wanted creating/available, got %s",
+			req.GetName(), shareGroupID, groupSnapshot.Status)
+	}
+
+	return &csi.CreateVolumeGroupSnapshotResponse{
+		GroupSnapshot: buildVolumeGroupSnapshot(groupSnapshot, readyToUse),
+	}, nil
+}
+
+func (gcs *groupControllerServer) DeleteVolumeGroupSnapshot(ctx context.Context, req *csi.DeleteVolumeGroupSnapshotRequest) (*csi.DeleteVolumeGroupSnapshotResponse, error) {
+	if err := validateDeleteVolumeGroupSnapshotRequest(req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	osOpts, err := options.NewOpenstackOptions(req.GetSecrets())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid OpenStack secrets: %v", err)
+	}
+
+	manilaClient, err := gcs.d.manilaClientBuilder.New(ctx, osOpts)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "failed to create Manila v2 client: %v", err)
+	}
+
+	if err := deleteShareGroupSnapshot(ctx, manilaClient, req.GetGroupSnapshotId()); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to delete group snapshot %s: %v", req.GetGroupSnapshotId(), err)
+	}
+
+	return &csi.DeleteVolumeGroupSnapshotResponse{}, nil
+}
+
+func (gcs *groupControllerServer) GetVolumeGroupSnapshot(ctx context.Context, req *csi.GetVolumeGroupSnapshotRequest) (*csi.GetVolumeGroupSnapshotResponse, error) {
+	if err := validateGetVolumeGroupSnapshotRequest(req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	osOpts, err := options.NewOpenstackOptions(req.GetSecrets())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid OpenStack secrets: %v", err)
+	}
+
+	manilaClient, err := gcs.d.manilaClientBuilder.New(ctx, osOpts)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "failed to create Manila v2 client: %v", err)
+	}
+
+	groupSnapshot, err := manilaClient.GetShareGroupSnapshotByID(ctx, req.GetGroupSnapshotId())
+	if err != nil {
+		if clouderrors.IsNotFound(err) {
+			return nil, status.Errorf(codes.NotFound, "group snapshot %s not found: %v", req.GetGroupSnapshotId(), err)
+		}
+
+		return nil, status.Errorf(codes.Internal, "failed to retrieve group snapshot %s: %v", req.GetGroupSnapshotId(), err)
+	}
+
+	if groupSnapshot.Status == snapshotError {
+		return nil, status.Errorf(codes.Internal, "group snapshot %s is in error state", groupSnapshot.ID)
+	}
+
+	return &csi.GetVolumeGroupSnapshotResponse{
+		GroupSnapshot: buildVolumeGroupSnapshot(groupSnapshot, groupSnapshot.Status == snapshotAvailable),
+	}, nil
+}
+
+// getSourceShareGroup returns the ID of the share group of the source shares.
+// The source shares must be all the shares of a single share group.
+func getSourceShareGroup(ctx context.Context, manilaClient manilaclient.Interface, sourceShareIDs []string, shareProto string) (string, error) {
+	var shareGroupID string
+
+	for _, shareID := range sourceShareIDs {
+		share, err := manilaClient.GetShareByID(ctx, shareID)
+		if err != nil {
+			return "", err
+		}
+
+		if strings.ToUpper(share.ShareProto) != shareProto {
+			return "", status.Errorf(codes.InvalidArgument, "share protocol mismatch: requested group snapshot of %s volume %s, but share protocol selector is set to %s",
+				share.ShareProto, shareID, shareProto)
+		}
+
+		if share.ShareGroupID == "" {
+			return "", status.Errorf(codes.InvalidArgument, "volume %s is not in a share group", shareID)
+		}
+
+		if shareGroupID != "" && share.ShareGroupID != shareGroupID {
+			return "", status.Errorf(codes.InvalidArgument, "volumes %s and %s are in different share groups %s and %s",
+				sourceShareIDs[0], shareID, shareGroupID, share.ShareGroupID)
+		}
+
+		shareGroupID = share.ShareGroupID
+	}
+
+	// A share group snapshot always includes all the shares of the share group
+
+	groupShares, err := manilaClient.GetShares(ctx, shares.ListOpts{ShareGroupID: shareGroupID})
+	if err != nil {
+		return "", fmt.Errorf("failed to list shares of share group %s: %v", shareGroupID, err)
+	}
+
+	for _, share := range groupShares {
+		if !slices.Contains(sourceShareIDs, share.ID) {
+			return "", status.Errorf(codes.InvalidArgument, "share group %s contains share %s that is not a source volume, a group snapshot must include all the shares of the share group",
+				shareGroupID, share.ID)
+		}
+	}
+
+	return shareGroupID, nil
+}
+
+// getOrCreateShareGroupSnapshot retrieves an existing share group snapshot with name=groupSnapName,
+// or creates a new one if it doesn't exist yet.
+func getOrCreateShareGroupSnapshot(ctx context.Context, manilaClient manilaclient.Interface, groupSnapName, shareGroupID string) (*manilaclient.ShareGroupSnapshot, error) {
+	groupSnapshot, err := manilaClient.GetShareGroupSnapshotByName(ctx, groupSnapName)
+	if err == nil {
+		klog.V(4).Infof("a group snapshot named %s already exists", groupSnapName)
+		return groupSnapshot, nil
+	}
+
+	if !clouderrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to probe for a group snapshot named %s: %w", groupSnapName, err)
+	}
+
+	// It doesn't exist, create it
+
+	return manilaClient.CreateShareGroupSnapshot(ctx, manilaclient.CreateShareGroupSnapshotOpts{
+		ShareGroupID: shareGroupID,
+		Name:         groupSnapName,
+		Description:  snapshotDescription,
+	})
+}
+
+func deleteShareGroupSnapshot(ctx context.Context, manilaClient manilaclient.Interface, groupSnapID string) error {
+	if err := manilaClient.DeleteShareGroupSnapshot(ctx, groupSnapID); err != nil {
+		if clouderrors.IsNotFound(err) {
+			klog.V(4).Infof("group snapshot %s not found, assuming it to be already deleted", groupSnapID)
+		} else {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func buildVolumeGroupSnapshot(groupSnapshot *manilaclient.ShareGroupSnapshot, readyToUse bool) *csi.VolumeGroupSnapshot {
+	// Parse CreatedAt timestamp
+	ctime := timestamppb.New(groupSnapshot.CreatedAt)
+	if err := ctime.CheckValid(); err != nil {
+		klog.Warningf("couldn't parse timestamp %v from group snapshot %s: %v", groupSnapshot.CreatedAt, groupSnapshot.ID, err)
+	}
+
+	snaps := make([]*csi.Snapshot, 0, len(groupSnapshot.Members))
+	for _, member := range groupSnapshot.Members {
+		snaps = append(snaps, &csi.Snapshot{
+			SnapshotId:      member.ID,
+			SourceVolumeId:  member.ShareID,
+			SizeBytes:       int64(member.Size) * bytesInGiB,
+			CreationTime:    ctime,
+			ReadyToUse:      readyToUse,
+			GroupSnapshotId: groupSnapshot.ID,
+		})
+	}
+
+	return &csi.VolumeGroupSnapshot{
+		GroupSnapshotId: groupSnapshot.ID,
+		Snapshots:       snaps,
+		CreationTime:    ctime,
+		ReadyToUse:      readyToUse,
+	}
+}
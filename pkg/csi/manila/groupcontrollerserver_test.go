@@ -0,0 +1,121 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shares"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
+)
+
+// fakeShareGroupClient serves the shares of share groups. The calls it doesn't implement panic.
+type fakeShareGroupClient struct {
+	manilaclient.Interface
+
+	shares []shares.Share
+}
+
+func (c *fakeShareGroupClient) GetShareByID(_ context.Context, shareID string) (*shares.Share, error) {
+	for _, s := range c.shares {
+		if s.ID == shareID {
+			return &s, nil
+		}
+	}
+	return nil, gophercloud.ErrResourceNotFound{}
+}
+
+func (c *fakeShareGroupClient) GetShares(_ context.Context, opts shares.ListOptsBuilder) ([]shares.Share, error) {
+	var ss []shares.Share
+	for _, s := range c.shares {
+		if s.ShareGroupID == opts.(shares.ListOpts).ShareGroupID {
+			ss = append(ss, s)
+		}
+	}
+	return ss, nil
+}
+
+func TestGetSourceShareGroup(t *testing.T) {
+	c := &fakeShareGroupClient{shares: []shares.Share{
+		{ID: "share-1", ShareProto: "NFS", ShareGroupID: "group-1"},
+		{ID: "share-2", ShareProto: "NFS", ShareGroupID: "group-1"},
+		{ID: "share-3", ShareProto: "NFS", ShareGroupID: "group-2"},
+		{ID: "share-4", ShareProto: "NFS"},
+		{ID: "share-5", ShareProto: "CEPHFS", ShareGroupID: "group-3"},
+	}}
+
+	ts := []struct {
+		name            string
+		sourceShareIDs  []string
+		expectedGroupID string
+		expectedCode    codes.Code
+	}{
+		{name: "all the shares of the share group", sourceShareIDs: []string{"share-1", "share-2"}, expectedGroupID: "group-1"},
+		{name: "share missing from the source shares", sourceShareIDs: []string{"share-1"}, expectedCode: codes.InvalidArgument},
+		{name: "different share groups", sourceShareIDs: []string{"share-1", "share-2", "share-3"}, expectedCode: codes.InvalidArgument},
+		{name: "share not in a share group", sourceShareIDs: []string{"share-4"}, expectedCode: codes.InvalidArgument},
+		{name: "share protocol mismatch", sourceShareIDs: []string{"share-5"}, expectedCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range ts {
+		t.Run(tt.name, func(t *testing.T) {
+			groupID, err := getSourceShareGroup(context.Background(), c, tt.sourceShareIDs, "NFS")
+			if status.Code(err) != tt.expectedCode {
+				t.Fatalf("expected code %s, got error %v", tt.expectedCode, err)
+			}
+
+			if groupID != tt.expectedGroupID {
+				t.Errorf("expected share group %q, got %q", tt.expectedGroupID, groupID)
+			}
+		})
+	}
+}
+
+func TestBuildVolumeGroupSnapshot(t *testing.T) {
+	groupSnapshot := &manilaclient.ShareGroupSnapshot{
+		ID:           "group-snapshot",
+		ShareGroupID: "group-1",
+		Status:       snapshotAvailable,
+		CreatedAt:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Members: []manilaclient.ShareGroupSnapshotMember{
+			{ID: "member-1", ShareID: "share-1", Size: 1},
+			{ID: "member-2", ShareID: "share-2", Size: 2},
+		},
+	}
+
+	vgs := buildVolumeGroupSnapshot(groupSnapshot, true)
+
+	if vgs.GetGroupSnapshotId() != "group-snapshot" || !vgs.GetReadyToUse() || len(vgs.GetSnapshots()) != 2 {
+		t.Fatalf("unexpected group snapshot %v", vgs)
+	}
+
+	for i, member := range groupSnapshot.Members {
+		snap := vgs.GetSnapshots()[i]
+		if snap.GetSnapshotId() != member.ID || snap.GetSourceVolumeId() != member.ShareID || snap.GetGroupSnapshotId() != groupSnapshot.ID {
+			t.Errorf("snapshot %v doesn't match member %v", snap, member)
+		}
+
+		if snap.GetSizeBytes() != int64(member.Size)*bytesInGiB {
+			t.Errorf("expected size %d, got %d", int64(member.Size)*bytesInGiB, snap.GetSizeBytes())
+		}
+	}
+}
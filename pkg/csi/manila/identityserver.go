@@ -86,6 +86,16 @@ func (ids *identityServer) GetPluginCapabilities(ctx context.Context, req *csi.G
 		})
 	}
 
+	if ids.d.gcs != nil {
+		caps = append(caps, &csi.PluginCapability{
+			Type: &csi.PluginCapability_Service_{
+				Service: &csi.PluginCapability_Service{
+					Type: csi.PluginCapability_Service_GROUP_CONTROLLER_SERVICE,
+				},
+			},
+		})
+	}
+
 	return &csi.GetPluginCapabilitiesResponse{
 		Capabilities: caps,
 	}, nil
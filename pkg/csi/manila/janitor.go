@@ -0,0 +1,130 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shares"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
+	clouderrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
+	"k8s.io/klog/v2"
+)
+
+// runShareJanitor periodically deletes the shares of the cluster which are stuck in an error state,
+// until ctx is done.
+func (d *Driver) runShareJanitor(ctx context.Context) {
+	klog.Infof("Cleaning up the shares in an error state every %v", d.janitorInterval)
+
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		manilaClient, err := newManilaClientFromSecret(ctx, d.kubeClient, d.manilaClientBuilder, d.janitorSecretNamespace, d.janitorSecretName)
+		if err != nil {
+			klog.Errorf("share janitor: %v", err)
+			return
+		}
+
+		if err := d.cleanUpErrorShares(ctx, manilaClient); err != nil {
+			klog.Errorf("share janitor: %v", err)
+		}
+	}, d.janitorInterval)
+}
+
+// cleanUpErrorShares deletes the shares of the cluster and of the share protocol of the driver in the
+// error_deleting state, and the shares in the error state which are neither being created nor backing
+// a persistent volume.
+func (d *Driver) cleanUpErrorShares(ctx context.Context, manilaClient manilaclient.Interface) error {
+	var volumeHandles map[string]struct{}
+
+	for _, shareStatus := range []string{shareErrorDeleting, shareError} {
+		ss, err := manilaClient.GetShares(ctx, shares.ListOpts{
+			Status:   shareStatus,
+			Metadata: map[string]string{clusterMetadataKey: d.clusterID},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list shares in %s state: %v", shareStatus, err)
+		}
+
+		for i := range ss {
+			share := &ss[i]
+
+			// The shares of the other protocols are cleaned up by their own plugins
+			if !strings.EqualFold(share.ShareProto, d.shareProto) {
+				continue
+			}
+
+			if share.Status == shareError {
+				if _, isPending := pendingVolumes.Load(share.Name); isPending {
+					klog.V(4).Infof("share janitor: skipping share %s in %s state, volume %s is being processed", share.ID, share.Status, share.Name)
+					continue
+				}
+
+				if volumeHandles == nil {
+					if volumeHandles, err = d.getVolumeHandles(ctx); err != nil {
+						return err
+					}
+				}
+
+				if _, ok := volumeHandles[share.ID]; ok {
+					klog.V(4).Infof("share janitor: skipping share %s in %s state, it backs a persistent volume", share.ID, share.Status)
+					continue
+				}
+			}
+
+			d.deleteErrorShare(ctx, manilaClient, share)
+		}
+	}
+
+	return nil
+}
+
+func (d *Driver) deleteErrorShare(ctx context.Context, manilaClient manilaclient.Interface, share *shares.Share) {
+	var err error
+
+	if d.janitorForceDelete {
+		klog.Infof("share janitor: force-deleting share %s (%s) in %s state", share.ID, share.Name, share.Status)
+		err = manilaClient.ForceDeleteShare(ctx, share.ID)
+	} else {
+		klog.Infof("share janitor: deleting share %s (%s) in %s state", share.ID, share.Name, share.Status)
+		err = manilaClient.DeleteShare(ctx, share.ID)
+	}
+
+	if err != nil && !clouderrors.IsNotFound(err) {
+		klog.Errorf("share janitor: failed to delete share %s: %v", share.ID, err)
+	}
+}
+
+// getVolumeHandles returns the volume handles of the CSI persistent volumes. The volumes of all
+// the drivers are considered, as a share may be imported by any of them.
+func (d *Driver) getVolumeHandles(ctx context.Context) (map[string]struct{}, error) {
+	pvs, err := d.kubeClient.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistent volumes: %v", err)
+	}
+
+	handles := make(map[string]struct{})
+	for _, pv := range pvs.Items {
+		if csiSource := pv.Spec.CSI; csiSource != nil {
+			handles[csiSource.VolumeHandle] = struct{}{}
+		}
+	}
+
+	return handles, nil
+}
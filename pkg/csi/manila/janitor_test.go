@@ -0,0 +1,125 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shares"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
+)
+
+// fakeJanitorClient lists the shares by status and cluster, and records the deleted shares.
+// The calls it doesn't implement panic.
+type fakeJanitorClient struct {
+	manilaclient.Interface
+
+	shares       []shares.Share
+	deleted      []string
+	forceDeleted []string
+}
+
+func (c *fakeJanitorClient) GetShares(_ context.Context, opts shares.ListOptsBuilder) ([]shares.Share, error) {
+	listOpts := opts.(shares.ListOpts)
+
+	var ss []shares.Share
+	for _, s := range c.shares {
+		if (listOpts.Status == "" || s.Status == listOpts.Status) && s.Metadata[clusterMetadataKey] == listOpts.Metadata[clusterMetadataKey] {
+			ss = append(ss, s)
+		}
+	}
+	return ss, nil
+}
+
+func (c *fakeJanitorClient) DeleteShare(_ context.Context, shareID string) error {
+	c.deleted = append(c.deleted, shareID)
+	return nil
+}
+
+func (c *fakeJanitorClient) ForceDeleteShare(_ context.Context, shareID string) error {
+	c.forceDeleted = append(c.forceDeleted, shareID)
+	return nil
+}
+
+func newCSIPersistentVolume(name, driver, volumeHandle string) *corev1.PersistentVolume {
+	return &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1.PersistentVolumeSpec{
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: driver, VolumeHandle: volumeHandle},
+			},
+		},
+	}
+}
+
+func TestCleanUpErrorShares(t *testing.T) {
+	cluster := map[string]string{clusterMetadataKey: "cluster"}
+
+	newClient := func() *fakeJanitorClient {
+		return &fakeJanitorClient{shares: []shares.Share{
+			{ID: "deleting", Name: "pvc-1", Status: shareErrorDeleting, ShareProto: "NFS", Metadata: cluster},
+			{ID: "error", Name: "pvc-2", Status: shareError, ShareProto: "NFS", Metadata: cluster},
+			{ID: "error-in-use", Name: "pvc-3", Status: shareError, ShareProto: "NFS", Metadata: cluster},
+			{ID: "error-pending", Name: "pvc-4", Status: shareError, ShareProto: "NFS", Metadata: cluster},
+			{ID: "error-in-use-other-driver", Name: "pvc-5", Status: shareError, ShareProto: "NFS", Metadata: cluster},
+			{ID: "error-other-cluster", Name: "pvc-6", Status: shareError, ShareProto: "NFS", Metadata: map[string]string{clusterMetadataKey: "other"}},
+			{ID: "error-other-protocol", Name: "pvc-8", Status: shareError, ShareProto: "CEPHFS", Metadata: cluster},
+			{ID: "available", Name: "pvc-7", Status: shareAvailable, ShareProto: "NFS", Metadata: cluster},
+		}}
+	}
+
+	kubeClient := fake.NewClientset(
+		newCSIPersistentVolume("pvc-3", "nfs.manila.csi.openstack.org", "error-in-use"),
+		newCSIPersistentVolume("pvc-5", "cephfs.manila.csi.openstack.org", "error-in-use-other-driver"),
+	)
+
+	pendingVolumes.Store("pvc-4", true)
+	defer pendingVolumes.Delete("pvc-4")
+
+	expected := []string{"deleting", "error"}
+
+	for _, forceDelete := range []bool{false, true} {
+		d := &Driver{
+			name:               "nfs.manila.csi.openstack.org",
+			shareProto:         "NFS",
+			clusterID:          "cluster",
+			kubeClient:         kubeClient,
+			janitorForceDelete: forceDelete,
+		}
+
+		c := newClient()
+		if err := d.cleanUpErrorShares(context.Background(), c); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		deleted, other := c.deleted, c.forceDeleted
+		if forceDelete {
+			deleted, other = c.forceDeleted, c.deleted
+		}
+
+		slices.Sort(deleted)
+		if !reflect.DeepEqual(deleted, expected) || len(other) != 0 {
+			t.Errorf("force delete %t: expected deleted shares %v, got %v and %v", forceDelete, expected, c.deleted, c.forceDeleted)
+		}
+	}
+}
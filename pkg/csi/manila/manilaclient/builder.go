@@ -40,13 +40,15 @@ var (
 type ClientBuilder struct {
 	UserAgent          string
 	ExtraUserAgentData []string
+	// RetryOpts configures the timeout and the retries of the API calls
+	RetryOpts client.RetryOpts
 }
 
 func (cb *ClientBuilder) New(ctx context.Context, o *client.AuthOpts) (Interface, error) {
-	return New(ctx, o, cb.UserAgent, cb.ExtraUserAgentData)
+	return New(ctx, o, cb.UserAgent, cb.ExtraUserAgentData, cb.RetryOpts)
 }
 
-func New(ctx context.Context, o *client.AuthOpts, userAgent string, extraUserAgentData []string) (*Client, error) {
+func New(ctx context.Context, o *client.AuthOpts, userAgent string, extraUserAgentData []string, retryOpts client.RetryOpts) (*Client, error) {
 	// Authenticate and create Manila v2 client
 	// If UseClouds is set, read clouds.yaml file
 	if o.UseClouds {
@@ -61,6 +63,8 @@ func New(ctx context.Context, o *client.AuthOpts, userAgent string, extraUserAge
 		return nil, fmt.Errorf("failed to authenticate: %v", err)
 	}
 
+	client.SetRetryOpts(provider, retryOpts)
+
 	client, err := openstack.NewSharedFileSystemV2(provider, gophercloud.EndpointOpts{
 		Region:       o.Region,
 		Availability: o.EndpointType,
@@ -72,11 +76,21 @@ func New(ctx context.Context, o *client.AuthOpts, userAgent string, extraUserAge
 	// Check client's and server's versions for compatibility
 
 	client.Microversion = minimumManilaVersion
-	if err = validateManilaClient(ctx, client); err != nil {
+	maxMicroversion, err := validateManilaClient(ctx, client)
+	if err != nil {
 		return nil, fmt.Errorf("manila v2 client validation failed: %v", err)
 	}
 
-	return &Client{c: client}, nil
+	// The Neutron client is only used to find the share networks by the tags of their network
+	networkClient, err := openstack.NewNetworkV2(provider, gophercloud.EndpointOpts{
+		Region:       o.Region,
+		Availability: o.EndpointType,
+	})
+	if err != nil {
+		networkClient = nil
+	}
+
+	return &Client{c: client, n: networkClient, maxMicroversion: maxMicroversion}, nil
 }
 
 func splitManilaMicroversion(microversion string) (major, minor int) {
@@ -106,27 +120,29 @@ func compareManilaVersionsLessThan(a, b string) bool {
 	return aMaj < bMaj || (aMaj == bMaj && aMin < bMin)
 }
 
-func validateManilaClient(ctx context.Context, c *gophercloud.ServiceClient) error {
+// validateManilaClient checks that the server supports the microversion of the client, and
+// returns the highest microversion the server supports.
+func validateManilaClient(ctx context.Context, c *gophercloud.ServiceClient) (string, error) {
 	serverVersion, err := apiversions.Get(ctx, c, "v2").Extract()
 	if err != nil {
-		return fmt.Errorf("failed to get Manila v2 API microversions: %v", err)
+		return "", fmt.Errorf("failed to get Manila v2 API microversions: %v", err)
 	}
 
 	if err = validateManilaMicroversion(serverVersion.MinVersion); err != nil {
-		return fmt.Errorf("server's minimum microversion is invalid: %v", err)
+		return "", fmt.Errorf("server's minimum microversion is invalid: %v", err)
 	}
 
 	if err = validateManilaMicroversion(serverVersion.Version); err != nil {
-		return fmt.Errorf("server's maximum microversion is invalid: %v", err)
+		return "", fmt.Errorf("server's maximum microversion is invalid: %v", err)
 	}
 
 	if compareManilaVersionsLessThan(c.Microversion, serverVersion.MinVersion) {
-		return fmt.Errorf("client's microversion %s is lower than server's minimum microversion %s", c.Microversion, serverVersion.MinVersion)
+		return "", fmt.Errorf("client's microversion %s is lower than server's minimum microversion %s", c.Microversion, serverVersion.MinVersion)
 	}
 
 	if compareManilaVersionsLessThan(serverVersion.Version, c.Microversion) {
-		return fmt.Errorf("client's microversion %s is higher than server's highest supported microversion %s", c.Microversion, serverVersion.Version)
+		return "", fmt.Errorf("client's microversion %s is higher than server's highest supported microversion %s", c.Microversion, serverVersion.Version)
 	}
 
-	return nil
+	return serverVersion.Version, nil
 }
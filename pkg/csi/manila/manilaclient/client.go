@@ -18,19 +18,40 @@ package manilaclient
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/networking/v2/networks"
+	"github.com/gophercloud/gophercloud/v2/openstack/networking/v2/subnets"
 	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/messages"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/replicas"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/schedulerstats"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/services"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/sharenetworks"
 	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shares"
 	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/sharetypes"
 	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/snapshots"
 	shares_utils "github.com/gophercloud/utils/v2/openstack/sharedfilesystems/v2/shares"
 	sharetypes_utils "github.com/gophercloud/utils/v2/openstack/sharedfilesystems/v2/sharetypes"
 	snapshots_utils "github.com/gophercloud/utils/v2/openstack/sharedfilesystems/v2/snapshots"
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
 )
 
+const (
+	replicasMicroversion = "2.56"
+)
+
+// ErrMicroversionNotSupported is returned by the calls requiring a higher microversion than the
+// server supports
+var ErrMicroversionNotSupported = errors.New("microversion not supported by the server")
+
 type Client struct {
 	c *gophercloud.ServiceClient
+	// Neutron client, nil if the networking service couldn't be found
+	n *gophercloud.ServiceClient
+	// The highest microversion the server supports
+	maxMicroversion string
 }
 
 func (c Client) GetMicroversion() string {
@@ -41,75 +62,128 @@ func (c Client) SetMicroversion(version string) {
 	c.c.Microversion = version
 }
 
+func (c Client) SupportsMicroversion(version string) bool {
+	return !compareManilaVersionsLessThan(c.maxMicroversion, version)
+}
+
 func (c Client) GetShareByID(ctx context.Context, shareID string) (*shares.Share, error) {
-	return shares.Get(ctx, c.c, shareID).Extract()
+	mc := metrics.NewMetricContext("share", "get")
+	res, err := shares.Get(ctx, c.c, shareID).Extract()
+	return res, mc.ObserveRequest(err)
 }
 
 func (c Client) GetShareByName(ctx context.Context, shareName string) (*shares.Share, error) {
+	mc := metrics.NewMetricContext("share", "list")
 	shareID, err := shares_utils.IDFromName(ctx, c.c, shareName)
-	if err != nil {
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+
+	return c.GetShareByID(ctx, shareID)
+}
+
+func (c Client) GetShares(ctx context.Context, opts shares.ListOptsBuilder) ([]shares.Share, error) {
+	mc := metrics.NewMetricContext("share", "list")
+	allPages, err := shares.ListDetail(c.c, opts).AllPages(ctx)
+	if mc.ObserveRequest(err) != nil {
 		return nil, err
 	}
 
-	return shares.Get(ctx, c.c, shareID).Extract()
+	return shares.ExtractShares(allPages)
 }
 
 func (c Client) CreateShare(ctx context.Context, opts shares.CreateOptsBuilder) (*shares.Share, error) {
-	return shares.Create(ctx, c.c, opts).Extract()
+	mc := metrics.NewMetricContext("share", "create")
+	res, err := shares.Create(ctx, c.c, opts).Extract()
+	return res, mc.ObserveRequest(err)
 }
 
 func (c Client) DeleteShare(ctx context.Context, shareID string) error {
-	return shares.Delete(ctx, c.c, shareID).ExtractErr()
+	mc := metrics.NewMetricContext("share", "delete")
+	return mc.ObserveRequest(shares.Delete(ctx, c.c, shareID).ExtractErr())
+}
+
+func (c Client) ForceDeleteShare(ctx context.Context, shareID string) error {
+	mc := metrics.NewMetricContext("share", "force_delete")
+	return mc.ObserveRequest(shares.ForceDelete(ctx, c.c, shareID).ExtractErr())
 }
 
 func (c Client) ExtendShare(ctx context.Context, shareID string, opts shares.ExtendOptsBuilder) error {
-	return shares.Extend(ctx, c.c, shareID, opts).ExtractErr()
+	mc := metrics.NewMetricContext("share", "extend")
+	return mc.ObserveRequest(shares.Extend(ctx, c.c, shareID, opts).ExtractErr())
 }
 
 func (c Client) GetExportLocations(ctx context.Context, shareID string) ([]shares.ExportLocation, error) {
-	return shares.ListExportLocations(ctx, c.c, shareID).Extract()
+	mc := metrics.NewMetricContext("share_export_location", "list")
+	res, err := shares.ListExportLocations(ctx, c.c, shareID).Extract()
+	return res, mc.ObserveRequest(err)
 }
 
 func (c Client) SetShareMetadata(ctx context.Context, shareID string, opts shares.SetMetadataOptsBuilder) (map[string]string, error) {
-	return shares.SetMetadata(ctx, c.c, shareID, opts).Extract()
+	mc := metrics.NewMetricContext("share_metadata", "set")
+	res, err := shares.SetMetadata(ctx, c.c, shareID, opts).Extract()
+	return res, mc.ObserveRequest(err)
+}
+
+func (c Client) DeleteShareMetadatum(ctx context.Context, shareID, key string) error {
+	mc := metrics.NewMetricContext("share_metadata", "delete")
+	return mc.ObserveRequest(shares.DeleteMetadatum(ctx, c.c, shareID, key).ExtractErr())
 }
 
 func (c Client) GetAccessRights(ctx context.Context, shareID string) ([]shares.AccessRight, error) {
-	return shares.ListAccessRights(ctx, c.c, shareID).Extract()
+	mc := metrics.NewMetricContext("share_access", "list")
+	res, err := shares.ListAccessRights(ctx, c.c, shareID).Extract()
+	return res, mc.ObserveRequest(err)
 }
 
 func (c Client) GrantAccess(ctx context.Context, shareID string, opts shares.GrantAccessOptsBuilder) (*shares.AccessRight, error) {
-	return shares.GrantAccess(ctx, c.c, shareID, opts).Extract()
+	mc := metrics.NewMetricContext("share_access", "grant")
+	res, err := shares.GrantAccess(ctx, c.c, shareID, opts).Extract()
+	return res, mc.ObserveRequest(err)
+}
+
+func (c Client) RevokeAccess(ctx context.Context, shareID string, opts shares.RevokeAccessOptsBuilder) error {
+	mc := metrics.NewMetricContext("share_access", "revoke")
+	return mc.ObserveRequest(shares.RevokeAccess(ctx, c.c, shareID, opts).ExtractErr())
 }
 
 func (c Client) GetSnapshotByID(ctx context.Context, snapID string) (*snapshots.Snapshot, error) {
-	return snapshots.Get(ctx, c.c, snapID).Extract()
+	mc := metrics.NewMetricContext("snapshot", "get")
+	res, err := snapshots.Get(ctx, c.c, snapID).Extract()
+	return res, mc.ObserveRequest(err)
 }
 
 func (c Client) GetSnapshotByName(ctx context.Context, snapName string) (*snapshots.Snapshot, error) {
+	mc := metrics.NewMetricContext("snapshot", "list")
 	snapID, err := snapshots_utils.IDFromName(ctx, c.c, snapName)
-	if err != nil {
+	if mc.ObserveRequest(err) != nil {
 		return nil, err
 	}
 
-	return snapshots.Get(ctx, c.c, snapID).Extract()
+	return c.GetSnapshotByID(ctx, snapID)
 }
 
 func (c Client) CreateSnapshot(ctx context.Context, opts snapshots.CreateOptsBuilder) (*snapshots.Snapshot, error) {
-	return snapshots.Create(ctx, c.c, opts).Extract()
+	mc := metrics.NewMetricContext("snapshot", "create")
+	res, err := snapshots.Create(ctx, c.c, opts).Extract()
+	return res, mc.ObserveRequest(err)
 }
 
 func (c Client) DeleteSnapshot(ctx context.Context, snapID string) error {
-	return snapshots.Delete(ctx, c.c, snapID).ExtractErr()
+	mc := metrics.NewMetricContext("snapshot", "delete")
+	return mc.ObserveRequest(snapshots.Delete(ctx, c.c, snapID).ExtractErr())
 }
 
 func (c Client) GetExtraSpecs(ctx context.Context, shareTypeID string) (sharetypes.ExtraSpecs, error) {
-	return sharetypes.GetExtraSpecs(ctx, c.c, shareTypeID).Extract()
+	mc := metrics.NewMetricContext("share_type_extra_specs", "get")
+	res, err := sharetypes.GetExtraSpecs(ctx, c.c, shareTypeID).Extract()
+	return res, mc.ObserveRequest(err)
 }
 
 func (c Client) GetShareTypes(ctx context.Context) ([]sharetypes.ShareType, error) {
+	mc := metrics.NewMetricContext("share_type", "list")
 	allPages, err := sharetypes.List(c.c, sharetypes.ListOpts{}).AllPages(ctx)
-	if err != nil {
+	if mc.ObserveRequest(err) != nil {
 		return nil, err
 	}
 
@@ -117,14 +191,159 @@ func (c Client) GetShareTypes(ctx context.Context) ([]sharetypes.ShareType, erro
 }
 
 func (c Client) GetShareTypeIDFromName(ctx context.Context, shareTypeName string) (string, error) {
-	return sharetypes_utils.IDFromName(ctx, c.c, shareTypeName)
+	mc := metrics.NewMetricContext("share_type", "list")
+	res, err := sharetypes_utils.IDFromName(ctx, c.c, shareTypeName)
+	return res, mc.ObserveRequest(err)
+}
+
+// withMicroversion calls f with at least the given microversion, or returns
+// ErrMicroversionNotSupported if the server doesn't support it.
+func (c Client) withMicroversion(microversion string, f func() error) error {
+	if !c.SupportsMicroversion(microversion) {
+		return fmt.Errorf("%w: %s is required, the server supports up to %s", ErrMicroversionNotSupported, microversion, c.maxMicroversion)
+	}
+
+	if v := c.c.Microversion; compareManilaVersionsLessThan(v, microversion) {
+		c.c.Microversion = microversion
+		defer func() { c.c.Microversion = v }()
+	}
+
+	return f()
+}
+
+func (c Client) GetReplicas(ctx context.Context, shareID string) ([]replicas.Replica, error) {
+	var res []replicas.Replica
+
+	mc := metrics.NewMetricContext("replica", "list")
+	err := c.withMicroversion(replicasMicroversion, func() error {
+		allPages, err := replicas.ListDetail(c.c, replicas.ListOpts{ShareID: shareID}).AllPages(ctx)
+		if err != nil {
+			return err
+		}
+
+		res, err = replicas.ExtractReplicas(allPages)
+		return err
+	})
+
+	return res, mc.ObserveRequest(err)
+}
+
+func (c Client) CreateReplica(ctx context.Context, opts replicas.CreateOptsBuilder) (*replicas.Replica, error) {
+	var res *replicas.Replica
+
+	mc := metrics.NewMetricContext("replica", "create")
+	err := c.withMicroversion(replicasMicroversion, func() (err error) {
+		res, err = replicas.Create(ctx, c.c, opts).Extract()
+		return err
+	})
+
+	return res, mc.ObserveRequest(err)
+}
+
+func (c Client) DeleteReplica(ctx context.Context, replicaID string) error {
+	mc := metrics.NewMetricContext("replica", "delete")
+	return mc.ObserveRequest(c.withMicroversion(replicasMicroversion, func() error {
+		return replicas.Delete(ctx, c.c, replicaID).ExtractErr()
+	}))
+}
+
+func (c Client) PromoteReplica(ctx context.Context, replicaID string) error {
+	mc := metrics.NewMetricContext("replica", "promote")
+	return mc.ObserveRequest(c.withMicroversion(replicasMicroversion, func() error {
+		return replicas.Promote(ctx, c.c, replicaID, replicas.PromoteOpts{}).ExtractErr()
+	}))
+}
+
+func (c Client) GetShareNetworkByID(ctx context.Context, shareNetworkID string) (*sharenetworks.ShareNetwork, error) {
+	mc := metrics.NewMetricContext("share_network", "get")
+	res, err := sharenetworks.Get(ctx, c.c, shareNetworkID).Extract()
+	return res, mc.ObserveRequest(err)
+}
+
+func (c Client) GetShareNetworks(ctx context.Context, opts sharenetworks.ListOptsBuilder) ([]sharenetworks.ShareNetwork, error) {
+	mc := metrics.NewMetricContext("share_network", "list")
+	allPages, err := sharenetworks.ListDetail(c.c, opts).AllPages(ctx)
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+
+	return sharenetworks.ExtractShareNetworks(allPages)
+}
+
+func (c Client) GetNetworkIDsByTag(ctx context.Context, tag string) ([]string, error) {
+	if c.n == nil {
+		return nil, errors.New("networking service is not available")
+	}
+
+	mc := metrics.NewMetricContext("network", "list")
+	allPages, err := networks.List(c.n, networks.ListOpts{Tags: tag}).AllPages(ctx)
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+
+	nets, err := networks.ExtractNetworks(allPages)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(nets))
+	for i := range nets {
+		ids[i] = nets[i].ID
+	}
+
+	return ids, nil
+}
+
+func (c Client) GetSubnetCIDRs(ctx context.Context) ([]string, error) {
+	if c.n == nil {
+		return nil, errors.New("networking service is not available")
+	}
+
+	mc := metrics.NewMetricContext("subnet", "list")
+	allPages, err := subnets.List(c.n, subnets.ListOpts{}).AllPages(ctx)
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+
+	subs, err := subnets.ExtractSubnets(allPages)
+	if err != nil {
+		return nil, err
+	}
+
+	cidrs := make([]string, len(subs))
+	for i := range subs {
+		cidrs[i] = subs[i].CIDR
+	}
+
+	return cidrs, nil
 }
 
 func (c Client) GetUserMessages(ctx context.Context, opts messages.ListOptsBuilder) ([]messages.Message, error) {
+	mc := metrics.NewMetricContext("user_message", "list")
 	allPages, err := messages.List(c.c, opts).AllPages(ctx)
-	if err != nil {
+	if mc.ObserveRequest(err) != nil {
 		return nil, err
 	}
 
 	return messages.ExtractMessages(allPages)
 }
+
+func (c Client) GetPools(ctx context.Context, opts schedulerstats.ListDetailOptsBuilder) ([]schedulerstats.Pool, error) {
+	mc := metrics.NewMetricContext("pool", "list")
+	allPages, err := schedulerstats.ListDetail(c.c, opts).AllPages(ctx)
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+
+	return schedulerstats.ExtractPools(allPages)
+}
+
+func (c Client) GetServices(ctx context.Context, opts services.ListOptsBuilder) ([]services.Service, error) {
+	mc := metrics.NewMetricContext("service", "list")
+	allPages, err := services.List(c.c, opts).AllPages(ctx)
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+
+	return services.ExtractServices(allPages)
+}
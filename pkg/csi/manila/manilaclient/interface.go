@@ -20,6 +20,10 @@ import (
 	"context"
 
 	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/messages"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/replicas"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/schedulerstats"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/services"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/sharenetworks"
 	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shares"
 	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/sharetypes"
 	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/snapshots"
@@ -29,30 +33,61 @@ import (
 type Interface interface {
 	GetMicroversion() string
 	SetMicroversion(version string)
+	// SupportsMicroversion returns true if the server supports the given microversion
+	SupportsMicroversion(version string) bool
 
 	GetShareByID(ctx context.Context, shareID string) (*shares.Share, error)
 	GetShareByName(ctx context.Context, shareName string) (*shares.Share, error)
+	GetShares(ctx context.Context, opts shares.ListOptsBuilder) ([]shares.Share, error)
 	CreateShare(ctx context.Context, opts shares.CreateOptsBuilder) (*shares.Share, error)
 	DeleteShare(ctx context.Context, shareID string) error
+	// ForceDeleteShare deletes the share in any state, requires the admin role
+	ForceDeleteShare(ctx context.Context, shareID string) error
 	ExtendShare(ctx context.Context, shareID string, opts shares.ExtendOptsBuilder) error
 
 	GetExportLocations(ctx context.Context, shareID string) ([]shares.ExportLocation, error)
 
 	SetShareMetadata(ctx context.Context, shareID string, opts shares.SetMetadataOptsBuilder) (map[string]string, error)
+	DeleteShareMetadatum(ctx context.Context, shareID, key string) error
 
 	GetAccessRights(ctx context.Context, shareID string) ([]shares.AccessRight, error)
 	GrantAccess(ctx context.Context, shareID string, opts shares.GrantAccessOptsBuilder) (*shares.AccessRight, error)
+	RevokeAccess(ctx context.Context, shareID string, opts shares.RevokeAccessOptsBuilder) error
 
 	GetSnapshotByID(ctx context.Context, snapID string) (*snapshots.Snapshot, error)
 	GetSnapshotByName(ctx context.Context, snapName string) (*snapshots.Snapshot, error)
 	CreateSnapshot(ctx context.Context, opts snapshots.CreateOptsBuilder) (*snapshots.Snapshot, error)
 	DeleteSnapshot(ctx context.Context, snapID string) error
 
+	// The share group snapshot calls use at least the microversion 2.55, from which the share groups are not experimental
+	GetShareGroupSnapshotByID(ctx context.Context, groupSnapshotID string) (*ShareGroupSnapshot, error)
+	GetShareGroupSnapshotByName(ctx context.Context, groupSnapshotName string) (*ShareGroupSnapshot, error)
+	CreateShareGroupSnapshot(ctx context.Context, opts CreateShareGroupSnapshotOpts) (*ShareGroupSnapshot, error)
+	DeleteShareGroupSnapshot(ctx context.Context, groupSnapshotID string) error
+
 	GetExtraSpecs(ctx context.Context, shareTypeID string) (sharetypes.ExtraSpecs, error)
 	GetShareTypes(ctx context.Context) ([]sharetypes.ShareType, error)
 	GetShareTypeIDFromName(ctx context.Context, shareTypeName string) (string, error)
 
+	// The share replica calls use at least the microversion 2.56, from which the replicas are not experimental
+	GetReplicas(ctx context.Context, shareID string) ([]replicas.Replica, error)
+	CreateReplica(ctx context.Context, opts replicas.CreateOptsBuilder) (*replicas.Replica, error)
+	DeleteReplica(ctx context.Context, replicaID string) error
+	PromoteReplica(ctx context.Context, replicaID string) error
+
+	GetShareNetworkByID(ctx context.Context, shareNetworkID string) (*sharenetworks.ShareNetwork, error)
+	GetShareNetworks(ctx context.Context, opts sharenetworks.ListOptsBuilder) ([]sharenetworks.ShareNetwork, error)
+	// GetNetworkIDsByTag returns the IDs of the Neutron networks which have the tag
+	GetNetworkIDsByTag(ctx context.Context, tag string) ([]string, error)
+	// GetSubnetCIDRs returns the CIDRs of the Neutron subnets
+	GetSubnetCIDRs(ctx context.Context) ([]string, error)
+
 	GetUserMessages(ctx context.Context, opts messages.ListOptsBuilder) ([]messages.Message, error)
+
+	GetLimits(ctx context.Context) (*Limits, error)
+	// The pools and the services are only listed by the admins with the default Manila policy
+	GetPools(ctx context.Context, opts schedulerstats.ListDetailOptsBuilder) ([]schedulerstats.Pool, error)
+	GetServices(ctx context.Context, opts services.ListOptsBuilder) ([]services.Service, error)
 }
 
 type Builder interface {
@@ -0,0 +1,65 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manilaclient
+
+import (
+	"context"
+
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+)
+
+// Limits are the absolute limits of the project, as reported by Manila.
+// Gophercloud doesn't implement the limits API of the shared file systems.
+// perShareGigabytesMicroversion is the microversion from which the per share gigabytes quota is reported
+const perShareGigabytesMicroversion = "2.62"
+
+type Limits struct {
+	// The total gigabytes of the shares the project may use, -1 if unlimited
+	MaxTotalShareGigabytes int `json:"maxTotalShareGigabytes"`
+	// The total gigabytes of the shares the project uses
+	TotalShareGigabytesUsed int `json:"totalShareGigabytesUsed"`
+	// The number of shares the project may have, -1 if unlimited
+	MaxTotalShares int `json:"maxTotalShares"`
+	// The number of shares the project has
+	TotalSharesUsed int `json:"totalSharesUsed"`
+	// The gigabytes of a single share, -1 if unlimited, 0 if the server doesn't report it
+	MaxPerShareGigabytes int `json:"maxPerShareGigabytes"`
+}
+
+func (c Client) GetLimits(ctx context.Context) (*Limits, error) {
+	var res struct {
+		Limits struct {
+			Absolute Limits `json:"absolute"`
+		} `json:"limits"`
+	}
+
+	get := func() error {
+		_, err := c.c.Get(ctx, c.c.ServiceURL("limits"), &res, nil)
+		return err
+	}
+
+	mc := metrics.NewMetricContext("limits", "get")
+	if c.SupportsMicroversion(perShareGigabytesMicroversion) {
+		if err := c.withMicroversion(perShareGigabytesMicroversion, get); mc.ObserveRequest(err) != nil {
+			return nil, err
+		}
+	} else if err := get(); mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+
+	return &res.Limits.Absolute, nil
+}
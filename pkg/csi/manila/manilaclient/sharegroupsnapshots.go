@@ -0,0 +1,143 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manilaclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+)
+
+// Gophercloud doesn't implement the share group snapshots API, which is
+// not experimental from the microversion 2.55.
+const shareGroupsMicroversion = "2.55"
+
+// ShareGroupSnapshot is a snapshot of all the shares of a share group.
+type ShareGroupSnapshot struct {
+	ID           string                     `json:"id"`
+	Name         string                     `json:"name"`
+	Description  string                     `json:"description"`
+	Status       string                     `json:"status"`
+	ShareGroupID string                     `json:"share_group_id"`
+	Members      []ShareGroupSnapshotMember `json:"members"`
+	CreatedAt    time.Time                  `json:"-"`
+}
+
+func (r *ShareGroupSnapshot) UnmarshalJSON(b []byte) error {
+	type tmp ShareGroupSnapshot
+	var s struct {
+		tmp
+		CreatedAt gophercloud.JSONRFC3339MilliNoZ `json:"created_at"`
+	}
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return err
+	}
+	*r = ShareGroupSnapshot(s.tmp)
+
+	r.CreatedAt = time.Time(s.CreatedAt)
+
+	return nil
+}
+
+// ShareGroupSnapshotMember is the snapshot of a share of the share group.
+type ShareGroupSnapshotMember struct {
+	ID      string `json:"id"`
+	ShareID string `json:"share_id"`
+	Size    int    `json:"size"`
+}
+
+// CreateShareGroupSnapshotOpts are the options of a new share group snapshot.
+type CreateShareGroupSnapshotOpts struct {
+	ShareGroupID string `json:"share_group_id"`
+	Name         string `json:"name,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+func (c Client) GetShareGroupSnapshotByID(ctx context.Context, groupSnapshotID string) (*ShareGroupSnapshot, error) {
+	var res struct {
+		ShareGroupSnapshot *ShareGroupSnapshot `json:"share_group_snapshot"`
+	}
+
+	mc := metrics.NewMetricContext("share_group_snapshot", "get")
+	err := c.withMicroversion(shareGroupsMicroversion, func() error {
+		_, err := c.c.Get(ctx, c.c.ServiceURL("share-group-snapshots", groupSnapshotID), &res, nil)
+		return err
+	})
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+
+	return res.ShareGroupSnapshot, nil
+}
+
+func (c Client) GetShareGroupSnapshotByName(ctx context.Context, groupSnapshotName string) (*ShareGroupSnapshot, error) {
+	var res struct {
+		ShareGroupSnapshots []ShareGroupSnapshot `json:"share_group_snapshots"`
+	}
+
+	mc := metrics.NewMetricContext("share_group_snapshot", "list")
+	err := c.withMicroversion(shareGroupsMicroversion, func() error {
+		_, err := c.c.Get(ctx, c.c.ServiceURL("share-group-snapshots", "detail")+"?"+url.Values{"name": {groupSnapshotName}}.Encode(), &res, nil)
+		return err
+	})
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+
+	switch len(res.ShareGroupSnapshots) {
+	case 0:
+		return nil, gophercloud.ErrResourceNotFound{Name: groupSnapshotName, ResourceType: "share group snapshot"}
+	case 1:
+		return &res.ShareGroupSnapshots[0], nil
+	default:
+		return nil, gophercloud.ErrMultipleResourcesFound{Name: groupSnapshotName, Count: len(res.ShareGroupSnapshots), ResourceType: "share group snapshot"}
+	}
+}
+
+func (c Client) CreateShareGroupSnapshot(ctx context.Context, opts CreateShareGroupSnapshotOpts) (*ShareGroupSnapshot, error) {
+	var res struct {
+		ShareGroupSnapshot *ShareGroupSnapshot `json:"share_group_snapshot"`
+	}
+
+	mc := metrics.NewMetricContext("share_group_snapshot", "create")
+	err := c.withMicroversion(shareGroupsMicroversion, func() error {
+		_, err := c.c.Post(ctx, c.c.ServiceURL("share-group-snapshots"), map[string]any{"share_group_snapshot": opts}, &res, &gophercloud.RequestOpts{
+			OkCodes: []int{202},
+		})
+		return err
+	})
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+
+	return res.ShareGroupSnapshot, nil
+}
+
+func (c Client) DeleteShareGroupSnapshot(ctx context.Context, groupSnapshotID string) error {
+	mc := metrics.NewMetricContext("share_group_snapshot", "delete")
+	return mc.ObserveRequest(c.withMicroversion(shareGroupsMicroversion, func() error {
+		_, err := c.c.Delete(ctx, c.c.ServiceURL("share-group-snapshots", groupSnapshotID), &gophercloud.RequestOpts{
+			OkCodes: []int{202},
+		})
+		return err
+	}))
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shares"
+	"google.golang.org/grpc"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog/v2"
+)
+
+// shareMetricsInterval is the interval between the updates of the share metrics
+const shareMetricsInterval = time.Minute
+
+// serveMetrics serves the metrics on the /metrics path of the given endpoint
+func serveMetrics(httpEndpoint string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", legacyregistry.HandlerWithReset())
+
+	klog.Infof("Serving metrics on %s", httpEndpoint)
+
+	if err := http.ListenAndServe(httpEndpoint, mux); err != nil {
+		klog.Fatalf("failed to listen & serve metrics on %s: %v", httpEndpoint, err)
+	}
+}
+
+// observeGRPC records the latency and the result of the CSI RPCs
+func observeGRPC(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	mc := metrics.NewCSIMetricContext(path.Base(info.FullMethod))
+	resp, err := handler(ctx, req)
+	return resp, mc.ObserveCSIOperation(err)
+}
+
+// runShareMetrics periodically counts the shares of the cluster by status, until ctx is done.
+func (d *Driver) runShareMetrics(ctx context.Context) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		manilaClient, err := newManilaClientFromSecret(ctx, d.kubeClient, d.manilaClientBuilder, d.shareMetricsSecretNamespace, d.shareMetricsSecretName)
+		if err != nil {
+			klog.Errorf("share metrics: %v", err)
+			return
+		}
+
+		if err := d.updateShareMetrics(ctx, manilaClient); err != nil {
+			klog.Errorf("share metrics: %v", err)
+		}
+	}, shareMetricsInterval)
+}
+
+// updateShareMetrics sets the number of the shares of the cluster and of the share protocol of the
+// driver in each status.
+func (d *Driver) updateShareMetrics(ctx context.Context, manilaClient manilaclient.Interface) error {
+	ss, err := manilaClient.GetShares(ctx, shares.ListOpts{
+		Metadata: map[string]string{clusterMetadataKey: d.clusterID},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list shares: %v", err)
+	}
+
+	sharesByStatus := make(map[string]int)
+	for i := range ss {
+		if strings.EqualFold(ss[i].ShareProto, d.shareProto) {
+			sharesByStatus[ss[i].Status]++
+		}
+	}
+
+	metrics.SetManilaShares(d.shareProto, sharesByStatus)
+
+	return nil
+}
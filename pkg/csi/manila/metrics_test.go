@@ -0,0 +1,113 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shares"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestObserveGRPC(t *testing.T) {
+	metrics.RegisterMetrics("manila-csi")
+
+	info := grpc.UnaryServerInfo{
+		FullMethod: "/csi.v1.Controller/CreateVolume",
+	}
+	ok := func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil }
+	exhausted := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.ResourceExhausted, "quota exceeded")
+	}
+
+	_, _ = observeGRPC(context.Background(), nil, &info, ok)
+	if _, err := observeGRPC(context.Background(), nil, &info, exhausted); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected the error of the handler, got %v", err)
+	}
+
+	expected := `
+# HELP csi_operation_errors_total [ALPHA] Total number of errors for a CSI RPC served by the plugin
+# TYPE csi_operation_errors_total counter
+csi_operation_errors_total{grpc_code="ResourceExhausted",method="CreateVolume"} 1
+# HELP csi_operations_total [ALPHA] Total number of CSI RPCs served by the plugin
+# TYPE csi_operations_total counter
+csi_operations_total{grpc_code="OK",method="CreateVolume"} 1
+csi_operations_total{grpc_code="ResourceExhausted",method="CreateVolume"} 1
+`
+	if err := testutil.GatherAndCompare(legacyregistry.DefaultGatherer, strings.NewReader(expected), "csi_operations_total", "csi_operation_errors_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpdateShareMetrics(t *testing.T) {
+	metrics.RegisterMetrics("manila-csi")
+
+	cluster := map[string]string{clusterMetadataKey: "cluster"}
+	c := &fakeJanitorClient{}
+
+	d := &Driver{
+		shareProto: "NFS",
+		clusterID:  "cluster",
+	}
+
+	expected := `
+# HELP manila_csi_shares [ALPHA] Number of the Manila shares provisioned by the plugin for the cluster, by status
+# TYPE manila_csi_shares gauge
+`
+	for _, tt := range []struct {
+		shares   []shares.Share
+		expected string
+	}{
+		{
+			shares: []shares.Share{
+				{ID: "1", Status: shareAvailable, ShareProto: "NFS", Metadata: cluster},
+				{ID: "2", Status: shareAvailable, ShareProto: "NFS", Metadata: cluster},
+				{ID: "3", Status: shareError, ShareProto: "NFS", Metadata: cluster},
+				{ID: "4", Status: shareError, ShareProto: "CEPHFS", Metadata: cluster},
+				{ID: "5", Status: shareError, ShareProto: "NFS", Metadata: map[string]string{clusterMetadataKey: "other"}},
+			},
+			expected: expected + `manila_csi_shares{protocol="NFS",status="available"} 2
+manila_csi_shares{protocol="NFS",status="error"} 1
+`,
+		},
+		{
+			// The error share is deleted
+			shares: []shares.Share{
+				{ID: "1", Status: shareAvailable, ShareProto: "NFS", Metadata: cluster},
+				{ID: "2", Status: shareAvailable, ShareProto: "NFS", Metadata: cluster},
+			},
+			expected: expected + `manila_csi_shares{protocol="NFS",status="available"} 2
+`,
+		},
+	} {
+		c.shares = tt.shares
+		if err := d.updateShareMetrics(context.Background(), c); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := testutil.GatherAndCompare(legacyregistry.DefaultGatherer, strings.NewReader(tt.expected), "manila_csi_shares"); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -130,12 +130,17 @@ func (ns *nodeServer) buildVolumeContext(ctx context.Context, volID volumeID, sh
 		return nil, nil, status.Errorf(codes.InvalidArgument, "failed to build volume context for volume %s: %v", volID, err)
 	}
 
+	if ns.d.shareProto == "CEPHFS" {
+		selectCephfsMounter(volumeContext)
+	}
+
 	return
 }
 
-func buildNodePublishSecret(accessRight *shares.AccessRight, sa shareadapters.ShareAdapter, volID volumeID) (map[string]string, error) {
+func buildNodePublishSecret(accessRight *shares.AccessRight, sa shareadapters.ShareAdapter, volID volumeID, secrets map[string]string) (map[string]string, error) {
 	opts := &shareadapters.SecretArgs{
 		AccessRight: accessRight,
+		Secrets:     secrets,
 	}
 	secret, err := sa.BuildNodePublishSecret(opts)
 	if err != nil {
@@ -145,9 +150,10 @@ func buildNodePublishSecret(accessRight *shares.AccessRight, sa shareadapters.Sh
 	return secret, nil
 }
 
-func buildNodeStageSecret(accessRight *shares.AccessRight, sa shareadapters.ShareAdapter, volID volumeID) (map[string]string, error) {
+func buildNodeStageSecret(accessRight *shares.AccessRight, sa shareadapters.ShareAdapter, volID volumeID, secrets map[string]string) (map[string]string, error) {
 	opts := &shareadapters.SecretArgs{
 		AccessRight: accessRight,
+		Secrets:     secrets,
 	}
 	secret, err := sa.BuildNodeStageSecret(opts)
 	if err != nil {
@@ -157,6 +163,23 @@ func buildNodeStageSecret(accessRight *shares.AccessRight, sa shareadapters.Shar
 	return secret, nil
 }
 
+// useCephxCredentials returns true if the node RPC is given the cephx credentials of the share
+// in the secret generated by the controller, in which case Manila isn't queried.
+func (ns *nodeServer) useCephxCredentials(secrets map[string]string) bool {
+	return ns.d.shareProto == "CEPHFS" && hasCephxCredentials(secrets)
+}
+
+func buildCephxVolumeContextFromOptions(shareOpts *options.NodeVolumeContext, volID volumeID) (map[string]string, error) {
+	volumeCtx, err := shareadapters.Cephfs{}.BuildVolumeContextFromOptions(shareOpts)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to build volume context for volume %s: %v", volID, err)
+	}
+
+	selectCephfsMounter(volumeCtx)
+
+	return volumeCtx, nil
+}
+
 func (ns *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
 	if err := validateNodePublishVolumeRequest(req); err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
@@ -169,9 +192,14 @@ func (ns *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 		return nil, status.Errorf(codes.InvalidArgument, "invalid volume context: %v", err)
 	}
 
-	osOpts, err := options.NewOpenstackOptions(req.GetSecrets())
-	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, "invalid OpenStack secrets: %v", err)
+	useCephx := ns.useCephxCredentials(req.GetSecrets())
+
+	var osOpts *client.AuthOpts
+	if !useCephx {
+		osOpts, err = options.NewOpenstackOptions(req.GetSecrets())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid OpenStack secrets: %v", err)
+		}
 	}
 
 	volID := volumeID(req.GetVolumeId())
@@ -192,15 +220,21 @@ func (ns *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 			volumeCtx, secret = cacheEntry.volumeContext, cacheEntry.publishSecret
 		} else {
 			klog.Warningf("STAGE_UNSTAGE_VOLUME capability is enabled, but node stage cache doesn't contain an entry for %s - this is most likely a bug! Rebuilding staging data anyway...", volID)
-			volumeCtx, accessRight, err = ns.buildVolumeContext(ctx, volID, shareOpts, osOpts)
-			if err == nil {
-				secret, err = buildNodePublishSecret(accessRight, getShareAdapter(ns.d.shareProto), volID)
+			if useCephx {
+				volumeCtx, err = buildCephxVolumeContextFromOptions(shareOpts, volID)
+			} else {
+				volumeCtx, accessRight, err = ns.buildVolumeContext(ctx, volID, shareOpts, osOpts)
+				if err == nil {
+					secret, err = buildNodePublishSecret(accessRight, getShareAdapter(ns.d.shareProto), volID, req.GetSecrets())
+				}
 			}
 		}
+	} else if useCephx {
+		volumeCtx, err = buildCephxVolumeContextFromOptions(shareOpts, volID)
 	} else {
 		volumeCtx, accessRight, err = ns.buildVolumeContext(ctx, volID, shareOpts, osOpts)
 		if err == nil {
-			secret, err = buildNodePublishSecret(accessRight, getShareAdapter(ns.d.shareProto), volID)
+			secret, err = buildNodePublishSecret(accessRight, getShareAdapter(ns.d.shareProto), volID, req.GetSecrets())
 		}
 	}
 	if err != nil {
@@ -218,6 +252,11 @@ func (ns *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 	req.Secrets = secret
 	req.VolumeContext = volumeCtx
 
+	// The NFS mount flags are set by NodeStageVolume if the proxied driver stages the volumes
+	if mnt := req.GetVolumeCapability().GetMount(); mnt != nil && strings.EqualFold(ns.d.shareProto, "NFS") && !ns.supportsNodeStage {
+		mnt.MountFlags = shareadapters.NFSMountFlags(shareOpts, mnt.MountFlags)
+	}
+
 	return ns.d.csiClientBuilder.NewNodeServiceClient(csiConn).PublishVolume(ctx, req)
 }
 
@@ -254,9 +293,14 @@ func (ns *nodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStageVol
 		return nil, status.Errorf(codes.InvalidArgument, "invalid volume context: %v", err)
 	}
 
-	osOpts, err := options.NewOpenstackOptions(req.GetSecrets())
-	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, "invalid OpenStack secrets: %v", err)
+	useCephx := ns.useCephxCredentials(req.GetSecrets())
+
+	var osOpts *client.AuthOpts
+	if !useCephx {
+		osOpts, err = options.NewOpenstackOptions(req.GetSecrets())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid OpenStack secrets: %v", err)
+		}
 	}
 
 	volID := volumeID(req.GetVolumeId())
@@ -264,15 +308,26 @@ func (ns *nodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStageVol
 	ns.nodeStageCacheMtx.Lock()
 	if cacheEntry, ok := ns.nodeStageCache[volID]; ok {
 		volumeCtx, stageSecret = cacheEntry.volumeContext, cacheEntry.stageSecret
+	} else if useCephx {
+		// The generated secret holds the cephx credentials CSI CephFS expects
+		volumeCtx, err = buildCephxVolumeContextFromOptions(shareOpts, volID)
+		stageSecret = map[string]string{
+			cephxUserIDKey:  req.GetSecrets()[cephxUserIDKey],
+			cephxUserKeyKey: req.GetSecrets()[cephxUserKeyKey],
+		}
+
+		if err == nil {
+			ns.nodeStageCache[volID] = stageCacheEntry{volumeContext: volumeCtx, stageSecret: stageSecret}
+		}
 	} else {
 		volumeCtx, accessRight, err = ns.buildVolumeContext(ctx, volID, shareOpts, osOpts)
 
 		if err == nil {
-			stageSecret, err = buildNodeStageSecret(accessRight, getShareAdapter(ns.d.shareProto), volID)
+			stageSecret, err = buildNodeStageSecret(accessRight, getShareAdapter(ns.d.shareProto), volID, req.GetSecrets())
 		}
 
 		if err == nil {
-			publishSecret, err = buildNodePublishSecret(accessRight, getShareAdapter(ns.d.shareProto), volID)
+			publishSecret, err = buildNodePublishSecret(accessRight, getShareAdapter(ns.d.shareProto), volID, req.GetSecrets())
 		}
 
 		if err == nil {
@@ -295,6 +350,14 @@ func (ns *nodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStageVol
 	req.Secrets = stageSecret
 	req.VolumeContext = volumeCtx
 
+	if mnt := req.GetVolumeCapability().GetMount(); mnt != nil && strings.EqualFold(ns.d.shareProto, "CIFS") {
+		mnt.MountFlags = shareadapters.CIFSMountFlags(shareOpts, mnt.MountFlags)
+	}
+
+	if mnt := req.GetVolumeCapability().GetMount(); mnt != nil && strings.EqualFold(ns.d.shareProto, "NFS") {
+		mnt.MountFlags = shareadapters.NFSMountFlags(shareOpts, mnt.MountFlags)
+	}
+
 	return ns.d.csiClientBuilder.NewNodeServiceClient(csiConn).StageVolume(ctx, req)
 }
 
@@ -359,5 +422,17 @@ func (ns *nodeServer) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVo
 }
 
 func (ns *nodeServer) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandVolumeRequest) (*csi.NodeExpandVolumeResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "")
+	// Manila shares are resized by ControllerExpandVolume, mounted shares
+	// see their new size without any action on the node.
+	// The node service doesn't advertise the EXPAND_VOLUME capability,
+	// this is only a no-op for the COs which call it regardless.
+	if req.GetVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume ID missing in request")
+	}
+
+	if req.GetVolumePath() == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume path missing in request")
+	}
+
+	return &csi.NodeExpandVolumeResponse{}, nil
 }
@@ -21,23 +21,33 @@ import (
 )
 
 type ControllerVolumeContext struct {
-	Protocol            string `name:"protocol" matches:"^(?i)CEPHFS|NFS$"`
-	Type                string `name:"type" value:"default:default"`
-	ShareNetworkID      string `name:"shareNetworkID" value:"optional"`
-	AutoTopology        string `name:"autoTopology" value:"default:false" matches:"(?i)^true|false$"`
-	AvailabilityZone    string `name:"availability" value:"optional"`
-	AppendShareMetadata string `name:"appendShareMetadata" value:"optional"`
-	Affinity            string `name:"affinity" value:"optional"`
-	AntiAffinity        string `name:"antiAffinity" value:"optional"`
-	GroupID             string `name:"groupID" value:"optional"`
+	Protocol                 string `name:"protocol" matches:"^(?i)CEPHFS|NFS|CIFS$"`
+	Type                     string `name:"type" value:"default:default"`
+	ShareNetworkID           string `name:"shareNetworkID" value:"optional"`
+	ShareNetworkName         string `name:"shareNetworkName" value:"optional" precludes:"shareNetworkID,shareNetworkTag"`
+	ShareNetworkTag          string `name:"shareNetworkTag" value:"optional" precludes:"shareNetworkID,shareNetworkName"`
+	AutoTopology             string `name:"autoTopology" value:"default:false" matches:"(?i)^true|false$"`
+	AutoTopologyZoneMap      string `name:"autoTopologyZoneMap" value:"optional"`
+	AvailabilityZone         string `name:"availability" value:"optional"`
+	AppendShareMetadata      string `name:"appendShareMetadata" value:"optional"`
+	Affinity                 string `name:"affinity" value:"optional"`
+	AntiAffinity             string `name:"antiAffinity" value:"optional"`
+	GroupID                  string `name:"groupID" value:"optional"`
+	ReplicaAvailabilityZones string `name:"replicaAvailabilityZones" value:"optional"`
+	ParentShareID            string `name:"parentShareID" value:"optional"`
+	ExtendAfterRestore       string `name:"extendAfterRestore" value:"default:false" matches:"(?i)^true|false$"`
 
 	// Adapter options
 
-	CephfsMounter            string `name:"cephfs-mounter" value:"default:fuse" matches:"^kernel|fuse$"`
+	CephfsMounter            string `name:"cephfs-mounter" value:"default:fuse" matches:"^(kernel|fuse|auto)$"`
 	CephfsClientID           string `name:"cephfs-clientID" value:"optional"`
 	CephfsKernelMountOptions string `name:"cephfs-kernelMountOptions" value:"optional"`
 	CephfsFuseMountOptions   string `name:"cephfs-fuseMountOptions" value:"optional"`
 	NFSShareClient           string `name:"nfs-shareClient" value:"default:0.0.0.0/0"`
+	NFSShareClientSource     string `name:"nfs-shareClientSource" value:"default:shareClient" matches:"^(shareClient|nodeSubnets|nodeAddresses)$"`
+	NFSMountOptions          string `name:"nfs-mountOptions" value:"optional"`
+	CIFSShareUser            string `name:"cifs-shareUser" value:"requiredIf:protocol=^(?i)CIFS$"`
+	CIFSSMBVersion           string `name:"cifs-smbVersion" value:"optional" matches:"^(1\\.0|2\\.0|2\\.1|3|3\\.0|3\\.02|3\\.1\\.1|default)$"`
 }
 
 type NodeVolumeContext struct {
@@ -45,12 +55,21 @@ type NodeVolumeContext struct {
 	ShareName      string `name:"shareName" value:"optionalIf:shareID=." precludes:"shareID"`
 	ShareAccessID  string `name:"shareAccessID" value:"optionalIf:shareAccessIDs=." precludes:"shareAccessIDs"` // Keep this for backwards compatibility
 	ShareAccessIDs string `name:"shareAccessIDs" value:"optionalIf:shareAccessID=." precludes:"shareAccessID"`
+	Subdir         string `name:"subdir" value:"optional"`
 
 	// Adapter options
 
-	CephfsMounter            string `name:"cephfs-mounter" value:"default:fuse" matches:"^kernel|fuse$"`
+	CephfsMounter            string `name:"cephfs-mounter" value:"default:fuse" matches:"^(kernel|fuse|auto)$"`
 	CephfsKernelMountOptions string `name:"cephfs-kernelMountOptions" value:"optional"`
 	CephfsFuseMountOptions   string `name:"cephfs-fuseMountOptions" value:"optional"`
+	NFSMountOptions          string `name:"nfs-mountOptions" value:"optional"`
+	CIFSSMBVersion           string `name:"cifs-smbVersion" value:"optional" matches:"^(1\\.0|2\\.0|2\\.1|3|3\\.0|3\\.02|3\\.1\\.1|default)$"`
+
+	// Set by the controller when it delivers the cephx credentials in a generated secret
+
+	CephfsMonitors string `name:"cephfs-monitors" value:"optional"`
+	CephfsRootPath string `name:"cephfs-rootPath" value:"optional"`
+	CephfsFsName   string `name:"cephfs-fsName" value:"optional"`
 }
 
 var (
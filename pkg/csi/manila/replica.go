@@ -0,0 +1,229 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/replicas"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shares"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/options"
+	"k8s.io/cloud-provider-openstack/pkg/util"
+	clouderrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
+	"k8s.io/klog/v2"
+)
+
+const (
+	replicaStateActive = "active"
+
+	replicaAvailable         = "available"
+	replicaDeleting          = "deleting"
+	replicaReplicationChange = "replication_change"
+	replicaError             = "error"
+
+	// Share type extra spec set to the replication type of the share type, if any
+	extraSpecReplicationType = "replication_type"
+
+	// Mutable parameter of ControllerModifyVolume promoting the replica of the share
+	// in the given availability zone
+	activeReplicaAvailabilityZoneKey = "activeReplicaAvailabilityZone"
+)
+
+// ensureShareReplicas creates a replica of the share in each of the availability zones of the
+// replicaAvailabilityZones volume parameter which have none yet. The replicas are not waited for,
+// Manila syncs them in the background.
+func ensureShareReplicas(ctx context.Context, manilaClient manilaclient.Interface, share *shares.Share, shareOpts *options.ControllerVolumeContext) error {
+	zones := util.SplitTrim(shareOpts.ReplicaAvailabilityZones, ',')
+	if len(zones) == 0 {
+		return nil
+	}
+
+	if extraSpecs, err := getShareTypeExtraSpecs(ctx, manilaClient, shareOpts.Type); err != nil {
+		klog.Warningf("failed to retrieve extra specs of share type %s, not checking its replication support: %v", shareOpts.Type, err)
+	} else if v, _ := extraSpecs[extraSpecReplicationType].(string); v == "" {
+		return status.Errorf(codes.InvalidArgument, "share type %s does not support replicas: %s extra spec is not set", shareOpts.Type, extraSpecReplicationType)
+	}
+
+	existing, err := manilaClient.GetReplicas(ctx, share.ID)
+	if err != nil {
+		if errors.Is(err, manilaclient.ErrMicroversionNotSupported) {
+			return status.Errorf(codes.InvalidArgument, "share replicas are not supported by the Manila API: %v", err)
+		}
+
+		return status.Errorf(codes.Internal, "failed to list replicas of volume %s: %v", share.ID, err)
+	}
+
+	for _, zone := range zones {
+		if hasReplicaInZone(existing, zone) {
+			continue
+		}
+
+		replica, err := manilaClient.CreateReplica(ctx, replicas.CreateOpts{
+			ShareID:          share.ID,
+			ShareNetworkID:   share.ShareNetworkID,
+			AvailabilityZone: zone,
+		})
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to create replica of volume %s in availability zone %s: %v", share.ID, zone, err)
+		}
+
+		klog.V(4).Infof("created replica %s of volume %s in availability zone %s", replica.ID, share.ID, zone)
+	}
+
+	return nil
+}
+
+func hasReplicaInZone(rs []replicas.Replica, zone string) bool {
+	for _, r := range rs {
+		if r.AvailabilityZone == zone {
+			return true
+		}
+	}
+
+	return false
+}
+
+// deleteShareReplicas deletes the replicas of the share which are not active, which Manila
+// requires before deleting the share. An Unavailable error is returned while they are being deleted.
+func deleteShareReplicas(ctx context.Context, manilaClient manilaclient.Interface, shareID string) error {
+	share, err := manilaClient.GetShareByID(ctx, shareID)
+	if err != nil {
+		if clouderrors.IsNotFound(err) {
+			return nil
+		}
+
+		return status.Errorf(codes.Internal, "failed to retrieve volume %s: %v", shareID, err)
+	}
+
+	if !share.HasReplicas {
+		return nil
+	}
+
+	rs, err := manilaClient.GetReplicas(ctx, shareID)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to list replicas of volume %s: %v", shareID, err)
+	}
+
+	var pending int
+	for _, r := range rs {
+		if r.State == replicaStateActive {
+			continue
+		}
+
+		pending++
+
+		if r.Status == replicaDeleting {
+			continue
+		}
+
+		if err := manilaClient.DeleteReplica(ctx, r.ID); err != nil && !clouderrors.IsNotFound(err) {
+			return status.Errorf(codes.Internal, "failed to delete replica %s of volume %s: %v", r.ID, shareID, err)
+		}
+
+		klog.V(4).Infof("deleting replica %s of volume %s", r.ID, shareID)
+	}
+
+	if pending > 0 {
+		return status.Errorf(codes.Unavailable, "waiting for %d replicas of volume %s to be deleted", pending, shareID)
+	}
+
+	return nil
+}
+
+// promoteShareReplica promotes the replica of the share in the availability zone to the active replica,
+// and waits for the promotion to complete.
+func promoteShareReplica(ctx context.Context, manilaClient manilaclient.Interface, shareID, zone string) error {
+	rs, err := manilaClient.GetReplicas(ctx, shareID)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to list replicas of volume %s: %v", shareID, err)
+	}
+
+	var replica *replicas.Replica
+	for i := range rs {
+		if rs[i].AvailabilityZone == zone {
+			replica = &rs[i]
+			break
+		}
+	}
+
+	if replica == nil {
+		return status.Errorf(codes.InvalidArgument, "volume %s has no replica in availability zone %s", shareID, zone)
+	}
+
+	switch {
+	case replica.State == replicaStateActive && replica.Status == replicaAvailable:
+		return nil
+	case replica.Status == replicaReplicationChange:
+		klog.V(4).Infof("replica %s of volume %s is already being promoted, waiting for it to become active", replica.ID, shareID)
+	case replica.Status == replicaAvailable:
+		if err := manilaClient.PromoteReplica(ctx, replica.ID); err != nil {
+			return status.Errorf(codes.Internal, "failed to promote replica %s of volume %s: %v", replica.ID, shareID, err)
+		}
+
+		klog.V(4).Infof("promoting replica %s of volume %s in availability zone %s", replica.ID, shareID, zone)
+	default:
+		return status.Errorf(codes.FailedPrecondition, "replica %s of volume %s must be available to be promoted, but is in %s state", replica.ID, shareID, replica.Status)
+	}
+
+	backoff := wait.Backoff{
+		Duration: time.Second * waitForAvailableShareTimeout,
+		Factor:   1.2,
+		Steps:    waitForAvailableShareRetries,
+	}
+
+	err = wait.ExponentialBackoff(backoff, func() (bool, error) {
+		rs, err := manilaClient.GetReplicas(ctx, shareID)
+		if err != nil {
+			return false, err
+		}
+
+		for _, r := range rs {
+			if r.ID != replica.ID {
+				continue
+			}
+
+			switch r.Status {
+			case replicaAvailable:
+				return r.State == replicaStateActive, nil
+			case replicaReplicationChange:
+				return false, nil
+			case replicaError:
+				return false, fmt.Errorf("replica %s is in error state", r.ID)
+			default:
+				return false, fmt.Errorf("replica %s is in an unexpected state: wanted either %s or %s, got %s", r.ID, replicaReplicationChange, replicaAvailable, r.Status)
+			}
+		}
+
+		return false, fmt.Errorf("replica %s not found", replica.ID)
+	})
+	if err != nil {
+		if wait.Interrupted(err) {
+			return status.Errorf(codes.DeadlineExceeded, "deadline exceeded while waiting for replica %s of volume %s to become active", replica.ID, shareID)
+		}
+
+		return status.Errorf(codes.Internal, "failed to promote replica %s of volume %s: %v", replica.ID, shareID, err)
+	}
+
+	return nil
+}
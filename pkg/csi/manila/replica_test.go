@@ -0,0 +1,212 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/replicas"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shares"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/sharetypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/options"
+)
+
+// fakeReplicaClient serves the replicas of the share of fakeShareClient. Promoting a replica
+// completes immediately. If unsupported is set, the server doesn't support the replicas microversion.
+type fakeReplicaClient struct {
+	fakeShareClient
+
+	unsupported bool
+
+	replicas []replicas.Replica
+	created  []string
+	deleted  []string
+	promoted []string
+}
+
+func (c *fakeReplicaClient) GetReplicas(_ context.Context, shareID string) ([]replicas.Replica, error) {
+	if c.unsupported {
+		return nil, fmt.Errorf("%w: 2.56 is required, the server supports up to 2.55", manilaclient.ErrMicroversionNotSupported)
+	}
+	return append([]replicas.Replica(nil), c.replicas...), nil
+}
+
+func (c *fakeReplicaClient) CreateReplica(_ context.Context, opts replicas.CreateOptsBuilder) (*replicas.Replica, error) {
+	zone := opts.(replicas.CreateOpts).AvailabilityZone
+	c.created = append(c.created, zone)
+	return &replicas.Replica{ID: "replica-" + zone, AvailabilityZone: zone}, nil
+}
+
+func (c *fakeReplicaClient) DeleteReplica(_ context.Context, replicaID string) error {
+	c.deleted = append(c.deleted, replicaID)
+	return nil
+}
+
+func (c *fakeReplicaClient) PromoteReplica(_ context.Context, replicaID string) error {
+	c.promoted = append(c.promoted, replicaID)
+	for i := range c.replicas {
+		if c.replicas[i].ID == replicaID {
+			c.replicas[i].State = replicaStateActive
+		} else {
+			c.replicas[i].State = "in_sync"
+		}
+	}
+	return nil
+}
+
+func replicatedShareTypes() []sharetypes.ShareType {
+	return []sharetypes.ShareType{{ID: "id-replicated", Name: "replicated", ExtraSpecs: map[string]any{extraSpecReplicationType: "dr"}}, {ID: "id-default", Name: "default"}}
+}
+
+func TestEnsureShareReplicas(t *testing.T) {
+	ts := []struct {
+		name            string
+		shareType       string
+		zones           string
+		unsupported     bool
+		replicas        []replicas.Replica
+		expectedCreated []string
+		expectedCode    codes.Code
+	}{
+		{name: "no replicas requested", shareType: "default"},
+		{name: "missing replicas", shareType: "replicated", zones: "az-1, az-2,az-3", replicas: []replicas.Replica{{ID: "active", AvailabilityZone: "az-1"}}, expectedCreated: []string{"az-2", "az-3"}},
+		{name: "existing replicas", shareType: "replicated", zones: "az-1,az-2", replicas: []replicas.Replica{{AvailabilityZone: "az-1"}, {AvailabilityZone: "az-2"}}},
+		{name: "share type without replication", shareType: "default", zones: "az-2", expectedCode: codes.InvalidArgument},
+		{name: "replicas not supported by the server", shareType: "replicated", zones: "az-2", unsupported: true, expectedCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range ts {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &fakeReplicaClient{fakeShareClient: fakeShareClient{shareTypes: replicatedShareTypes()}, unsupported: tt.unsupported, replicas: tt.replicas}
+			shareOpts := &options.ControllerVolumeContext{Type: tt.shareType, ReplicaAvailabilityZones: tt.zones}
+
+			err := ensureShareReplicas(context.Background(), c, &shares.Share{ID: "share"}, shareOpts)
+			if status.Code(err) != tt.expectedCode {
+				t.Fatalf("expected code %s, got error %v", tt.expectedCode, err)
+			}
+
+			if !reflect.DeepEqual(c.created, tt.expectedCreated) {
+				t.Errorf("expected replicas created in %v, got %v", tt.expectedCreated, c.created)
+			}
+		})
+	}
+}
+
+func TestDeleteShareReplicas(t *testing.T) {
+	ts := []struct {
+		name            string
+		hasReplicas     bool
+		replicas        []replicas.Replica
+		expectedDeleted []string
+		expectedCode    codes.Code
+	}{
+		{name: "no replicas", replicas: []replicas.Replica{{ID: "active", State: replicaStateActive}}},
+		{name: "only the active replica left", hasReplicas: true, replicas: []replicas.Replica{{ID: "active", State: replicaStateActive}}},
+		{
+			name:        "non-active replicas",
+			hasReplicas: true,
+			replicas: []replicas.Replica{
+				{ID: "active", State: replicaStateActive, Status: replicaAvailable},
+				{ID: "in-sync", State: "in_sync", Status: replicaAvailable},
+				{ID: "deleting", State: "out_of_sync", Status: replicaDeleting},
+			},
+			expectedDeleted: []string{"in-sync"},
+			expectedCode:    codes.Unavailable,
+		},
+	}
+
+	for _, tt := range ts {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &fakeReplicaClient{fakeShareClient: fakeShareClient{share: shares.Share{ID: "share", HasReplicas: tt.hasReplicas}}, replicas: tt.replicas}
+
+			err := deleteShareReplicas(context.Background(), c, "share")
+			if status.Code(err) != tt.expectedCode {
+				t.Fatalf("expected code %s, got error %v", tt.expectedCode, err)
+			}
+
+			if !reflect.DeepEqual(c.deleted, tt.expectedDeleted) {
+				t.Errorf("expected deleted replicas %v, got %v", tt.expectedDeleted, c.deleted)
+			}
+		})
+	}
+}
+
+func TestPromoteShareReplica(t *testing.T) {
+	ts := []struct {
+		name             string
+		zone             string
+		secondaryStatus  string
+		expectedPromoted []string
+		expectedCode     codes.Code
+	}{
+		{name: "already active", zone: "az-1", secondaryStatus: replicaAvailable},
+		{name: "promoted", zone: "az-2", secondaryStatus: replicaAvailable, expectedPromoted: []string{"secondary"}},
+		{name: "no replica in zone", zone: "az-3", secondaryStatus: replicaAvailable, expectedCode: codes.InvalidArgument},
+		{name: "replica in error state", zone: "az-2", secondaryStatus: replicaError, expectedCode: codes.FailedPrecondition},
+	}
+
+	for _, tt := range ts {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &fakeReplicaClient{replicas: []replicas.Replica{
+				{ID: "primary", AvailabilityZone: "az-1", State: replicaStateActive, Status: replicaAvailable},
+				{ID: "secondary", AvailabilityZone: "az-2", State: "in_sync", Status: tt.secondaryStatus},
+			}}
+
+			err := promoteShareReplica(context.Background(), c, "share", tt.zone)
+			if status.Code(err) != tt.expectedCode {
+				t.Fatalf("expected code %s, got error %v", tt.expectedCode, err)
+			}
+
+			if !reflect.DeepEqual(c.promoted, tt.expectedPromoted) {
+				t.Errorf("expected promoted replicas %v, got %v", tt.expectedPromoted, c.promoted)
+			}
+		})
+	}
+}
+
+func TestValidateControllerModifyVolumeRequest(t *testing.T) {
+	secrets := map[string]string{"os-authURL": "https://keystone"}
+
+	ts := []struct {
+		name      string
+		req       *csi.ControllerModifyVolumeRequest
+		expectErr bool
+	}{
+		{name: "valid", req: &csi.ControllerModifyVolumeRequest{VolumeId: "share", Secrets: secrets, MutableParameters: map[string]string{activeReplicaAvailabilityZoneKey: "az-2"}}},
+		{name: "no mutable parameters", req: &csi.ControllerModifyVolumeRequest{VolumeId: "share"}},
+		{name: "missing volume ID", req: &csi.ControllerModifyVolumeRequest{Secrets: secrets}, expectErr: true},
+		{name: "unsupported parameter", req: &csi.ControllerModifyVolumeRequest{VolumeId: "share", Secrets: secrets, MutableParameters: map[string]string{"type": "gold"}}, expectErr: true},
+		{name: "empty zone", req: &csi.ControllerModifyVolumeRequest{VolumeId: "share", Secrets: secrets, MutableParameters: map[string]string{activeReplicaAvailabilityZoneKey: ""}}, expectErr: true},
+		{name: "missing secrets", req: &csi.ControllerModifyVolumeRequest{VolumeId: "share", MutableParameters: map[string]string{activeReplicaAvailabilityZoneKey: "az-2"}}, expectErr: true},
+	}
+
+	for _, tt := range ts {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateControllerModifyVolumeRequest(tt.req)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("expected error: %t, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
@@ -87,13 +87,14 @@ func getOrCreateShare(ctx context.Context, manilaClient manilaclient.Interface,
 		klog.V(4).Infof("volume %s already exists", shareName)
 	}
 
-	// It exists, wait till it's Available
+	// It exists, wait till it's Available. A share restored from a snapshot
+	// may be being extended by a previous call
 
 	if share.Status == shareAvailable {
 		return share, 0, nil
 	}
 
-	return waitForShareStatus(ctx, manilaClient, share.ID, []string{shareCreating, shareCreatingFromSnapshot}, shareAvailable, false)
+	return waitForShareStatus(ctx, manilaClient, share.ID, []string{shareCreating, shareCreatingFromSnapshot, shareExtending}, shareAvailable, false)
 }
 
 func deleteShare(ctx context.Context, manilaClient manilaclient.Interface, shareID string) error {
@@ -125,22 +126,37 @@ func tryDeleteShare(ctx context.Context, manilaClient manilaclient.Interface, sh
 	}
 }
 
-func extendShare(ctx context.Context, manilaClient manilaclient.Interface, shareID string, newSizeInGiB int) (*shares.Share, error) {
-	opts := shares.ExtendOpts{
-		NewSize: newSizeInGiB,
-	}
+// extendShare extends the share to newSizeInGiB and waits for it to become available.
+// A share which is still being extended, e.g. by a previous, interrupted call, is only waited for.
+func extendShare(ctx context.Context, manilaClient manilaclient.Interface, share *shares.Share, newSizeInGiB int) (*shares.Share, error) {
+	shareID := share.ID
+
+	switch share.Status {
+	case shareAvailable:
+		opts := shares.ExtendOpts{
+			NewSize: newSizeInGiB,
+		}
 
-	if err := manilaClient.ExtendShare(ctx, shareID, opts); err != nil {
-		return nil, err
+		if err := manilaClient.ExtendShare(ctx, shareID, opts); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to resize volume %s: %v", shareID, err)
+		}
+	case shareExtending:
+		klog.V(4).Infof("volume %s is already being extended, waiting for it to become available", shareID)
+	default:
+		return nil, status.Errorf(codes.FailedPrecondition, "volume %s must be available to be resized, but is in %s state", shareID, share.Status)
 	}
 
 	share, manilaErrCode, err := waitForShareStatus(ctx, manilaClient, shareID, []string{shareExtending}, shareAvailable, false)
 	if err != nil {
 		if wait.Interrupted(err) {
-			return nil, status.Errorf(codes.DeadlineExceeded, "deadline exceeded while waiting for volume ID %s to become available", share.Name)
+			return nil, status.Errorf(codes.DeadlineExceeded, "deadline exceeded while waiting for volume ID %s to become available", shareID)
 		}
 
-		return nil, status.Errorf(manilaErrCode.toRPCErrorCode(), "failed to resize volume %s: %v", share.Name, err)
+		return nil, status.Errorf(manilaErrCode.toRPCErrorCode(), "failed to resize volume %s: %v", shareID, err)
+	}
+
+	if share.Size < newSizeInGiB {
+		return nil, status.Errorf(codes.Internal, "volume %s was resized to %d GiB instead of the requested %d GiB", shareID, share.Size, newSizeInGiB)
 	}
 
 	return share, nil
@@ -0,0 +1,121 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shares"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/sharetypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
+)
+
+// fakeShareClient serves a single share and the share types. The calls it doesn't implement panic.
+type fakeShareClient struct {
+	manilaclient.Interface
+
+	share      shares.Share
+	extended   bool
+	shareTypes []sharetypes.ShareType
+
+	// extendingPolls is the number of the next calls getting the share being extended
+	extendingPolls int
+}
+
+func (c *fakeShareClient) GetShareByID(_ context.Context, shareID string) (*shares.Share, error) {
+	s := c.share
+	if c.extendingPolls > 0 {
+		c.extendingPolls--
+		s.Status = shareExtending
+	}
+	return &s, nil
+}
+
+func (c *fakeShareClient) GetShareByName(ctx context.Context, shareName string) (*shares.Share, error) {
+	return c.GetShareByID(ctx, c.share.ID)
+}
+
+func (c *fakeShareClient) ExtendShare(_ context.Context, shareID string, opts shares.ExtendOptsBuilder) error {
+	c.extended = true
+	c.share.Size = opts.(shares.ExtendOpts).NewSize
+	return nil
+}
+
+func (c *fakeShareClient) GetShareTypes(_ context.Context) ([]sharetypes.ShareType, error) {
+	if c.shareTypes == nil {
+		return nil, errors.New("forbidden")
+	}
+	return c.shareTypes, nil
+}
+
+func TestExtendShare(t *testing.T) {
+	ts := []struct {
+		name             string
+		status           string
+		backendSize      int
+		expectedExtended bool
+		expectedCode     codes.Code
+	}{
+		{name: "available", status: shareAvailable, backendSize: 1, expectedExtended: true},
+		{name: "being extended", status: shareExtending, backendSize: 2},
+		{name: "not extended by the backend", status: shareExtending, backendSize: 1, expectedCode: codes.Internal},
+		{name: "in error state", status: shareErrorExtending, backendSize: 1, expectedCode: codes.FailedPrecondition},
+	}
+
+	for _, tt := range ts {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &fakeShareClient{share: shares.Share{ID: "share", Size: tt.backendSize, Status: shareAvailable}}
+			share := shares.Share{ID: "share", Size: 1, Status: tt.status}
+
+			s, err := extendShare(context.Background(), c, &share, 2)
+			if c.extended != tt.expectedExtended {
+				t.Errorf("expected the share to be extended: %t, got %t", tt.expectedExtended, c.extended)
+			}
+
+			if tt.expectedCode != codes.OK {
+				if status.Code(err) != tt.expectedCode {
+					t.Errorf("expected error code %s, got %v", tt.expectedCode, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if s.Size != 2 {
+				t.Errorf("expected size 2, got %d", s.Size)
+			}
+		})
+	}
+}
+
+func TestGetOrCreateShareBeingExtended(t *testing.T) {
+	// The share restored from a snapshot is being extended by a previous CreateVolume call
+	c := &fakeShareClient{share: shares.Share{ID: "share", Size: 2, Status: shareAvailable}, extendingPolls: 2}
+
+	s, _, err := getOrCreateShare(context.Background(), c, "share", &shares.CreateOpts{Size: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Status != shareAvailable || s.Size != 2 {
+		t.Errorf("expected an available share of size 2, got %s share of size %d", s.Status, s.Size)
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/gophercloud/gophercloud/v2"
 	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shares"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/options"
 	manilautil "k8s.io/cloud-provider-openstack/pkg/csi/manila/util"
 	"k8s.io/cloud-provider-openstack/pkg/util"
 	"k8s.io/klog/v2"
@@ -115,30 +116,49 @@ func (Cephfs) BuildVolumeContext(args *VolumeContextArgs) (volumeContext map[str
 
 	monitors, rootPath, err := splitExportLocationPath(args.Locations[chosenExportLocationIdx].Path)
 
+	// Extract fs_name from __mount_options metadata if available
+	// This is used by the ceph-csi plugin:
+	// https://github.com/ceph/ceph-csi/blob/521a90c041acbe0fc68db8ecb27ef84da5af87dc/docs/static-pvc.md?plain=1#L287
+	fsName := extractFsNameFromMountOptions(args.Share)
+	if fsName != "" {
+		klog.V(4).Infof("Found fs_name in share metadata: %s", fsName)
+	}
+
+	return buildCephfsVolumeContext(monitors, rootPath, fsName, args.Options), err
+}
+
+// BuildVolumeContextFromOptions builds the volume context from the cephfs-monitors, cephfs-rootPath
+// and cephfs-fsName fields of the node volume context, which are set by the controller when it delivers
+// the cephx credentials of the share in a generated secret. Manila is not queried.
+func (Cephfs) BuildVolumeContextFromOptions(opts *options.NodeVolumeContext) (volumeContext map[string]string, err error) {
+	if opts.CephfsMonitors == "" || opts.CephfsRootPath == "" {
+		return nil, fmt.Errorf("cephfs-monitors and cephfs-rootPath must be set when using cephx credentials from a generated secret")
+	}
+
+	return buildCephfsVolumeContext(opts.CephfsMonitors, opts.CephfsRootPath, opts.CephfsFsName, opts), nil
+}
+
+func buildCephfsVolumeContext(monitors, rootPath, fsName string, opts *options.NodeVolumeContext) map[string]string {
 	volCtx := map[string]string{
 		"monitors":        monitors,
 		"rootPath":        rootPath,
-		"mounter":         args.Options.CephfsMounter,
+		"mounter":         opts.CephfsMounter,
 		"provisionVolume": "false",
 	}
 
-	if args.Options.CephfsKernelMountOptions != "" {
-		volCtx["kernelMountOptions"] = args.Options.CephfsKernelMountOptions
+	if opts.CephfsKernelMountOptions != "" {
+		volCtx["kernelMountOptions"] = opts.CephfsKernelMountOptions
 	}
 
-	if args.Options.CephfsFuseMountOptions != "" {
-		volCtx["fuseMountOptions"] = args.Options.CephfsFuseMountOptions
+	if opts.CephfsFuseMountOptions != "" {
+		volCtx["fuseMountOptions"] = opts.CephfsFuseMountOptions
 	}
 
-	// Extract fs_name from __mount_options metadata if available
-	// This is used by the ceph-csi plugin:
-	// https://github.com/ceph/ceph-csi/blob/521a90c041acbe0fc68db8ecb27ef84da5af87dc/docs/static-pvc.md?plain=1#L287
-	if fsName := extractFsNameFromMountOptions(args.Share); fsName != "" {
+	if fsName != "" {
 		volCtx["fsName"] = fsName
-		klog.V(4).Infof("Found fs_name in share metadata: %s", fsName)
 	}
 
-	return volCtx, err
+	return volCtx
 }
 
 // extractFsNameFromMountOptions extracts the fs from __mount_options metadata
@@ -0,0 +1,144 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shareadapters
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shares"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/options"
+	manilautil "k8s.io/cloud-provider-openstack/pkg/csi/manila/util"
+	"k8s.io/klog/v2"
+)
+
+// Keys of the SMB credentials in the node stage secret. The user must be
+// one of the users granted access to the share with cifs-shareUser.
+const (
+	CIFSUsernameKey = "cifs-username"
+	CIFSPasswordKey = "cifs-password"
+	CIFSDomainKey   = "cifs-domain"
+)
+
+type CIFS struct{}
+
+var _ ShareAdapter = &CIFS{}
+
+func (CIFS) GetOrGrantAccesses(ctx context.Context, args *GrantAccessArgs) ([]shares.AccessRight, error) {
+	// First, check if the access right exists or needs to be created
+
+	rights, err := args.ManilaClient.GetAccessRights(ctx, args.Share.ID)
+	if err != nil {
+		if _, ok := err.(gophercloud.ErrResourceNotFound); !ok {
+			return nil, fmt.Errorf("failed to list access rights: %v", err)
+		}
+	}
+
+	accessToList := strings.Split(args.Options.CIFSShareUser, ",")
+
+	for _, at := range accessToList {
+		// Try to find the access right
+		found := false
+		for _, r := range rights {
+			if r.AccessTo == at && r.AccessType == "user" && r.AccessLevel == "rw" {
+				klog.V(4).Infof("user access right %s for share %s already exists", at, args.Share.Name)
+				found = true
+				break
+			}
+		}
+		// Not found, create it
+		if !found {
+			right, err := args.ManilaClient.GrantAccess(ctx, args.Share.ID, shares.GrantAccessOpts{
+				AccessType:  "user",
+				AccessLevel: "rw",
+				AccessTo:    at,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to grant access right: %v", err)
+			}
+			rights = append(rights, *right)
+		}
+	}
+
+	return rights, nil
+}
+
+func (CIFS) BuildVolumeContext(args *VolumeContextArgs) (volumeContext map[string]string, err error) {
+	chosenExportLocationIdx, err := manilautil.FindExportLocation(args.Locations, manilautil.AnyExportLocation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to choose an export location: %v", err)
+	}
+
+	source, err := cifsSource(args.Locations[chosenExportLocationIdx].Path)
+
+	return map[string]string{
+		"source": source,
+	}, err
+}
+
+func (CIFS) BuildNodeStageSecret(args *SecretArgs) (secret map[string]string, err error) {
+	username, password := args.Secrets[CIFSUsernameKey], args.Secrets[CIFSPasswordKey]
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("%s and %s must be set in the node stage secret", CIFSUsernameKey, CIFSPasswordKey)
+	}
+
+	secret = map[string]string{
+		"username": username,
+		"password": password,
+	}
+
+	if domain := args.Secrets[CIFSDomainKey]; domain != "" {
+		secret["domain"] = domain
+	}
+
+	return secret, nil
+}
+
+func (CIFS) BuildNodePublishSecret(args *SecretArgs) (secret map[string]string, err error) {
+	return nil, nil
+}
+
+// CIFSMountFlags returns the mount flags of the share, with the SMB version of
+// the cifs-smbVersion parameter unless the mount flags of the volume capability
+// already set one.
+func CIFSMountFlags(opts *options.NodeVolumeContext, mountFlags []string) []string {
+	if opts.CIFSSMBVersion == "" {
+		return mountFlags
+	}
+
+	for _, f := range mountFlags {
+		if strings.HasPrefix(f, "vers=") {
+			return mountFlags
+		}
+	}
+
+	return append(mountFlags, "vers="+opts.CIFSSMBVersion)
+}
+
+// cifsSource converts the UNC path of a CIFS export location, e.g. \\10.0.0.1\share,
+// to the source CSI SMB mounts, e.g. //10.0.0.1/share.
+func cifsSource(exportLocationPath string) (string, error) {
+	source := strings.ReplaceAll(exportLocationPath, `\`, "/")
+	server, share, _ := strings.Cut(strings.TrimPrefix(source, "//"), "/")
+	if !strings.HasPrefix(source, "//") || server == "" || share == "" {
+		return "", fmt.Errorf("failed to parse server and share from export location '%s'", exportLocationPath)
+	}
+
+	return source, nil
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shareadapters
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shares"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/options"
+)
+
+func TestCIFSBuildVolumeContext(t *testing.T) {
+	testCases := []struct {
+		name      string
+		path      string
+		expected  string
+		expectErr bool
+	}{
+		{name: "UNC path", path: `\\10.0.0.1\share-1234`, expected: "//10.0.0.1/share-1234"},
+		{name: "UNC path with directory", path: `\\fileserver.example.com\share-1234\dir`, expected: "//fileserver.example.com/share-1234/dir"},
+		{name: "missing share", path: `\\10.0.0.1`, expectErr: true},
+		{name: "not a UNC path", path: "10.0.0.1:/share-1234", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			volCtx, err := CIFS{}.BuildVolumeContext(&VolumeContextArgs{
+				Locations: []shares.ExportLocation{{Path: tc.path}},
+			})
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("expected an error, got volume context %v", volCtx)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if volCtx["source"] != tc.expected {
+				t.Errorf("expected source %q, got %q", tc.expected, volCtx["source"])
+			}
+		})
+	}
+}
+
+func TestCIFSBuildNodeStageSecret(t *testing.T) {
+	testCases := []struct {
+		name      string
+		secrets   map[string]string
+		expected  map[string]string
+		expectErr bool
+	}{
+		{
+			name:     "credentials",
+			secrets:  map[string]string{"os-authURL": "https://keystone", CIFSUsernameKey: "alice", CIFSPasswordKey: "secret"},
+			expected: map[string]string{"username": "alice", "password": "secret"},
+		},
+		{
+			name:     "credentials with domain",
+			secrets:  map[string]string{CIFSUsernameKey: "alice", CIFSPasswordKey: "secret", CIFSDomainKey: "EXAMPLE"},
+			expected: map[string]string{"username": "alice", "password": "secret", "domain": "EXAMPLE"},
+		},
+		{
+			name:      "missing password",
+			secrets:   map[string]string{CIFSUsernameKey: "alice"},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			secret, err := CIFS{}.BuildNodeStageSecret(&SecretArgs{Secrets: tc.secrets})
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("expected error: %t, got %v", tc.expectErr, err)
+			}
+			if !reflect.DeepEqual(secret, tc.expected) {
+				t.Errorf("expected secret %v, got %v", tc.expected, secret)
+			}
+		})
+	}
+}
+
+func TestCIFSMountFlags(t *testing.T) {
+	testCases := []struct {
+		name       string
+		smbVersion string
+		mountFlags []string
+		expected   []string
+	}{
+		{name: "no version", mountFlags: []string{"dir_mode=0777"}, expected: []string{"dir_mode=0777"}},
+		{name: "version", smbVersion: "3.1.1", mountFlags: []string{"dir_mode=0777"}, expected: []string{"dir_mode=0777", "vers=3.1.1"}},
+		{name: "version set by the mount flags", smbVersion: "3.1.1", mountFlags: []string{"vers=2.1"}, expected: []string{"vers=2.1"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			flags := CIFSMountFlags(&options.NodeVolumeContext{CIFSSMBVersion: tc.smbVersion}, tc.mountFlags)
+			if !reflect.DeepEqual(flags, tc.expected) {
+				t.Errorf("expected mount flags %v, got %v", tc.expected, flags)
+			}
+		})
+	}
+}
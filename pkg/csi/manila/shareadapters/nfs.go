@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"path"
 	"strings"
 
 	"github.com/gophercloud/gophercloud/v2"
@@ -80,6 +81,10 @@ func (NFS) BuildVolumeContext(args *VolumeContextArgs) (volumeContext map[string
 
 	server, share, err := splitExportLocationPath(args.Locations[chosenExportLocationIdx].Path)
 
+	if args.Options != nil && args.Options.Subdir != "" {
+		share = path.Join(share, args.Options.Subdir)
+	}
+
 	return map[string]string{
 		"server": server,
 		"share":  share,
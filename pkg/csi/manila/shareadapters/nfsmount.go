@@ -0,0 +1,213 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shareadapters
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/options"
+	"k8s.io/klog/v2"
+)
+
+var (
+	// The NFS mount options which take no value, see nfs(5) and mount(8). The
+	// ones which can be negated with the "no" prefix are listed without it.
+	nfsFlagOptions = map[string]bool{
+		"ro": true, "rw": true, "sync": true, "async": true, "defaults": true, "_netdev": true,
+		"atime": true, "diratime": true, "relatime": true, "strictatime": true, "lazytime": true,
+		"exec": true, "suid": true, "dev": true,
+		"hard": true, "soft": true, "softerr": true, "softreval": true, "intr": true,
+		"ac": true, "cto": true, "lock": true, "acl": true, "rdirplus": true, "sharecache": true,
+		"resvport": true, "fsc": true, "migration": true, "posix": true, "trunkdiscovery": true,
+		"bg": true, "fg": true, "tcp": true, "udp": true, "rdma": true,
+	}
+
+	// The NFS mount options which take a value, with the regular expression the
+	// value must match.
+	nfsValueOptions = map[string]*regexp.Regexp{
+		"vers":         regexp.MustCompile(`^(3|4|4\.[0-2])$`),
+		"nfsvers":      regexp.MustCompile(`^(3|4|4\.[0-2])$`),
+		"minorversion": regexp.MustCompile(`^[0-2]$`),
+		"nconnect":     reUint,
+		"timeo":        reUint,
+		"retrans":      reUint,
+		"retry":        reUint,
+		"rsize":        reUint,
+		"wsize":        reUint,
+		"acregmin":     reUint,
+		"acregmax":     reUint,
+		"acdirmin":     reUint,
+		"acdirmax":     reUint,
+		"actimeo":      reUint,
+		"port":         reUint,
+		"mountport":    reUint,
+		"namlen":       reUint,
+		"max_connect":  reUint,
+		"proto":        regexp.MustCompile(`^(tcp|udp|rdma)6?$`),
+		"mountproto":   regexp.MustCompile(`^(tcp|udp)6?$`),
+		"sec":          regexp.MustCompile(`^(sys|none|krb5|krb5i|krb5p)(:(sys|none|krb5|krb5i|krb5p))*$`),
+		"lookupcache":  regexp.MustCompile(`^(all|none|pos|positive)$`),
+		"local_lock":   regexp.MustCompile(`^(none|all|flock|posix)$`),
+		"xprtsec":      regexp.MustCompile(`^(none|tls|mtls)$`),
+		"clientaddr":   reNotEmpty,
+		"mounthost":    reNotEmpty,
+		"fsc":          reNotEmpty,
+		"context":      reNotEmpty,
+		"fscontext":    reNotEmpty,
+		"defcontext":   reNotEmpty,
+		"rootcontext":  reNotEmpty,
+	}
+
+	reUint     = regexp.MustCompile(`^\d+$`)
+	reNotEmpty = regexp.MustCompile(`^.+$`)
+)
+
+// The NFS mount options which override each other
+var nfsOptionGroups = map[string]string{
+	"nfsvers": "vers",
+	"soft":    "hard",
+	"softerr": "hard",
+	"ro":      "rw",
+	"async":   "sync",
+	"fg":      "bg",
+	"udp":     "proto",
+	"tcp":     "proto",
+	"rdma":    "proto",
+}
+
+// ValidateNFSMountOption returns an error if the option is not a valid NFS mount option.
+func ValidateNFSMountOption(option string) error {
+	name, value, hasValue := strings.Cut(option, "=")
+
+	if !hasValue {
+		if nfsFlagOptions[name] || nfsFlagOptions[strings.TrimPrefix(name, "no")] {
+			return nil
+		}
+
+		if _, ok := nfsValueOptions[name]; ok {
+			return fmt.Errorf("NFS mount option %s requires a value", name)
+		}
+
+		return fmt.Errorf("unknown NFS mount option %s", name)
+	}
+
+	re, ok := nfsValueOptions[name]
+	if !ok {
+		return fmt.Errorf("unknown NFS mount option %s", name)
+	}
+
+	if !re.MatchString(value) {
+		return fmt.Errorf("invalid value %q of NFS mount option %s", value, name)
+	}
+
+	// The Linux NFS client opens at most 16 connections to a server
+	if n, _ := strconv.Atoi(value); name == "nconnect" && (n < 1 || n > 16) {
+		return fmt.Errorf("invalid value %q of NFS mount option nconnect, expected 1 to 16", value)
+	}
+
+	return nil
+}
+
+// ValidateNFSMountOptions returns an error if one of the comma-separated options is not
+// a valid NFS mount option.
+func ValidateNFSMountOptions(mountOptions string) error {
+	for _, o := range splitMountOptions(mountOptions) {
+		if err := ValidateNFSMountOption(o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// splitMountOptions splits the comma-separated mount options, except for the
+// commas in double quotes, e.g. in context="system_u:object_r:nfs_t:s0:c0,c1".
+func splitMountOptions(mountOptions string) []string {
+	var (
+		opts   []string
+		quoted bool
+		start  int
+	)
+
+	appendOpt := func(o string) {
+		if o = strings.TrimSpace(o); o != "" {
+			opts = append(opts, o)
+		}
+	}
+
+	for i, c := range mountOptions {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			appendOpt(mountOptions[start:i])
+			start = i + 1
+		}
+	}
+	appendOpt(mountOptions[start:])
+
+	return opts
+}
+
+// nfsOptionKey returns the key of the mount option, the same for the options
+// which override each other, e.g. hard and soft, or ac and noac.
+func nfsOptionKey(option string) string {
+	name, _, hasValue := strings.Cut(option, "=")
+	if !hasValue {
+		if trimmed := strings.TrimPrefix(name, "no"); trimmed != name && nfsFlagOptions[trimmed] {
+			name = trimmed
+		}
+	}
+
+	if group, ok := nfsOptionGroups[name]; ok {
+		return group
+	}
+
+	return name
+}
+
+// NFSMountFlags returns the mount flags of the share: the mount flags of the volume
+// capability which are valid NFS mount options, followed by the default options of
+// the nfs-mountOptions parameter which the mount flags don't override. The invalid
+// mount flags are stripped with a warning.
+func NFSMountFlags(opts *options.NodeVolumeContext, mountFlags []string) []string {
+	var flags []string
+	keys := make(map[string]bool)
+
+	for _, f := range mountFlags {
+		for _, o := range splitMountOptions(f) {
+			if err := ValidateNFSMountOption(o); err != nil {
+				klog.Warningf("stripping mount option %s: %v", o, err)
+				continue
+			}
+
+			flags = append(flags, o)
+			keys[nfsOptionKey(o)] = true
+		}
+	}
+
+	for _, o := range splitMountOptions(opts.NFSMountOptions) {
+		if !keys[nfsOptionKey(o)] {
+			flags = append(flags, o)
+		}
+	}
+
+	return flags
+}
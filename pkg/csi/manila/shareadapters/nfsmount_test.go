@@ -0,0 +1,79 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shareadapters
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/options"
+)
+
+func TestValidateNFSMountOptions(t *testing.T) {
+	testCases := []struct {
+		mountOptions string
+		valid        bool
+	}{
+		{mountOptions: "", valid: true},
+		{mountOptions: "vers=4.1,nconnect=4,timeo=600,hard", valid: true},
+		{mountOptions: "nfsvers=3, proto=tcp, noac, nolock, noatime", valid: true},
+		{mountOptions: `context="system_u:object_r:nfs_t:s0:c0,c1",ro`, valid: true},
+		{mountOptions: "vers=5"},
+		{mountOptions: "nconnect=0"},
+		{mountOptions: "nconnect=17"},
+		{mountOptions: "timeo=-1"},
+		{mountOptions: "timeo"},
+		{mountOptions: "hard=1"},
+		{mountOptions: "dir_mode=0777"},
+		{mountOptions: "mds_namespace=cephfs"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.mountOptions, func(t *testing.T) {
+			err := ValidateNFSMountOptions(tc.mountOptions)
+			if tc.valid && err != nil {
+				t.Errorf("expected valid mount options, got %v", err)
+			}
+			if !tc.valid && err == nil {
+				t.Error("expected invalid mount options")
+			}
+		})
+	}
+}
+
+func TestNFSMountFlags(t *testing.T) {
+	testCases := []struct {
+		name         string
+		mountOptions string
+		mountFlags   []string
+		expected     []string
+	}{
+		{name: "no options", mountFlags: []string{"hard"}, expected: []string{"hard"}},
+		{name: "defaults", mountOptions: "vers=4.1,nconnect=4,timeo=600", expected: []string{"vers=4.1", "nconnect=4", "timeo=600"}},
+		{name: "defaults overridden by the mount flags", mountOptions: "vers=4.1,nconnect=4,hard,ac", mountFlags: []string{"nfsvers=4.2", "soft,noac"}, expected: []string{"nfsvers=4.2", "soft", "noac", "nconnect=4"}},
+		{name: "incompatible mount flags stripped", mountOptions: "nconnect=4", mountFlags: []string{"dir_mode=0777", "nconnect=32", "noatime"}, expected: []string{"noatime", "nconnect=4"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			flags := NFSMountFlags(&options.NodeVolumeContext{NFSMountOptions: tc.mountOptions}, tc.mountFlags)
+			if !reflect.DeepEqual(flags, tc.expected) {
+				t.Errorf("expected mount flags %v, got %v", tc.expected, flags)
+			}
+		})
+	}
+}
@@ -43,11 +43,14 @@ type VolumeContextArgs struct {
 
 type SecretArgs struct {
 	AccessRight *shares.AccessRight
+
+	// Secrets of the node RPC
+	Secrets map[string]string
 }
 
 type ShareAdapter interface {
 	// GetOrGrantAccesses first tries to retrieve the list of access rights for args.Share.
-	// It iterates over the list of access clients that should have access to the share considering nfs-shareClient or cephfs-clientID.
+	// It iterates over the list of access clients that should have access to the share considering nfs-shareClient, cephfs-clientID or cifs-shareUser.
 	// The access right is created for the share in case it doesn't exist yet.
 	// Returns an existing or new access right for args.Share.
 	GetOrGrantAccesses(ctx context.Context, args *GrantAccessArgs) (accessRights []shares.AccessRight, err error)
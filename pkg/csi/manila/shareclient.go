@@ -0,0 +1,207 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/options"
+	"k8s.io/klog/v2"
+)
+
+// Values of the nfs-shareClientSource volume parameter
+const (
+	// The NFS access rules are granted to the nfs-shareClient CIDRs
+	shareClientSourceShareClient = "shareClient"
+	// The NFS access rules are granted to the Neutron subnets of the node addresses
+	shareClientSourceNodeSubnets = "nodeSubnets"
+	// The NFS access rules are granted to the node addresses
+	shareClientSourceNodeAddresses = "nodeAddresses"
+)
+
+// resolveShareClients replaces the nfs-shareClient CIDRs of shareOpts with the CIDRs derived
+// from the node addresses if nfs-shareClientSource is set to nodeSubnets or nodeAddresses.
+// Only the derived CIDRs within the nfs-shareClient CIDRs are kept. Both parameters are recorded
+// in shareMetadata so that the access rules may be repaired when the nodes change.
+func (cs *controllerServer) resolveShareClients(ctx context.Context, manilaClient manilaclient.Interface, shareOpts *options.ControllerVolumeContext, shareMetadata map[string]string) error {
+	if shareOpts.NFSShareClientSource == shareClientSourceShareClient || !strings.EqualFold(shareOpts.Protocol, "NFS") {
+		return nil
+	}
+
+	if cs.d.nodeLister == nil {
+		return status.Errorf(codes.FailedPrecondition, "nfs-shareClientSource %s requires a node lister", shareOpts.NFSShareClientSource)
+	}
+
+	nodes, err := cs.d.nodeLister.List(labels.Everything())
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to list nodes: %v", err)
+	}
+
+	allowed, err := parseCIDRs(shareOpts.NFSShareClient)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid nfs-shareClient: %v", err)
+	}
+
+	var subnetCIDRs []string
+	if shareOpts.NFSShareClientSource == shareClientSourceNodeSubnets {
+		if subnetCIDRs, err = manilaClient.GetSubnetCIDRs(ctx); err != nil {
+			return status.Errorf(codes.Internal, "failed to list subnets: %v", err)
+		}
+	}
+
+	clients, err := nodeShareClients(nodeAddresses(nodes), subnetCIDRs, allowed)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to parse subnets: %v", err)
+	}
+
+	if len(clients) == 0 {
+		return status.Errorf(codes.FailedPrecondition, "no node address within nfs-shareClient %s to grant access to with nfs-shareClientSource %s",
+			shareOpts.NFSShareClient, shareOpts.NFSShareClientSource)
+	}
+
+	klog.V(4).Infof("granting NFS access to %v with nfs-shareClientSource %s", clients, shareOpts.NFSShareClientSource)
+
+	shareMetadata[shareClientSourceMetadataKey] = shareOpts.NFSShareClientSource
+	shareMetadata[shareClientMetadataKey] = shareOpts.NFSShareClient
+
+	shareOpts.NFSShareClient = strings.Join(clients, ",")
+
+	return nil
+}
+
+// nodeAddresses returns the internal IP addresses of the nodes.
+func nodeAddresses(nodes []*corev1.Node) []net.IP {
+	var ips []net.IP
+
+	for _, node := range nodes {
+		for _, addr := range node.Status.Addresses {
+			if addr.Type != corev1.NodeInternalIP {
+				continue
+			}
+
+			if ip := net.ParseIP(addr.Address); ip != nil {
+				ips = append(ips, ip)
+			} else {
+				klog.Warningf("ignoring invalid internal IP address %q of node %s", addr.Address, node.Name)
+			}
+		}
+	}
+
+	return ips
+}
+
+// nodeShareClients returns the sorted CIDRs of the smallest subnets of subnetCIDRs containing
+// the node addresses, or of the node addresses themselves if subnetCIDRs is nil. Only the CIDRs
+// within one of the allowed networks are returned.
+func nodeShareClients(ips []net.IP, subnetCIDRs []string, allowed []*net.IPNet) ([]string, error) {
+	subnets, err := parseCIDRs(strings.Join(subnetCIDRs, ","))
+	if err != nil {
+		return nil, err
+	}
+
+	var clients []string
+
+	for _, ip := range ips {
+		var client *net.IPNet
+
+		if subnetCIDRs == nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			client = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		} else {
+			for _, subnet := range subnets {
+				if !subnet.Contains(ip) {
+					continue
+				}
+
+				if client == nil || prefixLength(subnet) > prefixLength(client) {
+					client = subnet
+				}
+			}
+
+			if client == nil {
+				klog.V(4).Infof("no subnet contains node address %s", ip)
+				continue
+			}
+		}
+
+		if !slices.ContainsFunc(allowed, func(n *net.IPNet) bool { return containsNetwork(n, client) }) {
+			klog.V(4).Infof("ignoring %s, not within the nfs-shareClient networks", client)
+			continue
+		}
+
+		if c := client.String(); !slices.Contains(clients, c) {
+			clients = append(clients, c)
+		}
+	}
+
+	slices.Sort(clients)
+
+	return clients, nil
+}
+
+// parseCIDRs parses a comma-separated list of CIDRs. An IP address is parsed as a single
+// address network.
+func parseCIDRs(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+func prefixLength(n *net.IPNet) int {
+	ones, _ := n.Mask.Size()
+	return ones
+}
+
+// containsNetwork returns true if the network n contains the network sub.
+func containsNetwork(n, sub *net.IPNet) bool {
+	_, nBits := n.Mask.Size()
+	_, subBits := sub.Mask.Size()
+
+	return nBits == subBits && n.Contains(sub.IP) && prefixLength(n) <= prefixLength(sub)
+}
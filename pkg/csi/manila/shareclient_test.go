@@ -0,0 +1,128 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newNode(name string, addrs ...corev1.NodeAddress) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status:     corev1.NodeStatus{Addresses: addrs},
+	}
+}
+
+func TestNodeAddresses(t *testing.T) {
+	nodes := []*corev1.Node{
+		newNode("node-1",
+			corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.10"},
+			corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: "203.0.113.10"},
+			corev1.NodeAddress{Type: corev1.NodeHostName, Address: "node-1"},
+		),
+		newNode("node-2",
+			corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.1.20"},
+			corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "fd00::20"},
+		),
+		newNode("node-3", corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "invalid"}),
+	}
+
+	ips := nodeAddresses(nodes)
+
+	expected := []string{"10.0.0.10", "10.0.1.20", "fd00::20"}
+	if len(ips) != len(expected) {
+		t.Fatalf("expected addresses %v, got %v", expected, ips)
+	}
+
+	for i := range ips {
+		if ips[i].String() != expected[i] {
+			t.Errorf("expected address %s, got %s", expected[i], ips[i])
+		}
+	}
+}
+
+func TestNodeShareClients(t *testing.T) {
+	var ips []net.IP
+	for _, s := range []string{"10.0.0.10", "10.0.0.11", "10.0.1.20", "192.168.0.5", "fd00::20"} {
+		ips = append(ips, net.ParseIP(s))
+	}
+
+	subnetCIDRs := []string{"10.0.0.0/16", "10.0.0.0/24", "10.0.1.0/24", "fd00::/64"}
+
+	ts := []struct {
+		name        string
+		subnetCIDRs []string
+		allowed     string
+		expected    []string
+	}{
+		{
+			name:     "node addresses",
+			allowed:  "0.0.0.0/0",
+			expected: []string{"10.0.0.10/32", "10.0.0.11/32", "10.0.1.20/32", "192.168.0.5/32"},
+		},
+		{
+			name:     "node addresses within the allowed networks",
+			allowed:  "10.0.0.0/24,fd00::/48",
+			expected: []string{"10.0.0.10/32", "10.0.0.11/32", "fd00::20/128"},
+		},
+		{
+			name:        "smallest node subnets",
+			subnetCIDRs: subnetCIDRs,
+			allowed:     "0.0.0.0/0,::/0",
+			expected:    []string{"10.0.0.0/24", "10.0.1.0/24", "fd00::/64"},
+		},
+		{
+			name:        "node subnets within the allowed networks",
+			subnetCIDRs: subnetCIDRs,
+			allowed:     "10.0.1.0/24",
+			expected:    []string{"10.0.1.0/24"},
+		},
+		{
+			name:        "node subnets larger than the allowed networks",
+			subnetCIDRs: subnetCIDRs,
+			allowed:     "10.0.0.10",
+		},
+		{
+			name:        "no subnets",
+			subnetCIDRs: []string{},
+			allowed:     "0.0.0.0/0",
+		},
+	}
+
+	for _, tt := range ts {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, err := parseCIDRs(tt.allowed)
+			if err != nil {
+				t.Fatalf("failed to parse %s: %v", tt.allowed, err)
+			}
+
+			clients, err := nodeShareClients(ips, tt.subnetCIDRs, allowed)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(clients, tt.expected) {
+				t.Errorf("expected share clients %v, got %v", tt.expected, clients)
+			}
+		})
+	}
+}
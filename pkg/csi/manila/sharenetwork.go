@@ -0,0 +1,98 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"context"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/sharenetworks"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/options"
+	clouderrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
+	"k8s.io/klog/v2"
+)
+
+// resolveShareNetwork validates the share network given by the shareNetworkID, shareNetworkName
+// or shareNetworkTag volume parameters, and sets shareOpts.ShareNetworkID to its ID.
+// The share network given by a tag is the one whose Neutron network has the tag.
+func resolveShareNetwork(ctx context.Context, manilaClient manilaclient.Interface, shareOpts *options.ControllerVolumeContext) error {
+	switch {
+	case shareOpts.ShareNetworkID != "":
+		if _, err := manilaClient.GetShareNetworkByID(ctx, shareOpts.ShareNetworkID); err != nil {
+			if clouderrors.IsNotFound(err) {
+				return status.Errorf(codes.InvalidArgument, "share network %s not found", shareOpts.ShareNetworkID)
+			}
+
+			return status.Errorf(codes.Internal, "failed to retrieve share network %s: %v", shareOpts.ShareNetworkID, err)
+		}
+
+		return nil
+	case shareOpts.ShareNetworkName != "":
+		shareNetworks, err := manilaClient.GetShareNetworks(ctx, sharenetworks.ListOpts{Name: shareOpts.ShareNetworkName})
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to list share networks named %s: %v", shareOpts.ShareNetworkName, err)
+		}
+
+		id, err := singleShareNetwork(shareNetworks, "named "+shareOpts.ShareNetworkName)
+		if err != nil {
+			return err
+		}
+
+		shareOpts.ShareNetworkID = id
+	case shareOpts.ShareNetworkTag != "":
+		networkIDs, err := manilaClient.GetNetworkIDsByTag(ctx, shareOpts.ShareNetworkTag)
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to list networks tagged %s: %v", shareOpts.ShareNetworkTag, err)
+		}
+
+		var shareNetworks []sharenetworks.ShareNetwork
+		for _, networkID := range networkIDs {
+			sns, err := manilaClient.GetShareNetworks(ctx, sharenetworks.ListOpts{NeutronNetID: networkID})
+			if err != nil {
+				return status.Errorf(codes.Internal, "failed to list share networks of network %s: %v", networkID, err)
+			}
+
+			shareNetworks = append(shareNetworks, sns...)
+		}
+
+		id, err := singleShareNetwork(shareNetworks, "with a network tagged "+shareOpts.ShareNetworkTag)
+		if err != nil {
+			return err
+		}
+
+		shareOpts.ShareNetworkID = id
+	default:
+		return nil
+	}
+
+	klog.V(4).Infof("resolved share network %s", shareOpts.ShareNetworkID)
+
+	return nil
+}
+
+func singleShareNetwork(shareNetworks []sharenetworks.ShareNetwork, desc string) (string, error) {
+	switch len(shareNetworks) {
+	case 0:
+		return "", status.Errorf(codes.InvalidArgument, "no share network %s found", desc)
+	case 1:
+		return shareNetworks[0].ID, nil
+	default:
+		return "", status.Errorf(codes.InvalidArgument, "found %d share networks %s, expected exactly one", len(shareNetworks), desc)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/sharenetworks"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/options"
+)
+
+// fakeShareNetworkClient serves share networks and the tags of their Neutron networks.
+// The calls it doesn't implement panic.
+type fakeShareNetworkClient struct {
+	manilaclient.Interface
+
+	shareNetworks []sharenetworks.ShareNetwork
+	networkTags   map[string][]string
+}
+
+func (c *fakeShareNetworkClient) GetShareNetworkByID(_ context.Context, shareNetworkID string) (*sharenetworks.ShareNetwork, error) {
+	for i := range c.shareNetworks {
+		if c.shareNetworks[i].ID == shareNetworkID {
+			return &c.shareNetworks[i], nil
+		}
+	}
+
+	return nil, gophercloud.ErrResourceNotFound{}
+}
+
+func (c *fakeShareNetworkClient) GetShareNetworks(_ context.Context, opts sharenetworks.ListOptsBuilder) ([]sharenetworks.ShareNetwork, error) {
+	o := opts.(sharenetworks.ListOpts)
+
+	var res []sharenetworks.ShareNetwork
+	for _, sn := range c.shareNetworks {
+		if (o.Name == "" || sn.Name == o.Name) && (o.NeutronNetID == "" || sn.NeutronNetID == o.NeutronNetID) {
+			res = append(res, sn)
+		}
+	}
+
+	return res, nil
+}
+
+func (c *fakeShareNetworkClient) GetNetworkIDsByTag(_ context.Context, tag string) ([]string, error) {
+	var ids []string
+	for id, tags := range c.networkTags {
+		for _, t := range tags {
+			if t == tag {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	return ids, nil
+}
+
+func TestResolveShareNetwork(t *testing.T) {
+	c := &fakeShareNetworkClient{
+		shareNetworks: []sharenetworks.ShareNetwork{
+			{ID: "sn-1", Name: "tenant-a", NeutronNetID: "net-1"},
+			{ID: "sn-2", Name: "tenant-b", NeutronNetID: "net-2"},
+			{ID: "sn-3", Name: "tenant-b", NeutronNetID: "net-3"},
+		},
+		networkTags: map[string][]string{
+			"net-1": {"storage-a"},
+			"net-2": {"storage-b"},
+			"net-3": {"storage-b"},
+		},
+	}
+
+	ts := []struct {
+		name         string
+		opts         options.ControllerVolumeContext
+		expectedID   string
+		expectedCode codes.Code
+	}{
+		{name: "none", opts: options.ControllerVolumeContext{}},
+		{name: "by ID", opts: options.ControllerVolumeContext{ShareNetworkID: "sn-1"}, expectedID: "sn-1"},
+		{name: "unknown ID", opts: options.ControllerVolumeContext{ShareNetworkID: "sn-4"}, expectedCode: codes.InvalidArgument},
+		{name: "by name", opts: options.ControllerVolumeContext{ShareNetworkName: "tenant-a"}, expectedID: "sn-1"},
+		{name: "unknown name", opts: options.ControllerVolumeContext{ShareNetworkName: "tenant-c"}, expectedCode: codes.InvalidArgument},
+		{name: "ambiguous name", opts: options.ControllerVolumeContext{ShareNetworkName: "tenant-b"}, expectedCode: codes.InvalidArgument},
+		{name: "by tag", opts: options.ControllerVolumeContext{ShareNetworkTag: "storage-a"}, expectedID: "sn-1"},
+		{name: "unknown tag", opts: options.ControllerVolumeContext{ShareNetworkTag: "storage-c"}, expectedCode: codes.InvalidArgument},
+		{name: "ambiguous tag", opts: options.ControllerVolumeContext{ShareNetworkTag: "storage-b"}, expectedCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range ts {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+
+			err := resolveShareNetwork(context.Background(), c, &opts)
+			if code := status.Code(err); code != tt.expectedCode {
+				t.Fatalf("expected error code %s, got %v", tt.expectedCode, err)
+			}
+
+			if err == nil && opts.ShareNetworkID != tt.expectedID {
+				t.Errorf("expected share network %q, got %q", tt.expectedID, opts.ShareNetworkID)
+			}
+		})
+	}
+}
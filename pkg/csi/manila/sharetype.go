@@ -0,0 +1,98 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/sharetypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
+	"k8s.io/klog/v2"
+)
+
+// Share type extra specs advertising the snapshot capabilities of its shares
+const (
+	extraSpecSnapshotSupport                = "snapshot_support"
+	extraSpecCreateShareFromSnapshotSupport = "create_share_from_snapshot_support"
+)
+
+// getShareTypeExtraSpecs returns the extra specs of the share type, given by its name or ID.
+func getShareTypeExtraSpecs(ctx context.Context, manilaClient manilaclient.Interface, shareType string) (sharetypes.ExtraSpecs, error) {
+	shareTypes, err := manilaClient.GetShareTypes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list share types: %v", err)
+	}
+
+	for _, t := range shareTypes {
+		if t.ID == shareType || t.Name == shareType {
+			return t.ExtraSpecs, nil
+		}
+	}
+
+	return nil, fmt.Errorf("share type %s not found", shareType)
+}
+
+// isExtraSpecEnabled returns true if the boolean extra spec is set to true,
+// either as "True" or as "<is> True".
+func isExtraSpecEnabled(extraSpecs sharetypes.ExtraSpecs, key string) bool {
+	v, ok := extraSpecs[key].(string)
+	if !ok {
+		return false
+	}
+
+	enabled, err := strconv.ParseBool(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(v), "<is>")))
+	return err == nil && enabled
+}
+
+// verifyShareTypeSupportsRestore checks that the shares of the share type can be created from snapshots.
+// The check is skipped if the share type can't be retrieved, e.g. because of the Manila policy, and Manila
+// refuses the share then.
+func verifyShareTypeSupportsRestore(ctx context.Context, manilaClient manilaclient.Interface, shareType string) error {
+	extraSpecs, err := getShareTypeExtraSpecs(ctx, manilaClient, shareType)
+	if err != nil {
+		klog.Warningf("failed to retrieve extra specs of share type %s, not checking its snapshot capabilities: %v", shareType, err)
+		return nil
+	}
+
+	if !isExtraSpecEnabled(extraSpecs, extraSpecCreateShareFromSnapshotSupport) {
+		return status.Errorf(codes.InvalidArgument, "share type %s does not support creating shares from snapshots: %s extra spec is not enabled",
+			shareType, extraSpecCreateShareFromSnapshotSupport)
+	}
+
+	return nil
+}
+
+// missingSnapshotCapabilities returns the snapshot capabilities the share doesn't advertise,
+// which are both required by CREATE_DELETE_SNAPSHOT.
+func missingSnapshotCapabilities(snapshotSupport, createShareFromSnapshotSupport bool) []string {
+	var missing []string
+
+	if !snapshotSupport {
+		missing = append(missing, extraSpecSnapshotSupport)
+	}
+
+	if !createShareFromSnapshotSupport {
+		missing = append(missing, extraSpecCreateShareFromSnapshotSupport)
+	}
+
+	return missing
+}
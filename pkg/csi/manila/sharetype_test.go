@@ -0,0 +1,91 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/sharetypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsExtraSpecEnabled(t *testing.T) {
+	ts := []struct {
+		value    interface{}
+		expected bool
+	}{
+		{value: "True", expected: true},
+		{value: "true", expected: true},
+		{value: "<is> True", expected: true},
+		{value: "False", expected: false},
+		{value: "<is> False", expected: false},
+		{value: "invalid", expected: false},
+		{value: nil, expected: false},
+	}
+
+	for _, tt := range ts {
+		extraSpecs := sharetypes.ExtraSpecs{}
+		if tt.value != nil {
+			extraSpecs[extraSpecSnapshotSupport] = tt.value
+		}
+
+		if enabled := isExtraSpecEnabled(extraSpecs, extraSpecSnapshotSupport); enabled != tt.expected {
+			t.Errorf("extra spec value %v: expected %t, got %t", tt.value, tt.expected, enabled)
+		}
+	}
+}
+
+func TestVerifyShareTypeSupportsRestore(t *testing.T) {
+	shareTypes := []sharetypes.ShareType{
+		{
+			ID:         "1",
+			Name:       "gold",
+			ExtraSpecs: map[string]interface{}{extraSpecSnapshotSupport: "True", extraSpecCreateShareFromSnapshotSupport: "<is> True"},
+		},
+		{
+			ID:         "2",
+			Name:       "silver",
+			ExtraSpecs: map[string]interface{}{extraSpecSnapshotSupport: "True"},
+		},
+	}
+
+	ts := []struct {
+		name         string
+		shareType    string
+		shareTypes   []sharetypes.ShareType
+		expectedCode codes.Code
+	}{
+		{name: "supported by name", shareType: "gold", shareTypes: shareTypes},
+		{name: "supported by ID", shareType: "1", shareTypes: shareTypes},
+		{name: "not supported", shareType: "silver", shareTypes: shareTypes, expectedCode: codes.InvalidArgument},
+		{name: "share type not found", shareType: "bronze", shareTypes: shareTypes},
+		{name: "share types not listed", shareType: "gold"},
+	}
+
+	for _, tt := range ts {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &fakeShareClient{shareTypes: tt.shareTypes}
+
+			err := verifyShareTypeSupportsRestore(context.Background(), c, tt.shareType)
+			if code := status.Code(err); code != tt.expectedCode {
+				t.Errorf("expected error code %s, got %v", tt.expectedCode, err)
+			}
+		})
+	}
+}
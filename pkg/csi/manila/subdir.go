@@ -0,0 +1,314 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shares"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/options"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/shareadapters"
+	"k8s.io/cloud-provider-openstack/pkg/util"
+	clouderrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// The volume ID of a subdirectory volume is the ID of its parent share and the name of
+	// the subdirectory, separated by subdirVolumeIDSeparator
+	subdirVolumeIDSeparator = "/"
+
+	// The parent share metadata keys prefixed with subdirMetadataKeyPrefix hold the sizes in GiB
+	// allotted to its subdirectories
+	subdirMetadataKeyPrefix = "manila.csi.openstack.org/subdir-"
+)
+
+func newSubdirVolumeID(shareID, subdir string) string {
+	return shareID + subdirVolumeIDSeparator + subdir
+}
+
+// parseSubdirVolumeID returns the parent share ID and the subdirectory of a subdirectory volume,
+// or false if the volume is a share.
+func parseSubdirVolumeID(volID string) (shareID, subdir string, ok bool) {
+	shareID, subdir, ok = strings.Cut(volID, subdirVolumeIDSeparator)
+	if !ok || shareID == "" || subdir == "" {
+		return "", "", false
+	}
+
+	return shareID, subdir, true
+}
+
+// subdirSizes returns the sizes in GiB allotted to the subdirectories of the parent share,
+// and their sum.
+func subdirSizes(share *shares.Share) (map[string]int, int) {
+	sizes := make(map[string]int)
+	var total int
+
+	for k, v := range share.Metadata {
+		subdir, ok := strings.CutPrefix(k, subdirMetadataKeyPrefix)
+		if !ok {
+			continue
+		}
+
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			klog.Warningf("ignoring invalid size %q of subdirectory %s of share %s", v, subdir, share.ID)
+			continue
+		}
+
+		sizes[subdir] = size
+		total += size
+	}
+
+	return sizes, total
+}
+
+// getParentShare retrieves the parent share of subdirectory volumes, which must be available.
+func getParentShare(ctx context.Context, manilaClient manilaclient.Interface, shareID, shareProto string) (*shares.Share, error) {
+	share, err := manilaClient.GetShareByID(ctx, shareID)
+	if err != nil {
+		if clouderrors.IsNotFound(err) {
+			return nil, status.Errorf(codes.NotFound, "parent share %s not found: %v", shareID, err)
+		}
+
+		return nil, status.Errorf(codes.Internal, "failed to retrieve parent share %s: %v", shareID, err)
+	}
+
+	if !strings.EqualFold(share.ShareProto, shareProto) {
+		return nil, status.Errorf(codes.InvalidArgument, "wrong share protocol %s for parent share %s, the plugin is set to operate in %s", share.ShareProto, shareID, shareProto)
+	}
+
+	if share.Status != shareAvailable {
+		return nil, status.Errorf(codes.FailedPrecondition, "invalid status of parent share %s: expected 'available', got '%s'", shareID, share.Status)
+	}
+
+	return share, nil
+}
+
+// checkSubdirSize returns a ResourceExhausted error if the subdirectories of the parent share
+// would be allotted more than the size of the share.
+func checkSubdirSize(share *shares.Share, subdir string, sizeInGiB int) error {
+	sizes, total := subdirSizes(share)
+	if left := share.Size - total + sizes[subdir]; sizeInGiB > left {
+		return status.Errorf(codes.ResourceExhausted, "parent share %s of %d GiB has %d GiB left for subdirectories, %d GiB requested", share.ID, share.Size, left, sizeInGiB)
+	}
+
+	return nil
+}
+
+// allotSubdirSize records the size of the subdirectory in the metadata of the parent share.
+func allotSubdirSize(ctx context.Context, manilaClient manilaclient.Interface, share *shares.Share, subdir string, sizeInGiB int) error {
+	if share.Metadata[subdirMetadataKeyPrefix+subdir] == strconv.Itoa(sizeInGiB) {
+		return nil
+	}
+
+	_, err := manilaClient.SetShareMetadata(ctx, share.ID, shares.SetMetadataOpts{
+		Metadata: map[string]string{subdirMetadataKeyPrefix + subdir: strconv.Itoa(sizeInGiB)},
+	})
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to update metadata of parent share %s: %v", share.ID, err)
+	}
+
+	return nil
+}
+
+// subdirFwdVolumeID returns the ID the fwd plugin knows the subdirectory by, in the
+// server#share#subdir format of CSI NFS.
+func subdirFwdVolumeID(ctx context.Context, manilaClient manilaclient.Interface, share *shares.Share, subdir string) (string, map[string]string, error) {
+	locations, err := manilaClient.GetExportLocations(ctx, share.ID)
+	if err != nil {
+		return "", nil, status.Errorf(codes.Internal, "failed to list export locations for parent share %s: %v", share.ID, err)
+	}
+
+	volCtx, err := shareadapters.NFS{}.BuildVolumeContext(&shareadapters.VolumeContextArgs{Locations: locations, Share: share})
+	if err != nil {
+		return "", nil, status.Errorf(codes.Internal, "failed to choose an export location for parent share %s: %v", share.ID, err)
+	}
+
+	return strings.Join([]string{volCtx["server"], volCtx["share"], subdir}, "#"), volCtx, nil
+}
+
+// createSubdirVolume provisions the volume as a subdirectory of the parent share of the
+// parentShareID parameter. The subdirectory is created by the controller service of the
+// fwd plugin.
+func (cs *controllerServer) createSubdirVolume(ctx context.Context, req *csi.CreateVolumeRequest, manilaClient manilaclient.Interface, shareOpts *options.ControllerVolumeContext, sizeInGiB int) (*csi.CreateVolumeResponse, error) {
+	if !strings.EqualFold(cs.d.shareProto, "NFS") {
+		return nil, status.Errorf(codes.InvalidArgument, "subdirectory volumes are only supported by the NFS share protocol, got %s", cs.d.shareProto)
+	}
+
+	if req.GetVolumeContentSource() != nil {
+		return nil, status.Error(codes.InvalidArgument, "subdirectory volumes cannot be created from a volume content source")
+	}
+
+	subdir := req.GetName()
+
+	// The sizes of the subdirectories of the parent share are updated one at a time
+	if _, isPending := pendingVolumes.LoadOrStore(shareOpts.ParentShareID, true); isPending {
+		return nil, status.Errorf(codes.Aborted, "parent share %s is already being processed", shareOpts.ParentShareID)
+	}
+	defer pendingVolumes.Delete(shareOpts.ParentShareID)
+
+	share, err := getParentShare(ctx, manilaClient, shareOpts.ParentShareID, cs.d.shareProto)
+	if err != nil {
+		return nil, err
+	}
+
+	sizes, _ := subdirSizes(share)
+	if size, ok := sizes[subdir]; ok && size != sizeInGiB {
+		return nil, status.Errorf(codes.AlreadyExists, "volume %s already exists, but is incompatible with the request: size %d GiB != %d GiB", subdir, size, sizeInGiB)
+	}
+
+	if err := checkSubdirSize(share, subdir, sizeInGiB); err != nil {
+		return nil, err
+	}
+
+	accessRights, err := getShareAdapter(shareOpts.Protocol).GetOrGrantAccesses(ctx, &shareadapters.GrantAccessArgs{Share: share, ManilaClient: manilaClient, Options: shareOpts})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to grant access to parent share %s: %v", share.ID, err)
+	}
+
+	_, fwdVolCtx, err := subdirFwdVolumeID(ctx, manilaClient, share, subdir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the subdirectory
+
+	csiConn, err := cs.d.csiClientBuilder.NewConnectionWithContext(ctx, cs.d.fwdEndpoint)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, fmtGrpcConnError(cs.d.fwdEndpoint, err))
+	}
+	defer csiConn.Close()
+
+	_, err = cs.d.csiClientBuilder.NewControllerServiceClient(csiConn).CreateVolume(ctx, &csi.CreateVolumeRequest{
+		Name:               subdir,
+		CapacityRange:      &csi.CapacityRange{RequiredBytes: int64(sizeInGiB) * bytesInGiB},
+		VolumeCapabilities: req.GetVolumeCapabilities(),
+		Parameters: map[string]string{
+			"server": fwdVolCtx["server"],
+			"share":  fwdVolCtx["share"],
+			"subDir": subdir,
+		},
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to create subdirectory %s of parent share %s: %v", subdir, share.ID, err)
+	}
+
+	if err := allotSubdirSize(ctx, manilaClient, share, subdir, sizeInGiB); err != nil {
+		return nil, err
+	}
+
+	var accessRightIDs []string
+	for _, ar := range accessRights {
+		accessRightIDs = append(accessRightIDs, ar.ID)
+	}
+
+	volCtx := filterParametersForVolumeContext(req.GetParameters(), options.NodeVolumeContextFields())
+	volCtx = util.SetMapIfNotEmpty(volCtx, "shareID", share.ID)
+	volCtx = util.SetMapIfNotEmpty(volCtx, "shareAccessIDs", strings.Join(accessRightIDs, ","))
+	volCtx = util.SetMapIfNotEmpty(volCtx, "subdir", subdir)
+
+	var accessibleTopology []*csi.Topology
+	if cs.d.withTopology && req.GetAccessibilityRequirements() != nil {
+		accessibleTopology = req.GetAccessibilityRequirements().GetPreferred()
+	}
+
+	klog.V(4).Infof("created subdirectory %s of %d GiB in parent share %s", subdir, sizeInGiB, share.ID)
+
+	return &csi.CreateVolumeResponse{
+		Volume: &csi.Volume{
+			VolumeId:           newSubdirVolumeID(share.ID, subdir),
+			AccessibleTopology: accessibleTopology,
+			CapacityBytes:      int64(sizeInGiB) * bytesInGiB,
+			VolumeContext:      volCtx,
+		},
+	}, nil
+}
+
+// deleteSubdirVolume deletes the subdirectory with the controller service of the fwd plugin, and
+// releases its size in the metadata of the parent share.
+func (cs *controllerServer) deleteSubdirVolume(ctx context.Context, manilaClient manilaclient.Interface, shareID, subdir string) error {
+	if _, isPending := pendingVolumes.LoadOrStore(shareID, true); isPending {
+		return status.Errorf(codes.Aborted, "parent share %s is already being processed", shareID)
+	}
+	defer pendingVolumes.Delete(shareID)
+
+	share, err := manilaClient.GetShareByID(ctx, shareID)
+	if err != nil {
+		if clouderrors.IsNotFound(err) {
+			// The subdirectory was deleted with its parent share
+			return nil
+		}
+
+		return status.Errorf(codes.Internal, "failed to retrieve parent share %s: %v", shareID, err)
+	}
+
+	fwdVolID, _, err := subdirFwdVolumeID(ctx, manilaClient, share, subdir)
+	if err != nil {
+		return err
+	}
+
+	csiConn, err := cs.d.csiClientBuilder.NewConnectionWithContext(ctx, cs.d.fwdEndpoint)
+	if err != nil {
+		return status.Error(codes.Unavailable, fmtGrpcConnError(cs.d.fwdEndpoint, err))
+	}
+	defer csiConn.Close()
+
+	if _, err := cs.d.csiClientBuilder.NewControllerServiceClient(csiConn).DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: fwdVolID}); err != nil {
+		return status.Errorf(codes.Internal, "failed to delete subdirectory %s of parent share %s: %v", subdir, shareID, err)
+	}
+
+	if _, ok := share.Metadata[subdirMetadataKeyPrefix+subdir]; ok {
+		if err := manilaClient.DeleteShareMetadatum(ctx, shareID, subdirMetadataKeyPrefix+subdir); err != nil && !clouderrors.IsNotFound(err) {
+			return status.Errorf(codes.Internal, "failed to update metadata of parent share %s: %v", shareID, err)
+		}
+	}
+
+	klog.V(4).Infof("deleted subdirectory %s of parent share %s", subdir, shareID)
+
+	return nil
+}
+
+// expandSubdirVolume allots the new size to the subdirectory in the metadata of the parent share.
+func expandSubdirVolume(ctx context.Context, manilaClient manilaclient.Interface, shareID, subdir, shareProto string, sizeInGiB int) error {
+	if _, isPending := pendingVolumes.LoadOrStore(shareID, true); isPending {
+		return status.Errorf(codes.Aborted, "parent share %s is already being processed", shareID)
+	}
+	defer pendingVolumes.Delete(shareID)
+
+	share, err := getParentShare(ctx, manilaClient, shareID, shareProto)
+	if err != nil {
+		return err
+	}
+
+	sizes, _ := subdirSizes(share)
+	if sizes[subdir] >= sizeInGiB {
+		return nil
+	}
+
+	if err := checkSubdirSize(share, subdir, sizeInGiB); err != nil {
+		return err
+	}
+
+	return allotSubdirSize(ctx, manilaClient, share, subdir, sizeInGiB)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shares"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeMetadataClient records the metadata set on the share of fakeShareClient.
+type fakeMetadataClient struct {
+	fakeShareClient
+
+	metadata map[string]string
+}
+
+func (c *fakeMetadataClient) SetShareMetadata(_ context.Context, shareID string, opts shares.SetMetadataOptsBuilder) (map[string]string, error) {
+	c.metadata = opts.(shares.SetMetadataOpts).Metadata
+	return c.metadata, nil
+}
+
+func TestParseSubdirVolumeID(t *testing.T) {
+	ts := []struct {
+		volID          string
+		expectedShare  string
+		expectedSubdir string
+		expectedOK     bool
+	}{
+		{volID: "share-id/pvc-1", expectedShare: "share-id", expectedSubdir: "pvc-1", expectedOK: true},
+		{volID: "share-id"},
+		{volID: "share-id/"},
+		{volID: "/pvc-1"},
+	}
+
+	for _, tt := range ts {
+		shareID, subdir, ok := parseSubdirVolumeID(tt.volID)
+		if shareID != tt.expectedShare || subdir != tt.expectedSubdir || ok != tt.expectedOK {
+			t.Errorf("%q: expected (%q, %q, %t), got (%q, %q, %t)", tt.volID, tt.expectedShare, tt.expectedSubdir, tt.expectedOK, shareID, subdir, ok)
+		}
+	}
+}
+
+func TestExpandSubdirVolume(t *testing.T) {
+	ts := []struct {
+		name             string
+		size             int
+		expectedMetadata map[string]string
+		expectedCode     codes.Code
+	}{
+		{name: "already allotted", size: 2},
+		{name: "expanded", size: 4, expectedMetadata: map[string]string{subdirMetadataKeyPrefix + "pvc-1": "4"}},
+		{name: "parent share exhausted", size: 6, expectedCode: codes.ResourceExhausted},
+	}
+
+	for _, tt := range ts {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &fakeMetadataClient{fakeShareClient: fakeShareClient{share: shares.Share{
+				ID:         "share",
+				Size:       10,
+				ShareProto: "NFS",
+				Status:     shareAvailable,
+				Metadata: map[string]string{
+					subdirMetadataKeyPrefix + "pvc-1": "2",
+					subdirMetadataKeyPrefix + "pvc-2": "5",
+					clusterMetadataKey:                "cluster",
+				},
+			}}}
+
+			err := expandSubdirVolume(context.Background(), c, "share", "pvc-1", "NFS", tt.size)
+			if status.Code(err) != tt.expectedCode {
+				t.Fatalf("expected code %s, got error %v", tt.expectedCode, err)
+			}
+
+			if !reflect.DeepEqual(c.metadata, tt.expectedMetadata) {
+				t.Errorf("expected metadata %v, got %v", tt.expectedMetadata, c.metadata)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"sort"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// parseZoneMap parses the autoTopologyZoneMap volume parameter, a JSON object
+// mapping the compute availability zones to the Manila availability zones.
+func parseZoneMap(data string) (map[string]string, error) {
+	zoneMap, err := parseStringMapFromJSON(data)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to parse autoTopologyZoneMap field: %v", err)
+	}
+
+	for computeAZ, manilaAZ := range zoneMap {
+		if computeAZ == "" || manilaAZ == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid autoTopologyZoneMap field: availability zones cannot be empty")
+		}
+	}
+
+	return zoneMap, nil
+}
+
+// mapTopologyToAvailabilityZone returns the Manila availability zone mapped to the first requested
+// compute availability zone which has one, preferred zones first. The share is accessible from all
+// the compute availability zones which are mapped to the same Manila availability zone.
+func mapTopologyToAvailabilityZone(req *csi.TopologyRequirement, zoneMap map[string]string) (string, []*csi.Topology, error) {
+	var requested []string
+
+	for _, topology := range append(req.GetPreferred(), req.GetRequisite()...) {
+		computeAZ, ok := topology.GetSegments()[topologyKey]
+		if !ok {
+			continue
+		}
+
+		requested = append(requested, computeAZ)
+
+		manilaAZ, ok := zoneMap[computeAZ]
+		if !ok {
+			continue
+		}
+
+		var computeAZs []string
+		for c, m := range zoneMap {
+			if m == manilaAZ {
+				computeAZs = append(computeAZs, c)
+			}
+		}
+		sort.Strings(computeAZs)
+
+		accessibleTopology := make([]*csi.Topology, len(computeAZs))
+		for i, c := range computeAZs {
+			accessibleTopology[i] = &csi.Topology{Segments: map[string]string{topologyKey: c}}
+		}
+
+		return manilaAZ, accessibleTopology, nil
+	}
+
+	return "", nil, status.Errorf(codes.InvalidArgument, "none of the requested availability zones %v is mapped to a Manila availability zone in autoTopologyZoneMap", requested)
+}
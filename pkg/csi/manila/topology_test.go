@@ -0,0 +1,110 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+func zoneTopologies(zones ...string) []*csi.Topology {
+	var ts []*csi.Topology
+	for _, z := range zones {
+		ts = append(ts, &csi.Topology{Segments: map[string]string{topologyKey: z}})
+	}
+	return ts
+}
+
+func TestMapTopologyToAvailabilityZone(t *testing.T) {
+	zoneMap := map[string]string{"nova-1": "zone-a", "nova-2": "zone-a", "nova-3": "zone-b"}
+
+	ts := []struct {
+		name               string
+		req                *csi.TopologyRequirement
+		expectedAZ         string
+		expectedAccessible []string
+		expectedError      bool
+	}{
+		{
+			name:               "preferred zone",
+			req:                &csi.TopologyRequirement{Preferred: zoneTopologies("nova-3", "nova-1")},
+			expectedAZ:         "zone-b",
+			expectedAccessible: []string{"nova-3"},
+		},
+		{
+			name:               "zones sharing a Manila zone",
+			req:                &csi.TopologyRequirement{Preferred: zoneTopologies("nova-2")},
+			expectedAZ:         "zone-a",
+			expectedAccessible: []string{"nova-1", "nova-2"},
+		},
+		{
+			name:               "unmapped preferred zone",
+			req:                &csi.TopologyRequirement{Preferred: zoneTopologies("nova-4"), Requisite: zoneTopologies("nova-4", "nova-1")},
+			expectedAZ:         "zone-a",
+			expectedAccessible: []string{"nova-1", "nova-2"},
+		},
+		{
+			name:          "no mapped zone",
+			req:           &csi.TopologyRequirement{Preferred: zoneTopologies("nova-4")},
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range ts {
+		t.Run(tt.name, func(t *testing.T) {
+			az, accessible, err := mapTopologyToAvailabilityZone(tt.req, zoneMap)
+			if tt.expectedError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if az != tt.expectedAZ {
+				t.Errorf("expected availability zone %s, got %s", tt.expectedAZ, az)
+			}
+
+			if expected := zoneTopologies(tt.expectedAccessible...); !reflect.DeepEqual(accessible, expected) {
+				t.Errorf("expected accessible topology %v, got %v", expected, accessible)
+			}
+		})
+	}
+}
+
+func TestParseZoneMap(t *testing.T) {
+	if _, err := parseZoneMap(`{"nova-1": "zone-a"}`); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if m, err := parseZoneMap(""); err != nil || m != nil {
+		t.Errorf("expected no zone map, got %v, %v", m, err)
+	}
+
+	if _, err := parseZoneMap(`{"nova-1": ""}`); err == nil {
+		t.Error("expected an error for an empty availability zone")
+	}
+
+	if _, err := parseZoneMap(`["nova-1"]`); err == nil {
+		t.Error("expected an error for an invalid JSON object")
+	}
+}
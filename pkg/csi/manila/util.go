@@ -27,6 +27,9 @@ import (
 	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shares"
 	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/snapshots"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
 	"k8s.io/cloud-provider-openstack/pkg/csi/manila/options"
 	"k8s.io/klog/v2"
@@ -150,6 +153,32 @@ func lastResourceError(ctx context.Context, manilaClient manilaclient.Interface,
 	return manilaErrorMessage{message: "unknown error"}, nil
 }
 
+// newManilaClientFromSecret builds a Manila client with the OpenStack credentials of the secret
+// namespace/name, for the calls which aren't given any secrets.
+func newManilaClientFromSecret(ctx context.Context, kubeClient kubernetes.Interface, builder manilaclient.Builder, namespace, name string) (manilaclient.Interface, error) {
+	secret, err := kubeClient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to retrieve secret %s/%s: %v", namespace, name, err)
+	}
+
+	secrets := make(map[string]string, len(secret.Data))
+	for k, v := range secret.Data {
+		secrets[k] = string(v)
+	}
+
+	osOpts, err := options.NewOpenstackOptions(secrets)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid OpenStack secrets in secret %s/%s: %v", namespace, name, err)
+	}
+
+	manilaClient, err := builder.New(ctx, osOpts)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "failed to create Manila v2 client: %v", err)
+	}
+
+	return manilaClient, nil
+}
+
 func compareProtocol(protoA, protoB string) bool {
 	return strings.EqualFold(protoA, protoB)
 }
@@ -225,6 +254,50 @@ func validateDeleteSnapshotRequest(req *csi.DeleteSnapshotRequest) error {
 	return nil
 }
 
+func validateCreateVolumeGroupSnapshotRequest(req *csi.CreateVolumeGroupSnapshotRequest) error {
+	if req.GetName() == "" {
+		return errors.New("group snapshot name cannot be empty")
+	}
+
+	if len(req.GetSourceVolumeIds()) == 0 {
+		return errors.New("source volume IDs cannot be empty")
+	}
+
+	if req.GetSecrets() == nil || len(req.GetSecrets()) == 0 {
+		return errors.New("secrets cannot be nil or empty")
+	}
+
+	if req.GetParameters() != nil {
+		klog.Info("parameters in CreateVolumeGroupSnapshot requests are ignored")
+	}
+
+	return nil
+}
+
+func validateDeleteVolumeGroupSnapshotRequest(req *csi.DeleteVolumeGroupSnapshotRequest) error {
+	if req.GetGroupSnapshotId() == "" {
+		return errors.New("group snapshot ID cannot be empty")
+	}
+
+	if req.GetSecrets() == nil || len(req.GetSecrets()) == 0 {
+		return errors.New("secrets cannot be nil or empty")
+	}
+
+	return nil
+}
+
+func validateGetVolumeGroupSnapshotRequest(req *csi.GetVolumeGroupSnapshotRequest) error {
+	if req.GetGroupSnapshotId() == "" {
+		return errors.New("group snapshot ID cannot be empty")
+	}
+
+	if req.GetSecrets() == nil || len(req.GetSecrets()) == 0 {
+		return errors.New("secrets cannot be nil or empty")
+	}
+
+	return nil
+}
+
 func coalesceValue(v string) string {
 	if v == "" {
 		return "<none>"
@@ -305,6 +378,28 @@ func validateControllerExpandVolumeRequest(req *csi.ControllerExpandVolumeReques
 	return nil
 }
 
+func validateControllerModifyVolumeRequest(req *csi.ControllerModifyVolumeRequest) error {
+	if req.GetVolumeId() == "" {
+		return errors.New("volume ID missing in request")
+	}
+
+	for k, v := range req.GetMutableParameters() {
+		if k != activeReplicaAvailabilityZoneKey {
+			return fmt.Errorf("unsupported mutable parameter %s", k)
+		}
+
+		if v == "" {
+			return fmt.Errorf("mutable parameter %s cannot be empty", k)
+		}
+	}
+
+	if len(req.GetMutableParameters()) > 0 && len(req.GetSecrets()) == 0 {
+		return errors.New("volume modify secrets cannot be nil or empty")
+	}
+
+	return nil
+}
+
 //
 // Node service request validation
 //
@@ -18,6 +18,7 @@ package manila
 
 import (
 	"context"
+	"strings"
 
 	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shares"
 	"google.golang.org/grpc/codes"
@@ -26,8 +27,12 @@ import (
 	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
 	"k8s.io/cloud-provider-openstack/pkg/csi/manila/options"
 	clouderrors "k8s.io/cloud-provider-openstack/pkg/util/errors"
+	"k8s.io/klog/v2"
 )
 
+// schedulerHintsMicroversion is the microversion from which the shares are created with scheduler hints
+const schedulerHintsMicroversion = "2.65"
+
 type volumeCreator interface {
 	create(ctx context.Context, manilaClient manilaclient.Interface, shareName string, sizeInGiB int, shareOpts *options.ControllerVolumeContext, shareMetadata map[string]string) (*shares.Share, error)
 }
@@ -46,15 +51,18 @@ func create(ctx context.Context, manilaClient manilaclient.Interface, shareName
 		SnapshotID:       snapshotID,
 	}
 
-	// Set scheduler hints if affinity or anti-affinity is set in PVC annotations
+	// Set scheduler hints if affinity or anti-affinity is set in the volume parameters or PVC annotations
 	if shareOpts.Affinity != "" || shareOpts.AntiAffinity != "" {
-		// Set microversion to 2.65 to use scheduler hints
-		v := manilaClient.GetMicroversion()
-		manilaClient.SetMicroversion("2.65")
-		defer manilaClient.SetMicroversion(v)
-		createOpts.SchedulerHints = &shares.SchedulerHints{
-			DifferentHost: shareOpts.AntiAffinity,
-			SameHost:      shareOpts.Affinity,
+		if manilaClient.SupportsMicroversion(schedulerHintsMicroversion) {
+			v := manilaClient.GetMicroversion()
+			manilaClient.SetMicroversion(schedulerHintsMicroversion)
+			defer manilaClient.SetMicroversion(v)
+			createOpts.SchedulerHints = &shares.SchedulerHints{
+				DifferentHost: shareOpts.AntiAffinity,
+				SameHost:      shareOpts.Affinity,
+			}
+		} else {
+			klog.Warningf("ignoring the scheduler hints of volume %s: they require Manila API microversion %s, which the server doesn't support", shareName, schedulerHintsMicroversion)
 		}
 	}
 
@@ -110,5 +118,30 @@ func (v volumeFromSnapshot) create(ctx context.Context, manilaClient manilaclien
 		return nil, status.Errorf(codes.FailedPrecondition, "snapshot %s is in invalid state: expected 'available', got '%s'", snapshot.ID, snapshot.Status)
 	}
 
-	return create(ctx, manilaClient, shareName, sizeInGiB, shareOpts, shareMetadata, snapshot.ID)
+	if snapshot.ShareProto != "" && !compareProtocol(snapshot.ShareProto, shareOpts.Protocol) {
+		return nil, status.Errorf(codes.InvalidArgument, "share protocol mismatch: snapshot %s is of a %s share, but the requested volume is %s", snapshot.ID, snapshot.ShareProto, shareOpts.Protocol)
+	}
+
+	if err := verifyShareTypeSupportsRestore(ctx, manilaClient, shareOpts.Type); err != nil {
+		return nil, err
+	}
+
+	// Some backends can't create shares larger than the snapshot, the share
+	// is restored at the size of the snapshot and extended afterwards
+	createSizeInGiB := sizeInGiB
+	if strings.EqualFold(shareOpts.ExtendAfterRestore, "true") && snapshot.Size < sizeInGiB {
+		createSizeInGiB = snapshot.Size
+	}
+
+	share, err := create(ctx, manilaClient, shareName, createSizeInGiB, shareOpts, shareMetadata, snapshot.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if share.Size < sizeInGiB {
+		klog.V(4).Infof("extending volume %s restored from snapshot %s from %d GiB to the requested %d GiB", shareName, snapshot.ID, share.Size, sizeInGiB)
+		return extendShare(ctx, manilaClient, share, sizeInGiB)
+	}
+
+	return share, nil
 }
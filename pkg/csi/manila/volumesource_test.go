@@ -0,0 +1,124 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manila
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shares"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/sharetypes"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/snapshots"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/manilaclient"
+	"k8s.io/cloud-provider-openstack/pkg/csi/manila/options"
+)
+
+// fakeRestoreClient restores a single snapshot into a share. If ignoreSize is set, the share is
+// created at the size of the snapshot like some backends do. The calls it doesn't implement panic.
+type fakeRestoreClient struct {
+	manilaclient.Interface
+
+	snapshot   snapshots.Snapshot
+	ignoreSize bool
+
+	share       *shares.Share
+	createdSize int
+	extended    bool
+}
+
+func (c *fakeRestoreClient) GetSnapshotByID(_ context.Context, snapshotID string) (*snapshots.Snapshot, error) {
+	s := c.snapshot
+	return &s, nil
+}
+
+func (c *fakeRestoreClient) GetShareTypes(_ context.Context) ([]sharetypes.ShareType, error) {
+	return nil, errors.New("forbidden")
+}
+
+func (c *fakeRestoreClient) GetShareByName(_ context.Context, shareName string) (*shares.Share, error) {
+	return nil, gophercloud.ErrResourceNotFound{}
+}
+
+func (c *fakeRestoreClient) CreateShare(_ context.Context, opts shares.CreateOptsBuilder) (*shares.Share, error) {
+	createOpts := opts.(*shares.CreateOpts)
+	c.createdSize = createOpts.Size
+
+	c.share = &shares.Share{ID: "share", Name: createOpts.Name, Size: createOpts.Size, SnapshotID: createOpts.SnapshotID, Status: shareAvailable}
+	if c.ignoreSize {
+		c.share.Size = c.snapshot.Size
+	}
+
+	s := *c.share
+	return &s, nil
+}
+
+func (c *fakeRestoreClient) GetShareByID(_ context.Context, shareID string) (*shares.Share, error) {
+	s := *c.share
+	return &s, nil
+}
+
+func (c *fakeRestoreClient) ExtendShare(_ context.Context, shareID string, opts shares.ExtendOptsBuilder) error {
+	c.extended = true
+	c.share.Size = opts.(shares.ExtendOpts).NewSize
+	return nil
+}
+
+func TestVolumeFromSnapshotLargerSize(t *testing.T) {
+	ts := []struct {
+		name                string
+		extendAfterRestore  string
+		ignoreSize          bool
+		sizeInGiB           int
+		expectedCreatedSize int
+		expectedExtended    bool
+	}{
+		{name: "same size", extendAfterRestore: "false", sizeInGiB: 1, expectedCreatedSize: 1},
+		{name: "larger size", extendAfterRestore: "false", sizeInGiB: 3, expectedCreatedSize: 3},
+		{name: "larger size ignored by the backend", extendAfterRestore: "false", ignoreSize: true, sizeInGiB: 3, expectedCreatedSize: 3, expectedExtended: true},
+		{name: "extended after restore", extendAfterRestore: "true", sizeInGiB: 3, expectedCreatedSize: 1, expectedExtended: true},
+		{name: "same size not extended after restore", extendAfterRestore: "true", sizeInGiB: 1, expectedCreatedSize: 1},
+	}
+
+	for _, tt := range ts {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &fakeRestoreClient{
+				snapshot:   snapshots.Snapshot{ID: "snapshot", Size: 1, ShareProto: "NFS", Status: snapshotAvailable},
+				ignoreSize: tt.ignoreSize,
+			}
+			shareOpts := &options.ControllerVolumeContext{Protocol: "NFS", Type: "default", ExtendAfterRestore: tt.extendAfterRestore}
+
+			share, err := volumeFromSnapshot{snapshotID: "snapshot"}.create(context.Background(), c, "pvc", tt.sizeInGiB, shareOpts, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if c.createdSize != tt.expectedCreatedSize {
+				t.Errorf("expected the share to be created with %d GiB, got %d GiB", tt.expectedCreatedSize, c.createdSize)
+			}
+
+			if c.extended != tt.expectedExtended {
+				t.Errorf("expected the share to be extended: %t, got %t", tt.expectedExtended, c.extended)
+			}
+
+			if share.Size != tt.sizeInGiB {
+				t.Errorf("expected size %d, got %d", tt.sizeInGiB, share.Size)
+			}
+		})
+	}
+}
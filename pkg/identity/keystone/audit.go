@@ -0,0 +1,201 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystone
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// auditWebhookQueueSize is the number of the audit events waiting to be sent to the audit
+	// webhook. The events are dropped while the queue is full, so that the authorization isn't
+	// slowed down by the webhook.
+	auditWebhookQueueSize = 10000
+	// auditWebhookBatchSize is the maximum number of the audit events sent in a single request
+	auditWebhookBatchSize = 100
+	// auditWebhookTimeout is the timeout of the requests to the audit webhook
+	auditWebhookTimeout = 10 * time.Second
+)
+
+// auditEvent records an authorization decision
+type auditEvent struct {
+	Time        time.Time `json:"time"`
+	User        string    `json:"user"`
+	UID         string    `json:"uid,omitempty"`
+	Groups      []string  `json:"groups,omitempty"`
+	ProjectID   string    `json:"projectID,omitempty"`
+	ProjectName string    `json:"projectName,omitempty"`
+	Verb        string    `json:"verb"`
+	Namespace   string    `json:"namespace,omitempty"`
+	APIGroup    string    `json:"apiGroup,omitempty"`
+	Resource    string    `json:"resource,omitempty"`
+	Subresource string    `json:"subresource,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	Path        string    `json:"path,omitempty"`
+	Decision    string    `json:"decision"`
+	// Policy is the name of the policy rule which allowed or denied the request, see policyRuleName
+	Policy string `json:"policy,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func newAuditEvent(attrs authorizer.Attributes, decision authorizer.Decision, reason, rule string) *auditEvent {
+	e := &auditEvent{
+		Time:        time.Now().UTC(),
+		Verb:        attrs.GetVerb(),
+		Namespace:   attrs.GetNamespace(),
+		APIGroup:    attrs.GetAPIGroup(),
+		Resource:    attrs.GetResource(),
+		Subresource: attrs.GetSubresource(),
+		Name:        attrs.GetName(),
+		Path:        attrs.GetPath(),
+		Decision:    "deny",
+		Policy:      rule,
+		Reason:      reason,
+	}
+	if decision == authorizer.DecisionAllow {
+		e.Decision = "allow"
+	}
+
+	if u := attrs.GetUser(); u != nil {
+		e.User = u.GetName()
+		e.UID = u.GetUID()
+		e.Groups = u.GetGroups()
+		if v := u.GetExtra()[ProjectID]; len(v) > 0 {
+			e.ProjectID = v[0]
+		}
+		if v := u.GetExtra()[ProjectName]; len(v) > 0 {
+			e.ProjectName = v[0]
+		}
+	}
+
+	return e
+}
+
+// auditLogger writes the authorization decisions as JSON lines to a file, and sends them in
+// batches to a webhook.
+type auditLogger struct {
+	mu  sync.Mutex
+	out io.Writer
+
+	webhookURL string
+	client     *http.Client
+	queue      chan *auditEvent
+}
+
+// newAuditLogger returns the audit logger of the config, or nil if auditing is disabled. The path
+// "-" means the standard output.
+func newAuditLogger(c *Config) (*auditLogger, error) {
+	if c.AuditLogPath == "" && c.AuditWebhookURL == "" {
+		return nil, nil
+	}
+
+	l := &auditLogger{}
+
+	switch c.AuditLogPath {
+	case "":
+	case "-":
+		l.out = os.Stdout
+	default:
+		f, err := os.OpenFile(c.AuditLogPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log file %s: %v", c.AuditLogPath, err)
+		}
+		l.out = f
+	}
+
+	if c.AuditWebhookURL != "" {
+		l.webhookURL = c.AuditWebhookURL
+		l.client = &http.Client{Timeout: auditWebhookTimeout}
+		l.queue = make(chan *auditEvent, auditWebhookQueueSize)
+	}
+
+	return l, nil
+}
+
+// log records the audit event. It doesn't wait for the event to be sent to the webhook.
+func (l *auditLogger) log(e *auditEvent) {
+	if l.out != nil {
+		data, err := json.Marshal(e)
+		if err != nil {
+			klog.Errorf("failed to encode audit event: %v", err)
+		} else {
+			l.mu.Lock()
+			_, err = l.out.Write(append(data, '\n'))
+			l.mu.Unlock()
+			if err != nil {
+				klog.Errorf("failed to write audit event: %v", err)
+			}
+		}
+	}
+
+	if l.queue != nil {
+		select {
+		case l.queue <- e:
+		default:
+			klog.Warningf("Audit webhook queue is full, dropping the audit event of user %s", e.User)
+		}
+	}
+}
+
+// runWebhook sends the queued audit events to the webhook until stopCh is closed.
+func (l *auditLogger) runWebhook(stopCh <-chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			return
+		case e := <-l.queue:
+			batch := []*auditEvent{e}
+			for len(batch) < auditWebhookBatchSize && len(l.queue) > 0 {
+				batch = append(batch, <-l.queue)
+			}
+
+			if err := l.sendWebhook(batch); err != nil {
+				klog.Errorf("failed to send %d audit events to the audit webhook: %v", len(batch), err)
+			}
+		}
+	}
+}
+
+// sendWebhook posts the audit events to the webhook as a JSON array.
+func (l *auditLogger) sendWebhook(events []*auditEvent) error {
+	data, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+
+	resp, err := l.client.Post(l.webhookURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystone
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+)
+
+func TestAuditAuthorizationDecisions(t *testing.T) {
+	apiGroup, namespace := "*", "default"
+	out := &bytes.Buffer{}
+	auth := &Auth{
+		authz: &Authorizer{pl: policyList{{
+			ResourceSpec: &resourcePolicySpec{Verbs: []string{"get"}, Resources: []string{"pods"}, APIGroup: &apiGroup, Namespace: &namespace},
+			Match:        []policyMatch{{Type: TypeProject, Values: []string{"demo"}}},
+		}}},
+		syncer: &Syncer{},
+		audit:  &auditLogger{out: out},
+	}
+
+	for _, verb := range []string{"get", "delete"} {
+		body := `{
+			"apiVersion": "authorization.k8s.io/v1beta1",
+			"kind": "SubjectAccessReview",
+			"spec": {
+				"user": "alice",
+				"group": ["project-id"],
+				"extra": {"alpha.kubernetes.io/identity/project/id": ["project-id"], "alpha.kubernetes.io/identity/project/name": ["demo"]},
+				"resourceAttributes": {"verb": "` + verb + `", "namespace": "default", "resource": "pods", "name": "web"}
+			}
+		}`
+		rr := httptest.NewRecorder()
+		auth.Handler(rr, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body)))
+		th.AssertEquals(t, http.StatusOK, rr.Code)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	th.AssertEquals(t, 2, len(lines))
+
+	var events []auditEvent
+	for _, line := range lines {
+		var e auditEvent
+		th.AssertNoErr(t, json.Unmarshal([]byte(line), &e))
+		e.Time = time.Time{}
+		events = append(events, e)
+	}
+
+	expected := []auditEvent{
+		{User: "alice", Groups: []string{"project-id"}, ProjectID: "project-id", ProjectName: "demo", Verb: "get", Namespace: "default", Resource: "pods", Name: "web", Decision: "allow", Policy: "0"},
+		{User: "alice", Groups: []string{"project-id"}, ProjectID: "project-id", ProjectName: "demo", Verb: "delete", Namespace: "default", Resource: "pods", Name: "web", Decision: "deny", Reason: "No policy matched."},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected audit events %+v, got %+v", expected, events)
+	}
+}
+
+func TestAuditWebhook(t *testing.T) {
+	received := make(chan []auditEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var events []auditEvent
+		if err := json.NewDecoder(r.Body).Decode(&events); err != nil {
+			t.Errorf("failed to decode audit events: %v", err)
+		}
+		received <- events
+	}))
+	defer server.Close()
+
+	l, err := newAuditLogger(&Config{AuditWebhookURL: server.URL})
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, true, l.out == nil)
+
+	// The queued events are sent in a single batch
+	l.log(&auditEvent{User: "alice", Decision: "allow"})
+	l.log(&auditEvent{User: "bob", Decision: "deny"})
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go l.runWebhook(stopCh)
+
+	select {
+	case events := <-received:
+		th.AssertEquals(t, 2, len(events))
+		th.AssertEquals(t, "alice", events[0].User)
+		th.AssertEquals(t, "bob", events[1].User)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the audit events")
+	}
+}
+
+func TestNewAuditLogger(t *testing.T) {
+	l, err := newAuditLogger(&Config{})
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, true, l == nil)
+
+	_, err = newAuditLogger(&Config{AuditLogPath: t.TempDir()})
+	th.AssertEquals(t, true, err != nil)
+}
@@ -19,14 +19,38 @@ package keystone
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"slices"
+	"time"
 
 	"github.com/gophercloud/gophercloud/v2"
 	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/groups"
 	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/tokens"
 	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/users"
+	"github.com/gophercloud/gophercloud/v2/pagination"
 	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
 )
 
+// Scopes of the Keystone tokens
+const (
+	ScopeProject = "project"
+	ScopeDomain  = "domain"
+	ScopeSystem  = "system"
+)
+
+// Prefixes of the groups of the users authenticated with domain-scoped and system-scoped tokens,
+// followed by the domain ID and the system respectively
+const (
+	DomainScopeGroupPrefix = "keystone:domain:"
+	SystemScopeGroupPrefix = "keystone:system:"
+)
+
+// FederationGroupPrefix is the prefix of the groups of the federated users, followed by the ID of
+// the Keystone group the user is mapped to. The token only holds the group IDs, which are thus
+// told apart from the names of the Keystone groups of the other users.
+const FederationGroupPrefix = "keystone:federation:group:"
+
 type tokenInfo struct {
 	userName    string
 	userID      string
@@ -35,39 +59,78 @@ type tokenInfo struct {
 	projectID   string
 	domainName  string
 	domainID    string
+	expiresAt   time.Time
+
+	// projectDomainID is the domain of the project, which the user may not belong to
+	projectDomainID string
+
+	// scope is one of ScopeProject, ScopeDomain or ScopeSystem. The project is set for
+	// project-scoped tokens, the scope domain for domain-scoped tokens and the system
+	// for system-scoped tokens.
+	scope           string
+	scopeDomainName string
+	scopeDomainID   string
+	system          string
+
+	// The identity provider, the protocol and the group IDs of the users authenticated
+	// through Keystone federation
+	identityProvider   string
+	federationProtocol string
+	federationGroups   []string
+
+	// The trust and the trustor of the trust-scoped tokens
+	trustID   string
+	trustorID string
+}
+
+// federationInfo is the OS-FEDERATION attribute of the user of a federated token.
+type federationInfo struct {
+	IdentityProvider struct {
+		ID string `json:"id"`
+	} `json:"identity_provider"`
+	Protocol struct {
+		ID string `json:"id"`
+	} `json:"protocol"`
+	Groups []struct {
+		ID string `json:"id"`
+	} `json:"groups"`
 }
 
 type IKeystone interface {
 	GetTokenInfo(context.Context, string) (*tokenInfo, error)
 	GetGroups(context.Context, string, string) ([]string, error)
+	ValidateToken(context.Context, string) (bool, error)
 }
 
 type Keystoner struct {
-	client *gophercloud.ServiceClient
+	// endpoints are tried in order, see call
+	endpoints []*keystoneEndpoint
 }
 
 func NewKeystoner(client *gophercloud.ServiceClient) *Keystoner {
 	return &Keystoner{
-		client: client,
+		endpoints: []*keystoneEndpoint{{url: client.IdentityEndpoint, client: client, healthy: true}},
 	}
 }
 
 // revive:disable:unexported-return
 func (k *Keystoner) GetTokenInfo(ctx context.Context, token string) (*tokenInfo, error) {
-	k.client.SetToken(token)
-	ret := tokens.Get(ctx, k.client, token)
+	var ret tokens.GetResult
+	_ = k.call(ctx, func(client *gophercloud.ServiceClient) error {
+		client = withToken(client, token)
+		mc := metrics.NewMetricContext("token", "get")
+		ret = tokens.Get(ctx, client, token)
+		return mc.ObserveRequest(ret.Err)
+	})
 
 	tokenUser, err := ret.ExtractUser()
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract user information from Keystone response: %v", err)
 	}
 
-	project, err := ret.ExtractProject()
+	issuedToken, err := ret.ExtractToken()
 	if err != nil {
-		return nil, fmt.Errorf("failed to extract project information from Keystone response: %v", err)
-	}
-	if project == nil {
-		return nil, fmt.Errorf("failed to extract project information from Keystone response")
+		return nil, fmt.Errorf("failed to extract token information from Keystone response: %v", err)
 	}
 
 	roles, err := ret.ExtractRoles()
@@ -80,22 +143,138 @@ func (k *Keystoner) GetTokenInfo(ctx context.Context, token string) (*tokenInfo,
 		userRoles = append(userRoles, role.Name)
 	}
 
-	return &tokenInfo{
-		userName:    tokenUser.Name,
-		userID:      tokenUser.ID,
-		projectName: project.Name,
-		projectID:   project.ID,
-		roles:       userRoles,
-		domainID:    tokenUser.Domain.ID,
-		domainName:  tokenUser.Domain.Name,
-	}, nil
+	info := &tokenInfo{
+		userName:   tokenUser.Name,
+		userID:     tokenUser.ID,
+		roles:      userRoles,
+		domainID:   tokenUser.Domain.ID,
+		domainName: tokenUser.Domain.Name,
+		expiresAt:  issuedToken.ExpiresAt,
+	}
+
+	if err := extractScope(ret, info); err != nil {
+		return nil, err
+	}
+
+	if err := extractFederation(ret, info); err != nil {
+		return nil, err
+	}
+
+	if err := extractTrust(ret, info); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// extractTrust sets the trust attributes of the token info if the token is scoped to a trust.
+func extractTrust(ret tokens.GetResult, info *tokenInfo) error {
+	var s struct {
+		Trust *struct {
+			ID          string `json:"id"`
+			TrustorUser struct {
+				ID string `json:"id"`
+			} `json:"trustor_user"`
+		} `json:"OS-TRUST:trust"`
+	}
+	if err := ret.ExtractIntoStructPtr(&s, "token"); err != nil {
+		return fmt.Errorf("failed to extract trust information from Keystone response: %v", err)
+	}
+
+	if t := s.Trust; t != nil {
+		info.trustID, info.trustorID = t.ID, t.TrustorUser.ID
+	}
+
+	return nil
+}
+
+// extractFederation sets the federation attributes of the token info if the token was issued
+// through Keystone federation.
+func extractFederation(ret tokens.GetResult, info *tokenInfo) error {
+	var s struct {
+		User struct {
+			Federation *federationInfo `json:"OS-FEDERATION"`
+		} `json:"user"`
+	}
+	if err := ret.ExtractIntoStructPtr(&s, "token"); err != nil {
+		return fmt.Errorf("failed to extract federation information from Keystone response: %v", err)
+	}
+
+	if f := s.User.Federation; f != nil {
+		info.identityProvider, info.federationProtocol = f.IdentityProvider.ID, f.Protocol.ID
+		for _, g := range f.Groups {
+			info.federationGroups = append(info.federationGroups, g.ID)
+		}
+	}
+
+	return nil
+}
+
+// extractScope sets the scope of the token info from the project, the domain or the system the
+// token is scoped to. The unscoped tokens are rejected.
+func extractScope(ret tokens.GetResult, info *tokenInfo) error {
+	project, err := ret.ExtractProject()
+	if err != nil {
+		return fmt.Errorf("failed to extract project information from Keystone response: %v", err)
+	}
+	if project != nil {
+		info.scope, info.projectID, info.projectName = ScopeProject, project.ID, project.Name
+		info.projectDomainID = project.Domain.ID
+		return nil
+	}
+
+	domain, err := ret.ExtractDomain()
+	if err != nil {
+		return fmt.Errorf("failed to extract domain information from Keystone response: %v", err)
+	}
+	if domain != nil {
+		info.scope, info.scopeDomainID, info.scopeDomainName = ScopeDomain, domain.ID, domain.Name
+		return nil
+	}
+
+	var s struct {
+		System map[string]bool `json:"system"`
+	}
+	if err := ret.ExtractIntoStructPtr(&s, "token"); err != nil {
+		return fmt.Errorf("failed to extract system information from Keystone response: %v", err)
+	}
+	for system, ok := range s.System {
+		if ok {
+			info.scope, info.system = ScopeSystem, system
+			return nil
+		}
+	}
+
+	return fmt.Errorf("failed to extract project, domain or system information from Keystone response")
 }
 
 // revive:enable:unexported-return
 
+// withToken returns a copy of the client which authenticates its requests with the token, so that
+// the concurrent calls with the tokens of several users don't share the token of the client.
+func withToken(client *gophercloud.ServiceClient, token string) *gophercloud.ServiceClient {
+	provider := &gophercloud.ProviderClient{
+		IdentityBase:     client.IdentityBase,
+		IdentityEndpoint: client.IdentityEndpoint,
+		TokenID:          token,
+		EndpointLocator:  client.EndpointLocator,
+		HTTPClient:       client.HTTPClient,
+		UserAgent:        client.UserAgent,
+	}
+	c := *client
+	c.ProviderClient = provider
+	return &c
+}
+
 func (k *Keystoner) GetGroups(ctx context.Context, token string, userID string) ([]string, error) {
-	k.client.SetToken(token)
-	allGroupPages, err := users.ListGroups(k.client, userID).AllPages(ctx)
+	var allGroupPages pagination.Page
+	err := k.call(ctx, func(client *gophercloud.ServiceClient) error {
+		client = withToken(client, token)
+		mc := metrics.NewMetricContext("user_groups", "list")
+		var err error
+		allGroupPages, err = users.ListGroups(client, userID).AllPages(ctx)
+		return mc.ObserveRequest(err)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user groups from Keystone: %v", err)
 	}
@@ -113,32 +292,142 @@ func (k *Keystoner) GetGroups(ctx context.Context, token string, userID string)
 	return userGroups, nil
 }
 
+// ValidateToken checks whether the token is still valid, i.e. neither expired nor revoked.
+func (k *Keystoner) ValidateToken(ctx context.Context, token string) (bool, error) {
+	var valid bool
+	err := k.call(ctx, func(client *gophercloud.ServiceClient) error {
+		client = withToken(client, token)
+		mc := metrics.NewMetricContext("token", "validate")
+		var err error
+		valid, err = tokens.Validate(ctx, client, token)
+		// The token is also the token of the request, so Keystone rejects the request itself with
+		// 401 Unauthorized rather than answering 404 Not Found once the token is revoked
+		if gophercloud.ResponseCodeIs(err, http.StatusUnauthorized) {
+			valid, err = false, nil
+		}
+		return mc.ObserveRequest(err)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to validate token: %v", err)
+	}
+
+	return valid, nil
+}
+
 // Authenticator contacts openstack keystone to validate user's token passed in the request.
 type Authenticator struct {
 	keystoner IKeystone
+	// cache caches the users of the validated tokens, the tokens are not cached if nil
+	cache *tokenCache
+	// acceptNonProjectScopes accepts the tokens scoped to a domain or to the system, whose roles
+	// are not roles in a project
+	acceptNonProjectScopes bool
+	// skipGroupLookup disables the lookup of the Keystone groups of the users, whose groups are
+	// then only their project and the groups of their scope
+	skipGroupLookup bool
+	// groupCache caches the Keystone groups of the users, the groups are not cached if nil
+	groupCache *groupCache
+	// extraFields are the keys of the extra fields added to the users, by attribute of
+	// userAttributes
+	extraFields map[string]string
 }
 
 // AuthenticateToken checks the token via Keystone call
 func (a *Authenticator) AuthenticateToken(ctx context.Context, token string) (user.Info, bool, error) {
+	u, authenticated, err := a.authenticateToken(ctx, token)
+	if authenticated {
+		metrics.ObserveKeystoneAuthentication("success")
+	} else {
+		metrics.ObserveKeystoneAuthentication("failure")
+	}
+	return u, authenticated, err
+}
+
+// isTokenCached reports whether the user of the token is cached, so that authenticating it doesn't
+// call Keystone.
+func (a *Authenticator) isTokenCached(token string) bool {
+	if a.cache == nil {
+		return false
+	}
+	_, ok := a.cache.get(token)
+	return ok
+}
+
+func (a *Authenticator) authenticateToken(ctx context.Context, token string) (user.Info, bool, error) {
+	if a.cache != nil {
+		u, ok := a.cache.get(token)
+		if ok {
+			metrics.ObserveKeystoneTokenCacheLookup("hit")
+			return u, true, nil
+		}
+		metrics.ObserveKeystoneTokenCacheLookup("miss")
+	}
+
 	tokenInfo, err := a.keystoner.GetTokenInfo(ctx, token)
 	if err != nil {
 		return nil, false, fmt.Errorf("failed to authenticate: %v", err)
 	}
+	if (tokenInfo.scope == ScopeDomain || tokenInfo.scope == ScopeSystem) && !a.acceptNonProjectScopes {
+		return nil, false, fmt.Errorf("failed to authenticate: %s-scoped tokens are not accepted", tokenInfo.scope)
+	}
 
-	userGroups, err := a.keystoner.GetGroups(ctx, token, tokenInfo.userID)
-	if err != nil {
-		return nil, false, fmt.Errorf("failed to authenticate: %v", err)
+	// The groups of the federated users are mapped by the identity provider, the ephemeral
+	// users have no group membership in Keystone
+	var userGroups []string
+	if tokenInfo.identityProvider != "" {
+		for _, g := range tokenInfo.federationGroups {
+			userGroups = append(userGroups, FederationGroupPrefix+g)
+		}
+	} else if !a.skipGroupLookup {
+		userGroups, err = a.getGroups(ctx, token, tokenInfo.userID)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to authenticate: %v", err)
+		}
 	}
 
 	extra := map[string][]string{
-		Roles:       tokenInfo.roles,
-		ProjectID:   {tokenInfo.projectID},
-		ProjectName: {tokenInfo.projectName},
-		DomainID:    {tokenInfo.domainID},
-		DomainName:  {tokenInfo.domainName},
+		Roles:      tokenInfo.roles,
+		DomainID:   {tokenInfo.domainID},
+		DomainName: {tokenInfo.domainName},
+		Scope:      {tokenInfo.scope},
+	}
+
+	if tokenInfo.identityProvider != "" {
+		extra[IdentityProvider] = []string{tokenInfo.identityProvider}
+		extra[FederationProtocol] = []string{tokenInfo.federationProtocol}
+		extra[FederationGroups] = tokenInfo.federationGroups
+	}
+
+	if tokenInfo.trustID != "" {
+		extra[TrustID] = []string{tokenInfo.trustID}
+		extra[TrustorID] = []string{tokenInfo.trustorID}
+	}
+
+	switch tokenInfo.scope {
+	case ScopeDomain:
+		extra[ScopeDomainID] = []string{tokenInfo.scopeDomainID}
+		extra[ScopeDomainName] = []string{tokenInfo.scopeDomainName}
+		userGroups = append(userGroups, DomainScopeGroupPrefix+tokenInfo.scopeDomainID)
+	case ScopeSystem:
+		extra[System] = []string{tokenInfo.system}
+		userGroups = append(userGroups, SystemScopeGroupPrefix+tokenInfo.system)
+	default:
+		extra[ProjectID] = []string{tokenInfo.projectID}
+		extra[ProjectName] = []string{tokenInfo.projectName}
+		if tokenInfo.projectDomainID != "" {
+			extra[ProjectDomainID] = []string{tokenInfo.projectDomainID}
+		}
+		userGroups = append(userGroups, tokenInfo.projectID)
+	}
+	// The configured extra fields copy the attributes, which are kept under their own keys for the
+	// authorization. The attributes the token lacks, e.g. the project of a domain-scoped token,
+	// are not added.
+	for attribute, key := range a.extraFields {
+		if values, ok := extra[userAttributes[attribute]]; ok {
+			extra[key] = slices.Clone(values)
+		}
 	}
 
-	userGroups = append(userGroups, tokenInfo.projectID)
 	authenticatedUser := &user.DefaultInfo{
 		Name:   tokenInfo.userName,
 		UID:    tokenInfo.userID,
@@ -146,5 +435,32 @@ func (a *Authenticator) AuthenticateToken(ctx context.Context, token string) (us
 		Extra:  extra,
 	}
 
+	if a.cache != nil {
+		a.cache.add(token, authenticatedUser, tokenInfo.expiresAt)
+	}
+
 	return authenticatedUser, true, nil
 }
+
+// getGroups returns the names of the Keystone groups of the user, from the group cache if they are
+// cached.
+func (a *Authenticator) getGroups(ctx context.Context, token string, userID string) ([]string, error) {
+	if a.groupCache != nil {
+		if groups, ok := a.groupCache.get(userID); ok {
+			metrics.ObserveKeystoneGroupCacheLookup("hit")
+			return groups, nil
+		}
+		metrics.ObserveKeystoneGroupCacheLookup("miss")
+	}
+
+	groups, err := a.keystoner.GetGroups(ctx, token, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.groupCache != nil {
+		a.groupCache.add(userID, groups)
+	}
+
+	return groups, nil
+}
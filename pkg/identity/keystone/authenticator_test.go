@@ -15,8 +15,18 @@ package keystone
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
 
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/tokens"
 	th "github.com/gophercloud/gophercloud/v2/testhelper"
 	"k8s.io/apiserver/pkg/authentication/user"
 )
@@ -33,6 +43,7 @@ func TestAuthenticateToken(t *testing.T) {
 			domainName:  "domain-name",
 			domainID:    "domain-id",
 			roles:       []string{"role1", "role2"},
+			scope:       ScopeProject,
 		}, nil).
 		Once()
 	keystone.
@@ -58,9 +69,315 @@ func TestAuthenticateToken(t *testing.T) {
 			ProjectName: {"project-name"},
 			DomainID:    {"domain-id"},
 			DomainName:  {"domain-name"},
+			Scope:       {ScopeProject},
 		},
 	}
 	th.AssertDeepEquals(t, expectedUserInfo, userInfo)
 
 	keystone.AssertExpectations(t)
 }
+
+func TestAuthenticateScopedToken(t *testing.T) {
+	ts := []struct {
+		name           string
+		info           *tokenInfo
+		expectedGroups []string
+		expectedExtra  map[string][]string
+	}{
+		{
+			name:           "domain scope",
+			info:           &tokenInfo{scope: ScopeDomain, scopeDomainID: "scope-domain-id", scopeDomainName: "scope-domain-name"},
+			expectedGroups: []string{"group1", "keystone:domain:scope-domain-id"},
+			expectedExtra: map[string][]string{
+				Scope:           {ScopeDomain},
+				ScopeDomainID:   {"scope-domain-id"},
+				ScopeDomainName: {"scope-domain-name"},
+			},
+		},
+		{
+			name:           "system scope",
+			info:           &tokenInfo{scope: ScopeSystem, system: "all"},
+			expectedGroups: []string{"group1", "keystone:system:all"},
+			expectedExtra: map[string][]string{
+				Scope:  {ScopeSystem},
+				System: {"all"},
+			},
+		},
+	}
+
+	for _, tt := range ts {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.info.userName, tt.info.userID = "user-name", "user-id"
+			tt.info.domainID, tt.info.domainName = "domain-id", "domain-name"
+			tt.info.roles = []string{"admin"}
+
+			keystone := &MockIKeystone{}
+			keystone.On("GetTokenInfo", "token").Return(tt.info, nil).Twice()
+			keystone.On("GetGroups", "token", "user-id").Return([]string{"group1"}, nil).Once()
+
+			// The tokens which aren't scoped to a project are rejected by default
+			a := &Authenticator{keystoner: keystone}
+			_, allowed, err := a.AuthenticateToken(context.TODO(), "token")
+			if err == nil || allowed {
+				t.Errorf("expected the %s-scoped token to be rejected", tt.info.scope)
+			}
+
+			a.acceptNonProjectScopes = true
+			userInfo, allowed, err := a.AuthenticateToken(context.TODO(), "token")
+			th.AssertNoErr(t, err)
+			th.AssertEquals(t, true, allowed)
+
+			tt.expectedExtra[Roles] = []string{"admin"}
+			tt.expectedExtra[DomainID] = []string{"domain-id"}
+			tt.expectedExtra[DomainName] = []string{"domain-name"}
+
+			if !reflect.DeepEqual(userInfo.GetGroups(), tt.expectedGroups) {
+				t.Errorf("expected groups %v, got %v", tt.expectedGroups, userInfo.GetGroups())
+			}
+			if !reflect.DeepEqual(userInfo.GetExtra(), tt.expectedExtra) {
+				t.Errorf("expected extra %v, got %v", tt.expectedExtra, userInfo.GetExtra())
+			}
+
+			keystone.AssertExpectations(t)
+		})
+	}
+}
+
+func TestExtractScope(t *testing.T) {
+	ts := []struct {
+		name          string
+		body          string
+		expectedInfo  tokenInfo
+		expectedError bool
+	}{
+		{
+			name:         "project scope",
+			body:         `{"token": {"project": {"id": "project-id", "name": "project-name", "domain": {"id": "default"}}}}`,
+			expectedInfo: tokenInfo{scope: ScopeProject, projectID: "project-id", projectName: "project-name", projectDomainID: "default"},
+		},
+		{
+			name:         "domain scope",
+			body:         `{"token": {"domain": {"id": "domain-id", "name": "domain-name"}}}`,
+			expectedInfo: tokenInfo{scope: ScopeDomain, scopeDomainID: "domain-id", scopeDomainName: "domain-name"},
+		},
+		{
+			name:         "system scope",
+			body:         `{"token": {"system": {"all": true}}}`,
+			expectedInfo: tokenInfo{scope: ScopeSystem, system: "all"},
+		},
+		{
+			name:          "unscoped",
+			body:          `{"token": {"user": {"id": "user-id"}}}`,
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range ts {
+		t.Run(tt.name, func(t *testing.T) {
+			var ret tokens.GetResult
+			th.AssertNoErr(t, json.Unmarshal([]byte(tt.body), &ret.Body))
+
+			var info tokenInfo
+			err := extractScope(ret, &info)
+			if tt.expectedError {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", info)
+				}
+				return
+			}
+
+			th.AssertNoErr(t, err)
+			if !reflect.DeepEqual(info, tt.expectedInfo) {
+				t.Errorf("expected %+v, got %+v", tt.expectedInfo, info)
+			}
+		})
+	}
+}
+
+func TestExtractFederation(t *testing.T) {
+	body := `{"token": {"user": {"id": "user-id", "OS-FEDERATION": {
+		"identity_provider": {"id": "sso"},
+		"protocol": {"id": "openid"},
+		"groups": [{"id": "group-id-1"}, {"id": "group-id-2"}]
+	}}}}`
+
+	var ret tokens.GetResult
+	th.AssertNoErr(t, json.Unmarshal([]byte(body), &ret.Body))
+
+	var info tokenInfo
+	th.AssertNoErr(t, extractFederation(ret, &info))
+
+	expected := tokenInfo{identityProvider: "sso", federationProtocol: "openid", federationGroups: []string{"group-id-1", "group-id-2"}}
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("expected %+v, got %+v", expected, info)
+	}
+}
+
+func TestAuthenticateFederatedToken(t *testing.T) {
+	keystone := &MockIKeystone{}
+	keystone.
+		On("GetTokenInfo", "token").
+		Return(&tokenInfo{
+			userName:           "user-name",
+			userID:             "user-id",
+			projectID:          "project-id",
+			projectName:        "project-name",
+			scope:              ScopeProject,
+			identityProvider:   "sso",
+			federationProtocol: "openid",
+			federationGroups:   []string{"group-id"},
+		}, nil).
+		Once()
+
+	// The groups of the federated users come from the token
+	a := &Authenticator{keystoner: keystone}
+	userInfo, allowed, err := a.AuthenticateToken(context.TODO(), "token")
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, true, allowed)
+
+	// The group IDs are prefixed, not to be mistaken for the group names of the other users
+	expectedGroups := []string{"keystone:federation:group:group-id", "project-id"}
+	if !reflect.DeepEqual(userInfo.GetGroups(), expectedGroups) {
+		t.Errorf("expected groups %v, got %v", expectedGroups, userInfo.GetGroups())
+	}
+
+	extra := userInfo.GetExtra()
+	th.AssertDeepEquals(t, []string{"sso"}, extra[IdentityProvider])
+	th.AssertDeepEquals(t, []string{"openid"}, extra[FederationProtocol])
+	th.AssertDeepEquals(t, []string{"group-id"}, extra[FederationGroups])
+
+	keystone.AssertExpectations(t)
+}
+
+func TestExtractTrust(t *testing.T) {
+	body := `{"token": {"user": {"id": "trustee-id"}, "OS-TRUST:trust": {
+		"id": "trust-id",
+		"impersonation": false,
+		"trustee_user": {"id": "trustee-id"},
+		"trustor_user": {"id": "trustor-id"}
+	}}}`
+
+	var ret tokens.GetResult
+	th.AssertNoErr(t, json.Unmarshal([]byte(body), &ret.Body))
+
+	var info tokenInfo
+	th.AssertNoErr(t, extractTrust(ret, &info))
+
+	expected := tokenInfo{trustID: "trust-id", trustorID: "trustor-id"}
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("expected %+v, got %+v", expected, info)
+	}
+
+	// The tokens which are not scoped to a trust
+	th.AssertNoErr(t, json.Unmarshal([]byte(`{"token": {"user": {"id": "user-id"}}}`), &ret.Body))
+
+	info = tokenInfo{}
+	th.AssertNoErr(t, extractTrust(ret, &info))
+	th.AssertEquals(t, "", info.trustID)
+}
+
+func TestAuthenticateTrustToken(t *testing.T) {
+	keystone := &MockIKeystone{}
+	keystone.
+		On("GetTokenInfo", "token").
+		Return(&tokenInfo{
+			userName:    "trustee",
+			userID:      "trustee-id",
+			projectID:   "project-id",
+			projectName: "project-name",
+			scope:       ScopeProject,
+			trustID:     "trust-id",
+			trustorID:   "trustor-id",
+		}, nil).
+		Once()
+	keystone.
+		On("GetGroups", "token", "trustee-id").
+		Return([]string{}, nil).
+		Once()
+
+	a := &Authenticator{keystoner: keystone}
+	userInfo, allowed, err := a.AuthenticateToken(context.TODO(), "token")
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, true, allowed)
+
+	extra := userInfo.GetExtra()
+	th.AssertDeepEquals(t, []string{"trust-id"}, extra[TrustID])
+	th.AssertDeepEquals(t, []string{"trustor-id"}, extra[TrustorID])
+
+	keystone.AssertExpectations(t)
+}
+
+func TestAuthenticateTokenExtraFields(t *testing.T) {
+	keystone := &MockIKeystone{}
+	keystone.
+		On("GetTokenInfo", "token").
+		Return(&tokenInfo{
+			userName:        "user-name",
+			userID:          "user-id",
+			domainID:        "domain-id",
+			roles:           []string{"admin"},
+			scope:           ScopeDomain,
+			scopeDomainID:   "domain-id",
+			scopeDomainName: "domain-name",
+		}, nil).
+		Once()
+	keystone.
+		On("GetGroups", "token", "user-id").
+		Return([]string{}, nil).
+		Once()
+
+	a := &Authenticator{
+		keystoner:              keystone,
+		acceptNonProjectScopes: true,
+		extraFields: map[string]string{
+			"domain_id":  "example.com/domain-id",
+			"roles":      "example.com/roles",
+			"project_id": "example.com/tenant-id",
+		},
+	}
+	userInfo, allowed, err := a.AuthenticateToken(context.TODO(), "token")
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, true, allowed)
+
+	extra := userInfo.GetExtra()
+	th.AssertDeepEquals(t, []string{"domain-id"}, extra["example.com/domain-id"])
+	th.AssertDeepEquals(t, []string{"admin"}, extra["example.com/roles"])
+	th.AssertDeepEquals(t, []string{"admin"}, extra[Roles])
+
+	// The domain-scoped token has no project
+	if _, ok := extra["example.com/tenant-id"]; ok {
+		t.Errorf("unexpected extra field example.com/tenant-id: %v", extra["example.com/tenant-id"])
+	}
+
+	keystone.AssertExpectations(t)
+}
+
+func TestKeystonerConcurrentTokens(t *testing.T) {
+	// Each request must be authenticated with the token it validates
+	var mismatches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Auth-Token") != r.Header.Get("X-Subject-Token") {
+			mismatches.Add(1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	provider, err := openstack.NewClient(server.URL + "/v3")
+	th.AssertNoErr(t, err)
+	keystoner := NewKeystoner(&gophercloud.ServiceClient{ProviderClient: provider, Endpoint: server.URL + "/v3/"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := keystoner.ValidateToken(context.TODO(), fmt.Sprintf("token-%d", i))
+			th.AssertNoErr(t, err)
+		}()
+	}
+	wg.Wait()
+
+	th.AssertEquals(t, int32(0), mismatches.Load())
+	th.AssertEquals(t, "", provider.Token())
+}
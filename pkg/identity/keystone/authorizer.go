@@ -19,12 +19,15 @@ package keystone
 import (
 	"encoding/json"
 	"fmt"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/gophercloud/gophercloud/v2"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
 	"k8s.io/klog/v2"
 
 	"k8s.io/apiserver/pkg/authorization/authorizer"
@@ -37,7 +40,19 @@ type Authorizer struct {
 	authURL string
 	client  *gophercloud.ServiceClient
 	pl      policyList
-	mu      sync.Mutex
+	// crdPolicies are the policies of the KeystoneAuthorizationPolicy objects, evaluated after pl
+	crdPolicies policyList
+	// parseErr is the error of the last parse of the policy ConfigMap, if it failed
+	parseErr error
+	mu       sync.Mutex
+}
+
+// hasPolicies returns true if any policy is defined.
+func (a *Authorizer) hasPolicies() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return len(a.pl) > 0 || len(a.crdPolicies) > 0
 }
 
 func findString(a string, list []string) bool {
@@ -162,7 +177,7 @@ func nonResourcePermissionAllowed(permissionSpec map[string][]string, attr autho
 			allowedVerbs.Insert(verb)
 		}
 
-		if key == path && allowedVerbs.Has(verb) {
+		if nonResourcePathMatches(key, path) && allowedVerbs.Has(verb) {
 			return true
 		}
 	}
@@ -170,6 +185,16 @@ func nonResourcePermissionAllowed(permissionSpec map[string][]string, attr autho
 	return false
 }
 
+// nonResourcePathMatches returns true if the path matches the definition, which is either the path,
+// "*" matching all paths, or a path with a trailing "*" matching all its subpaths.
+func nonResourcePathMatches(definition string, path string) bool {
+	if definition == "*" || definition == path {
+		return true
+	}
+	// Allow a trailing * subpath match
+	return strings.HasSuffix(definition, "*") && strings.HasPrefix(path, strings.TrimRight(definition, "*"))
+}
+
 func resourceMatches(p policy, a authorizer.Attributes) bool {
 	if *p.ResourceSpec.APIGroup != "*" && *p.ResourceSpec.APIGroup != a.GetAPIGroup() {
 		return false
@@ -217,10 +242,7 @@ func nonResourceMatches(p policy, a authorizer.Attributes) bool {
 	if !findString("*", p.NonResourceSpec.Verbs) && !findString(a.GetVerb(), p.NonResourceSpec.Verbs) {
 		return false
 	}
-	if *p.NonResourceSpec.NonResourcePath != "*" && *p.NonResourceSpec.NonResourcePath != a.GetPath() &&
-		// Allow a trailing * subpath match
-		(!strings.HasSuffix(*p.NonResourceSpec.NonResourcePath, "*") ||
-			!strings.HasPrefix(a.GetPath(), strings.TrimRight(*p.NonResourceSpec.NonResourcePath, "*"))) {
+	if !nonResourcePathMatches(*p.NonResourceSpec.NonResourcePath, a.GetPath()) {
 		return false
 	}
 	allowed := match(p.Match, a)
@@ -237,10 +259,8 @@ func nonResourceMatches(p policy, a authorizer.Attributes) bool {
 func match(match []policyMatch, attributes authorizer.Attributes) bool {
 	user := attributes.GetUser()
 	var find bool
-	types := []string{TypeGroup, TypeProject, TypeRole, TypeUser}
-
 	for _, m := range match {
-		if !findString(m.Type, types) {
+		if !slices.Contains(policyMatchTypes, m.Type) {
 			klog.Warningf("unknown type %s", m.Type)
 			return false
 		}
@@ -289,6 +309,16 @@ func match(match []policyMatch, attributes authorizer.Attributes) bool {
 				}
 			}
 			return false
+		} else if m.Type == TypeIdentityProvider || m.Type == TypeProtocol || m.Type == TypeTrust {
+			key := IdentityProvider
+			if m.Type == TypeProtocol {
+				key = FederationProtocol
+			} else if m.Type == TypeTrust {
+				key = TrustID
+			}
+			if !slices.ContainsFunc(user.GetExtra()[key], func(v string) bool { return findString(v, m.Values) }) {
+				return false
+			}
 		} else if m.Type == TypeRole {
 			if val, ok := user.GetExtra()[Roles]; ok {
 				for _, item := range val {
@@ -312,6 +342,13 @@ func match(match []policyMatch, attributes authorizer.Attributes) bool {
 
 // Authorize checks whether the user can perform an operation
 func (a *Authorizer) Authorize(attributes authorizer.Attributes) (authorized authorizer.Decision, reason string, err error) {
+	authorized, reason, _ = a.authorizeWithRule(attributes)
+	return authorized, reason, nil
+}
+
+// authorizeWithRule checks whether the user can perform an operation like Authorize, and returns
+// the name of the policy rule which allowed or explicitly denied it.
+func (a *Authorizer) authorizeWithRule(attributes authorizer.Attributes) (authorizer.Decision, string, string) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
@@ -326,7 +363,8 @@ func (a *Authorizer) Authorize(attributes authorizer.Attributes) (authorized aut
 
 	// When the user.Extra does not exist, it means that the keystone user authentication has failed, and the authorization verification should not pass.
 	if user.GetExtra() == nil {
-		return authorizer.DecisionDeny, "No auth info found.", nil
+		metrics.ObserveKeystoneAuthorization("deny", "")
+		return authorizer.DecisionDeny, "No auth info found.", ""
 	}
 
 	// We support both project name and project ID.
@@ -344,9 +382,17 @@ func (a *Authorizer) Authorize(attributes authorizer.Attributes) (authorized aut
 
 	klog.V(4).Infof("Request userRoles: %s, userProjects: %s", userRoles.List(), userProjects.List())
 
-	// The permission is whitelist. Make sure we go through all the policies that match the user roles and projects. If
-	// the operation is allowed explicitly, stop the loop and return "allowed".
-	for _, p := range a.pl {
+	// The permission is whitelist, along with the deny policies carving out exceptions. Go through the policies in the
+	// order of their priority, the first policy matching the operation allows or denies it. If no policy matches, the
+	// operation is denied.
+	pl := slices.Concat(a.pl, a.crdPolicies)
+	for _, i := range pl.evaluationOrder() {
+		p := pl[i]
+		if !p.hasValidEffect() {
+			klog.Warningf("unsupported effect %s. skipping policy %s", p.Effect, policyRuleName(p, i))
+			continue
+		}
+
 		policyRoles := sets.NewString()
 		policyProjects := sets.NewString()
 
@@ -370,29 +416,42 @@ func (a *Authorizer) Authorize(attributes authorizer.Attributes) (authorized aut
 		}
 
 		// ResourcePermissionsSpec and NonResourcePermissionsSpec take precedence over ResourceSpec and NonResourceSpec
+		var matched bool
 		if attributes.IsResourceRequest() {
 			if p.ResourcePermissionsSpec != nil {
-				if resourcePermissionAllowed(p.ResourcePermissionsSpec, attributes) {
-					return authorizer.DecisionAllow, "", nil
-				}
+				matched = resourcePermissionAllowed(p.ResourcePermissionsSpec, attributes)
 			} else if p.ResourceSpec != nil {
-				if resourceMatches(*p, attributes) {
-					return authorizer.DecisionAllow, "", nil
-				}
+				matched = resourceMatches(*p, attributes)
 			}
 		} else {
 			if p.NonResourcePermissionsSpec != nil {
-				if nonResourcePermissionAllowed(p.NonResourcePermissionsSpec, attributes) {
-					return authorizer.DecisionAllow, "", nil
-				}
+				matched = nonResourcePermissionAllowed(p.NonResourcePermissionsSpec, attributes)
 			} else if p.NonResourceSpec != nil {
-				if nonResourceMatches(*p, attributes) {
-					return authorizer.DecisionAllow, "", nil
-				}
+				matched = nonResourceMatches(*p, attributes)
+			}
+		}
+
+		if matched {
+			rule := policyRuleName(p, i)
+			if p.isDeny() {
+				metrics.ObserveKeystoneAuthorization("deny", rule)
+				return authorizer.DecisionDeny, fmt.Sprintf("Denied by policy %s.", rule), rule
 			}
+			metrics.ObserveKeystoneAuthorization("allow", rule)
+			return authorizer.DecisionAllow, "", rule
 		}
 	}
 
 	klog.V(4).Infof("Authorization failed, user: %#v, attributes: %#v\n", attributes.GetUser(), attributes)
-	return authorizer.DecisionDeny, "No policy matched.", nil
+	metrics.ObserveKeystoneAuthorization("deny", "")
+	return authorizer.DecisionDeny, "No policy matched.", ""
+}
+
+// policyRuleName returns the name of the policy in the metrics and the audit log, i.e. its index in the policy file
+// or ConfigMap, or the name of its KeystoneAuthorizationPolicy object followed by its index.
+func policyRuleName(p *policy, i int) string {
+	if p.name != "" {
+		return p.name
+	}
+	return strconv.Itoa(i)
 }
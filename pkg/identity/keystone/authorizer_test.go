@@ -18,12 +18,15 @@ package keystone
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/gophercloud/gophercloud/v2"
 	"github.com/gophercloud/gophercloud/v2/openstack"
 	th "github.com/gophercloud/gophercloud/v2/testhelper"
 
+	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apiserver/pkg/authentication/user"
 	"k8s.io/apiserver/pkg/authorization/authorizer"
 )
@@ -412,3 +415,173 @@ func TestAuthorizerVersion2(t *testing.T) {
 	decision, _, _ = a.Authorize(attrs)
 	th.AssertEquals(t, authorizer.DecisionAllow, decision)
 }
+
+func TestAuthorizerFederation(t *testing.T) {
+	apiGroup, namespace := "*", "default"
+	policy := policyList{{
+		ResourceSpec: &resourcePolicySpec{Verbs: []string{"get"}, Resources: []string{"pods"}, APIGroup: &apiGroup, Namespace: &namespace},
+		Match: []policyMatch{
+			{Type: TypeIdentityProvider, Values: []string{"sso"}},
+			{Type: TypeProtocol, Values: []string{"openid"}},
+		},
+	}}
+
+	a := &Authorizer{pl: policy}
+
+	federated := &user.DefaultInfo{
+		Name: "federated",
+		Extra: map[string][]string{
+			IdentityProvider:   {"sso"},
+			FederationProtocol: {"openid"},
+		},
+	}
+	otherProvider := &user.DefaultInfo{
+		Name: "other",
+		Extra: map[string][]string{
+			IdentityProvider:   {"other"},
+			FederationProtocol: {"openid"},
+		},
+	}
+	local := &user.DefaultInfo{Name: "local", Extra: map[string][]string{Roles: {"member"}}}
+
+	attrs := authorizer.AttributesRecord{User: federated, ResourceRequest: true, Verb: "get", Namespace: "default", Resource: "pods"}
+	decision, _, _ := a.Authorize(attrs)
+	th.AssertEquals(t, authorizer.DecisionAllow, decision)
+
+	attrs = authorizer.AttributesRecord{User: otherProvider, ResourceRequest: true, Verb: "get", Namespace: "default", Resource: "pods"}
+	decision, _, _ = a.Authorize(attrs)
+	th.AssertEquals(t, authorizer.DecisionDeny, decision)
+
+	attrs = authorizer.AttributesRecord{User: local, ResourceRequest: true, Verb: "get", Namespace: "default", Resource: "pods"}
+	decision, _, _ = a.Authorize(attrs)
+	th.AssertEquals(t, authorizer.DecisionDeny, decision)
+}
+
+func TestAuthorizerDenyPolicies(t *testing.T) {
+	apiGroup, all, kubeSystem := "*", "*", "kube-system"
+	policy := policyList{
+		{
+			ResourceSpec: &resourcePolicySpec{Verbs: []string{"*"}, Resources: []string{"*"}, APIGroup: &apiGroup, Namespace: &all},
+			Match:        []policyMatch{{Type: TypeRole, Values: []string{"member"}}},
+		},
+		{
+			ResourceSpec: &resourcePolicySpec{Verbs: []string{"*"}, Resources: []string{"secrets"}, APIGroup: &apiGroup, Namespace: &kubeSystem},
+			Match:        []policyMatch{{Type: TypeRole, Values: []string{"member"}}},
+			Effect:       EffectDeny,
+		},
+		{
+			// The admins may read the secrets of kube-system, before the deny policy
+			ResourceSpec: &resourcePolicySpec{Verbs: []string{"get"}, Resources: []string{"secrets"}, APIGroup: &apiGroup, Namespace: &kubeSystem},
+			Match:        []policyMatch{{Type: TypeRole, Values: []string{"admin"}}},
+			Priority:     10,
+		},
+		{
+			NonResourcePermissionsSpec: map[string][]string{"/healthz/*": {"get"}, "*": {"get"}},
+			Match:                      []policyMatch{{Type: TypeRole, Values: []string{"member"}}},
+		},
+		{
+			NonResourcePermissionsSpec: map[string][]string{"/debug/*": {"*"}},
+			Match:                      []policyMatch{{Type: TypeRole, Values: []string{"member"}}},
+			Effect:                     EffectDeny,
+		},
+	}
+
+	a := &Authorizer{pl: policy}
+
+	member := &user.DefaultInfo{Name: "member", Extra: map[string][]string{Roles: {"member"}}}
+	admin := &user.DefaultInfo{Name: "admin", Extra: map[string][]string{Roles: {"member", "admin"}}}
+
+	attrs := authorizer.AttributesRecord{User: member, ResourceRequest: true, Verb: "get", Namespace: "kube-system", Resource: "pods"}
+	decision, _, _ := a.Authorize(attrs)
+	th.AssertEquals(t, authorizer.DecisionAllow, decision)
+
+	// The deny policy takes precedence over the allow policy of the same priority
+	attrs = authorizer.AttributesRecord{User: member, ResourceRequest: true, Verb: "get", Namespace: "kube-system", Resource: "secrets"}
+	decision, reason, rule := a.authorizeWithRule(attrs)
+	th.AssertEquals(t, authorizer.DecisionDeny, decision)
+	th.AssertEquals(t, "Denied by policy 1.", reason)
+	th.AssertEquals(t, "1", rule)
+
+	attrs = authorizer.AttributesRecord{User: member, ResourceRequest: true, Verb: "get", Namespace: "default", Resource: "secrets"}
+	decision, _, _ = a.Authorize(attrs)
+	th.AssertEquals(t, authorizer.DecisionAllow, decision)
+
+	// The allow policy with a higher priority takes precedence over the deny policy
+	attrs = authorizer.AttributesRecord{User: admin, ResourceRequest: true, Verb: "get", Namespace: "kube-system", Resource: "secrets"}
+	decision, _, rule = a.authorizeWithRule(attrs)
+	th.AssertEquals(t, authorizer.DecisionAllow, decision)
+	th.AssertEquals(t, "2", rule)
+
+	attrs = authorizer.AttributesRecord{User: admin, ResourceRequest: true, Verb: "delete", Namespace: "kube-system", Resource: "secrets"}
+	decision, _, _ = a.Authorize(attrs)
+	th.AssertEquals(t, authorizer.DecisionDeny, decision)
+
+	// Non-resource paths
+	attrs = authorizer.AttributesRecord{User: member, ResourceRequest: false, Verb: "get", Path: "/healthz/etcd"}
+	decision, _, _ = a.Authorize(attrs)
+	th.AssertEquals(t, authorizer.DecisionAllow, decision)
+
+	attrs = authorizer.AttributesRecord{User: member, ResourceRequest: false, Verb: "get", Path: "/debug/pprof"}
+	decision, _, rule = a.authorizeWithRule(attrs)
+	th.AssertEquals(t, authorizer.DecisionDeny, decision)
+	th.AssertEquals(t, "4", rule)
+
+	// The policies with an unsupported effect are skipped
+	a.pl = policyList{{
+		ResourceSpec: &resourcePolicySpec{Verbs: []string{"*"}, Resources: []string{"*"}, APIGroup: &apiGroup, Namespace: &all},
+		Effect:       "allwo",
+	}}
+	attrs = authorizer.AttributesRecord{User: member, ResourceRequest: true, Verb: "get", Namespace: "default", Resource: "pods"}
+	decision, reason, _ = a.authorizeWithRule(attrs)
+	th.AssertEquals(t, authorizer.DecisionDeny, decision)
+	th.AssertEquals(t, "No policy matched.", reason)
+}
+
+func TestAuthorizerTrust(t *testing.T) {
+	apiGroup, namespace := "*", "default"
+	policy := policyList{{
+		ResourceSpec: &resourcePolicySpec{Verbs: []string{"get"}, Resources: []string{"pods"}, APIGroup: &apiGroup, Namespace: &namespace},
+		Match:        []policyMatch{{Type: TypeTrust, Values: []string{"trust-id"}}},
+	}}
+
+	a := &Authorizer{pl: policy}
+
+	trustee := &user.DefaultInfo{Name: "trustee", Extra: map[string][]string{TrustID: {"trust-id"}, TrustorID: {"trustor-id"}}}
+	otherTrust := &user.DefaultInfo{Name: "trustee", Extra: map[string][]string{TrustID: {"other-trust-id"}}}
+	local := &user.DefaultInfo{Name: "local", Extra: map[string][]string{Roles: {"member"}}}
+
+	attrs := authorizer.AttributesRecord{User: trustee, ResourceRequest: true, Verb: "get", Namespace: "default", Resource: "pods"}
+	decision, _, _ := a.Authorize(attrs)
+	th.AssertEquals(t, authorizer.DecisionAllow, decision)
+
+	attrs = authorizer.AttributesRecord{User: otherTrust, ResourceRequest: true, Verb: "get", Namespace: "default", Resource: "pods"}
+	decision, _, _ = a.Authorize(attrs)
+	th.AssertEquals(t, authorizer.DecisionDeny, decision)
+
+	attrs = authorizer.AttributesRecord{User: local, ResourceRequest: true, Verb: "get", Namespace: "default", Resource: "pods"}
+	decision, _, _ = a.Authorize(attrs)
+	th.AssertEquals(t, authorizer.DecisionDeny, decision)
+}
+
+func TestPolicyEffectValidation(t *testing.T) {
+	policies := `[
+		{"resource": {"verbs": ["*"], "resources": ["*"], "version": "*", "namespace": "*"}, "match": [{"type": "role", "values": ["member"]}]},
+		{"resource": {"verbs": ["*"], "resources": ["secrets"], "version": "*", "namespace": "kube-system"}, "match": [{"type": "role", "values": ["member"]}], "effect": "Deny"}
+	]`
+
+	// The policy file is rejected
+	path := filepath.Join(t.TempDir(), "policy.json")
+	th.AssertNoErr(t, os.WriteFile(path, []byte(policies), 0600))
+	_, err := newFromFile(path)
+	th.AssertEquals(t, `policy 1: unsupported effect "Deny"`, err.Error())
+
+	// The policies of the ConfigMap are rejected as a whole rather than without the deny policy
+	k := &Auth{authz: &Authorizer{}}
+	k.updatePolicies(&apiv1.ConfigMap{Data: map[string]string{"policies": policies}}, "kube-system/keystone-auth-policy")
+	th.AssertEquals(t, 0, len(k.authz.pl))
+	th.AssertEquals(t, true, k.authz.parseErr != nil)
+
+	k.updatePolicies(&apiv1.ConfigMap{Data: map[string]string{"policies": strings.Replace(policies, "Deny", "deny", 1)}}, "kube-system/keystone-auth-policy")
+	th.AssertEquals(t, 2, len(k.authz.pl))
+	th.AssertNoErr(t, k.authz.parseErr)
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystone
+
+import (
+	"crypto/tls"
+	"fmt"
+	"slices"
+
+	certutil "k8s.io/client-go/util/cert"
+)
+
+// newServerTLSConfig returns the TLS config of the webhook server. If the config has a client CA
+// file, the clients must present a certificate signed by one of its CAs and, if the allowed client
+// names are set, with one of them as common name. The config is nil otherwise.
+func newServerTLSConfig(c *Config) (*tls.Config, error) {
+	if c.ClientCAFile == "" {
+		return nil, nil
+	}
+
+	clientCAs, err := certutil.NewPool(c.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client CA file %s: %v", c.ClientCAFile, err)
+	}
+
+	config := &tls.Config{
+		ClientCAs:  clientCAs,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		MinVersion: tls.VersionTLS12,
+	}
+	if len(c.AllowedClientNames) > 0 {
+		config.VerifyConnection = verifyClientName(c.AllowedClientNames)
+	}
+
+	return config, nil
+}
+
+// verifyClientName returns the function rejecting the connections of the clients whose verified
+// certificate doesn't have one of the allowed names as common name.
+func verifyClientName(allowedNames []string) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if len(cs.VerifiedChains) == 0 || len(cs.VerifiedChains[0]) == 0 {
+			return fmt.Errorf("client certificate not verified")
+		}
+
+		name := cs.VerifiedChains[0][0].Subject.CommonName
+		if !slices.Contains(allowedNames, name) {
+			return fmt.Errorf("client certificate common name %q is not allowed", name)
+		}
+		return nil
+	}
+}
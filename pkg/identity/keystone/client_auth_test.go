@@ -0,0 +1,123 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystone
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+)
+
+// newTestCertificate returns a certificate with the given common name, signed by parent or self-signed
+// if parent is nil.
+func newTestCertificate(t *testing.T, commonName string, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	th.AssertNoErr(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	issuer, signer := template, any(key)
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		issuer, signer = parent.Leaf, parent.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	th.AssertNoErr(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	th.AssertNoErr(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestNewServerTLSConfig(t *testing.T) {
+	config, err := newServerTLSConfig(&Config{})
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, true, config == nil)
+
+	_, err = newServerTLSConfig(&Config{ClientCAFile: filepath.Join(t.TempDir(), "missing.crt")})
+	th.AssertEquals(t, true, err != nil)
+}
+
+func TestClientCertificateAuthentication(t *testing.T) {
+	ca := newTestCertificate(t, "ca", nil)
+	otherCA := newTestCertificate(t, "other-ca", nil)
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	th.AssertNoErr(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Certificate[0]}), 0600))
+
+	config, err := newServerTLSConfig(&Config{ClientCAFile: caFile, AllowedClientNames: []string{"kube-apiserver"}})
+	th.AssertNoErr(t, err)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+
+	for _, tt := range []struct {
+		name       string
+		clientCert tls.Certificate
+		allowed    bool
+	}{
+		{name: "allowed name", clientCert: newTestCertificate(t, "kube-apiserver", &ca), allowed: true},
+		{name: "other name", clientCert: newTestCertificate(t, "other", &ca)},
+		{name: "other CA", clientCert: newTestCertificate(t, "kube-apiserver", &otherCA)},
+		{name: "no certificate"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client := server.Client()
+			transport := client.Transport.(*http.Transport).Clone()
+			// The certificate is sent even if it isn't signed by the CAs the server asks for
+			transport.TLSClientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return &tt.clientCert, nil
+			}
+			client.Transport = transport
+
+			resp, err := client.Get(server.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if tt.allowed != (err == nil) {
+				t.Errorf("expected the request to be allowed: %t, got error %v", tt.allowed, err)
+			}
+		})
+	}
+}
@@ -19,6 +19,8 @@ package keystone
 import (
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/pflag"
 	"k8s.io/klog/v2"
@@ -29,13 +31,50 @@ type Config struct {
 	Address             string
 	CertFile            string
 	KeyFile             string
+	ClientCAFile        string
+	AllowedClientNames  []string
 	KeystoneURL         string
 	KeystoneCA          string
 	PolicyFile          string
 	PolicyConfigMapName string
+	PolicyCRD           bool
 	SyncConfigFile      string
 	SyncConfigMapName   string
 	Kubeconfig          string
+
+	// KeystoneFailoverURLs are the URLs of the Keystone endpoints tried after KeystoneURL,
+	// optionally followed by a comma and the file containing their certificate authority
+	KeystoneFailoverURLs        []string
+	KeystoneHealthCheckInterval time.Duration
+
+	TokenCacheTTL                time.Duration
+	TokenRevocationCheckInterval time.Duration
+
+	// AcceptNonProjectScopes accepts the tokens scoped to a domain or to the system
+	AcceptNonProjectScopes bool
+
+	GroupLookup   bool
+	GroupCacheTTL time.Duration
+
+	// DeprovisioningCloudConfig is the cloud config file of the credentials used to look up the
+	// users and the projects of the cached authentications
+	DeprovisioningCloudConfig   string
+	DeprovisioningCheckInterval time.Duration
+
+	// UserExtraFields are the keys of the extra fields added to the users, by attribute
+	UserExtraFields map[string]string
+
+	RateLimit            float64
+	RateLimitBurst       int
+	ClientRateLimit      float64
+	ClientRateLimitBurst int
+	MaxRequestBodyBytes  int64
+
+	MetricsAddress string
+	HealthAddress  string
+
+	AuditLogPath    string
+	AuditWebhookURL string
 }
 
 // NewConfig returns a Config
@@ -44,6 +83,7 @@ func NewConfig() *Config {
 		Address:             "0.0.0.0:8443",
 		CertFile:            os.Getenv("TLS_CERT_FILE"),
 		KeyFile:             os.Getenv("TLS_PRIVATE_KEY_FILE"),
+		ClientCAFile:        os.Getenv("TLS_CLIENT_CA_FILE"),
 		KeystoneURL:         os.Getenv("OS_AUTH_URL"),
 		KeystoneCA:          os.Getenv("KEYSTONE_CA_FILE"),
 		PolicyFile:          os.Getenv("KEYSTONE_POLICY_FILE"),
@@ -51,6 +91,16 @@ func NewConfig() *Config {
 		SyncConfigFile:      os.Getenv("KEYSTONE_SYNC_CONFIG_FILE"),
 		SyncConfigMapName:   os.Getenv("KEYSTONE_SYNC_CONFIGMAP_NAME"),
 		Kubeconfig:          os.Getenv("KEYSTONE_KUBECONFIG_FILE"),
+
+		KeystoneHealthCheckInterval: 30 * time.Second,
+
+		TokenRevocationCheckInterval: time.Minute,
+
+		GroupLookup: true,
+
+		DeprovisioningCheckInterval: time.Minute,
+
+		MaxRequestBodyBytes: 1 << 20,
 	}
 }
 
@@ -62,17 +112,73 @@ func (c *Config) ValidateFlags() error {
 		errorsFound = true
 		klog.Errorf("please specify --keystone-url or set the OS_AUTH_URL environment variable.")
 	}
+	for _, s := range c.KeystoneFailoverURLs {
+		if parseKeystoneEndpoint(s).url == "" {
+			errorsFound = true
+			klog.Errorf("--keystone-failover-url must not be empty.")
+		}
+	}
+	if c.KeystoneHealthCheckInterval < 0 {
+		errorsFound = true
+		klog.Errorf("--keystone-health-check-interval must not be negative.")
+	}
 	if c.CertFile == "" || c.KeyFile == "" {
 		errorsFound = true
 		klog.Errorf("Please specify --tls-cert-file and --tls-private-key-file arguments.")
 	}
-	if c.PolicyFile == "" && c.PolicyConfigMapName == "" {
-		klog.Warning("Argument --keystone-policy-file or --policy-configmap-name missing. Only keystone authentication will work. Use RBAC for authorization.")
+	if len(c.AllowedClientNames) > 0 && c.ClientCAFile == "" {
+		errorsFound = true
+		klog.Errorf("--allowed-client-names requires --client-ca-file.")
+	}
+	if c.PolicyFile == "" && c.PolicyConfigMapName == "" && !c.PolicyCRD {
+		klog.Warning("Argument --keystone-policy-file, --policy-configmap-name or --policy-crd missing. Only keystone authentication will work. Use RBAC for authorization.")
 	}
 	if c.SyncConfigFile == "" && c.SyncConfigMapName == "" {
 		klog.Warning("Argument --sync-config-file or --sync-configmap-name missing. Data synchronization between Keystone and Kubernetes is disabled.")
 	}
 
+	if c.TokenCacheTTL < 0 {
+		errorsFound = true
+		klog.Errorf("--token-cache-ttl must not be negative.")
+	}
+	if c.TokenRevocationCheckInterval < 0 {
+		errorsFound = true
+		klog.Errorf("--token-revocation-check-interval must not be negative.")
+	}
+	if c.GroupCacheTTL < 0 {
+		errorsFound = true
+		klog.Errorf("--group-cache-ttl must not be negative.")
+	}
+	if c.DeprovisioningCheckInterval < 0 {
+		errorsFound = true
+		klog.Errorf("--deprovisioning-check-interval must not be negative.")
+	}
+	extraKeys := make(map[string]bool, len(c.UserExtraFields))
+	for attribute, key := range c.UserExtraFields {
+		if _, ok := userAttributes[attribute]; !ok {
+			errorsFound = true
+			klog.Errorf("--user-extra-fields: unsupported attribute %s, must be one of project_id, project_name, project_domain_id, domain_id, domain_name, roles, identity_provider or protocol.", attribute)
+		}
+		if key == "" || strings.HasPrefix(key, "alpha.kubernetes.io/identity/") {
+			errorsFound = true
+			klog.Errorf("--user-extra-fields: the key of attribute %s must not be empty nor start with alpha.kubernetes.io/identity/.", attribute)
+		}
+		if extraKeys[key] {
+			errorsFound = true
+			klog.Errorf("--user-extra-fields: key %s is used more than once.", key)
+		}
+		extraKeys[key] = true
+	}
+
+	if c.RateLimit < 0 || c.RateLimitBurst < 0 || c.ClientRateLimit < 0 || c.ClientRateLimitBurst < 0 {
+		errorsFound = true
+		klog.Errorf("--rate-limit, --rate-limit-burst, --client-rate-limit and --client-rate-limit-burst must not be negative.")
+	}
+	if c.MaxRequestBodyBytes < 0 {
+		errorsFound = true
+		klog.Errorf("--max-request-body-bytes must not be negative.")
+	}
+
 	if errorsFound {
 		return fmt.Errorf("failed to validate the input parameters")
 	}
@@ -84,11 +190,33 @@ func (c *Config) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&c.Address, "listen", c.Address, "<address>:<port> to listen on")
 	fs.StringVar(&c.CertFile, "tls-cert-file", c.CertFile, "File containing the default x509 Certificate for HTTPS.")
 	fs.StringVar(&c.KeyFile, "tls-private-key-file", c.KeyFile, "File containing the default x509 private key matching --tls-cert-file.")
+	fs.StringVar(&c.ClientCAFile, "client-ca-file", c.ClientCAFile, "File containing the certificate authorities of the client certificates. If provided, the clients must present a certificate signed by one of them, e.g. the kube-apiserver.")
+	fs.StringSliceVar(&c.AllowedClientNames, "allowed-client-names", c.AllowedClientNames, "Common names of the client certificates which are allowed to call the webhook, e.g. kube-apiserver. Any client certificate signed by the --client-ca-file authorities is allowed if empty.")
 	fs.StringVar(&c.KeystoneURL, "keystone-url", c.KeystoneURL, "URL for the OpenStack Keystone API")
 	fs.StringVar(&c.KeystoneCA, "keystone-ca-file", c.KeystoneCA, "File containing the certificate authority for Keystone Service.")
+	fs.StringArrayVar(&c.KeystoneFailoverURLs, "keystone-failover-url", c.KeystoneFailoverURLs, "URL of a Keystone endpoint the webhook fails over to when the previous endpoints can't be reached, optionally followed by a comma and the file containing its certificate authority, e.g. https://keystone-2:5000/v3,/etc/keystone-2/ca.crt. Use multiple times to add more than one endpoint, the endpoints are tried in order after --keystone-url.")
+	fs.DurationVar(&c.KeystoneHealthCheckInterval, "keystone-health-check-interval", c.KeystoneHealthCheckInterval, "Interval between the health checks of the Keystone endpoints when --keystone-failover-url is set. The requests fail back to the first healthy endpoint once it passes a health check. The endpoints are not checked if 0.")
 	fs.StringVar(&c.PolicyFile, "keystone-policy-file", c.PolicyFile, "File containing the policy, if provided, it takes precedence over the policy configmap.")
 	fs.StringVar(&c.PolicyConfigMapName, "policy-configmap-name", c.PolicyConfigMapName, "ConfigMap in kube-system namespace containing the policy configuration, the ConfigMap data must contain the key 'policies'")
+	fs.BoolVar(&c.PolicyCRD, "policy-crd", c.PolicyCRD, "Load the policy from the KeystoneAuthorizationPolicy objects in addition to the policy file or configmap. The policies are reloaded on every change of the objects.")
 	fs.StringVar(&c.SyncConfigFile, "sync-config-file", c.SyncConfigFile, "File containing config values for data synchronization between Keystone and Kubernetes.")
 	fs.StringVar(&c.SyncConfigMapName, "sync-configmap-name", "", "ConfigMap in kube-system namespace containing config values for data synchronization between Keystone and Kubernetes.")
+	fs.DurationVar(&c.TokenCacheTTL, "token-cache-ttl", c.TokenCacheTTL, "Duration for which the users of the validated tokens are cached, capped by the expiration of the tokens. The tokens are not cached if 0.")
+	fs.DurationVar(&c.TokenRevocationCheckInterval, "token-revocation-check-interval", c.TokenRevocationCheckInterval, "Interval between the checks of the revocation of the cached tokens with Keystone. The revoked tokens stay cached until the --token-cache-ttl elapses if 0.")
+	fs.BoolVar(&c.AcceptNonProjectScopes, "accept-non-project-scopes", c.AcceptNonProjectScopes, "Accept the tokens scoped to a domain or to the system in addition to the tokens scoped to a project. Their roles, in the alpha.kubernetes.io/identity/roles extra field, are the roles of the user on the domain or on the system.")
+	fs.BoolVar(&c.GroupLookup, "group-lookup", c.GroupLookup, "Look up the Keystone groups of the users when validating their tokens, and add their names to the groups of the users. The federated users get the groups they are mapped to regardless.")
+	fs.DurationVar(&c.GroupCacheTTL, "group-cache-ttl", c.GroupCacheTTL, "Duration for which the Keystone groups of the users are cached, shared by all the tokens of a user. The groups are not cached if 0.")
+	fs.StringVar(&c.DeprovisioningCloudConfig, "deprovisioning-cloud-config", c.DeprovisioningCloudConfig, "Cloud config file with the credentials of a Keystone user allowed to get the users and the projects, e.g. with the reader role. If set, the cached authentications of the deleted or disabled users and projects are removed every --deprovisioning-check-interval.")
+	fs.DurationVar(&c.DeprovisioningCheckInterval, "deprovisioning-check-interval", c.DeprovisioningCheckInterval, "Interval between the checks of the deletion or disabling of the users and the projects of the cached authentications. The authentications stay cached until their cache entries expire if 0.")
+	fs.StringToStringVar(&c.UserExtraFields, "user-extra-fields", c.UserExtraFields, "Extra fields added to the users in the TokenReview responses, as attribute=key pairs, e.g. project_id=example.com/tenant-id. The attributes are project_id, project_name, project_domain_id, domain_id, domain_name, roles, identity_provider and protocol, which are also kept under their alpha.kubernetes.io/identity/ keys.")
+	fs.Float64Var(&c.RateLimit, "rate-limit", c.RateLimit, "Maximum number of webhook requests per second of all the clients together. The requests over the limit are rejected with 429 Too Many Requests. No limit if 0.")
+	fs.IntVar(&c.RateLimitBurst, "rate-limit-burst", c.RateLimitBurst, "Number of webhook requests of all the clients together which are allowed at once, above --rate-limit.")
+	fs.Float64Var(&c.ClientRateLimit, "client-rate-limit", c.ClientRateLimit, "Maximum number of authentication webhook requests per second of every client of the Kubernetes API, identified by its token, which call Keystone as the token is not cached. The requests over the limit are rejected with 429 Too Many Requests. No limit if 0.")
+	fs.IntVar(&c.ClientRateLimitBurst, "client-rate-limit-burst", c.ClientRateLimitBurst, "Number of authentication webhook requests calling Keystone of every client of the Kubernetes API which are allowed at once, above --client-rate-limit.")
+	fs.Int64Var(&c.MaxRequestBodyBytes, "max-request-body-bytes", c.MaxRequestBodyBytes, "Maximum size in bytes of the webhook request bodies. The larger requests are rejected with 413 Request Entity Too Large. No limit if 0.")
+	fs.StringVar(&c.MetricsAddress, "metrics-listen", c.MetricsAddress, "<address>:<port> to serve the Prometheus metrics on over HTTP, on the /metrics path. The metrics are not served if empty.")
+	fs.StringVar(&c.HealthAddress, "health-listen", c.HealthAddress, "<address>:<port> to serve the /healthz and /readyz probes on over HTTP, in addition to the webhook listener, which requires client certificates if --client-ca-file is set.")
+	fs.StringVar(&c.AuditLogPath, "audit-log-path", c.AuditLogPath, "File the authorization decisions are appended to as JSON lines, '-' means the standard output. The decisions are not written if empty.")
+	fs.StringVar(&c.AuditWebhookURL, "audit-webhook-url", c.AuditWebhookURL, "URL the authorization decisions are posted to in batches, as JSON arrays. The decisions are not sent if empty.")
 	fs.StringVar(&c.Kubeconfig, "kubeconfig", c.Kubeconfig, "Kubeconfig file used to connect to Kubernetes API to get policy configmap. If the service is running inside the pod, this option is not necessary, will use in-cluster config instead.")
 }
@@ -0,0 +1,156 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystone
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/projects"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/users"
+	gcfg "gopkg.in/gcfg.v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/klog/v2"
+
+	"k8s.io/cloud-provider-openstack/pkg/client"
+)
+
+// deprovisioningCloudConfig is the configuration file of the credentials the deprovisioning
+// checks look up the users and the projects with, in the format of the other components.
+type deprovisioningCloudConfig struct {
+	Global client.AuthOpts
+}
+
+// deprovisioningChecker removes the cached authentications of the users and of the projects which
+// were deleted or disabled in Keystone. The tokens of these users and projects are invalidated by
+// Keystone, but they may be revalidated only once their cache entries expire, e.g. when the
+// revocation checks are disabled.
+type deprovisioningChecker struct {
+	client *gophercloud.ServiceClient
+	tokens *tokenCache
+	groups *groupCache
+}
+
+// newDeprovisioningChecker connects to Keystone with the credentials of the cloud config file,
+// which must be allowed to get the users and the projects, e.g. with the reader role.
+func newDeprovisioningChecker(path string, tokens *tokenCache, groups *groupCache) (*deprovisioningChecker, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the deprovisioning cloud config: %v", err)
+	}
+	defer f.Close()
+
+	var cfg deprovisioningCloudConfig
+	if err := gcfg.FatalOnly(gcfg.ReadInto(&cfg, f)); err != nil {
+		return nil, fmt.Errorf("failed to read the deprovisioning cloud config: %v", err)
+	}
+
+	if cfg.Global.UseClouds {
+		if cfg.Global.CloudsFile != "" {
+			os.Setenv("OS_CLIENT_CONFIG_FILE", cfg.Global.CloudsFile)
+		}
+		if err := client.ReadClouds(&cfg.Global); err != nil {
+			return nil, fmt.Errorf("failed to read clouds.yaml: %v", err)
+		}
+	}
+
+	provider, err := client.NewOpenStackClient(&cfg.Global, "k8s-keystone-auth", userAgentData...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate the deprovisioning checks: %v", err)
+	}
+
+	identity, err := openstack.NewIdentityV3(provider, gophercloud.EndpointOpts{Region: cfg.Global.Region, Availability: cfg.Global.EndpointType})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the identity endpoint: %v", err)
+	}
+
+	return &deprovisioningChecker{client: identity, tokens: tokens, groups: groups}, nil
+}
+
+// deprovisioned returns whether the user or the project is deleted or disabled, according to the
+// result of its lookup. The failed lookups are not considered deprovisioning.
+func deprovisioned(kind, id string, enabled bool, err error) bool {
+	if err != nil {
+		if gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+			klog.Infof("Keystone %s %s was deleted, removing its cached authentications", kind, id)
+			return true
+		}
+		klog.Warningf("Failed to check the deprovisioning of Keystone %s %s: %v", kind, id, err)
+		return false
+	}
+
+	if !enabled {
+		klog.Infof("Keystone %s %s is disabled, removing its cached authentications", kind, id)
+	}
+	return !enabled
+}
+
+// check looks up the users and the projects of the cached authentications, and removes the ones
+// of the deleted or disabled users and projects.
+func (d *deprovisioningChecker) check(ctx context.Context) {
+	userIDs, projectIDs := sets.New[string](), sets.New[string]()
+	if d.tokens != nil {
+		for _, u := range d.tokens.users() {
+			userIDs.Insert(u.UID)
+			projectIDs.Insert(u.Extra[ProjectID]...)
+		}
+	}
+	if d.groups != nil {
+		userIDs.Insert(d.groups.userIDs()...)
+	}
+
+	deprovisionedUsers, deprovisionedProjects := sets.New[string](), sets.New[string]()
+	for id := range userIDs {
+		u, err := users.Get(ctx, d.client, id).Extract()
+		if deprovisioned("user", id, err == nil && u.Enabled, err) {
+			deprovisionedUsers.Insert(id)
+		}
+	}
+	for id := range projectIDs {
+		p, err := projects.Get(ctx, d.client, id).Extract()
+		if deprovisioned("project", id, err == nil && p.Enabled, err) {
+			deprovisionedProjects.Insert(id)
+		}
+	}
+
+	if d.tokens != nil && (deprovisionedUsers.Len() > 0 || deprovisionedProjects.Len() > 0) {
+		n := d.tokens.deleteUsers(func(u *user.DefaultInfo) bool {
+			return deprovisionedUsers.Has(u.UID) || deprovisionedProjects.HasAny(u.Extra[ProjectID]...)
+		})
+		klog.Infof("Removed %d tokens of deprovisioned users and projects from the token cache", n)
+	}
+	if d.groups != nil {
+		for id := range deprovisionedUsers {
+			d.groups.delete(id)
+		}
+	}
+}
+
+// run periodically checks the deprovisioning of the users and the projects, until stopCh is
+// closed.
+func (d *deprovisioningChecker) run(interval time.Duration, stopCh <-chan struct{}) {
+	wait.Until(func() {
+		d.check(context.TODO())
+	}, interval, stopCh)
+}
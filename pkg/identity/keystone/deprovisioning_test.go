@@ -0,0 +1,105 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystone
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	"github.com/gophercloud/gophercloud/v2/testhelper/client"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+func TestDeprovisioningCheck(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	enabled := map[string]bool{
+		"/users/user1":       true,
+		"/users/user2":       false,
+		"/users/user4":       true,
+		"/projects/project1": true,
+		"/projects/project3": false,
+	}
+	for _, path := range []string{"/users/", "/projects/"} {
+		fakeServer.Mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			th.TestMethod(t, r, "GET")
+
+			if r.URL.Path == "/users/user5" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			e, ok := enabled[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			if path == "/users/" {
+				fmt.Fprintf(w, `{"user": {"id": "%s", "enabled": %t}}`, r.URL.Path[len(path):], e)
+			} else {
+				fmt.Fprintf(w, `{"project": {"id": "%s", "enabled": %t}}`, r.URL.Path[len(path):], e)
+			}
+		})
+	}
+
+	tokens := newTokenCache(time.Hour)
+	expiresAt := time.Now().Add(time.Hour)
+	for _, u := range []*user.DefaultInfo{
+		{UID: "user1", Extra: map[string][]string{ProjectID: {"project1"}}},
+		// Disabled user
+		{UID: "user2", Extra: map[string][]string{ProjectID: {"project1"}}},
+		// Deleted project
+		{UID: "user1", Extra: map[string][]string{ProjectID: {"project2"}}},
+		// Disabled project
+		{UID: "user4", Extra: map[string][]string{ProjectID: {"project3"}}},
+		// Failed lookup
+		{UID: "user5", Extra: map[string][]string{ProjectID: {"project1"}}},
+	} {
+		tokens.add(fmt.Sprintf("%s-%s", u.UID, u.Extra[ProjectID][0]), u, expiresAt)
+	}
+
+	groups := newGroupCache(time.Hour)
+	for _, id := range []string{"user1", "user2", "user3"} {
+		groups.add(id, []string{"group"})
+	}
+
+	d := &deprovisioningChecker{client: client.ServiceClient(fakeServer), tokens: tokens, groups: groups}
+	d.check(context.TODO())
+
+	for token, expected := range map[string]bool{
+		"user1-project1": true,
+		"user2-project1": false,
+		"user1-project2": false,
+		"user4-project3": false,
+		"user5-project1": true,
+	} {
+		_, ok := tokens.get(token)
+		th.AssertEquals(t, expected, ok)
+	}
+
+	// The groups of the deleted and disabled users are removed
+	for id, expected := range map[string]bool{"user1": true, "user2": false, "user3": false} {
+		_, ok := groups.get(id)
+		th.AssertEquals(t, expected, ok)
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystone
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// maxGroupCacheEntries bounds the memory used by the group cache. The groups are not cached while
+// the cache is full of unexpired entries.
+const maxGroupCacheEntries = 10000
+
+type groupCacheEntry struct {
+	groups    []string
+	expiresAt time.Time
+}
+
+// groupCache caches the names of the Keystone groups of the users, keyed by the IDs of the users.
+// Unlike the token cache, the groups are shared by all the tokens of a user.
+type groupCache struct {
+	ttl     time.Duration
+	now     func() time.Time
+	mu      sync.Mutex
+	entries map[string]*groupCacheEntry
+}
+
+func newGroupCache(ttl time.Duration) *groupCache {
+	return &groupCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]*groupCacheEntry),
+	}
+}
+
+// get returns a copy of the cached groups of the user, if not expired.
+func (c *groupCache) get(userID string) ([]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[userID]
+	if !ok {
+		return nil, false
+	}
+
+	if !c.now().Before(e.expiresAt) {
+		delete(c.entries, userID)
+		return nil, false
+	}
+
+	return slices.Clone(e.groups), true
+}
+
+// userIDs returns the IDs of the users whose groups are cached.
+func (c *groupCache) userIDs() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return slices.Collect(maps.Keys(c.entries))
+}
+
+func (c *groupCache) delete(userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, userID)
+}
+
+// add caches the groups of the user until the TTL of the cache elapses.
+func (c *groupCache) add(userID string, groups []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	if len(c.entries) >= maxGroupCacheEntries {
+		maps.DeleteFunc(c.entries, func(_ string, e *groupCacheEntry) bool {
+			return !now.Before(e.expiresAt)
+		})
+
+		if len(c.entries) >= maxGroupCacheEntries {
+			klog.V(4).Infof("Group cache is full, not caching the groups of user %s", userID)
+			return
+		}
+	}
+
+	c.entries[userID] = &groupCacheEntry{groups: slices.Clone(groups), expiresAt: now.Add(c.ttl)}
+}
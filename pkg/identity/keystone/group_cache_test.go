@@ -0,0 +1,95 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystone
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+)
+
+func TestAuthenticateGroupCache(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	keystone := &MockIKeystone{}
+	for _, token := range []string{"token1", "token2"} {
+		keystone.
+			On("GetTokenInfo", token).
+			Return(&tokenInfo{userName: "user-name", userID: "user-id", projectID: "project-id", scope: ScopeProject}, nil).
+			Once()
+	}
+	keystone.
+		On("GetGroups", "token1", "user-id").
+		Return([]string{"group1"}, nil).
+		Once()
+
+	cache := newGroupCache(10 * time.Minute)
+	cache.now = func() time.Time { return now }
+
+	a := &Authenticator{keystoner: keystone, groupCache: cache}
+
+	// The groups are shared by the tokens of the user
+	for _, token := range []string{"token1", "token2"} {
+		u, allowed, err := a.AuthenticateToken(context.TODO(), token)
+		th.AssertNoErr(t, err)
+		th.AssertEquals(t, true, allowed)
+		th.AssertDeepEquals(t, []string{"group1", "project-id"}, u.GetGroups())
+	}
+
+	keystone.AssertExpectations(t)
+
+	// The groups are no longer cached once the TTL elapsed
+	now = now.Add(10 * time.Minute)
+	_, ok := cache.get("user-id")
+	th.AssertEquals(t, false, ok)
+}
+
+func TestAuthenticateSkipGroupLookup(t *testing.T) {
+	keystone := &MockIKeystone{}
+	keystone.
+		On("GetTokenInfo", "token").
+		Return(&tokenInfo{userName: "user-name", userID: "user-id", projectID: "project-id", scope: ScopeProject}, nil).
+		Once()
+
+	// GetGroups is not expected
+	a := &Authenticator{keystoner: keystone, skipGroupLookup: true}
+	u, allowed, err := a.AuthenticateToken(context.TODO(), "token")
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, true, allowed)
+	th.AssertDeepEquals(t, []string{"project-id"}, u.GetGroups())
+
+	keystone.AssertExpectations(t)
+}
+
+func TestGroupCacheCopy(t *testing.T) {
+	cache := newGroupCache(time.Minute)
+
+	groups := []string{"group1"}
+	cache.add("user-id", groups)
+	groups[0] = "modified"
+
+	cached, ok := cache.get("user-id")
+	th.AssertEquals(t, true, ok)
+	th.AssertDeepEquals(t, []string{"group1"}, cached)
+
+	// The cached groups must not be modified through the returned ones
+	cached[0] = "modified"
+	cached, _ = cache.get("user-id")
+	th.AssertDeepEquals(t, []string{"group1"}, cached)
+}
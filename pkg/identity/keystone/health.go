@@ -0,0 +1,124 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystone
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// readyzKeystoneTimeout bounds the duration of the checks of the Keystone endpoints of a readiness
+// probe.
+const readyzKeystoneTimeout = 5 * time.Second
+
+// healthz answers the liveness probes. It doesn't check the dependencies, as restarting the
+// webhook doesn't help when Keystone is down.
+func healthz(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+// readyz answers the readiness probes: the webhook is ready when a Keystone endpoint can be
+// reached and the policies could be parsed. The result of every check is listed in the response
+// like in the probes of the Kubernetes components.
+func (k *Auth) readyz(w http.ResponseWriter, r *http.Request) {
+	checks := []struct {
+		name  string
+		check func(ctx context.Context) error
+	}{
+		{"keystone", k.checkKeystone},
+		{"policy", k.checkPolicies},
+	}
+
+	var b strings.Builder
+	ready := true
+	for _, c := range checks {
+		if err := c.check(r.Context()); err != nil {
+			ready = false
+			fmt.Fprintf(&b, "[-]%s failed: %v\n", c.name, err)
+			klog.V(2).Infof("Readiness check %s failed: %v", c.name, err)
+			continue
+		}
+		fmt.Fprintf(&b, "[+]%s ok\n", c.name)
+	}
+
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(b.String()))
+}
+
+// checkKeystone checks that at least one of the Keystone endpoints can be reached.
+func (k *Auth) checkKeystone(ctx context.Context) error {
+	keystoner, ok := k.authn.keystoner.(*Keystoner)
+	if !ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readyzKeystoneTimeout)
+	defer cancel()
+
+	var errs []error
+	for _, e := range keystoner.endpoints {
+		err := e.check(ctx)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %v", e.url, err))
+	}
+
+	return fmt.Errorf("no Keystone endpoint can be reached: %v", errors.Join(errs...))
+}
+
+// checkPolicies checks that the last update of the policy ConfigMap could be parsed. The policy
+// file is parsed at startup, and the errors of the KeystoneAuthorizationPolicy objects are
+// reported in their status instead.
+func (k *Auth) checkPolicies(_ context.Context) error {
+	k.authz.mu.Lock()
+	defer k.authz.mu.Unlock()
+
+	return k.authz.parseErr
+}
+
+// serveHealth serves the health endpoints over HTTP on the address, without the client
+// certificates the webhook listener may require.
+func serveHealth(address string, k *Auth) {
+	mux := http.NewServeMux()
+	k.installHealthHandlers(mux)
+
+	klog.Infof("Serving health checks on %s", address)
+
+	if err := http.ListenAndServe(address, mux); err != nil {
+		klog.Fatalf("failed to listen & serve health checks on %s: %v", address, err)
+	}
+}
+
+func (k *Auth) installHealthHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", healthz)
+	mux.HandleFunc("/readyz", k.readyz)
+}
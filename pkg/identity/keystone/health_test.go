@@ -0,0 +1,78 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystone
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+)
+
+func TestHealthz(t *testing.T) {
+	w := httptest.NewRecorder()
+	healthz(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	th.AssertEquals(t, http.StatusOK, w.Code)
+	th.AssertEquals(t, "ok", w.Body.String())
+}
+
+func TestReadyz(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+
+	server1, endpoint1 := newFakeKeystone(t, &status)
+	server2, endpoint2 := newFakeKeystone(t, &status)
+
+	k := &Auth{
+		authn: &Authenticator{keystoner: &Keystoner{endpoints: []*keystoneEndpoint{endpoint1, endpoint2}}},
+		authz: &Authorizer{},
+	}
+
+	readyz := func() (int, string) {
+		w := httptest.NewRecorder()
+		k.readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return w.Code, w.Body.String()
+	}
+
+	code, body := readyz()
+	th.AssertEquals(t, http.StatusOK, code)
+	th.AssertEquals(t, "[+]keystone ok\n[+]policy ok\n", body)
+
+	// Ready as long as one of the endpoints can be reached
+	server1.Close()
+	code, _ = readyz()
+	th.AssertEquals(t, http.StatusOK, code)
+
+	server2.Close()
+	code, body = readyz()
+	th.AssertEquals(t, http.StatusServiceUnavailable, code)
+	if !strings.HasPrefix(body, "[-]keystone failed: no Keystone endpoint can be reached") {
+		t.Errorf("unexpected body %q", body)
+	}
+
+	// The unparsable policies make the webhook unready too
+	k.authn.keystoner = &MockIKeystone{}
+	k.authz.parseErr = fmt.Errorf("failed to parse policies")
+	code, body = readyz()
+	th.AssertEquals(t, http.StatusServiceUnavailable, code)
+	th.AssertEquals(t, "[+]keystone ok\n[-]policy failed: failed to parse policies\n", body)
+}
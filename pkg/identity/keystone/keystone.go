@@ -37,6 +37,8 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 	k8suser "k8s.io/apiserver/pkg/authentication/user"
 	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	corelisters "k8s.io/client-go/listers/core/v1"
@@ -44,7 +46,9 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 	certutil "k8s.io/client-go/util/cert"
 	"k8s.io/client-go/util/workqueue"
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
 	"k8s.io/cloud-provider-openstack/pkg/version"
+	"k8s.io/component-base/metrics/legacyregistry"
 	"k8s.io/klog/v2"
 )
 
@@ -56,8 +60,40 @@ const (
 	ProjectName = "alpha.kubernetes.io/identity/project/name"
 	DomainID    = "alpha.kubernetes.io/identity/user/domain/id"
 	DomainName  = "alpha.kubernetes.io/identity/user/domain/name"
+	// ProjectDomainID is the domain of the project, the project names are only unique within it
+	ProjectDomainID = "alpha.kubernetes.io/identity/project/domain/id"
+	// Scope is one of ScopeProject, ScopeDomain or ScopeSystem
+	Scope = "alpha.kubernetes.io/identity/scope"
+	// ScopeDomainID and ScopeDomainName are set for the domain-scoped tokens
+	ScopeDomainID   = "alpha.kubernetes.io/identity/domain/id"
+	ScopeDomainName = "alpha.kubernetes.io/identity/domain/name"
+	// System is set for the system-scoped tokens, e.g. to "all"
+	System = "alpha.kubernetes.io/identity/system"
+	// IdentityProvider, FederationProtocol and FederationGroups are set for the users
+	// authenticated through Keystone federation, FederationGroups to the IDs of the groups
+	IdentityProvider   = "alpha.kubernetes.io/identity/federation/identity-provider"
+	FederationProtocol = "alpha.kubernetes.io/identity/federation/protocol"
+	FederationGroups   = "alpha.kubernetes.io/identity/federation/groups"
+	// TrustID and TrustorID are set for the trust-scoped tokens, TrustorID to the ID of the user
+	// who delegated their roles to the trustee
+	TrustID   = "alpha.kubernetes.io/identity/trust/id"
+	TrustorID = "alpha.kubernetes.io/identity/trust/trustor-id"
 )
 
+// userAttributes maps the attributes of the users, which the group templates and the
+// --user-extra-fields flag refer to, to the keys of the user extra fields holding them
+var userAttributes = map[string]string{
+	"project_id":        ProjectID,
+	"project_name":      ProjectName,
+	"project_domain_id": ProjectDomainID,
+	"domain_id":         DomainID,
+	"domain_name":       DomainName,
+	"roles":             Roles,
+
+	"identity_provider": IdentityProvider,
+	"protocol":          FederationProtocol,
+}
+
 var userAgentData []string
 
 // AddExtraFlags is called by the main package to add component specific command line flags
@@ -90,11 +126,23 @@ type Auth struct {
 	k8sClient      *kubernetes.Clientset
 	syncer         *Syncer
 	config         *Config
+	tlsConfig      *tls.Config
+	audit          *auditLogger
+	limiter        *requestLimiter
+	deprovisioning *deprovisioningChecker
 	stopCh         chan struct{}
 	queue          workqueue.TypedRateLimitingInterface[any]
 	informer       informers.SharedInformerFactory
 	cmLister       corelisters.ConfigMapLister
 	cmListerSynced cache.InformerSynced
+
+	dynamicClient      dynamic.Interface
+	policyInformer     dynamicinformer.DynamicSharedInformerFactory
+	policyLister       cache.GenericLister
+	policyListerSynced cache.InformerSynced
+	// parsedPolicyCRDs are the last policies parsed from the KeystoneAuthorizationPolicy objects,
+	// by name, kept while their objects fail to parse
+	parsedPolicyCRDs map[string]parsedPolicyCRD
 }
 
 // Run starts the keystone webhook server.
@@ -112,14 +160,68 @@ func (k *Auth) Run() {
 		}
 		klog.Info("ConfigMaps synced and ready")
 
+		if k.policyInformer != nil {
+			go k.policyInformer.Start(k.stopCh)
+
+			if !cache.WaitForCacheSync(k.stopCh, k.policyListerSynced) {
+				runtimeutil.HandleError(fmt.Errorf("timed out waiting for KeystoneAuthorizationPolicy caches to sync"))
+				return
+			}
+			klog.Info("KeystoneAuthorizationPolicies synced and ready")
+		}
+
 		go wait.Until(k.runWorker, time.Second, k.stopCh)
 	}
 
+	if keystoner, ok := k.authn.keystoner.(*Keystoner); ok && len(keystoner.endpoints) > 1 && k.config.KeystoneHealthCheckInterval > 0 {
+		go keystoner.runHealthChecks(k.config.KeystoneHealthCheckInterval, k.stopCh)
+	}
+
+	if k.authn.cache != nil && k.config.TokenRevocationCheckInterval > 0 {
+		go k.authn.cache.runRevocationChecks(k.authn.keystoner, k.config.TokenRevocationCheckInterval, k.stopCh)
+	}
+
+	if k.deprovisioning != nil && k.config.DeprovisioningCheckInterval > 0 {
+		go k.deprovisioning.run(k.config.DeprovisioningCheckInterval, k.stopCh)
+	}
+
+	if k.audit != nil && k.audit.queue != nil {
+		go k.audit.runWebhook(k.stopCh)
+	}
+
+	if k.config.MetricsAddress != "" {
+		metrics.RegisterMetrics("k8s-keystone-auth")
+		go serveMetrics(k.config.MetricsAddress)
+	}
+
+	if k.config.HealthAddress != "" {
+		go serveHealth(k.config.HealthAddress, k)
+	}
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/webhook", k.Handler)
+	k.installHealthHandlers(mux)
+
+	server := &http.Server{
+		Addr:      k.config.Address,
+		Handler:   mux,
+		TLSConfig: k.tlsConfig,
+	}
 
 	klog.Infof("Starting webhook server...")
-	klog.Fatal(http.ListenAndServeTLS(k.config.Address, k.config.CertFile, k.config.KeyFile, mux))
+	klog.Fatal(server.ListenAndServeTLS(k.config.CertFile, k.config.KeyFile))
+}
+
+// serveMetrics serves the metrics on the /metrics path of the given address
+func serveMetrics(address string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", legacyregistry.HandlerWithReset())
+
+	klog.Infof("Serving metrics on %s", address)
+
+	if err := http.ListenAndServe(address, mux); err != nil {
+		klog.Fatalf("failed to listen & serve metrics on %s: %v", address, err)
+	}
 }
 
 func (k *Auth) enqueueConfigMap(obj interface{}) {
@@ -175,8 +277,15 @@ func (k *Auth) updatePolicies(cm *apiv1.ConfigMap, key string) {
 	klog.Info("ConfigMap created or updated, will update the authorization policy.")
 
 	var policy policyList
+	var parseErr error
 	if err := json.Unmarshal([]byte(cm.Data["policies"]), &policy); err != nil {
-		runtimeutil.HandleError(fmt.Errorf("failed to parse policies defined in the configmap %s: %v", key, err))
+		parseErr = fmt.Errorf("failed to parse policies defined in the configmap %s: %v", key, err)
+		runtimeutil.HandleError(parseErr)
+	} else if err := policy.validate(); err != nil {
+		// None of the policies apply, rather than the policies without the invalid ones
+		policy = nil
+		parseErr = fmt.Errorf("invalid policies defined in the configmap %s: %v", key, err)
+		runtimeutil.HandleError(parseErr)
 	}
 	if len(policy) > 0 {
 		if _, err := json.MarshalIndent(policy, "", "  "); err != nil {
@@ -186,6 +295,7 @@ func (k *Auth) updatePolicies(cm *apiv1.ConfigMap, key string) {
 
 	k.authz.mu.Lock()
 	k.authz.pl = policy
+	k.authz.parseErr = parseErr
 	k.authz.mu.Unlock()
 
 	klog.Infof("Authorization policy updated.")
@@ -201,14 +311,16 @@ func (k *Auth) updateSyncConfig(cm *apiv1.ConfigMap, key string) {
 		runtimeutil.HandleError(fmt.Errorf("failed to parse sync config defined in the configmap %s: %v", key, err))
 	}
 
-	k.syncer.mu.Lock()
-	k.syncer.syncConfig = sc
-	k.syncer.mu.Unlock()
+	k.syncer.setSyncConfig(sc)
 
 	klog.Infof("Sync configuration updated.")
 }
 
 func (k *Auth) processItem(key string) error {
+	if key == policyCRDKey {
+		return k.syncPolicyCRDs(context.TODO())
+	}
+
 	namespace, name, err := cache.SplitMetaNamespaceKey(key)
 	if err != nil {
 		return err
@@ -225,10 +337,8 @@ func (k *Auth) processItem(key string) error {
 		}
 		if name == k.config.SyncConfigMapName {
 			klog.Infof("SyncConfigmap %v has been deleted.", k.config.SyncConfigMapName)
-			k.syncer.mu.Lock()
 			sc := newSyncConfig()
-			k.syncer.syncConfig = &sc
-			k.syncer.mu.Unlock()
+			k.syncer.setSyncConfig(&sc)
 		}
 	case err != nil:
 		return fmt.Errorf("error fetching object with key %s: %v", key, err)
@@ -248,10 +358,17 @@ func (k *Auth) processItem(key string) error {
 func (k *Auth) Handler(w http.ResponseWriter, r *http.Request) {
 	ctx := context.TODO()
 	var data map[string]interface{}
+	if k.config != nil && k.config.MaxRequestBodyBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, k.config.MaxRequestBodyBytes)
+	}
 	decoder := json.NewDecoder(r.Body)
 	defer r.Body.Close()
 	err := decoder.Decode(&data)
 	if err != nil {
+		if isRequestBodyTooLarge(err) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -267,6 +384,14 @@ func (k *Auth) Handler(w http.ResponseWriter, r *http.Request) {
 	switch kind {
 	case "TokenReview":
 		var token = data["spec"].(map[string]interface{})["token"].(string)
+		// Only the tokens which are not cached are reviewed by Keystone, and limited per client
+		client := ""
+		if !k.authn.isTokenCached(token) {
+			client = "token:" + tokenHash(token)
+		}
+		if !k.limiter.allowRequest(w, client) {
+			return
+		}
 		userInfo := k.authenticateToken(ctx, w, r, token, data)
 
 		// Do synchronization
@@ -278,6 +403,9 @@ func (k *Auth) Handler(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 	case "SubjectAccessReview":
+		if !k.limiter.allowRequest(w, "") {
+			return
+		}
 		k.authorizeToken(w, r, data)
 	default:
 		http.Error(w, fmt.Sprintf("unknown kind/apiVersion %q %q", kind, apiVersion), http.StatusBadRequest)
@@ -376,25 +504,29 @@ func (k *Auth) authorizeToken(w http.ResponseWriter, r *http.Request, data map[s
 		return
 	}
 
-	var allowed authorizer.Decision
-	if len(k.authz.pl) > 0 {
-		var reason string
-		var err error
-		allowed, reason, err = k.authz.Authorize(attrs)
-		klog.V(4).Infof("<<<< authorizeToken: %v, %v, %v\n", allowed, reason, err)
-		if err != nil {
-			http.Error(w, reason, http.StatusInternalServerError)
-			return
-		}
+	allowed, reason, rule := authorizer.DecisionDeny, "No policy defined.", ""
+	if k.authz.hasPolicies() {
+		allowed, reason, rule = k.authz.authorizeWithRule(attrs)
+		klog.V(4).Infof("<<<< authorizeToken: %v, %v, %v\n", allowed, reason, rule)
 	} else {
 		// The operator didn't set authorization policy, deny by default.
-		allowed = authorizer.DecisionDeny
+		metrics.ObserveKeystoneAuthorization("deny", "")
+	}
+
+	if k.audit != nil {
+		k.audit.log(newAuditEvent(attrs, allowed, reason, rule))
 	}
 
 	delete(data, "spec")
-	data["status"] = map[string]interface{}{
+	status := map[string]interface{}{
 		"allowed": allowed == authorizer.DecisionAllow,
 	}
+	// The operations denied by a deny policy are not left to the other authorizers
+	if allowed == authorizer.DecisionDeny && rule != "" {
+		status["denied"] = true
+		status["reason"] = reason
+	}
+	data["status"] = status
 	output, err := json.MarshalIndent(data, "", "  ")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -407,13 +539,28 @@ func (k *Auth) authorizeToken(w http.ResponseWriter, r *http.Request, data map[s
 
 // NewKeystoneAuth returns a new KeystoneAuth controller
 func NewKeystoneAuth(ctx context.Context, c *Config) (*Auth, error) {
-	keystoneClient, err := createKeystoneClient(ctx, c.KeystoneURL, c.KeystoneCA)
+	endpoints := []*keystoneEndpoint{{url: c.KeystoneURL, caFile: c.KeystoneCA}}
+	for _, s := range c.KeystoneFailoverURLs {
+		endpoints = append(endpoints, parseKeystoneEndpoint(s))
+	}
+
+	keystoner, err := newFailoverKeystoner(ctx, endpoints)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize keystone client: %v", err)
 	}
 
+	tlsConfig, err := newServerTLSConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	audit, err := newAuditLogger(c)
+	if err != nil {
+		return nil, err
+	}
+
 	var k8sClient *kubernetes.Clientset
-	if c.PolicyConfigMapName != "" || c.SyncConfigMapName != "" || c.SyncConfigFile != "" {
+	if c.PolicyConfigMapName != "" || c.PolicyCRD || c.SyncConfigMapName != "" || c.SyncConfigFile != "" {
 		k8sClient, err = createKubernetesClient(c.Kubeconfig)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get kubernetes client: %v", err)
@@ -433,6 +580,9 @@ func NewKeystoneAuth(ctx context.Context, c *Config) (*Auth, error) {
 		if err := json.Unmarshal([]byte(cm.Data["policies"]), &policy); err != nil {
 			return nil, fmt.Errorf("failed to parse policies defined in the configmap %s: %v", c.PolicyConfigMapName, err)
 		}
+		if err := policy.validate(); err != nil {
+			return nil, fmt.Errorf("invalid policies defined in the configmap %s: %v", c.PolicyConfigMapName, err)
+		}
 	}
 	if c.PolicyFile != "" {
 		policy, err = newFromFile(c.PolicyFile)
@@ -482,13 +632,39 @@ func NewKeystoneAuth(ctx context.Context, c *Config) (*Auth, error) {
 		}
 	}
 
+	authn := &Authenticator{keystoner: keystoner, acceptNonProjectScopes: c.AcceptNonProjectScopes, skipGroupLookup: !c.GroupLookup, extraFields: c.UserExtraFields}
+	if c.TokenCacheTTL > 0 {
+		authn.cache = newTokenCache(c.TokenCacheTTL)
+	}
+	if c.GroupLookup && c.GroupCacheTTL > 0 {
+		authn.groupCache = newGroupCache(c.GroupCacheTTL)
+	}
+
+	var deprovisioning *deprovisioningChecker
+	if c.DeprovisioningCloudConfig != "" && (authn.cache != nil || authn.groupCache != nil) {
+		deprovisioning, err = newDeprovisioningChecker(c.DeprovisioningCloudConfig, authn.cache, authn.groupCache)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	syncer := &Syncer{syncConfig: sc}
+	if k8sClient != nil {
+		// A nil *kubernetes.Clientset would make a non-nil kubernetes.Interface
+		syncer.k8sClient = k8sClient
+	}
+
 	keystoneAuth := &Auth{
-		authn:     &Authenticator{keystoner: NewKeystoner(keystoneClient)},
-		authz:     &Authorizer{authURL: c.KeystoneURL, client: keystoneClient, pl: policy},
-		syncer:    &Syncer{k8sClient: k8sClient, syncConfig: sc},
-		k8sClient: k8sClient,
-		config:    c,
-		stopCh:    make(chan struct{}),
+		authn:          authn,
+		authz:          &Authorizer{authURL: c.KeystoneURL, pl: policy},
+		syncer:         syncer,
+		k8sClient:      k8sClient,
+		config:         c,
+		tlsConfig:      tlsConfig,
+		audit:          audit,
+		limiter:        newRequestLimiter(c),
+		deprovisioning: deprovisioning,
+		stopCh:         make(chan struct{}),
 	}
 
 	if k8sClient != nil {
@@ -517,6 +693,12 @@ func NewKeystoneAuth(ctx context.Context, c *Config) (*Auth, error) {
 		keystoneAuth.cmLister = cmInformer.Lister()
 		keystoneAuth.cmListerSynced = cmInformer.Informer().HasSynced
 		keystoneAuth.queue = queue
+
+		if c.PolicyCRD {
+			if err := keystoneAuth.setupPolicyInformer(c.Kubeconfig); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return keystoneAuth, nil
@@ -0,0 +1,208 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystone
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// keystoneHealthCheckTimeout is the timeout of the health checks of the Keystone endpoints
+const keystoneHealthCheckTimeout = 10 * time.Second
+
+// keystoneEndpoint is one of the Keystone endpoints the webhook fails over between. The client is
+// nil until the endpoint could be reached.
+type keystoneEndpoint struct {
+	url    string
+	caFile string
+
+	mu      sync.RWMutex
+	client  *gophercloud.ServiceClient
+	healthy bool
+}
+
+// parseKeystoneEndpoint parses a Keystone endpoint of the --keystone-failover-url flag, i.e. its
+// URL optionally followed by a comma and the file containing its certificate authority.
+func parseKeystoneEndpoint(s string) *keystoneEndpoint {
+	url, caFile, _ := strings.Cut(s, ",")
+	return &keystoneEndpoint{url: url, caFile: caFile}
+}
+
+func (e *keystoneEndpoint) getClient() *gophercloud.ServiceClient {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.client
+}
+
+func (e *keystoneEndpoint) isHealthy() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.healthy
+}
+
+func (e *keystoneEndpoint) setHealthy(healthy bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.healthy != healthy {
+		if healthy {
+			klog.Infof("Keystone endpoint %s is healthy", e.url)
+		} else {
+			klog.Warningf("Keystone endpoint %s is unhealthy", e.url)
+		}
+	}
+	e.healthy = healthy
+}
+
+// connect creates the client of the endpoint if it doesn't exist yet.
+func (e *keystoneEndpoint) connect(ctx context.Context) error {
+	if e.getClient() != nil {
+		return nil
+	}
+
+	client, err := createKeystoneClient(ctx, e.url, e.caFile)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.client = client
+	e.mu.Unlock()
+
+	return nil
+}
+
+// check checks that the endpoint answers its version discovery request without a server error,
+// connecting to it first if needed.
+func (e *keystoneEndpoint) check(ctx context.Context) error {
+	if err := e.connect(ctx); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.getClient().HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// newFailoverKeystoner connects to the Keystone endpoints, which are tried in order. It fails if
+// none of them can be reached, the other ones are connected to by the health checks.
+func newFailoverKeystoner(ctx context.Context, endpoints []*keystoneEndpoint) (*Keystoner, error) {
+	var errs []error
+	for _, e := range endpoints {
+		if err := e.connect(ctx); err != nil {
+			klog.Warningf("Failed to connect to Keystone endpoint %s: %v", e.url, err)
+			errs = append(errs, err)
+			continue
+		}
+		e.setHealthy(true)
+	}
+
+	if len(errs) == len(endpoints) {
+		return nil, errors.Join(errs...)
+	}
+
+	return &Keystoner{endpoints: endpoints}, nil
+}
+
+// call calls f with the client of the first healthy endpoint, and fails over to the next endpoints
+// while the endpoint can't be reached or fails with a server error. The unhealthy endpoints are
+// tried last.
+func (k *Keystoner) call(ctx context.Context, f func(client *gophercloud.ServiceClient) error) error {
+	var healthy, unhealthy []*keystoneEndpoint
+	for _, e := range k.endpoints {
+		if e.isHealthy() {
+			healthy = append(healthy, e)
+		} else {
+			unhealthy = append(unhealthy, e)
+		}
+	}
+
+	err := errors.New("no Keystone endpoint can be reached")
+	for _, e := range append(healthy, unhealthy...) {
+		client := e.getClient()
+		if client == nil {
+			continue
+		}
+
+		err = f(client)
+		if !isEndpointFailure(err) || ctx.Err() != nil {
+			if err == nil && len(k.endpoints) > 1 {
+				e.setHealthy(true)
+			}
+			return err
+		}
+
+		if len(k.endpoints) > 1 {
+			klog.Warningf("Keystone endpoint %s failed, failing over to the next endpoint: %v", e.url, err)
+			e.setHealthy(false)
+		}
+	}
+
+	return err
+}
+
+// isEndpointFailure reports whether the error is caused by the endpoint rather than by the
+// request, i.e. the endpoint can't be reached or fails with a server error.
+func isEndpointFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var respErr gophercloud.ErrUnexpectedResponseCode
+	if errors.As(err, &respErr) {
+		return respErr.Actual >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// runHealthChecks checks the health of the endpoints every interval until stopCh is closed, so
+// that the requests fail back to the first healthy endpoint.
+func (k *Keystoner) runHealthChecks(interval time.Duration, stopCh <-chan struct{}) {
+	wait.Until(func() {
+		for _, e := range k.endpoints {
+			ctx, cancel := context.WithTimeout(context.Background(), keystoneHealthCheckTimeout)
+			err := e.check(ctx)
+			cancel()
+
+			if err != nil {
+				klog.V(4).Infof("Health check of Keystone endpoint %s failed: %v", e.url, err)
+			}
+			e.setHealthy(err == nil)
+		}
+	}, interval, stopCh)
+}
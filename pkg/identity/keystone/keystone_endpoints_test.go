@@ -0,0 +1,126 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystone
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack"
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+)
+
+const testTokenBody = `{"token": {
+	"expires_at": "2030-01-01T00:00:00.000000Z",
+	"user": {"id": "user-id", "name": "user", "domain": {"id": "default", "name": "Default"}},
+	"roles": [{"id": "role-id", "name": "member"}],
+	"project": {"id": "project-id", "name": "demo", "domain": {"id": "default"}}
+}}`
+
+// newFakeKeystone returns a Keystone server answering the token requests with the status code, and
+// the version discovery requests with 200 OK
+func newFakeKeystone(t *testing.T, status *atomic.Int32) (*httptest.Server, *keystoneEndpoint) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v3/auth/tokens" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(int(status.Load()))
+		if status.Load() == http.StatusOK {
+			fmt.Fprint(w, testTokenBody)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	provider, err := openstack.NewClient(server.URL + "/v3")
+	th.AssertNoErr(t, err)
+	client := &gophercloud.ServiceClient{ProviderClient: provider, Endpoint: server.URL + "/v3/"}
+
+	return server, &keystoneEndpoint{url: server.URL + "/v3", client: client, healthy: true}
+}
+
+func TestKeystonerFailover(t *testing.T) {
+	var status1, status2 atomic.Int32
+	status1.Store(http.StatusServiceUnavailable)
+	status2.Store(http.StatusOK)
+
+	_, endpoint1 := newFakeKeystone(t, &status1)
+	_, endpoint2 := newFakeKeystone(t, &status2)
+	k := &Keystoner{endpoints: []*keystoneEndpoint{endpoint1, endpoint2}}
+
+	// The first endpoint fails with a server error
+	info, err := k.GetTokenInfo(context.Background(), "token")
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "user-id", info.userID)
+	th.AssertEquals(t, false, endpoint1.isHealthy())
+	th.AssertEquals(t, true, endpoint2.isHealthy())
+
+	// The unhealthy endpoint is tried last
+	status1.Store(http.StatusOK)
+	status2.Store(http.StatusNotFound)
+	_, err = k.GetTokenInfo(context.Background(), "token")
+	th.AssertEquals(t, true, err != nil)
+	th.AssertEquals(t, true, endpoint2.isHealthy())
+
+	// until it passes a health check
+	th.AssertNoErr(t, endpoint1.check(context.Background()))
+	endpoint1.setHealthy(true)
+	info, err = k.GetTokenInfo(context.Background(), "token")
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "user-id", info.userID)
+}
+
+func TestKeystonerFailoverUnreachable(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+
+	server1, endpoint1 := newFakeKeystone(t, &status)
+	_, endpoint2 := newFakeKeystone(t, &status)
+	server1.Close()
+
+	k := &Keystoner{endpoints: []*keystoneEndpoint{endpoint1, endpoint2}}
+
+	info, err := k.GetTokenInfo(context.Background(), "token")
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "user-id", info.userID)
+	th.AssertEquals(t, false, endpoint1.isHealthy())
+	th.AssertEquals(t, true, endpoint1.check(context.Background()) != nil)
+}
+
+func TestIsEndpointFailure(t *testing.T) {
+	th.AssertEquals(t, false, isEndpointFailure(nil))
+	th.AssertEquals(t, false, isEndpointFailure(gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusNotFound}))
+	th.AssertEquals(t, true, isEndpointFailure(gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusBadGateway}))
+	th.AssertEquals(t, true, isEndpointFailure(fmt.Errorf("connection refused")))
+}
+
+func TestParseKeystoneEndpoint(t *testing.T) {
+	e := parseKeystoneEndpoint("https://keystone-2:5000/v3,/etc/ca.crt")
+	th.AssertEquals(t, "https://keystone-2:5000/v3", e.url)
+	th.AssertEquals(t, "/etc/ca.crt", e.caFile)
+
+	e = parseKeystoneEndpoint("https://keystone-2:5000/v3")
+	th.AssertEquals(t, "https://keystone-2:5000/v3", e.url)
+	th.AssertEquals(t, "", e.caFile)
+}
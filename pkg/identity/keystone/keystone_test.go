@@ -77,6 +77,10 @@ func (m *mockKeystoner) GetGroups(ctx context.Context, token string, userID stri
 	return nil, fmt.Errorf("invalid token")
 }
 
+func (m *mockKeystoner) ValidateToken(ctx context.Context, token string) (bool, error) {
+	return false, nil
+}
+
 func TestWebhookRouting(t *testing.T) {
 	// Create a minimal Auth instance for testing
 	auth := &Auth{
@@ -0,0 +1,104 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystone
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestAuthenticationMetrics(t *testing.T) {
+	metrics.RegisterMetrics("k8s-keystone-auth")
+
+	keystone := &MockIKeystone{}
+	keystone.
+		On("GetTokenInfo", "token").
+		Return(&tokenInfo{userName: "user-name", userID: "user-id", projectID: "project-id", expiresAt: time.Now().Add(time.Hour)}, nil).
+		Once()
+	keystone.
+		On("GetGroups", "token", "user-id").
+		Return([]string{"group1"}, nil).
+		Once()
+	keystone.
+		On("GetTokenInfo", "invalid").
+		Return(nil, errors.New("token not found")).
+		Once()
+
+	a := &Authenticator{keystoner: keystone, cache: newTokenCache(time.Minute)}
+
+	for _, token := range []string{"token", "token", "invalid"} {
+		_, _, _ = a.AuthenticateToken(context.Background(), token)
+	}
+
+	expected := `
+# HELP keystone_auth_authentications_total [ALPHA] Total number of token authentications served by k8s-keystone-auth, by result
+# TYPE keystone_auth_authentications_total counter
+keystone_auth_authentications_total{result="failure"} 1
+keystone_auth_authentications_total{result="success"} 2
+# HELP keystone_auth_token_cache_lookups_total [ALPHA] Total number of lookups of the tokens in the token cache of k8s-keystone-auth, by result
+# TYPE keystone_auth_token_cache_lookups_total counter
+keystone_auth_token_cache_lookups_total{result="hit"} 1
+keystone_auth_token_cache_lookups_total{result="miss"} 2
+`
+	if err := testutil.GatherAndCompare(legacyregistry.DefaultGatherer, strings.NewReader(expected), "keystone_auth_authentications_total", "keystone_auth_token_cache_lookups_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAuthorizationMetrics(t *testing.T) {
+	metrics.RegisterMetrics("k8s-keystone-auth")
+
+	apiGroup, namespace := "*", "*"
+	a := &Authorizer{
+		pl: policyList{
+			{NonResourceSpec: &nonResourcePolicySpec{Verbs: []string{"get"}, NonResourcePath: &namespace}, Match: []policyMatch{{Type: TypeUser, Values: []string{"*"}}}},
+		},
+		crdPolicies: policyList{
+			{name: "pod-viewers/0", ResourceSpec: &resourcePolicySpec{Verbs: []string{"get"}, Resources: []string{"pods"}, APIGroup: &apiGroup, Namespace: &namespace}, Match: []policyMatch{{Type: TypeUser, Values: []string{"*"}}}},
+		},
+	}
+
+	u := &user.DefaultInfo{Name: "user", Extra: map[string][]string{Roles: {"member"}}}
+	for _, attrs := range []authorizer.AttributesRecord{
+		{User: u, Verb: "get", Path: "/healthz"},
+		{User: u, ResourceRequest: true, Verb: "get", Namespace: "default", Resource: "pods"},
+		{User: u, ResourceRequest: true, Verb: "delete", Namespace: "default", Resource: "pods"},
+		{User: &user.DefaultInfo{Name: "anonymous"}, ResourceRequest: true, Verb: "get", Namespace: "default", Resource: "pods"},
+	} {
+		_, _, _ = a.Authorize(attrs)
+	}
+
+	expected := `
+# HELP keystone_auth_authorizations_total [ALPHA] Total number of authorization decisions of k8s-keystone-auth, by decision and by policy rule which allowed or denied the request
+# TYPE keystone_auth_authorizations_total counter
+keystone_auth_authorizations_total{decision="allow",policy="0"} 1
+keystone_auth_authorizations_total{decision="allow",policy="pod-viewers/0"} 1
+keystone_auth_authorizations_total{decision="deny",policy=""} 2
+`
+	if err := testutil.GatherAndCompare(legacyregistry.DefaultGatherer, strings.NewReader(expected), "keystone_auth_authorizations_total"); err != nil {
+		t.Error(err)
+	}
+}
@@ -58,3 +58,24 @@ func (_m *MockIKeystone) GetTokenInfo(_ context.Context, _a0 string) (*tokenInfo
 
 	return r0, r1
 }
+
+// ValidateToken provides a mock function with given fields: _a0
+func (_m *MockIKeystone) ValidateToken(_ context.Context, _a0 string) (bool, error) {
+	ret := _m.Called(_a0)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(string) bool); ok {
+		r0 = rf(_a0)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(_a0)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
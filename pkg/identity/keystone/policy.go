@@ -19,7 +19,9 @@ package keystone
 import (
 	"bufio"
 	"encoding/json"
+	"fmt"
 	"os"
+	"sort"
 )
 
 type policy struct {
@@ -34,6 +36,17 @@ type policy struct {
 	NonResourcePermissionsSpec map[string][]string `json:"nonresource_permissions,omitempty"`
 
 	Users map[string][]string `json:"users"`
+
+	// Effect is EffectAllow or EffectDeny, EffectAllow if empty
+	Effect string `json:"effect,omitempty"`
+
+	// Priority orders the evaluation of the policies, the policies with a higher priority are
+	// evaluated first
+	Priority int `json:"priority,omitempty"`
+
+	// name identifies the policy in the metrics, it is set for the policies of the
+	// KeystoneAuthorizationPolicy objects
+	name string
 }
 
 // Supported types for policy match.
@@ -42,8 +55,21 @@ const (
 	TypeGroup   string = "group"
 	TypeProject string = "project"
 	TypeRole    string = "role"
+	// The identity provider and the protocol of the users authenticated through Keystone federation
+	TypeIdentityProvider string = "identity_provider"
+	TypeProtocol         string = "protocol"
+	// The trust of the trust-scoped tokens
+	TypeTrust string = "trust"
 )
 
+// Supported effects of a policy.
+const (
+	EffectAllow string = "allow"
+	EffectDeny  string = "deny"
+)
+
+var policyMatchTypes = []string{TypeGroup, TypeProject, TypeRole, TypeUser, TypeIdentityProvider, TypeProtocol, TypeTrust}
+
 type policyMatch struct {
 	Type string `json:"type"`
 
@@ -79,8 +105,68 @@ type nonResourcePolicySpec struct {
 	NonResourcePath *string `json:"path"`
 }
 
+// isDeny returns true if the policy denies the requests it matches.
+func (p *policy) isDeny() bool {
+	return p.Effect == EffectDeny
+}
+
+// hasValidEffect returns true if the effect of the policy is supported.
+func (p *policy) hasValidEffect() bool {
+	return p.Effect == "" || p.Effect == EffectAllow || p.Effect == EffectDeny
+}
+
 type policyList []*policy
 
+// evaluationOrder returns the indexes of the policies in the order they are evaluated: by
+// descending priority, the deny policies before the allow policies of the same priority, then
+// in the order they are defined.
+func (pl policyList) evaluationOrder() []int {
+	order := make([]int, len(pl))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		p, q := pl[order[i]], pl[order[j]]
+		if p.Priority != q.Priority {
+			return p.Priority > q.Priority
+		}
+		return p.isDeny() && !q.isDeny()
+	})
+
+	return order
+}
+
+// validateEvaluation checks that the authorizer can evaluate the policy as written: that its effect
+// is supported, so that e.g. a deny policy with a misspelled effect is rejected rather than skipped,
+// and that its resource has the fields the authorizer dereferences.
+func (p *policy) validateEvaluation() error {
+	if p.ResourceSpec != nil && (p.ResourceSpec.APIGroup == nil || p.ResourceSpec.Namespace == nil) {
+		return fmt.Errorf("resource requires version and namespace")
+	}
+
+	if !p.hasValidEffect() {
+		return fmt.Errorf("unsupported effect %q", p.Effect)
+	}
+
+	return nil
+}
+
+// validate checks the policies of the policy file or ConfigMap. The policies which never match,
+// e.g. with an unknown match type, are still accepted like they always were, unlike in the
+// KeystoneAuthorizationPolicy objects.
+func (pl policyList) validate() error {
+	for i, p := range pl {
+		if p == nil {
+			return fmt.Errorf("policy %d: empty policy", i)
+		}
+		if err := p.validateEvaluation(); err != nil {
+			return fmt.Errorf("policy %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
 // newFromFile loads a list of policies from a file
 func newFromFile(path string) (policyList, error) {
 	file, err := os.Open(path)
@@ -97,5 +183,8 @@ func newFromFile(path string) (policyList, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := data.validate(); err != nil {
+		return nil, err
+	}
 	return data, nil
 }
@@ -0,0 +1,260 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystone
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// policyCRDKey is the work queue key of the KeystoneAuthorizationPolicy objects, which are
+	// reloaded all at once
+	policyCRDKey = "keystoneauthorizationpolicies"
+
+	policyConditionReady = "Ready"
+)
+
+var policyGVR = schema.GroupVersionResource{
+	Group:    "keystone.openstack.org",
+	Version:  "v1alpha1",
+	Resource: "keystoneauthorizationpolicies",
+}
+
+// policyCRDSpec is the spec of a KeystoneAuthorizationPolicy object.
+type policyCRDSpec struct {
+	Policies []json.RawMessage `json:"policies"`
+}
+
+// policyCRDStatus is the status of a KeystoneAuthorizationPolicy object.
+type policyCRDStatus struct {
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// setupPolicyInformer sets up the informer of the KeystoneAuthorizationPolicy objects, which
+// reloads the policies on every change.
+func (k *Auth) setupPolicyInformer(kubeConfig string) error {
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeConfig)
+	if err != nil {
+		return fmt.Errorf("failed to get kubernetes config: %v", err)
+	}
+
+	k.dynamicClient, err = dynamic.NewForConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to get kubernetes dynamic client: %v", err)
+	}
+
+	k.policyInformer = dynamicinformer.NewDynamicSharedInformerFactory(k.dynamicClient, time.Minute*5)
+	informer := k.policyInformer.ForResource(policyGVR)
+	_, err = informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: k.enqueuePolicyCRD,
+		UpdateFunc: func(old, new interface{}) {
+			if old.(*unstructured.Unstructured).GetResourceVersion() == new.(*unstructured.Unstructured).GetResourceVersion() {
+				// Periodic resync will send update events for all known objects.
+				return
+			}
+			k.enqueuePolicyCRD(new)
+		},
+		DeleteFunc: k.enqueuePolicyCRD,
+	})
+	if err != nil {
+		return fmt.Errorf("add event handler failed: %w", err)
+	}
+
+	k.policyLister = informer.Lister()
+	k.policyListerSynced = informer.Informer().HasSynced
+
+	return nil
+}
+
+func (k *Auth) enqueuePolicyCRD(obj interface{}) {
+	k.queue.Add(policyCRDKey)
+}
+
+// parsedPolicyCRD are the policies parsed from a KeystoneAuthorizationPolicy object
+type parsedPolicyCRD struct {
+	uid      types.UID
+	policies policyList
+}
+
+// syncPolicyCRDs reloads the policies of all the KeystoneAuthorizationPolicy objects, ordered by
+// name. The objects which fail to parse keep the policies last parsed from them, if any, and their
+// Ready condition records the error.
+func (k *Auth) syncPolicyCRDs(ctx context.Context) error {
+	objs, err := k.policyLister.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list KeystoneAuthorizationPolicy objects: %v", err)
+	}
+
+	slices.SortFunc(objs, func(a, b runtime.Object) int {
+		return strings.Compare(a.(*unstructured.Unstructured).GetName(), b.(*unstructured.Unstructured).GetName())
+	})
+
+	var policies policyList
+	var statusErr error
+	parsed := make(map[string]parsedPolicyCRD, len(objs))
+
+	for _, o := range objs {
+		obj := o.(*unstructured.Unstructured)
+
+		pl, err := parsePolicyCRD(obj)
+		if err != nil {
+			// the policies of a recreated object are not kept
+			if last, ok := k.parsedPolicyCRDs[obj.GetName()]; ok && last.uid == obj.GetUID() {
+				klog.Errorf("Failed to parse the policies of KeystoneAuthorizationPolicy %s, keeping its last policies: %v", obj.GetName(), err)
+				parsed[obj.GetName()] = last
+				policies = append(policies, last.policies...)
+			} else {
+				klog.Errorf("Failed to parse the policies of KeystoneAuthorizationPolicy %s: %v", obj.GetName(), err)
+			}
+		} else {
+			parsed[obj.GetName()] = parsedPolicyCRD{uid: obj.GetUID(), policies: pl}
+			policies = append(policies, pl...)
+		}
+
+		if err := k.updatePolicyCRDStatus(ctx, obj, err); err != nil {
+			statusErr = err
+		}
+	}
+
+	k.parsedPolicyCRDs = parsed
+	k.authz.mu.Lock()
+	k.authz.crdPolicies = policies
+	k.authz.mu.Unlock()
+
+	klog.Infof("Authorization policy updated from %d KeystoneAuthorizationPolicy objects.", len(objs))
+
+	return statusErr
+}
+
+// parsePolicyCRD returns the policies of a KeystoneAuthorizationPolicy object. The policies
+// have the same format as the ones of the policy file.
+func parsePolicyCRD(obj *unstructured.Unstructured) (policyList, error) {
+	data, err := json.Marshal(obj.Object["spec"])
+	if err != nil {
+		return nil, err
+	}
+
+	var spec policyCRDSpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("invalid spec: %v", err)
+	}
+
+	var pl policyList
+	for i, raw := range spec.Policies {
+		var p policy
+
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&p); err != nil {
+			return nil, fmt.Errorf("policy %d: %v", i, err)
+		}
+
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("policy %d: %v", i, err)
+		}
+
+		p.name = fmt.Sprintf("%s/%d", obj.GetName(), i)
+		pl = append(pl, &p)
+	}
+
+	return pl, nil
+}
+
+// validate checks that the policy grants a permission, has the fields the authorizer requires and
+// only matches the supported types.
+func (p *policy) validate() error {
+	if p.ResourceSpec == nil && p.NonResourceSpec == nil && p.ResourcePermissionsSpec == nil && p.NonResourcePermissionsSpec == nil {
+		return fmt.Errorf("one of resource, nonresource, resource_permissions or nonresource_permissions is required")
+	}
+
+	if err := p.validateEvaluation(); err != nil {
+		return err
+	}
+
+	if p.NonResourceSpec != nil && p.NonResourceSpec.NonResourcePath == nil {
+		return fmt.Errorf("nonresource requires path")
+	}
+
+	for _, m := range p.Match {
+		if !slices.Contains(policyMatchTypes, m.Type) {
+			return fmt.Errorf("unsupported match type %q", m.Type)
+		}
+	}
+
+	return nil
+}
+
+// updatePolicyCRDStatus sets the Ready condition of a KeystoneAuthorizationPolicy object
+// according to its parse error, if it changed.
+func (k *Auth) updatePolicyCRDStatus(ctx context.Context, obj *unstructured.Unstructured, parseErr error) error {
+	var status policyCRDStatus
+	if s, ok := obj.UnstructuredContent()["status"].(map[string]interface{}); ok {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(s, &status); err != nil {
+			klog.Warningf("Ignoring the invalid status of KeystoneAuthorizationPolicy %s: %v", obj.GetName(), err)
+		}
+	}
+
+	condition := metav1.Condition{
+		Type:               policyConditionReady,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: obj.GetGeneration(),
+		Reason:             "Loaded",
+		Message:            "The policies are loaded",
+	}
+	if parseErr != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "ParseError"
+		condition.Message = parseErr.Error()
+	}
+
+	if !meta.SetStatusCondition(&status.Conditions, condition) {
+		return nil
+	}
+
+	s, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return err
+	}
+
+	obj = obj.DeepCopy()
+	obj.Object["status"] = s
+
+	if _, err := k.dynamicClient.Resource(policyGVR).UpdateStatus(ctx, obj, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update the status of KeystoneAuthorizationPolicy %s: %v", obj.GetName(), err)
+	}
+
+	return nil
+}
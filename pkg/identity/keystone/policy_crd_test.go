@@ -0,0 +1,134 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystone
+
+import (
+	"context"
+	"testing"
+
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newPolicyCRD(name string, policies ...interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": policyGVR.GroupVersion().String(),
+		"kind":       "KeystoneAuthorizationPolicy",
+		"metadata":   map[string]interface{}{"name": name, "generation": int64(1)},
+		"spec":       map[string]interface{}{"policies": policies},
+	}}
+}
+
+func TestParsePolicyCRD(t *testing.T) {
+	pl, err := parsePolicyCRD(newPolicyCRD("valid", map[string]interface{}{
+		"users":                map[string]interface{}{"projects": []interface{}{"demo"}, "roles": []interface{}{"member"}},
+		"resource_permissions": map[string]interface{}{"*/pods": []interface{}{"get", "list"}},
+	}))
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, 1, len(pl))
+	th.AssertDeepEquals(t, []string{"get", "list"}, pl[0].ResourcePermissionsSpec["*/pods"])
+	th.AssertEquals(t, "valid/0", pl[0].name)
+
+	_, err = parsePolicyCRD(newPolicyCRD("unknown-field", map[string]interface{}{
+		"resource_permission": map[string]interface{}{"*/pods": []interface{}{"get"}},
+	}))
+	th.AssertEquals(t, `policy 0: json: unknown field "resource_permission"`, err.Error())
+
+	_, err = parsePolicyCRD(newPolicyCRD("no-permission", map[string]interface{}{
+		"users": map[string]interface{}{"projects": []interface{}{"demo"}},
+	}))
+	th.AssertEquals(t, "policy 0: one of resource, nonresource, resource_permissions or nonresource_permissions is required", err.Error())
+
+	_, err = parsePolicyCRD(newPolicyCRD("unknown-match", map[string]interface{}{
+		"resource": map[string]interface{}{"verbs": []interface{}{"get"}, "resources": []interface{}{"pods"}},
+		"match":    []interface{}{map[string]interface{}{"type": "domain", "values": []interface{}{"default"}}},
+	}))
+	th.AssertEquals(t, "policy 0: resource requires version and namespace", err.Error())
+
+	_, err = parsePolicyCRD(newPolicyCRD("unknown-match", map[string]interface{}{
+		"resource": map[string]interface{}{"verbs": []interface{}{"get"}, "resources": []interface{}{"pods"}, "version": "*", "namespace": "*"},
+		"match":    []interface{}{map[string]interface{}{"type": "domain", "values": []interface{}{"default"}}},
+	}))
+	th.AssertEquals(t, `policy 0: unsupported match type "domain"`, err.Error())
+
+	_, err = parsePolicyCRD(newPolicyCRD("unknown-effect", map[string]interface{}{
+		"resource_permissions": map[string]interface{}{"*/pods": []interface{}{"get"}},
+		"effect":               "reject",
+	}))
+	th.AssertEquals(t, `policy 0: unsupported effect "reject"`, err.Error())
+}
+
+func TestSyncPolicyCRDs(t *testing.T) {
+	valid := newPolicyCRD("valid", map[string]interface{}{
+		"users":                map[string]interface{}{"projects": []interface{}{"demo"}, "roles": []interface{}{"member"}},
+		"resource_permissions": map[string]interface{}{"*/pods": []interface{}{"get"}},
+	})
+	invalid := newPolicyCRD("invalid", map[string]interface{}{})
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), valid, invalid)
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	th.AssertNoErr(t, indexer.Add(valid))
+	th.AssertNoErr(t, indexer.Add(invalid))
+
+	k := &Auth{
+		authz:         &Authorizer{},
+		dynamicClient: dynamicClient,
+		policyLister:  cache.NewGenericLister(indexer, policyGVR.GroupResource()),
+	}
+
+	th.AssertNoErr(t, k.syncPolicyCRDs(context.Background()))
+	th.AssertEquals(t, true, k.authz.hasPolicies())
+
+	u := &user.DefaultInfo{Name: "user", Extra: map[string][]string{ProjectName: {"demo"}, Roles: {"member"}}}
+	decision, _, err := k.authz.Authorize(authorizer.AttributesRecord{User: u, ResourceRequest: true, Verb: "get", Namespace: "default", Resource: "pods"})
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, authorizer.DecisionAllow, decision)
+
+	for name, expected := range map[string]metav1.ConditionStatus{"valid": metav1.ConditionTrue, "invalid": metav1.ConditionFalse} {
+		obj, err := dynamicClient.Resource(policyGVR).Get(context.Background(), name, metav1.GetOptions{})
+		th.AssertNoErr(t, err)
+
+		var status policyCRDStatus
+		th.AssertNoErr(t, runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object["status"].(map[string]interface{}), &status))
+
+		condition := meta.FindStatusCondition(status.Conditions, policyConditionReady)
+		th.AssertEquals(t, expected, condition.Status)
+		th.AssertEquals(t, int64(1), condition.ObservedGeneration)
+	}
+
+	// An object which fails to parse after an update keeps its last policies
+	broken := newPolicyCRD("valid", map[string]interface{}{})
+	th.AssertNoErr(t, indexer.Update(broken))
+	th.AssertNoErr(t, k.syncPolicyCRDs(context.Background()))
+	decision, _, err = k.authz.Authorize(authorizer.AttributesRecord{User: u, ResourceRequest: true, Verb: "get", Namespace: "default", Resource: "pods"})
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, authorizer.DecisionAllow, decision)
+
+	// unless the object was recreated
+	broken.SetUID("recreated")
+	th.AssertNoErr(t, indexer.Update(broken))
+	th.AssertNoErr(t, k.syncPolicyCRDs(context.Background()))
+	th.AssertEquals(t, false, k.authz.hasPolicies())
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystone
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/klog/v2"
+)
+
+// maxClientLimiters bounds the memory used by the per-client rate limiters. The limiter of the
+// client seen the longest ago is evicted for a new client while there are this many clients with a
+// limiter being refilled.
+const maxClientLimiters = 10000
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// requestLimiter limits the rate of the webhook requests of all the clients of the Kubernetes API
+// together, and the rate of the TokenReview requests calling Keystone of every client. The clients
+// are identified by their token, as the kube-apiserver usually sends all the requests. It is nil if
+// neither rate is limited.
+type requestLimiter struct {
+	global *rate.Limiter
+
+	clientLimit rate.Limit
+	clientBurst int
+
+	now func() time.Time
+
+	mu      sync.Mutex
+	clients map[string]*clientLimiter
+}
+
+// newRequestLimiter returns the limiter of the rates of the config, or nil if they are not limited.
+func newRequestLimiter(c *Config) *requestLimiter {
+	if c.RateLimit <= 0 && c.ClientRateLimit <= 0 {
+		return nil
+	}
+
+	l := &requestLimiter{now: time.Now}
+	if c.RateLimit > 0 {
+		l.global = rate.NewLimiter(rate.Limit(c.RateLimit), max(c.RateLimitBurst, 1))
+	}
+	if c.ClientRateLimit > 0 {
+		l.clientLimit = rate.Limit(c.ClientRateLimit)
+		l.clientBurst = max(c.ClientRateLimitBurst, 1)
+		l.clients = make(map[string]*clientLimiter)
+	}
+	return l
+}
+
+// allow reports whether a request of the client is allowed. The client limit is checked first, so
+// that the requests rejected for a single client don't use up the global limit. Only the global
+// limit applies if client is empty.
+func (l *requestLimiter) allow(client string) bool {
+	now := l.now()
+
+	if client != "" && l.clients != nil && !l.allowClient(client, now) {
+		return false
+	}
+	return l.global == nil || l.global.AllowN(now, 1)
+}
+
+func (l *requestLimiter) allowClient(client string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c, ok := l.clients[client]
+	if !ok {
+		if len(l.clients) >= maxClientLimiters {
+			l.purgeIdleClientsLocked(now)
+			if len(l.clients) >= maxClientLimiters {
+				l.evictOldestClientLocked()
+			}
+		}
+		c = &clientLimiter{limiter: rate.NewLimiter(l.clientLimit, l.clientBurst)}
+		l.clients[client] = c
+	}
+
+	c.lastSeen = now
+	return c.limiter.AllowN(now, 1)
+}
+
+// purgeIdleClientsLocked removes the limiters idle for long enough to be refilled, which would
+// allow the same requests as new ones.
+func (l *requestLimiter) purgeIdleClientsLocked(now time.Time) {
+	refill := time.Duration(float64(l.clientBurst) / float64(l.clientLimit) * float64(time.Second))
+	for client, c := range l.clients {
+		if now.Sub(c.lastSeen) >= refill {
+			delete(l.clients, client)
+		}
+	}
+}
+
+// evictOldestClientLocked removes the limiter of the client seen the longest ago, so that a flood
+// of new clients can't lock out the others.
+func (l *requestLimiter) evictOldestClientLocked() {
+	var oldest string
+	var oldestSeen time.Time
+	for client, c := range l.clients {
+		if oldest == "" || c.lastSeen.Before(oldestSeen) {
+			oldest, oldestSeen = client, c.lastSeen
+		}
+	}
+	delete(l.clients, oldest)
+}
+
+// allowRequest reports whether a request of the client is allowed, and otherwise rejects it with
+// 429 Too Many Requests. All the requests are allowed if l is nil.
+func (l *requestLimiter) allowRequest(w http.ResponseWriter, client string) bool {
+	if l == nil || l.allow(client) {
+		return true
+	}
+
+	// The client may be a token hash, which is not logged
+	klog.V(4).Infof("Rejecting a webhook request, rate limit exceeded")
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+	return false
+}
+
+// isRequestBodyTooLarge reports whether err is returned reading a request body over the limit.
+func isRequestBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
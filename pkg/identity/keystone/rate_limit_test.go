@@ -0,0 +1,145 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystone
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	"golang.org/x/time/rate"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+func TestNewRequestLimiter(t *testing.T) {
+	th.AssertEquals(t, true, newRequestLimiter(&Config{}) == nil)
+
+	l := newRequestLimiter(&Config{RateLimit: 10})
+	th.AssertEquals(t, true, l.global != nil)
+	th.AssertEquals(t, true, l.clients == nil)
+
+	l = newRequestLimiter(&Config{ClientRateLimit: 10})
+	th.AssertEquals(t, true, l.global == nil)
+	th.AssertEquals(t, 1, l.clientBurst)
+}
+
+func TestRequestLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	l := newRequestLimiter(&Config{RateLimit: 1, RateLimitBurst: 3, ClientRateLimit: 1, ClientRateLimitBurst: 2})
+	l.now = func() time.Time { return now }
+
+	// The client limit is reached before the global one
+	th.AssertEquals(t, true, l.allow("10.0.0.1"))
+	th.AssertEquals(t, true, l.allow("10.0.0.1"))
+	th.AssertEquals(t, false, l.allow("10.0.0.1"))
+
+	// The rejected requests don't use up the global limit
+	th.AssertEquals(t, true, l.allow("10.0.0.2"))
+	th.AssertEquals(t, false, l.allow("10.0.0.3"))
+
+	now = now.Add(time.Second)
+	th.AssertEquals(t, true, l.allow("10.0.0.1"))
+	th.AssertEquals(t, false, l.allow("10.0.0.1"))
+}
+
+func TestRequestLimiterPurgesIdleClients(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	l := newRequestLimiter(&Config{ClientRateLimit: 1, ClientRateLimitBurst: 2})
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < maxClientLimiters; i++ {
+		l.clients[string(rune(i))] = &clientLimiter{limiter: rate.NewLimiter(1, 2), lastSeen: now.Add(time.Duration(i) * time.Microsecond)}
+	}
+
+	// The limiter of the client seen the longest ago is evicted for a new client
+	th.AssertEquals(t, true, l.allow("10.0.0.1"))
+	th.AssertEquals(t, maxClientLimiters, len(l.clients))
+	_, ok := l.clients[string(rune(0))]
+	th.AssertEquals(t, false, ok)
+	_, ok = l.clients[string(rune(1))]
+	th.AssertEquals(t, true, ok)
+
+	// The limiters are refilled after 2 seconds
+	now = now.Add(3 * time.Second)
+	th.AssertEquals(t, true, l.allow("10.0.0.2"))
+	th.AssertEquals(t, 1, len(l.clients))
+}
+
+func TestHandlerRateLimit(t *testing.T) {
+	auth := &Auth{
+		authn:   &Authenticator{keystoner: &mockKeystoner{}},
+		authz:   &Authorizer{},
+		syncer:  &Syncer{},
+		config:  &Config{},
+		limiter: newRequestLimiter(&Config{ClientRateLimit: 1}),
+	}
+
+	serve := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		auth.Handler(rr, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body)))
+		return rr
+	}
+	tokenReview := func(token string) string {
+		return `{"apiVersion": "authentication.k8s.io/v1beta1", "kind": "TokenReview", "spec": {"token": "` + token + `"}}`
+	}
+	accessReview := func(user string) string {
+		return `{"apiVersion": "authorization.k8s.io/v1beta1", "kind": "SubjectAccessReview", "spec": {"user": "` + user + `", "group": [], "nonResourceAttributes": {"verb": "get", "path": "/healthz"}}}`
+	}
+
+	th.AssertEquals(t, http.StatusUnauthorized, serve(tokenReview("token1")).Code)
+	rr := serve(tokenReview("token1"))
+	th.AssertEquals(t, http.StatusTooManyRequests, rr.Code)
+	th.AssertEquals(t, "1", rr.Header().Get("Retry-After"))
+
+	// The requests reviewing the other tokens come from the same kube-apiserver but are limited
+	// separately
+	th.AssertEquals(t, http.StatusUnauthorized, serve(tokenReview("token2")).Code)
+
+	// The cached tokens are not reviewed by Keystone, so not limited
+	auth.authn.cache = newTokenCache(time.Minute)
+	auth.authn.cache.add("token3", &user.DefaultInfo{Name: "user3"}, time.Now().Add(time.Hour))
+	th.AssertEquals(t, http.StatusOK, serve(tokenReview("token3")).Code)
+	th.AssertEquals(t, http.StatusOK, serve(tokenReview("token3")).Code)
+
+	// The authorization requests don't call Keystone, so are only limited globally
+	th.AssertEquals(t, http.StatusOK, serve(accessReview("user1")).Code)
+	th.AssertEquals(t, http.StatusOK, serve(accessReview("user1")).Code)
+}
+
+func TestHandlerMaxRequestBodyBytes(t *testing.T) {
+	auth := &Auth{
+		authn:  &Authenticator{keystoner: &mockKeystoner{}},
+		authz:  &Authorizer{},
+		syncer: &Syncer{},
+		config: &Config{MaxRequestBodyBytes: 128},
+	}
+
+	body := `{"apiVersion": "authentication.k8s.io/v1beta1", "kind": "TokenReview", "spec": {"token": "` + strings.Repeat("a", 128) + `"}}`
+	rr := httptest.NewRecorder()
+	auth.Handler(rr, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body)))
+	th.AssertEquals(t, http.StatusRequestEntityTooLarge, rr.Code)
+
+	body = `{"apiVersion": "authentication.k8s.io/v1beta1", "kind": "TokenReview", "spec": {"token": "token"}}`
+	rr = httptest.NewRecorder()
+	auth.Handler(rr, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body)))
+	th.AssertEquals(t, http.StatusUnauthorized, rr.Code)
+}
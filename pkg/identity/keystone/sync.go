@@ -20,6 +20,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"regexp"
 	"slices"
@@ -42,6 +43,30 @@ const (
 
 var allowedDataTypesToSync = []string{Projects, RoleAssignments}
 
+var groupTemplateVariableRegexp = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// provisioningTemplateVariables maps the variables of the namespace and role binding templates to
+// the keys of the user extra attributes they are replaced with. Only the project attributes are
+// supported, as the objects are shared by all the users of the project.
+var provisioningTemplateVariables = map[string]string{
+	"project_id":   ProjectID,
+	"project_name": ProjectName,
+}
+
+// namespaceTemplate defines the labels and annotations of the namespaces created for the projects
+type namespaceTemplate struct {
+	Labels      map[string]string `yaml:"labels"`
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+// roleBindingTemplate defines a role binding created in the namespaces of the projects
+type roleBindingTemplate struct {
+	Name        string   `yaml:"name"`
+	ClusterRole string   `yaml:"cluster-role"`
+	Groups      []string `yaml:"groups"`
+	Users       []string `yaml:"users"`
+}
+
 type roleMap struct {
 	KeystoneRole string   `yaml:"keystone-role"`
 	Username     string   `yaml:"username"`
@@ -65,6 +90,19 @@ type syncConfig struct {
 
 	// List of role mappings that will apply to the user info after authentication.
 	RoleMaps []*roleMap `yaml:"role-mappings"`
+
+	// List of templates of the groups added to the user info after authentication. Can contain
+	// the userAttributes as variables, e.g. {project_id}, a group is added for every role of the
+	// user if the template contains {roles}.
+	GroupTemplates []string `yaml:"group-templates"`
+
+	// Labels and annotations of the namespaces created for the projects. The values can contain
+	// the variables {project_id} and {project_name}.
+	NamespaceTemplate *namespaceTemplate `yaml:"namespace-template"`
+
+	// List of role bindings created in the namespaces of the projects. The names, groups and users
+	// can contain the variables {project_id} and {project_name}.
+	RoleBindingTemplates []*roleBindingTemplate `yaml:"role-binding-templates"`
 }
 
 func (sc *syncConfig) validate() error {
@@ -86,6 +124,22 @@ func (sc *syncConfig) validate() error {
 		}
 	}
 
+	for _, t := range sc.GroupTemplates {
+		if t == "" {
+			return fmt.Errorf("group template must not be empty")
+		}
+
+		for _, m := range groupTemplateVariableRegexp.FindAllStringSubmatch(t, -1) {
+			if _, ok := userAttributes[m[1]]; !ok {
+				return fmt.Errorf("unsupported variable %s in group template %q", m[0], t)
+			}
+		}
+	}
+
+	if err := sc.validateProvisioningTemplates(); err != nil {
+		return err
+	}
+
 	// Check that only allowed data types are enabled for synchronization
 	for _, dt := range sc.DataTypesToSync {
 		var flag bool
@@ -107,6 +161,41 @@ func (sc *syncConfig) validate() error {
 	return nil
 }
 
+func (sc *syncConfig) validateProvisioningTemplates() error {
+	if (sc.NamespaceTemplate != nil || len(sc.RoleBindingTemplates) > 0) && !slices.Contains(sc.DataTypesToSync, Projects) {
+		return fmt.Errorf("namespace-template and role-binding-templates require the %s data type to sync", Projects)
+	}
+
+	var templates []string
+	if sc.NamespaceTemplate != nil {
+		templates = slices.AppendSeq(templates, maps.Values(sc.NamespaceTemplate.Labels))
+		templates = slices.AppendSeq(templates, maps.Values(sc.NamespaceTemplate.Annotations))
+	}
+
+	for _, rb := range sc.RoleBindingTemplates {
+		if rb.Name == "" || rb.ClusterRole == "" {
+			return fmt.Errorf("role binding template requires name and cluster-role")
+		}
+		if len(rb.Groups) == 0 && len(rb.Users) == 0 {
+			return fmt.Errorf("role binding template %q requires groups or users", rb.Name)
+		}
+
+		templates = append(templates, rb.Name)
+		templates = append(templates, rb.Groups...)
+		templates = append(templates, rb.Users...)
+	}
+
+	for _, t := range templates {
+		for _, m := range groupTemplateVariableRegexp.FindAllStringSubmatch(t, -1) {
+			if _, ok := provisioningTemplateVariables[m[1]]; !ok {
+				return fmt.Errorf("unsupported variable %s in template %q", m[0], t)
+			}
+		}
+	}
+
+	return nil
+}
+
 // formatNamespaceName generates a namespace name, based on format string
 func (sc *syncConfig) formatNamespaceName(id string, name string, domain string) string {
 	res := strings.ReplaceAll(sc.NamespaceFormat, "%i", id)
@@ -149,9 +238,23 @@ func newSyncConfigFromFile(path string) (*syncConfig, error) {
 
 // Syncer synchronizes auth data between Keystone and Kubernetes
 type Syncer struct {
-	k8sClient  *kubernetes.Clientset
+	k8sClient  kubernetes.Interface
 	syncConfig *syncConfig
 	mu         sync.Mutex
+
+	// provisioned contains the namespaces in which the role bindings of the templates have been
+	// created since the sync config was set
+	provisioned map[string]bool
+}
+
+// setSyncConfig replaces the sync config, the role bindings of its templates are created again in
+// the namespaces of the projects.
+func (s *Syncer) setSyncConfig(sc *syncConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.syncConfig = sc
+	s.provisioned = nil
 }
 
 func (s *Syncer) syncData(ctx context.Context, u *userInfo) error {
@@ -214,6 +317,10 @@ func (s *Syncer) syncProjectData(ctx context.Context, u *userInfo, namespaceName
 				Name: namespaceName,
 			},
 		}
+		if t := s.syncConfig.NamespaceTemplate; t != nil {
+			namespace.Labels = formatProvisioningTemplates(t.Labels, u.Extra)
+			namespace.Annotations = formatProvisioningTemplates(t.Annotations, u.Extra)
+		}
 		_, err := s.k8sClient.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{})
 		if err != nil {
 			klog.Warningf("Cannot create a namespace for the user: %v", err)
@@ -225,9 +332,80 @@ func (s *Syncer) syncProjectData(ctx context.Context, u *userInfo, namespaceName
 		return errors.New("internal server error")
 	}
 
+	return s.provisionRoleBindings(ctx, u, namespaceName)
+}
+
+// provisionRoleBindings creates the role bindings of the templates in the namespace of the project,
+// once per namespace. The existing role bindings are left as they are.
+func (s *Syncer) provisionRoleBindings(ctx context.Context, u *userInfo, namespaceName string) error {
+	if len(s.syncConfig.RoleBindingTemplates) == 0 || s.provisioned[namespaceName] {
+		return nil
+	}
+
+	for _, t := range s.syncConfig.RoleBindingTemplates {
+		roleBinding := &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: formatProvisioningTemplate(t.Name, u.Extra),
+			},
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: "rbac.authorization.k8s.io",
+				Kind:     "ClusterRole",
+				Name:     t.ClusterRole,
+			},
+		}
+		for _, g := range t.Groups {
+			roleBinding.Subjects = append(roleBinding.Subjects, rbacv1.Subject{
+				APIGroup: "rbac.authorization.k8s.io",
+				Kind:     "Group",
+				Name:     formatProvisioningTemplate(g, u.Extra),
+			})
+		}
+		for _, user := range t.Users {
+			roleBinding.Subjects = append(roleBinding.Subjects, rbacv1.Subject{
+				APIGroup: "rbac.authorization.k8s.io",
+				Kind:     "User",
+				Name:     formatProvisioningTemplate(user, u.Extra),
+			})
+		}
+
+		_, err := s.k8sClient.RbacV1().RoleBindings(namespaceName).Create(ctx, roleBinding, metav1.CreateOptions{})
+		if err != nil && !k8serrors.IsAlreadyExists(err) {
+			klog.Warningf("Cannot create the role binding %s of the project: %v", roleBinding.Name, err)
+			return errors.New("internal server error")
+		}
+	}
+
+	if s.provisioned == nil {
+		s.provisioned = make(map[string]bool)
+	}
+	s.provisioned[namespaceName] = true
+
 	return nil
 }
 
+// formatProvisioningTemplate replaces the variables of a namespace or role binding template with
+// the project attributes of the user.
+func formatProvisioningTemplate(template string, extra map[string][]string) string {
+	return groupTemplateVariableRegexp.ReplaceAllStringFunc(template, func(v string) string {
+		if values := extra[provisioningTemplateVariables[strings.Trim(v, "{}")]]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	})
+}
+
+func formatProvisioningTemplates(templates map[string]string, extra map[string][]string) map[string]string {
+	if len(templates) == 0 {
+		return nil
+	}
+
+	res := make(map[string]string, len(templates))
+	for k, t := range templates {
+		res[k] = formatProvisioningTemplate(t, extra)
+	}
+	return res
+}
+
 func (s *Syncer) syncRoleAssignmentsData(ctx context.Context, u *userInfo, namespaceName string) error {
 	// TODO(mfedosin): add a field separator to filter out unnecessary roles bindings at an early stage
 	roleBindings, err := s.k8sClient.RbacV1().RoleBindings(namespaceName).List(ctx, metav1.ListOptions{})
@@ -307,10 +485,18 @@ func (s *Syncer) syncRoleAssignmentsData(ctx context.Context, u *userInfo, names
 
 // syncRoles modifies the user attributes according to the config.
 func (s *Syncer) syncRoles(user *userInfo) *userInfo {
-	if s.syncConfig == nil || len(s.syncConfig.RoleMaps) == 0 {
+	if s.syncConfig == nil || (len(s.syncConfig.RoleMaps) == 0 && len(s.syncConfig.GroupTemplates) == 0) {
 		return user
 	}
 
+	for _, t := range s.syncConfig.GroupTemplates {
+		for _, group := range formatGroups(t, user.Extra) {
+			if !slices.Contains(user.Groups, group) {
+				user.Groups = append(user.Groups, group)
+			}
+		}
+	}
+
 	if roles, isPresent := user.Extra[Roles]; isPresent {
 		for _, roleMap := range s.syncConfig.RoleMaps {
 			if roleMap.KeystoneRole != "" && slices.Contains(roles, roleMap.KeystoneRole) {
@@ -326,3 +512,45 @@ func (s *Syncer) syncRoles(user *userInfo) *userInfo {
 
 	return user
 }
+
+// formatGroups generates the groups of a group template from the user extra attributes. No group
+// is generated if an attribute the template refers to is missing, e.g. the project of an unscoped
+// token.
+func formatGroups(template string, extra map[string][]string) []string {
+	// Every combination of the values of the variables is substituted in a single pass, so that the
+	// values which look like variables, e.g. a project named {roles}, are not expanded again
+	combinations := []map[string]string{{}}
+	for _, m := range groupTemplateVariableRegexp.FindAllStringSubmatch(template, -1) {
+		if _, ok := combinations[0][m[0]]; ok {
+			continue
+		}
+
+		values := extra[userAttributes[m[1]]]
+		if m[1] != "roles" && len(values) > 1 {
+			values = values[:1]
+		}
+
+		var expanded []map[string]string
+		for _, c := range combinations {
+			for _, v := range values {
+				if v != "" {
+					e := maps.Clone(c)
+					e[m[0]] = v
+					expanded = append(expanded, e)
+				}
+			}
+		}
+		if len(expanded) == 0 {
+			return nil
+		}
+		combinations = expanded
+	}
+
+	groups := make([]string, 0, len(combinations))
+	for _, c := range combinations {
+		groups = append(groups, groupTemplateVariableRegexp.ReplaceAllStringFunc(template, func(v string) string {
+			return c[v]
+		}))
+	}
+	return groups
+}
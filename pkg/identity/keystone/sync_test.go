@@ -17,11 +17,16 @@ limitations under the License.
 package keystone
 
 import (
+	"context"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 
 	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 func TestSyncConfigFromFile(t *testing.T) {
@@ -81,6 +86,110 @@ func TestSyncConfigValidation(t *testing.T) {
 		),
 		err.Error(),
 	)
+
+	sc = newSyncConfig()
+
+	// GroupTemplates must contain only supported variables
+	sc.GroupTemplates = []string{"project:{project_name}:role:{roles}"}
+	err = sc.validate()
+	th.AssertNoErr(t, err)
+
+	sc.GroupTemplates = []string{"project:{project}"}
+	err = sc.validate()
+	th.AssertEquals(t, `unsupported variable {project} in group template "project:{project}"`, err.Error())
+
+	sc.GroupTemplates = []string{""}
+	err = sc.validate()
+	th.AssertEquals(t, "group template must not be empty", err.Error())
+
+	sc = newSyncConfig()
+
+	// The namespace and role binding templates require the projects to be synced
+	sc.RoleBindingTemplates = []*roleBindingTemplate{{Name: "{project_name}-admins", ClusterRole: "admin", Groups: []string{"{project_id}:admin"}}}
+	err = sc.validate()
+	th.AssertEquals(t, "namespace-template and role-binding-templates require the projects data type to sync", err.Error())
+
+	sc.DataTypesToSync = []string{Projects}
+	err = sc.validate()
+	th.AssertNoErr(t, err)
+
+	sc.RoleBindingTemplates = []*roleBindingTemplate{{Name: "admins", ClusterRole: "admin"}}
+	err = sc.validate()
+	th.AssertEquals(t, `role binding template "admins" requires groups or users`, err.Error())
+
+	sc.RoleBindingTemplates = []*roleBindingTemplate{{Name: "admins", Groups: []string{"admins"}}}
+	err = sc.validate()
+	th.AssertEquals(t, "role binding template requires name and cluster-role", err.Error())
+
+	// The templates can't contain the user attributes
+	sc.RoleBindingTemplates = []*roleBindingTemplate{{Name: "{roles}", ClusterRole: "admin", Groups: []string{"admins"}}}
+	err = sc.validate()
+	th.AssertEquals(t, `unsupported variable {roles} in template "{roles}"`, err.Error())
+
+	sc.RoleBindingTemplates = nil
+	sc.NamespaceTemplate = &namespaceTemplate{Labels: map[string]string{"project": "{domain_name}"}}
+	err = sc.validate()
+	th.AssertEquals(t, `unsupported variable {domain_name} in template "{domain_name}"`, err.Error())
+}
+
+func TestSyncProjectDataTemplates(t *testing.T) {
+	sc := newSyncConfig()
+	sc.DataTypesToSync = []string{Projects}
+	sc.NamespaceTemplate = &namespaceTemplate{
+		Labels:      map[string]string{"keystone.openstack.org/project-id": "{project_id}"},
+		Annotations: map[string]string{"keystone.openstack.org/project-name": "{project_name}"},
+	}
+	sc.RoleBindingTemplates = []*roleBindingTemplate{
+		{Name: "keystone-admins", ClusterRole: "admin", Groups: []string{"{project_id}:admin"}},
+		{Name: "keystone-viewers", ClusterRole: "view", Groups: []string{"{project_id}:member"}, Users: []string{"{project_name}-robot"}},
+	}
+
+	k8sClient := fake.NewClientset(&rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "keystone-viewers", Namespace: "project-id"},
+		RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: "edit"},
+	})
+	s := &Syncer{k8sClient: k8sClient, syncConfig: &sc}
+
+	u := &userInfo{
+		Username: "user",
+		UID:      "user-id",
+		Extra:    map[string][]string{ProjectID: {"project-id"}, ProjectName: {"demo"}, DomainID: {"default"}},
+	}
+	th.AssertNoErr(t, s.syncData(context.Background(), u))
+
+	ns, err := k8sClient.CoreV1().Namespaces().Get(context.Background(), "project-id", metav1.GetOptions{})
+	th.AssertNoErr(t, err)
+	if !reflect.DeepEqual(ns.Labels, map[string]string{"keystone.openstack.org/project-id": "project-id"}) {
+		t.Errorf("unexpected namespace labels %v", ns.Labels)
+	}
+	if !reflect.DeepEqual(ns.Annotations, map[string]string{"keystone.openstack.org/project-name": "demo"}) {
+		t.Errorf("unexpected namespace annotations %v", ns.Annotations)
+	}
+
+	rb, err := k8sClient.RbacV1().RoleBindings("project-id").Get(context.Background(), "keystone-admins", metav1.GetOptions{})
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "admin", rb.RoleRef.Name)
+	expectedSubjects := []rbacv1.Subject{{APIGroup: "rbac.authorization.k8s.io", Kind: "Group", Name: "project-id:admin"}}
+	if !reflect.DeepEqual(rb.Subjects, expectedSubjects) {
+		t.Errorf("expected subjects %v, got %v", expectedSubjects, rb.Subjects)
+	}
+
+	// The existing role bindings are left as they are
+	rb, err = k8sClient.RbacV1().RoleBindings("project-id").Get(context.Background(), "keystone-viewers", metav1.GetOptions{})
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "edit", rb.RoleRef.Name)
+
+	// The role bindings are created once per namespace
+	th.AssertNoErr(t, k8sClient.RbacV1().RoleBindings("project-id").Delete(context.Background(), "keystone-admins", metav1.DeleteOptions{}))
+	th.AssertNoErr(t, s.syncData(context.Background(), u))
+	_, err = k8sClient.RbacV1().RoleBindings("project-id").Get(context.Background(), "keystone-admins", metav1.GetOptions{})
+	th.AssertEquals(t, true, err != nil)
+
+	// until the sync config changes
+	s.setSyncConfig(&sc)
+	th.AssertNoErr(t, s.syncData(context.Background(), u))
+	_, err = k8sClient.RbacV1().RoleBindings("project-id").Get(context.Background(), "keystone-admins", metav1.GetOptions{})
+	th.AssertNoErr(t, err)
 }
 
 func TestSyncRoles(t *testing.T) {
@@ -154,3 +263,76 @@ func TestSyncRolesSkipm(t *testing.T) {
 
 	th.AssertEquals(t, userModified, user1)
 }
+
+func TestSyncRolesGroupTemplates(t *testing.T) {
+	sc := newSyncConfig()
+	sc.GroupTemplates = []string{
+		"project:{project_name}:role:{roles}",
+		"domain:{domain_name}",
+		"project:{project_id}",
+		"project:{project_domain_id}:{project_name}",
+		"{roles}",
+	}
+	syncer := Syncer{
+		k8sClient:  nil,
+		syncConfig: &sc,
+	}
+
+	fakeID := "b4db78f0-4dd7-41cf-8475-203c34230dc0"
+	user1 := &userInfo{
+		Username: "fake-user",
+		UID:      fakeID,
+		Groups:   []string{"project-id", "member"},
+		Extra: map[string][]string{
+			Roles:       {"member", "reader"},
+			ProjectID:   {"project-id"},
+			ProjectName: {"demo"},
+			DomainID:    {"default"},
+			DomainName:  {"Default"},
+
+			ProjectDomainID: {"project-domain"},
+		},
+	}
+
+	userModified := syncer.syncRoles(user1)
+
+	expectedGroups := []string{
+		"project-id",
+		"member",
+		"project:demo:role:member",
+		"project:demo:role:reader",
+		"domain:Default",
+		"project:project-id",
+		"project:project-domain:demo",
+		"reader",
+	}
+	th.AssertDeepEquals(t, expectedGroups, userModified.Groups)
+
+	// No group is generated from the attributes missing from an unscoped token
+	user2 := &userInfo{
+		Username: "fake-user",
+		UID:      fakeID,
+		Groups:   []string{},
+		Extra:    map[string][]string{DomainName: {"Default"}},
+	}
+
+	userModified = syncer.syncRoles(user2)
+
+	th.AssertDeepEquals(t, []string{"domain:Default"}, userModified.Groups)
+
+	// The values are not expanded as variables
+	user3 := &userInfo{
+		Username: "fake-user",
+		UID:      fakeID,
+		Groups:   []string{},
+		Extra: map[string][]string{
+			Roles:       {"member", "reader"},
+			ProjectName: {"{roles}"},
+			DomainName:  {"{project_id}"},
+		},
+	}
+
+	userModified = syncer.syncRoles(user3)
+
+	th.AssertDeepEquals(t, []string{"project:{roles}:role:member", "project:{roles}:role:reader", "domain:{project_id}", "member", "reader"}, userModified.Groups)
+}
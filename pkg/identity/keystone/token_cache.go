@@ -0,0 +1,202 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystone
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/klog/v2"
+)
+
+// maxTokenCacheEntries bounds the memory used by the token cache. The tokens are not cached while
+// the cache is full of unexpired tokens.
+const maxTokenCacheEntries = 10000
+
+type tokenCacheEntry struct {
+	// token is kept to check its revocation
+	token     string
+	user      *user.DefaultInfo
+	expiresAt time.Time
+}
+
+// tokenCache caches the users of the validated tokens, keyed by the SHA-256 hash of the tokens.
+type tokenCache struct {
+	ttl     time.Duration
+	now     func() time.Time
+	mu      sync.Mutex
+	entries map[string]*tokenCacheEntry
+}
+
+func newTokenCache(ttl time.Duration) *tokenCache {
+	return &tokenCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]*tokenCacheEntry),
+	}
+}
+
+func tokenHash(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// get returns a copy of the cached user of the token, if not expired.
+func (c *tokenCache) get(token string) (*user.DefaultInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[tokenHash(token)]
+	if !ok {
+		return nil, false
+	}
+
+	if !c.now().Before(e.expiresAt) {
+		delete(c.entries, tokenHash(token))
+		return nil, false
+	}
+
+	return copyUser(e.user), true
+}
+
+// add caches the user of the token until the TTL of the cache elapses or the token expires,
+// whichever comes first.
+func (c *tokenCache) add(token string, u *user.DefaultInfo, tokenExpiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	expiresAt := now.Add(c.ttl)
+	if !tokenExpiresAt.IsZero() && tokenExpiresAt.Before(expiresAt) {
+		expiresAt = tokenExpiresAt
+	}
+	if !now.Before(expiresAt) {
+		return
+	}
+
+	if len(c.entries) >= maxTokenCacheEntries {
+		c.purgeExpiredLocked(now)
+
+		if len(c.entries) >= maxTokenCacheEntries {
+			klog.V(4).Infof("Token cache is full, not caching the token of user %s", u.Name)
+			return
+		}
+	}
+
+	c.entries[tokenHash(token)] = &tokenCacheEntry{token: token, user: copyUser(u), expiresAt: expiresAt}
+}
+
+func (c *tokenCache) delete(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, tokenHash(token))
+}
+
+// users returns copies of the users of the unexpired cached tokens.
+func (c *tokenCache) users() []*user.DefaultInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	users := make([]*user.DefaultInfo, 0, len(c.entries))
+	for _, e := range c.entries {
+		if now.Before(e.expiresAt) {
+			users = append(users, copyUser(e.user))
+		}
+	}
+	return users
+}
+
+// deleteUsers removes the cached tokens of the users for which f returns true, and returns the
+// number of removed tokens.
+func (c *tokenCache) deleteUsers(f func(u *user.DefaultInfo) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := len(c.entries)
+	maps.DeleteFunc(c.entries, func(_ string, e *tokenCacheEntry) bool {
+		return f(e.user)
+	})
+	return n - len(c.entries)
+}
+
+func (c *tokenCache) purgeExpiredLocked(now time.Time) {
+	maps.DeleteFunc(c.entries, func(_ string, e *tokenCacheEntry) bool {
+		return !now.Before(e.expiresAt)
+	})
+}
+
+// checkRevocations removes the expired tokens and the tokens Keystone no longer considers valid
+// from the cache. The tokens which fail to be validated are kept until they expire.
+func (c *tokenCache) checkRevocations(ctx context.Context, keystoner IKeystone) {
+	c.mu.Lock()
+	c.purgeExpiredLocked(c.now())
+	tokens := make([]string, 0, len(c.entries))
+	for _, e := range c.entries {
+		tokens = append(tokens, e.token)
+	}
+	c.mu.Unlock()
+
+	var revoked int
+	for _, token := range tokens {
+		valid, err := keystoner.ValidateToken(ctx, token)
+		if err != nil {
+			klog.Warningf("Failed to check the revocation of a cached token: %v", err)
+			continue
+		}
+
+		if !valid {
+			c.delete(token)
+			revoked++
+		}
+	}
+
+	if revoked > 0 {
+		klog.Infof("Removed %d revoked tokens from the token cache", revoked)
+	}
+}
+
+// runRevocationChecks periodically checks the revocation of the cached tokens, until stopCh is
+// closed.
+func (c *tokenCache) runRevocationChecks(keystoner IKeystone, interval time.Duration, stopCh <-chan struct{}) {
+	wait.Until(func() {
+		c.checkRevocations(context.TODO(), keystoner)
+	}, interval, stopCh)
+}
+
+func copyUser(u *user.DefaultInfo) *user.DefaultInfo {
+	extra := make(map[string][]string, len(u.Extra))
+	for k, v := range u.Extra {
+		extra[k] = slices.Clone(v)
+	}
+
+	return &user.DefaultInfo{
+		Name:   u.Name,
+		UID:    u.UID,
+		Groups: slices.Clone(u.Groups),
+		Extra:  extra,
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystone
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack"
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+func TestAuthenticateTokenCache(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	keystone := &MockIKeystone{}
+	keystone.
+		On("GetTokenInfo", "token").
+		Return(&tokenInfo{userName: "user-name", userID: "user-id", projectID: "project-id", expiresAt: now.Add(time.Hour)}, nil).
+		Once()
+	keystone.
+		On("GetGroups", "token", "user-id").
+		Return([]string{"group1"}, nil).
+		Once()
+
+	cache := newTokenCache(10 * time.Minute)
+	cache.now = func() time.Time { return now }
+
+	a := &Authenticator{keystoner: keystone, cache: cache}
+
+	for i := 0; i < 2; i++ {
+		u, allowed, err := a.AuthenticateToken(context.TODO(), "token")
+		th.AssertNoErr(t, err)
+		th.AssertEquals(t, true, allowed)
+		th.AssertEquals(t, "user-name", u.GetName())
+
+		// The cached user must not be modified through the returned one
+		u.(*user.DefaultInfo).Groups[0] = "modified"
+	}
+
+	keystone.AssertExpectations(t)
+
+	// The token is no longer cached once the TTL elapsed
+	now = now.Add(10 * time.Minute)
+	_, ok := cache.get("token")
+	th.AssertEquals(t, false, ok)
+}
+
+func TestTokenCacheExpiration(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cache := newTokenCache(time.Hour)
+	cache.now = func() time.Time { return now }
+
+	u := &user.DefaultInfo{Name: "user-name"}
+
+	// The token expiration caps the TTL
+	cache.add("token", u, now.Add(time.Minute))
+	_, ok := cache.get("token")
+	th.AssertEquals(t, true, ok)
+
+	now = now.Add(time.Minute)
+	_, ok = cache.get("token")
+	th.AssertEquals(t, false, ok)
+
+	// An expired token is not cached
+	cache.add("expired", u, now.Add(-time.Second))
+	th.AssertEquals(t, 0, len(cache.entries))
+}
+
+func TestTokenCacheCheckRevocations(t *testing.T) {
+	keystone := &MockIKeystone{}
+	keystone.On("ValidateToken", "valid").Return(true, nil).Once()
+	keystone.On("ValidateToken", "revoked").Return(false, nil).Once()
+
+	cache := newTokenCache(time.Hour)
+	cache.add("valid", &user.DefaultInfo{Name: "user1"}, time.Time{})
+	cache.add("revoked", &user.DefaultInfo{Name: "user2"}, time.Time{})
+
+	cache.checkRevocations(context.TODO(), keystone)
+
+	_, ok := cache.get("valid")
+	th.AssertEquals(t, true, ok)
+	_, ok = cache.get("revoked")
+	th.AssertEquals(t, false, ok)
+
+	keystone.AssertExpectations(t)
+}
+
+func TestTokenCacheCheckRevocationsKeystone(t *testing.T) {
+	// Keystone validates each token with the token itself, so it rejects the revoked tokens with
+	// 401 Unauthorized
+	statuses := map[string]int{
+		"valid":   http.StatusOK,
+		"revoked": http.StatusUnauthorized,
+		"expired": http.StatusNotFound,
+		"failed":  http.StatusInternalServerError,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		th.AssertEquals(t, "/v3/auth/tokens", r.URL.Path)
+		th.AssertEquals(t, r.Header.Get("X-Auth-Token"), r.Header.Get("X-Subject-Token"))
+		w.WriteHeader(statuses[r.Header.Get("X-Subject-Token")])
+	}))
+	defer server.Close()
+
+	provider, err := openstack.NewClient(server.URL + "/v3")
+	th.AssertNoErr(t, err)
+	keystoner := NewKeystoner(&gophercloud.ServiceClient{ProviderClient: provider, Endpoint: server.URL + "/v3/"})
+
+	cache := newTokenCache(time.Hour)
+	for token := range statuses {
+		cache.add(token, &user.DefaultInfo{Name: token}, time.Time{})
+	}
+
+	cache.checkRevocations(context.TODO(), keystoner)
+
+	for token, cached := range map[string]bool{"valid": true, "revoked": false, "expired": false, "failed": true} {
+		_, ok := cache.get(token)
+		th.AssertEquals(t, cached, ok)
+	}
+}
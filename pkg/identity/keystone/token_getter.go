@@ -19,9 +19,12 @@ package keystone
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"slices"
 
 	"github.com/gophercloud/gophercloud/v2"
 	"github.com/gophercloud/gophercloud/v2/openstack"
@@ -33,14 +36,85 @@ import (
 	"k8s.io/klog/v2"
 )
 
+// authReceiptHeader is the header of the receipts of the authentications which require more
+// authentication methods, e.g. a TOTP passcode in addition to the password
+const authReceiptHeader = "Openstack-Auth-Receipt"
+
 type Options struct {
 	AuthOptions    gophercloud.AuthOptions
 	ClientCertPath string
 	ClientKeyPath  string
 	ClientCAPath   string
+	// Receipt is the receipt of an MFARequiredError. The authentication methods of the receipt
+	// are not submitted again.
+	Receipt string
+}
+
+// MFARequiredError is returned when the authentication succeeded but Keystone requires more
+// authentication methods, e.g. in the domains enforcing multi-factor authentication.
+type MFARequiredError struct {
+	// Receipt proves the authentication methods which succeeded
+	Receipt string
+	// Methods are the authentication methods which succeeded
+	Methods []string
+	// RequiredMethods are the sets of the authentication methods, one of which must succeed
+	RequiredMethods [][]string
+}
+
+func (e *MFARequiredError) Error() string {
+	return fmt.Sprintf("additional authentication methods are required, one of %v", e.RequiredMethods)
+}
+
+// RequiresTOTP reports whether a TOTP passcode completes one of the sets of the required
+// authentication methods.
+func (e *MFARequiredError) RequiresTOTP() bool {
+	for _, methods := range e.RequiredMethods {
+		if !slices.Contains(methods, "totp") {
+			continue
+		}
+
+		complete := true
+		for _, m := range methods {
+			if m != "totp" && !slices.Contains(e.Methods, m) {
+				complete = false
+			}
+		}
+		if complete {
+			return true
+		}
+	}
+	return false
+}
+
+// newMFARequiredError returns the MFARequiredError of an authentication error with a receipt, or
+// nil if the authentication didn't succeed.
+func newMFARequiredError(err error) *MFARequiredError {
+	var respErr gophercloud.ErrUnexpectedResponseCode
+	if !errors.As(err, &respErr) || respErr.Actual != http.StatusUnauthorized {
+		return nil
+	}
+
+	receipt := respErr.ResponseHeader.Get(authReceiptHeader)
+	if receipt == "" {
+		return nil
+	}
+
+	var body struct {
+		Receipt struct {
+			Methods []string `json:"methods"`
+		} `json:"receipt"`
+		RequiredAuthMethods [][]string `json:"required_auth_methods"`
+	}
+	if err := json.Unmarshal(respErr.Body, &body); err != nil {
+		klog.V(4).Infof("failed to parse the authentication receipt response: %v", err)
+	}
+
+	return &MFARequiredError{Receipt: receipt, Methods: body.Receipt.Methods, RequiredMethods: body.RequiredAuthMethods}
 }
 
-// GetToken creates a token by authenticate with keystone.
+// GetToken creates a token by authenticate with keystone. An MFARequiredError is returned if
+// Keystone requires more authentication methods, the token is then created by calling GetToken
+// again with the receipt of the error, and the missing methods, e.g. a TOTP passcode.
 func GetToken(ctx context.Context, options Options) (*tokens3.Token, error) {
 	var token *tokens3.Token
 	var setTransport bool
@@ -113,8 +187,11 @@ func GetToken(ctx context.Context, options Options) (*tokens3.Token, error) {
 	}
 
 	// Issue new unscoped token
-	result := tokens3.Create(ctx, v3Client, &options.AuthOptions)
+	result := createToken(ctx, v3Client, options)
 	if result.Err != nil {
+		if mfaErr := newMFARequiredError(result.Err); mfaErr != nil {
+			return token, mfaErr
+		}
 		return token, result.Err
 	}
 	token, err = result.ExtractToken()
@@ -125,3 +202,30 @@ func GetToken(ctx context.Context, options Options) (*tokens3.Token, error) {
 
 	return token, nil
 }
+
+// createToken creates a token like tokens.Create, the receipt of the options is sent along with
+// the authentication methods.
+func createToken(ctx context.Context, client *gophercloud.ServiceClient, options Options) (r tokens3.CreateResult) {
+	if options.Receipt == "" {
+		return tokens3.Create(ctx, client, &options.AuthOptions)
+	}
+
+	scope, err := options.AuthOptions.ToTokenV3ScopeMap()
+	if err != nil {
+		r.Err = err
+		return
+	}
+
+	b, err := options.AuthOptions.ToTokenV3CreateMap(scope)
+	if err != nil {
+		r.Err = err
+		return
+	}
+
+	resp, err := client.Post(ctx, client.ServiceURL("auth", "tokens"), b, &r.Body, &gophercloud.RequestOpts{
+		OmitHeaders: []string{"X-Auth-Token"},
+		MoreHeaders: map[string]string{authReceiptHeader: options.Receipt},
+	})
+	_, r.Header, r.Err = gophercloud.ParseResponse(resp, err)
+	return
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystone
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	tokens3 "github.com/gophercloud/gophercloud/v2/openstack/identity/v3/tokens"
+	"k8s.io/klog/v2"
+)
+
+// TokenFileCache caches the tokens issued to client-keystone-auth on disk, so that the
+// executions of the plugin don't authenticate with Keystone again until the tokens are about
+// to expire.
+type TokenFileCache struct {
+	// Dir is the directory of the files of the cached tokens
+	Dir string
+	// RenewBefore is how long before their expiry the tokens are renewed
+	RenewBefore time.Duration
+	// now returns the current time, time.Now if nil
+	now func() time.Time
+}
+
+// cachedToken is the content of the file of a cached token
+type cachedToken struct {
+	ID        string    `json:"id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// DefaultTokenCacheDir returns the default directory of the cached tokens, in the cache
+// directory of the user.
+func DefaultTokenCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "client-keystone-auth")
+}
+
+// tokenCacheKey returns the key of the tokens of the options, which identifies the Keystone
+// endpoint, the user or the application credential, and the scope. The secrets are not part of
+// the key.
+func tokenCacheKey(options Options) string {
+	o := options.AuthOptions
+	parts := []string{
+		o.IdentityEndpoint,
+		o.UserID, o.Username, o.DomainID, o.DomainName,
+		o.TenantID, o.TenantName,
+		o.ApplicationCredentialID, o.ApplicationCredentialName,
+	}
+	if o.Scope != nil {
+		parts = append(parts, o.Scope.ProjectID, o.Scope.ProjectName, o.Scope.DomainID, o.Scope.DomainName, strconv.FormatBool(o.Scope.System), o.Scope.TrustID)
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *TokenFileCache) path(options Options) string {
+	return filepath.Join(c.Dir, tokenCacheKey(options)+".json")
+}
+
+func (c *TokenFileCache) currentTime() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// Get returns the cached token of the options, or nil if there is no token or the token is to be
+// renewed.
+func (c *TokenFileCache) Get(options Options) *tokens3.Token {
+	data, err := os.ReadFile(c.path(options))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			klog.V(4).Infof("failed to read the cached token: %v", err)
+		}
+		return nil
+	}
+
+	var t cachedToken
+	if err := json.Unmarshal(data, &t); err != nil {
+		klog.V(4).Infof("failed to parse the cached token: %v", err)
+		return nil
+	}
+
+	if t.ID == "" || !c.currentTime().Add(c.RenewBefore).Before(t.ExpiresAt) {
+		return nil
+	}
+
+	return &tokens3.Token{ID: t.ID, ExpiresAt: t.ExpiresAt}
+}
+
+// Set caches the token of the options. The file of the token is only readable by the user.
+func (c *TokenFileCache) Set(options Options, token *tokens3.Token) error {
+	data, err := json.Marshal(cachedToken{ID: token.ID, ExpiresAt: token.ExpiresAt})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return fmt.Errorf("failed to create the token cache directory: %v", err)
+	}
+
+	// The token is written to a temporary file then renamed, so that the concurrent executions
+	// never read a partial file
+	f, err := os.CreateTemp(c.Dir, ".token-")
+	if err != nil {
+		return fmt.Errorf("failed to create the token cache file: %v", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write the token cache file: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write the token cache file: %v", err)
+	}
+
+	if err := os.Rename(f.Name(), c.path(options)); err != nil {
+		return fmt.Errorf("failed to write the token cache file: %v", err)
+	}
+
+	return nil
+}
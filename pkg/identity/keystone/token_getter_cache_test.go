@@ -0,0 +1,89 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystone
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	tokens3 "github.com/gophercloud/gophercloud/v2/openstack/identity/v3/tokens"
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+)
+
+func TestTokenFileCache(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := &TokenFileCache{
+		Dir:         filepath.Join(t.TempDir(), "tokens"),
+		RenewBefore: 5 * time.Minute,
+		now:         func() time.Time { return now },
+	}
+
+	options := Options{
+		AuthOptions: gophercloud.AuthOptions{
+			IdentityEndpoint: "https://keystone.example.com/v3",
+			Username:         "testuser",
+			Password:         "testpw",
+			DomainName:       "default",
+		},
+	}
+
+	if token := cache.Get(options); token != nil {
+		t.Fatalf("expected no cached token, got %v", token)
+	}
+
+	err := cache.Set(options, &tokens3.Token{ID: "0123456789", ExpiresAt: now.Add(time.Hour)})
+	th.AssertNoErr(t, err)
+
+	fi, err := os.Stat(cache.path(options))
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, os.FileMode(0600), fi.Mode().Perm())
+
+	token := cache.Get(options)
+	if token == nil {
+		t.Fatal("expected a cached token")
+	}
+	th.AssertEquals(t, "0123456789", token.ID)
+	th.AssertEquals(t, true, token.ExpiresAt.Equal(now.Add(time.Hour)))
+
+	// The secrets are not part of the key
+	options.AuthOptions.Password = "otherpw"
+	if token := cache.Get(options); token == nil {
+		t.Error("expected a cached token with another password")
+	}
+
+	// The tokens of the other users are cached apart
+	other := options
+	other.AuthOptions.Username = "otheruser"
+	if token := cache.Get(other); token != nil {
+		t.Errorf("expected no cached token for another user, got %v", token)
+	}
+
+	// The token is renewed before it expires
+	now = now.Add(56 * time.Minute)
+	if token := cache.Get(options); token != nil {
+		t.Errorf("expected the token to be renewed, got %v", token)
+	}
+
+	// Corrupted files are ignored
+	th.AssertNoErr(t, os.WriteFile(cache.path(options), []byte("{"), 0600))
+	if token := cache.Get(options); token != nil {
+		t.Errorf("expected no token from a corrupted file, got %v", token)
+	}
+}
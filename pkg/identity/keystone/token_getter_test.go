@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"reflect"
 	"testing"
 
 	"github.com/gophercloud/gophercloud/v2"
@@ -109,3 +110,136 @@ func TestTokenGetter(t *testing.T) {
 	_, err = GetToken(context.TODO(), options)
 	th.AssertEquals(t, "You must provide a password to authenticate", err.Error())
 }
+
+func TestTokenGetterMFA(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	const receipt = "receipt-id"
+
+	fakeServer.Mux.HandleFunc("/v3/auth/tokens", func(w http.ResponseWriter, r *http.Request) {
+		var x struct {
+			Auth struct {
+				Identity struct {
+					Methods []string
+					TOTP    struct {
+						User struct{ Passcode string }
+					}
+				}
+			}
+		}
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &x)
+		methods := x.Auth.Identity.Methods
+
+		switch {
+		case reflect.DeepEqual(methods, []string{"password"}):
+			w.Header().Add("Openstack-Auth-Receipt", receipt)
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"receipt": {"methods": ["password"], "expires_at": "2015-11-09T01:42:57.527363Z"},
+				"required_auth_methods": [["password", "totp"]]}`)
+		case reflect.DeepEqual(methods, []string{"totp"}) && r.Header.Get("Openstack-Auth-Receipt") == receipt && x.Auth.Identity.TOTP.User.Passcode == "123456":
+			w.Header().Add("X-Subject-Token", "0123456789")
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"token": {"methods": ["password", "totp"], "expires_at": "2015-11-09T01:42:57.527363Z"}}`)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+
+	options := Options{
+		AuthOptions: gophercloud.AuthOptions{
+			IdentityEndpoint: fakeServer.Endpoint(),
+			Username:         "testuser",
+			Password:         "testpw",
+			DomainName:       "default",
+		},
+	}
+
+	_, err := GetToken(context.TODO(), options)
+	mfaErr, ok := err.(*MFARequiredError)
+	if !ok {
+		t.Fatalf("expected an MFARequiredError, got %v", err)
+	}
+	th.AssertEquals(t, receipt, mfaErr.Receipt)
+	th.AssertDeepEquals(t, []string{"password"}, mfaErr.Methods)
+	th.AssertDeepEquals(t, [][]string{{"password", "totp"}}, mfaErr.RequiredMethods)
+	th.AssertEquals(t, true, mfaErr.RequiresTOTP())
+
+	// The receipt and the passcode complete the authentication
+	options.Receipt = mfaErr.Receipt
+	options.AuthOptions.Password = ""
+	options.AuthOptions.Passcode = "123456"
+
+	token, err := GetToken(context.TODO(), options)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "0123456789", token.ID)
+
+	// Incorrect passcode
+	options.AuthOptions.Passcode = "000000"
+
+	_, err = GetToken(context.TODO(), options)
+	if !gophercloud.ResponseCodeIs(err, http.StatusUnauthorized) {
+		t.Fatalf("expected an unauthorized error, got %v", err)
+	}
+}
+
+func TestMFARequiredErrorRequiresTOTP(t *testing.T) {
+	ts := []struct {
+		methods         []string
+		requiredMethods [][]string
+		expected        bool
+	}{
+		{methods: []string{"password"}, requiredMethods: [][]string{{"password", "totp"}}, expected: true},
+		{methods: []string{"password"}, requiredMethods: [][]string{{"password", "mapped"}}, expected: false},
+		{methods: []string{"password"}, requiredMethods: [][]string{{"password", "mapped"}, {"password", "totp"}}, expected: true},
+		{methods: []string{"password"}, requiredMethods: [][]string{{"application_credential", "totp"}}, expected: false},
+	}
+
+	for _, tt := range ts {
+		e := &MFARequiredError{Methods: tt.methods, RequiredMethods: tt.requiredMethods}
+		if e.RequiresTOTP() != tt.expected {
+			t.Errorf("methods %v, required methods %v: expected %t", tt.methods, tt.requiredMethods, tt.expected)
+		}
+	}
+}
+
+func TestTokenGetterTrust(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	fakeServer.Mux.HandleFunc("/v3/auth/tokens", func(w http.ResponseWriter, r *http.Request) {
+		var x struct {
+			Auth struct {
+				Scope struct {
+					Trust struct{ ID string } `json:"OS-TRUST:trust"`
+				}
+			}
+		}
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &x)
+
+		if x.Auth.Scope.Trust.ID != "trust-id" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Add("X-Subject-Token", "0123456789")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"token": {"methods": ["password"], "expires_at": "2015-11-09T01:42:57.527363Z",
+			"OS-TRUST:trust": {"id": "trust-id", "trustor_user": {"id": "trustor-id"}, "trustee_user": {"id": "trustee-id"}}}}`)
+	})
+
+	options := Options{
+		AuthOptions: gophercloud.AuthOptions{
+			IdentityEndpoint: fakeServer.Endpoint(),
+			Username:         "trustee",
+			Password:         "testpw",
+			DomainName:       "default",
+			Scope:            &gophercloud.AuthScope{TrustID: "trust-id"},
+		},
+	}
+
+	token, err := GetToken(context.TODO(), options)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "0123456789", token.ID)
+}
@@ -2,62 +2,172 @@ package barbican
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
 
 	"github.com/gophercloud/gophercloud/v2"
 	"github.com/gophercloud/gophercloud/v2/openstack"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/tokens"
 	"github.com/gophercloud/gophercloud/v2/openstack/keymanager/v1/secrets"
 	"k8s.io/cloud-provider-openstack/pkg/client"
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
 	"k8s.io/klog/v2"
 )
 
 type KMSOpts struct {
+	// KeyID is the key the data is encrypted with
 	KeyID string `gcfg:"key-id"`
+	// ContainerName is the name of the container of the key, used if KeyID is not set
+	ContainerName string `gcfg:"container-name"`
+	// CreateKey creates the container of ContainerName if it doesn't exist, it is meant to be set
+	// on the first start only
+	CreateKey bool `gcfg:"create-key"`
+	// PreviousKeyIDs are the keys the data was encrypted with before rotating to KeyID, the data
+	// encrypted with them is still decrypted until it is rewritten
+	PreviousKeyIDs []string `gcfg:"previous-key-id"`
+	// FailoverRegions are the regions of the standby Barbican endpoints, tried in order when the
+	// endpoint of the region of the cloud is unreachable
+	FailoverRegions []string `gcfg:"failover-region"`
+	// FailoverURLs are the URLs of the standby Barbican endpoints, tried after FailoverRegions
+	FailoverURLs []string `gcfg:"failover-url"`
+}
+
+// KeyOpts are the options of a named key, served on its own socket so that it can be selected by
+// a kms provider of the encryption configuration, e.g. to encrypt each resource with its own key
+type KeyOpts struct {
+	KeyID          string   `gcfg:"key-id"`
+	ContainerName  string   `gcfg:"container-name"`
+	CreateKey      bool     `gcfg:"create-key"`
+	PreviousKeyIDs []string `gcfg:"previous-key-id"`
+	SocketPath     string   `gcfg:"socket-path"`
 }
 
 // Config to read config options
 type Config struct {
 	Global     client.AuthOpts
 	KeyManager KMSOpts
+	// Key are the named keys, by name
+	Key map[string]*KeyOpts
 }
 
 // Barbican is gophercloud service client
 type Barbican struct {
 	Client *gophercloud.ServiceClient
+	// FailoverClients are the clients of the standby Barbican endpoints, tried in order when
+	// Client is unreachable
+	FailoverClients []*gophercloud.ServiceClient
+	// UserID is the ID of the Keystone user the clients are authenticated with
+	UserID string
 }
 
-// NewBarbicanClient creates new BarbicanClient
-func NewBarbicanClient(cfg Config) (*gophercloud.ServiceClient, error) {
+// ReadClouds completes the credentials of the config with the ones of clouds.yaml, if use-clouds
+// is set
+func ReadClouds(cfg *Config) error {
 	if cfg.Global.UseClouds {
 		if cfg.Global.CloudsFile != "" {
 			os.Setenv("OS_CLIENT_CONFIG_FILE", cfg.Global.CloudsFile)
 		}
 		if err := client.ReadClouds(&cfg.Global); err != nil {
-			return nil, err
+			return err
 		}
 		klog.V(5).Infof("Config, loaded from the %s:", cfg.Global.CloudsFile)
 		client.LogCfg(cfg.Global)
 	}
+	return nil
+}
 
+// NewBarbican creates new Barbican with the clients of the Barbican endpoint of the cloud and of
+// the standby endpoints, authenticated with the credentials of the config, which must have been
+// completed by ReadClouds
+func NewBarbican(cfg Config) (*Barbican, error) {
 	provider, err := client.NewOpenStackClient(&cfg.Global, "barbican-kms-plugin")
 	if err != nil {
 		return nil, err
 	}
 
-	return openstack.NewKeyManagerV1(provider, gophercloud.EndpointOpts{
+	client, err := openstack.NewKeyManagerV1(provider, gophercloud.EndpointOpts{
 		Region:       cfg.Global.Region,
 		Availability: cfg.Global.EndpointType,
 	})
+	if err != nil {
+		return nil, err
+	}
+	barbican := &Barbican{Client: client}
+
+	if result, ok := provider.GetAuthResult().(tokens.CreateResult); ok {
+		if user, err := result.ExtractUser(); err == nil {
+			barbican.UserID = user.ID
+		}
+	}
+
+	for _, region := range cfg.KeyManager.FailoverRegions {
+		client, err := openstack.NewKeyManagerV1(provider, gophercloud.EndpointOpts{
+			Region:       region,
+			Availability: cfg.Global.EndpointType,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the Barbican endpoint of failover region %s: %v", region, err)
+		}
+		barbican.FailoverClients = append(barbican.FailoverClients, client)
+	}
+
+	for _, url := range cfg.KeyManager.FailoverURLs {
+		barbican.FailoverClients = append(barbican.FailoverClients, &gophercloud.ServiceClient{
+			ProviderClient: provider,
+			Endpoint:       gophercloud.NormalizeURL(url),
+			ResourceBase:   gophercloud.NormalizeURL(url) + "v1/",
+		})
+	}
+
+	return barbican, nil
+}
+
+// isUnreachable returns whether the request failed because Barbican is unreachable or failing,
+// rather than because of the request itself, e.g. a missing secret.
+func isUnreachable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var codeError gophercloud.ErrUnexpectedResponseCode
+	if errors.As(err, &codeError) {
+		return codeError.Actual >= http.StatusInternalServerError
+	}
+	return true
 }
 
-// GetSecret gets unencrypted secret
+// GetSecret gets unencrypted secret, from the standby endpoints if the Barbican endpoint of the
+// cloud is unreachable
 func (barbican *Barbican) GetSecret(ctx context.Context, keyID string) ([]byte, error) {
+	key, err := getSecret(ctx, barbican.Client, keyID)
+	for _, client := range barbican.FailoverClients {
+		if err == nil || !isUnreachable(ctx, err) {
+			break
+		}
+		klog.Warningf("Failed to get key %s, failing over to %s: %v", keyID, client.Endpoint, err)
+
+		key, err = getSecret(ctx, client, keyID)
+		if err == nil {
+			klog.V(4).Infof("Got key %s from failover endpoint %s", keyID, client.Endpoint)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func getSecret(ctx context.Context, client *gophercloud.ServiceClient, keyID string) ([]byte, error) {
 	opts := secrets.GetPayloadOpts{
 		PayloadContentType: "application/octet-stream",
 	}
 
-	key, err := secrets.GetPayload(ctx, barbican.Client, keyID, opts).Extract()
-	if err != nil {
+	mc := metrics.NewMetricContext("secret_payload", "get")
+	key, err := secrets.GetPayload(ctx, client, keyID, opts).Extract()
+	if mc.ObserveRequest(err) != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,156 @@
+package barbican
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/keymanager/v1/containers"
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	"github.com/gophercloud/gophercloud/v2/testhelper/client"
+)
+
+func TestGetSecretFailover(t *testing.T) {
+	primary := th.SetupHTTP()
+	defer primary.Teardown()
+	standby := th.SetupHTTP()
+	defer standby.Teardown()
+
+	primary.Mux.HandleFunc("/secrets/unavailable/payload", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	primary.Mux.HandleFunc("/secrets/missing/payload", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	var standbyRequests int
+	for _, id := range []string{"unavailable", "missing"} {
+		standby.Mux.HandleFunc("/secrets/"+id+"/payload", func(w http.ResponseWriter, r *http.Request) {
+			standbyRequests++
+			w.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = w.Write([]byte("key"))
+		})
+	}
+
+	b := &Barbican{
+		Client:          client.ServiceClient(primary),
+		FailoverClients: []*gophercloud.ServiceClient{client.ServiceClient(standby)},
+	}
+
+	// The standby endpoint is used when the primary one fails
+	key, err := b.GetSecret(context.TODO(), "unavailable")
+	if err != nil || !bytes.Equal(key, []byte("key")) {
+		t.Errorf("unexpected key %q: %v", key, err)
+	}
+
+	// A missing secret doesn't fail over
+	if _, err := b.GetSecret(context.TODO(), "missing"); !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+
+	if standbyRequests != 1 {
+		t.Errorf("expected 1 request to the standby endpoint, got %d", standbyRequests)
+	}
+
+	// An unreachable primary endpoint fails over
+	primary.Teardown()
+	key, err = b.GetSecret(context.TODO(), "missing")
+	if err != nil || !bytes.Equal(key, []byte("key")) {
+		t.Errorf("unexpected key %q: %v", key, err)
+	}
+}
+
+func TestEnsureKey(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	// stored are the containers listed, concurrent is the container created by another replica
+	// at the same time as the next one
+	var stored []string
+	var concurrent string
+	var deleted []string
+	fakeServer.Mux.HandleFunc("/containers", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case "GET":
+			th.TestFormValues(t, r, map[string]string{"name": "k8s"})
+			fmt.Fprintf(w, `{"containers": [%s], "total": %d}`, strings.Join(stored, ","), len(stored))
+		case "POST":
+			var body containers.CreateOpts
+			th.AssertNoErr(t, json.NewDecoder(r.Body).Decode(&body))
+			th.AssertEquals(t, "k8s", body.Name)
+			refs, _ := json.Marshal(body.SecretRefs)
+			stored = append(stored, fmt.Sprintf(`{"name": "k8s", "container_ref": "%s/containers/container", "created": "2024-01-01T10:00:01", "secret_refs": %s}`, fakeServer.Server.URL, refs))
+			if concurrent != "" {
+				stored = append(stored, concurrent)
+			}
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"container_ref": "%s/containers/container"}`, fakeServer.Server.URL)
+		}
+	})
+	for _, u := range []string{"/containers/container", "/secrets/key"} {
+		fakeServer.Mux.HandleFunc(u, func(w http.ResponseWriter, r *http.Request) {
+			th.TestMethod(t, r, "DELETE")
+			deleted = append(deleted, u)
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+
+	var keys int
+	fakeServer.Mux.HandleFunc("/secrets", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		keys++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"secret_ref": "%s/secrets/key"}`, fakeServer.Server.URL)
+	})
+
+	acl := `{"read": {"users": ["user"], "project-access": false}}`
+	var acls []string
+	for _, u := range []string{"/secrets/key/acl", "/containers/container/acl"} {
+		fakeServer.Mux.HandleFunc(u, func(w http.ResponseWriter, r *http.Request) {
+			th.TestMethod(t, r, "PUT")
+			th.TestJSONRequest(t, r, acl)
+			acls = append(acls, u)
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"acl_ref": "%s%s"}`, fakeServer.Server.URL, u)
+		})
+	}
+
+	b := &Barbican{Client: client.ServiceClient(fakeServer), UserID: "user"}
+
+	// The key isn't created unless create-key is set
+	_, err := b.EnsureKey(context.TODO(), "k8s", false)
+	if err == nil {
+		t.Fatal("expected an error when the container doesn't exist")
+	}
+	th.AssertEquals(t, 0, keys)
+
+	// The key is created on the first call only, the ACLs of the existing containers are left as is
+	for i := 0; i < 2; i++ {
+		keyID, err := b.EnsureKey(context.TODO(), "k8s", true)
+		th.AssertNoErr(t, err)
+		th.AssertEquals(t, "key", keyID)
+	}
+	th.AssertEquals(t, 1, keys)
+	th.AssertDeepEquals(t, []string{"/secrets/key/acl", "/containers/container/acl"}, acls)
+
+	// The oldest container is used when another replica created one at the same time, the
+	// container created by this replica is deleted
+	stored = nil
+	concurrent = fmt.Sprintf(`{"name": "k8s", "container_ref": "%s/containers/other", "created": "2024-01-01T10:00:00", "secret_refs": [{"name": "kek", "secret_ref": "%s/secrets/other-key"}]}`, fakeServer.Server.URL, fakeServer.Server.URL)
+	keyID, err := b.EnsureKey(context.TODO(), "k8s", true)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "other-key", keyID)
+	th.AssertDeepEquals(t, []string{"/containers/container", "/secrets/key"}, deleted)
+
+	// The replicas which start later use the oldest container too
+	keyID, err = b.EnsureKey(context.TODO(), "k8s", false)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "other-key", keyID)
+}
@@ -0,0 +1,151 @@
+package barbican
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"path"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/keymanager/v1/acls"
+	"github.com/gophercloud/gophercloud/v2/openstack/keymanager/v1/containers"
+	"github.com/gophercloud/gophercloud/v2/openstack/keymanager/v1/secrets"
+	"k8s.io/klog/v2"
+)
+
+// kekSecretName is the name of the reference of the key in the containers created by the plugin
+const kekSecretName = "kek"
+
+// EnsureKey returns the ID of the key of the container with the given name. If the container
+// doesn't exist and create is set, a 256-bit AES key is generated and stored in a new container,
+// whose ACLs grant access only to the user of the plugin. The ACLs of the existing containers are
+// left as is. When several containers have the name, e.g. when several replicas created one at
+// the same time, the oldest is used, so that all the replicas converge on the same key.
+func (barbican *Barbican) EnsureKey(ctx context.Context, containerName string, create bool) (string, error) {
+	cs, err := barbican.listContainers(ctx, containerName)
+	if err != nil {
+		return "", err
+	}
+	if len(cs) == 0 {
+		// The containers of another user may not be listed, so the key is only created when asked
+		// to, on the first start
+		if !create {
+			return "", fmt.Errorf("container %s not found, set create-key to create it", containerName)
+		}
+		created, err := barbican.createKeyContainer(ctx, containerName)
+		if err != nil {
+			return "", err
+		}
+		if cs, err = barbican.listContainers(ctx, containerName); err != nil {
+			return "", err
+		}
+		if oldest := oldestContainer(cs); oldest != nil && oldest.ContainerRef != created.ContainerRef {
+			klog.Infof("Container %s was created concurrently, using %s", containerName, oldest.ContainerRef)
+			barbican.deleteKeyContainer(ctx, created)
+		}
+	}
+
+	oldest := oldestContainer(cs)
+	if oldest == nil {
+		return "", fmt.Errorf("container %s not found after it was created", containerName)
+	}
+	if len(cs) > 1 {
+		klog.Warningf("Found %d containers named %s, using the oldest %s", len(cs), containerName, oldest.ContainerRef)
+	}
+	for _, ref := range oldest.SecretRefs {
+		if ref.Name == kekSecretName {
+			return path.Base(ref.SecretRef), nil
+		}
+	}
+	return "", fmt.Errorf("container %s has no secret named %s", containerName, kekSecretName)
+}
+
+// listContainers lists the containers with the given name
+func (barbican *Barbican) listContainers(ctx context.Context, containerName string) ([]containers.Container, error) {
+	pages, err := containers.List(barbican.Client, containers.ListOpts{Name: containerName}).AllPages(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %v", err)
+	}
+	cs, err := containers.ExtractContainers(pages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %v", err)
+	}
+	return cs, nil
+}
+
+// oldestContainer returns the container created first, the ties are broken by reference
+func oldestContainer(cs []containers.Container) *containers.Container {
+	var oldest *containers.Container
+	for i := range cs {
+		c := &cs[i]
+		if oldest == nil || c.Created.Before(oldest.Created) || (c.Created.Equal(oldest.Created) && c.ContainerRef < oldest.ContainerRef) {
+			oldest = c
+		}
+	}
+	return oldest
+}
+
+// deleteKeyContainer deletes a container created by the plugin and its key, which were never used
+func (barbican *Barbican) deleteKeyContainer(ctx context.Context, c *containers.Container) {
+	if err := containers.Delete(ctx, barbican.Client, path.Base(c.ContainerRef)).ExtractErr(); err != nil {
+		klog.Errorf("Failed to delete container %s: %v", c.ContainerRef, err)
+		return
+	}
+	for _, ref := range c.SecretRefs {
+		if err := secrets.Delete(ctx, barbican.Client, path.Base(ref.SecretRef)).ExtractErr(); err != nil {
+			klog.Errorf("Failed to delete key %s: %v", ref.SecretRef, err)
+		}
+	}
+}
+
+// createKeyContainer generates a key and stores it in a new container, it returns the container.
+// The ACL of the key is set before the container is created, so that a container is only found on
+// the next starts once its key is only readable by the user of the plugin.
+func (barbican *Barbican) createKeyContainer(ctx context.Context, containerName string) (*containers.Container, error) {
+	if barbican.UserID == "" {
+		return nil, fmt.Errorf("failed to find the user of the plugin to grant access to container %s", containerName)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	secret, err := secrets.Create(ctx, barbican.Client, secrets.CreateOpts{
+		Algorithm:              "aes",
+		BitLength:              256,
+		Mode:                   "cbc",
+		Name:                   containerName,
+		Payload:                base64.StdEncoding.EncodeToString(key),
+		PayloadContentType:     "application/octet-stream",
+		PayloadContentEncoding: "base64",
+		SecretType:             secrets.SymmetricSecret,
+	}).Extract()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key: %v", err)
+	}
+	secretID := path.Base(secret.SecretRef)
+
+	// Only the user of the plugin may read the key, regardless of the roles in the project
+	projectAccess := false
+	aclOpts := acls.SetOpts{{Type: "read", Users: &[]string{barbican.UserID}, ProjectAccess: &projectAccess}}
+	if _, err := acls.SetSecretACL(ctx, barbican.Client, secretID, aclOpts).Extract(); err != nil {
+		return nil, fmt.Errorf("failed to set the ACL of key %s: %v", secretID, err)
+	}
+
+	container, err := containers.Create(ctx, barbican.Client, containers.CreateOpts{
+		Type:       containers.GenericContainer,
+		Name:       containerName,
+		SecretRefs: []containers.SecretRef{{Name: kekSecretName, SecretRef: secret.SecretRef}},
+	}).Extract()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create container %s: %v", containerName, err)
+	}
+	if _, err := acls.SetContainerACL(ctx, barbican.Client, path.Base(container.ContainerRef), aclOpts).Extract(); err != nil {
+		return nil, fmt.Errorf("failed to set the ACL of container %s: %v", containerName, err)
+	}
+
+	klog.Infof("Created key %s in container %s", secretID, containerName)
+	container.SecretRefs = []containers.SecretRef{{Name: kekSecretName, SecretRef: secret.SecretRef}}
+	return container, nil
+}
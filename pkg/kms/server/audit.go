@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"k8s.io/klog/v2"
+	pbv1 "k8s.io/kms/apis/v1beta1"
+	pb "k8s.io/kms/apis/v2"
+)
+
+// auditEvent records the usage of a key to encrypt or decrypt data
+type auditEvent struct {
+	Time       time.Time `json:"time"`
+	Operation  string    `json:"operation"`
+	APIVersion string    `json:"apiVersion"`
+	KeyID      string    `json:"keyID"`
+	// RequestUID is the UID of the KMS v2 request, generated by the kube-apiserver
+	RequestUID string       `json:"requestUID,omitempty"`
+	Caller     *auditCaller `json:"caller,omitempty"`
+	Result     string       `json:"result"`
+	Error      string       `json:"error,omitempty"`
+}
+
+// auditCaller is the process which connected to the socket of the plugin, e.g. the kube-apiserver
+type auditCaller struct {
+	UID uint32 `json:"uid"`
+	PID int32  `json:"pid"`
+}
+
+// peerCredAddr is the address of the connections to the socket, with the credentials of the
+// process which connected, if known
+type peerCredAddr struct {
+	net.Addr
+	caller *auditCaller
+}
+
+// auditLogger writes the encrypt and decrypt operations as JSON lines to a file. The successful
+// operations are sampled, the failed ones are always written.
+type auditLogger struct {
+	mu  sync.Mutex
+	out io.Writer
+
+	sampleRate float64
+	rand       func() float64
+}
+
+// newAuditLogger returns the audit logger writing to the path, or nil if the path is empty. The
+// path "-" means the standard output.
+func newAuditLogger(path string, sampleRate float64) (*auditLogger, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if sampleRate <= 0 || sampleRate > 1 {
+		return nil, fmt.Errorf("audit sample rate %v must be greater than 0 and at most 1", sampleRate)
+	}
+
+	l := &auditLogger{sampleRate: sampleRate, rand: rand.Float64}
+	if path == "-" {
+		l.out = os.Stdout
+	} else {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log file %s: %v", path, err)
+		}
+		l.out = f
+	}
+
+	return l, nil
+}
+
+// log writes the audit event, unless the event is successful and not sampled
+func (l *auditLogger) log(e *auditEvent) {
+	if e.Error == "" && l.sampleRate < 1 && l.rand() >= l.sampleRate {
+		return
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		klog.Errorf("failed to encode audit event: %v", err)
+		return
+	}
+
+	l.mu.Lock()
+	_, err = l.out.Write(append(data, '\n'))
+	l.mu.Unlock()
+	if err != nil {
+		klog.Errorf("failed to write audit event: %v", err)
+	}
+}
+
+// auditGRPC records the encrypt and decrypt RPCs in the audit log, with the key they use
+func (s *KMSserver) auditGRPC(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if s.audit == nil {
+		return resp, err
+	}
+
+	e := &auditEvent{
+		Time:   time.Now().UTC(),
+		KeyID:  s.cfg.KeyManager.KeyID,
+		Result: "success",
+	}
+
+	switch r := req.(type) {
+	case *pb.EncryptRequest:
+		e.APIVersion, e.Operation, e.RequestUID = version, "encrypt", r.Uid
+		if res, ok := resp.(*pb.EncryptResponse); ok && res.KeyId != "" {
+			e.KeyID = res.KeyId
+		}
+	case *pb.DecryptRequest:
+		e.APIVersion, e.Operation, e.RequestUID = version, "decrypt", r.Uid
+		if r.KeyId != "" {
+			e.KeyID = r.KeyId
+		}
+	case *pbv1.EncryptRequest:
+		e.APIVersion, e.Operation = versionV1, "encrypt"
+	case *pbv1.DecryptRequest:
+		e.APIVersion, e.Operation = versionV1, "decrypt"
+	default:
+		// The status, version and health RPCs don't use the key to encrypt or decrypt data
+		return resp, err
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		if addr, ok := p.Addr.(peerCredAddr); ok {
+			e.Caller = addr.caller
+		}
+	}
+
+	if err != nil {
+		e.Result = "failure"
+		e.Error = err.Error()
+	}
+
+	s.audit.log(e)
+
+	return resp, err
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	pbv1 "k8s.io/kms/apis/v1beta1"
+	pb "k8s.io/kms/apis/v2"
+)
+
+func TestAuditGRPC(t *testing.T) {
+	out := &bytes.Buffer{}
+	s := &KMSserver{
+		barbican: failingBarbican{},
+		audit:    &auditLogger{out: out, sampleRate: 1},
+	}
+	s.cfg.KeyManager.KeyID = "current"
+
+	caller := &auditCaller{UID: 1000, PID: 42}
+	ctx := peer.NewContext(context.TODO(), &peer.Peer{Addr: peerCredAddr{Addr: &net.UnixAddr{Name: "@", Net: "unix"}, caller: caller}})
+	info := &grpc.UnaryServerInfo{}
+
+	for _, tt := range []struct {
+		req     interface{}
+		handler grpc.UnaryHandler
+	}{
+		{req: &pb.EncryptRequest{Uid: "encrypt"}, handler: func(_ context.Context, _ interface{}) (interface{}, error) {
+			return &pb.EncryptResponse{KeyId: "current"}, nil
+		}},
+		{req: &pb.DecryptRequest{Uid: "decrypt", KeyId: "previous"}, handler: func(ctx context.Context, req interface{}) (interface{}, error) {
+			return s.Decrypt(ctx, req.(*pb.DecryptRequest))
+		}},
+		{req: &pbv1.DecryptRequest{}, handler: func(_ context.Context, _ interface{}) (interface{}, error) {
+			return &pbv1.DecryptResponse{}, nil
+		}},
+		{req: &pb.StatusRequest{}, handler: func(_ context.Context, _ interface{}) (interface{}, error) {
+			return &pb.StatusResponse{}, nil
+		}},
+	} {
+		_, _ = s.auditGRPC(ctx, tt.req, info, tt.handler)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 audit events, got %d: %s", len(lines), out)
+	}
+
+	expected := []auditEvent{
+		{Operation: "encrypt", APIVersion: "v2", KeyID: "current", RequestUID: "encrypt", Result: "success"},
+		{Operation: "decrypt", APIVersion: "v2", KeyID: "previous", RequestUID: "decrypt", Result: "failure"},
+		{Operation: "decrypt", APIVersion: "v1beta1", KeyID: "current", Result: "success"},
+	}
+	for i, line := range lines {
+		var e auditEvent
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Operation != expected[i].Operation || e.APIVersion != expected[i].APIVersion || e.KeyID != expected[i].KeyID ||
+			e.RequestUID != expected[i].RequestUID || e.Result != expected[i].Result {
+			t.Errorf("expected audit event %+v, got %+v", expected[i], e)
+		}
+		if (e.Result == "failure") != (e.Error != "") {
+			t.Errorf("expected an error only for a failure, got %+v", e)
+		}
+		if e.Caller == nil || *e.Caller != *caller {
+			t.Errorf("expected caller %+v, got %+v", caller, e.Caller)
+		}
+	}
+}
+
+func TestAuditSampling(t *testing.T) {
+	out := &bytes.Buffer{}
+	l := &auditLogger{out: out, sampleRate: 0.5}
+
+	for _, r := range []float64{0.2, 0.7} {
+		l.rand = func() float64 { return r }
+		l.log(&auditEvent{Result: "success"})
+		l.log(&auditEvent{Result: "failure", Error: "unavailable"})
+	}
+
+	// A single success is sampled, the failures are always written
+	if n := strings.Count(out.String(), "\n"); n != 3 {
+		t.Errorf("expected 3 audit events, got %d: %s", n, out)
+	}
+}
+
+func TestNewAuditLogger(t *testing.T) {
+	if l, err := newAuditLogger("", 1); l != nil || err != nil {
+		t.Errorf("expected no audit logger, got %v, %v", l, err)
+	}
+
+	for _, rate := range []float64{0, -1, 1.5} {
+		if _, err := newAuditLogger("-", rate); err == nil {
+			t.Errorf("expected an error for sample rate %v", rate)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := newAuditLogger(path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.log(&auditEvent{Operation: "encrypt", Result: "success"})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"operation":"encrypt"`) {
+		t.Errorf("expected the audit event in the file, got %s", data)
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cloud-provider-openstack/pkg/kms/barbican"
+	"k8s.io/klog/v2"
+)
+
+// reloadCredentials authenticates with the credentials of the cloud config file, and of
+// clouds.yaml if use-clouds is set, if they changed. The current credentials are kept if the new
+// ones fail to authenticate or to read any of the keys, e.g. as the new credentials are of another
+// user, which the ACLs of the keys don't grant access to. The servers of the named keys use the new
+// credentials too. The keys and the failover endpoints are not reloaded.
+func (s *KMSserver) reloadCredentials(configFilePath string, newBarbican func(barbican.Config) (BarbicanService, error)) error {
+	var cfg barbican.Config
+	if err := initConfig(configFilePath, &cfg); err != nil {
+		return fmt.Errorf("failed to read the cloud config: %v", err)
+	}
+	if err := barbican.ReadClouds(&cfg); err != nil {
+		return fmt.Errorf("failed to read clouds.yaml: %v", err)
+	}
+
+	if cfg.Global == s.cfg.Global {
+		return nil
+	}
+	klog.Infof("Credentials of the cloud config changed, authenticating with the new credentials")
+
+	cfg.KeyManager = s.cfg.KeyManager
+	b, err := newBarbican(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to authenticate with the new credentials: %v", err)
+	}
+
+	for _, ks := range append([]*KMSserver{s}, s.keyServers...) {
+		for _, keyID := range ks.keyIDs() {
+			if _, err := b.GetSecret(context.TODO(), keyID); err != nil {
+				return fmt.Errorf("failed to get key %s with the new credentials: %v", keyID, err)
+			}
+		}
+	}
+
+	s.setBarbican(b)
+	s.cfg.Global = cfg.Global
+
+	klog.Infof("Credentials of the cloud config are reloaded")
+	return nil
+}
+
+// watchCredentials reloads the credentials at every interval, until stopCh is closed.
+func (s *KMSserver) watchCredentials(configFilePath string, interval time.Duration, stopCh <-chan struct{}) {
+	klog.Infof("Reloading the credentials from %s every %s", configFilePath, interval)
+	wait.Until(func() {
+		err := s.reloadCredentials(configFilePath, func(cfg barbican.Config) (BarbicanService, error) {
+			return barbican.NewBarbican(cfg)
+		})
+		if err != nil {
+			klog.Errorf("Failed to reload the credentials, keeping the current ones: %v", err)
+		}
+	}, interval, stopCh)
+}
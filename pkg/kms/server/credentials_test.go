@@ -0,0 +1,73 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/cloud-provider-openstack/pkg/kms/barbican"
+)
+
+func TestReloadCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cloud.conf")
+	writeConfig := func(secret string) {
+		t.Helper()
+		config := "[Global]\nauth-url = https://keystone.example.com/v3\napplication-credential-id = id\napplication-credential-secret = " + secret + "\n[KeyManager]\nkey-id = key\n"
+		if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeConfig("secret")
+	s := &KMSserver{barbican: failingBarbican{}}
+	if err := initConfig(path, &s.cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	var authenticated []string
+	newBarbican := func(cfg barbican.Config) (BarbicanService, error) {
+		authenticated = append(authenticated, cfg.Global.ApplicationCredentialSecret)
+		switch cfg.Global.ApplicationCredentialSecret {
+		case "invalid":
+			return nil, errors.New("unauthorized")
+		case "other-user":
+			return failingBarbican{}, nil
+		}
+		return &barbican.FakeBarbican{}, nil
+	}
+
+	// The unchanged credentials are not reloaded
+	if err := s.reloadCredentials(path, newBarbican); err != nil || len(authenticated) != 0 {
+		t.Fatalf("expected no reload, got %v: %v", authenticated, err)
+	}
+
+	// The invalid credentials are not used
+	writeConfig("invalid")
+	if err := s.reloadCredentials(path, newBarbican); err == nil {
+		t.Fatal("expected an error for the invalid credentials")
+	}
+	if _, ok := s.barbican.(failingBarbican); !ok || s.cfg.Global.ApplicationCredentialSecret != "secret" {
+		t.Fatalf("expected the current credentials to be kept")
+	}
+
+	// The credentials which can't read the key are not used either
+	writeConfig("other-user")
+	if err := s.reloadCredentials(path, newBarbican); err == nil {
+		t.Fatal("expected an error for the credentials which can't read the key")
+	}
+	if s.cfg.Global.ApplicationCredentialSecret != "secret" {
+		t.Fatalf("expected the current credentials to be kept")
+	}
+
+	writeConfig("rotated")
+	if err := s.reloadCredentials(path, newBarbican); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.barbican.(*barbican.FakeBarbican); !ok || s.cfg.Global.ApplicationCredentialSecret != "rotated" {
+		t.Fatalf("expected the rotated credentials to be used")
+	}
+	if s.cfg.KeyManager.KeyID != "key" {
+		t.Errorf("expected the key to be kept, got %q", s.cfg.KeyManager.KeyID)
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// dekCache caches the decrypted DEKs, keyed by the SHA-256 hash of the key ID and the cipher, so
+// that the data encrypted with the same DEK is decrypted without fetching the key from Barbican.
+type dekCache struct {
+	ttl     time.Duration
+	size    int
+	now     func() time.Time
+	mu      sync.Mutex
+	entries map[string]*dekCacheEntry
+}
+
+type dekCacheEntry struct {
+	plain     []byte
+	expiresAt time.Time
+}
+
+func newDEKCache(ttl time.Duration, size int) *dekCache {
+	return &dekCache{
+		ttl:     ttl,
+		size:    size,
+		now:     time.Now,
+		entries: make(map[string]*dekCacheEntry),
+	}
+}
+
+func dekCacheKey(keyID string, cipher []byte) string {
+	h := sha256.New()
+	h.Write([]byte(keyID))
+	h.Write([]byte{0})
+	h.Write(cipher)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// get returns a copy of the cached DEK, if it didn't expire.
+func (c *dekCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(e.expiresAt) {
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	return slices.Clone(e.plain), true
+}
+
+// add caches the DEK until the TTL of the cache elapses, unless the cache is full of unexpired
+// DEKs.
+func (c *dekCache) add(key string, plain []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	if len(c.entries) >= c.size {
+		maps.DeleteFunc(c.entries, func(_ string, e *dekCacheEntry) bool {
+			return !now.Before(e.expiresAt)
+		})
+
+		if len(c.entries) >= c.size {
+			klog.V(4).Infof("DEK cache is full, not caching the DEK")
+			return
+		}
+	}
+
+	c.entries[key] = &dekCacheEntry{plain: slices.Clone(plain), expiresAt: now.Add(c.ttl)}
+}
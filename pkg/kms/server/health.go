@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog/v2"
+	pbv1 "k8s.io/kms/apis/v1beta1"
+	pb "k8s.io/kms/apis/v2"
+)
+
+// healthServer implements the gRPC health checking protocol for the whole server and for the KMS
+// services, which are serving if the keys can be fetched from Barbican.
+type healthServer struct {
+	healthpb.UnimplementedHealthServer
+	kms *KMSserver
+}
+
+// Check returns the serving status of the service
+func (h *healthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	switch req.Service {
+	case "", pb.KeyManagementService_ServiceDesc.ServiceName, pbv1.KeyManagementService_ServiceDesc.ServiceName:
+	default:
+		return nil, status.Errorf(codes.NotFound, "unknown service %s", req.Service)
+	}
+
+	if err := h.kms.checkKeys(ctx); err != nil {
+		klog.V(4).Infof("Health check failed: %v", err)
+		return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING}, nil
+	}
+
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+// serveMetrics serves the metrics on the /metrics path of the given address
+func serveMetrics(address string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", legacyregistry.HandlerWithReset())
+
+	klog.Infof("Serving metrics on %s", address)
+
+	if err := http.ListenAndServe(address, mux); err != nil {
+		klog.Fatalf("failed to listen & serve metrics on %s: %v", address, err)
+	}
+}
+
+// observeGRPC records the latency and the result of the KMS RPCs
+func observeGRPC(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	mc := metrics.NewKMSMetricContext(strings.TrimPrefix(info.FullMethod, "/"))
+	resp, err := handler(ctx, req)
+	return resp, mc.ObserveKMSOperation(err)
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"k8s.io/cloud-provider-openstack/pkg/kms/barbican"
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestHealthCheck(t *testing.T) {
+	for _, tt := range []struct {
+		service  string
+		barbican BarbicanService
+		expected healthpb.HealthCheckResponse_ServingStatus
+		code     codes.Code
+	}{
+		{service: "", barbican: &barbican.FakeBarbican{}, expected: healthpb.HealthCheckResponse_SERVING},
+		{service: "v2.KeyManagementService", barbican: &barbican.FakeBarbican{}, expected: healthpb.HealthCheckResponse_SERVING},
+		{service: "v1beta1.KeyManagementService", barbican: failingBarbican{}, expected: healthpb.HealthCheckResponse_NOT_SERVING},
+		{service: "other", barbican: &barbican.FakeBarbican{}, code: codes.NotFound},
+	} {
+		h := &healthServer{kms: &KMSserver{barbican: tt.barbican}}
+
+		res, err := h.Check(context.TODO(), &healthpb.HealthCheckRequest{Service: tt.service})
+		if status.Code(err) != tt.code {
+			t.Errorf("service %q: expected code %v, got %v", tt.service, tt.code, err)
+			continue
+		}
+		if res.GetStatus() != tt.expected {
+			t.Errorf("service %q: expected status %v, got %v", tt.service, tt.expected, res.GetStatus())
+		}
+	}
+}
+
+func TestObserveGRPC(t *testing.T) {
+	metrics.RegisterMetrics("barbican-kms-plugin")
+
+	info := grpc.UnaryServerInfo{
+		FullMethod: "/v2.KeyManagementService/Decrypt",
+	}
+	ok := func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil }
+	unavailable := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Unavailable, "barbican unavailable")
+	}
+
+	_, _ = observeGRPC(context.Background(), nil, &info, ok)
+	if _, err := observeGRPC(context.Background(), nil, &info, unavailable); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected the error of the handler, got %v", err)
+	}
+
+	expected := `
+# HELP barbican_kms_operation_errors_total [ALPHA] Total number of errors for a KMS RPC served by barbican-kms-plugin
+# TYPE barbican_kms_operation_errors_total counter
+barbican_kms_operation_errors_total{grpc_code="Unavailable",method="v2.KeyManagementService/Decrypt"} 1
+# HELP barbican_kms_operations_total [ALPHA] Total number of KMS RPCs served by barbican-kms-plugin
+# TYPE barbican_kms_operations_total counter
+barbican_kms_operations_total{grpc_code="OK",method="v2.KeyManagementService/Decrypt"} 1
+barbican_kms_operations_total{grpc_code="Unavailable",method="v2.KeyManagementService/Decrypt"} 1
+`
+	if err := testutil.GatherAndCompare(legacyregistry.DefaultGatherer, strings.NewReader(expected), "barbican_kms_operations_total", "barbican_kms_operation_errors_total"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,61 @@
+//go:build linux
+
+package server
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
+)
+
+// peerCredListener records the credentials of the processes which connect to the unix socket in
+// the remote address of their connections, which is the address of the gRPC peer.
+type peerCredListener struct {
+	net.Listener
+}
+
+type peerCredConn struct {
+	net.Conn
+	addr net.Addr
+}
+
+func (c *peerCredConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+func newPeerCredListener(l net.Listener) net.Listener {
+	return peerCredListener{Listener: l}
+}
+
+func (l peerCredListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return conn, nil
+	}
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		klog.V(4).Infof("Failed to get the credentials of the peer: %v", err)
+		return conn, nil
+	}
+
+	var cred *unix.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil || credErr != nil {
+		klog.V(4).Infof("Failed to get the credentials of the peer: %v, %v", err, credErr)
+		return conn, nil
+	}
+
+	return &peerCredConn{
+		Conn: conn,
+		addr: peerCredAddr{Addr: conn.RemoteAddr(), caller: &auditCaller{UID: cred.Uid, PID: cred.Pid}},
+	}, nil
+}
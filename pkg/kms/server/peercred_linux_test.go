@@ -0,0 +1,38 @@
+//go:build linux
+
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPeerCredListener(t *testing.T) {
+	l, err := net.Listen("unix", filepath.Join(t.TempDir(), "kms.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	client, err := net.Dial("unix", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	conn, err := newPeerCredListener(l).Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	addr, ok := conn.RemoteAddr().(peerCredAddr)
+	if !ok {
+		t.Fatalf("expected the credentials of the peer, got %T", conn.RemoteAddr())
+	}
+	if int(addr.caller.UID) != os.Getuid() || int(addr.caller.PID) != os.Getpid() {
+		t.Errorf("expected uid %d and pid %d, got %+v", os.Getuid(), os.Getpid(), addr.caller)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package server
+
+import (
+	"net"
+)
+
+// newPeerCredListener returns the listener as is, the credentials of the peers are only supported
+// on Linux
+func newPeerCredListener(l net.Listener) net.Listener {
+	return l
+}
@@ -5,31 +5,76 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"slices"
+	"sync"
+	"time"
 
 	"golang.org/x/sys/unix"
 	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	gcfg "gopkg.in/gcfg.v1"
 	"k8s.io/cloud-provider-openstack/pkg/kms/barbican"
 	"k8s.io/cloud-provider-openstack/pkg/kms/encryption/aescbc"
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
 	"k8s.io/klog/v2"
+	pbv1 "k8s.io/kms/apis/v1beta1"
 	pb "k8s.io/kms/apis/v2"
 )
 
 const (
 	netProtocol    = "unix"
 	version        = "v2"
-	runtimeversion = "0.0.2"
+	runtimename    = "barbican"
+	runtimeversion = "0.0.3"
+
+	// algorithmAnnotation is the annotation of the ciphertexts recording the algorithm they were
+	// encrypted with, so that the ciphertexts of other algorithms can be told apart
+	algorithmAnnotation = "algorithm.barbican-kms.openstack.org"
+	algorithmAESCBC     = "aes-cbc"
 )
 
 type BarbicanService interface {
 	GetSecret(ctx context.Context, keyID string) ([]byte, error)
 }
 
+// Options are the options of the KMS server
+type Options struct {
+	// CloudConfig is the path of the cloud config file
+	CloudConfig string
+	// SocketPath is the path of the unix socket the KMS services are served on
+	SocketPath string
+	// DEKCacheTTL is the duration for which the decrypted DEKs are cached, up to DEKCacheSize
+	// DEKs, they are not cached if 0
+	DEKCacheTTL  time.Duration
+	DEKCacheSize int
+	// MetricsAddress is the address the metrics are served on, if not empty
+	MetricsAddress string
+	// CloudConfigReloadInterval is the interval the credentials of the cloud config are checked
+	// for changes at, they are not reloaded if 0
+	CloudConfigReloadInterval time.Duration
+	// AuditLogPath is the file the encrypt and decrypt operations are appended to, "-" means the
+	// standard output, they are not written if empty. The successful operations are sampled at
+	// AuditSampleRate.
+	AuditLogPath    string
+	AuditSampleRate float64
+}
+
 // KMSserver struct
 type KMSserver struct {
 	pb.UnimplementedKeyManagementServiceServer
-	cfg      barbican.Config
-	barbican BarbicanService
+	cfg barbican.Config
+
+	// barbicanMu guards barbican, which is replaced when the credentials are reloaded
+	barbicanMu sync.RWMutex
+	barbican   BarbicanService
+	// deks caches the decrypted DEKs, the DEKs are not cached if nil
+	deks *dekCache
+	// audit writes the audit log of the keys usage, the usage is not audited if nil
+	audit *auditLogger
+
+	// keyServers are the servers of the named keys, which share the Barbican clients and the DEK
+	// cache of the server
+	keyServers []*KMSserver
 }
 
 func initConfig(configFilePath string, cfg *barbican.Config) error {
@@ -46,49 +91,71 @@ func initConfig(configFilePath string, cfg *barbican.Config) error {
 }
 
 // Run Grpc server for barbican KMS
-func Run(configFilePath string, socketpath string, sigchan <-chan os.Signal) (err error) {
+func Run(opts Options, sigchan <-chan os.Signal) (err error) {
 	klog.Infof("Barbican KMS Plugin Starting Version: %s, RunTimeVersion: %s", version, runtimeversion)
 	s := new(KMSserver)
-	err = initConfig(configFilePath, &s.cfg)
+	err = initConfig(opts.CloudConfig, &s.cfg)
 	if err != nil {
 		klog.V(4).Infof("Error in Getting Config File: %v", err)
 		return err
 	}
 
-	client, err := barbican.NewBarbicanClient(s.cfg)
+	if err = validateKeys(s.cfg, opts.SocketPath); err != nil {
+		return err
+	}
+
+	if err = barbican.ReadClouds(&s.cfg); err != nil {
+		klog.V(4).Infof("Error in Reading clouds.yaml: %v", err)
+		return err
+	}
+
+	b, err := barbican.NewBarbican(s.cfg)
 	if err != nil {
 		klog.V(4).Infof("Failed to get Barbican client: %v", err)
 		return err
 	}
-	s.barbican = &barbican.Barbican{Client: client}
+	s.barbican = b
 
-	// unlink the unix socket
-	if err = unix.Unlink(socketpath); err != nil {
-		klog.V(4).Infof("Error to unlink unix socket: %v", err)
+	if err = ensureKeys(context.TODO(), b, &s.cfg); err != nil {
+		return err
 	}
 
-	listener, err := net.Listen(netProtocol, socketpath)
-	if err != nil {
-		klog.Fatalf("Failed to Listen: %v", err)
+	if opts.DEKCacheTTL > 0 && opts.DEKCacheSize > 0 {
+		s.deks = newDEKCache(opts.DEKCacheTTL, opts.DEKCacheSize)
+	}
+
+	if s.audit, err = newAuditLogger(opts.AuditLogPath, opts.AuditSampleRate); err != nil {
 		return err
 	}
 
-	gServer := grpc.NewServer()
-	pb.RegisterKeyManagementServiceServer(gServer, s)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
 
-	serverCh := make(chan error, 1)
-	go func() {
-		err := gServer.Serve(listener)
-		serverCh <- err
-		close(serverCh)
-	}()
+	if opts.MetricsAddress != "" {
+		metrics.RegisterMetrics("barbican-kms-plugin")
+		go serveMetrics(opts.MetricsAddress)
+	}
+
+	serverCh := make(chan error, 1+len(s.cfg.Key))
+	servers := []*grpc.Server{s.serve(opts.SocketPath, serverCh)}
+	for name, key := range s.cfg.Key {
+		klog.Infof("Serving key %s on %s", name, key.SocketPath)
+		servers = append(servers, s.newKeyServer(key).serve(key.SocketPath, serverCh))
+	}
+
+	// The servers of the named keys must be created first, as their Barbican clients are replaced too
+	if opts.CloudConfigReloadInterval > 0 {
+		go s.watchCredentials(opts.CloudConfig, opts.CloudConfigReloadInterval, stopCh)
+	}
 
 	for {
 		select {
 		case sig := <-sigchan:
 			if sig == unix.SIGINT || sig == unix.SIGTERM {
 				fmt.Println("force stop, shutting down grpc server")
-				gServer.GracefulStop()
+				for _, gServer := range servers {
+					gServer.GracefulStop()
+				}
 				return nil
 			}
 		case err := <-serverCh:
@@ -99,9 +166,122 @@ func Run(configFilePath string, socketpath string, sigchan <-chan os.Signal) (er
 	}
 }
 
-// Version returns KMS service version
+// validateKeys validates that the named keys have a key ID or a container name, and a socket path
+// of their own
+func validateKeys(cfg barbican.Config, socketPath string) error {
+	sockets := map[string]string{socketPath: "the default key"}
+	for name, key := range cfg.Key {
+		if key.KeyID == "" && key.ContainerName == "" {
+			return fmt.Errorf("key-id or container-name of key %q is missing", name)
+		}
+		if key.SocketPath == "" {
+			return fmt.Errorf("socket-path of key %q is missing", name)
+		}
+		if other, ok := sockets[key.SocketPath]; ok {
+			return fmt.Errorf("socket-path %s of key %q is already used by %s", key.SocketPath, name, other)
+		}
+		sockets[key.SocketPath] = fmt.Sprintf("key %q", name)
+	}
+	return nil
+}
+
+// ensureKeys sets the IDs of the keys configured by container name, creating the containers which
+// don't exist when create-key is set
+func ensureKeys(ctx context.Context, b *barbican.Barbican, cfg *barbican.Config) error {
+	if cfg.KeyManager.KeyID == "" && cfg.KeyManager.ContainerName != "" {
+		keyID, err := b.EnsureKey(ctx, cfg.KeyManager.ContainerName, cfg.KeyManager.CreateKey)
+		if err != nil {
+			return fmt.Errorf("failed to ensure the key of container %s: %v", cfg.KeyManager.ContainerName, err)
+		}
+		cfg.KeyManager.KeyID = keyID
+	}
+
+	for name, key := range cfg.Key {
+		if key.KeyID == "" {
+			keyID, err := b.EnsureKey(ctx, key.ContainerName, key.CreateKey)
+			if err != nil {
+				return fmt.Errorf("failed to ensure the key %q of container %s: %v", name, key.ContainerName, err)
+			}
+			key.KeyID = keyID
+		}
+	}
+
+	return nil
+}
+
+// newKeyServer creates the server of the named key
+func (s *KMSserver) newKeyServer(key *barbican.KeyOpts) *KMSserver {
+	ks := &KMSserver{
+		cfg: barbican.Config{
+			Global:     s.cfg.Global,
+			KeyManager: barbican.KMSOpts{KeyID: key.KeyID, PreviousKeyIDs: key.PreviousKeyIDs},
+		},
+		barbican: s.barbican,
+		deks:     s.deks,
+		audit:    s.audit,
+	}
+	s.keyServers = append(s.keyServers, ks)
+	return ks
+}
+
+// serve serves the KMS services and the health service on the unix socket, the errors of the
+// gRPC server are sent to serverCh.
+func (s *KMSserver) serve(socketPath string, serverCh chan<- error) *grpc.Server {
+	if len(s.cfg.KeyManager.PreviousKeyIDs) > 0 {
+		klog.Infof("Encrypting with key %s, decrypting with keys %v", s.cfg.KeyManager.KeyID, s.keyIDs())
+	}
+
+	// unlink the unix socket
+	if err := unix.Unlink(socketPath); err != nil {
+		klog.V(4).Infof("Error to unlink unix socket: %v", err)
+	}
+
+	listener, err := net.Listen(netProtocol, socketPath)
+	if err != nil {
+		klog.Fatalf("Failed to Listen: %v", err)
+	}
+
+	gServer := grpc.NewServer(grpc.ChainUnaryInterceptor(observeGRPC, s.auditGRPC))
+	pb.RegisterKeyManagementServiceServer(gServer, s)
+	pbv1.RegisterKeyManagementServiceServer(gServer, &KMSv1server{kms: s})
+	healthpb.RegisterHealthServer(gServer, &healthServer{kms: s})
+
+	go func() {
+		serverCh <- gServer.Serve(newPeerCredListener(listener))
+	}()
+
+	return gServer
+}
+
+// setBarbican replaces the Barbican clients of the server and of the servers of the named keys
+func (s *KMSserver) setBarbican(b BarbicanService) {
+	for _, ks := range append([]*KMSserver{s}, s.keyServers...) {
+		ks.barbicanMu.Lock()
+		ks.barbican = b
+		ks.barbicanMu.Unlock()
+	}
+}
+
+// getSecret gets the key from Barbican
+func (s *KMSserver) getSecret(ctx context.Context, keyID string) ([]byte, error) {
+	s.barbicanMu.RLock()
+	b := s.barbican
+	s.barbicanMu.RUnlock()
+
+	return b.GetSecret(ctx, keyID)
+}
+
+// keyIDs returns the IDs of the keys the data can be decrypted with, the current key first.
+func (s *KMSserver) keyIDs() []string {
+	return append([]string{s.cfg.KeyManager.KeyID}, s.cfg.KeyManager.PreviousKeyIDs...)
+}
+
+// Status returns KMS service version, health and the current key ID. The plugin is healthy if
+// the current and the previous keys can be fetched from Barbican, as the data encrypted with a
+// missing previous key can't be decrypted anymore. The kube-apiserver picks up the rotation of
+// the key from the change of the key ID.
 func (s *KMSserver) Status(ctx context.Context, req *pb.StatusRequest) (*pb.StatusResponse, error) {
-	klog.V(4).Infof("Version Information Requested by Kubernetes api server")
+	klog.V(4).Infof("Status Information Requested by Kubernetes api server")
 
 	res := &pb.StatusResponse{
 		Version: version,
@@ -109,23 +289,46 @@ func (s *KMSserver) Status(ctx context.Context, req *pb.StatusRequest) (*pb.Stat
 		KeyId:   s.cfg.KeyManager.KeyID,
 	}
 
+	if err := s.checkKeys(ctx); err != nil {
+		res.Healthz = err.Error()
+	}
+
 	return res, nil
 }
 
-// Decrypt decrypts the cipher
+// checkKeys checks that the current and the previous keys can be fetched from Barbican.
+func (s *KMSserver) checkKeys(ctx context.Context) error {
+	for _, keyID := range s.keyIDs() {
+		if _, err := s.getSecret(ctx, keyID); err != nil {
+			klog.V(4).Infof("Failed to get key %v: ", err)
+			return fmt.Errorf("failed to get key %s: %v", keyID, err)
+		}
+	}
+	return nil
+}
+
+// Decrypt decrypts the cipher with the key it was encrypted with, which must be the current key or
+// one of the previous keys.
 func (s *KMSserver) Decrypt(ctx context.Context, req *pb.DecryptRequest) (*pb.DecryptResponse, error) {
 	klog.V(4).Infof("Decrypt Request by Kubernetes api server")
 
-	// TODO: consider using req.KeyId
-	key, err := s.barbican.GetSecret(ctx, s.cfg.KeyManager.KeyID)
-	if err != nil {
-		klog.V(4).Infof("Failed to get key %v: ", err)
-		return nil, err
+	if algorithm, ok := req.Annotations[algorithmAnnotation]; ok && string(algorithm) != algorithmAESCBC {
+		return nil, fmt.Errorf("unsupported encryption algorithm %q", algorithm)
 	}
 
-	plain, err := aescbc.Decrypt(req.Ciphertext, key)
+	keyID := req.KeyId
+	if keyID == "" {
+		keyID = s.cfg.KeyManager.KeyID
+	}
+	if !slices.Contains(s.keyIDs(), keyID) {
+		return nil, fmt.Errorf("unknown key %s, it must be the key-id or a previous-key-id", keyID)
+	}
+	if keyID != s.cfg.KeyManager.KeyID {
+		klog.V(2).Infof("Decrypting data encrypted with previous key %s, it must be rewritten before the key is removed", keyID)
+	}
+
+	plain, err := s.decrypt(ctx, keyID, req.Ciphertext)
 	if err != nil {
-		klog.V(4).Infof("Failed to decrypt data %v: ", err)
 		return nil, err
 	}
 
@@ -136,18 +339,59 @@ func (s *KMSserver) Decrypt(ctx context.Context, req *pb.DecryptRequest) (*pb.De
 func (s *KMSserver) Encrypt(ctx context.Context, req *pb.EncryptRequest) (*pb.EncryptResponse, error) {
 	klog.V(4).Infof("Encrypt Request by Kubernetes api server")
 
-	key, err := s.barbican.GetSecret(ctx, s.cfg.KeyManager.KeyID)
+	cipher, err := s.encrypt(ctx, s.cfg.KeyManager.KeyID, req.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.EncryptResponse{
+		Ciphertext:  cipher,
+		KeyId:       s.cfg.KeyManager.KeyID,
+		Annotations: map[string][]byte{algorithmAnnotation: []byte(algorithmAESCBC)},
+	}, nil
+}
 
+func (s *KMSserver) decrypt(ctx context.Context, keyID string, cipher []byte) ([]byte, error) {
+	var cacheKey string
+	if s.deks != nil {
+		// The cipher is decrypted in place, so the cache key is computed first
+		cacheKey = dekCacheKey(keyID, cipher)
+		if plain, ok := s.deks.get(cacheKey); ok {
+			return plain, nil
+		}
+	}
+
+	key, err := s.getSecret(ctx, keyID)
 	if err != nil {
 		klog.V(4).Infof("Failed to get key %v: ", err)
 		return nil, err
 	}
 
-	cipher, err := aescbc.Encrypt(req.Plaintext, key)
+	plain, err := aescbc.Decrypt(cipher, key)
+	if err != nil {
+		klog.V(4).Infof("Failed to decrypt data %v: ", err)
+		return nil, err
+	}
+
+	if s.deks != nil {
+		s.deks.add(cacheKey, plain)
+	}
+
+	return plain, nil
+}
 
+func (s *KMSserver) encrypt(ctx context.Context, keyID string, plain []byte) ([]byte, error) {
+	key, err := s.getSecret(ctx, keyID)
+	if err != nil {
+		klog.V(4).Infof("Failed to get key %v: ", err)
+		return nil, err
+	}
+
+	cipher, err := aescbc.Encrypt(plain, key)
 	if err != nil {
 		klog.V(4).Infof("Failed to encrypt data %v: ", err)
 		return nil, err
 	}
-	return &pb.EncryptResponse{Ciphertext: cipher, KeyId: s.cfg.KeyManager.KeyID}, nil
+
+	return cipher, nil
 }
@@ -3,13 +3,48 @@ package server
 import (
 	"bytes"
 	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 
 	"k8s.io/cloud-provider-openstack/pkg/kms/barbican"
+	pbv1 "k8s.io/kms/apis/v1beta1"
 	pb "k8s.io/kms/apis/v2"
 )
 
-var s = new(KMSserver)
+var s = &KMSserver{barbican: &barbican.FakeBarbican{}}
+
+// failingBarbican fails to get any key
+type failingBarbican struct{}
+
+func (failingBarbican) GetSecret(_ context.Context, keyID string) ([]byte, error) {
+	return nil, errors.New("unavailable")
+}
+
+// countingBarbican counts the keys it gets
+type countingBarbican struct {
+	barbican.FakeBarbican
+	count int
+}
+
+func (b *countingBarbican) GetSecret(ctx context.Context, keyID string) ([]byte, error) {
+	b.count++
+	return b.FakeBarbican.GetSecret(ctx, keyID)
+}
+
+// keysBarbican gets the keys by ID
+type keysBarbican map[string][]byte
+
+func (b keysBarbican) GetSecret(_ context.Context, keyID string) ([]byte, error) {
+	key, ok := b[keyID]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return key, nil
+}
 
 func TestInitConfig(t *testing.T) {
 }
@@ -22,6 +57,19 @@ func TestStatus(t *testing.T) {
 	}
 }
 
+func TestStatusUnhealthy(t *testing.T) {
+	s := &KMSserver{barbican: failingBarbican{}}
+	s.cfg.KeyManager.KeyID = "key"
+
+	res, err := s.Status(context.TODO(), &pb.StatusRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Healthz == "ok" || res.KeyId != "key" {
+		t.Errorf("expected an unhealthy status with key ID key, got %v", res)
+	}
+}
+
 func TestEncryptDecrypt(t *testing.T) {
 	s.barbican = &barbican.FakeBarbican{}
 	fakeData := []byte("fakedata")
@@ -38,3 +86,200 @@ func TestEncryptDecrypt(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestEncryptDecryptAnnotations(t *testing.T) {
+	s := &KMSserver{barbican: &barbican.FakeBarbican{}}
+	s.cfg.KeyManager.KeyID = "key"
+	s.cfg.KeyManager.PreviousKeyIDs = []string{"previous-key"}
+
+	encresp, err := s.Encrypt(context.TODO(), &pb.EncryptRequest{Plaintext: []byte("fakedata")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encresp.KeyId != "key" || string(encresp.Annotations[algorithmAnnotation]) != algorithmAESCBC {
+		t.Fatalf("unexpected key ID %q or annotations %v", encresp.KeyId, encresp.Annotations)
+	}
+
+	// The data encrypted with a previous key is decrypted with it
+	decreq := &pb.DecryptRequest{Ciphertext: encresp.Ciphertext, KeyId: "previous-key", Annotations: encresp.Annotations}
+	if _, err := s.Decrypt(context.TODO(), decreq); err != nil {
+		t.Fatal(err)
+	}
+
+	decreq.Annotations = map[string][]byte{algorithmAnnotation: []byte("other")}
+	if _, err := s.Decrypt(context.TODO(), decreq); err == nil {
+		t.Error("expected an error for an unsupported algorithm")
+	}
+}
+
+func TestEncryptDecryptV1(t *testing.T) {
+	v1 := &KMSv1server{kms: &KMSserver{barbican: &barbican.FakeBarbican{}}}
+
+	version, err := v1.Version(context.TODO(), &pbv1.VersionRequest{})
+	if err != nil || version.Version != "v1beta1" {
+		t.Fatalf("unexpected version %v: %v", version, err)
+	}
+
+	fakeData := []byte("fakedata")
+	encresp, err := v1.Encrypt(context.TODO(), &pbv1.EncryptRequest{Plain: fakeData})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decresp, err := v1.Decrypt(context.TODO(), &pbv1.DecryptRequest{Cipher: encresp.Cipher})
+	if err != nil || !bytes.Equal(decresp.Plain, fakeData) {
+		t.Fatalf("unexpected plain %q: %v", decresp.GetPlain(), err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	keys := keysBarbican{
+		"old-key": []byte("0123456789abcdef0123456789abcdef"),
+		"new-key": []byte("fedcba9876543210fedcba9876543210"),
+	}
+	fakeData := []byte("fakedata")
+
+	s := &KMSserver{barbican: keys}
+	s.cfg.KeyManager.KeyID = "old-key"
+	old, err := s.Encrypt(context.TODO(), &pb.EncryptRequest{Plaintext: fakeData})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotate to the new key
+	s.cfg.KeyManager.KeyID = "new-key"
+	s.cfg.KeyManager.PreviousKeyIDs = []string{"old-key"}
+
+	status, err := s.Status(context.TODO(), &pb.StatusRequest{})
+	if err != nil || status.Healthz != "ok" || status.KeyId != "new-key" {
+		t.Fatalf("unexpected status %v: %v", status, err)
+	}
+
+	encresp, err := s.Encrypt(context.TODO(), &pb.EncryptRequest{Plaintext: fakeData})
+	if err != nil || encresp.KeyId != "new-key" {
+		t.Fatalf("unexpected key ID %q: %v", encresp.GetKeyId(), err)
+	}
+
+	for _, res := range []*pb.EncryptResponse{old, encresp} {
+		decresp, err := s.Decrypt(context.TODO(), &pb.DecryptRequest{Ciphertext: res.Ciphertext, KeyId: res.KeyId})
+		if err != nil || !bytes.Equal(decresp.Plaintext, fakeData) {
+			t.Errorf("failed to decrypt the data encrypted with %s: %v", res.KeyId, err)
+		}
+	}
+
+	// The keys which are not configured are refused
+	if _, err := s.Decrypt(context.TODO(), &pb.DecryptRequest{Ciphertext: old.Ciphertext, KeyId: "other-key"}); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+
+	// A missing previous key makes the plugin unhealthy
+	delete(keys, "old-key")
+	status, err = s.Status(context.TODO(), &pb.StatusRequest{})
+	if err != nil || status.Healthz == "ok" {
+		t.Errorf("expected an unhealthy status, got %v: %v", status, err)
+	}
+}
+
+func TestDecryptDEKCache(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	b := &countingBarbican{}
+	s := &KMSserver{barbican: b, deks: newDEKCache(time.Minute, 1)}
+	s.deks.now = func() time.Time { return now }
+
+	fakeData := []byte("fakedata")
+	encresp, err := s.Encrypt(context.TODO(), &pb.EncryptRequest{Plaintext: fakeData})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := s.Encrypt(context.TODO(), &pb.EncryptRequest{Plaintext: []byte("otherdata")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decrypt := func(ciphertext []byte, expected []byte) {
+		t.Helper()
+		// The ciphertext is decrypted in place
+		decresp, err := s.Decrypt(context.TODO(), &pb.DecryptRequest{Ciphertext: bytes.Clone(ciphertext)})
+		if err != nil || !bytes.Equal(decresp.Plaintext, expected) {
+			t.Fatalf("unexpected plaintext %q: %v", decresp.GetPlaintext(), err)
+		}
+	}
+
+	b.count = 0
+	decrypt(encresp.Ciphertext, fakeData)
+	decrypt(encresp.Ciphertext, fakeData)
+	if b.count != 1 {
+		t.Errorf("expected the key to be fetched once, got %d times", b.count)
+	}
+
+	// The cache is full
+	decrypt(other.Ciphertext, []byte("otherdata"))
+	decrypt(other.Ciphertext, []byte("otherdata"))
+	if b.count != 3 {
+		t.Errorf("expected the key to be fetched 3 times, got %d times", b.count)
+	}
+
+	// The DEK is decrypted again once the TTL elapsed
+	now = now.Add(time.Minute)
+	decrypt(encresp.Ciphertext, fakeData)
+	if b.count != 4 {
+		t.Errorf("expected the key to be fetched 4 times, got %d times", b.count)
+	}
+}
+
+func TestNamedKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cloud.conf")
+	config := `[Global]
+auth-url = https://keystone.example.com/v3
+
+[KeyManager]
+key-id = default-key
+
+[Key "configmaps"]
+key-id = configmaps-key
+previous-key-id = previous-configmaps-key
+socket-path = /kms/configmaps.sock
+`
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &KMSserver{barbican: failingBarbican{}}
+	if err := initConfig(path, &s.cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateKeys(s.cfg, "/kms/kms.sock"); err != nil {
+		t.Fatal(err)
+	}
+
+	key := s.cfg.Key["configmaps"]
+	if key == nil || key.KeyID != "configmaps-key" || key.SocketPath != "/kms/configmaps.sock" {
+		t.Fatalf("unexpected named key %v", key)
+	}
+
+	ks := s.newKeyServer(key)
+	if !reflect.DeepEqual(ks.keyIDs(), []string{"configmaps-key", "previous-configmaps-key"}) {
+		t.Errorf("unexpected key IDs %v", ks.keyIDs())
+	}
+
+	// The server of the named key uses the Barbican clients of the server
+	s.setBarbican(&barbican.FakeBarbican{})
+	encresp, err := ks.Encrypt(context.TODO(), &pb.EncryptRequest{Plaintext: []byte("fakedata")})
+	if err != nil || encresp.KeyId != "configmaps-key" {
+		t.Fatalf("unexpected key ID %q: %v", encresp.GetKeyId(), err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		key  barbican.KeyOpts
+	}{
+		{name: "missing key ID", key: barbican.KeyOpts{SocketPath: "/kms/other.sock"}},
+		{name: "missing socket path", key: barbican.KeyOpts{KeyID: "other-key"}},
+		{name: "socket path of the default key", key: barbican.KeyOpts{KeyID: "other-key", SocketPath: "/kms/kms.sock"}},
+	} {
+		cfg := barbican.Config{Key: map[string]*barbican.KeyOpts{"other": &tt.key}}
+		if err := validateKeys(cfg, "/kms/kms.sock"); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
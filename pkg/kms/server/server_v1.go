@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+
+	"k8s.io/klog/v2"
+	pbv1 "k8s.io/kms/apis/v1beta1"
+)
+
+const versionV1 = "v1beta1"
+
+// KMSv1server serves the deprecated KMS v1 API, for the kms providers of the encryption
+// configuration with apiVersion v1. The KMS v1 API doesn't pass the key ID, so the ciphertexts
+// are always decrypted with the configured key.
+type KMSv1server struct {
+	pbv1.UnimplementedKeyManagementServiceServer
+	kms *KMSserver
+}
+
+// Version returns KMS service version
+func (s *KMSv1server) Version(ctx context.Context, req *pbv1.VersionRequest) (*pbv1.VersionResponse, error) {
+	klog.V(4).Infof("Version Information Requested by Kubernetes api server")
+
+	return &pbv1.VersionResponse{Version: versionV1, RuntimeName: runtimename, RuntimeVersion: runtimeversion}, nil
+}
+
+// Decrypt decrypts the cipher
+func (s *KMSv1server) Decrypt(ctx context.Context, req *pbv1.DecryptRequest) (*pbv1.DecryptResponse, error) {
+	klog.V(4).Infof("Decrypt Request by Kubernetes api server")
+
+	plain, err := s.kms.decrypt(ctx, s.kms.cfg.KeyManager.KeyID, req.Cipher)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pbv1.DecryptResponse{Plain: plain}, nil
+}
+
+// Encrypt encrypts DEK
+func (s *KMSv1server) Encrypt(ctx context.Context, req *pbv1.EncryptRequest) (*pbv1.EncryptResponse, error) {
+	klog.V(4).Infof("Encrypt Request by Kubernetes api server")
+
+	cipher, err := s.kms.encrypt(ctx, s.kms.cfg.KeyManager.KeyID, req.Plain)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pbv1.EncryptResponse{Cipher: cipher}, nil
+}
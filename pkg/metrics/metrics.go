@@ -64,4 +64,17 @@ func RegisterMetrics(component string) {
 	if component == "occm" {
 		doRegisterOccmMetrics()
 	}
+	if component == "cinder-csi" {
+		doRegisterCSIMetrics()
+	}
+	if component == "manila-csi" {
+		doRegisterCSIMetrics()
+		doRegisterManilaMetrics()
+	}
+	if component == "k8s-keystone-auth" {
+		doRegisterKeystoneMetrics()
+	}
+	if component == "barbican-kms-plugin" {
+		doRegisterKMSMetrics()
+	}
 }
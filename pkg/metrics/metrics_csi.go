@@ -0,0 +1,89 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/status"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+var (
+	csiOperationMetrics = &OpenstackMetrics{
+		Duration: metrics.NewHistogramVec(
+			&metrics.HistogramOpts{
+				Name:    "csi_operation_duration_seconds",
+				Help:    "Latency of a CSI RPC served by the plugin",
+				Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1.0, 2.5, 5.0, 10.0, 15.0, 30.0, 60.0, 120.0, 300.0, 600.0},
+			}, []string{"method", "grpc_code"}),
+		Total: metrics.NewCounterVec(
+			&metrics.CounterOpts{
+				Name: "csi_operations_total",
+				Help: "Total number of CSI RPCs served by the plugin",
+			}, []string{"method", "grpc_code"}),
+		Errors: metrics.NewCounterVec(
+			&metrics.CounterOpts{
+				Name: "csi_operation_errors_total",
+				Help: "Total number of errors for a CSI RPC served by the plugin",
+			}, []string{"method", "grpc_code"}),
+	}
+
+	csiQuotaPreflightFailures = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name: "csi_quota_preflight_failures_total",
+			Help: "Total number of CSI RPCs failed by the quota pre-flight checks of the plugin",
+		}, []string{"method", "quota"})
+)
+
+// NewCSIMetricContext creates a new MetricContext for a CSI RPC, specified by
+// its method name, e.g. CreateVolume.
+func NewCSIMetricContext(method string) *MetricContext {
+	return &MetricContext{
+		Start:      time.Now(),
+		Attributes: []string{method},
+	}
+}
+
+// ObserveCSIOperation records the RPC latency and counts the errors, labelled
+// with the gRPC status code of the error.
+func (mc *MetricContext) ObserveCSIOperation(err error) error {
+	mc.Attributes = append(mc.Attributes, status.Code(err).String())
+	return mc.Observe(csiOperationMetrics, err)
+}
+
+// ObserveQuotaPreflightFailure counts the CSI RPC failed because the quota
+// of the project, e.g. gigabytes, would be exceeded.
+func ObserveQuotaPreflightFailure(method, quota string) {
+	csiQuotaPreflightFailures.WithLabelValues(method, quota).Inc()
+}
+
+var registerCSIMetrics sync.Once
+
+// doRegisterCSIMetrics registers CSI RPC metrics.
+func doRegisterCSIMetrics() {
+	registerCSIMetrics.Do(func() {
+		legacyregistry.MustRegister(
+			csiOperationMetrics.Duration,
+			csiOperationMetrics.Total,
+			csiOperationMetrics.Errors,
+			csiQuotaPreflightFailures,
+		)
+	})
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sync"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+var (
+	keystoneAuthentications = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name: "keystone_auth_authentications_total",
+			Help: "Total number of token authentications served by k8s-keystone-auth, by result",
+		}, []string{"result"})
+
+	keystoneAuthorizations = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name: "keystone_auth_authorizations_total",
+			Help: "Total number of authorization decisions of k8s-keystone-auth, by decision and by policy rule which allowed or denied the request",
+		}, []string{"decision", "policy"})
+
+	keystoneTokenCacheLookups = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name: "keystone_auth_token_cache_lookups_total",
+			Help: "Total number of lookups of the tokens in the token cache of k8s-keystone-auth, by result",
+		}, []string{"result"})
+
+	keystoneGroupCacheLookups = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name: "keystone_auth_group_cache_lookups_total",
+			Help: "Total number of lookups of the groups of the users in the group cache of k8s-keystone-auth, by result",
+		}, []string{"result"})
+)
+
+// ObserveKeystoneAuthentication counts the token authentication with the
+// given result, e.g. success or failure.
+func ObserveKeystoneAuthentication(result string) {
+	keystoneAuthentications.WithLabelValues(result).Inc()
+}
+
+// ObserveKeystoneAuthorization counts the authorization decision, e.g. allow
+// or deny, and the policy rule which allowed or denied the request, if any.
+func ObserveKeystoneAuthorization(decision, policy string) {
+	keystoneAuthorizations.WithLabelValues(decision, policy).Inc()
+}
+
+// ObserveKeystoneTokenCacheLookup counts the lookup of a token in the token
+// cache, hit or miss.
+func ObserveKeystoneTokenCacheLookup(result string) {
+	keystoneTokenCacheLookups.WithLabelValues(result).Inc()
+}
+
+// ObserveKeystoneGroupCacheLookup counts the lookup of the groups of a user
+// in the group cache, hit or miss.
+func ObserveKeystoneGroupCacheLookup(result string) {
+	keystoneGroupCacheLookups.WithLabelValues(result).Inc()
+}
+
+var registerKeystoneMetrics sync.Once
+
+// doRegisterKeystoneMetrics registers k8s-keystone-auth metrics.
+func doRegisterKeystoneMetrics() {
+	registerKeystoneMetrics.Do(func() {
+		legacyregistry.MustRegister(
+			keystoneAuthentications,
+			keystoneAuthorizations,
+			keystoneTokenCacheLookups,
+			keystoneGroupCacheLookups,
+		)
+	})
+}
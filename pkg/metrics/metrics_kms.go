@@ -0,0 +1,76 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/status"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+var (
+	kmsOperationMetrics = &OpenstackMetrics{
+		Duration: metrics.NewHistogramVec(
+			&metrics.HistogramOpts{
+				Name:    "barbican_kms_operation_duration_seconds",
+				Help:    "Latency of a KMS RPC served by barbican-kms-plugin",
+				Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1.0, 2.5, 5.0, 10.0},
+			}, []string{"method", "grpc_code"}),
+		Total: metrics.NewCounterVec(
+			&metrics.CounterOpts{
+				Name: "barbican_kms_operations_total",
+				Help: "Total number of KMS RPCs served by barbican-kms-plugin",
+			}, []string{"method", "grpc_code"}),
+		Errors: metrics.NewCounterVec(
+			&metrics.CounterOpts{
+				Name: "barbican_kms_operation_errors_total",
+				Help: "Total number of errors for a KMS RPC served by barbican-kms-plugin",
+			}, []string{"method", "grpc_code"}),
+	}
+)
+
+// NewKMSMetricContext creates a new MetricContext for a KMS RPC, specified by
+// its service and method name, e.g. v2.KeyManagementService/Encrypt.
+func NewKMSMetricContext(method string) *MetricContext {
+	return &MetricContext{
+		Start:      time.Now(),
+		Attributes: []string{method},
+	}
+}
+
+// ObserveKMSOperation records the RPC latency and counts the errors, labelled
+// with the gRPC status code of the error.
+func (mc *MetricContext) ObserveKMSOperation(err error) error {
+	mc.Attributes = append(mc.Attributes, status.Code(err).String())
+	return mc.Observe(kmsOperationMetrics, err)
+}
+
+var registerKMSMetrics sync.Once
+
+// doRegisterKMSMetrics registers barbican-kms-plugin metrics.
+func doRegisterKMSMetrics() {
+	registerKMSMetrics.Do(func() {
+		legacyregistry.MustRegister(
+			kmsOperationMetrics.Duration,
+			kmsOperationMetrics.Total,
+			kmsOperationMetrics.Errors,
+		)
+	})
+}
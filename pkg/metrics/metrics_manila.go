@@ -0,0 +1,52 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sync"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+var (
+	manilaShares = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Name: "manila_csi_shares",
+			Help: "Number of the Manila shares provisioned by the plugin for the cluster, by status",
+		}, []string{"protocol", "status"})
+)
+
+// SetManilaShares sets the number of the shares of the given protocol in each
+// status. The statuses which are no longer reported are reset.
+func SetManilaShares(protocol string, sharesByStatus map[string]int) {
+	manilaShares.Reset()
+	for status, count := range sharesByStatus {
+		manilaShares.WithLabelValues(protocol, status).Set(float64(count))
+	}
+}
+
+var registerManilaMetrics sync.Once
+
+// doRegisterManilaMetrics registers Manila CSI metrics.
+func doRegisterManilaMetrics() {
+	registerManilaMetrics.Do(func() {
+		legacyregistry.MustRegister(
+			manilaShares,
+		)
+	})
+}
@@ -18,11 +18,13 @@ const networkClientType = "network"
 const loadbalancerClientType = "loadbalancer"
 const routesClientType = "routes"
 const secretClientType = "secrets"
+const baremetalClientType = "baremetal"
 
 const configsPath = "/etc/config/"
 
 type clientsFactory struct {
 	clientType    string
+	region        string
 	defaultClient *gophercloud.ServiceClient
 	clients       map[string]*gophercloud.ServiceClient
 	m             *sync.Mutex
@@ -37,6 +39,14 @@ func newClientsFactory(clientType string, defaultClient *gophercloud.ServiceClie
 	}
 }
 
+// newRegionalClientsFactory creates a factory of clients of the given region.
+// The region overrides the one set in the project configurations.
+func newRegionalClientsFactory(clientType string, region string, defaultClient *gophercloud.ServiceClient) *clientsFactory {
+	c := newClientsFactory(clientType, defaultClient)
+	c.region = region
+	return c
+}
+
 func (c *clientsFactory) get(meta metav1.ObjectMeta) *gophercloud.ServiceClient {
 	if meta.Labels == nil || meta.Labels[CustomProjectAliasLabel] == "" {
 		return c.defaultClient
@@ -76,6 +86,9 @@ func (c *clientsFactory) getProjectTypedClient(projectAlias string) (*gopherclou
 		Region:       cloudConfig.Global.Region,
 		Availability: cloudConfig.Global.EndpointType,
 	}
+	if c.region != "" {
+		epOpts.Region = c.region
+	}
 
 	switch c.clientType {
 	case computeClientType:
@@ -113,6 +126,13 @@ func (c *clientsFactory) getProjectTypedClient(projectAlias string) (*gopherclou
 			return nil, err
 		}
 		return secret, nil
+	case baremetalClientType:
+		baremetal, err := client.NewBareMetalV1(provider, epOpts)
+		if err != nil {
+			klog.Errorf("Failed to create an OpenStack Baremetal client: %v", err)
+			return nil, err
+		}
+		return baremetal, nil
 	}
 
 	return nil, fmt.Errorf("unknown client type %s", c.clientType)
@@ -147,6 +167,9 @@ func (c *clientsFactory) getProjectProvider(cloudConfig *Config) (*gophercloud.P
 }
 
 func (c *clientsFactory) clientKey(projectID string) string {
+	if c.region != "" {
+		return c.clientType + "/" + c.region + "/" + projectID
+	}
 	return c.clientType + "/" + projectID
 }
 
@@ -24,4 +24,8 @@ const (
 	eventLBFloatingIPSkipped           = "LoadBalancerFloatingIPSkipped"
 	eventLBRename                      = "LoadBalancerRename"
 	eventLBLbMethodUnknown             = "LoadBalancerLbMethodUnknown"
+	eventNodeZoneChanged               = "NodeZoneChanged"
+	eventInstanceError                 = "InstanceError"
+	eventInstanceRecovered             = "InstanceRecovered"
+	eventInstanceErrorExpired          = "InstanceErrorGracePeriodExpired"
 )
@@ -24,6 +24,7 @@ import (
 	"strings"
 
 	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/baremetal/v1/nodes"
 	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/flavors"
 	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
 	"github.com/gophercloud/gophercloud/v2/openstack/networking/v2/ports"
@@ -31,6 +32,7 @@ import (
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/cloud-provider-openstack/pkg/client"
 	"k8s.io/cloud-provider-openstack/pkg/metrics"
@@ -42,68 +44,190 @@ import (
 const (
 	RegionalProviderIDEnv = "OS_CCM_REGIONAL"
 	instanceShutoff       = "SHUTOFF"
+
+	// NodeExcludeFromLifecycle is the annotation (or label) marking a node which is
+	// managed externally. When set to "true", the cloud provider never reports the
+	// node as missing or shut down and never changes its metadata.
+	NodeExcludeFromLifecycle = "node.openstack.org/exclude-from-lifecycle"
+
+	// LabelPrimaryPortID is the node label holding the ID of the Neutron port of the node primary interface
+	LabelPrimaryPortID = "node.openstack.org/primary-port-id"
 )
 
+// regionClients holds the clients used to manage the instances of a region.
+type regionClients struct {
+	compute   *clientsFactory
+	network   *clientsFactory
+	baremetal *clientsFactory
+}
+
 // InstancesV2 encapsulates an implementation of InstancesV2 for OpenStack.
 type InstancesV2 struct {
-	compute          *clientsFactory
-	network          *clientsFactory
-	region           string
-	regionProviderID bool
-	networkingOpts   NetworkingOpts
+	// clients of the default region
+	regionClients
+	region            string
+	additionalRegions []string
+	regionalClients   map[string]*regionClients
+	regionProviderID  bool
+	networkingOpts    NetworkingOpts
+	instancesOpts     InstancesOpts
+	existenceCache    *instanceExistenceCache
+	serverCache       *serverCache
+	eventRecorder     record.EventRecorder
 }
 
 // InstancesV2 returns an implementation of InstancesV2 for OpenStack.
 func (os *OpenStack) InstancesV2() (cloudprovider.InstancesV2, bool) {
 	klog.V(4).Info("openstack.Instancesv2() called")
 
-	compute, err := client.NewComputeV2(os.provider, os.epOpts)
+	defaultClients, err := newRegionClients(os.provider, os.epOpts, "")
 	if err != nil {
-		klog.Errorf("unable to access compute v2 API : %v", err)
+		klog.Errorf("%v", err)
 		return nil, false
 	}
 
-	network, err := client.NewNetworkV2(os.provider, os.epOpts)
-	if err != nil {
-		klog.Errorf("unable to access network v2 API : %v", err)
-		return nil, false
+	var additionalRegions []string
+	regionalClients := make(map[string]*regionClients)
+	for _, region := range os.instancesOpts.AdditionalRegion {
+		if region == os.epOpts.Region || regionalClients[region] != nil {
+			continue
+		}
+		rc, err := newRegionClients(os.provider, os.epOpts, region)
+		if err != nil {
+			klog.Errorf("%v", err)
+			return nil, false
+		}
+		additionalRegions = append(additionalRegions, region)
+		regionalClients[region] = rc
 	}
 
-	computeFactory := newClientsFactory(computeClientType, compute)
-	networkFactory := newClientsFactory(networkClientType, network)
-
 	regionalProviderID := false
 	if isRegionalProviderID := sysos.Getenv(RegionalProviderIDEnv); isRegionalProviderID == "true" {
 		regionalProviderID = true
 	}
+	if len(additionalRegions) > 0 {
+		// the region is required to find the instance of a node
+		regionalProviderID = true
+	}
 
 	return &InstancesV2{
-		compute:          computeFactory,
-		network:          networkFactory,
-		region:           os.epOpts.Region,
-		regionProviderID: regionalProviderID,
-		networkingOpts:   os.networkingOpts,
+		regionClients:     *defaultClients,
+		region:            os.epOpts.Region,
+		additionalRegions: additionalRegions,
+		regionalClients:   regionalClients,
+		regionProviderID:  regionalProviderID,
+		networkingOpts:    os.networkingOpts,
+		instancesOpts:     os.instancesOpts,
+		existenceCache:    os.existenceCache,
+		serverCache:       os.serverCache,
+		eventRecorder:     os.eventRecorder,
 	}, true
 }
 
+// newRegionClients creates the clients of a region. If region is empty, the
+// region of the endpoint options is used.
+func newRegionClients(provider *gophercloud.ProviderClient, epOpts *gophercloud.EndpointOpts, region string) (*regionClients, error) {
+	eo := *epOpts
+	if region != "" {
+		eo.Region = region
+	}
+
+	compute, err := client.NewComputeV2(provider, &eo)
+	if err != nil {
+		return nil, fmt.Errorf("unable to access compute v2 API : %v", err)
+	}
+
+	network, err := client.NewNetworkV2(provider, &eo)
+	if err != nil {
+		return nil, fmt.Errorf("unable to access network v2 API : %v", err)
+	}
+
+	rc := &regionClients{
+		compute: newRegionalClientsFactory(computeClientType, region, compute),
+		network: newRegionalClientsFactory(networkClientType, region, network),
+	}
+
+	// baremetal client is optional, it is only needed for Ironic backed nodes
+	baremetal, err := client.NewBareMetalV1(provider, &eo)
+	if err != nil {
+		klog.V(3).Infof("Baremetal node support is disabled in region %s: %v", eo.Region, err)
+	} else {
+		rc.baremetal = newRegionalClientsFactory(baremetalClientType, region, baremetal)
+	}
+
+	return rc, nil
+}
+
+// regions returns the supported regions, the default one first.
+func (i *InstancesV2) regions() []string {
+	return append([]string{i.region}, i.additionalRegions...)
+}
+
+// clientsFor returns the clients of the region, or nil if the region is not supported.
+func (i *InstancesV2) clientsFor(region string) *regionClients {
+	if region == "" || region == i.region {
+		return &i.regionClients
+	}
+	return i.regionalClients[region]
+}
+
 // InstanceExists indicates whether a given node exists according to the cloud provider
 func (i *InstancesV2) InstanceExists(ctx context.Context, node *v1.Node) (bool, error) {
-	_, err := i.getInstance(ctx, node)
+	if isNodeExcludedFromLifecycle(node) {
+		klog.V(6).Infof("node %s is excluded from the lifecycle, assuming it exists", node.Name)
+		return true, nil
+	}
+
+	if !i.existenceCache.allow() {
+		return i.failSafeInstanceExists(node, errCircuitOpen)
+	}
+
+	srv, _, err := i.getInstance(ctx, node)
 	if err == cloudprovider.InstanceNotFound {
 		klog.V(6).Infof("instance not found for node: %s", node.Name)
+		i.existenceCache.notFound(node.Name)
 		return false, nil
 	}
 
 	if err != nil {
+		if isTransientComputeError(err) {
+			i.existenceCache.failed()
+			return i.failSafeInstanceExists(node, err)
+		}
 		return false, err
 	}
 
+	if i.errorGracePeriodExpired(srv) {
+		klog.Warningf("Server %s of node %s is in ERROR state since %s, reporting it as missing", srv.ID, node.Name, serverErrorSince(srv))
+		if i.eventRecorder != nil {
+			i.eventRecorder.Eventf(node, v1.EventTypeWarning, eventInstanceErrorExpired, "Server %s is in ERROR state since %s: %s", srv.ID, serverErrorSince(srv), serverFaultMessage(srv))
+		}
+		i.existenceCache.notFound(node.Name)
+		return false, nil
+	}
+
+	i.existenceCache.seen(node.Name)
 	return true, nil
 }
 
+// failSafeInstanceExists reports the instance of the node as existing if it was
+// seen recently enough, otherwise it returns the error of the compute API.
+func (i *InstancesV2) failSafeInstanceExists(node *v1.Node, err error) (bool, error) {
+	if i.existenceCache.assumeExists(node.Name) {
+		klog.Warningf("Unable to check instance of node %s, assuming it exists: %v", node.Name, err)
+		return true, nil
+	}
+	return false, err
+}
+
 // InstanceShutdown returns true if the instance is shutdown according to the cloud provider.
 func (i *InstancesV2) InstanceShutdown(ctx context.Context, node *v1.Node) (bool, error) {
-	server, err := i.getInstance(ctx, node)
+	if isNodeExcludedFromLifecycle(node) {
+		klog.V(6).Infof("node %s is excluded from the lifecycle, assuming it is running", node.Name)
+		return false, nil
+	}
+
+	server, _, err := i.getInstance(ctx, node)
 	if err != nil {
 		return false, err
 	}
@@ -118,7 +242,12 @@ func (i *InstancesV2) InstanceShutdown(ctx context.Context, node *v1.Node) (bool
 
 // InstanceMetadata returns the instance's metadata.
 func (i *InstancesV2) InstanceMetadata(ctx context.Context, node *v1.Node) (*cloudprovider.InstanceMetadata, error) {
-	srv, err := i.getInstance(ctx, node)
+	if isNodeExcludedFromLifecycle(node) {
+		klog.V(6).Infof("node %s is excluded from the lifecycle, keeping its current metadata", node.Name)
+		return nodeCurrentMetadata(node), nil
+	}
+
+	srv, region, err := i.getInstance(ctx, node)
 	if err != nil {
 		return nil, err
 	}
@@ -126,56 +255,215 @@ func (i *InstancesV2) InstanceMetadata(ctx context.Context, node *v1.Node) (*clo
 	if srv != nil {
 		server = *srv
 	}
+	rc := i.clientsFor(region)
+
+	// the Ironic node is looked up at most once, when the flavor or the
+	// ports of the server are missing
+	var bmNode *nodes.Node
+	bmNodeFetched := false
+	getBaremetalNode := func() (*nodes.Node, error) {
+		if bmNodeFetched {
+			return bmNode, nil
+		}
+		var err error
+		bmNode, err = rc.getBaremetalNode(ctx, node, server.ID)
+		if err != nil {
+			return nil, err
+		}
+		bmNodeFetched = true
+		return bmNode, nil
+	}
 
-	instanceType, err := srvInstanceType(ctx, i.compute.get(node.ObjectMeta), &server)
+	instanceType, err := srvInstanceType(ctx, rc.compute.get(node.ObjectMeta), &server)
 	if err != nil {
-		return nil, err
+		// baremetal servers may be deployed without a flavor
+		bmNode, bmErr := getBaremetalNode()
+		if bmErr != nil || bmNode == nil {
+			return nil, err
+		}
+		instanceType, err = baremetalInstanceType(bmNode)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	ports, err := getAttachedPorts(ctx, i.network.get(node.ObjectMeta), server.ID)
+	ports, err := getAttachedPorts(ctx, rc.network.get(node.ObjectMeta), server.ID)
 	if err != nil {
 		return nil, err
 	}
 
-	addresses, err := nodeAddresses(ctx, &server, ports, i.network.get(node.ObjectMeta), i.networkingOpts)
+	if len(ports) == 0 {
+		// Neutron ports of baremetal servers may not be owned by the server,
+		// discover them through the physical ports of the Ironic node instead
+		bmNode, err := getBaremetalNode()
+		if err != nil {
+			return nil, err
+		}
+		if bmNode != nil {
+			ports, err = getBaremetalAttachedPorts(ctx, rc.baremetal.get(node.ObjectMeta), rc.network.get(node.ObjectMeta), bmNode.UUID)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	addresses, err := nodeAddresses(ctx, &server, ports, rc.network.get(node.ObjectMeta), i.networkingOpts)
 	if err != nil {
 		return nil, err
 	}
 
 	availabilityZone := util.SanitizeLabel(server.AvailabilityZone)
 
+	var additionalLabels map[string]string
+	if i.instancesOpts.ServerGroupLabels {
+		sg, err := getServerGroup(ctx, rc.compute.get(node.ObjectMeta), server.ID)
+		if err != nil {
+			// labels are informational, don't fail the node initialization
+			klog.Warningf("Failed to get server group of server %s: %v", server.ID, err)
+		} else if sg != nil {
+			additionalLabels = serverGroupLabels(sg)
+		}
+	}
+
+	if i.instancesOpts.PrimaryPortLabel {
+		additionalLabels = util.SetMapIfNotEmpty(additionalLabels, LabelPrimaryPortID, primaryPortID(ports, addresses))
+	}
+
 	return &cloudprovider.InstanceMetadata{
-		ProviderID:    i.makeInstanceID(&server),
-		InstanceType:  instanceType,
-		NodeAddresses: addresses,
-		Zone:          availabilityZone,
-		Region:        i.region,
+		ProviderID:       i.makeInstanceID(&server, region),
+		InstanceType:     instanceType,
+		NodeAddresses:    addresses,
+		Zone:             availabilityZone,
+		Region:           region,
+		AdditionalLabels: additionalLabels,
 	}, nil
 }
 
-func (i *InstancesV2) makeInstanceID(srv *servers.Server) string {
+// primaryPortID returns the ID of the port holding the first internal address
+// of the node, which is the address used by the kubelet.
+func primaryPortID(ports []PortWithTrunkDetails, addresses []v1.NodeAddress) string {
+	for _, addr := range addresses {
+		if addr.Type != v1.NodeInternalIP {
+			continue
+		}
+		for _, port := range ports {
+			for _, fixedIP := range port.FixedIPs {
+				if fixedIP.IPAddress == addr.Address {
+					return port.ID
+				}
+			}
+		}
+		return ""
+	}
+	return ""
+}
+
+// isNodeExcludedFromLifecycle returns true if the node is annotated or labeled
+// with NodeExcludeFromLifecycle set to "true".
+func isNodeExcludedFromLifecycle(node *v1.Node) bool {
+	if v, ok := node.Annotations[NodeExcludeFromLifecycle]; ok {
+		return v == "true"
+	}
+	return node.Labels[NodeExcludeFromLifecycle] == "true"
+}
+
+// nodeCurrentMetadata returns the instance metadata already set on the node,
+// so that the cloud node controller does not change it.
+func nodeCurrentMetadata(node *v1.Node) *cloudprovider.InstanceMetadata {
+	return &cloudprovider.InstanceMetadata{
+		ProviderID:    node.Spec.ProviderID,
+		InstanceType:  node.Labels[v1.LabelInstanceTypeStable],
+		NodeAddresses: node.Status.Addresses,
+		Zone:          node.Labels[v1.LabelTopologyZone],
+		Region:        node.Labels[v1.LabelTopologyRegion],
+	}
+}
+
+func (i *InstancesV2) makeInstanceID(srv *servers.Server, region string) string {
 	if i.regionProviderID {
-		return fmt.Sprintf("%s://%s/%s", ProviderName, i.region, srv.ID)
+		return fmt.Sprintf("%s://%s/%s", ProviderName, region, srv.ID)
 	}
 	return fmt.Sprintf("%s:///%s", ProviderName, srv.ID)
 }
 
-func (i *InstancesV2) getInstance(ctx context.Context, node *v1.Node) (*servers.Server, error) {
+// getInstance returns the server of the node and the region it belongs to.
+func (i *InstancesV2) getInstance(ctx context.Context, node *v1.Node) (*servers.Server, string, error) {
+	// only the servers of the default project are prefetched
+	useCache := node.Labels[CustomProjectAliasLabel] == ""
+
 	if node.Spec.ProviderID == "" {
-		return getServerByName(ctx, i.compute.get(node.ObjectMeta), node.Name)
+		// look for the server in the default region first
+		for _, region := range i.regions() {
+			if srv := i.serverCache.getByName(region, node.Name); useCache && srv != nil {
+				return srv, region, nil
+			}
+			server, err := getServerByName(ctx, i.clientsFor(region).compute.get(node.ObjectMeta), node.Name)
+			if err == errors.ErrNotFound {
+				continue
+			}
+			return server, region, err
+		}
+		return nil, "", errors.ErrNotFound
 	}
 
 	instanceID, instanceRegion, err := instanceIDFromProviderID(node.Spec.ProviderID)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+
+	if instanceRegion == "" {
+		instanceRegion = i.region
 	}
 
-	if instanceRegion != "" && instanceRegion != i.region {
-		return nil, fmt.Errorf("ProviderID \"%s\" didn't match supported region \"%s\"", node.Spec.ProviderID, i.region)
+	rc := i.clientsFor(instanceRegion)
+	if rc == nil {
+		return nil, "", fmt.Errorf("ProviderID \"%s\" didn't match supported regions \"%s\"", node.Spec.ProviderID, strings.Join(i.regions(), ","))
 	}
 
+	if srv := i.serverCache.getByID(instanceRegion, instanceID); useCache && srv != nil {
+		return srv, instanceRegion, nil
+	}
+
+	server, err := getServerByID(ctx, rc.compute.get(node.ObjectMeta), instanceID)
+	if err == cloudprovider.InstanceNotFound && rc.baremetal != nil {
+		// the providerID of a baremetal node may refer to the Ironic node
+		// instead of the Nova server deployed on it
+		bmNode, bmErr := getBaremetalNodeByID(ctx, rc.baremetal.get(node.ObjectMeta), instanceID)
+		if bmErr != nil {
+			if errors.IsNotFound(bmErr) {
+				return nil, "", cloudprovider.InstanceNotFound
+			}
+			return nil, "", bmErr
+		}
+		if bmNode.InstanceUUID == "" {
+			klog.V(4).Infof("Baremetal node %s has no instance deployed", bmNode.UUID)
+			return nil, "", cloudprovider.InstanceNotFound
+		}
+		server, err = getServerByID(ctx, rc.compute.get(node.ObjectMeta), bmNode.InstanceUUID)
+	}
+	return server, instanceRegion, err
+}
+
+// getBaremetalNode returns the Ironic node backing the server, or nil if the
+// server is not a baremetal one or baremetal support is disabled.
+func (rc *regionClients) getBaremetalNode(ctx context.Context, node *v1.Node, serverID string) (*nodes.Node, error) {
+	if rc.baremetal == nil {
+		return nil, nil
+	}
+
+	bmNode, err := getBaremetalNodeByInstanceID(ctx, rc.baremetal.get(node.ObjectMeta), serverID)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return bmNode, nil
+}
+
+func getServerByID(ctx context.Context, client *gophercloud.ServiceClient, instanceID string) (*servers.Server, error) {
 	mc := metrics.NewMetricContext("server", "get")
-	server, err := servers.Get(ctx, i.compute.get(node.ObjectMeta), instanceID).Extract()
+	server, err := servers.Get(ctx, client, instanceID).Extract()
 	if mc.ObserveRequest(err) != nil {
 		if errors.IsNotFound(err) {
 			return nil, cloudprovider.InstanceNotFound
@@ -139,6 +139,13 @@ func removeFromNodeAddresses(addresses *[]v1.NodeAddress, removeAddresses ...v1.
 	}
 }
 
+// reportSecondaryAddresses returns true if the secondary fixed IPs and the
+// trunk subport addresses of the network should be reported as node addresses.
+// All of them are reported unless 'secondary-address-network-name' is set.
+func reportSecondaryAddresses(networkingOpts NetworkingOpts, network string) bool {
+	return len(networkingOpts.SecondaryAddressNetworkName) == 0 || slices.Contains(networkingOpts.SecondaryAddressNetworkName, network)
+}
+
 // IP addresses order:
 // * interfaces private IPs
 // * access IPs
@@ -147,12 +154,55 @@ func removeFromNodeAddresses(addresses *[]v1.NodeAddress, removeAddresses ...v1.
 func nodeAddresses(ctx context.Context, srv *servers.Server, ports []PortWithTrunkDetails, client *gophercloud.ServiceClient, networkingOpts NetworkingOpts) ([]v1.NodeAddress, error) {
 	addrs := []v1.NodeAddress{}
 
+	type Address struct {
+		IPType string `mapstructure:"OS-EXT-IPS:type"`
+		Addr   string
+	}
+
+	var addresses map[string][]Address
+	err := mapstructure.Decode(srv.Addresses, &addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	// networkOf returns the name of the network the address belongs to
+	networkOf := func(ip string) string {
+		for network, props := range addresses {
+			for _, p := range props {
+				if p.Addr == ip {
+					return network
+				}
+			}
+		}
+		return ""
+	}
+
+	// secondary addresses are all the fixed IPs of a port but the first one
+	secondaryIPs := make(map[string]struct{})
+	for _, port := range ports {
+		for i, fixedIP := range port.FixedIPs {
+			if i > 0 {
+				secondaryIPs[fixedIP.IPAddress] = struct{}{}
+			}
+		}
+	}
+	isIgnoredSecondaryIP := func(network, ip string) bool {
+		if _, ok := secondaryIPs[ip]; !ok {
+			return false
+		}
+		return !reportSecondaryAddresses(networkingOpts, network)
+	}
+
 	// parse private IP addresses first in an ordered manner
 	for _, port := range ports {
 		for _, fixedIP := range port.FixedIPs {
 			if port.Status != "ACTIVE" {
 				continue
 			}
+			if isIgnoredSecondaryIP(networkOf(fixedIP.IPAddress), fixedIP.IPAddress) {
+				klog.V(5).Infof("Node '%s' secondary address '%s' ignored due to 'secondary-address-network-name' option", srv.Name, fixedIP.IPAddress)
+				continue
+			}
 			isIPv6 := net.ParseIP(fixedIP.IPAddress).To4() == nil
 			if !isIPv6 || !networkingOpts.IPv6SupportDisabled {
 				addToNodeAddresses(&addrs,
@@ -194,17 +244,6 @@ func nodeAddresses(ctx context.Context, srv *servers.Server, ports []PortWithTru
 	}
 
 	// process the rest
-	type Address struct {
-		IPType string `mapstructure:"OS-EXT-IPS:type"`
-		Addr   string
-	}
-
-	var addresses map[string][]Address
-	err := mapstructure.Decode(srv.Addresses, &addresses)
-	if err != nil {
-		return nil, err
-	}
-
 	// Add the addresses assigned on subports via trunk
 	// This exposes the vlan networks to which subports are attached
 	for _, port := range ports {
@@ -219,6 +258,10 @@ func nodeAddresses(ctx context.Context, srv *servers.Server, ports []PortWithTru
 				klog.Errorf("Failed to get subport %s network details: %v", subport.PortID, err)
 				continue
 			}
+			if !reportSecondaryAddresses(networkingOpts, n.Name) {
+				klog.V(5).Infof("Node '%s' subport '%s' addresses ignored due to 'secondary-address-network-name' option", srv.Name, p.Name)
+				continue
+			}
 			for _, fixedIP := range p.FixedIPs {
 				klog.V(5).Infof("Node '%s' is found subport '%s' address '%s/%s'", srv.Name, p.Name, n.Name, fixedIP.IPAddress)
 				isIPv6 := net.ParseIP(fixedIP.IPAddress).To4() == nil
@@ -246,6 +289,10 @@ func nodeAddresses(ctx context.Context, srv *servers.Server, ports []PortWithTru
 
 	for _, network := range networks {
 		for _, props := range addresses[network] {
+			if props.IPType != "floating" && isIgnoredSecondaryIP(network, props.Addr) {
+				continue
+			}
+
 			var addressType v1.NodeAddressType
 			if props.IPType == "floating" {
 				addressType = v1.NodeExternalIP
@@ -0,0 +1,135 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/baremetal/v1/nodes"
+	baremetalports "github.com/gophercloud/gophercloud/v2/openstack/baremetal/v1/ports"
+	neutronports "github.com/gophercloud/gophercloud/v2/openstack/networking/v2/ports"
+
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	"k8s.io/cloud-provider-openstack/pkg/util/errors"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// baremetalVIFPortIDKey is the key of the Ironic port internal_info
+	// field holding the ID of the Neutron port bound to the physical port.
+	baremetalVIFPortIDKey = "tenant_vif_port_id"
+)
+
+// getBaremetalNodeByID returns the Ironic node with the given name or UUID.
+func getBaremetalNodeByID(ctx context.Context, client *gophercloud.ServiceClient, nodeID string) (*nodes.Node, error) {
+	mc := metrics.NewMetricContext("baremetal_node", "get")
+	node, err := nodes.Get(ctx, client, nodeID).Extract()
+	if mc.ObserveRequest(err) != nil {
+		if errors.IsNotFound(err) {
+			return nil, errors.ErrNotFound
+		}
+		return nil, err
+	}
+	return node, nil
+}
+
+// getBaremetalNodeByInstanceID returns the Ironic node the Nova server with
+// the given ID is deployed on.
+func getBaremetalNodeByInstanceID(ctx context.Context, client *gophercloud.ServiceClient, instanceID string) (*nodes.Node, error) {
+	mc := metrics.NewMetricContext("baremetal_node", "list")
+	allPages, err := nodes.List(client, nodes.ListOpts{InstanceUUID: instanceID}).AllPages(ctx)
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+
+	nodeList, err := nodes.ExtractNodes(allPages)
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(nodeList) {
+	case 0:
+		return nil, errors.ErrNotFound
+	case 1:
+		return &nodeList[0], nil
+	default:
+		return nil, errors.ErrMultipleResults
+	}
+}
+
+// baremetalInstanceType returns the instance type of a baremetal node. Since
+// baremetal servers are not always scheduled using a flavor, the resource
+// class of the node is used instead.
+func baremetalInstanceType(node *nodes.Node) (string, error) {
+	if node.ResourceClass != "" && isValidLabelValue(node.ResourceClass) {
+		return node.ResourceClass, nil
+	}
+	return "", fmt.Errorf("baremetal node %s has no valid resource class", node.UUID)
+}
+
+// baremetalVIFPortIDs extracts the IDs of the Neutron ports bound to the
+// physical ports of a baremetal node.
+func baremetalVIFPortIDs(bmPorts []baremetalports.Port) []string {
+	var ids []string
+	for _, p := range bmPorts {
+		val, ok := p.InternalInfo[baremetalVIFPortIDKey]
+		if !ok {
+			continue
+		}
+		id, ok := val.(string)
+		if !ok || id == "" {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// getBaremetalAttachedPorts returns the Neutron ports bound to the physical
+// ports of a baremetal node. It is used when Neutron does not report any port
+// owned by the server, e.g. when the ports were created out of band.
+func getBaremetalAttachedPorts(ctx context.Context, baremetal, network *gophercloud.ServiceClient, nodeID string) ([]PortWithTrunkDetails, error) {
+	mc := metrics.NewMetricContext("baremetal_port", "list")
+	allPages, err := baremetalports.ListDetail(baremetal, baremetalports.ListOpts{NodeUUID: nodeID}).AllPages(ctx)
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+
+	bmPorts, err := baremetalports.ExtractPorts(allPages)
+	if err != nil {
+		return nil, err
+	}
+
+	var allPorts []PortWithTrunkDetails
+	for _, id := range baremetalVIFPortIDs(bmPorts) {
+		var port PortWithTrunkDetails
+		mc := metrics.NewMetricContext("port", "get")
+		err := neutronports.Get(ctx, network, id).ExtractInto(&port)
+		if mc.ObserveRequest(err) != nil {
+			if errors.IsNotFound(err) {
+				klog.V(4).Infof("Neutron port %s of baremetal node %s not found", id, nodeID)
+				continue
+			}
+			return nil, err
+		}
+		allPorts = append(allPorts, port)
+	}
+
+	return allPorts, nil
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/baremetal/v1/nodes"
+	baremetalports "github.com/gophercloud/gophercloud/v2/openstack/baremetal/v1/ports"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBaremetalVIFPortIDs(t *testing.T) {
+	bmPorts := []baremetalports.Port{
+		{UUID: "p1", InternalInfo: map[string]any{baremetalVIFPortIDKey: "vif-1"}},
+		{UUID: "p2", InternalInfo: map[string]any{}},
+		{UUID: "p3", InternalInfo: map[string]any{baremetalVIFPortIDKey: ""}},
+		{UUID: "p4", InternalInfo: map[string]any{baremetalVIFPortIDKey: 42}},
+		{UUID: "p5", InternalInfo: map[string]any{baremetalVIFPortIDKey: "vif-5"}},
+	}
+
+	assert.Equal(t, []string{"vif-1", "vif-5"}, baremetalVIFPortIDs(bmPorts))
+	assert.Empty(t, baremetalVIFPortIDs(nil))
+}
+
+func TestBaremetalInstanceType(t *testing.T) {
+	tests := []struct {
+		name    string
+		node    nodes.Node
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "resource class is used as instance type",
+			node: nodes.Node{UUID: "n1", ResourceClass: "baremetal.gold"},
+			want: "baremetal.gold",
+		},
+		{
+			name:    "empty resource class",
+			node:    nodes.Node{UUID: "n2"},
+			wantErr: true,
+		},
+		{
+			name:    "resource class is not a valid label value",
+			node:    nodes.Node{UUID: "n3", ResourceClass: "bare metal"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := baremetalInstanceType(&tt.node)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/cloud-provider-openstack/pkg/util/errors"
+	"k8s.io/klog/v2"
+)
+
+const defaultCircuitBreakerCooldown = 30 * time.Second
+
+// errCircuitOpen is returned when Nova is not queried because it failed too
+// many times in a row
+var errCircuitOpen = fmt.Errorf("compute API circuit breaker is open")
+
+// isTransientComputeError returns true if the error is caused by a degraded
+// compute API rather than by the instance itself.
+func isTransientComputeError(err error) bool {
+	return errors.IsServerError(err) || errors.IsTimeoutError(err)
+}
+
+// instanceExistenceCache remembers when instances were last seen by Nova and
+// protects Nova with a circuit breaker. It is used to avoid reporting nodes as
+// missing (and having them deleted) during transient compute API outages.
+type instanceExistenceCache struct {
+	failSafeWindow time.Duration
+	threshold      int
+	cooldown       time.Duration
+
+	m         sync.Mutex
+	lastSeen  map[string]time.Time
+	lastPrune time.Time
+	failures  int
+	openUntil time.Time
+	now       func() time.Time
+}
+
+func newInstanceExistenceCache(opts InstancesOpts) *instanceExistenceCache {
+	cooldown := opts.CircuitBreakerCooldown.Duration
+	if cooldown == 0 {
+		cooldown = defaultCircuitBreakerCooldown
+	}
+	return &instanceExistenceCache{
+		failSafeWindow: opts.FailSafeWindow.Duration,
+		threshold:      opts.CircuitBreakerThreshold,
+		cooldown:       cooldown,
+		lastSeen:       make(map[string]time.Time),
+		now:            time.Now,
+	}
+}
+
+// allow returns false if the circuit breaker is open and Nova should not be queried.
+func (c *instanceExistenceCache) allow() bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.threshold <= 0 || !c.now().Before(c.openUntil)
+}
+
+// seen records that the instance of the node exists.
+func (c *instanceExistenceCache) seen(key string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.failures = 0
+	if c.failSafeWindow <= 0 {
+		return
+	}
+	now := c.now()
+	c.lastSeen[key] = now
+	c.pruneLocked(now)
+}
+
+// pruneLocked drops the instances not seen within the fail-safe window, e.g.
+// of the nodes deleted without their instance being reported as missing. It
+// scans the instances at most once per window.
+func (c *instanceExistenceCache) pruneLocked(now time.Time) {
+	if now.Sub(c.lastPrune) < c.failSafeWindow {
+		return
+	}
+	c.lastPrune = now
+	for key, t := range c.lastSeen {
+		if now.Sub(t) > c.failSafeWindow {
+			delete(c.lastSeen, key)
+		}
+	}
+}
+
+// notFound records that the instance of the node doesn't exist.
+func (c *instanceExistenceCache) notFound(key string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.failures = 0
+	delete(c.lastSeen, key)
+}
+
+// forget drops the instance of a deleted node.
+func (c *instanceExistenceCache) forget(key string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	delete(c.lastSeen, key)
+}
+
+// failed records a transient failure of Nova and opens the circuit breaker
+// once the threshold of consecutive failures is reached.
+func (c *instanceExistenceCache) failed() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.failures++
+	if c.threshold > 0 && c.failures >= c.threshold {
+		klog.Warningf("Compute API failed %d times in a row, not querying it for %s", c.failures, c.cooldown)
+		c.openUntil = c.now().Add(c.cooldown)
+		c.failures = 0
+	}
+}
+
+// assumeExists returns true if the instance of the node was seen within the
+// fail-safe window and can be assumed to still exist.
+func (c *instanceExistenceCache) assumeExists(key string) bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.failSafeWindow <= 0 {
+		return false
+	}
+	t, ok := c.lastSeen[key]
+	if ok && c.now().Sub(t) > c.failSafeWindow {
+		delete(c.lastSeen, key)
+		return false
+	}
+	return ok
+}
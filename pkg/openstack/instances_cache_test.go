@@ -0,0 +1,104 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/cloud-provider-openstack/pkg/util"
+)
+
+func TestInstanceExistenceCacheFailSafeWindow(t *testing.T) {
+	now := time.Now()
+	c := newInstanceExistenceCache(InstancesOpts{FailSafeWindow: util.MyDuration{Duration: time.Minute}})
+	c.now = func() time.Time { return now }
+
+	assert.False(t, c.assumeExists("node1"), "unknown node must not be assumed to exist")
+
+	c.seen("node1")
+	now = now.Add(30 * time.Second)
+	assert.True(t, c.assumeExists("node1"))
+
+	now = now.Add(time.Minute)
+	assert.False(t, c.assumeExists("node1"), "fail-safe window expired")
+
+	c.seen("node1")
+	c.notFound("node1")
+	assert.False(t, c.assumeExists("node1"), "deleted node must not be assumed to exist")
+}
+
+func TestInstanceExistenceCachePrune(t *testing.T) {
+	now := time.Now()
+	c := newInstanceExistenceCache(InstancesOpts{FailSafeWindow: util.MyDuration{Duration: time.Minute}})
+	c.now = func() time.Time { return now }
+
+	c.seen("node1")
+	c.seen("node2")
+	c.forget("node2")
+	assert.NotContains(t, c.lastSeen, "node2", "deleted node must be forgotten")
+
+	// node1 is not seen anymore, e.g. its node was deleted while the
+	// controller was down, and is pruned once the window expired
+	now = now.Add(2 * time.Minute)
+	c.seen("node3")
+	assert.NotContains(t, c.lastSeen, "node1")
+	assert.Contains(t, c.lastSeen, "node3")
+}
+
+func TestInstanceExistenceCacheDisabled(t *testing.T) {
+	c := newInstanceExistenceCache(InstancesOpts{})
+
+	c.seen("node1")
+	assert.False(t, c.assumeExists("node1"))
+
+	for range 10 {
+		c.failed()
+	}
+	assert.True(t, c.allow())
+}
+
+func TestInstanceExistenceCacheCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	c := newInstanceExistenceCache(InstancesOpts{CircuitBreakerThreshold: 3})
+	c.now = func() time.Time { return now }
+
+	c.failed()
+	c.failed()
+	assert.True(t, c.allow())
+
+	// a success resets the consecutive failures
+	c.seen("node1")
+	c.failed()
+	c.failed()
+	assert.True(t, c.allow())
+
+	c.failed()
+	assert.False(t, c.allow())
+
+	now = now.Add(defaultCircuitBreakerCooldown)
+	assert.True(t, c.allow())
+}
+
+func TestIsTransientComputeError(t *testing.T) {
+	assert.True(t, isTransientComputeError(gophercloud.ErrUnexpectedResponseCode{Actual: 503}))
+	assert.True(t, isTransientComputeError(gophercloud.ErrUnexpectedResponseCode{Actual: 500}))
+	assert.False(t, isTransientComputeError(gophercloud.ErrUnexpectedResponseCode{Actual: 404}))
+	assert.False(t, isTransientComputeError(errCircuitOpen))
+}
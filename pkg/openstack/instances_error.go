@@ -0,0 +1,167 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const (
+	instanceError = "ERROR"
+
+	// TaintInstanceError is the taint set on the nodes whose server is in ERROR state
+	TaintInstanceError = "node.openstack.org/instance-error"
+
+	errorStateCheckPeriod = time.Minute
+)
+
+// serverFaultMessage returns the message of the Nova fault of the server.
+func serverFaultMessage(srv *servers.Server) string {
+	if srv.Fault.Message == "" {
+		return "unknown fault"
+	}
+	return fmt.Sprintf("%s (code %d)", srv.Fault.Message, srv.Fault.Code)
+}
+
+// serverErrorSince returns when the server entered the ERROR state. The fault
+// time is used when known, otherwise the last update of the server.
+func serverErrorSince(srv *servers.Server) time.Time {
+	if !srv.Fault.Created.IsZero() {
+		return srv.Fault.Created
+	}
+	return srv.Updated
+}
+
+// errorGracePeriodExpired returns true if the server has been in ERROR state
+// for longer than the configured grace period and its node must be deleted.
+func (i *InstancesV2) errorGracePeriodExpired(srv *servers.Server) bool {
+	gracePeriod := i.instancesOpts.ErrorStateDeleteAfter.Duration
+	if gracePeriod <= 0 || srv.Status != instanceError {
+		return false
+	}
+	return time.Since(serverErrorSince(srv)) > gracePeriod
+}
+
+// runErrorStateReconciler periodically taints the nodes whose server is in
+// ERROR state, and removes the taint once the server recovered.
+func (os *OpenStack) runErrorStateReconciler(stop <-chan struct{}) {
+	klog.V(1).Infof("Tainting nodes with servers in ERROR state every %s", errorStateCheckPeriod)
+
+	ctx := wait.ContextForChannel(stop)
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := os.reconcileErrorStateNodes(ctx); err != nil {
+			klog.Errorf("Failed to reconcile nodes with servers in ERROR state: %v", err)
+		}
+	}, errorStateCheckPeriod)
+}
+
+func (os *OpenStack) reconcileErrorStateNodes(ctx context.Context) error {
+	if os.nodeInformerHasSynced == nil || !os.nodeInformerHasSynced() {
+		klog.V(4).Info("Node informer is not yet synced, skipping ERROR state reconciliation")
+		return nil
+	}
+
+	instances, ok := os.InstancesV2()
+	if !ok {
+		return fmt.Errorf("instances are not supported")
+	}
+	i := instances.(*InstancesV2)
+
+	nodes, err := os.nodeInformer.Lister().List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	for _, node := range nodes {
+		if node.Spec.ProviderID == "" || isNodeExcludedFromLifecycle(node) {
+			continue
+		}
+
+		srv, _, err := i.getInstance(ctx, node)
+		if err != nil {
+			klog.V(4).Infof("Failed to get the instance of node %s: %v", node.Name, err)
+			continue
+		}
+
+		if err := os.updateNodeErrorTaint(ctx, node, srv); err != nil {
+			klog.Errorf("Failed to update the %s taint of node %s: %v", TaintInstanceError, node.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// updateNodeErrorTaint adds or removes the ERROR state taint of the node
+// according to the status of its server.
+func (os *OpenStack) updateNodeErrorTaint(ctx context.Context, node *v1.Node, srv *servers.Server) error {
+	inError := srv.Status == instanceError
+	if inError == hasErrorTaint(node) {
+		return nil
+	}
+
+	newNode := node.DeepCopy()
+	if inError {
+		newNode.Spec.Taints = append(newNode.Spec.Taints, v1.Taint{
+			Key:    TaintInstanceError,
+			Effect: v1.TaintEffectNoSchedule,
+		})
+	} else {
+		var taints []v1.Taint
+		for _, taint := range newNode.Spec.Taints {
+			if taint.Key != TaintInstanceError {
+				taints = append(taints, taint)
+			}
+		}
+		newNode.Spec.Taints = taints
+	}
+
+	if _, err := os.kclient.CoreV1().Nodes().Update(ctx, newNode, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+
+	if inError {
+		klog.Warningf("Server %s of node %s is in ERROR state: %s", srv.ID, node.Name, serverFaultMessage(srv))
+		if os.eventRecorder != nil {
+			os.eventRecorder.Eventf(node, v1.EventTypeWarning, eventInstanceError, "Server %s is in ERROR state: %s", srv.ID, serverFaultMessage(srv))
+		}
+	} else {
+		klog.Infof("Server %s of node %s recovered from ERROR state", srv.ID, node.Name)
+		if os.eventRecorder != nil {
+			os.eventRecorder.Eventf(node, v1.EventTypeNormal, eventInstanceRecovered, "Server %s recovered from ERROR state, current status %s", srv.ID, srv.Status)
+		}
+	}
+
+	return nil
+}
+
+func hasErrorTaint(node *v1.Node) bool {
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == TaintInstanceError {
+			return true
+		}
+	}
+	return false
+}
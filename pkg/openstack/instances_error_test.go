@@ -0,0 +1,86 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/cloud-provider-openstack/pkg/util"
+)
+
+func TestErrorGracePeriodExpired(t *testing.T) {
+	i := &InstancesV2{instancesOpts: InstancesOpts{ErrorStateDeleteAfter: util.MyDuration{Duration: time.Hour}}}
+
+	old := time.Now().Add(-2 * time.Hour)
+	recent := time.Now().Add(-time.Minute)
+
+	assert.True(t, i.errorGracePeriodExpired(&servers.Server{Status: instanceError, Updated: old}))
+	assert.False(t, i.errorGracePeriodExpired(&servers.Server{Status: instanceError, Updated: recent}))
+	assert.False(t, i.errorGracePeriodExpired(&servers.Server{Status: instanceError, Updated: old, Fault: servers.Fault{Created: recent}}),
+		"fault time takes precedence over the update time")
+	assert.False(t, i.errorGracePeriodExpired(&servers.Server{Status: "ACTIVE", Updated: old}))
+
+	disabled := &InstancesV2{}
+	assert.False(t, disabled.errorGracePeriodExpired(&servers.Server{Status: instanceError, Updated: old}))
+}
+
+func TestUpdateNodeErrorTaint(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+		Spec: v1.NodeSpec{
+			Taints: []v1.Taint{{Key: "foo", Effect: v1.TaintEffectNoExecute}},
+		},
+	}
+
+	kclient := fake.NewClientset(node)
+	recorder := record.NewFakeRecorder(10)
+	os := &OpenStack{kclient: kclient, eventRecorder: recorder}
+
+	srv := &servers.Server{ID: "srv1", Status: instanceError, Fault: servers.Fault{Code: 500, Message: "No valid host was found"}}
+	err := os.updateNodeErrorTaint(context.TODO(), node, srv)
+	assert.NoError(t, err)
+
+	node, err = kclient.CoreV1().Nodes().Get(context.TODO(), "node1", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []v1.Taint{
+		{Key: "foo", Effect: v1.TaintEffectNoExecute},
+		{Key: TaintInstanceError, Effect: v1.TaintEffectNoSchedule},
+	}, node.Spec.Taints)
+	assert.Contains(t, <-recorder.Events, "No valid host was found (code 500)")
+
+	// already tainted
+	err = os.updateNodeErrorTaint(context.TODO(), node, srv)
+	assert.NoError(t, err)
+	assert.Empty(t, recorder.Events)
+
+	srv.Status = "ACTIVE"
+	err = os.updateNodeErrorTaint(context.TODO(), node, srv)
+	assert.NoError(t, err)
+
+	node, err = kclient.CoreV1().Nodes().Get(context.TODO(), "node1", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []v1.Taint{{Key: "foo", Effect: v1.TaintEffectNoExecute}}, node.Spec.Taints)
+	assert.Contains(t, <-recorder.Events, eventInstanceRecovered)
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/v2/pagination"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	"k8s.io/klog/v2"
+)
+
+type cachedServer struct {
+	server  servers.Server
+	region  string
+	fetched time.Time
+}
+
+// serverCache holds the servers of the cluster nodes fetched with a single
+// listing on startup, so that the controllers syncing all the nodes right
+// after a restart don't issue a request per node.
+type serverCache struct {
+	ttl time.Duration
+
+	m      sync.Mutex
+	byID   map[string]cachedServer
+	byName map[string]cachedServer
+	now    func() time.Time
+}
+
+func newServerCache(ttl time.Duration) *serverCache {
+	return &serverCache{
+		ttl:    ttl,
+		byID:   make(map[string]cachedServer),
+		byName: make(map[string]cachedServer),
+		now:    time.Now,
+	}
+}
+
+func (c *serverCache) add(region string, srv servers.Server) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	entry := cachedServer{server: srv, region: region, fetched: c.now()}
+	c.byID[region+"/"+srv.ID] = entry
+	c.byName[region+"/"+srv.Name] = entry
+}
+
+func (c *serverCache) fresh(entry cachedServer, ok bool) bool {
+	return ok && c.now().Sub(entry.fetched) <= c.ttl
+}
+
+// getByID returns the cached server with the given ID in the region, or nil
+// if it's not cached or expired.
+func (c *serverCache) getByID(region, id string) *servers.Server {
+	if c == nil {
+		return nil
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	entry, ok := c.byID[region+"/"+id]
+	if !c.fresh(entry, ok) {
+		return nil
+	}
+	return &entry.server
+}
+
+// getByName returns the cached server with the given name in the region, or
+// nil if it's not cached or expired. The names are only unique within a
+// region, so the servers of the nodes with the same name in different regions
+// are cached separately.
+func (c *serverCache) getByName(region, name string) *servers.Server {
+	if c == nil {
+		return nil
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	entry, ok := c.byName[region+"/"+name]
+	if !c.fresh(entry, ok) {
+		return nil
+	}
+	return &entry.server
+}
+
+// prefetchServers waits for the node informer to be synced and warms the
+// server cache with the servers of all the cluster nodes.
+func (os *OpenStack) prefetchServers(stop <-chan struct{}) {
+	ctx := wait.ContextForChannel(stop)
+	err := wait.PollUntilContextCancel(ctx, time.Second, true, func(context.Context) (bool, error) {
+		return os.nodeInformerHasSynced != nil && os.nodeInformerHasSynced(), nil
+	})
+	if err != nil {
+		klog.Warningf("Node informer was not synced, servers are not prefetched: %v", err)
+		return
+	}
+
+	instances, ok := os.InstancesV2()
+	if !ok {
+		return
+	}
+	i := instances.(*InstancesV2)
+
+	nodes, err := os.nodeInformer.Lister().List(labels.Everything())
+	if err != nil {
+		klog.Errorf("Failed to list nodes, servers are not prefetched: %v", err)
+		return
+	}
+
+	ids := make(map[string]sets.Set[string])
+	names := sets.New[string]()
+	for _, node := range nodes {
+		if node.Labels[CustomProjectAliasLabel] != "" {
+			// the servers of other projects are not listed
+			continue
+		}
+		if node.Spec.ProviderID == "" {
+			names.Insert(node.Name)
+			continue
+		}
+		instanceID, region, err := instanceIDFromProviderID(node.Spec.ProviderID)
+		if err != nil {
+			continue
+		}
+		if region == "" {
+			region = i.region
+		}
+		if ids[region] == nil {
+			ids[region] = sets.New[string]()
+		}
+		ids[region].Insert(instanceID)
+	}
+
+	count := 0
+	for _, region := range i.regions() {
+		rc := i.clientsFor(region)
+		mc := metrics.NewMetricContext("server", "list")
+		err := servers.List(rc.compute.defaultClient, servers.ListOpts{}).EachPage(ctx, func(_ context.Context, page pagination.Page) (bool, error) {
+			srvs, err := servers.ExtractServers(page)
+			if err != nil {
+				return false, err
+			}
+			for _, srv := range srvs {
+				if ids[region].Has(srv.ID) || names.Has(srv.Name) {
+					os.serverCache.add(region, srv)
+					count++
+				}
+			}
+			return true, nil
+		})
+		if mc.ObserveRequest(err) != nil {
+			klog.Errorf("Failed to prefetch servers of region %s: %v", region, err)
+		}
+	}
+
+	klog.Infof("Prefetched %d servers of %d nodes", count, len(nodes))
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestServerCache(t *testing.T) {
+	now := time.Now()
+	c := newServerCache(time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.add("RegionOne", servers.Server{ID: "id1", Name: "node1"})
+
+	assert.Equal(t, "id1", c.getByID("RegionOne", "id1").ID)
+	assert.Nil(t, c.getByID("RegionTwo", "id1"))
+	assert.Nil(t, c.getByID("RegionOne", "id2"))
+
+	assert.Equal(t, "id1", c.getByName("RegionOne", "node1").ID)
+	assert.Nil(t, c.getByName("RegionTwo", "node1"))
+
+	// the nodes with the same name in different regions don't collide
+	c.add("RegionTwo", servers.Server{ID: "id2", Name: "node1"})
+	assert.Equal(t, "id1", c.getByName("RegionOne", "node1").ID)
+	assert.Equal(t, "id2", c.getByName("RegionTwo", "node1").ID)
+
+	now = now.Add(2 * time.Minute)
+	assert.Nil(t, c.getByID("RegionOne", "id1"))
+	assert.Nil(t, c.getByName("RegionOne", "node1"))
+
+	// a disabled cache is nil
+	var disabled *serverCache
+	assert.Nil(t, disabled.getByID("RegionOne", "id1"))
+}
+
+func TestGetInstanceFromServerCache(t *testing.T) {
+	c := newServerCache(time.Minute)
+	c.add("RegionOne", servers.Server{ID: "id1", Name: "node1"})
+
+	// no clients are configured, any call to OpenStack would panic
+	i := &InstancesV2{region: "RegionOne", serverCache: c}
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+		Spec:       v1.NodeSpec{ProviderID: "openstack:///id1"},
+	}
+	srv, region, err := i.getInstance(context.TODO(), node)
+	assert.NoError(t, err)
+	assert.Equal(t, "id1", srv.ID)
+	assert.Equal(t, "RegionOne", region)
+
+	node.Spec.ProviderID = ""
+	srv, _, err = i.getInstance(context.TODO(), node)
+	assert.NoError(t, err)
+	assert.Equal(t, "id1", srv.ID)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+	"slices"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servergroups"
+	"github.com/gophercloud/gophercloud/v2/pagination"
+
+	"k8s.io/cloud-provider-openstack/pkg/metrics"
+	"k8s.io/cloud-provider-openstack/pkg/util"
+)
+
+const (
+	// LabelServerGroup is the node label holding the name of the Nova server group of the node
+	LabelServerGroup = "node.openstack.org/server-group"
+	// LabelServerGroupPolicy is the node label holding the policy of the Nova server group of the node
+	LabelServerGroupPolicy = "node.openstack.org/server-group-policy"
+)
+
+// getServerGroup returns the server group the server is a member of, or nil
+// if the server doesn't belong to any server group.
+func getServerGroup(ctx context.Context, client *gophercloud.ServiceClient, serverID string) (*servergroups.ServerGroup, error) {
+	var group *servergroups.ServerGroup
+
+	mc := metrics.NewMetricContext("server_group", "list")
+	err := servergroups.List(client, servergroups.ListOpts{}).EachPage(ctx, func(_ context.Context, page pagination.Page) (bool, error) {
+		sgs, err := servergroups.ExtractServerGroups(page)
+		if err != nil {
+			return false, err
+		}
+		for _, sg := range sgs {
+			if slices.Contains(sg.Members, serverID) {
+				group = &sg
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if mc.ObserveRequest(err) != nil {
+		return nil, err
+	}
+
+	return group, nil
+}
+
+// serverGroupPolicy returns the policy of the server group. The policy field
+// is only returned by Nova since microversion 2.64, older versions return the
+// list of policies instead.
+func serverGroupPolicy(sg *servergroups.ServerGroup) string {
+	if sg.Policy != nil {
+		return *sg.Policy
+	}
+	if len(sg.Policies) > 0 {
+		return sg.Policies[0]
+	}
+	return ""
+}
+
+// serverGroupLabels returns the node labels describing the server group.
+func serverGroupLabels(sg *servergroups.ServerGroup) map[string]string {
+	var labels map[string]string
+	labels = util.SetMapIfNotEmpty(labels, LabelServerGroup, util.SanitizeLabel(sg.Name))
+	labels = util.SetMapIfNotEmpty(labels, LabelServerGroupPolicy, util.SanitizeLabel(serverGroupPolicy(sg)))
+	return labels
+}
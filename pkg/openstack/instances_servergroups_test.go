@@ -0,0 +1,68 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servergroups"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerGroupLabels(t *testing.T) {
+	policy := "soft-anti-affinity"
+
+	tests := []struct {
+		name string
+		sg   servergroups.ServerGroup
+		want map[string]string
+	}{
+		{
+			name: "policy field is preferred",
+			sg:   servergroups.ServerGroup{Name: "workers", Policy: &policy, Policies: []string{"affinity"}},
+			want: map[string]string{
+				LabelServerGroup:       "workers",
+				LabelServerGroupPolicy: "soft-anti-affinity",
+			},
+		},
+		{
+			name: "legacy policies list",
+			sg:   servergroups.ServerGroup{Name: "workers", Policies: []string{"anti-affinity"}},
+			want: map[string]string{
+				LabelServerGroup:       "workers",
+				LabelServerGroupPolicy: "anti-affinity",
+			},
+		},
+		{
+			name: "name is sanitized",
+			sg:   servergroups.ServerGroup{Name: "my workers"},
+			want: map[string]string{
+				LabelServerGroup: "my-workers",
+			},
+		},
+		{
+			name: "empty server group",
+			sg:   servergroups.ServerGroup{},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, serverGroupLabels(&tt.sg))
+		})
+	}
+}
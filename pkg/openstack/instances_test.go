@@ -17,9 +17,13 @@ limitations under the License.
 package openstack
 
 import (
+	"context"
 	"testing"
 
+	neutronports "github.com/gophercloud/gophercloud/v2/openstack/networking/v2/ports"
 	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func Test_instanceIDFromProviderID(t *testing.T) {
@@ -92,3 +96,147 @@ func Test_instanceIDFromProviderID(t *testing.T) {
 		})
 	}
 }
+
+func TestInstancesV2ExcludedNode(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "external",
+			Annotations: map[string]string{
+				NodeExcludeFromLifecycle: "true",
+			},
+			Labels: map[string]string{
+				v1.LabelInstanceTypeStable: "m1.small",
+				v1.LabelTopologyZone:       "nova",
+				v1.LabelTopologyRegion:     "RegionOne",
+			},
+		},
+		Spec: v1.NodeSpec{
+			ProviderID: "openstack:///missing",
+		},
+		Status: v1.NodeStatus{
+			Addresses: []v1.NodeAddress{
+				{Type: v1.NodeInternalIP, Address: "10.0.0.1"},
+			},
+		},
+	}
+
+	// no clients are configured, any call to OpenStack would panic
+	i := &InstancesV2{}
+
+	exists, err := i.InstanceExists(context.TODO(), node)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	shutdown, err := i.InstanceShutdown(context.TODO(), node)
+	assert.NoError(t, err)
+	assert.False(t, shutdown)
+
+	md, err := i.InstanceMetadata(context.TODO(), node)
+	assert.NoError(t, err)
+	assert.Equal(t, "openstack:///missing", md.ProviderID)
+	assert.Equal(t, "m1.small", md.InstanceType)
+	assert.Equal(t, "nova", md.Zone)
+	assert.Equal(t, "RegionOne", md.Region)
+	assert.Equal(t, node.Status.Addresses, md.NodeAddresses)
+}
+
+func TestIsNodeExcludedFromLifecycle(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		labels      map[string]string
+		want        bool
+	}{
+		{
+			name: "no annotation or label",
+			want: false,
+		},
+		{
+			name:        "annotation set to true",
+			annotations: map[string]string{NodeExcludeFromLifecycle: "true"},
+			want:        true,
+		},
+		{
+			name:   "label set to true",
+			labels: map[string]string{NodeExcludeFromLifecycle: "true"},
+			want:   true,
+		},
+		{
+			name:        "annotation takes precedence over label",
+			annotations: map[string]string{NodeExcludeFromLifecycle: "false"},
+			labels:      map[string]string{NodeExcludeFromLifecycle: "true"},
+			want:        false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations, Labels: tt.labels}}
+			assert.Equal(t, tt.want, isNodeExcludedFromLifecycle(node))
+		})
+	}
+}
+
+func TestInstancesV2Regions(t *testing.T) {
+	r2 := &regionClients{}
+	i := &InstancesV2{
+		region:            "RegionOne",
+		additionalRegions: []string{"RegionTwo"},
+		regionalClients:   map[string]*regionClients{"RegionTwo": r2},
+	}
+
+	assert.Equal(t, []string{"RegionOne", "RegionTwo"}, i.regions())
+	assert.Equal(t, &i.regionClients, i.clientsFor(""))
+	assert.Equal(t, &i.regionClients, i.clientsFor("RegionOne"))
+	assert.Equal(t, r2, i.clientsFor("RegionTwo"))
+	assert.Nil(t, i.clientsFor("RegionThree"))
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node"},
+		Spec:       v1.NodeSpec{ProviderID: "openstack://RegionThree/testInstanceID"},
+	}
+	_, _, err := i.getInstance(context.TODO(), node)
+	assert.ErrorContains(t, err, "didn't match supported regions \"RegionOne,RegionTwo\"")
+}
+
+func TestPrimaryPortID(t *testing.T) {
+	ports := []PortWithTrunkDetails{
+		{Port: neutronports.Port{ID: "port-storage", FixedIPs: []neutronports.IP{{IPAddress: "10.1.0.5"}}}},
+		{Port: neutronports.Port{ID: "port-primary", FixedIPs: []neutronports.IP{{IPAddress: "10.0.0.5"}, {IPAddress: "10.0.0.6"}}}},
+	}
+
+	tests := []struct {
+		name      string
+		addresses []v1.NodeAddress
+		want      string
+	}{
+		{
+			name: "port of the first internal address",
+			addresses: []v1.NodeAddress{
+				{Type: v1.NodeExternalIP, Address: "10.1.0.5"},
+				{Type: v1.NodeInternalIP, Address: "10.0.0.6"},
+				{Type: v1.NodeInternalIP, Address: "10.1.0.5"},
+			},
+			want: "port-primary",
+		},
+		{
+			name: "first internal address is not a port address",
+			addresses: []v1.NodeAddress{
+				{Type: v1.NodeInternalIP, Address: "192.168.0.1"},
+				{Type: v1.NodeInternalIP, Address: "10.0.0.5"},
+			},
+			want: "",
+		},
+		{
+			name: "no internal address",
+			addresses: []v1.NodeAddress{
+				{Type: v1.NodeHostName, Address: "node"},
+			},
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, primaryPortID(ports, tt.addresses))
+		})
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cloud-provider-openstack/pkg/util"
+	"k8s.io/klog/v2"
+)
+
+// runZoneRelabeler periodically updates the zone labels of the nodes whose
+// server was moved to another availability zone, e.g. by a live migration or
+// a host aggregate change. The cloud node controller only sets these labels
+// when the node is initialized.
+func (os *OpenStack) runZoneRelabeler(stop <-chan struct{}) {
+	period := os.instancesOpts.ZoneRelabelPeriod.Duration
+	klog.V(1).Infof("Reconciling node zone labels every %s", period)
+
+	ctx := wait.ContextForChannel(stop)
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := os.reconcileNodeZones(ctx); err != nil {
+			klog.Errorf("Failed to reconcile node zone labels: %v", err)
+		}
+	}, period)
+}
+
+func (os *OpenStack) reconcileNodeZones(ctx context.Context) error {
+	if os.nodeInformerHasSynced == nil || !os.nodeInformerHasSynced() {
+		klog.V(4).Info("Node informer is not yet synced, skipping zone labels reconciliation")
+		return nil
+	}
+
+	instances, ok := os.InstancesV2()
+	if !ok {
+		return fmt.Errorf("instances are not supported")
+	}
+	i := instances.(*InstancesV2)
+
+	nodes, err := os.nodeInformer.Lister().List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	for _, node := range nodes {
+		if node.Spec.ProviderID == "" || isNodeExcludedFromLifecycle(node) {
+			continue
+		}
+
+		srv, _, err := i.getInstance(ctx, node)
+		if err != nil {
+			klog.V(4).Infof("Failed to get the instance of node %s: %v", node.Name, err)
+			continue
+		}
+
+		zone := util.SanitizeLabel(srv.AvailabilityZone)
+		current := node.Labels[v1.LabelTopologyZone]
+		if zone == "" || current == zone {
+			continue
+		}
+
+		if err := os.patchNodeZone(ctx, node, zone); err != nil {
+			klog.Errorf("Failed to update zone labels of node %s: %v", node.Name, err)
+			continue
+		}
+
+		klog.Infof("Node %s moved from zone %q to zone %q", node.Name, current, zone)
+		if os.eventRecorder != nil {
+			os.eventRecorder.Eventf(node, v1.EventTypeNormal, eventNodeZoneChanged, "Node zone changed from %q to %q", current, zone)
+		}
+	}
+
+	return nil
+}
+
+// patchNodeZone sets the zone labels of the node. The deprecated beta label is
+// only updated if the node already has it.
+func (os *OpenStack) patchNodeZone(ctx context.Context, node *v1.Node, zone string) error {
+	nodeLabels := map[string]string{
+		v1.LabelTopologyZone: zone,
+	}
+	if _, ok := node.Labels[v1.LabelFailureDomainBetaZone]; ok {
+		nodeLabels[v1.LabelFailureDomainBetaZone] = zone
+	}
+
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"labels": nodeLabels,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = os.kclient.CoreV1().Nodes().Patch(ctx, node.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
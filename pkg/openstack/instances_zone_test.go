@@ -0,0 +1,66 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPatchNodeZone(t *testing.T) {
+	nodes := []*v1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "node1",
+				Labels: map[string]string{
+					v1.LabelTopologyZone: "az1",
+					"foo":                "bar",
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "node2",
+				Labels: map[string]string{
+					v1.LabelTopologyZone:          "az1",
+					v1.LabelFailureDomainBetaZone: "az1",
+				},
+			},
+		},
+	}
+
+	kclient := fake.NewClientset(nodes[0], nodes[1])
+	os := &OpenStack{kclient: kclient}
+
+	for _, node := range nodes {
+		err := os.patchNodeZone(context.TODO(), node, "az2")
+		assert.NoError(t, err)
+	}
+
+	node1, err := kclient.CoreV1().Nodes().Get(context.TODO(), "node1", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{v1.LabelTopologyZone: "az2", "foo": "bar"}, node1.Labels)
+
+	node2, err := kclient.CoreV1().Nodes().Get(context.TODO(), "node2", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{v1.LabelTopologyZone: "az2", v1.LabelFailureDomainBetaZone: "az2"}, node2.Labels)
+}
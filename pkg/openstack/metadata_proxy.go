@@ -0,0 +1,212 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// metadataProxyPath is the path the node metadata is served on
+	metadataProxyPath = "/openstack/v1/metadata"
+	// nodeNameExtraKey is the key of the user extra info holding the name of
+	// the node the pod owning a bound service account token runs on
+	nodeNameExtraKey = "authentication.kubernetes.io/node-name"
+
+	// metadataProxyReadHeaderTimeout, metadataProxyReadTimeout and
+	// metadataProxyWriteTimeout bound the time a client may hold a connection
+	metadataProxyReadHeaderTimeout = 10 * time.Second
+	metadataProxyReadTimeout       = 30 * time.Second
+	metadataProxyWriteTimeout      = 30 * time.Second
+	// metadataProxyShutdownTimeout is how long the requests in progress are
+	// waited for when stopping
+	metadataProxyShutdownTimeout = 10 * time.Second
+)
+
+var (
+	metadataProxyBindAddress string
+	metadataProxyCertFile    string
+	metadataProxyKeyFile     string
+)
+
+// proxyMetadata is the metadata of the node served to the pods running on it
+type proxyMetadata struct {
+	UUID             string `json:"uuid"`
+	Name             string `json:"name"`
+	ProjectID        string `json:"project_id"`
+	AvailabilityZone string `json:"availability_zone"`
+	Region           string `json:"region"`
+	Flavor           string `json:"flavor"`
+}
+
+// metadataProxy serves the OpenStack metadata of the node a pod runs on. The
+// pod authenticates with its service account token, which must be bound to
+// the pod so that the node it runs on is known.
+type metadataProxy struct {
+	kclient     kubernetes.Interface
+	getMetadata func(ctx context.Context, node *v1.Node) (*proxyMetadata, error)
+}
+
+// runMetadataProxy starts the metadata proxy on the configured address, and
+// shuts it down when stop is closed.
+func (os *OpenStack) runMetadataProxy(stop <-chan struct{}) {
+	instances, ok := os.InstancesV2()
+	if !ok {
+		klog.Errorf("Metadata proxy is disabled: instances are not supported")
+		return
+	}
+	i := instances.(*InstancesV2)
+
+	proxy := &metadataProxy{
+		kclient:     os.kclient,
+		getMetadata: i.proxyMetadata,
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(metadataProxyPath, proxy)
+
+	server := &http.Server{
+		Addr:              metadataProxyBindAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: metadataProxyReadHeaderTimeout,
+		ReadTimeout:       metadataProxyReadTimeout,
+		WriteTimeout:      metadataProxyWriteTimeout,
+	}
+
+	go func() {
+		<-stop
+		ctx, cancel := context.WithTimeout(context.Background(), metadataProxyShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			klog.Errorf("Failed to shut down metadata proxy: %v", err)
+		}
+	}()
+
+	klog.Infof("Starting metadata proxy on %s", metadataProxyBindAddress)
+	var err error
+	if metadataProxyCertFile != "" && metadataProxyKeyFile != "" {
+		err = server.ListenAndServeTLS(metadataProxyCertFile, metadataProxyKeyFile)
+	} else {
+		klog.Warning("Metadata proxy TLS certificate is not set, service account tokens are sent in clear text")
+		err = server.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		klog.Infof("Metadata proxy stopped")
+		return
+	}
+	klog.Errorf("Metadata proxy stopped: %v", err)
+}
+
+func (p *metadataProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		http.Error(w, "missing bearer token", http.StatusUnauthorized)
+		return
+	}
+
+	nodeName, err := p.authenticate(r.Context(), token)
+	if err != nil {
+		klog.V(4).Infof("Metadata proxy request rejected: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if nodeName == "" {
+		http.Error(w, "token is not bound to a pod running on a node", http.StatusForbidden)
+		return
+	}
+
+	node, err := p.kclient.CoreV1().Nodes().Get(r.Context(), nodeName, metav1.GetOptions{})
+	if err != nil {
+		klog.Errorf("Metadata proxy failed to get node %s: %v", nodeName, err)
+		http.Error(w, "failed to get node", http.StatusInternalServerError)
+		return
+	}
+
+	md, err := p.getMetadata(r.Context(), node)
+	if err != nil {
+		klog.Errorf("Metadata proxy failed to get metadata of node %s: %v", nodeName, err)
+		http.Error(w, "failed to get node metadata", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(md); err != nil {
+		klog.Errorf("Metadata proxy failed to write response: %v", err)
+	}
+}
+
+// authenticate validates the token and returns the name of the node the pod
+// owning the token runs on.
+func (p *metadataProxy) authenticate(ctx context.Context, token string) (string, error) {
+	review := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token: token,
+		},
+	}
+	res, err := p.kclient.AuthenticationV1().TokenReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to review token: %v", err)
+	}
+	if !res.Status.Authenticated {
+		return "", fmt.Errorf("token is not authenticated: %s", res.Status.Error)
+	}
+
+	nodeNames := res.Status.User.Extra[nodeNameExtraKey]
+	if len(nodeNames) != 1 {
+		return "", nil
+	}
+	return nodeNames[0], nil
+}
+
+// proxyMetadata returns the metadata of the node served by the metadata proxy.
+func (i *InstancesV2) proxyMetadata(ctx context.Context, node *v1.Node) (*proxyMetadata, error) {
+	srv, region, err := i.getInstance(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+
+	flavor, err := srvInstanceType(ctx, i.clientsFor(region).compute.get(node.ObjectMeta), srv)
+	if err != nil {
+		klog.V(4).Infof("Failed to get flavor of server %s: %v", srv.ID, err)
+	}
+
+	return &proxyMetadata{
+		UUID:             srv.ID,
+		Name:             srv.Name,
+		ProjectID:        srv.TenantID,
+		AvailabilityZone: srv.AvailabilityZone,
+		Region:           region,
+		Flavor:           flavor,
+	}, nil
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestMetadataProxy(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	kclient := fake.NewClientset(node)
+
+	// tokens are "<node name>" for bound tokens, "unbound" or "invalid"
+	kclient.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		switch review.Spec.Token {
+		case "invalid":
+			review.Status.Authenticated = false
+		case "unbound":
+			review.Status.Authenticated = true
+		default:
+			review.Status.Authenticated = true
+			review.Status.User.Extra = map[string]authenticationv1.ExtraValue{
+				nodeNameExtraKey: {review.Spec.Token},
+			}
+		}
+		return true, review, nil
+	})
+
+	proxy := &metadataProxy{
+		kclient: kclient,
+		getMetadata: func(_ context.Context, node *v1.Node) (*proxyMetadata, error) {
+			return &proxyMetadata{UUID: "uuid-" + node.Name, AvailabilityZone: "nova", Flavor: "m1.small"}, nil
+		},
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		token      string
+		wantStatus int
+	}{
+		{name: "valid bound token", method: http.MethodGet, token: "node1", wantStatus: http.StatusOK},
+		{name: "missing token", method: http.MethodGet, wantStatus: http.StatusUnauthorized},
+		{name: "invalid token", method: http.MethodGet, token: "invalid", wantStatus: http.StatusUnauthorized},
+		{name: "token not bound to a node", method: http.MethodGet, token: "unbound", wantStatus: http.StatusForbidden},
+		{name: "unknown node", method: http.MethodGet, token: "node2", wantStatus: http.StatusInternalServerError},
+		{name: "wrong method", method: http.MethodPost, token: "node1", wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, metadataProxyPath, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+
+			proxy.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var md proxyMetadata
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &md))
+			assert.Equal(t, proxyMetadata{UUID: "uuid-node1", AvailabilityZone: "nova", Flavor: "m1.small"}, md)
+		})
+	}
+}
@@ -39,6 +39,7 @@ import (
 	coreinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/cloud-provider-openstack/pkg/client"
 	"k8s.io/cloud-provider-openstack/pkg/metrics"
@@ -68,6 +69,9 @@ var supportedContainerStore = []string{"barbican", "external"}
 // AddExtraFlags is called by the main package to add component specific command line flags
 func AddExtraFlags(fs *pflag.FlagSet) {
 	fs.StringArrayVar(&userAgentData, "user-agent", nil, "Extra data to add to gophercloud user-agent. Use multiple times to add more than one component.")
+	fs.StringVar(&metadataProxyBindAddress, "metadata-proxy-bind-address", "", "The address the node metadata proxy listens on, e.g. ':10260'. If empty, the metadata proxy is disabled.")
+	fs.StringVar(&metadataProxyCertFile, "metadata-proxy-tls-cert-file", "", "File containing the x509 certificate used by the node metadata proxy.")
+	fs.StringVar(&metadataProxyKeyFile, "metadata-proxy-tls-private-key-file", "", "File containing the x509 private key matching --metadata-proxy-tls-cert-file.")
 }
 
 type PortWithTrunkDetails struct {
@@ -138,10 +142,25 @@ type LBClass struct {
 
 // NetworkingOpts is used for networking settings
 type NetworkingOpts struct {
-	IPv6SupportDisabled bool     `gcfg:"ipv6-support-disabled"`
-	PublicNetworkName   []string `gcfg:"public-network-name"`
-	InternalNetworkName []string `gcfg:"internal-network-name"`
-	AddressSortOrder    string   `gcfg:"address-sort-order"`
+	IPv6SupportDisabled         bool     `gcfg:"ipv6-support-disabled"`
+	PublicNetworkName           []string `gcfg:"public-network-name"`
+	InternalNetworkName         []string `gcfg:"internal-network-name"`
+	AddressSortOrder            string   `gcfg:"address-sort-order"`
+	SecondaryAddressNetworkName []string `gcfg:"secondary-address-network-name"` // If specified, secondary fixed IPs and subport addresses are only reported for these networks
+}
+
+// InstancesOpts is used for the instances settings
+type InstancesOpts struct {
+	ServerGroupLabels       bool            `gcfg:"server-group-labels"`       // if true, nodes are labeled with the name and policy of their Nova server group
+	FailSafeWindow          util.MyDuration `gcfg:"fail-safe-window"`          // how long an instance seen by Nova is assumed to exist while Nova is failing. Default 0, disabled
+	CircuitBreakerThreshold int             `gcfg:"circuit-breaker-threshold"` // number of consecutive Nova failures before it stops being queried. Default 0, disabled
+	CircuitBreakerCooldown  util.MyDuration `gcfg:"circuit-breaker-cooldown"`  // how long Nova is not queried once the circuit breaker is open. Default 30s
+	AdditionalRegion        []string        `gcfg:"additional-region"`         // regions, besides the default one, the nodes can belong to
+	ZoneRelabelPeriod       util.MyDuration `gcfg:"zone-relabel-period"`       // how often the zone labels of the nodes are reconciled with the AZ of their server. Default 0, disabled
+	ServerCacheTTL          util.MyDuration `gcfg:"server-cache-ttl"`          // how long the servers prefetched on startup are used instead of querying Nova. Default 0, disabled
+	PrimaryPortLabel        bool            `gcfg:"primary-port-label"`        // if true, nodes are labeled with the ID of the Neutron port of their primary interface
+	ErrorStateTaint         bool            `gcfg:"error-state-taint"`         // if true, nodes whose server is in ERROR state are tainted
+	ErrorStateDeleteAfter   util.MyDuration `gcfg:"error-state-delete-after"`  // how long a server can stay in ERROR state before its node is deleted. Default 0, never
 }
 
 // RouterOpts is used for Neutron routes
@@ -157,6 +176,9 @@ type OpenStack struct {
 	routeOpts             RouterOpts
 	metadataOpts          metadata.Opts
 	networkingOpts        NetworkingOpts
+	instancesOpts         InstancesOpts
+	existenceCache        *instanceExistenceCache
+	serverCache           *serverCache
 	kclient               kubernetes.Interface
 	nodeInformer          coreinformers.NodeInformer
 	nodeInformerHasSynced func() bool
@@ -173,6 +195,7 @@ type Config struct {
 	Route             RouterOpts
 	Metadata          metadata.Opts
 	Networking        NetworkingOpts
+	Instances         InstancesOpts
 }
 
 func init() {
@@ -199,6 +222,22 @@ func (os *OpenStack) Initialize(clientBuilder cloudprovider.ControllerClientBuil
 	os.eventBroadcaster = record.NewBroadcaster()
 	os.eventBroadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: os.kclient.CoreV1().Events("")})
 	os.eventRecorder = os.eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "cloud-provider-openstack"})
+
+	if os.instancesOpts.ZoneRelabelPeriod.Duration > 0 {
+		go os.runZoneRelabeler(stop)
+	}
+
+	if os.serverCache != nil {
+		go os.prefetchServers(stop)
+	}
+
+	if os.instancesOpts.ErrorStateTaint {
+		go os.runErrorStateReconciler(stop)
+	}
+
+	if metadataProxyBindAddress != "" {
+		go os.runMetadataProxy(stop)
+	}
 }
 
 // ReadConfig reads values from the cloud.conf
@@ -302,6 +341,12 @@ func NewOpenStack(cfg Config) (*OpenStack, error) {
 		routeOpts:      cfg.Route,
 		metadataOpts:   cfg.Metadata,
 		networkingOpts: cfg.Networking,
+		instancesOpts:  cfg.Instances,
+		existenceCache: newInstanceExistenceCache(cfg.Instances),
+	}
+
+	if cfg.Instances.ServerCacheTTL.Duration > 0 {
+		os.serverCache = newServerCache(cfg.Instances.ServerCacheTTL.Duration)
 	}
 
 	// ini file doesn't support maps so we are reusing top level sub sections
@@ -430,4 +475,21 @@ func (os *OpenStack) SetInformers(informerFactory informers.SharedInformerFactor
 	klog.V(1).Infof("Setting up informers for Cloud")
 	os.nodeInformer = informerFactory.Core().V1().Nodes()
 	os.nodeInformerHasSynced = os.nodeInformer.Informer().HasSynced
+
+	if os.existenceCache != nil {
+		// the instances of the deleted nodes are no longer checked
+		_, err := os.nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			DeleteFunc: func(obj interface{}) {
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				if node, ok := obj.(*v1.Node); ok {
+					os.existenceCache.forget(node.Name)
+				}
+			},
+		})
+		if err != nil {
+			klog.Errorf("Failed to watch the deleted nodes: %v", err)
+		}
+	}
 }
@@ -734,6 +734,95 @@ func TestNodeAddressesOneInternalNetwork(t *testing.T) {
 	}
 }
 
+func TestNodeAddressesSecondaryAddressNetwork(t *testing.T) {
+	srv := servers.Server{
+		Status: "ACTIVE",
+		HostID: "29d3c8c896a45aa4c34e52247875d7fefc3d94bbcc9f622b5d204362",
+		Addresses: map[string]interface{}{
+			"private": []interface{}{
+				map[string]interface{}{
+					"version":         float64(4),
+					"addr":            "10.0.0.32",
+					"OS-EXT-IPS:type": "fixed",
+				},
+				map[string]interface{}{
+					"version":         float64(4),
+					"addr":            "10.0.0.31",
+					"OS-EXT-IPS:type": "fixed",
+				},
+				map[string]interface{}{
+					"version":         float64(4),
+					"addr":            "50.56.176.36",
+					"OS-EXT-IPS:type": "floating",
+				},
+			},
+			"storage": []interface{}{
+				map[string]interface{}{
+					"version":         float64(4),
+					"addr":            "10.1.0.5",
+					"OS-EXT-IPS:type": "fixed",
+				},
+				map[string]interface{}{
+					"version":         float64(4),
+					"addr":            "10.1.0.6",
+					"OS-EXT-IPS:type": "fixed",
+				},
+			},
+		},
+	}
+
+	networkingOpts := NetworkingOpts{
+		SecondaryAddressNetworkName: []string{"storage"},
+	}
+
+	ports := []PortWithTrunkDetails{
+		{
+			Port: neutronports.Port{
+				Status: "ACTIVE",
+				FixedIPs: []neutronports.IP{
+					{
+						IPAddress: "10.0.0.32",
+					},
+					{
+						IPAddress: "10.0.0.31",
+					},
+				},
+			},
+		},
+		{
+			Port: neutronports.Port{
+				Status: "ACTIVE",
+				FixedIPs: []neutronports.IP{
+					{
+						IPAddress: "10.1.0.5",
+					},
+					{
+						IPAddress: "10.1.0.6",
+					},
+				},
+			},
+		},
+	}
+
+	addrs, err := nodeAddresses(context.TODO(), &srv, ports, nil, networkingOpts)
+	if err != nil {
+		t.Fatalf("nodeAddresses returned error: %v", err)
+	}
+
+	t.Logf("addresses are %v", addrs)
+
+	want := []v1.NodeAddress{
+		{Type: v1.NodeInternalIP, Address: "10.0.0.32"},
+		{Type: v1.NodeInternalIP, Address: "10.1.0.5"},
+		{Type: v1.NodeInternalIP, Address: "10.1.0.6"},
+		{Type: v1.NodeExternalIP, Address: "50.56.176.36"},
+	}
+
+	if !reflect.DeepEqual(want, addrs) {
+		t.Errorf("nodeAddresses returned incorrect value, want %v", want)
+	}
+}
+
 func TestNodeAddressesIPv6Disabled(t *testing.T) {
 	srv := servers.Server{
 		Status:     "ACTIVE",
@@ -0,0 +1,104 @@
+//go:build windows
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blockdevice
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// On Windows the devices are disks, specified by their number.
+
+func powershell(command string, env ...string) (string, error) {
+	cmd := exec.Command("powershell", "/c", command)
+	cmd.Env = append(os.Environ(), env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("powershell command %q failed: %v, output: %q", command, err, string(out))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// IsBlockDevice checks whether the path exists. Raw block volumes are not
+// supported on Windows.
+func IsBlockDevice(path string) (bool, error) {
+	if _, err := os.Stat(path); err != nil {
+		return false, fmt.Errorf("failed to stat() %q: %v", path, err)
+	}
+	return false, nil
+}
+
+// GetBlockDeviceSize returns the size of the disk by number
+func GetBlockDeviceSize(diskNumber string) (int64, error) {
+	out, err := powershell("(Get-Disk -Number $env:disk).Size", fmt.Sprintf("disk=%s", diskNumber))
+	if err != nil {
+		return -1, err
+	}
+	return strconv.ParseInt(out, 10, 64)
+}
+
+func checkBlockDeviceSize(diskNumber string, deviceMountPath string, newSize int64) error {
+	klog.V(4).Infof("Detecting %q volume size", deviceMountPath)
+	size, err := GetBlockDeviceSize(diskNumber)
+	if err != nil {
+		return err
+	}
+
+	klog.V(3).Infof("Detected %q volume size: %d", deviceMountPath, size)
+
+	if size < newSize {
+		return fmt.Errorf("current volume size is less than expected one: %d < %d", size, newSize)
+	}
+
+	return nil
+}
+
+func RescanBlockDeviceGeometry(diskNumber string, deviceMountPath string, newSize int64) error {
+	if newSize == 0 {
+		klog.Error("newSize is empty, skipping the block device rescan")
+		return nil
+	}
+
+	// when disk size corresponds expectations, return nil
+	bdSizeErr := checkBlockDeviceSize(diskNumber, deviceMountPath, newSize)
+	if bdSizeErr == nil {
+		return nil
+	}
+
+	if err := RescanDevice(diskNumber); err != nil {
+		klog.Errorf("Error rescanning disk %s: %v", diskNumber, err)
+		// no need to run checkBlockDeviceSize second time here, return the saved error
+		return bdSizeErr
+	}
+
+	return checkBlockDeviceSize(diskNumber, deviceMountPath, newSize)
+}
+
+func RescanDevice(diskNumber string) error {
+	klog.V(4).Infof("Rescanning disk %s", diskNumber)
+	if _, err := powershell("Update-HostStorageCache; Get-Disk -Number $env:disk | Update-Disk", fmt.Sprintf("disk=%s", diskNumber)); err != nil {
+		return fmt.Errorf("error rescanning disk %s: %v", diskNumber, err)
+	}
+	return nil
+}
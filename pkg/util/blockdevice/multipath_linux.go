@@ -0,0 +1,191 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blockdevice
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog/v2"
+	"k8s.io/utils/exec"
+)
+
+// sysBlockPath is the sysfs directory of the block devices
+var sysBlockPath = "/sys/block"
+
+// deviceName returns the kernel name of the device, e.g. sda for
+// /dev/disk/by-id/scsi-XXXX
+func deviceName(devicePath string) (string, error) {
+	p, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(p), nil
+}
+
+// DeviceExists returns true if the kernel device of the given name, e.g. sda,
+// still exists.
+func DeviceExists(name string) bool {
+	_, err := os.Stat(filepath.Join(sysBlockPath, name))
+	return err == nil
+}
+
+// GetMultipathDevice returns the path of the multipath map the device is a
+// path of, or an empty string if the device is not part of a multipath map.
+func GetMultipathDevice(devicePath string) (string, error) {
+	name, err := deviceName(devicePath)
+	if err != nil {
+		return "", err
+	}
+
+	holders, err := os.ReadDir(filepath.Join(sysBlockPath, name, "holders"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	for _, h := range holders {
+		if isMultipathMap(h.Name()) {
+			return filepath.Join("/dev", h.Name()), nil
+		}
+	}
+	return "", nil
+}
+
+// isMultipathMap returns true if the device mapper device of the given kernel
+// name, e.g. dm-0, is a multipath map.
+func isMultipathMap(name string) bool {
+	uuid, err := os.ReadFile(filepath.Join(sysBlockPath, name, "dm", "uuid"))
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(strings.TrimSpace(string(uuid)), "mpath-")
+}
+
+// IsMultipathDevice returns true if the device is a multipath map.
+func IsMultipathDevice(devicePath string) bool {
+	name, err := deviceName(devicePath)
+	if err != nil {
+		return false
+	}
+	return isMultipathMap(name)
+}
+
+// GetMultipathPaths returns the kernel names of the paths of the multipath
+// map, e.g. sda and sdb.
+func GetMultipathPaths(mpathDevice string) ([]string, error) {
+	name, err := deviceName(mpathDevice)
+	if err != nil {
+		return nil, err
+	}
+
+	slaves, err := os.ReadDir(filepath.Join(sysBlockPath, name, "slaves"))
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(slaves))
+	for _, s := range slaves {
+		paths = append(paths, s.Name())
+	}
+	return paths, nil
+}
+
+// CreateMultipathDevice asks multipath to create the map of the device. The
+// map is created asynchronously by multipathd.
+func CreateMultipathDevice(devicePath string) error {
+	klog.V(4).Infof("Creating multipath map of %q", devicePath)
+	out, err := exec.New().Command("multipath", devicePath).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to create multipath map of %s: %v, output: %q", devicePath, err, string(out))
+	}
+	return nil
+}
+
+// multipathMapName returns the name of the multipath map, e.g. mpatha, which
+// is expected by the multipath tools.
+func multipathMapName(mpathDevice string) (string, error) {
+	name, err := deviceName(mpathDevice)
+	if err != nil {
+		return "", err
+	}
+
+	mapName, err := os.ReadFile(filepath.Join(sysBlockPath, name, "dm", "name"))
+	if err != nil {
+		return "", fmt.Errorf("failed to get the name of multipath map %s: %v", mpathDevice, err)
+	}
+	return strings.TrimSpace(string(mapName)), nil
+}
+
+// FlushMultipathDevice flushes and removes the multipath map.
+func FlushMultipathDevice(mpathDevice string) error {
+	mapName, err := multipathMapName(mpathDevice)
+	if err != nil {
+		return err
+	}
+
+	klog.V(4).Infof("Flushing multipath map %q", mapName)
+	out, err := exec.New().Command("multipath", "-f", mapName).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to flush multipath map %s: %v, output: %q", mpathDevice, err, string(out))
+	}
+	return nil
+}
+
+// ResizeMultipathDevice resizes the multipath map to the size of its paths,
+// which must have been rescanned.
+func ResizeMultipathDevice(mpathDevice string) error {
+	mapName, err := multipathMapName(mpathDevice)
+	if err != nil {
+		return err
+	}
+
+	klog.V(4).Infof("Resizing multipath map %q", mapName)
+	out, err := exec.New().Command("multipathd", "resize", "map", mapName).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to resize multipath map %s: %v, output: %q", mpathDevice, err, string(out))
+	}
+	return nil
+}
+
+// RemoveSCSIDevice flushes the buffers of the SCSI device of the given kernel
+// name, e.g. sda, and removes it from the SCSI subsystem. Devices which are not
+// SCSI devices, e.g. virtio-blk disks, are ignored and false is returned.
+func RemoveSCSIDevice(name string) (bool, error) {
+	deletePath := filepath.Join(sysBlockPath, name, "device", "delete")
+	if _, err := os.Stat(deletePath); err != nil {
+		if os.IsNotExist(err) {
+			klog.V(4).Infof("Device %q is not a SCSI device, skipping its removal", name)
+			return false, nil
+		}
+		return false, err
+	}
+
+	if out, err := exec.New().Command("blockdev", "--flushbufs", filepath.Join("/dev", name)).CombinedOutput(); err != nil {
+		klog.Warningf("Failed to flush the buffers of device %q: %v, output: %q", name, err, string(out))
+	}
+
+	klog.V(4).Infof("Removing SCSI device %q", name)
+	if err := os.WriteFile(deletePath, []byte{'1'}, 0200); err != nil {
+		return false, fmt.Errorf("failed to remove SCSI device %s: %v", name, err)
+	}
+	return true, nil
+}
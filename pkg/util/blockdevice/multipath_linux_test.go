@@ -0,0 +1,66 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blockdevice
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetMultipathDevice(t *testing.T) {
+	dir := t.TempDir()
+	sysBlockPath = filepath.Join(dir, "sys")
+	defer func() { sysBlockPath = "/sys/block" }()
+
+	devDir := filepath.Join(dir, "dev")
+	assert.NoError(t, os.MkdirAll(devDir, 0755))
+	for _, dev := range []string{"sda", "sdb", "sdc", "dm-0", "dm-1"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(devDir, dev), nil, 0644))
+		assert.NoError(t, os.MkdirAll(filepath.Join(sysBlockPath, dev), 0755))
+	}
+	// sda and sdb are the paths of the multipath map dm-0, sdc holds the LVM volume dm-1
+	for dm, slaves := range map[string][]string{"dm-0": {"sda", "sdb"}, "dm-1": {"sdc"}} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(sysBlockPath, dm, "dm"), 0755))
+		uuid := "LVM-xxxx"
+		if dm == "dm-0" {
+			uuid = "mpath-3600a0980383030523424457a4a695266"
+		}
+		assert.NoError(t, os.WriteFile(filepath.Join(sysBlockPath, dm, "dm", "uuid"), []byte(uuid+"\n"), 0644))
+		for _, s := range slaves {
+			assert.NoError(t, os.MkdirAll(filepath.Join(sysBlockPath, dm, "slaves", s), 0755))
+			assert.NoError(t, os.MkdirAll(filepath.Join(sysBlockPath, s, "holders", dm), 0755))
+		}
+	}
+
+	mpath, err := GetMultipathDevice(filepath.Join(devDir, "sdb"))
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/dm-0", mpath)
+
+	mpath, err = GetMultipathDevice(filepath.Join(devDir, "sdc"))
+	assert.NoError(t, err)
+	assert.Empty(t, mpath, "LVM volumes are not multipath maps")
+
+	assert.True(t, IsMultipathDevice(filepath.Join(devDir, "dm-0")))
+	assert.False(t, IsMultipathDevice(filepath.Join(devDir, "dm-1")))
+
+	paths, err := GetMultipathPaths(filepath.Join(devDir, "dm-0"))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"sda", "sdb"}, paths)
+}
@@ -0,0 +1,55 @@
+//go:build !linux
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blockdevice
+
+import (
+	"errors"
+)
+
+func DeviceExists(name string) bool {
+	return false
+}
+
+func GetMultipathDevice(devicePath string) (string, error) {
+	return "", errors.New("GetMultipathDevice is not implemented for this OS")
+}
+
+func IsMultipathDevice(devicePath string) bool {
+	return false
+}
+
+func GetMultipathPaths(mpathDevice string) ([]string, error) {
+	return nil, errors.New("GetMultipathPaths is not implemented for this OS")
+}
+
+func CreateMultipathDevice(devicePath string) error {
+	return errors.New("CreateMultipathDevice is not implemented for this OS")
+}
+
+func FlushMultipathDevice(mpathDevice string) error {
+	return errors.New("FlushMultipathDevice is not implemented for this OS")
+}
+
+func ResizeMultipathDevice(mpathDevice string) error {
+	return errors.New("ResizeMultipathDevice is not implemented for this OS")
+}
+
+func RemoveSCSIDevice(name string) (bool, error) {
+	return false, errors.New("RemoveSCSIDevice is not implemented for this OS")
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blockdevice
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"k8s.io/klog/v2"
+	"k8s.io/utils/exec"
+)
+
+// sysNVMePath is the sysfs directory of the NVMe controllers
+var sysNVMePath = "/sys/class/nvme"
+
+// nvmeNamespaceRe matches the kernel names of the NVMe namespaces, e.g.
+// nvme0n1. The paths of the namespaces of a multipath subsystem, e.g.
+// nvme0c1n1, are hidden and not matched.
+var nvmeNamespaceRe = regexp.MustCompile(`^nvme\d+n\d+$`)
+
+// ConnectNVMeoF connects the node with the given host NQN to the portals of the
+// NVMe-oF subsystem of the given NQN. The portals which are already connected
+// are skipped, and an error is returned only if no portal is connected.
+func ConnectNVMeoF(hostNQN, targetNQN string, portals []NVMeoFPortal) error {
+	connected := nvmeConnectedPortals(targetNQN)
+
+	var errs []string
+	ok := false
+	for _, p := range portals {
+		if connected[p.Address+":"+p.Port] {
+			klog.V(4).Infof("NVMe-oF subsystem %q is already connected through %s", targetNQN, p)
+			ok = true
+			continue
+		}
+
+		klog.V(4).Infof("Connecting to NVMe-oF subsystem %q through %s", targetNQN, p)
+		out, err := exec.New().Command("nvme", "connect",
+			"--transport", p.Transport,
+			"--traddr", p.Address,
+			"--trsvcid", p.Port,
+			"--nqn", targetNQN,
+			"--hostnqn", hostNQN).CombinedOutput()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v, output: %q", p, err, string(out)))
+			continue
+		}
+		ok = true
+	}
+
+	if !ok {
+		return fmt.Errorf("failed to connect to NVMe-oF subsystem %s: %s", targetNQN, strings.Join(errs, "; "))
+	}
+	if len(errs) > 0 {
+		klog.Warningf("Failed to connect to some portals of NVMe-oF subsystem %q: %s", targetNQN, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// nvmeConnectedPortals returns the "address:port" of the portals the node is
+// connected to the subsystem through.
+func nvmeConnectedPortals(targetNQN string) map[string]bool {
+	portals := make(map[string]bool)
+
+	controllers, err := os.ReadDir(sysNVMePath)
+	if err != nil {
+		return portals
+	}
+	for _, c := range controllers {
+		if readSysfsAttr(filepath.Join(sysNVMePath, c.Name(), "subsysnqn")) != targetNQN {
+			continue
+		}
+		// e.g. traddr=10.0.0.1,trsvcid=4420,src_addr=10.0.0.2
+		var addr, port string
+		for _, kv := range strings.Split(readSysfsAttr(filepath.Join(sysNVMePath, c.Name(), "address")), ",") {
+			k, v, _ := strings.Cut(kv, "=")
+			switch k {
+			case "traddr":
+				addr = v
+			case "trsvcid":
+				port = v
+			}
+		}
+		portals[addr+":"+port] = true
+	}
+	return portals
+}
+
+// isNVMeoFSubsystem returns true if the node is connected to the NVMe subsystem
+// over fabrics, i.e. not over PCIe.
+func isNVMeoFSubsystem(targetNQN string) bool {
+	controllers, err := os.ReadDir(sysNVMePath)
+	if err != nil {
+		return false
+	}
+	for _, c := range controllers {
+		if readSysfsAttr(filepath.Join(sysNVMePath, c.Name(), "subsysnqn")) != targetNQN {
+			continue
+		}
+		switch readSysfsAttr(filepath.Join(sysNVMePath, c.Name(), "transport")) {
+		case "tcp", "rdma", "fc":
+			return true
+		}
+	}
+	return false
+}
+
+// FindNVMeNamespace returns the device path of the NVMe namespace of the given
+// UUID, or an empty string if it is not found.
+func FindNVMeNamespace(uuid string) (string, error) {
+	devices, err := os.ReadDir(sysBlockPath)
+	if err != nil {
+		return "", err
+	}
+
+	uuid = strings.ToLower(uuid)
+	for _, d := range devices {
+		if !nvmeNamespaceRe.MatchString(d.Name()) {
+			continue
+		}
+		nsUUID := readSysfsAttr(filepath.Join(sysBlockPath, d.Name(), "uuid"))
+		if nsUUID == "" {
+			// e.g. uuid.8ae6ff6e-4ec1-4bbd-a16e-257b3cfbcbcf
+			nsUUID = strings.TrimPrefix(readSysfsAttr(filepath.Join(sysBlockPath, d.Name(), "wwid")), "uuid.")
+		}
+		if strings.ToLower(nsUUID) == uuid {
+			return filepath.Join("/dev", d.Name()), nil
+		}
+	}
+	return "", nil
+}
+
+// DisconnectNVMeNamespace disconnects the node from the NVMe-oF subsystem of
+// the NVMe namespace of the given device path, unless other namespaces of the
+// subsystem are still connected.
+func DisconnectNVMeNamespace(devicePath string) error {
+	name, err := deviceName(devicePath)
+	if err != nil {
+		return err
+	}
+
+	targetNQN := readSysfsAttr(filepath.Join(sysBlockPath, name, "device", "subsysnqn"))
+	if targetNQN == "" {
+		return fmt.Errorf("failed to get the NVMe-oF subsystem of device %s", devicePath)
+	}
+	if !isNVMeoFSubsystem(targetNQN) {
+		klog.V(4).Infof("NVMe subsystem %q of device %s is not an NVMe-oF subsystem, skipping its disconnection", targetNQN, devicePath)
+		return nil
+	}
+
+	devices, err := os.ReadDir(sysBlockPath)
+	if err != nil {
+		return err
+	}
+	for _, d := range devices {
+		if d.Name() == name || !nvmeNamespaceRe.MatchString(d.Name()) {
+			continue
+		}
+		if readSysfsAttr(filepath.Join(sysBlockPath, d.Name(), "device", "subsysnqn")) == targetNQN {
+			klog.V(4).Infof("NVMe-oF subsystem %q has other namespaces, skipping its disconnection", targetNQN)
+			return nil
+		}
+	}
+
+	klog.V(4).Infof("Disconnecting from NVMe-oF subsystem %q", targetNQN)
+	out, err := exec.New().Command("nvme", "disconnect", "--nqn", targetNQN).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to disconnect from NVMe-oF subsystem %s: %v, output: %q", targetNQN, err, string(out))
+	}
+	return nil
+}
+
+func readSysfsAttr(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blockdevice
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindNVMeNamespace(t *testing.T) {
+	dir := t.TempDir()
+	sysBlockPath = filepath.Join(dir, "block")
+	sysNVMePath = filepath.Join(dir, "nvme")
+	defer func() {
+		sysBlockPath = "/sys/block"
+		sysNVMePath = "/sys/class/nvme"
+	}()
+
+	write := func(path, value string) {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(value+"\n"), 0644))
+	}
+	// nvme0 is a local PCIe drive, nvme1 is connected over TCP
+	write(filepath.Join(sysNVMePath, "nvme0", "subsysnqn"), "nqn.2014.08.org.nvmexpress:local")
+	write(filepath.Join(sysNVMePath, "nvme0", "transport"), "pcie")
+	write(filepath.Join(sysNVMePath, "nvme1", "subsysnqn"), "nqn.2014-08.org.cinder:volume")
+	write(filepath.Join(sysNVMePath, "nvme1", "transport"), "tcp")
+	write(filepath.Join(sysNVMePath, "nvme1", "address"), "traddr=10.0.0.1,trsvcid=4420,src_addr=10.0.0.2")
+
+	write(filepath.Join(sysBlockPath, "nvme0n1", "device", "subsysnqn"), "nqn.2014.08.org.nvmexpress:local")
+	write(filepath.Join(sysBlockPath, "nvme0n1", "wwid"), "eui.0025388b91b4d1a2")
+	write(filepath.Join(sysBlockPath, "nvme1n1", "device", "subsysnqn"), "nqn.2014-08.org.cinder:volume")
+	write(filepath.Join(sysBlockPath, "nvme1n1", "uuid"), "8AE6FF6E-4EC1-4BBD-A16E-257B3CFBCBCF")
+	write(filepath.Join(sysBlockPath, "nvme1n2", "device", "subsysnqn"), "nqn.2014-08.org.cinder:volume")
+	write(filepath.Join(sysBlockPath, "nvme1n2", "wwid"), "uuid.1d8b2a40-3a32-4c57-9b0f-3b3f68c0d0aa")
+	// hidden path of a multipath namespace
+	write(filepath.Join(sysBlockPath, "nvme1c1n1", "uuid"), "8ae6ff6e-4ec1-4bbd-a16e-257b3cfbcbcf")
+
+	dev, err := FindNVMeNamespace("8ae6ff6e-4ec1-4bbd-a16e-257b3cfbcbcf")
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/nvme1n1", dev)
+
+	dev, err = FindNVMeNamespace("1d8b2a40-3a32-4c57-9b0f-3b3f68c0d0aa")
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/nvme1n2", dev)
+
+	dev, err = FindNVMeNamespace("00000000-0000-0000-0000-000000000000")
+	assert.NoError(t, err)
+	assert.Empty(t, dev)
+
+	assert.True(t, isNVMeoFSubsystem("nqn.2014-08.org.cinder:volume"))
+	assert.False(t, isNVMeoFSubsystem("nqn.2014.08.org.nvmexpress:local"))
+	assert.Equal(t, map[string]bool{"10.0.0.1:4420": true}, nvmeConnectedPortals("nqn.2014-08.org.cinder:volume"))
+
+	devDir := filepath.Join(dir, "dev")
+	for _, dev := range []string{"nvme0n1", "nvme1n1"} {
+		write(filepath.Join(devDir, dev), "")
+	}
+	// the subsystem of a local drive is never disconnected
+	assert.NoError(t, DisconnectNVMeNamespace(filepath.Join(devDir, "nvme0n1")))
+	// nor the subsystem of a namespace still in use by another volume
+	assert.NoError(t, DisconnectNVMeNamespace(filepath.Join(devDir, "nvme1n1")))
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blockdevice
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog/v2"
+	"k8s.io/utils/exec"
+)
+
+// sysRBDPath is the sysfs directory of the mapped RBD images
+var sysRBDPath = "/sys/bus/rbd/devices"
+
+// MapRBD maps the RBD image of the given pool with the krbd kernel module, and
+// returns its device path. The Ceph user authenticates with the keyring of the
+// Ceph configuration of the node. An image which is already mapped is not
+// mapped again.
+func MapRBD(pool, image, user string, monitors []string) (string, error) {
+	devicePath, err := FindRBDDevice(pool, image)
+	if err != nil {
+		return "", err
+	}
+	if devicePath != "" {
+		klog.V(4).Infof("RBD image %s/%s is already mapped to %s", pool, image, devicePath)
+		return devicePath, nil
+	}
+
+	args := []string{"device", "map", pool + "/" + image}
+	if user != "" {
+		args = append(args, "--id", user)
+	}
+	if len(monitors) > 0 {
+		args = append(args, "--mon-host", strings.Join(monitors, ","))
+	}
+
+	klog.V(4).Infof("Mapping RBD image %s/%s", pool, image)
+	out, err := exec.New().Command("rbd", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to map RBD image %s/%s: %v, output: %q", pool, image, err, string(out))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// FindRBDDevice returns the device path the RBD image of the given pool is
+// mapped to, or an empty string if it is not mapped. An empty pool matches
+// the images of any pool.
+func FindRBDDevice(pool, image string) (string, error) {
+	devices, err := os.ReadDir(sysRBDPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// the krbd module isn't loaded
+			return "", nil
+		}
+		return "", err
+	}
+
+	for _, d := range devices {
+		if readSysfsAttr(filepath.Join(sysRBDPath, d.Name(), "name")) != image {
+			continue
+		}
+		if pool != "" && readSysfsAttr(filepath.Join(sysRBDPath, d.Name(), "pool")) != pool {
+			continue
+		}
+		return "/dev/rbd" + d.Name(), nil
+	}
+	return "", nil
+}
+
+// UnmapRBD unmaps the RBD device of the given path
+func UnmapRBD(devicePath string) error {
+	klog.V(4).Infof("Unmapping RBD device %s", devicePath)
+	out, err := exec.New().Command("rbd", "device", "unmap", devicePath).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to unmap RBD device %s: %v, output: %q", devicePath, err, string(out))
+	}
+	return nil
+}
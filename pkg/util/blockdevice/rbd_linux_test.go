@@ -0,0 +1,58 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blockdevice
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindRBDDevice(t *testing.T) {
+	dir := t.TempDir()
+	sysRBDPath = filepath.Join(dir, "missing")
+	defer func() { sysRBDPath = "/sys/bus/rbd/devices" }()
+
+	// the krbd module isn't loaded
+	dev, err := FindRBDDevice("volumes", "volume-1")
+	assert.NoError(t, err)
+	assert.Empty(t, dev)
+
+	sysRBDPath = filepath.Join(dir, "rbd")
+	write := func(path, value string) {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(value+"\n"), 0644))
+	}
+	write(filepath.Join(sysRBDPath, "0", "pool"), "images")
+	write(filepath.Join(sysRBDPath, "0", "name"), "volume-1")
+	write(filepath.Join(sysRBDPath, "1", "pool"), "volumes")
+	write(filepath.Join(sysRBDPath, "1", "name"), "volume-1")
+
+	dev, err = FindRBDDevice("volumes", "volume-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/rbd1", dev)
+
+	dev, err = FindRBDDevice("", "volume-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/rbd0", dev)
+
+	dev, err = FindRBDDevice("volumes", "volume-2")
+	assert.NoError(t, err)
+	assert.Empty(t, dev)
+}
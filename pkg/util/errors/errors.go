@@ -17,7 +17,9 @@ limitations under the License.
 package errors
 
 import (
+	"context"
 	"errors"
+	"net"
 	"net/http"
 
 	"github.com/gophercloud/gophercloud/v2"
@@ -45,6 +47,22 @@ var ErrNoRouterID = errors.New("router-id not set in cloud provider config")
 // ErrNoNodeInformer is used when node informer is not yet initialized
 var ErrNoNodeInformer = errors.New("node informer is not yet initialized")
 
+// ErrCrossAZAttach is used when a volume can't be attached to a server of
+// another availability zone
+var ErrCrossAZAttach = errors.New("volume and server are not in the same availability zone")
+
+// ErrMicroversionNotSupported is used when a feature requires an API
+// microversion which is not supported
+var ErrMicroversionNotSupported = errors.New("microversion not supported")
+
+// ErrVolumeErrorState is used when a volume went into an error state, e.g.
+// because its creation failed
+var ErrVolumeErrorState = errors.New("volume is in error state")
+
+// ErrSnapshotNotReady is used when a snapshot is still being created after
+// the time it was waited for
+var ErrSnapshotNotReady = errors.New("snapshot is not ready")
+
 func IsNotFound(err error) bool {
 	if err == ErrNotFound {
 		return true
@@ -64,3 +82,21 @@ func IsInvalidError(err error) bool {
 func IsConflictError(err error) bool {
 	return gophercloud.ResponseCodeIs(err, http.StatusConflict)
 }
+
+// IsServerError returns true if the error is a 5xx response from the API
+func IsServerError(err error) bool {
+	var e gophercloud.ErrUnexpectedResponseCode
+	if errors.As(err, &e) {
+		return e.Actual >= http.StatusInternalServerError
+	}
+	return false
+}
+
+// IsTimeoutError returns true if the request to the API timed out
+func IsTimeoutError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var e net.Error
+	return errors.As(err, &e) && e.Timeout()
+}
@@ -17,19 +17,13 @@ limitations under the License.
 package mount
 
 import (
-	"fmt"
+	"context"
 	"os"
-	"path"
-	"strings"
 	"time"
 
-	"golang.org/x/sys/unix"
 	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/klog/v2"
 	"k8s.io/mount-utils"
 	"k8s.io/utils/exec"
-
-	"k8s.io/cloud-provider-openstack/pkg/util/blockdevice"
 )
 
 const (
@@ -43,7 +37,7 @@ const (
 type IMount interface {
 	Mounter() *mount.SafeFormatAndMount
 	ScanForAttach(devicePath string) error
-	GetDevicePath(volumeID string) (string, error)
+	GetDevicePath(volumeID string, opts DeviceWaitOpts) (string, error)
 	IsLikelyNotMountPointAttach(targetpath string) (bool, error)
 	UnmountPath(mountPath string) error
 	MakeFile(pathname string) error
@@ -52,6 +46,12 @@ type IMount interface {
 	GetMountFs(path string) ([]byte, error)
 }
 
+// Resizer resizes the file system of a volume to the size of its device
+type Resizer interface {
+	NeedResize(devicePath string, deviceMountPath string) (bool, error)
+	Resize(devicePath string, deviceMountPath string) (bool, error)
+}
+
 type DeviceStats struct {
 	Block bool
 
@@ -61,6 +61,29 @@ type DeviceStats struct {
 	AvailableInodes int64
 	TotalInodes     int64
 	UsedInodes      int64
+
+	// ReadOnlyRemount is true if the file system was mounted read-write and
+	// remounted read-only, e.g. by ext4 after I/O errors
+	ReadOnlyRemount bool
+	// DeviceMissing is true if the device of the volume disappeared, e.g.
+	// when the volume was detached without being unmounted
+	DeviceMissing bool
+}
+
+// DeviceWaitOpts configures the wait for the device of an attached volume to
+// appear on the node
+type DeviceWaitOpts struct {
+	// Timeout of the wait, or zero for the default backoff
+	Timeout time.Duration
+	// PollInterval between the scans for the device, probeVolumeDuration if
+	// zero
+	PollInterval time.Duration
+	// UdevSettle waits for udev to process the events of each scan, so that
+	// the links of the device are created before it is looked up again
+	UdevSettle bool
+	// PreferByPath returns the /dev/disk/by-path link of the device when it
+	// has one, instead of its /dev/disk/by-id link
+	PreferByPath bool
 }
 
 type Mount struct {
@@ -80,154 +103,40 @@ func getBaseMounter() *mount.SafeFormatAndMount {
 	}
 }
 
-// GetMountProvider returns instance of Mounter
-func GetMountProvider() IMount {
-	if MInstance == nil {
-		MInstance = &Mount{BaseMounter: getBaseMounter()}
-	}
-	return MInstance
-}
-
-// Mounter returns instance of SafeFormatAndMount
-func (m *Mount) Mounter() *mount.SafeFormatAndMount {
-	return m.BaseMounter
-}
-
-// probeVolume probes volume in compute
-func probeVolume() error {
-	// rescan scsi bus
-	scsiPath := "/sys/class/scsi_host/"
-	if dirs, err := os.ReadDir(scsiPath); err == nil {
-		for _, f := range dirs {
-			name := scsiPath + f.Name() + "/scan"
-			data := []byte("- - -")
-			if err := os.WriteFile(name, data, 0666); err != nil {
-				return fmt.Errorf("unable to scan %s: %w", f.Name(), err)
-			}
+// waitForDevice calls the condition until it is true. With a timeout, it is
+// called every poll interval until the timeout expires, otherwise with an
+// exponential backoff starting at the poll interval.
+func waitForDevice(opts DeviceWaitOpts, condition wait.ConditionFunc) error {
+	interval := opts.PollInterval
+	if opts.Timeout > 0 {
+		if interval <= 0 {
+			interval = probeVolumeDuration
 		}
+		return wait.PollUntilContextTimeout(context.Background(), interval, opts.Timeout, true, condition.WithContext())
 	}
 
-	executor := exec.New()
-	args := []string{"trigger"}
-	cmd := executor.Command("udevadm", args...)
-	_, err := cmd.CombinedOutput()
-	if err != nil {
-		klog.V(3).Infof("error running udevadm trigger %v\n", err)
-		return err
+	if interval <= 0 {
+		interval = operationFinishInitDelay
 	}
-	return nil
-}
-
-// GetDevicePath returns the path of an attached block storage volume, specified by its id.
-func (m *Mount) GetDevicePath(volumeID string) (string, error) {
 	backoff := wait.Backoff{
-		Duration: operationFinishInitDelay,
+		Duration: interval,
 		Factor:   operationFinishFactor,
 		Steps:    operationFinishSteps,
 	}
-
-	var devicePath string
-	err := wait.ExponentialBackoff(backoff, func() (bool, error) {
-		devicePath = m.getDevicePathBySerialID(volumeID)
-		if devicePath != "" {
-			return true, nil
-		}
-		// see issue https://github.com/kubernetes/cloud-provider-openstack/issues/705
-		if err := probeVolume(); err != nil {
-			// log the error, but continue. Might not happen in edge cases
-			klog.V(5).Infof("Unable to probe attached disk: %v", err)
-		}
-		return false, nil
-	})
-
-	if wait.Interrupted(err) {
-		return "", fmt.Errorf("failed to find device for the volumeID: %q within the alloted time", volumeID)
-	} else if devicePath == "" {
-		return "", fmt.Errorf("device path was empty for volumeID: %q", volumeID)
-	}
-	return devicePath, nil
-}
-
-// GetDevicePathBySerialID returns the path of an attached block storage volume, specified by its id.
-func (m *Mount) getDevicePathBySerialID(volumeID string) string {
-	// Build a list of candidate device paths.
-	// Certain Nova drivers will set the disk serial ID, including the Cinder volume id.
-	candidateDeviceNodes := []string{
-		// KVM
-		fmt.Sprintf("virtio-%s", volumeID[:20]),
-		// KVM #852
-		fmt.Sprintf("virtio-%s", volumeID),
-		// KVM virtio-scsi
-		fmt.Sprintf("scsi-0QEMU_QEMU_HARDDISK_%s", volumeID[:20]),
-		// KVM virtio-scsi #852
-		fmt.Sprintf("scsi-0QEMU_QEMU_HARDDISK_%s", volumeID),
-		// ESXi
-		fmt.Sprintf("wwn-0x%s", strings.ReplaceAll(volumeID, "-", "")),
-	}
-
-	files, err := os.ReadDir("/dev/disk/by-id/")
-	if err != nil {
-		klog.V(4).Infof("ReadDir failed with error %v", err)
-	}
-
-	for _, f := range files {
-		for _, c := range candidateDeviceNodes {
-			if c == f.Name() {
-				klog.V(4).Infof("Found disk attached as %q; full devicepath: %s\n",
-					f.Name(), path.Join("/dev/disk/by-id/", f.Name()))
-				return path.Join("/dev/disk/by-id/", f.Name())
-			}
-		}
-	}
-
-	klog.V(4).Infof("Failed to find device for the volumeID: %q by serial ID", volumeID)
-	return ""
-}
-
-// ScanForAttach
-func (m *Mount) ScanForAttach(devicePath string) error {
-	ticker := time.NewTicker(probeVolumeDuration)
-	defer ticker.Stop()
-	timer := time.NewTimer(probeVolumeTimeout)
-	defer timer.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			klog.V(5).Infof("Checking Cinder disk %q is attached.", devicePath)
-			if err := probeVolume(); err != nil {
-				// log the error, but continue. Might not happen in edge cases
-				klog.V(5).Infof("Unable to probe attached disk: %v", err)
-			}
-
-			exists, err := mount.PathExists(devicePath)
-			if exists && err == nil {
-				return nil
-			}
-			klog.V(3).Infof("Could not find attached Cinder disk %s", devicePath)
-		case <-timer.C:
-			return fmt.Errorf("could not find attached Cinder disk %s. Timeout waiting for mount paths to be created", devicePath)
-		}
-	}
+	return wait.ExponentialBackoff(backoff, condition)
 }
 
-// IsLikelyNotMountPointAttach
-func (m *Mount) IsLikelyNotMountPointAttach(targetpath string) (bool, error) {
-	notMnt, err := m.BaseMounter.IsLikelyNotMountPoint(targetpath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			err = os.MkdirAll(targetpath, 0750)
-			if err == nil {
-				notMnt = true
-			}
-		}
+// GetMountProvider returns instance of Mounter
+func GetMountProvider() IMount {
+	if MInstance == nil {
+		MInstance = &Mount{BaseMounter: getBaseMounter()}
 	}
-	return notMnt, err
+	return MInstance
 }
 
-func (m *Mount) GetMountFs(volumePath string) ([]byte, error) {
-	args := []string{"-o", "source", "--first-only", "--noheadings", "--target", volumePath}
-	return m.BaseMounter.Exec.Command("findmnt", args...).CombinedOutput()
+// Mounter returns instance of SafeFormatAndMount
+func (m *Mount) Mounter() *mount.SafeFormatAndMount {
+	return m.BaseMounter
 }
 
 // UnmountPath
@@ -257,41 +166,3 @@ func (m *Mount) MakeFile(pathname string) error {
 	}
 	return nil
 }
-
-func (m *Mount) GetDeviceStats(path string) (*DeviceStats, error) {
-	isBlock, err := blockdevice.IsBlockDevice(path)
-	if err != nil {
-		return nil, err
-	}
-
-	if isBlock {
-		size, err := blockdevice.GetBlockDeviceSize(path)
-		if err != nil {
-			return nil, err
-		}
-
-		return &DeviceStats{
-			Block:      true,
-			TotalBytes: size,
-		}, nil
-	}
-
-	var statfs unix.Statfs_t
-	// See http://man7.org/linux/man-pages/man2/statfs.2.html for details.
-	err = unix.Statfs(path, &statfs)
-	if err != nil {
-		return nil, err
-	}
-
-	return &DeviceStats{
-		Block: false,
-
-		AvailableBytes: int64(statfs.Bavail) * int64(statfs.Bsize),
-		TotalBytes:     int64(statfs.Blocks) * int64(statfs.Bsize),
-		UsedBytes:      (int64(statfs.Blocks) - int64(statfs.Bfree)) * int64(statfs.Bsize),
-
-		AvailableInodes: int64(statfs.Ffree),
-		TotalInodes:     int64(statfs.Files),
-		UsedInodes:      int64(statfs.Files) - int64(statfs.Ffree),
-	}, nil
-}
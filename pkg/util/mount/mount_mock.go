@@ -110,7 +110,7 @@ func (_m *MountMock) ScanForAttach(devicePath string) error {
 }
 
 // GetDevicePath provides a mock function with given fields: volumeID
-func (_m *MountMock) GetDevicePath(volumeID string) (string, error) {
+func (_m *MountMock) GetDevicePath(volumeID string, opts DeviceWaitOpts) (string, error) {
 	ret := _m.Called(volumeID)
 
 	var r0 string
@@ -0,0 +1,325 @@
+//go:build !windows
+
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mount
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"k8s.io/mount-utils"
+	"k8s.io/utils/exec"
+
+	"k8s.io/cloud-provider-openstack/pkg/util/blockdevice"
+)
+
+// DefaultFsType is the file system volumes are formatted with by default
+const DefaultFsType = "ext4"
+
+// NewResizeFs returns the Resizer of the file systems supported by resize2fs,
+// xfs_growfs and btrfs
+func NewResizeFs(exec exec.Interface) Resizer {
+	return mount.NewResizeFs(exec)
+}
+
+// udevSettleTimeout bounds the wait for udev to process the events of a scan
+const udevSettleTimeout = 30 * time.Second
+
+// probeVolume probes volume in compute. With udevSettle, it waits for udev to
+// process the events of the scan.
+func probeVolume(udevSettle bool) error {
+	// rescan scsi bus
+	scsiPath := "/sys/class/scsi_host/"
+	if dirs, err := os.ReadDir(scsiPath); err == nil {
+		for _, f := range dirs {
+			name := scsiPath + f.Name() + "/scan"
+			data := []byte("- - -")
+			if err := os.WriteFile(name, data, 0666); err != nil {
+				return fmt.Errorf("unable to scan %s: %w", f.Name(), err)
+			}
+		}
+	}
+
+	executor := exec.New()
+	args := []string{"trigger"}
+	cmd := executor.Command("udevadm", args...)
+	_, err := cmd.CombinedOutput()
+	if err != nil {
+		klog.V(3).Infof("error running udevadm trigger %v\n", err)
+		return err
+	}
+
+	if udevSettle {
+		args := []string{"settle", fmt.Sprintf("--timeout=%d", int(udevSettleTimeout.Seconds()))}
+		if out, err := executor.Command("udevadm", args...).CombinedOutput(); err != nil {
+			klog.V(3).Infof("error running udevadm settle %v: %s", err, string(out))
+			return err
+		}
+	}
+	return nil
+}
+
+// GetDevicePath returns the path of an attached block storage volume, specified by its id.
+// The device is waited for until the timeout expires, or with the default backoff if it is zero.
+func (m *Mount) GetDevicePath(volumeID string, opts DeviceWaitOpts) (string, error) {
+	var devicePath string
+	err := waitForDevice(opts, func() (bool, error) {
+		devicePath = m.getDevicePathBySerialID(volumeID)
+		if devicePath != "" {
+			return true, nil
+		}
+		// see issue https://github.com/kubernetes/cloud-provider-openstack/issues/705
+		if err := probeVolume(opts.UdevSettle); err != nil {
+			// log the error, but continue. Might not happen in edge cases
+			klog.V(5).Infof("Unable to probe attached disk: %v", err)
+		}
+		return false, nil
+	})
+
+	if wait.Interrupted(err) {
+		return "", fmt.Errorf("failed to find device for the volumeID: %q within the alloted time", volumeID)
+	} else if devicePath == "" {
+		return "", fmt.Errorf("device path was empty for volumeID: %q", volumeID)
+	}
+
+	if opts.PreferByPath {
+		if byPath := findByPathLink(devicePath); byPath != "" {
+			klog.V(4).Infof("Using the by-path link %s of device %s", byPath, devicePath)
+			return byPath, nil
+		}
+		klog.V(4).Infof("Device %s has no by-path link, using it", devicePath)
+	}
+	return devicePath, nil
+}
+
+// byPathDir holds the links of the devices by their bus path
+var byPathDir = "/dev/disk/by-path"
+
+// findByPathLink returns the /dev/disk/by-path link of the device, or an empty
+// string if there is none. The links of the partitions are skipped.
+func findByPathLink(devicePath string) string {
+	target, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		return ""
+	}
+	links, err := filepath.Glob(filepath.Join(byPathDir, "*"))
+	if err != nil {
+		return ""
+	}
+	// the links are sorted, so that the same link is returned every time
+	for _, link := range links {
+		if strings.Contains(filepath.Base(link), "-part") {
+			continue
+		}
+		if resolved, err := filepath.EvalSymlinks(link); err == nil && resolved == target {
+			return link
+		}
+	}
+	return ""
+}
+
+// GetDevicePathBySerialID returns the path of an attached block storage volume, specified by its id.
+func (m *Mount) getDevicePathBySerialID(volumeID string) string {
+	// Build a list of candidate device paths.
+	// Certain Nova drivers will set the disk serial ID, including the Cinder volume id.
+	candidateDeviceNodes := []string{
+		// KVM
+		fmt.Sprintf("virtio-%s", volumeID[:20]),
+		// KVM #852
+		fmt.Sprintf("virtio-%s", volumeID),
+		// KVM virtio-scsi
+		fmt.Sprintf("scsi-0QEMU_QEMU_HARDDISK_%s", volumeID[:20]),
+		// KVM virtio-scsi #852
+		fmt.Sprintf("scsi-0QEMU_QEMU_HARDDISK_%s", volumeID),
+		// ESXi
+		fmt.Sprintf("wwn-0x%s", strings.ReplaceAll(volumeID, "-", "")),
+	}
+
+	files, err := os.ReadDir("/dev/disk/by-id/")
+	if err != nil {
+		klog.V(4).Infof("ReadDir failed with error %v", err)
+	}
+
+	for _, f := range files {
+		for _, c := range candidateDeviceNodes {
+			if c == f.Name() {
+				klog.V(4).Infof("Found disk attached as %q; full devicepath: %s\n",
+					f.Name(), path.Join("/dev/disk/by-id/", f.Name()))
+				return path.Join("/dev/disk/by-id/", f.Name())
+			}
+		}
+	}
+
+	klog.V(4).Infof("Failed to find device for the volumeID: %q by serial ID", volumeID)
+	return ""
+}
+
+// ScanForAttach
+func (m *Mount) ScanForAttach(devicePath string) error {
+	ticker := time.NewTicker(probeVolumeDuration)
+	defer ticker.Stop()
+	timer := time.NewTimer(probeVolumeTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			klog.V(5).Infof("Checking Cinder disk %q is attached.", devicePath)
+			if err := probeVolume(false); err != nil {
+				// log the error, but continue. Might not happen in edge cases
+				klog.V(5).Infof("Unable to probe attached disk: %v", err)
+			}
+
+			exists, err := mount.PathExists(devicePath)
+			if exists && err == nil {
+				return nil
+			}
+			klog.V(3).Infof("Could not find attached Cinder disk %s", devicePath)
+		case <-timer.C:
+			return fmt.Errorf("could not find attached Cinder disk %s. Timeout waiting for mount paths to be created", devicePath)
+		}
+	}
+}
+
+// IsLikelyNotMountPointAttach
+func (m *Mount) IsLikelyNotMountPointAttach(targetpath string) (bool, error) {
+	notMnt, err := m.BaseMounter.IsLikelyNotMountPoint(targetpath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = os.MkdirAll(targetpath, 0750)
+			if err == nil {
+				notMnt = true
+			}
+		}
+	}
+	return notMnt, err
+}
+
+func (m *Mount) GetMountFs(volumePath string) ([]byte, error) {
+	args := []string{"-o", "source", "--first-only", "--noheadings", "--target", volumePath}
+	return m.BaseMounter.Exec.Command("findmnt", args...).CombinedOutput()
+}
+
+func (m *Mount) GetDeviceStats(path string) (*DeviceStats, error) {
+	isBlock, err := blockdevice.IsBlockDevice(path)
+	if err != nil {
+		return nil, err
+	}
+
+	mi, err := findMountInfo(procMountInfoPath, path)
+	if err != nil {
+		klog.V(4).Infof("Failed to find the mount of %s: %v", path, err)
+	}
+	readOnlyRemount, deviceMissing := mountCondition(mi)
+	if deviceMissing {
+		return &DeviceStats{
+			Block:         isBlock,
+			DeviceMissing: true,
+		}, nil
+	}
+
+	if isBlock {
+		size, err := blockdevice.GetBlockDeviceSize(path)
+		if err != nil {
+			return nil, err
+		}
+
+		return &DeviceStats{
+			Block:      true,
+			TotalBytes: size,
+		}, nil
+	}
+
+	var statfs unix.Statfs_t
+	// See http://man7.org/linux/man-pages/man2/statfs.2.html for details.
+	err = unix.Statfs(path, &statfs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeviceStats{
+		Block: false,
+
+		AvailableBytes: int64(statfs.Bavail) * int64(statfs.Bsize),
+		TotalBytes:     int64(statfs.Blocks) * int64(statfs.Bsize),
+		UsedBytes:      (int64(statfs.Blocks) - int64(statfs.Bfree)) * int64(statfs.Bsize),
+
+		AvailableInodes: int64(statfs.Ffree),
+		TotalInodes:     int64(statfs.Files),
+		UsedInodes:      int64(statfs.Files) - int64(statfs.Ffree),
+
+		ReadOnlyRemount: readOnlyRemount,
+	}, nil
+}
+
+// procMountInfoPath is the mount table of the mount namespace of the plugin
+var procMountInfoPath = "/proc/self/mountinfo"
+
+// findMountInfo returns the last mount of the path in the mount table, i.e.
+// the visible one, or nil if the path is not a mount point.
+func findMountInfo(mountInfoPath, path string) (*mount.MountInfo, error) {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, err
+	}
+
+	infos, err := mount.ParseMountInfo(mountInfoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var found *mount.MountInfo
+	for i := range infos {
+		if infos[i].MountPoint == target {
+			found = &infos[i]
+		}
+	}
+	return found, nil
+}
+
+// mountCondition returns whether the file system of the mount was remounted
+// read-only, and whether the device of the mount disappeared. The volumes
+// published read-only are mounted with the ro mount option, while the
+// remounts only change the options of the file system.
+func mountCondition(mi *mount.MountInfo) (readOnlyRemount bool, deviceMissing bool) {
+	if mi == nil {
+		return false, false
+	}
+
+	readOnlyRemount = slices.Contains(mi.MountOptions, "rw") && slices.Contains(mi.SuperOptions, "ro")
+
+	// the raw block volumes are bind mounts of the device nodes
+	device := mi.Source
+	if mi.FsType == "devtmpfs" {
+		device = filepath.Join("/dev", mi.Root)
+	}
+	if strings.HasPrefix(device, "/dev/") {
+		if _, err := os.Stat(device); os.IsNotExist(err) {
+			deviceMissing = true
+		}
+	}
+	return readOnlyRemount, deviceMissing
+}
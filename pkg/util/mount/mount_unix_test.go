@@ -0,0 +1,58 @@
+//go:build !windows
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mount
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindByPathLink(t *testing.T) {
+	dir := t.TempDir()
+	byID, byPath := filepath.Join(dir, "by-id"), filepath.Join(dir, "by-path")
+	for _, d := range []string{byID, byPath} {
+		assert.NoError(t, os.Mkdir(d, 0755))
+	}
+	for _, dev := range []string{"vdb", "vdb1", "vdc"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, dev), nil, 0644))
+	}
+	links := map[string]string{
+		filepath.Join(byID, "virtio-vdb"):                         "vdb",
+		filepath.Join(byID, "virtio-vdd"):                         "vdd",
+		filepath.Join(byPath, "pci-0000:00:06.0-part1"):           "vdb1",
+		filepath.Join(byPath, "pci-0000:00:06.0"):                 "vdb",
+		filepath.Join(byPath, "virtio-pci-0000:00:06.0"):          "vdb",
+		filepath.Join(byPath, "pci-0000:00:07.0"):                 "vdc",
+		filepath.Join(byPath, "virtio-pci-0000:00:07.0-dangling"): "missing",
+	}
+	for link, dev := range links {
+		assert.NoError(t, os.Symlink(filepath.Join(dir, dev), link))
+	}
+
+	saved := byPathDir
+	byPathDir = byPath
+	defer func() { byPathDir = saved }()
+
+	assert.Equal(t, filepath.Join(byPath, "pci-0000:00:06.0"), findByPathLink(filepath.Join(byID, "virtio-vdb")))
+	assert.Equal(t, filepath.Join(byPath, "pci-0000:00:07.0"), findByPathLink(filepath.Join(dir, "vdc")))
+	assert.Empty(t, findByPathLink(filepath.Join(byID, "virtio-vdd")))
+}
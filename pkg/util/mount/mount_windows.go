@@ -0,0 +1,228 @@
+//go:build windows
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mount
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/exec"
+)
+
+// DefaultFsType is the file system volumes are formatted with by default
+const DefaultFsType = "NTFS"
+
+// The disks are managed with the PowerShell Storage module, which requires the
+// node plugin to run as a HostProcess container. CSI Proxy is not supported
+// yet. The device path of a volume is the number of its disk, as expected by
+// SafeFormatAndMount on Windows.
+
+// powershell runs the PowerShell command with the given environment variables
+// and returns its trimmed output.
+func powershell(e exec.Interface, command string, env ...string) (string, error) {
+	cmd := e.Command("powershell", "/c", command)
+	cmd.SetEnv(append(os.Environ(), env...))
+	klog.V(8).Infof("Executing command: %q", command)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("powershell command %q failed: %v, output: %q", command, err, string(out))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// rescanDisks updates the cache of the disks of the node
+func rescanDisks() error {
+	_, err := powershell(exec.New(), "Update-HostStorageCache")
+	return err
+}
+
+// GetDevicePath returns the number of the disk of an attached block storage volume, specified by its id.
+// The disk is waited for until the timeout expires, or with the default backoff if it is zero.
+func (m *Mount) GetDevicePath(volumeID string, opts DeviceWaitOpts) (string, error) {
+	var diskNumber string
+	err := waitForDevice(opts, func() (bool, error) {
+		var err error
+		diskNumber, err = m.getDiskNumberBySerialID(volumeID)
+		if err != nil {
+			klog.V(4).Infof("Failed to find disk of volume %q: %v", volumeID, err)
+		}
+		if diskNumber != "" {
+			return true, nil
+		}
+		if err := rescanDisks(); err != nil {
+			// log the error, but continue. Might not happen in edge cases
+			klog.V(5).Infof("Unable to rescan disks: %v", err)
+		}
+		return false, nil
+	})
+
+	if wait.Interrupted(err) {
+		return "", fmt.Errorf("failed to find disk for the volumeID: %q within the alloted time", volumeID)
+	} else if diskNumber == "" {
+		return "", fmt.Errorf("disk number was empty for volumeID: %q", volumeID)
+	}
+	return diskNumber, nil
+}
+
+// getDiskNumberBySerialID returns the number of the disk whose serial number
+// is the Cinder volume ID. Nova truncates the serial number of virtio-blk
+// disks to 20 characters.
+func (m *Mount) getDiskNumberBySerialID(volumeID string) (string, error) {
+	serials := []string{volumeID}
+	if len(volumeID) > 20 {
+		serials = append(serials, volumeID[:20])
+	}
+
+	out, err := powershell(m.BaseMounter.Exec,
+		`(Get-Disk | Where-Object { $_.SerialNumber -and ($env:serials -split ',') -contains $_.SerialNumber.Trim() }).Number`,
+		fmt.Sprintf("serials=%s", strings.Join(serials, ",")))
+	if err != nil || out == "" {
+		return "", err
+	}
+
+	numbers := strings.Fields(out)
+	if len(numbers) > 1 {
+		return "", fmt.Errorf("found %d disks for the volumeID: %q", len(numbers), volumeID)
+	}
+	klog.V(4).Infof("Found disk %s attached for the volumeID: %q", numbers[0], volumeID)
+	return numbers[0], nil
+}
+
+// ScanForAttach
+func (m *Mount) ScanForAttach(diskNumber string) error {
+	if _, err := strconv.Atoi(diskNumber); err != nil {
+		return fmt.Errorf("invalid disk number %q: %v", diskNumber, err)
+	}
+
+	ticker := time.NewTicker(probeVolumeDuration)
+	defer ticker.Stop()
+	timer := time.NewTimer(probeVolumeTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			klog.V(5).Infof("Checking Cinder disk %q is attached.", diskNumber)
+			if err := rescanDisks(); err != nil {
+				// log the error, but continue. Might not happen in edge cases
+				klog.V(5).Infof("Unable to rescan disks: %v", err)
+			}
+
+			_, err := powershell(m.BaseMounter.Exec, "Get-Disk -Number $env:disk", fmt.Sprintf("disk=%s", diskNumber))
+			if err == nil {
+				return nil
+			}
+			klog.V(3).Infof("Could not find attached Cinder disk %s", diskNumber)
+		case <-timer.C:
+			return fmt.Errorf("could not find attached Cinder disk %s. Timeout waiting for disk to be attached", diskNumber)
+		}
+	}
+}
+
+// IsLikelyNotMountPointAttach returns true if the target path is not a link
+// to a volume. The volumes are mounted by linking their target paths to them,
+// so an empty directory at the target path is removed.
+func (m *Mount) IsLikelyNotMountPointAttach(targetpath string) (bool, error) {
+	notMnt, err := m.BaseMounter.IsLikelyNotMountPoint(targetpath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return notMnt, err
+	}
+	if notMnt {
+		if err := os.Remove(targetpath); err != nil {
+			return notMnt, fmt.Errorf("failed to remove directory %s before mounting: %v", targetpath, err)
+		}
+	}
+	return notMnt, nil
+}
+
+// GetMountFs returns the number of the disk of the volume the path is linked to.
+func (m *Mount) GetMountFs(volumePath string) ([]byte, error) {
+	out, err := powershell(m.BaseMounter.Exec,
+		`$p = $env:mountpath; while ($t = (Get-Item -Path $p).Target) { $p = @($t)[0] }; (Get-Partition | Where-Object { $_.AccessPaths -contains $p }).DiskNumber`,
+		fmt.Sprintf("mountpath=%s", volumePath))
+	return []byte(out), err
+}
+
+func (m *Mount) GetDeviceStats(path string) (*DeviceStats, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var available, total, free uint64
+	if err := windows.GetDiskFreeSpaceEx(pathPtr, &available, &total, &free); err != nil {
+		return nil, err
+	}
+
+	// NTFS has no inodes
+	return &DeviceStats{
+		Block: false,
+
+		AvailableBytes: int64(available),
+		TotalBytes:     int64(total),
+		UsedBytes:      int64(total) - int64(free),
+	}, nil
+}
+
+// resizeFs resizes the NTFS partition of a disk, specified by its number.
+type resizeFs struct {
+	exec exec.Interface
+}
+
+// partitionSizes prints the size of the data partition of the disk and the
+// maximum size it can be resized to
+const partitionSizes = `$p = Get-Disk -Number $env:disk | Get-Partition | Where-Object Type -ne 'Reserved';` +
+	` $max = ($p | Get-PartitionSupportedSize).SizeMax;`
+
+// NewResizeFs returns the Resizer of the NTFS partitions
+func NewResizeFs(exec exec.Interface) Resizer {
+	return &resizeFs{exec: exec}
+}
+
+func (r *resizeFs) NeedResize(diskNumber string, _ string) (bool, error) {
+	// partitions smaller than the maximum size by less than 1 MiB can not be
+	// resized because of the alignment
+	out, err := powershell(r.exec, partitionSizes+` $p.Size -lt ($max - 1MB)`, fmt.Sprintf("disk=%s", diskNumber))
+	if err != nil {
+		return false, err
+	}
+	return strings.EqualFold(out, "true"), nil
+}
+
+func (r *resizeFs) Resize(diskNumber string, deviceMountPath string) (bool, error) {
+	needResize, err := r.NeedResize(diskNumber, deviceMountPath)
+	if err != nil || !needResize {
+		return false, err
+	}
+
+	if _, err := powershell(r.exec, partitionSizes+` Resize-Partition -InputObject $p -Size $max`, fmt.Sprintf("disk=%s", diskNumber)); err != nil {
+		return false, err
+	}
+	klog.V(2).Infof("Resized the partition of disk %s", diskNumber)
+	return true, nil
+}
@@ -8,9 +8,13 @@ import (
 	"time"
 
 	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/attachments"
 	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/backups"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/qos"
 	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/snapshots"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/transfers"
 	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumetypes"
 	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
 	"k8s.io/cloud-provider-openstack/pkg/csi/cinder"
 	"k8s.io/cloud-provider-openstack/pkg/csi/cinder/openstack"
@@ -119,6 +123,10 @@ func (cloud *cloud) WaitVolumeTargetStatus(_ context.Context, volumeID string, t
 	return nil
 }
 
+func (cloud *cloud) WaitVolumeTargetStatusWithTimeout(_ context.Context, volumeID string, tStatus []string, timeout time.Duration) error {
+	return nil
+}
+
 func (cloud *cloud) GetAttachmentDiskPath(_ context.Context, instanceID, volumeID string) (string, error) {
 	return cinder.FakeDevicePath, nil
 }
@@ -241,7 +249,7 @@ func (cloud *cloud) GetSnapshotByID(_ context.Context, snapshotID string) (*snap
 	return snap, nil
 }
 
-func (cloud *cloud) WaitSnapshotReady(_ context.Context, snapshotID string) (string, error) {
+func (cloud *cloud) WaitSnapshotReady(_ context.Context, snapshotID string, _ func(*snapshots.Snapshot)) (string, error) {
 	return "available", nil
 }
 
@@ -346,6 +354,16 @@ func (cloud *cloud) ExpandVolume(_ context.Context, volumeID string, status stri
 	return nil
 }
 
+func (cloud *cloud) ChangeVolumeType(_ context.Context, volumeID string, volumeType string, _ string) error {
+	vol, ok := cloud.volumes[volumeID]
+	if !ok {
+		return notFoundError()
+	}
+
+	vol.VolumeType = volumeType
+	return nil
+}
+
 func (cloud *cloud) GetMaxVolLimit() int64 {
 	return 256
 }
@@ -363,3 +381,65 @@ func (cloud *cloud) GetBlockStorageOpts() openstack.BlockStorageOpts {
 func (cloud *cloud) ResolveVolumeListToUUIDs(_ context.Context, v string) (string, error) {
 	return v, nil
 }
+
+func (cloud *cloud) GetVolumeTypeEncryption(_ context.Context, _ string) (*volumetypes.GetEncryptionType, error) {
+	return nil, nil
+}
+
+func (cloud *cloud) GetSecretPayload(_ context.Context, _ string) ([]byte, error) {
+	return nil, notFoundError()
+}
+
+func (cloud *cloud) GetQoSSpecs(_ context.Context, _ string) (*qos.QoS, error) {
+	return nil, errors.ErrNotFound
+}
+
+func (cloud *cloud) GetVolumeTypeQoSSpecs(_ context.Context, _ string) (*qos.QoS, error) {
+	return nil, nil
+}
+
+func (cloud *cloud) GetVolumeQuota(_ context.Context, _ string) (*openstack.VolumeQuota, error) {
+	return &openstack.VolumeQuota{
+		AvailableGB:        openstack.UnlimitedQuota,
+		MaxVolumeSizeGB:    openstack.UnlimitedQuota,
+		AvailableVolumes:   openstack.UnlimitedQuota,
+		AvailableSnapshots: openstack.UnlimitedQuota,
+	}, nil
+}
+
+func (cloud *cloud) CreateVolumeTransfer(_ context.Context, volumeID string) (*transfers.Transfer, error) {
+	return nil, notFoundError()
+}
+
+func (cloud *cloud) AcceptVolumeTransfer(_ context.Context, _, _ string) error {
+	return notFoundError()
+}
+
+func (cloud *cloud) DeleteVolumeTransfer(_ context.Context, _ string) error {
+	return nil
+}
+
+func (cloud *cloud) UpdateVolumeMetadata(_ context.Context, _ string, _ map[string]string) error {
+	return nil
+}
+
+func (cloud *cloud) CreateVolumeAttachment(_ context.Context, _, _ string, _ map[string]any) (*attachments.Attachment, error) {
+	return nil, notFoundError()
+}
+
+func (cloud *cloud) DeleteVolumeAttachments(_ context.Context, _, _ string) error {
+	return nil
+}
+
+func (cloud *cloud) VolumeAttachedByCompute(_ context.Context, instanceID, volumeID string) (bool, error) {
+	vol, ok := cloud.volumes[volumeID]
+	if !ok {
+		return false, nil
+	}
+	for _, att := range vol.Attachments {
+		if att.ServerID == instanceID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -51,7 +51,7 @@ func (m *fakemount) GetInstanceID() (string, error) {
 	return cinder.FakeInstanceID, nil
 }
 
-func (m *fakemount) GetDevicePath(volumeID string) (string, error) {
+func (m *fakemount) GetDevicePath(volumeID string, opts cpomount.DeviceWaitOpts) (string, error) {
 	return cinder.FakeDevicePath, nil
 }
 
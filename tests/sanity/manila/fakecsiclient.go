@@ -30,9 +30,10 @@ import (
 )
 
 var (
-	_ csiclient.Builder  = &fakeCSIClientBuilder{}
-	_ csiclient.Identity = &fakeIdentitySvcClient{}
-	_ csiclient.Node     = &fakeNodeSvcClient{}
+	_ csiclient.Builder    = &fakeCSIClientBuilder{}
+	_ csiclient.Identity   = &fakeIdentitySvcClient{}
+	_ csiclient.Node       = &fakeNodeSvcClient{}
+	_ csiclient.Controller = &fakeControllerSvcClient{}
 )
 
 type fakeIdentitySvcClient struct{}
@@ -98,6 +99,16 @@ func (c fakeNodeSvcClient) UnpublishVolume(ctx context.Context, req *csi.NodeUnp
 	return &csi.NodeUnpublishVolumeResponse{}, nil
 }
 
+type fakeControllerSvcClient struct{}
+
+func (c fakeControllerSvcClient) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
+	return &csi.CreateVolumeResponse{Volume: &csi.Volume{VolumeId: req.GetName(), CapacityBytes: req.GetCapacityRange().GetRequiredBytes()}}, nil
+}
+
+func (c fakeControllerSvcClient) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
+	return &csi.DeleteVolumeResponse{}, nil
+}
+
 type fakeCSIClientBuilder struct{}
 
 func (b fakeCSIClientBuilder) NewConnection(string) (*grpc.ClientConn, error) {
@@ -112,6 +123,10 @@ func (b fakeCSIClientBuilder) NewNodeServiceClient(conn *grpc.ClientConn) csicli
 	return &fakeNodeSvcClient{}
 }
 
+func (b fakeCSIClientBuilder) NewControllerServiceClient(conn *grpc.ClientConn) csiclient.Controller {
+	return &fakeControllerSvcClient{}
+}
+
 func (b fakeCSIClientBuilder) NewIdentityServiceClient(conn *grpc.ClientConn) csiclient.Identity {
 	return &fakeIdentitySvcClient{}
 }
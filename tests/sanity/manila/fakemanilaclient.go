@@ -23,6 +23,10 @@ import (
 
 	"github.com/gophercloud/gophercloud/v2"
 	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/messages"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/replicas"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/schedulerstats"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/services"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/sharenetworks"
 	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shares"
 	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/sharetypes"
 	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/snapshots"
@@ -74,6 +78,10 @@ func (c fakeManilaClient) GetMicroversion() string {
 func (c fakeManilaClient) SetMicroversion(_ string) {
 }
 
+func (c fakeManilaClient) SupportsMicroversion(_ string) bool {
+	return true
+}
+
 func (c fakeManilaClient) GetShareByID(_ context.Context, shareID string) (*shares.Share, error) {
 	s, ok := fakeShares[strToInt(shareID)]
 	if !ok {
@@ -99,6 +107,15 @@ func (c fakeManilaClient) GetShareByName(ctx context.Context, shareName string)
 	return c.GetShareByID(ctx, shareID)
 }
 
+func (c fakeManilaClient) GetShares(_ context.Context, opts shares.ListOptsBuilder) ([]shares.Share, error) {
+	var ss []shares.Share
+	for _, share := range fakeShares {
+		ss = append(ss, *share)
+	}
+
+	return ss, nil
+}
+
 func (c fakeManilaClient) CreateShare(_ context.Context, opts shares.CreateOptsBuilder) (*shares.Share, error) {
 	var res shares.CreateResult
 	res.Body = opts
@@ -129,6 +146,10 @@ func (c fakeManilaClient) DeleteShare(_ context.Context, shareID string) error {
 	return nil
 }
 
+func (c fakeManilaClient) ForceDeleteShare(ctx context.Context, shareID string) error {
+	return c.DeleteShare(ctx, shareID)
+}
+
 func (c fakeManilaClient) ExtendShare(ctx context.Context, shareID string, opts shares.ExtendOptsBuilder) error {
 	share, err := c.GetShareByID(ctx, shareID)
 	if err != nil {
@@ -164,6 +185,10 @@ func (c fakeManilaClient) SetShareMetadata(_ context.Context, shareID string, op
 	return nil, nil
 }
 
+func (c fakeManilaClient) DeleteShareMetadatum(_ context.Context, shareID, key string) error {
+	return nil
+}
+
 func (c fakeManilaClient) GetExtraSpecs(_ context.Context, shareTypeID string) (sharetypes.ExtraSpecs, error) {
 	return map[string]interface{}{"snapshot_support": "True", "create_share_from_snapshot_support": "True"}, nil
 }
@@ -222,6 +247,22 @@ func (c fakeManilaClient) GrantAccess(_ context.Context, shareID string, opts sh
 	return accessRight, nil
 }
 
+func (c fakeManilaClient) RevokeAccess(_ context.Context, shareID string, opts shares.RevokeAccessOptsBuilder) error {
+	if !shareExists(shareID) {
+		return gophercloud.ErrResourceNotFound{}
+	}
+
+	optsMap, err := opts.ToRevokeAccessMap()
+	if err != nil {
+		return err
+	}
+
+	accessID, _ := optsMap["deny_access"].(map[string]any)["access_id"].(string)
+	delete(fakeAccessRights, strToInt(accessID))
+
+	return nil
+}
+
 func (c fakeManilaClient) GetSnapshotByID(_ context.Context, snapID string) (*snapshots.Snapshot, error) {
 	s, ok := fakeSnapshots[strToInt(snapID)]
 	if !ok {
@@ -259,10 +300,14 @@ func (c fakeManilaClient) CreateSnapshot(_ context.Context, opts snapshots.Creat
 	snap.ID = intToStr(fakeSnapshotID)
 	snap.Status = "available"
 
-	if !shareExists(snap.ShareID) {
+	share, ok := fakeShares[strToInt(snap.ShareID)]
+	if !ok {
 		return nil, gophercloud.ErrUnexpectedResponseCode{Actual: 404}
 	}
 
+	snap.ShareProto = share.ShareProto
+	snap.ShareSize = share.Size
+
 	fakeSnapshots[fakeSnapshotID] = snap
 	fakeSnapshotID++
 
@@ -279,6 +324,66 @@ func (c fakeManilaClient) DeleteSnapshot(_ context.Context, snapID string) error
 	return nil
 }
 
+func (c fakeManilaClient) GetShareGroupSnapshotByID(_ context.Context, groupSnapshotID string) (*manilaclient.ShareGroupSnapshot, error) {
+	return nil, gophercloud.ErrResourceNotFound{}
+}
+
+func (c fakeManilaClient) GetShareGroupSnapshotByName(_ context.Context, groupSnapshotName string) (*manilaclient.ShareGroupSnapshot, error) {
+	return nil, gophercloud.ErrResourceNotFound{}
+}
+
+func (c fakeManilaClient) CreateShareGroupSnapshot(_ context.Context, opts manilaclient.CreateShareGroupSnapshotOpts) (*manilaclient.ShareGroupSnapshot, error) {
+	return nil, gophercloud.ErrUnexpectedResponseCode{Actual: 400}
+}
+
+func (c fakeManilaClient) DeleteShareGroupSnapshot(_ context.Context, groupSnapshotID string) error {
+	return gophercloud.ErrResourceNotFound{}
+}
+
+func (c fakeManilaClient) GetReplicas(_ context.Context, shareID string) ([]replicas.Replica, error) {
+	return nil, nil
+}
+
+func (c fakeManilaClient) CreateReplica(_ context.Context, opts replicas.CreateOptsBuilder) (*replicas.Replica, error) {
+	return nil, gophercloud.ErrUnexpectedResponseCode{Actual: 400}
+}
+
+func (c fakeManilaClient) DeleteReplica(_ context.Context, replicaID string) error {
+	return gophercloud.ErrResourceNotFound{}
+}
+
+func (c fakeManilaClient) PromoteReplica(_ context.Context, replicaID string) error {
+	return gophercloud.ErrResourceNotFound{}
+}
+
+func (c fakeManilaClient) GetShareNetworkByID(_ context.Context, shareNetworkID string) (*sharenetworks.ShareNetwork, error) {
+	return nil, gophercloud.ErrResourceNotFound{}
+}
+
+func (c fakeManilaClient) GetShareNetworks(_ context.Context, opts sharenetworks.ListOptsBuilder) ([]sharenetworks.ShareNetwork, error) {
+	return nil, nil
+}
+
+func (c fakeManilaClient) GetNetworkIDsByTag(_ context.Context, tag string) ([]string, error) {
+	return nil, nil
+}
+
+func (c fakeManilaClient) GetSubnetCIDRs(_ context.Context) ([]string, error) {
+	return nil, nil
+}
+
 func (c fakeManilaClient) GetUserMessages(_ context.Context, opts messages.ListOptsBuilder) ([]messages.Message, error) {
 	return nil, nil
 }
+
+func (c fakeManilaClient) GetLimits(_ context.Context) (*manilaclient.Limits, error) {
+	return &manilaclient.Limits{MaxTotalShareGigabytes: -1, MaxTotalShares: -1}, nil
+}
+
+func (c fakeManilaClient) GetPools(_ context.Context, opts schedulerstats.ListDetailOptsBuilder) ([]schedulerstats.Pool, error) {
+	return nil, gophercloud.ErrUnexpectedResponseCode{Actual: 403}
+}
+
+func (c fakeManilaClient) GetServices(_ context.Context, opts services.ListOptsBuilder) ([]services.Service, error) {
+	return nil, gophercloud.ErrUnexpectedResponseCode{Actual: 403}
+}
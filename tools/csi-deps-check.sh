@@ -40,3 +40,4 @@ set -o errexit
 # go mod k8s.io/cloud-provider-openstack/pkg/util/mount
 /bin/udevadm --version
 /bin/findmnt -V
+/sbin/cryptsetup --version
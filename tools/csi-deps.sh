@@ -100,3 +100,4 @@ cp /bin/btrfs* ${DEST}/bin/
 copy_deps /bin/udevadm
 copy_deps /lib/udev/rules.d
 copy_deps /bin/findmnt
+copy_deps /sbin/cryptsetup